@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serve answers every request on listener with response and counts the requests
+func serve(listener net.Listener, response CommandResponse, requests *int32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		var req CommandRequest
+		if err := json.NewDecoder(conn).Decode(&req); err == nil {
+			atomic.AddInt32(requests, 1)
+			data, _ := json.Marshal(response)
+			conn.Write(data)
+		}
+		conn.Close()
+	}
+}
+
+func TestSendCommandRetriesUntilSocketIsUp(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cmd.sock")
+	var requests int32
+
+	// The service comes up only after the first connection attempt has failed
+	started := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			close(started)
+			return
+		}
+		started <- listener
+		serve(listener, CommandResponse{Code: 202, Status: "Accepted", ID: "cmd-1"}, &requests)
+	}()
+	t.Cleanup(func() {
+		if listener, ok := <-started; ok {
+			listener.Close()
+		}
+	})
+
+	client := NewClient(socketPath, time.Second).WithRetry(5, 100*time.Millisecond)
+	response, err := client.SendCommand(context.Background(), "update_cron_schedules", nil)
+	if err != nil {
+		t.Fatalf("expected the retry to be transparent, got error: %v", err)
+	}
+	if response.Code != 202 || response.ID != "cmd-1" {
+		t.Errorf("expected 202 cmd-1, got %d %s", response.Code, response.ID)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected the command to be sent once, got %d", got)
+	}
+}
+
+func TestSendCommandDoesNotRetryRejectedCommand(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cmd.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var requests int32
+	go serve(listener, CommandResponse{Code: 400, Status: "Bad Request", Message: "invalid schedule"}, &requests)
+
+	client := NewClient(socketPath, time.Second).WithRetry(5, 10*time.Millisecond)
+	response, err := client.SendCommand(context.Background(), "update_cron_schedules", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if response.Code != 400 {
+		t.Errorf("expected 400, got %d", response.Code)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected a rejected command to be sent once, got %d", got)
+	}
+}
+
+func TestSendCommandGivesUpAfterRetries(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "missing.sock")
+
+	client := NewClient(socketPath, time.Second).WithRetry(3, time.Millisecond)
+	_, err := client.SendCommand(context.Background(), "update_cron_schedules", nil)
+
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("expected ConnectError, got %v", err)
+	}
+}
+
+func TestSendCommandReconnectsAfterServiceRestart(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cmd.sock")
+	var requests int32
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go serve(listener, CommandResponse{Code: 202, Status: "Accepted", ID: "cmd-1"}, &requests)
+
+	client := NewClient(socketPath, time.Second).WithRetry(5, 50*time.Millisecond)
+	if _, err := client.SendCommand(context.Background(), "update_cron_schedules", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// systemd restarts the service: the socket closes and comes back a little later
+	listener.Close()
+	restarted := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			close(restarted)
+			return
+		}
+		restarted <- listener
+		serve(listener, CommandResponse{Code: 202, Status: "Accepted", ID: "cmd-2"}, &requests)
+	}()
+	t.Cleanup(func() {
+		if listener, ok := <-restarted; ok {
+			listener.Close()
+		}
+	})
+
+	response, err := client.SendCommand(context.Background(), "update_cron_schedules", nil)
+	if err != nil {
+		t.Fatalf("expected the client to reconnect, got error: %v", err)
+	}
+	if response.ID != "cmd-2" {
+		t.Errorf("expected the restarted service to answer with cmd-2, got %s", response.ID)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("expected 2 commands to be sent, got %d", got)
+	}
+}
+
+func TestSendCommandAbortedAtRequestDeadline(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "cmd.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// A wedged service reads the command but never answers
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req CommandRequest
+		json.NewDecoder(conn).Decode(&req)
+		<-done
+	}()
+
+	client := NewClient(socketPath, 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err = client.SendCommand(ctx, "update_cron_schedules", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the command to be aborted at the deadline, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("expected the command to give up at the deadline, it took %s", elapsed)
+	}
+}
@@ -3,25 +3,61 @@ package dbcmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"syscall"
 	"time"
 )
 
 // Client communicates with the dbcalm-db-cmd Unix socket service
 type Client struct {
-	socketPath string
-	timeout    time.Duration
+	socketPath    string
+	timeout       time.Duration
+	retryAttempts int
+	retryBackoff  time.Duration
+}
+
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = 200 * time.Millisecond
+)
+
+// ConnectError means the socket could not be reached, so the command was never sent
+type ConnectError struct {
+	SocketPath string
+	Err        error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("failed to connect to socket %s: %v", e.SocketPath, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
 }
 
 // NewClient creates a new socket client
 func NewClient(socketPath string, timeout time.Duration) *Client {
 	return &Client{
-		socketPath: socketPath,
-		timeout:    timeout,
+		socketPath:    socketPath,
+		timeout:       timeout,
+		retryAttempts: DefaultRetryAttempts,
+		retryBackoff:  DefaultRetryBackoff,
 	}
 }
 
+// WithRetry sets how often connecting is attempted while the socket is unavailable,
+// e.g. during a service restart. The backoff doubles after every attempt.
+func (c *Client) WithRetry(attempts int, backoff time.Duration) *Client {
+	if attempts < 1 {
+		attempts = 1
+	}
+	c.retryAttempts = attempts
+	c.retryBackoff = backoff
+	return c
+}
+
 // CommandRequest represents a command sent to the socket
 type CommandRequest struct {
 	Cmd  string                 `json:"cmd"`
@@ -30,18 +66,23 @@ type CommandRequest struct {
 
 // CommandResponse represents a response from the socket
 type CommandResponse struct {
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
-	ID      string `json:"id,omitempty"`
-	Message string `json:"message,omitempty"`
+	Code    int                    `json:"code"`
+	Status  string                 `json:"status"`
+	ID      string                 `json:"id,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
 }
 
-// SendCommand sends a command to the Unix socket and waits for response
+// SendCommand sends a command to the Unix socket and waits for response.
+// Connecting is retried while the socket is unavailable; once the command has been
+// sent it is never retried, and a rejected command is returned as a normal response.
+// Cancelling ctx, as a request timeout does, closes the connection and aborts the
+// command without waiting for the socket timeout.
 func (c *Client) SendCommand(ctx context.Context, cmd string, args map[string]interface{}) (*CommandResponse, error) {
 	// Connect to the Unix socket
-	conn, err := net.DialTimeout("unix", c.socketPath, c.timeout)
+	conn, err := c.dial(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to socket %s: %w", c.socketPath, err)
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -49,6 +90,8 @@ func (c *Client) SendCommand(ctx context.Context, cmd string, args map[string]in
 	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
 		return nil, fmt.Errorf("failed to set deadline: %w", err)
 	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
 
 	// Prepare request
 	request := CommandRequest{
@@ -63,6 +106,9 @@ func (c *Client) SendCommand(ctx context.Context, cmd string, args map[string]in
 	}
 
 	if _, err := conn.Write(requestBytes); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command %s aborted: %w", cmd, ctx.Err())
+		}
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
@@ -70,6 +116,9 @@ func (c *Client) SendCommand(ctx context.Context, cmd string, args map[string]in
 	buffer := make([]byte, 4096)
 	n, err := conn.Read(buffer)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command %s aborted: %w", cmd, ctx.Err())
+		}
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
@@ -81,3 +130,36 @@ func (c *Client) SendCommand(ctx context.Context, cmd string, args map[string]in
 
 	return &response, nil
 }
+
+// dial connects to the socket, retrying with backoff while the service is not listening
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	backoff := c.retryBackoff
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		var conn net.Conn
+		dialer := net.Dialer{Timeout: c.timeout}
+		conn, err = dialer.DialContext(ctx, "unix", c.socketPath)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= c.retryAttempts || !retryableDialError(err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, &ConnectError{SocketPath: c.socketPath, Err: ctx.Err()}
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return nil, &ConnectError{SocketPath: c.socketPath, Err: err}
+}
+
+// retryableDialError reports whether the service is (re)starting: the socket file is
+// missing or nothing is listening on it yet
+func retryableDialError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+}
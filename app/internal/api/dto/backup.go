@@ -4,24 +4,62 @@ import "time"
 
 // CreateBackupRequest represents the backup creation request
 type CreateBackupRequest struct {
-	Type         string  `json:"type" binding:"required,oneof=full incremental"` // "full" or "incremental"
-	BackupID     *string `json:"backup_id"`                                       // Optional custom ID
-	FromBackupID *string `json:"from_backup_id"`                                  // For incremental backups
-	ScheduleID   *int64  `json:"schedule_id"`                                     // For scheduled backups
+	Type         string  `json:"type" binding:"omitempty,oneof=full incremental"`     // "full" or "incremental", defaults to the schedule's type
+	BackupID     *string `json:"backup_id"`                                           // Optional custom ID
+	FromBackupID *string `json:"from_backup_id"`                                      // For incremental backups
+	ScheduleID   *int64  `json:"schedule_id"`                                         // Runs the backup with the schedule's settings, as cron would
+	Strategy     string  `json:"strategy" binding:"omitempty,oneof=physical logical"` // Defaults to the schedule's strategy, then physical
+	Description  *string `json:"description" binding:"omitempty,max=500"`             // Optional note on why the backup was taken
+}
+
+// ConsolidateBackupRequest represents the request to consolidate an incremental chain
+type ConsolidateBackupRequest struct {
+	BackupID *string `json:"backup_id"` // Optional ID for the new full backup
+	Retire   bool    `json:"retire"`    // Remove the chain once the new backup is in place
+}
+
+// UpdateBackupRequest represents the request to update a backup. The retention override is
+// the only field that can change, null or leaving it out clears it.
+type UpdateBackupRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"` // Keeps the backup and its chain until then
+}
+
+// BackupEstimateResponse is how long the next backup of a type is expected to take. The
+// estimate fields are omitted when there are too few completed backups to go by.
+type BackupEstimateResponse struct {
+	Type                     string   `json:"type"`
+	Strategy                 string   `json:"strategy"`
+	Samples                  int      `json:"samples"` // Recent completed backups the estimate is based on
+	AverageDurationSeconds   *float64 `json:"average_duration_seconds,omitempty"`
+	SizeTrendBytesPerDay     *float64 `json:"size_trend_bytes_per_day,omitempty"`
+	EstimatedSize            *int64   `json:"estimated_size,omitempty"`
+	EstimatedDurationSeconds *float64 `json:"estimated_duration_seconds,omitempty"`
 }
 
 // BackupResponse represents a backup
 type BackupResponse struct {
-	ID             string     `json:"id"`
-	Type           string     `json:"-"` // Not sent in JSON, derived field
-	FromBackupID   *string    `json:"from_backup_id,omitempty"`
-	ScheduleID     *int64     `json:"schedule_id,omitempty"`
-	StartTime      time.Time  `json:"start_time"`
-	EndTime        *time.Time `json:"end_time,omitempty"`
-	ProcessID      int64      `json:"-"` // Not sent in JSON
-	Size           *int64     `json:"-"` // Not sent in JSON
-	RetentionValue *int       `json:"retention_value,omitempty"`
-	RetentionUnit  *string    `json:"retention_unit,omitempty"`
+	ID                 string     `json:"id"`
+	Type               string     `json:"type"`                     // full or incremental, always present
+	FromBackupID       *string    `json:"from_backup_id,omitempty"` // Omitted for full backups
+	ScheduleID         *int64     `json:"schedule_id,omitempty"`
+	Strategy           string     `json:"strategy"`
+	ExcludedDatabases  []string   `json:"excluded_databases,omitempty"`
+	Description        *string    `json:"description,omitempty"`
+	Source             *string    `json:"source,omitempty"`              // primary or replica, omitted when db-cmd has no source configured
+	VerificationStatus *string    `json:"verification_status,omitempty"` // "passed" or "failed", omitted until verified
+	LastVerifiedAt     *time.Time `json:"last_verified_at,omitempty"`
+	Healthy            bool       `json:"healthy"`         // False once verification failed
+	GrantsCaptured     bool       `json:"grants_captured"` // Users and grants were captured, so restore_mode grants can apply them
+	StartTime          time.Time  `json:"start_time"`
+	EndTime            *time.Time `json:"end_time,omitempty"`
+	ProcessID          int64      `json:"-"`                 // Not sent in JSON
+	Size               *int64     `json:"-"`                 // Not sent in JSON
+	CompressionRatio   *float64   `json:"compression_ratio"` // Uncompressed size over size on disk, null when not compressed
+	RestoreCount       int        `json:"restore_count"`
+	LastRestoredAt     *time.Time `json:"last_restored_at"`
+	RetentionValue     *int       `json:"retention_value,omitempty"`
+	RetentionUnit      *string    `json:"retention_unit,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"` // Retention override, omitted when unset
 }
 
 // BackupListResponse represents a list of backups
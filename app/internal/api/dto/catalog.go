@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+// CatalogBackupResponse represents a snapshot of the dbcalm catalog
+type CatalogBackupResponse struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"` // In bytes
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CatalogRestoreRequest represents the catalog restore request
+type CatalogRestoreRequest struct {
+	Name string `json:"name" binding:"required"` // A snapshot name returned by POST /system/catalog-backup
+}
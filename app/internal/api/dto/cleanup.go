@@ -4,3 +4,18 @@ package dto
 type CleanupRequest struct {
 	ScheduleID *int64 `json:"schedule_id,omitempty"` // Optional: cleanup specific schedule
 }
+
+// CleanupResponse is the async cleanup response plus each schedule's outcome when
+// cleaning up all schedules
+type CleanupResponse struct {
+	AsyncResponse
+	Schedules []CleanupScheduleOutcome `json:"schedules,omitempty"`
+}
+
+// CleanupScheduleOutcome reports a single schedule's part in a cleanup run
+type CleanupScheduleOutcome struct {
+	ScheduleID     int64  `json:"schedule_id"`
+	Status         string `json:"status"` // "succeeded", "skipped" or "error"
+	Reason         string `json:"reason,omitempty"`
+	ExpiredBackups int    `json:"expired_backups"`
+}
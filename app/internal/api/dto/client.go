@@ -4,12 +4,14 @@ import "time"
 
 // CreateClientRequest represents the client creation request
 type CreateClientRequest struct {
-	Label string `json:"label" binding:"required"`
+	Label  string   `json:"label" binding:"required"`
+	Scopes []string `json:"scopes"` // Omitted grants all scopes
 }
 
 // UpdateClientRequest represents the client update request
 type UpdateClientRequest struct {
-	Label string `json:"label" binding:"required"`
+	Label  string   `json:"label" binding:"required"`
+	Scopes []string `json:"scopes"` // Omitted keeps the current scopes
 }
 
 // ClientResponse represents a client
@@ -2,7 +2,14 @@ package dto
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code,omitempty"`
+	Error   string       `json:"error"`
+	Message string       `json:"message,omitempty"`
+	Code    int          `json:"code,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"` // Every invalid field of a 422
+}
+
+// FieldError names an invalid request field and why it was rejected
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
 }
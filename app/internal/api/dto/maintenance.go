@@ -0,0 +1,18 @@
+package dto
+
+import "time"
+
+// MaintenanceRequest represents the maintenance-mode toggle request
+type MaintenanceRequest struct {
+	Enabled     *bool   `json:"enabled" binding:"required"`
+	BlockManual *bool   `json:"block_manual,omitempty"` // Also refuse manual backups/restores, defaults to true
+	Reason      *string `json:"reason,omitempty"`
+}
+
+// MaintenanceResponse represents the maintenance-mode state
+type MaintenanceResponse struct {
+	Enabled     bool      `json:"enabled"`
+	BlockManual bool      `json:"block_manual"`
+	Reason      *string   `json:"reason,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
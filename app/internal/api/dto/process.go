@@ -16,8 +16,13 @@ type ProcessResponse struct {
 	EndTime    *time.Time             `json:"end_time,omitempty"`
 	Type       string                 `json:"type"`
 	Args       map[string]interface{} `json:"args,omitempty"`
-	Link       *string                `json:"link,omitempty"`       // Link to status endpoint
-	ResourceID *string                `json:"resource_id,omitempty"` // Extracted from args["id"]
+	Progress   *int                   `json:"progress,omitempty"` // 0-100, restores only
+	Phase      *string                `json:"phase,omitempty"`    // copying, preparing, copying-back
+	ScheduleID *int64                 `json:"schedule_id,omitempty"`
+	RetryOf    *string                `json:"retry_of,omitempty"`    // Command ID of the failed process this one retries
+	Link       *string                `json:"link,omitempty"`        // Link to status endpoint
+	ResourceID *string                `json:"resource_id,omitempty"` // Backup, restored backup or cleaned up schedule
+	Metadata   map[string]interface{} `json:"metadata"`              // resource_id, chain_length, target, size
 }
 
 // ProcessListResponse represents a list of processes
@@ -26,11 +31,28 @@ type ProcessListResponse struct {
 	Pagination PaginationInfo    `json:"pagination"`
 }
 
+// ProcessUsageResponse is the live resource usage of a running process. CPU time and IO
+// are totals since it started.
+type ProcessUsageResponse struct {
+	CommandID          string  `json:"command_id"`
+	PID                int     `json:"pid"`
+	State              string  `json:"state"` // R running, S sleeping, D waiting on disk IO
+	Threads            int     `json:"threads"`
+	ElapsedSeconds     float64 `json:"elapsed_seconds"`
+	CPUUserSeconds     float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds   float64 `json:"cpu_system_seconds"`
+	BlockIOWaitSeconds float64 `json:"block_io_wait_seconds"` // Zero without kernel delay accounting
+	RSSBytes           int64   `json:"rss_bytes"`
+	ReadBytes          int64   `json:"read_bytes"`
+	WriteBytes         int64   `json:"write_bytes"`
+}
+
 // AsyncResponse represents an async operation response (202 Accepted)
 // Matches Python StatusResponse format
 type AsyncResponse struct {
-	Status     string  `json:"status"`
-	Link       *string `json:"link,omitempty"`
-	PID        *string `json:"pid,omitempty"`
-	ResourceID *string `json:"resource_id,omitempty"`
+	Status     string                 `json:"status"`
+	Link       *string                `json:"link,omitempty"`
+	PID        *string                `json:"pid,omitempty"`
+	ResourceID *string                `json:"resource_id,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"` // e.g. promoted_to_full
 }
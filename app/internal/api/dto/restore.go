@@ -4,8 +4,19 @@ import "time"
 
 // CreateRestoreRequest represents the restore creation request
 type CreateRestoreRequest struct {
-	BackupID string `json:"id" binding:"required"` // Matches Python field name
-	Target   string `json:"target" binding:"required,oneof=database folder"` // "database" or "folder"
+	BackupID string `json:"id" binding:"required"`                            // Matches Python field name
+	Target   string `json:"target" binding:"omitempty,oneof=database folder"` // "database" or "folder", defaults to default_restore_target
+	// RestoreMode is "physical" (default), "logical" or "grants"; logical replays a dump into a
+	// running server, grants only the users and grants captured with the backup
+	RestoreMode string `json:"restore_mode" binding:"omitempty,oneof=logical physical grants"`
+	// TargetPath is the folder a folder restore is written to, outside backup_dir
+	TargetPath string `json:"target_path"`
+	// Databases limits the restore to these databases, all databases when empty
+	Databases []string `json:"databases"`
+	// Record false runs a throwaway folder restore without adding it to the restore history
+	Record *bool `json:"record"`
+	// Archive packs the prepared folder of a folder restore into a tar.zst archive
+	Archive bool `json:"archive"`
 }
 
 // RestoreResponse represents a restore
@@ -15,11 +26,24 @@ type RestoreResponse struct {
 	BackupTimestamp time.Time  `json:"backup_timestamp"`
 	Target          string     `json:"target"`
 	TargetPath      string     `json:"target_path"`
+	Archive         bool       `json:"archive"` // TargetPath is a tar.zst archive of the prepared folder
+	Mode            string     `json:"mode"`
+	Databases       []string   `json:"databases,omitempty"`
+	SafetyCopyPath  *string    `json:"safety_copy_path,omitempty"` // Copy of the data directory taken before a database restore
 	StartTime       time.Time  `json:"start_time"`
 	EndTime         *time.Time `json:"end_time,omitempty"`
 	ProcessID       int64      `json:"process_id"`
 }
 
+// RestorePlanResponse lists the backups a restore to target_time needs, in restore order
+type RestorePlanResponse struct {
+	TargetTime      time.Time        `json:"target_time"`
+	BackupTimestamp time.Time        `json:"backup_timestamp"` // Point in time the plan restores to, at or before target_time
+	Backups         []BackupResponse `json:"backups"`          // Full backup first
+	ChainLength     int              `json:"chain_length"`
+	TotalSize       int64            `json:"total_size"` // Bytes to prepare, backups without a recorded size count as 0
+}
+
 // RestoreListResponse represents a list of restores
 type RestoreListResponse struct {
 	Items      []RestoreResponse `json:"items"`
@@ -4,50 +4,101 @@ import "time"
 
 // CreateScheduleRequest represents the schedule creation request
 type CreateScheduleRequest struct {
-	BackupType     string  `json:"backup_type" binding:"required,oneof=full incremental"`
-	Frequency      string  `json:"frequency" binding:"required,oneof=daily weekly monthly hourly interval"`
-	DayOfWeek      *int    `json:"day_of_week,omitempty"`      // 0-6 (Sunday-Saturday)
-	DayOfMonth     *int    `json:"day_of_month,omitempty"`     // 1-31
-	Hour           *int    `json:"hour,omitempty"`             // 0-23
-	Minute         *int    `json:"minute,omitempty"`           // 0-59
-	IntervalValue  *int    `json:"interval_value,omitempty"`   // For interval frequency
-	IntervalUnit   *string `json:"interval_unit,omitempty"`    // "minutes" or "hours"
-	RetentionValue *int    `json:"retention_value,omitempty"`  // Retention period value
-	RetentionUnit  *string `json:"retention_unit,omitempty"`   // "days", "weeks", or "months"
-	Enabled        bool    `json:"enabled"`
+	BackupType         string   `json:"backup_type" binding:"required,oneof=full incremental"`
+	Frequency          string   `json:"frequency" binding:"required,oneof=daily weekly monthly hourly interval"`
+	DayOfWeek          *int     `json:"day_of_week,omitempty"`                                         // 0-6 (Sunday-Saturday)
+	DaysOfWeek         []int    `json:"days_of_week,omitempty"`                                        // Several days for weekly schedules, replaces day_of_week
+	DayOfMonth         *int     `json:"day_of_month,omitempty"`                                        // 1-31
+	Hour               *int     `json:"hour,omitempty"`                                                // 0-23
+	Minute             *int     `json:"minute,omitempty"`                                              // 0-59
+	IntervalValue      *int     `json:"interval_value,omitempty"`                                      // For interval frequency
+	IntervalUnit       *string  `json:"interval_unit,omitempty"`                                       // "minutes" or "hours"
+	RetentionValue     *int     `json:"retention_value,omitempty"`                                     // Retention period value
+	RetentionUnit      *string  `json:"retention_unit,omitempty"`                                      // "hours", "days", "weeks", or "months"
+	Strategy           *string  `json:"strategy,omitempty" binding:"omitempty,oneof=physical logical"` // Defaults to "physical"
+	ExcludeDatabases   []string `json:"exclude_databases,omitempty"`                                   // Databases left out of this schedule's backups
+	PreBackupHook      *string  `json:"pre_backup_hook,omitempty"`                                     // Must be inside db-cmd's hook_dir
+	PostBackupHook     *string  `json:"post_backup_hook,omitempty"`                                    // Must be inside db-cmd's hook_dir
+	VerifyOnCompletion bool     `json:"verify_on_completion"`                                          // Verify each backup right after it is taken
+	CredentialsSuffix  *string  `json:"credentials_suffix,omitempty"`                                  // Credentials file section, e.g. "-replica" for [client-replica]
+	WindowStart        *int     `json:"window_start,omitempty"`                                        // Hour an hourly or interval schedule's runs may start from, 0-23
+	WindowEnd          *int     `json:"window_end,omitempty"`                                          // Hour runs must start before, wraps past midnight when before window_start
+	Enabled            bool     `json:"enabled"`
+}
+
+// CreateSchedulePresetRequest creates the schedules of a preset together
+type CreateSchedulePresetRequest struct {
+	Preset        string `json:"preset" binding:"required,oneof=weekly_full_daily_incremental"`
+	DayOfWeek     *int   `json:"day_of_week" binding:"required"`          // Day of the full backup, 0-6 (Sunday-Saturday)
+	Hour          *int   `json:"hour" binding:"required"`                 // 0-23
+	Minute        *int   `json:"minute" binding:"required"`               // 0-59
+	RetentionDays int    `json:"retention_days" binding:"required,min=1"` // Days of backups kept restorable
+	Enabled       *bool  `json:"enabled,omitempty"`                       // Defaults to true
+}
+
+// CloneScheduleRequest is the optional body of POST /schedules/:id/clone
+type CloneScheduleRequest struct {
+	Enabled bool `json:"enabled"` // The copy is disabled by default
+}
+
+// SchedulePresetResponse lists the schedules a preset created
+type SchedulePresetResponse struct {
+	Preset      string             `json:"preset"`
+	PresetGroup string             `json:"preset_group"`
+	Schedules   []ScheduleResponse `json:"schedules"`
 }
 
 // UpdateScheduleRequest represents the schedule update request
 type UpdateScheduleRequest struct {
-	BackupType     *string `json:"backup_type,omitempty"`
-	Frequency      *string `json:"frequency,omitempty"`
-	DayOfWeek      *int    `json:"day_of_week,omitempty"`
-	DayOfMonth     *int    `json:"day_of_month,omitempty"`
-	Hour           *int    `json:"hour,omitempty"`
-	Minute         *int    `json:"minute,omitempty"`
-	IntervalValue  *int    `json:"interval_value,omitempty"`
-	IntervalUnit   *string `json:"interval_unit,omitempty"`
-	RetentionValue *int    `json:"retention_value,omitempty"`
-	RetentionUnit  *string `json:"retention_unit,omitempty"`
-	Enabled        *bool   `json:"enabled,omitempty"`
+	BackupType         *string   `json:"backup_type,omitempty"`
+	Frequency          *string   `json:"frequency,omitempty"`
+	DayOfWeek          *int      `json:"day_of_week,omitempty"`
+	DaysOfWeek         *[]int    `json:"days_of_week,omitempty"`
+	DayOfMonth         *int      `json:"day_of_month,omitempty"`
+	Hour               *int      `json:"hour,omitempty"`
+	Minute             *int      `json:"minute,omitempty"`
+	IntervalValue      *int      `json:"interval_value,omitempty"`
+	IntervalUnit       *string   `json:"interval_unit,omitempty"`
+	RetentionValue     *int      `json:"retention_value,omitempty"`
+	RetentionUnit      *string   `json:"retention_unit,omitempty"`
+	Strategy           *string   `json:"strategy,omitempty" binding:"omitempty,oneof=physical logical"`
+	ExcludeDatabases   *[]string `json:"exclude_databases,omitempty"` // An empty list clears the exclusions
+	PreBackupHook      *string   `json:"pre_backup_hook,omitempty"`   // An empty string clears the hook
+	PostBackupHook     *string   `json:"post_backup_hook,omitempty"`  // An empty string clears the hook
+	VerifyOnCompletion *bool     `json:"verify_on_completion,omitempty"`
+	CredentialsSuffix  *string   `json:"credentials_suffix,omitempty"` // An empty string selects db-cmd's default section
+	WindowStart        *int      `json:"window_start,omitempty"`       // -1 clears the window
+	WindowEnd          *int      `json:"window_end,omitempty"`         // -1 clears the window
+	Enabled            *bool     `json:"enabled,omitempty"`
 }
 
 // ScheduleResponse represents a schedule
 type ScheduleResponse struct {
-	ID             int64      `json:"id"`
-	BackupType     string     `json:"backup_type"`
-	Frequency      string     `json:"frequency"`
-	DayOfWeek      *int       `json:"day_of_week,omitempty"`
-	DayOfMonth     *int       `json:"day_of_month,omitempty"`
-	Hour           *int       `json:"hour,omitempty"`
-	Minute         *int       `json:"minute,omitempty"`
-	IntervalValue  *int       `json:"interval_value,omitempty"`
-	IntervalUnit   *string    `json:"interval_unit,omitempty"`
-	RetentionValue *int       `json:"retention_value,omitempty"`
-	RetentionUnit  *string    `json:"retention_unit,omitempty"`
-	Enabled        bool       `json:"enabled"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID                 int64     `json:"id"`
+	BackupType         string    `json:"backup_type"`
+	Frequency          string    `json:"frequency"`
+	DayOfWeek          *int      `json:"day_of_week,omitempty"`
+	DaysOfWeek         []int     `json:"days_of_week,omitempty"`
+	DayOfMonth         *int      `json:"day_of_month,omitempty"`
+	Hour               *int      `json:"hour,omitempty"`
+	Minute             *int      `json:"minute,omitempty"`
+	IntervalValue      *int      `json:"interval_value,omitempty"`
+	IntervalUnit       *string   `json:"interval_unit,omitempty"`
+	RetentionValue     *int      `json:"retention_value,omitempty"`
+	RetentionUnit      *string   `json:"retention_unit,omitempty"`
+	Strategy           string    `json:"strategy"`
+	ExcludeDatabases   []string  `json:"exclude_databases,omitempty"`
+	PreBackupHook      *string   `json:"pre_backup_hook,omitempty"`
+	PostBackupHook     *string   `json:"post_backup_hook,omitempty"`
+	VerifyOnCompletion bool      `json:"verify_on_completion"`
+	CredentialsSuffix  *string   `json:"credentials_suffix,omitempty"`
+	WindowStart        *int      `json:"window_start,omitempty"`
+	WindowEnd          *int      `json:"window_end,omitempty"`
+	Timezone           string    `json:"timezone"`               // Zone hour, minute and the window are in
+	PresetGroup        *string   `json:"preset_group,omitempty"` // Shared by the schedules a preset created
+	Enabled            bool      `json:"enabled"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
 }
 
 // ScheduleListResponse represents a list of schedules
@@ -55,3 +106,29 @@ type ScheduleListResponse struct {
 	Items      []ScheduleResponse `json:"items"`
 	Pagination PaginationInfo     `json:"pagination"`
 }
+
+// ScheduleHealthResponse lists the enabled schedules that need attention
+type ScheduleHealthResponse struct {
+	Items []ScheduleHealthItem `json:"items"`
+}
+
+// ScheduleHealthItem reports why a schedule needs attention
+type ScheduleHealthItem struct {
+	ScheduleID    int64      `json:"schedule_id"`
+	Status        string     `json:"status"` // "failed" or "overdue"
+	Reason        string     `json:"reason"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	LastRunStatus *string    `json:"last_run_status"`
+	NextRunAt     *time.Time `json:"next_run_at"`
+}
+
+// CronPreviewResponse is the cron file cmd would write for the enabled schedules
+type CronPreviewResponse struct {
+	Content   string `json:"content"`
+	Schedules int    `json:"schedules"`
+}
+
+// CronResyncResponse reports how many enabled schedules the cron file was rewritten with
+type CronResyncResponse struct {
+	Schedules int `json:"schedules"`
+}
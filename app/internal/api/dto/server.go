@@ -0,0 +1,39 @@
+package dto
+
+import "time"
+
+// ServerInfoResponse represents the database server as detected by db-cmd
+type ServerInfoResponse struct {
+	DbType          string    `json:"db_type"`
+	Version         string    `json:"version"`
+	DumpAvailable   bool      `json:"dump_available"`
+	ClientAvailable bool      `json:"client_available"`
+	Source          string    `json:"source,omitempty"` // primary or replica, omitted when not configured
+	DetectedAt      time.Time `json:"detected_at"`
+}
+
+// TestConnectionRequest selects the credentials section to test
+type TestConnectionRequest struct {
+	CredentialsSuffix *string `json:"credentials_suffix,omitempty"` // Defaults to db-cmd's configured section
+}
+
+// TestConnectionResponse reports whether db-cmd could connect with the credentials
+type TestConnectionResponse struct {
+	Connected         bool   `json:"connected"`
+	CredentialsSuffix string `json:"credentials_suffix"`
+	DbType            string `json:"db_type"`
+	Version           string `json:"version,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// DiskUsageResponse is the last check of backup_dir's filesystem, part of GET /health
+type DiskUsageResponse struct {
+	Path              string     `json:"path"`
+	State             string     `json:"state"` // unknown, ok, warning or critical
+	UsedPercent       float64    `json:"used_percent"`
+	InodesUsedPercent float64    `json:"inodes_used_percent"`
+	FreeBytes         uint64     `json:"free_bytes"`
+	FreeInodes        uint64     `json:"free_inodes"`
+	CheckedAt         *time.Time `json:"checked_at,omitempty"`
+	Error             string     `json:"error,omitempty"`
+}
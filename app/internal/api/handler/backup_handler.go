@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
@@ -17,13 +19,13 @@ import (
 
 // Allowed fields for backup queries and ordering
 var (
-	backupQueryFields = []string{"id", "from_backup_id", "schedule_id", "start_time", "end_time", "process_id"}
+	backupQueryFields = []string{"id", "type", "from_backup_id", "schedule_id", "strategy", "description", "verification_status", "verified", "healthy", "start_time", "end_time", "process_id"}
 	backupOrderFields = []string{"id", "start_time", "end_time"}
 )
 
 type BackupHandler struct {
-	backupService    *service.BackupService
-	scheduleRepo     repository.ScheduleRepository
+	backupService *service.BackupService
+	scheduleRepo  repository.ScheduleRepository
 }
 
 func NewBackupHandler(backupService *service.BackupService, scheduleRepo repository.ScheduleRepository) *BackupHandler {
@@ -45,13 +47,51 @@ func (h *BackupHandler) CreateBackup(c *gin.Context) {
 		return
 	}
 
+	// A schedule_id runs the backup cron would: the schedule's type and strategy unless the
+	// request picks them, its settings (applied by the service) and its retention
+	strategy := domain.BackupStrategy(req.Strategy)
+	if req.ScheduleID != nil {
+		schedule, err := h.scheduleRepo.FindByID(c.Request.Context(), *req.ScheduleID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error:   "Not Found",
+				Message: fmt.Sprintf("Schedule with id %d not found", *req.ScheduleID),
+				Code:    http.StatusNotFound,
+			})
+			return
+		}
+		if req.Type == "" {
+			req.Type = string(schedule.BackupType)
+		}
+		if strategy == "" {
+			strategy = schedule.Strategy
+		}
+	}
+	if req.Type == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "type is required without a schedule_id",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if req.Type == "incremental" && strategy == domain.BackupStrategyLogical {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "incremental backups are only supported with the physical strategy",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
 	var process *domain.Process
 	var err error
 
 	if req.Type == "full" {
-		process, err = h.backupService.CreateFullBackup(c.Request.Context(), req.BackupID, req.ScheduleID)
+		process, err = h.backupService.CreateFullBackup(c.Request.Context(), req.BackupID, req.ScheduleID, strategy, req.Description)
 	} else {
-		process, err = h.backupService.CreateIncrementalBackup(c.Request.Context(), req.BackupID, req.FromBackupID, req.ScheduleID)
+		process, err = h.backupService.CreateIncrementalBackup(c.Request.Context(), req.BackupID, req.FromBackupID, req.ScheduleID, req.Description)
 	}
 
 	if err != nil {
@@ -76,9 +116,10 @@ func (h *BackupHandler) CreateBackup(c *gin.Context) {
 	// Build response matching Python StatusResponse format
 	link := fmt.Sprintf("/status/%s", process.CommandID)
 	response := dto.AsyncResponse{
-		Status: string(process.Status),
-		Link:   &link,
-		PID:    &process.CommandID,
+		Status:   string(process.Status),
+		Link:     &link,
+		PID:      &process.CommandID,
+		Metadata: asyncMetadata(process),
 	}
 
 	// Add resource_id (backup_id) if provided in request
@@ -89,6 +130,83 @@ func (h *BackupHandler) CreateBackup(c *gin.Context) {
 	c.JSON(http.StatusAccepted, response)
 }
 
+// ConsolidateBackup handles POST /backups/:id/consolidate
+func (h *BackupHandler) ConsolidateBackup(c *gin.Context) {
+	var req dto.ConsolidateBackupRequest
+	// An empty body keeps the chain and generates the new backup's ID
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	process, err := h.backupService.ConsolidateBackup(c.Request.Context(), c.Param("id"), req.BackupID, req.Retire)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.AsyncResponse{
+			Status: err.Error(),
+		})
+		return
+	}
+
+	link := fmt.Sprintf("/status/%s", process.CommandID)
+	newID, _ := process.Args["id"].(string)
+	c.JSON(http.StatusAccepted, dto.AsyncResponse{
+		Status:     string(process.Status),
+		Link:       &link,
+		PID:        &process.CommandID,
+		ResourceID: &newID,
+		Metadata:   asyncMetadata(process),
+	})
+}
+
+// EstimateBackup handles GET /backups/estimate
+func (h *BackupHandler) EstimateBackup(c *gin.Context) {
+	backupType := domain.BackupType(c.DefaultQuery("type", string(domain.BackupTypeFull)))
+	strategy := domain.BackupStrategy(c.Query("strategy"))
+
+	estimate, err := h.backupService.EstimateBackup(c.Request.Context(), backupType, strategy, time.Now())
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	seconds := func(d *time.Duration) *float64 {
+		if d == nil {
+			return nil
+		}
+		s := math.Round(d.Seconds())
+		return &s
+	}
+	c.JSON(http.StatusOK, dto.BackupEstimateResponse{
+		Type:                     string(estimate.Type),
+		Strategy:                 string(estimate.Strategy),
+		Samples:                  estimate.Samples,
+		AverageDurationSeconds:   seconds(estimate.AverageDuration),
+		SizeTrendBytesPerDay:     estimate.SizeTrend,
+		EstimatedSize:            estimate.EstimatedSize,
+		EstimatedDurationSeconds: seconds(estimate.EstimatedDuration),
+	})
+}
+
 // GetBackup handles GET /backups/:id
 func (h *BackupHandler) GetBackup(c *gin.Context) {
 	id := c.Param("id")
@@ -106,6 +224,36 @@ func (h *BackupHandler) GetBackup(c *gin.Context) {
 	c.JSON(http.StatusOK, toBackupResponse(backup))
 }
 
+// UpdateBackup handles PATCH /backups/:id, setting or clearing its retention override
+func (h *BackupHandler) UpdateBackup(c *gin.Context) {
+	var req dto.UpdateBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	backup, err := h.backupService.SetBackupExpiry(c.Request.Context(), c.Param("id"), req.ExpiresAt, time.Now())
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.toBackupResponseWithRetention(c.Request.Context(), backup))
+}
+
 // ListBackups handles GET /backups
 func (h *BackupHandler) ListBackups(c *gin.Context) {
 	// Parse pagination parameters
@@ -140,10 +288,31 @@ func (h *BackupHandler) ListBackups(c *gin.Context) {
 			})
 			return
 		}
+		if err := util.ParseBooleanFilters(filters, "verified", "healthy"); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
 
 		filter.Filters = filters
 	}
 
+	if latest := c.Query("latest_per_schedule"); latest != "" {
+		latestPerSchedule, err := strconv.ParseBool(latest)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "latest_per_schedule must be true or false",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		filter.LatestPerSchedule = latestPerSchedule
+	}
+
 	// Parse order
 	if orderStr := c.Query("order"); orderStr != "" {
 		orders, err := util.ParseOrderString(orderStr)
@@ -181,20 +350,9 @@ func (h *BackupHandler) ListBackups(c *gin.Context) {
 
 	count, _ := h.backupService.CountBackups(c.Request.Context(), filter)
 
-	// Calculate pagination info
-	totalPages := 0
-	if perPage > 0 {
-		totalPages = (count + perPage - 1) / perPage
-	}
-
 	response := dto.BackupListResponse{
-		Items: make([]dto.BackupResponse, len(backups)),
-		Pagination: dto.PaginationInfo{
-			Total:      count,
-			Page:       page,
-			PerPage:    perPage,
-			TotalPages: totalPages,
-		},
+		Items:      make([]dto.BackupResponse, len(backups)),
+		Pagination: dto.NewPaginationInfo(count, page, perPage),
 	}
 
 	for i, backup := range backups {
@@ -205,15 +363,49 @@ func (h *BackupHandler) ListBackups(c *gin.Context) {
 }
 
 func toBackupResponse(backup *domain.Backup) dto.BackupResponse {
+	var verification *string
+	if backup.Verification != nil {
+		status := string(*backup.Verification)
+		verification = &status
+	}
+
+	// Full backups have no base, an empty from_backup_id is left out rather than sent as ""
+	fromBackupID := backup.FromBackupID
+	if fromBackupID != nil && *fromBackupID == "" {
+		fromBackupID = nil
+	}
+	backupType := backup.Type
+	if backupType == "" {
+		backupType = domain.BackupTypeFull
+		if fromBackupID != nil {
+			backupType = domain.BackupTypeIncremental
+		}
+	}
+	if backupType == domain.BackupTypeFull {
+		fromBackupID = nil
+	}
+
 	return dto.BackupResponse{
-		ID:           backup.ID,
-		Type:         string(backup.Type),
-		FromBackupID: backup.FromBackupID,
-		ScheduleID:   backup.ScheduleID,
-		StartTime:    backup.StartTime,
-		EndTime:      backup.EndTime,
-		ProcessID:    backup.ProcessID,
-		Size:         backup.Size,
+		ID:                 backup.ID,
+		Type:               string(backupType),
+		FromBackupID:       fromBackupID,
+		ScheduleID:         backup.ScheduleID,
+		Strategy:           string(backup.Strategy),
+		ExcludedDatabases:  backup.ExcludedDatabases,
+		Description:        backup.Description,
+		Source:             backup.Source,
+		VerificationStatus: verification,
+		LastVerifiedAt:     backup.LastVerifiedAt,
+		ExpiresAt:          backup.ExpiresAt,
+		Healthy:            backup.Healthy(),
+		GrantsCaptured:     backup.GrantsCaptured,
+		StartTime:          backup.StartTime,
+		EndTime:            backup.EndTime,
+		ProcessID:          backup.ProcessID,
+		Size:               backup.Size,
+		CompressionRatio:   backup.CompressionRatio(),
+		RestoreCount:       backup.RestoreCount,
+		LastRestoredAt:     backup.LastRestoredAt,
 	}
 }
 
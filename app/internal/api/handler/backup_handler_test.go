@@ -2,8 +2,20 @@
 package handler
 
 import (
+	"encoding/json"
+	"math"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/service"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
 )
 
 func TestListBackups(t *testing.T) {
@@ -202,6 +214,41 @@ func TestListBackupsPaginationMetadata(t *testing.T) {
 	}
 }
 
+func TestListBackupsPaginationNextPrev(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	tests := []struct {
+		name            string
+		path            string
+		expectedHasNext bool
+		expectedHasPrev bool
+	}{
+		{name: "first page", path: "/backups?page=1&per_page=3", expectedHasNext: true, expectedHasPrev: false},
+		{name: "middle page", path: "/backups?page=2&per_page=3", expectedHasNext: true, expectedHasPrev: true},
+		{name: "last page", path: "/backups?page=4&per_page=3", expectedHasNext: false, expectedHasPrev: true},
+		{name: "only page", path: "/backups?page=1&per_page=20", expectedHasNext: false, expectedHasPrev: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.makeRequest(t, tt.path)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+
+			resp := parseBackupListResponse(t, w)
+			if resp.Pagination.HasNext != tt.expectedHasNext {
+				t.Errorf("expected has_next %v, got %v", tt.expectedHasNext, resp.Pagination.HasNext)
+			}
+			if resp.Pagination.HasPrev != tt.expectedHasPrev {
+				t.Errorf("expected has_prev %v, got %v", tt.expectedHasPrev, resp.Pagination.HasPrev)
+			}
+		})
+	}
+}
+
 func TestListBackupsDateRangeFiltering(t *testing.T) {
 	env := setupTestEnv(t)
 	defer env.cleanup()
@@ -237,3 +284,460 @@ func TestListBackupsDateRangeFiltering(t *testing.T) {
 		}
 	}
 }
+
+func TestListBackupsTypeFiltering(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	w := env.makeRequest(t, "/backups?query=type|incremental&order=start_time|asc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	resp := parseBackupListResponse(t, w)
+
+	if resp.Pagination.Total != 5 {
+		t.Errorf("expected 5 incremental backups, got %d", resp.Pagination.Total)
+	}
+	for i, item := range resp.Items {
+		if item.FromBackupID == nil {
+			t.Errorf("item[%d]: expected an incremental backup, got full backup %s", i, item.ID)
+		}
+	}
+}
+
+func TestListBackupsVerifiedFiltering(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// backup-001 and backup-002 passed verification, backup-003 failed it, the rest never ran
+	if _, err := env.db.Exec(`UPDATE backup SET verification_status = 'passed', last_verified_at = CURRENT_TIMESTAMP WHERE id IN ('backup-001', 'backup-002')`); err != nil {
+		t.Fatalf("failed to set verification: %v", err)
+	}
+	if _, err := env.db.Exec(`UPDATE backup SET verification_status = 'failed', last_verified_at = CURRENT_TIMESTAMP WHERE id = 'backup-003'`); err != nil {
+		t.Fatalf("failed to set verification: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{name: "verified", query: "verified|true", expectedStatus: http.StatusOK, expectedIDs: []string{"backup-001", "backup-002"}},
+		{name: "unverified", query: "verified|false", expectedStatus: http.StatusOK,
+			expectedIDs: []string{"backup-003", "backup-004", "backup-005", "backup-006", "backup-007", "backup-008", "backup-009", "backup-010"}},
+		{name: "not verified with ne", query: "verified|ne|true", expectedStatus: http.StatusOK,
+			expectedIDs: []string{"backup-003", "backup-004", "backup-005", "backup-006", "backup-007", "backup-008", "backup-009", "backup-010"}},
+		{name: "unhealthy", query: "healthy|false", expectedStatus: http.StatusOK, expectedIDs: []string{"backup-003"}},
+		{name: "verified full backups", query: "verified|1,type|full", expectedStatus: http.StatusOK, expectedIDs: []string{"backup-001", "backup-002"}},
+		{name: "not a boolean", query: "verified|yes", expectedStatus: http.StatusBadRequest},
+		{name: "operator without meaning", query: "healthy|gt|true", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.makeRequest(t, "/backups?order=id|asc&query="+url.QueryEscape(tt.query))
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d\nBody: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			resp := parseBackupListResponse(t, w)
+			var ids []string
+			for _, item := range resp.Items {
+				ids = append(ids, item.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Errorf("expected %v, got %v", tt.expectedIDs, ids)
+			}
+			if resp.Pagination.Total != len(tt.expectedIDs) {
+				t.Errorf("expected total %d, got %d", len(tt.expectedIDs), resp.Pagination.Total)
+			}
+		})
+	}
+}
+
+func TestEstimateBackup(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// The full backups took 10 minutes each while growing by 1000 bytes every 5 days
+	for i, id := range []string{"backup-001", "backup-002", "backup-003", "backup-004", "backup-005"} {
+		if _, err := env.db.Exec(`UPDATE backup SET size = ? WHERE id = ?`, (i+1)*1000, id); err != nil {
+			t.Fatalf("failed to set size: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name              string
+		query             string
+		expectedStatus    int
+		expectedSamples   int
+		expectedAverage   float64
+		expectSizeTrend   bool
+		expectNoEstimates bool
+	}{
+		{name: "full backups with a size trend", query: "?type=full", expectedStatus: http.StatusOK, expectedSamples: 5, expectedAverage: 600, expectSizeTrend: true},
+		{name: "incrementals without sizes", query: "?type=incremental", expectedStatus: http.StatusOK, expectedSamples: 5, expectedAverage: 300},
+		{name: "no logical history", query: "?type=full&strategy=logical", expectedStatus: http.StatusOK, expectNoEstimates: true},
+		{name: "invalid type", query: "?type=differential", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.makeRequest(t, "/backups/estimate"+tt.query)
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d\nBody: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp dto.BackupEstimateResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if resp.Samples != tt.expectedSamples {
+				t.Errorf("expected %d samples, got %d", tt.expectedSamples, resp.Samples)
+			}
+			if tt.expectNoEstimates {
+				if resp.AverageDurationSeconds != nil || resp.EstimatedDurationSeconds != nil {
+					t.Errorf("expected no estimate without history, got %s", w.Body.String())
+				}
+				return
+			}
+			if resp.AverageDurationSeconds == nil || *resp.AverageDurationSeconds != tt.expectedAverage {
+				t.Errorf("expected an average of %vs, got %s", tt.expectedAverage, w.Body.String())
+			}
+			if resp.EstimatedDurationSeconds == nil {
+				t.Fatalf("expected an estimated duration, got %s", w.Body.String())
+			}
+
+			if !tt.expectSizeTrend {
+				if resp.SizeTrendBytesPerDay != nil || *resp.EstimatedDurationSeconds != tt.expectedAverage {
+					t.Errorf("expected the average as the estimate without sizes, got %s", w.Body.String())
+				}
+				return
+			}
+			if resp.SizeTrendBytesPerDay == nil || math.Abs(*resp.SizeTrendBytesPerDay-200) > 0.01 {
+				t.Errorf("expected a trend of 200 bytes per day, got %s", w.Body.String())
+			}
+			// The backups keep growing since the last one, so the next takes longer
+			if resp.EstimatedSize == nil || *resp.EstimatedSize <= 5000 || *resp.EstimatedDurationSeconds <= tt.expectedAverage {
+				t.Errorf("expected a larger and longer next backup, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListBackupsCompressionRatio(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// backup-001 is compressed, backup-002 has a size but no compression
+	if _, err := env.db.Exec(`UPDATE backup SET size = 1000, uncompressed_size = 3420 WHERE id = 'backup-001'`); err != nil {
+		t.Fatalf("failed to set sizes: %v", err)
+	}
+	if _, err := env.db.Exec(`UPDATE backup SET size = 1000 WHERE id = 'backup-002'`); err != nil {
+		t.Fatalf("failed to set sizes: %v", err)
+	}
+
+	w := env.makeRequest(t, "/backups?query=type|full&order=start_time|asc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	resp := parseBackupListResponse(t, w)
+	if len(resp.Items) < 2 || resp.Items[0].ID != "backup-001" || resp.Items[1].ID != "backup-002" {
+		t.Fatalf("expected backup-001 and backup-002 first, got %v", resp.Items)
+	}
+	if ratio := resp.Items[0].CompressionRatio; ratio == nil || *ratio != 3.42 {
+		t.Errorf("expected compression_ratio 3.42 for backup-001, got %v", ratio)
+	}
+	if ratio := resp.Items[1].CompressionRatio; ratio != nil {
+		t.Errorf("expected no compression_ratio for backup-002, got %v", *ratio)
+	}
+}
+
+func TestBackupResponseSerialization(t *testing.T) {
+	tests := []struct {
+		name         string
+		backup       *domain.Backup
+		expectedType string
+		expectedFrom interface{} // nil when from_backup_id must be absent
+	}{
+		{
+			name:         "full backup",
+			backup:       &domain.Backup{ID: "full-1", Type: domain.BackupTypeFull},
+			expectedType: "full",
+		},
+		{
+			name:         "full backup with an empty base",
+			backup:       &domain.Backup{ID: "full-2", Type: domain.BackupTypeFull, FromBackupID: ptr("")},
+			expectedType: "full",
+		},
+		{
+			name:         "incremental backup",
+			backup:       &domain.Backup{ID: "incr-1", Type: domain.BackupTypeIncremental, FromBackupID: ptr("full-1")},
+			expectedType: "incremental",
+			expectedFrom: "full-1",
+		},
+		{
+			name:         "type derived from the base",
+			backup:       &domain.Backup{ID: "incr-2", FromBackupID: ptr("incr-1")},
+			expectedType: "incremental",
+			expectedFrom: "incr-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(toBackupResponse(tt.backup))
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if fields["type"] != tt.expectedType {
+				t.Errorf("expected type %s, got %v", tt.expectedType, fields["type"])
+			}
+			from, present := fields["from_backup_id"]
+			if tt.expectedFrom == nil {
+				if present {
+					t.Errorf("expected from_backup_id to be absent, got %v", from)
+				}
+			} else if from != tt.expectedFrom {
+				t.Errorf("expected from_backup_id %v, got %v", tt.expectedFrom, from)
+			}
+		})
+	}
+}
+
+func TestListBackupsRestoreCount(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// backup-001 is restored a second time, after the seeded restore
+	lastRestore := time.Date(2030, 2, 1, 12, 0, 0, 0, time.UTC)
+	_, err := env.db.Exec(`
+		INSERT INTO restore (backup_id, backup_timestamp, target, target_path, start_time, end_time, process_id)
+		VALUES ('backup-001', ?, 'folder', '/tmp/restore-3', ?, ?, 9)
+	`, lastRestore.Format(time.RFC3339), lastRestore.Add(-time.Hour).Format(time.RFC3339), lastRestore.Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("failed to seed restore: %v", err)
+	}
+
+	w := env.makeRequest(t, "/backups?per_page=100")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	items := map[string]dto.BackupResponse{}
+	for _, item := range parseBackupListResponse(t, w).Items {
+		items[item.ID] = item
+	}
+
+	if got := items["backup-001"]; got.RestoreCount != 2 || got.LastRestoredAt == nil || !got.LastRestoredAt.Equal(lastRestore) {
+		t.Errorf("expected backup-001 restored twice, last at %v, got %d at %v", lastRestore, got.RestoreCount, got.LastRestoredAt)
+	}
+	if got := items["backup-002"]; got.RestoreCount != 1 {
+		t.Errorf("expected backup-002 restored once, got %d", got.RestoreCount)
+	}
+	if got := items["backup-006"]; got.RestoreCount != 0 || got.LastRestoredAt != nil {
+		t.Errorf("expected backup-006 never restored, got %d at %v", got.RestoreCount, got.LastRestoredAt)
+	}
+}
+
+func TestListBackupsLatestPerSchedule(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// Two schedules, the remaining backups stay ad-hoc
+	now := time.Now().Format(time.RFC3339)
+	for _, id := range []int{1, 2} {
+		_, err := env.db.Exec(`
+			INSERT INTO schedule (id, backup_type, frequency, hour, minute, enabled, created_at, updated_at)
+			VALUES (?, 'full', 'daily', 2, 0, 1, ?, ?)
+		`, id, now, now)
+		if err != nil {
+			t.Fatalf("failed to seed schedule: %v", err)
+		}
+	}
+	_, err := env.db.Exec(`
+		UPDATE backup SET schedule_id = CASE
+			WHEN id IN ('backup-001', 'backup-002', 'backup-006', 'backup-007') THEN 1
+			WHEN id IN ('backup-003', 'backup-004', 'backup-008', 'backup-009') THEN 2
+		END
+	`)
+	if err != nil {
+		t.Fatalf("failed to assign schedules: %v", err)
+	}
+
+	// A newer backup of schedule 2 that hasn't completed doesn't count
+	_, err = env.db.Exec(`
+		INSERT INTO backup (id, type, schedule_id, start_time, end_time, process_id)
+		VALUES ('backup-011', 'full', 2, ?, NULL, 7)
+	`, time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC).Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("failed to seed running backup: %v", err)
+	}
+
+	w := env.makeRequest(t, "/backups?latest_per_schedule=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	resp := parseBackupListResponse(t, w)
+	expected := []string{"backup-010", "backup-009", "backup-007"}
+	if len(resp.Items) != len(expected) {
+		t.Fatalf("expected %d backups, got %d", len(expected), len(resp.Items))
+	}
+	for i, id := range expected {
+		if resp.Items[i].ID != id {
+			t.Errorf("expected item %d to be %s, got %s", i, id, resp.Items[i].ID)
+		}
+	}
+	if resp.Pagination.Total != len(expected) {
+		t.Errorf("expected total %d, got %d", len(expected), resp.Pagination.Total)
+	}
+
+	w = env.makeRequest(t, "/backups?latest_per_schedule=maybe")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid latest_per_schedule, got %d", w.Code)
+	}
+}
+
+func TestCreateBackupInheritsSchedule(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+
+	dbCmd := newFakeDBCmd(t)
+	scheduleRepo := sqlite.NewScheduleRepository(env.db)
+	backupService := service.NewBackupService(sqlite.NewBackupRepository(env.db), scheduleRepo, nil, dbcmd.NewClient(dbCmd.path, time.Second), 0)
+	env.router.POST("/backups", NewBackupHandler(backupService, scheduleRepo).CreateBackup)
+
+	_, err := env.db.Exec(`
+		INSERT INTO schedule (backup_type, frequency, hour, minute, strategy, exclude_databases, verify_on_completion, enabled, retention_value, retention_unit, created_at, updated_at)
+		VALUES ('full', 'daily', 2, 0, 'logical', '["scratch"]', 1, 1, 7, 'days', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed schedule: %v", err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/backups", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only the schedule_id: the backup is the one the schedule's cron run would start
+	w := post(`{"schedule_id": 1}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	args := dbCmd.args("full_backup")
+	if args == nil {
+		t.Fatal("expected a full_backup command for the schedule's full type")
+	}
+	if args["schedule_id"] != float64(1) || args["strategy"] != "logical" || args["verify"] != true {
+		t.Errorf("expected the schedule's id, strategy and verification, got %v", args)
+	}
+	if exclude, _ := args["exclude_databases"].([]interface{}); len(exclude) != 1 || exclude[0] != "scratch" {
+		t.Errorf("expected the schedule's exclusions, got %v", args["exclude_databases"])
+	}
+
+	if w := post(`{"schedule_id": 42}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing schedule, got %d", w.Code)
+	}
+	if w := post(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without type or schedule_id, got %d", w.Code)
+	}
+}
+
+func TestBackupDescription(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	dbCmd := newFakeDBCmd(t)
+	scheduleRepo := sqlite.NewScheduleRepository(env.db)
+	backupService := service.NewBackupService(sqlite.NewBackupRepository(env.db), scheduleRepo, nil, dbcmd.NewClient(dbCmd.path, time.Second), 0)
+	env.router.POST("/backups", NewBackupHandler(backupService, scheduleRepo).CreateBackup)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/backups", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The note is passed on, trimmed, for db-cmd to store with the backup
+	w := post(`{"type": "full", "description": "  before schema migration X  "}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if args := dbCmd.args("full_backup"); args["description"] != "before schema migration X" {
+		t.Errorf("expected the trimmed description, got %v", args["description"])
+	}
+	if w := post(`{"type": "full", "description": "` + strings.Repeat("x", 501) + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a description over 500 characters, got %d", w.Code)
+	}
+
+	for id, description := range map[string]string{
+		"backup-003": "Before schema migration X",
+		"backup-004": "nightly 100%_done",
+	} {
+		if _, err := env.db.Exec(`UPDATE backup SET description = ? WHERE id = ?`, description, id); err != nil {
+			t.Fatalf("failed to set description: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		expectedIDs []string
+	}{
+		{name: "contains is case-insensitive", query: "description|contains|SCHEMA", expectedIDs: []string{"backup-003"}},
+		{name: "wildcards match literally", query: "description|contains|%_", expectedIDs: []string{"backup-004"}},
+		{name: "an underscore is not a single-character wildcard", query: "description|contains|0_d", expectedIDs: []string{}},
+		{name: "isnotnull finds the annotated backups", query: "description|isnotnull", expectedIDs: []string{"backup-004", "backup-003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.makeRequest(t, "/backups?query="+url.QueryEscape(tt.query))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+			}
+			resp := parseBackupListResponse(t, w)
+			ids := []string{}
+			for _, item := range resp.Items {
+				ids = append(ids, item.ID)
+				if item.Description == nil {
+					t.Errorf("expected %s to carry its description", item.ID)
+				}
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Errorf("expected %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+
+	// Backups without a note leave the field out
+	w = env.makeRequest(t, "/backups?query=id|backup-001")
+	if strings.Contains(w.Body.String(), `"description"`) {
+		t.Errorf("expected no description field, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/service"
+)
+
+type CatalogHandler struct {
+	catalogService *service.CatalogService
+}
+
+func NewCatalogHandler(catalogService *service.CatalogService) *CatalogHandler {
+	return &CatalogHandler{
+		catalogService: catalogService,
+	}
+}
+
+// BackupCatalog handles POST /system/catalog-backup
+func (h *CatalogHandler) BackupCatalog(c *gin.Context) {
+	backup, err := h.catalogService.Backup(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CatalogBackupResponse{
+		Name:      backup.Name,
+		Path:      backup.Path,
+		Size:      backup.Size,
+		CreatedAt: backup.CreatedAt,
+	})
+}
+
+// RestoreCatalog handles POST /system/catalog-restore
+func (h *CatalogHandler) RestoreCatalog(c *gin.Context) {
+	var req dto.CatalogRestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := h.catalogService.Restore(c.Request.Context(), req.Name); err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "restored", "name": req.Name})
+}
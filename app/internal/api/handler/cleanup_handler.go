@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/service"
 )
 
@@ -27,27 +28,34 @@ func (h *CleanupHandler) Cleanup(c *gin.Context) {
 		req.ScheduleID = nil
 	}
 
-	var process, err = h.cleanupService.CleanupAll(c.Request.Context())
-
+	var process *domain.Process
+	var outcomes []domain.CleanupOutcome
+	var err error
 	if req.ScheduleID != nil && *req.ScheduleID > 0 {
 		process, err = h.cleanupService.CleanupBySchedule(c.Request.Context(), *req.ScheduleID)
+	} else {
+		process, outcomes, err = h.cleanupService.CleanupAll(c.Request.Context())
 	}
 
 	if err != nil {
 		// Return error in AsyncResponse format to match Python behavior
 		// Frontend expects {"status": "error message"} format
-		c.JSON(http.StatusServiceUnavailable, dto.AsyncResponse{
-			Status: err.Error(),
+		c.JSON(http.StatusServiceUnavailable, dto.CleanupResponse{
+			AsyncResponse: dto.AsyncResponse{Status: err.Error()},
+			Schedules:     toCleanupOutcomes(outcomes),
 		})
 		return
 	}
 
 	// Build response matching Python StatusResponse format
 	link := fmt.Sprintf("/status/%s", process.CommandID)
-	response := dto.AsyncResponse{
-		Status: string(process.Status),
-		Link:   &link,
-		PID:    &process.CommandID,
+	response := dto.CleanupResponse{
+		AsyncResponse: dto.AsyncResponse{
+			Status: string(process.Status),
+			Link:   &link,
+			PID:    &process.CommandID,
+		},
+		Schedules: toCleanupOutcomes(outcomes),
 	}
 
 	// Add schedule_id as resource_id if provided
@@ -58,3 +66,16 @@ func (h *CleanupHandler) Cleanup(c *gin.Context) {
 
 	c.JSON(http.StatusAccepted, response)
 }
+
+func toCleanupOutcomes(outcomes []domain.CleanupOutcome) []dto.CleanupScheduleOutcome {
+	var result []dto.CleanupScheduleOutcome
+	for _, outcome := range outcomes {
+		result = append(result, dto.CleanupScheduleOutcome{
+			ScheduleID:     outcome.ScheduleID,
+			Status:         string(outcome.Status),
+			Reason:         outcome.Reason,
+			ExpiredBackups: outcome.ExpiredBackups,
+		})
+	}
+	return result
+}
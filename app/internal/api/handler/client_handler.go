@@ -36,6 +36,19 @@ func (h *ClientHandler) CreateClient(c *gin.Context) {
 		return
 	}
 
+	scopes := req.Scopes
+	if scopes == nil {
+		scopes = []string{domain.ScopeAll}
+	}
+	if err := domain.ValidateScopes(scopes); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
 	// Generate secret
 	secret := uuid.New().String()
 
@@ -51,7 +64,7 @@ func (h *ClientHandler) CreateClient(c *gin.Context) {
 	}
 
 	// Create client
-	client := domain.NewClient(req.Label, hashedSecret, []string{"all"})
+	client := domain.NewClient(req.Label, hashedSecret, scopes)
 	if err := h.clientRepo.Create(c.Request.Context(), client); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error:   "Internal Server Error",
@@ -131,6 +144,14 @@ func (h *ClientHandler) UpdateClient(c *gin.Context) {
 		})
 		return
 	}
+	if err := domain.ValidateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
 
 	// Get existing client
 	client, err := h.clientRepo.FindByID(c.Request.Context(), id)
@@ -143,8 +164,11 @@ func (h *ClientHandler) UpdateClient(c *gin.Context) {
 		return
 	}
 
-	// Update label
+	// Update label, and scopes when given
 	client.Label = req.Label
+	if req.Scopes != nil {
+		client.Scopes = req.Scopes
+	}
 	if err := h.clientRepo.Update(c.Request.Context(), client); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error:   "Internal Server Error",
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/service"
+)
+
+type MaintenanceHandler struct {
+	maintenanceService *service.MaintenanceService
+}
+
+func NewMaintenanceHandler(maintenanceService *service.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenanceService: maintenanceService,
+	}
+}
+
+// GetMaintenance handles GET /maintenance
+func (h *MaintenanceHandler) GetMaintenance(c *gin.Context) {
+	maintenance, err := h.maintenanceService.GetMaintenance(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toMaintenanceResponse(maintenance))
+}
+
+// SetMaintenance handles POST /maintenance
+func (h *MaintenanceHandler) SetMaintenance(c *gin.Context) {
+	var req dto.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	blockManual := true
+	if req.BlockManual != nil {
+		blockManual = *req.BlockManual
+	}
+
+	maintenance, err := h.maintenanceService.SetMaintenance(c.Request.Context(), *req.Enabled, blockManual, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, toMaintenanceResponse(maintenance))
+}
+
+func toMaintenanceResponse(maintenance *domain.Maintenance) dto.MaintenanceResponse {
+	return dto.MaintenanceResponse{
+		Enabled:     maintenance.Enabled,
+		BlockManual: maintenance.BlockManual,
+		Reason:      maintenance.Reason,
+		UpdatedAt:   maintenance.UpdatedAt,
+	}
+}
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/api/middleware"
 	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
@@ -15,17 +17,23 @@ import (
 
 // Allowed fields for process queries and ordering
 var (
-	processQueryFields = []string{"id", "command", "command_id", "pid", "status", "return_code", "start_time", "end_time", "type"}
+	processQueryFields = []string{"id", "command", "command_id", "pid", "status", "return_code", "start_time", "end_time", "type", "schedule_id"}
 	processOrderFields = []string{"id", "start_time", "end_time", "status"}
 )
 
 type ProcessHandler struct {
 	processService *service.ProcessService
+	usageService   *service.ProcessUsageService
+	retryService   *service.RetryService
+	backupRepo     repository.BackupRepository
 }
 
-func NewProcessHandler(processService *service.ProcessService) *ProcessHandler {
+func NewProcessHandler(processService *service.ProcessService, usageService *service.ProcessUsageService, retryService *service.RetryService, backupRepo repository.BackupRepository) *ProcessHandler {
 	return &ProcessHandler{
 		processService: processService,
+		usageService:   usageService,
+		retryService:   retryService,
+		backupRepo:     backupRepo,
 	}
 }
 
@@ -67,6 +75,19 @@ func (h *ProcessHandler) ListProcesses(c *gin.Context) {
 		filter.Filters = filters
 	}
 
+	if activeFirst := c.Query("active_first"); activeFirst != "" {
+		value, err := strconv.ParseBool(activeFirst)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "active_first must be true or false",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		filter.ActiveFirst = value
+	}
+
 	// Parse order
 	if orderStr := c.Query("order"); orderStr != "" {
 		orders, err := util.ParseOrderString(orderStr)
@@ -104,20 +125,9 @@ func (h *ProcessHandler) ListProcesses(c *gin.Context) {
 
 	count, _ := h.processService.CountProcesses(c.Request.Context(), filter)
 
-	// Calculate pagination info
-	totalPages := 0
-	if perPage > 0 {
-		totalPages = (count + perPage - 1) / perPage
-	}
-
 	response := dto.ProcessListResponse{
-		Items: make([]dto.ProcessResponse, len(processes)),
-		Pagination: dto.PaginationInfo{
-			Total:      count,
-			Page:       page,
-			PerPage:    perPage,
-			TotalPages: totalPages,
-		},
+		Items:      make([]dto.ProcessResponse, len(processes)),
+		Pagination: dto.NewPaginationInfo(count, page, perPage),
 	}
 
 	for i, process := range processes {
@@ -141,7 +151,7 @@ func (h *ProcessHandler) GetProcessByCommandID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, toProcessResponse(process))
+	c.JSON(http.StatusOK, h.toDetailedProcessResponse(c, process))
 }
 
 // GetProcess handles GET /processes/:id
@@ -166,7 +176,98 @@ func (h *ProcessHandler) GetProcess(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, toProcessResponse(process))
+	c.JSON(http.StatusOK, h.toDetailedProcessResponse(c, process))
+}
+
+// GetProcessUsage handles GET /processes/:id/usage. The id is the process's command ID,
+// gin needs the wildcard to share its name with GET /processes/:id.
+func (h *ProcessHandler) GetProcessUsage(c *gin.Context) {
+	commandID := c.Param("id")
+
+	usage, err := h.usageService.Usage(c.Request.Context(), commandID)
+	if err != nil {
+		statusCode := http.StatusServiceUnavailable
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ProcessUsageResponse{
+		CommandID:          commandID,
+		PID:                usage.PID,
+		State:              usage.State,
+		Threads:            usage.Threads,
+		ElapsedSeconds:     usage.ElapsedSeconds,
+		CPUUserSeconds:     usage.CPUUserSeconds,
+		CPUSystemSeconds:   usage.CPUSystemSeconds,
+		BlockIOWaitSeconds: usage.BlockIOWaitSeconds,
+		RSSBytes:           usage.RSSBytes,
+		ReadBytes:          usage.ReadBytes,
+		WriteBytes:         usage.WriteBytes,
+	})
+}
+
+// RetryProcess handles POST /processes/:id/retry, the id being the failed process's command
+// ID as for GET /processes/:id/usage
+func (h *ProcessHandler) RetryProcess(c *gin.Context) {
+	commandID := c.Param("id")
+
+	original, err := h.processService.GetProcessByCommandID(c.Request.Context(), commandID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Error:   "Not Found",
+			Message: fmt.Sprintf("Process not found: %s", commandID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	// Retrying a database restore overwrites the live database as much as the first attempt
+	if target, _ := original.Args["target"].(string); original.Type == domain.ProcessTypeRestore && target == string(domain.RestoreTargetDatabase) {
+		claims, ok := middleware.GetAuthClaims(c)
+		if !ok || !claims.HasScope(domain.ScopeRestoreDatabase) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: fmt.Sprintf("restoring to the database requires the %s scope", domain.ScopeRestoreDatabase),
+				Code:    http.StatusForbidden,
+			})
+			return
+		}
+	}
+
+	process, err := h.retryService.Retry(c.Request.Context(), commandID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	metadata := asyncMetadata(process)
+	metadata["retry_of"] = original.CommandID
+
+	link := fmt.Sprintf("/status/%s", process.CommandID)
+	c.JSON(http.StatusAccepted, dto.AsyncResponse{
+		Status:     string(process.Status),
+		Link:       &link,
+		PID:        &process.CommandID,
+		ResourceID: original.ResourceID(),
+		Metadata:   metadata,
+	})
 }
 
 func toProcessResponse(process *domain.Process) dto.ProcessResponse {
@@ -183,18 +284,81 @@ func toProcessResponse(process *domain.Process) dto.ProcessResponse {
 		EndTime:    process.EndTime,
 		Type:       string(process.Type),
 		Args:       process.Args,
+		Progress:   process.Progress,
+		Phase:      process.Phase,
+		ScheduleID: process.ScheduleID,
+		RetryOf:    process.RetryOf,
 	}
 
 	// Add status link
 	link := fmt.Sprintf("/status/%s", process.CommandID)
 	response.Link = &link
 
-	// Extract resource_id from args if available (for backup/restore operations)
-	if process.Args != nil {
-		if id, ok := process.Args["id"].(string); ok {
-			response.ResourceID = &id
-		}
+	response.ResourceID = process.ResourceID()
+	response.Metadata = processMetadata(process)
+
+	return response
+}
+
+// toDetailedProcessResponse is the response for a single process, which adds the size
+// of the backup a successful backup or consolidation took to its metadata
+func (h *ProcessHandler) toDetailedProcessResponse(c *gin.Context, process *domain.Process) dto.ProcessResponse {
+	response := toProcessResponse(process)
+
+	if process.Status != domain.ProcessStatusSuccess || response.ResourceID == nil {
+		return response
+	}
+	if process.Type != domain.ProcessTypeBackup && process.Type != domain.ProcessTypeConsolidateBackup {
+		return response
+	}
+	backup, err := h.backupRepo.FindByID(c.Request.Context(), *response.ResourceID)
+	if err != nil || backup == nil || backup.Size == nil {
+		return response
 	}
+	response.Metadata["size"] = *backup.Size
 
 	return response
 }
+
+// processMetadata holds the operation specific details of a process: its resource_id,
+// the length of the backup chain it worked through and a restore's target
+func processMetadata(process *domain.Process) map[string]interface{} {
+	metadata := make(map[string]interface{})
+
+	if id := process.ResourceID(); id != nil {
+		metadata["resource_id"] = *id
+	}
+	if idList, ok := process.Args["id_list"].([]interface{}); ok && len(idList) > 0 {
+		metadata["chain_length"] = len(idList)
+	}
+	if process.Type == domain.ProcessTypeRestore {
+		if target, ok := process.Args["target"].(string); ok && target != "" {
+			metadata["target"] = target
+		}
+	}
+
+	return metadata
+}
+
+// asyncMetadataKeys are the process args an accepted operation reports back to the
+// client; the rest, such as paths and credentials, stay internal to db-cmd
+var asyncMetadataKeys = []string{
+	"id_list",
+	"promoted_to_full",
+	"promotion_reason",
+	"backup_timestamp",
+	"excluded_databases",
+	"databases",
+	"warning",
+}
+
+// asyncMetadata is the metadata of the response to an accepted operation
+func asyncMetadata(process *domain.Process) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	for _, key := range asyncMetadataKeys {
+		if value, ok := process.Args[key]; ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
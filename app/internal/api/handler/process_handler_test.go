@@ -1,8 +1,18 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/service"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
 )
 
 func TestListProcesses(t *testing.T) {
@@ -291,3 +301,278 @@ func TestListProcessesCombinedFiltering(t *testing.T) {
 		t.Errorf("expected status 'running', got %s", item.Status)
 	}
 }
+
+func TestListProcessesScheduleFiltering(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// A finished and a running backup of schedule 5
+	if _, err := env.db.Exec(`UPDATE process SET schedule_id = 5 WHERE command_id IN ('proc-001', 'proc-007')`); err != nil {
+		t.Fatalf("failed to set process schedules: %v", err)
+	}
+
+	w := env.makeRequest(t, "/processes?query=schedule_id|5&order=start_time|asc")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	resp := parseProcessListResponse(t, w)
+
+	if len(resp.Items) != 2 {
+		t.Fatalf("expected 2 processes for schedule 5, got %d", len(resp.Items))
+	}
+	for i, commandID := range []string{"proc-001", "proc-007"} {
+		item := resp.Items[i]
+		if item.CommandID != commandID {
+			t.Errorf("item[%d]: expected %s, got %s", i, commandID, item.CommandID)
+		}
+		if item.ScheduleID == nil || *item.ScheduleID != 5 {
+			t.Errorf("item[%d]: expected schedule_id 5, got %v", i, item.ScheduleID)
+		}
+	}
+}
+
+func TestListProcessesActiveFirst(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	// The running proc-007 is the newest, it sorts last in ascending order unless active_first
+	w := env.makeRequest(t, "/processes?order=start_time|asc&active_first=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+
+	resp := parseProcessListResponse(t, w)
+	if len(resp.Items) != 10 {
+		t.Fatalf("expected 10 processes, got %d", len(resp.Items))
+	}
+	if resp.Items[0].CommandID != "proc-007" || resp.Items[0].Status != "running" {
+		t.Errorf("expected the running proc-007 first, got %s (%s)", resp.Items[0].CommandID, resp.Items[0].Status)
+	}
+	// The finished processes keep the requested order after it
+	if resp.Items[1].CommandID != "proc-001" {
+		t.Errorf("expected proc-001 second, got %s", resp.Items[1].CommandID)
+	}
+
+	// Without an order the running process leads the default newest first order
+	w = env.makeRequest(t, "/processes?active_first=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+	resp = parseProcessListResponse(t, w)
+	if len(resp.Items) != 10 || resp.Items[0].CommandID != "proc-007" {
+		t.Errorf("expected the running proc-007 first of 10, got %d items", len(resp.Items))
+	}
+
+	w = env.makeRequest(t, "/processes?active_first=maybe")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid active_first, got %d", w.Code)
+	}
+}
+
+func TestProcessResponseResourceID(t *testing.T) {
+	scheduleID := int64(3)
+	tests := []struct {
+		name       string
+		process    *domain.Process
+		expectedID string // empty when there is no resource
+	}{
+		{
+			name:       "backup",
+			process:    &domain.Process{Type: domain.ProcessTypeBackup, Args: map[string]interface{}{"id": "backup-1"}},
+			expectedID: "backup-1",
+		},
+		{
+			name:       "consolidate",
+			process:    &domain.Process{Type: domain.ProcessTypeConsolidateBackup, Args: map[string]interface{}{"id": "consolidated-1", "id_list": []interface{}{"full-1", "incr-1"}}},
+			expectedID: "consolidated-1",
+		},
+		{
+			name:       "verify",
+			process:    &domain.Process{Type: "verify_backup", Args: map[string]interface{}{"id": "incr-1", "id_list": []interface{}{"full-1", "incr-1"}}},
+			expectedID: "incr-1",
+		},
+		{
+			name:       "restore is the last backup of the chain",
+			process:    &domain.Process{Type: domain.ProcessTypeRestore, Args: map[string]interface{}{"id_list": []interface{}{"full-1", "incr-1", "incr-2"}}},
+			expectedID: "incr-2",
+		},
+		{
+			name:       "cleanup of a schedule",
+			process:    &domain.Process{Type: domain.ProcessTypeCleanupBackups, Args: map[string]interface{}{"backup_ids": `["full-1"]`}, ScheduleID: &scheduleID},
+			expectedID: "3",
+		},
+		{
+			name:    "cleanup of every schedule",
+			process: &domain.Process{Type: domain.ProcessTypeCleanupBackups, Args: map[string]interface{}{"backup_ids": `["full-1"]`}},
+		},
+		{
+			name:    "cron schedule update",
+			process: &domain.Process{Type: domain.ProcessTypeUpdateCronSchedules, Args: map[string]interface{}{"schedules": []interface{}{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := toProcessResponse(tt.process)
+
+			if tt.expectedID == "" {
+				if _, ok := resp.Metadata["resource_id"]; resp.ResourceID != nil || ok {
+					t.Fatalf("expected no resource_id, got %v and metadata %v", resp.ResourceID, resp.Metadata)
+				}
+				return
+			}
+			if resp.ResourceID == nil || *resp.ResourceID != tt.expectedID {
+				t.Fatalf("expected resource_id %s, got %v", tt.expectedID, resp.ResourceID)
+			}
+			if resp.Metadata["resource_id"] != tt.expectedID {
+				t.Errorf("expected metadata resource_id %s, got %v", tt.expectedID, resp.Metadata["resource_id"])
+			}
+		})
+	}
+}
+
+func TestProcessResponseMetadata(t *testing.T) {
+	restore := toProcessResponse(&domain.Process{
+		Type: domain.ProcessTypeRestore,
+		Args: map[string]interface{}{"id_list": []interface{}{"full-1", "incr-1"}, "target": "folder"},
+	})
+	if restore.Metadata["chain_length"] != 2 || restore.Metadata["target"] != "folder" {
+		t.Errorf("expected chain_length 2 and target folder, got %v", restore.Metadata)
+	}
+
+	cron := toProcessResponse(&domain.Process{Type: domain.ProcessTypeUpdateCronSchedules})
+	if cron.Metadata == nil || len(cron.Metadata) != 0 {
+		t.Errorf("expected empty metadata for a cron schedule update, got %v", cron.Metadata)
+	}
+
+	// The status of a single backup process carries the size of the backup it took
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.router.GET("/status/:command_id", env.processHandler.GetProcessByCommandID)
+
+	result, err := env.db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES ('backup-cmd', 'mariabackup --backup', 1, 'success', ?, ?, 'backup', '{"id":"sized-backup"}')
+	`, time.Now().Add(-time.Minute), time.Now())
+	if err != nil {
+		t.Fatalf("failed to seed process: %v", err)
+	}
+	processID, _ := result.LastInsertId()
+	_, err = env.db.Exec(`
+		INSERT INTO backup (id, type, start_time, end_time, size, process_id)
+		VALUES ('sized-backup', 'full', ?, ?, 2048, ?)
+	`, time.Now().Add(-time.Minute), time.Now(), processID)
+	if err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+
+	w := env.makeRequest(t, "/status/backup-cmd")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d\nBody: %s", w.Code, w.Body.String())
+	}
+	var resp dto.ProcessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Metadata["resource_id"] != "sized-backup" || resp.Metadata["size"] != float64(2048) {
+		t.Errorf("expected resource_id sized-backup and size 2048, got %v", resp.Metadata)
+	}
+}
+
+func TestRetryFailedBackup(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	dbCmd := newFakeDBCmd(t)
+	processRepo := sqlite.NewProcessRepository(env.db)
+	processService := service.NewProcessService(processRepo)
+	backupService := service.NewBackupService(sqlite.NewBackupRepository(env.db), sqlite.NewScheduleRepository(env.db), processService, dbcmd.NewClient(dbCmd.path, time.Second), 0)
+	retryService := service.NewRetryService(processRepo, backupService, nil, nil)
+	env.router.POST("/processes/:id/retry", NewProcessHandler(processService, nil, retryService, sqlite.NewBackupRepository(env.db)).RetryProcess)
+
+	// An incremental that failed, and the row db-cmd adds before accepting the retry
+	_, err := env.db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES ('failed-incr', 'mariabackup --backup', 0, 'failed', '2025-11-02T10:00:00Z', '2025-11-02T10:05:00Z', 'backup',
+			'{"id": "broken-incr", "from_backup_id": "backup-001", "description": "before the upgrade"}'),
+			('cmd-incremental_backup', 'mariabackup --backup', 0, 'running', CURRENT_TIMESTAMP, NULL, 'backup', '{}')
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed processes: %v", err)
+	}
+
+	post := func(commandID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/processes/"+commandID+"/retry", nil)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("failed-incr")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp dto.AsyncResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.PID == nil || *resp.PID != "cmd-incremental_backup" || resp.Metadata["retry_of"] != "failed-incr" {
+		t.Errorf("expected the retry's command id and retry_of, got %+v", resp)
+	}
+
+	// The same incremental is taken again under a new id
+	args := dbCmd.args("incremental_backup")
+	if args["from_backup_id"] != "backup-001" || args["description"] != "before the upgrade" {
+		t.Errorf("expected the failed backup's base and description, got %v", args)
+	}
+	if args["id"] == "broken-incr" {
+		t.Error("expected the retry to get a new backup id")
+	}
+
+	retry, err := processRepo.FindByCommandID(context.Background(), "cmd-incremental_backup")
+	if err != nil {
+		t.Fatalf("failed to find retry: %v", err)
+	}
+	if retry.RetryOf == nil || *retry.RetryOf != "failed-incr" {
+		t.Errorf("expected the retry to reference failed-incr, got %v", retry.RetryOf)
+	}
+
+	// Only failed processes can be retried
+	if w := post("proc-001"); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for a successful process, got %d", w.Code)
+	}
+	if w := post("missing"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown process, got %d", w.Code)
+	}
+}
+
+func TestAsyncMetadata(t *testing.T) {
+	process := &domain.Process{
+		Args: map[string]interface{}{
+			"id":                 "20240101-000000",
+			"id_list":            []interface{}{"full", "incr"},
+			"credentials_suffix": "secret",
+			"backup_dir":         "/var/backups/dbcalm",
+			"promoted_to_full":   true,
+			"warning":            "restoring a MariaDB 10.6 backup",
+		},
+	}
+
+	metadata := asyncMetadata(process)
+	for _, key := range []string{"id", "credentials_suffix", "backup_dir"} {
+		if _, ok := metadata[key]; ok {
+			t.Errorf("expected %s to be left out of the metadata", key)
+		}
+	}
+	if metadata["promoted_to_full"] != true || metadata["warning"] == nil || metadata["id_list"] == nil {
+		t.Errorf("expected the allowlisted args in the metadata, got %v", metadata)
+	}
+
+	if metadata := asyncMetadata(&domain.Process{}); len(metadata) != 0 {
+		t.Errorf("expected empty metadata for a process without args, got %v", metadata)
+	}
+}
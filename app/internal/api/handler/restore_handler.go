@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/api/middleware"
 	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
@@ -16,19 +18,22 @@ import (
 
 // Allowed fields for restore queries and ordering
 var (
-	restoreQueryFields = []string{"id", "start_time", "end_time", "target", "target_path", "backup_id", "backup_timestamp", "process_id"}
+	restoreQueryFields = []string{"id", "start_time", "end_time", "target", "target_path", "archive", "mode", "backup_id", "backup_timestamp", "process_id"}
 	restoreOrderFields = []string{"id", "start_time", "end_time", "backup_id"}
 )
 
 type RestoreHandler struct {
 	restoreService *service.RestoreService
 	backupRepo     repository.BackupRepository
+	// defaultTarget is used when a request names no target, empty requires one
+	defaultTarget string
 }
 
-func NewRestoreHandler(restoreService *service.RestoreService, backupRepo repository.BackupRepository) *RestoreHandler {
+func NewRestoreHandler(restoreService *service.RestoreService, backupRepo repository.BackupRepository, defaultTarget string) *RestoreHandler {
 	return &RestoreHandler{
 		restoreService: restoreService,
 		backupRepo:     backupRepo,
+		defaultTarget:  defaultTarget,
 	}
 }
 
@@ -44,6 +49,43 @@ func (h *RestoreHandler) CreateRestore(c *gin.Context) {
 		return
 	}
 
+	// Only a folder restore can be defaulted, a database restore wipes the data dir
+	if req.Target == "" {
+		if h.defaultTarget != "folder" {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "target is required, restoring to the database has to be requested explicitly",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		req.Target = h.defaultTarget
+	}
+
+	// Overwriting the live database takes its own scope, folder restores are open to every token
+	if req.Target == "database" {
+		claims, ok := middleware.GetAuthClaims(c)
+		if !ok || !claims.HasScope(domain.ScopeRestoreDatabase) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{
+				Error:   "Forbidden",
+				Message: fmt.Sprintf("restoring to the database requires the %s scope", domain.ScopeRestoreDatabase),
+				Code:    http.StatusForbidden,
+			})
+			return
+		}
+	}
+
+	backupID, err := domain.NormalizeBackupID(req.BackupID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	req.BackupID = backupID
+
 	// Validate backup exists before starting async restore (matches Python behavior)
 	backup, err := h.backupRepo.FindByID(c.Request.Context(), req.BackupID)
 	if err != nil || backup == nil {
@@ -55,12 +97,51 @@ func (h *RestoreHandler) CreateRestore(c *gin.Context) {
 		return
 	}
 
+	mode := domain.RestoreModePhysical
+	if req.RestoreMode != "" {
+		mode = domain.RestoreMode(req.RestoreMode)
+	}
+	if (mode == domain.RestoreModeLogical || mode == domain.RestoreModeGrants) && req.Target != "database" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: fmt.Sprintf("%s restore is only supported for the database target", mode),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if req.TargetPath != "" && req.Target != "folder" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "target_path is only supported for the folder target",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	record := req.Record == nil || *req.Record
+	if !record && req.Target != "folder" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "database restores are always recorded, record=false is only supported for the folder target",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if req.Archive && req.Target != "folder" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "archive is only supported for the folder target",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
 	var process *domain.Process
 
 	if req.Target == "database" {
-		process, err = h.restoreService.RestoreToDatabase(c.Request.Context(), req.BackupID)
+		process, err = h.restoreService.RestoreToDatabase(c.Request.Context(), req.BackupID, mode, req.Databases)
 	} else {
-		process, err = h.restoreService.RestoreToFolder(c.Request.Context(), req.BackupID)
+		process, err = h.restoreService.RestoreToFolder(c.Request.Context(), req.BackupID, req.TargetPath, req.Databases, record, req.Archive)
 	}
 
 	if err != nil {
@@ -89,6 +170,7 @@ func (h *RestoreHandler) CreateRestore(c *gin.Context) {
 		Link:       &link,
 		PID:        &process.CommandID,
 		ResourceID: &req.BackupID, // Resource is the backup being restored
+		Metadata:   asyncMetadata(process),
 	}
 
 	c.JSON(http.StatusAccepted, response)
@@ -169,20 +251,9 @@ func (h *RestoreHandler) ListRestores(c *gin.Context) {
 
 	count, _ := h.restoreService.CountRestores(c.Request.Context(), filter)
 
-	// Calculate pagination info
-	totalPages := 0
-	if perPage > 0 {
-		totalPages = (count + perPage - 1) / perPage
-	}
-
 	response := dto.RestoreListResponse{
-		Items: make([]dto.RestoreResponse, len(restores)),
-		Pagination: dto.PaginationInfo{
-			Total:      count,
-			Page:       page,
-			PerPage:    perPage,
-			TotalPages: totalPages,
-		},
+		Items:      make([]dto.RestoreResponse, len(restores)),
+		Pagination: dto.NewPaginationInfo(count, page, perPage),
 	}
 
 	for i, restore := range restores {
@@ -217,6 +288,47 @@ func (h *RestoreHandler) GetRestore(c *gin.Context) {
 	c.JSON(http.StatusOK, toRestoreResponse(restore))
 }
 
+// PlanRestore handles GET /restore/plan
+func (h *RestoreHandler) PlanRestore(c *gin.Context) {
+	targetTime, err := time.Parse(time.RFC3339, c.Query("time"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "time must be an RFC 3339 timestamp, e.g. 2024-10-18T03:00:00Z",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	plan, err := h.restoreService.PlanRestore(c.Request.Context(), targetTime)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	response := dto.RestorePlanResponse{
+		TargetTime:      plan.TargetTime,
+		BackupTimestamp: plan.BackupTimestamp,
+		Backups:         make([]dto.BackupResponse, len(plan.Chain)),
+		ChainLength:     len(plan.Chain),
+		TotalSize:       plan.TotalSize,
+	}
+	for i, backup := range plan.Chain {
+		response.Backups[i] = toBackupResponse(backup)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func toRestoreResponse(restore *domain.Restore) dto.RestoreResponse {
 	return dto.RestoreResponse{
 		ID:              restore.ID,
@@ -224,6 +336,10 @@ func toRestoreResponse(restore *domain.Restore) dto.RestoreResponse {
 		BackupTimestamp: restore.BackupTimestamp,
 		Target:          string(restore.Target),
 		TargetPath:      restore.TargetPath,
+		Archive:         restore.Archive,
+		Mode:            string(restore.Mode),
+		Databases:       restore.Databases,
+		SafetyCopyPath:  restore.SafetyCopyPath,
 		StartTime:       restore.StartTime,
 		EndTime:         restore.EndTime,
 		ProcessID:       restore.ProcessID,
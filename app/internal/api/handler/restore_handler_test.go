@@ -2,7 +2,15 @@ package handler
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/service"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
 )
 
 func TestListRestores(t *testing.T) {
@@ -221,3 +229,123 @@ func TestListRestoresBackupIDFiltering(t *testing.T) {
 		t.Errorf("expected backup_id 'backup-003', got %s", resp.Items[0].BackupID)
 	}
 }
+
+func TestCreateRestoreDefaultTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultTarget string
+		body          string
+		expectedCode  int
+	}{
+		{name: "missing target without a default", body: `{"id": "missing"}`, expectedCode: http.StatusBadRequest},
+		{name: "missing target defaults to folder", defaultTarget: "folder", body: `{"id": "missing"}`, expectedCode: http.StatusNotFound},
+		{name: "explicit database target", defaultTarget: "folder", body: `{"id": "missing", "target": "database"}`, expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestEnv(t)
+			defer env.cleanup()
+
+			env.restoreHandler.defaultTarget = tt.defaultTarget
+			env.router.POST("/restore", withScopes(domain.ScopeAll), env.restoreHandler.CreateRestore)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/restore", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			env.router.ServeHTTP(w, req)
+
+			// Past the target check the unknown backup is reported
+			if w.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d\nBody: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateRestoreDatabaseScope(t *testing.T) {
+	tests := []struct {
+		name         string
+		scopes       []string
+		target       string
+		expectedCode int
+	}{
+		{name: "all scope restores to database", scopes: []string{domain.ScopeAll}, target: "database", expectedCode: http.StatusNotFound},
+		{name: "restore:database scope restores to database", scopes: []string{domain.ScopeRestoreDatabase}, target: "database", expectedCode: http.StatusNotFound},
+		{name: "no scope is refused a database restore", target: "database", expectedCode: http.StatusForbidden},
+		{name: "no scope restores to folder", target: "folder", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := setupTestEnv(t)
+			defer env.cleanup()
+
+			env.router.POST("/restore", withScopes(tt.scopes...), env.restoreHandler.CreateRestore)
+
+			w := httptest.NewRecorder()
+			body := `{"id": "missing", "target": "` + tt.target + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/restore", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			env.router.ServeHTTP(w, req)
+
+			// An allowed restore gets past the scope check to report the unknown backup
+			if w.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d\nBody: %s", tt.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateRestoreWithoutRecord(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+	env.seedTestData(t)
+
+	dbCmd := newFakeDBCmd(t)
+	backupRepo := sqlite.NewBackupRepository(env.db)
+	restoreService := service.NewRestoreService(sqlite.NewRestoreRepository(env.db), backupRepo, sqlite.NewProcessRepository(env.db),
+		dbcmd.NewClient(dbCmd.path, time.Second))
+	env.router.POST("/restore", withScopes(domain.ScopeAll), NewRestoreHandler(restoreService, backupRepo, "").CreateRestore)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/restore", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+	countRestores := func() int {
+		var count int
+		if err := env.db.QueryRow(`SELECT COUNT(*) FROM restore`).Scan(&count); err != nil {
+			t.Fatalf("failed to count restores: %v", err)
+		}
+		return count
+	}
+	before := countRestores()
+
+	// db-cmd is told not to record the restore, it still runs as a process
+	w := post(`{"id": "backup-001", "target": "folder", "record": false}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if args := dbCmd.args("restore_backup"); args["record"] != false {
+		t.Errorf("expected record=false to be passed on, got %v", args)
+	}
+	if after := countRestores(); after != before {
+		t.Errorf("expected no restore row, got %d more", after-before)
+	}
+
+	// Recording is the default
+	if w := post(`{"id": "backup-001", "target": "folder"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, set := dbCmd.args("restore_backup")["record"]; set {
+		t.Errorf("expected no record argument by default, got %v", dbCmd.args("restore_backup"))
+	}
+
+	// Database restores are always recorded
+	if w := post(`{"id": "backup-001", "target": "database", "record": false}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a database restore with record=false, got %d", w.Code)
+	}
+}
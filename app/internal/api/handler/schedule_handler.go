@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
@@ -41,6 +44,9 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 	)
 
 	schedule.DayOfWeek = req.DayOfWeek
+	if req.DaysOfWeek != nil {
+		schedule.SetWeekdays(req.DaysOfWeek)
+	}
 	schedule.DayOfMonth = req.DayOfMonth
 	schedule.Hour = req.Hour
 	schedule.Minute = req.Minute
@@ -55,8 +61,29 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 		ru := domain.RetentionUnit(*req.RetentionUnit)
 		schedule.RetentionUnit = &ru
 	}
+	if req.Strategy != nil {
+		schedule.Strategy = domain.BackupStrategy(*req.Strategy)
+	}
+	schedule.ExcludeDatabases = req.ExcludeDatabases
+	schedule.PreBackupHook = optionalString(req.PreBackupHook)
+	schedule.PostBackupHook = optionalString(req.PostBackupHook)
+	schedule.VerifyOnCompletion = req.VerifyOnCompletion
+	schedule.CredentialsSuffix = optionalString(req.CredentialsSuffix)
+	schedule.WindowStart = req.WindowStart
+	schedule.WindowEnd = req.WindowEnd
 
 	if err := h.scheduleService.CreateSchedule(c.Request.Context(), schedule); err != nil {
+		scheduleError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toScheduleResponse(schedule, h.scheduleService.Timezone()))
+}
+
+// CreatePreset handles POST /schedules/preset
+func (h *ScheduleHandler) CreatePreset(c *gin.Context) {
+	var req dto.CreateSchedulePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error:   "Bad Request",
 			Message: err.Error(),
@@ -65,7 +92,28 @@ func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, toScheduleResponse(schedule))
+	opts := domain.PresetOptions{
+		DayOfWeek:     *req.DayOfWeek,
+		Hour:          *req.Hour,
+		Minute:        *req.Minute,
+		RetentionDays: req.RetentionDays,
+		Enabled:       req.Enabled == nil || *req.Enabled,
+	}
+	schedules, err := h.scheduleService.CreatePreset(c.Request.Context(), domain.SchedulePreset(req.Preset), opts)
+	if err != nil {
+		scheduleError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	response := dto.SchedulePresetResponse{
+		Preset:      req.Preset,
+		PresetGroup: *schedules[0].PresetGroup,
+		Schedules:   make([]dto.ScheduleResponse, len(schedules)),
+	}
+	for i, schedule := range schedules {
+		response.Schedules[i] = toScheduleResponse(schedule, h.scheduleService.Timezone())
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 // GetSchedule handles GET /schedules/:id
@@ -90,7 +138,39 @@ func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, toScheduleResponse(schedule))
+	c.JSON(http.StatusOK, toScheduleResponse(schedule, h.scheduleService.Timezone()))
+}
+
+// CloneSchedule handles POST /schedules/:id/clone
+func (h *ScheduleHandler) CloneSchedule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: "Invalid schedule ID",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	// The body is optional
+	var req dto.CloneScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error:   "Bad Request",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	schedule, err := h.scheduleService.CloneSchedule(c.Request.Context(), id, req.Enabled)
+	if err != nil {
+		scheduleError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, toScheduleResponse(schedule, h.scheduleService.Timezone()))
 }
 
 // ListSchedules handles GET /schedules
@@ -131,23 +211,62 @@ func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
 	if limit > 0 {
 		page = (offset / limit) + 1
 	}
-	totalPages := 0
-	if limit > 0 {
-		totalPages = (count + limit - 1) / limit
-	}
 
 	response := dto.ScheduleListResponse{
-		Items: make([]dto.ScheduleResponse, len(schedules)),
-		Pagination: dto.PaginationInfo{
-			Total:      count,
-			Page:       page,
-			PerPage:    limit,
-			TotalPages: totalPages,
-		},
+		Items:      make([]dto.ScheduleResponse, len(schedules)),
+		Pagination: dto.NewPaginationInfo(count, page, limit),
 	}
 
 	for i, schedule := range schedules {
-		response.Items[i] = toScheduleResponse(schedule)
+		response.Items[i] = toScheduleResponse(schedule, h.scheduleService.Timezone())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// defaultScheduleGrace is how late a run may start before its schedule counts as overdue
+const defaultScheduleGrace = time.Hour
+
+// ScheduleHealth handles GET /schedules/health
+func (h *ScheduleHandler) ScheduleHealth(c *gin.Context) {
+	grace := defaultScheduleGrace
+	if raw := c.Query("grace"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: "grace must be a non-negative duration, e.g. 30m",
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		grace = parsed
+	}
+
+	unhealthy, err := h.scheduleService.UnhealthySchedules(c.Request.Context(), time.Now(), grace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error:   "Internal Server Error",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	response := dto.ScheduleHealthResponse{Items: make([]dto.ScheduleHealthItem, len(unhealthy))}
+	for i, health := range unhealthy {
+		item := dto.ScheduleHealthItem{
+			ScheduleID: health.Schedule.ID,
+			Status:     string(health.Status),
+			Reason:     health.Reason,
+			NextRunAt:  health.NextRunAt,
+		}
+		if health.LastRun != nil {
+			status := string(health.LastRun.Status)
+			item.LastRunAt = &health.LastRun.StartTime
+			item.LastRunStatus = &status
+		}
+		response.Items[i] = item
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -194,7 +313,10 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 		schedule.Frequency = domain.ScheduleFrequency(*req.Frequency)
 	}
 	if req.DayOfWeek != nil {
-		schedule.DayOfWeek = req.DayOfWeek
+		schedule.SetWeekdays([]int{*req.DayOfWeek})
+	}
+	if req.DaysOfWeek != nil {
+		schedule.SetWeekdays(*req.DaysOfWeek)
 	}
 	if req.DayOfMonth != nil {
 		schedule.DayOfMonth = req.DayOfMonth
@@ -219,20 +341,40 @@ func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
 		ru := domain.RetentionUnit(*req.RetentionUnit)
 		schedule.RetentionUnit = &ru
 	}
+	if req.Strategy != nil {
+		schedule.Strategy = domain.BackupStrategy(*req.Strategy)
+	}
+	if req.ExcludeDatabases != nil {
+		schedule.ExcludeDatabases = *req.ExcludeDatabases
+	}
+	if req.PreBackupHook != nil {
+		schedule.PreBackupHook = optionalString(req.PreBackupHook)
+	}
+	if req.PostBackupHook != nil {
+		schedule.PostBackupHook = optionalString(req.PostBackupHook)
+	}
+	if req.VerifyOnCompletion != nil {
+		schedule.VerifyOnCompletion = *req.VerifyOnCompletion
+	}
+	if req.CredentialsSuffix != nil {
+		schedule.CredentialsSuffix = optionalString(req.CredentialsSuffix)
+	}
+	if req.WindowStart != nil {
+		schedule.WindowStart = optionalHour(req.WindowStart)
+	}
+	if req.WindowEnd != nil {
+		schedule.WindowEnd = optionalHour(req.WindowEnd)
+	}
 	if req.Enabled != nil {
 		schedule.Enabled = *req.Enabled
 	}
 
 	if err := h.scheduleService.UpdateSchedule(c.Request.Context(), schedule); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Bad Request",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+		scheduleError(c, err, http.StatusBadRequest)
 		return
 	}
 
-	c.JSON(http.StatusOK, toScheduleResponse(schedule))
+	c.JSON(http.StatusOK, toScheduleResponse(schedule, h.scheduleService.Timezone()))
 }
 
 // DeleteSchedule handles DELETE /schedules/:id
@@ -248,31 +390,84 @@ func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
 	}
 
 	if err := h.scheduleService.DeleteSchedule(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Internal Server Error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+		scheduleError(c, err, http.StatusInternalServerError)
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
 
-func toScheduleResponse(schedule *domain.Schedule) dto.ScheduleResponse {
+// ResyncCron handles POST /schedules/resync-cron
+func (h *ScheduleHandler) ResyncCron(c *gin.Context) {
+	count, err := h.scheduleService.ResyncCron(c.Request.Context())
+	if err != nil {
+		scheduleError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.CronResyncResponse{Schedules: count})
+}
+
+// CronPreview handles GET /schedules/cron, the cron file cmd would write right now
+func (h *ScheduleHandler) CronPreview(c *gin.Context) {
+	content, count, err := h.scheduleService.CronPreview(c.Request.Context())
+	if err != nil {
+		scheduleError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.CronPreviewResponse{Content: content, Schedules: count})
+}
+
+// scheduleError responds with a service error's own status, or statusCode for others.
+// Validation errors are a 422 listing every invalid field.
+func scheduleError(c *gin.Context, err error, statusCode int) {
+	var svcErr *service.ServiceError
+	if errors.As(err, &svcErr) {
+		statusCode = svcErr.Code
+	}
+	response := dto.ErrorResponse{Message: err.Error()}
+
+	// Invalid fields are listed one by one, for the UI to show next to each field
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		statusCode = http.StatusUnprocessableEntity
+		for _, field := range validationErr.Fields {
+			response.Fields = append(response.Fields, dto.FieldError{Field: field.Field, Reason: field.Reason})
+		}
+	}
+
+	response.Error = http.StatusText(statusCode)
+	response.Code = statusCode
+	c.JSON(statusCode, response)
+}
+
+// toScheduleResponse converts a schedule, which runs in timezone
+func toScheduleResponse(schedule *domain.Schedule, timezone string) dto.ScheduleResponse {
 	response := dto.ScheduleResponse{
-		ID:             schedule.ID,
-		BackupType:     string(schedule.BackupType),
-		Frequency:      string(schedule.Frequency),
-		DayOfWeek:      schedule.DayOfWeek,
-		DayOfMonth:     schedule.DayOfMonth,
-		Hour:           schedule.Hour,
-		Minute:         schedule.Minute,
-		IntervalValue:  schedule.IntervalValue,
-		RetentionValue: schedule.RetentionValue,
-		Enabled:        schedule.Enabled,
-		CreatedAt:      schedule.CreatedAt,
-		UpdatedAt:      schedule.UpdatedAt,
+		ID:                 schedule.ID,
+		BackupType:         string(schedule.BackupType),
+		Frequency:          string(schedule.Frequency),
+		DayOfWeek:          schedule.DayOfWeek,
+		DaysOfWeek:         schedule.Weekdays(),
+		DayOfMonth:         schedule.DayOfMonth,
+		Hour:               schedule.Hour,
+		Minute:             schedule.Minute,
+		IntervalValue:      schedule.IntervalValue,
+		RetentionValue:     schedule.RetentionValue,
+		Strategy:           string(schedule.Strategy),
+		ExcludeDatabases:   schedule.ExcludeDatabases,
+		PreBackupHook:      schedule.PreBackupHook,
+		PostBackupHook:     schedule.PostBackupHook,
+		VerifyOnCompletion: schedule.VerifyOnCompletion,
+		CredentialsSuffix:  schedule.CredentialsSuffix,
+		WindowStart:        schedule.WindowStart,
+		WindowEnd:          schedule.WindowEnd,
+		Timezone:           timezone,
+		PresetGroup:        schedule.PresetGroup,
+		Enabled:            schedule.Enabled,
+		CreatedAt:          schedule.CreatedAt,
+		UpdatedAt:          schedule.UpdatedAt,
 	}
 
 	if schedule.IntervalUnit != nil {
@@ -286,3 +481,19 @@ func toScheduleResponse(schedule *domain.Schedule) dto.ScheduleResponse {
 
 	return response
 }
+
+// optionalString treats an empty string as unset, so updates can clear a hook or credentials suffix
+func optionalString(hook *string) *string {
+	if hook == nil || *hook == "" {
+		return nil
+	}
+	return hook
+}
+
+// optionalHour maps a negative hour, which clears a window in updates, to nil
+func optionalHour(hour *int) *int {
+	if hour == nil || *hour < 0 {
+		return nil
+	}
+	return hour
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/service"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCloneSchedule(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+
+	cmdSocket := newFakeDBCmd(t)
+	scheduleService := service.NewScheduleService(
+		sqlite.NewScheduleRepository(env.db),
+		sqlite.NewBackupRepository(env.db),
+		service.NewProcessService(sqlite.NewProcessRepository(env.db)),
+		cmd.NewClient(cmdSocket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+	env.router.POST("/schedules/:id/clone", NewScheduleHandler(scheduleService).CloneSchedule)
+
+	_, err := env.db.Exec(`
+		INSERT INTO schedule (backup_type, frequency, days_of_week, day_of_week, hour, minute, strategy, exclude_databases,
+			retention_value, retention_unit, preset_group, enabled, created_at, updated_at)
+		VALUES ('full', 'weekly', '1,3', 1, 2, 30, 'logical', '["scratch"]', 7, 'days', 'group-1', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed schedule: %v", err)
+	}
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+	parse := func(w *httptest.ResponseRecorder) dto.ScheduleResponse {
+		var resp dto.ScheduleResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return resp
+	}
+
+	// Without a body the copy is disabled
+	w := post("/schedules/1/clone", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	clone := parse(w)
+	if clone.ID == 1 || clone.Enabled {
+		t.Errorf("expected a new, disabled schedule, got id %d enabled %v", clone.ID, clone.Enabled)
+	}
+	if clone.BackupType != "full" || clone.Frequency != "weekly" || clone.Strategy != "logical" ||
+		!reflect.DeepEqual(clone.DaysOfWeek, []int{1, 3}) || *clone.Hour != 2 || *clone.Minute != 30 ||
+		*clone.RetentionValue != 7 || *clone.RetentionUnit != "days" || !reflect.DeepEqual(clone.ExcludeDatabases, []string{"scratch"}) {
+		t.Errorf("expected the source's fields to be copied, got %+v", clone)
+	}
+	if clone.PresetGroup != nil {
+		t.Errorf("expected the copy to leave the preset group, got %s", *clone.PresetGroup)
+	}
+	if cmdSocket.args("update_cron_schedules") == nil {
+		t.Error("expected cron to be updated")
+	}
+
+	// The copy can be enabled right away
+	w = post("/schedules/1/clone", `{"enabled": true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if enabled := parse(w); !enabled.Enabled || enabled.ID == clone.ID {
+		t.Errorf("expected another, enabled schedule, got id %d enabled %v", enabled.ID, enabled.Enabled)
+	}
+
+	if w := post("/schedules/99/clone", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for a missing schedule, got %d", w.Code)
+	}
+	if w := post("/schedules/abc/clone", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid id, got %d", w.Code)
+	}
+}
+
+func TestCreateScheduleFieldErrors(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+
+	cmdSocket := newFakeDBCmd(t)
+	scheduleService := service.NewScheduleService(
+		sqlite.NewScheduleRepository(env.db),
+		sqlite.NewBackupRepository(env.db),
+		service.NewProcessService(sqlite.NewProcessRepository(env.db)),
+		cmd.NewClient(cmdSocket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+	env.router.POST("/schedules", NewScheduleHandler(scheduleService).CreateSchedule)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedFields []dto.FieldError
+	}{
+		{
+			name: "every invalid field is reported",
+			body: `{"backup_type": "incremental", "frequency": "weekly", "days_of_week": [1, 7], "strategy": "logical",
+				"retention_value": 0, "retention_unit": "days", "pre_backup_hook": "hooks/pre.sh", "enabled": true}`,
+			expectedFields: []dto.FieldError{
+				{Field: "backup_type", Reason: "incremental backups require at least one enabled full backup schedule"},
+				{Field: "strategy", Reason: "the logical strategy is only supported for full backup schedules"},
+				{Field: "retention_value", Reason: "retention_value must be at least 1, got 0"},
+				{Field: "pre_backup_hook", Reason: `invalid hook path: "hooks/pre.sh"`},
+				{Field: "hour", Reason: "required for weekly schedules"},
+				{Field: "minute", Reason: "required for weekly schedules"},
+				{Field: "days_of_week", Reason: "invalid day_of_week 7, must be 0-6"},
+			},
+		},
+		{
+			name: "missing fields of a frequency",
+			body: `{"backup_type": "full", "frequency": "interval", "retention_value": 7, "retention_unit": "fortnights", "enabled": true}`,
+			expectedFields: []dto.FieldError{
+				{Field: "retention_unit", Reason: `invalid retention_unit "fortnights", must be one of hours, days, weeks, months`},
+				{Field: "interval_value", Reason: "required for interval schedules"},
+				{Field: "interval_unit", Reason: "required for interval schedules"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body.String())
+			}
+			var resp dto.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if !reflect.DeepEqual(resp.Fields, tt.expectedFields) {
+				t.Errorf("expected fields %+v, got %+v", tt.expectedFields, resp.Fields)
+			}
+			if resp.Code != http.StatusUnprocessableEntity || resp.Message == "" {
+				t.Errorf("expected code 422 and a message, got %+v", resp)
+			}
+		})
+	}
+
+	var count int
+	if err := env.db.QueryRow(`SELECT COUNT(*) FROM schedule`).Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected no schedule to be created, got %d (%v)", count, err)
+	}
+}
+
+func TestScheduleInheritsDefaultTimezone(t *testing.T) {
+	env := setupTestEnv(t)
+	defer env.cleanup()
+
+	location, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	cmdSocket := newFakeDBCmd(t)
+	scheduleService := service.NewScheduleService(
+		sqlite.NewScheduleRepository(env.db),
+		sqlite.NewBackupRepository(env.db),
+		service.NewProcessService(sqlite.NewProcessRepository(env.db)),
+		cmd.NewClient(cmdSocket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		location,
+	)
+	handler := NewScheduleHandler(scheduleService)
+	env.router.POST("/schedules", handler.CreateSchedule)
+	env.router.GET("/schedules/:id", handler.GetSchedule)
+
+	body := `{"backup_type": "full", "frequency": "daily", "hour": 2, "minute": 30, "enabled": true}`
+	req := httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created dto.ScheduleResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if created.Timezone != "Europe/Amsterdam" {
+		t.Errorf("expected the default timezone Europe/Amsterdam, got %q", created.Timezone)
+	}
+
+	// cmd is told to run the schedule in the default zone
+	cronArgs := cmdSocket.args("update_cron_schedules")
+	schedules, _ := cronArgs["schedules"].([]interface{})
+	if len(schedules) != 1 {
+		t.Fatalf("expected one schedule in the cron update, got %v", cronArgs)
+	}
+	if tz := schedules[0].(map[string]interface{})["timezone"]; tz != "Europe/Amsterdam" {
+		t.Errorf("expected timezone Europe/Amsterdam in the cron update, got %v", tz)
+	}
+
+	w = env.makeRequest(t, fmt.Sprintf("/schedules/%d", created.ID))
+	var fetched dto.ScheduleResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &fetched); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if fetched.Timezone != "Europe/Amsterdam" {
+		t.Errorf("expected the fetched schedule in Europe/Amsterdam, got %q", fetched.Timezone)
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/service"
+)
+
+type ServerHandler struct {
+	serverService *service.ServerService
+}
+
+func NewServerHandler(serverService *service.ServerService) *ServerHandler {
+	return &ServerHandler{
+		serverService: serverService,
+	}
+}
+
+// GetServerInfo handles GET /server/info
+func (h *ServerHandler) GetServerInfo(c *gin.Context) {
+	info, err := h.serverService.GetServerInfo(c.Request.Context())
+	if err != nil {
+		statusCode := http.StatusServiceUnavailable
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ServerInfoResponse{
+		DbType:          info.DbType,
+		Version:         info.Version,
+		DumpAvailable:   info.DumpAvailable,
+		ClientAvailable: info.ClientAvailable,
+		Source:          info.Source,
+		DetectedAt:      info.DetectedAt,
+	})
+}
+
+// TestConnection handles POST /server/test-connection
+func (h *ServerHandler) TestConnection(c *gin.Context) {
+	var req dto.TestConnectionRequest
+	// An empty body tests db-cmd's configured credentials
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "Bad Request",
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	result, err := h.serverService.TestConnection(c.Request.Context(), req.CredentialsSuffix)
+	if err != nil {
+		statusCode := http.StatusServiceUnavailable
+		var svcErr *service.ServiceError
+		if errors.As(err, &svcErr) {
+			statusCode = svcErr.Code
+		}
+		c.JSON(statusCode, dto.ErrorResponse{
+			Error:   http.StatusText(statusCode),
+			Message: err.Error(),
+			Code:    statusCode,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TestConnectionResponse{
+		Connected:         result.Connected,
+		CredentialsSuffix: result.CredentialsSuffix,
+		DbType:            result.DbType,
+		Version:           result.Version,
+		Error:             result.Error,
+	})
+}
@@ -2,13 +2,17 @@ package handler
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/api/middleware"
 	"github.com/martijn/dbcalm/internal/core/service"
 	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
 )
@@ -40,13 +44,13 @@ func setupTestEnv(t *testing.T) *testEnv {
 
 	// Create services (without dbClient since we're only testing list endpoints)
 	processService := service.NewProcessService(processRepo)
-	backupService := service.NewBackupService(backupRepo, processService, nil)
-	restoreService := service.NewRestoreService(restoreRepo, backupRepo, nil)
+	backupService := service.NewBackupService(backupRepo, scheduleRepo, processService, nil, 0)
+	restoreService := service.NewRestoreService(restoreRepo, backupRepo, processRepo, nil)
 
 	// Create handlers
 	backupHandler := NewBackupHandler(backupService, scheduleRepo)
-	restoreHandler := NewRestoreHandler(restoreService, backupRepo)
-	processHandler := NewProcessHandler(processService)
+	restoreHandler := NewRestoreHandler(restoreService, backupRepo, "")
+	processHandler := NewProcessHandler(processService, nil, nil, backupRepo)
 
 	// Setup gin router in test mode
 	gin.SetMode(gin.TestMode)
@@ -54,6 +58,7 @@ func setupTestEnv(t *testing.T) *testEnv {
 
 	// Register routes without auth middleware
 	router.GET("/backups", backupHandler.ListBackups)
+	router.GET("/backups/estimate", backupHandler.EstimateBackup)
 	router.GET("/restores", restoreHandler.ListRestores)
 	router.GET("/processes", processHandler.ListProcesses)
 
@@ -66,6 +71,74 @@ func setupTestEnv(t *testing.T) *testEnv {
 	}
 }
 
+// withScopes stands in for the auth middleware, authenticating every request with the scopes
+func withScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.AuthContextKey, &service.TokenClaims{Subject: "test-client", SubjectType: "client", Scopes: scopes})
+		c.Next()
+	}
+}
+
+// fakeDBCmd is a Unix socket server standing in for db-cmd. It reports a MariaDB server
+// for server_info and accepts every other command with a 202.
+type fakeDBCmd struct {
+	path     string
+	mu       sync.Mutex
+	requests map[string]map[string]interface{} // Args of the last request per command
+}
+
+func newFakeDBCmd(t *testing.T) *fakeDBCmd {
+	t.Helper()
+
+	f := &fakeDBCmd{path: filepath.Join(t.TempDir(), "db-cmd.sock"), requests: map[string]map[string]interface{}{}}
+	listener, err := net.Listen("unix", f.path)
+	if err != nil {
+		t.Fatalf("failed to listen on fake db-cmd socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeDBCmd) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req struct {
+		Cmd  string                 `json:"cmd"`
+		Args map[string]interface{} `json:"args"`
+	}
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.requests[req.Cmd] = req.Args
+	f.mu.Unlock()
+
+	response := map[string]interface{}{"code": 202, "status": "Accepted", "id": "cmd-" + req.Cmd}
+	if req.Cmd == "server_info" {
+		response = map[string]interface{}{"code": 200, "status": "OK", "data": map[string]interface{}{
+			"db_type": "mariadb", "version": "10.11.6", "dump_available": true, "client_available": true,
+		}}
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+// args returns the args db-cmd received for cmd, nil when it wasn't sent
+func (f *fakeDBCmd) args(cmd string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[cmd]
+}
+
 // cleanup closes the test database
 func (env *testEnv) cleanup() {
 	if env.db != nil {
@@ -142,10 +215,14 @@ func (env *testEnv) seedTestData(t *testing.T) {
 		if b.endTime != nil {
 			endTimeStr = b.endTime.Format(time.RFC3339)
 		}
+		backupType := "full"
+		if b.fromBackupID != nil {
+			backupType = "incremental"
+		}
 		_, err := env.db.Exec(`
-			INSERT INTO backup (id, from_backup_id, start_time, end_time, process_id)
-			VALUES (?, ?, ?, ?, ?)
-		`, b.id, b.fromBackupID, b.startTime.Format(time.RFC3339), endTimeStr, b.processID)
+			INSERT INTO backup (id, type, from_backup_id, start_time, end_time, process_id)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, b.id, backupType, b.fromBackupID, b.startTime.Format(time.RFC3339), endTimeStr, b.processID)
 		if err != nil {
 			t.Fatalf("failed to seed backup %s: %v", b.id, err)
 		}
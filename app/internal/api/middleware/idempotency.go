@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/service"
+)
+
+const (
+	IdempotencyHeaderKey = "Idempotency-Key"
+	// IdempotentReplayedHeaderKey is set on responses replayed for a repeated key
+	IdempotentReplayedHeaderKey = "Idempotent-Replayed"
+)
+
+// IdempotencyMiddleware replays the original response when a request is repeated with the
+// same Idempotency-Key, instead of running it again. Requests without the header are not
+// affected. Errors use the AsyncResponse format the backup and restore endpoints return.
+func IdempotencyMiddleware(idempotencyService *service.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeaderKey)
+		if key == "" || !idempotencyService.Enabled() {
+			c.Next()
+			return
+		}
+
+		owner := ""
+		if claims, ok := GetAuthClaims(c); ok {
+			owner = claims.Subject
+		}
+
+		stored, err := idempotencyService.Begin(c.Request.Context(), owner, key, c.Request.Method, c.FullPath(), time.Now())
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			message := err.Error()
+			var svcErr *service.ServiceError
+			if errors.As(err, &svcErr) {
+				statusCode = svcErr.Code
+				message = svcErr.Message
+			}
+			c.JSON(statusCode, dto.AsyncResponse{
+				Status: message,
+			})
+			c.Abort()
+			return
+		}
+		if stored != nil {
+			c.Header(IdempotentReplayedHeaderKey, "true")
+			c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.Response)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The client may have given up waiting, the response must still be stored for its retry
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := idempotencyService.Finish(ctx, owner, key, recorder.Status(), recorder.body.Bytes()); err != nil {
+			log.Printf("Warning: failed to store response for Idempotency-Key %q: %v", key, err)
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body written through it
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/core/service"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		age           time.Duration // How long ago the first request was made
+		expectReplay  bool
+		expectStarted int
+	}{
+		{name: "repeated within ttl", age: time.Hour, expectReplay: true, expectStarted: 1},
+		{name: "repeated after ttl", age: 25 * time.Hour, expectStarted: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sqlite.New(filepath.Join(t.TempDir(), "db.sqlite3"))
+			if err != nil {
+				t.Fatalf("failed to create test database: %v", err)
+			}
+			defer db.Close()
+
+			idempotencyService := service.NewIdempotencyService(sqlite.NewIdempotencyRepository(db), 24*time.Hour)
+
+			started := 0
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/backups", IdempotencyMiddleware(idempotencyService), func(c *gin.Context) {
+				started++
+				c.JSON(http.StatusAccepted, gin.H{"status": "running", "pid": fmt.Sprintf("cmd-%d", started)})
+			})
+
+			post := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/backups", nil)
+				req.Header.Set(IdempotencyHeaderKey, "retry-1")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w
+			}
+
+			first := post()
+			if first.Code != http.StatusAccepted {
+				t.Fatalf("expected status 202, got %d: %s", first.Code, first.Body.String())
+			}
+
+			var commandID string
+			if err := db.Get(&commandID, `SELECT command_id FROM idempotency_key WHERE key = 'retry-1'`); err != nil {
+				t.Fatalf("failed to read stored key: %v", err)
+			}
+			if commandID != "cmd-1" {
+				t.Errorf("expected command_id cmd-1 to be stored, got %q", commandID)
+			}
+
+			if _, err := db.Exec(`UPDATE idempotency_key SET created_at = ?`, time.Now().Add(-tt.age)); err != nil {
+				t.Fatalf("failed to age stored key: %v", err)
+			}
+
+			second := post()
+			if second.Code != http.StatusAccepted {
+				t.Fatalf("expected status 202, got %d: %s", second.Code, second.Body.String())
+			}
+			if started != tt.expectStarted {
+				t.Errorf("expected the handler to run %d times, ran %d times", tt.expectStarted, started)
+			}
+
+			replayed := second.Header().Get(IdempotentReplayedHeaderKey) == "true"
+			if replayed != tt.expectReplay {
+				t.Errorf("expected replayed %v, got %v", tt.expectReplay, replayed)
+			}
+			if tt.expectReplay && second.Body.String() != first.Body.String() {
+				t.Errorf("expected the original response %s, got %s", first.Body.String(), second.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareReleasesFailedRequests(t *testing.T) {
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	idempotencyService := service.NewIdempotencyService(sqlite.NewIdempotencyRepository(db), 24*time.Hour)
+
+	statusCode := http.StatusConflict
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/backups", IdempotencyMiddleware(idempotencyService), func(c *gin.Context) {
+		c.JSON(statusCode, gin.H{"status": "busy"})
+	})
+
+	for _, expected := range []int{http.StatusConflict, http.StatusAccepted} {
+		statusCode = expected
+		req := httptest.NewRequest(http.MethodPost, "/backups", nil)
+		req.Header.Set(IdempotencyHeaderKey, "retry-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != expected {
+			t.Fatalf("expected status %d, got %d: %s", expected, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
+	"github.com/martijn/dbcalm/internal/core/service"
+)
+
+// MaintenanceMiddleware refuses manual backups and restores while maintenance mode blocks them.
+// Errors use the AsyncResponse format the backup and restore endpoints return.
+func MaintenanceMiddleware(maintenanceService *service.MaintenanceService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := maintenanceService.CheckManual(c.Request.Context()); err != nil {
+			statusCode := http.StatusInternalServerError
+			message := err.Error()
+			var svcErr *service.ServiceError
+			if errors.As(err, &svcErr) {
+				statusCode = svcErr.Code
+				message = svcErr.Message
+			}
+			c.JSON(statusCode, dto.AsyncResponse{
+				Status: message,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
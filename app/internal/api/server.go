@@ -2,13 +2,17 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"math"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/martijn/dbcalm/internal/api/dto"
 	"github.com/martijn/dbcalm/internal/api/handler"
 	"github.com/martijn/dbcalm/internal/api/middleware"
+	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 	"github.com/martijn/dbcalm/internal/core/service"
 	"github.com/martijn/dbcalm/pkg/config"
@@ -27,10 +31,17 @@ func NewServer(
 	cfg *config.Config,
 	authService *service.AuthService,
 	processService *service.ProcessService,
+	processUsageService *service.ProcessUsageService,
 	backupService *service.BackupService,
 	restoreService *service.RestoreService,
 	scheduleService *service.ScheduleService,
 	cleanupService *service.CleanupService,
+	retryService *service.RetryService,
+	serverService *service.ServerService,
+	maintenanceService *service.MaintenanceService,
+	catalogService *service.CatalogService,
+	idempotencyService *service.IdempotencyService,
+	diskMonitorService *service.DiskMonitorService,
 	clientRepo repository.ClientRepository,
 	scheduleRepo repository.ScheduleRepository,
 	backupRepo repository.BackupRepository,
@@ -47,15 +58,19 @@ func NewServer(
 	router.Use(gin.Recovery())
 	router.Use(middleware.ErrorHandlerMiddleware())
 	router.Use(middleware.CORSMiddleware(cfg.CORSOrigins))
+	router.Use(middleware.TimeoutMiddleware(cfg.RequestTimeout))
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authService)
 	backupHandler := handler.NewBackupHandler(backupService, scheduleRepo)
-	restoreHandler := handler.NewRestoreHandler(restoreService, backupRepo)
+	restoreHandler := handler.NewRestoreHandler(restoreService, backupRepo, cfg.DefaultRestoreTarget)
 	scheduleHandler := handler.NewScheduleHandler(scheduleService)
-	processHandler := handler.NewProcessHandler(processService)
+	processHandler := handler.NewProcessHandler(processService, processUsageService, retryService, backupRepo)
 	clientHandler := handler.NewClientHandler(clientRepo, authService)
 	cleanupHandler := handler.NewCleanupHandler(cleanupService)
+	serverHandler := handler.NewServerHandler(serverService)
+	maintenanceHandler := handler.NewMaintenanceHandler(maintenanceService)
+	catalogHandler := handler.NewCatalogHandler(catalogService)
 
 	// Public routes (no auth required)
 	auth := router.Group("/auth")
@@ -66,37 +81,48 @@ func NewServer(
 
 	// Protected routes (auth required)
 	authMiddleware := middleware.AuthMiddleware(authService)
+	maintenanceMiddleware := middleware.MaintenanceMiddleware(maintenanceService)
+	idempotencyMiddleware := middleware.IdempotencyMiddleware(idempotencyService)
 
 	// Backups
 	backups := router.Group("/backups")
 	backups.Use(authMiddleware)
 	{
-		backups.POST("", backupHandler.CreateBackup)
+		backups.POST("", idempotencyMiddleware, maintenanceMiddleware, backupHandler.CreateBackup)
 		backups.GET("", backupHandler.ListBackups)
+		backups.GET("/estimate", backupHandler.EstimateBackup)
 		backups.GET("/:id", backupHandler.GetBackup)
+		backups.PATCH("/:id", backupHandler.UpdateBackup)
+		backups.POST("/:id/consolidate", maintenanceMiddleware, backupHandler.ConsolidateBackup)
 	}
 
 	// Restores
 	restores := router.Group("/restores")
 	restores.Use(authMiddleware)
 	{
-		restores.POST("", restoreHandler.CreateRestore)
+		restores.POST("", idempotencyMiddleware, maintenanceMiddleware, restoreHandler.CreateRestore)
 		restores.GET("", restoreHandler.ListRestores)
 		restores.GET("/:id", restoreHandler.GetRestore)
 	}
 
 	// Alternative restore endpoint (Python compatibility)
-	router.POST("/restore", authMiddleware, restoreHandler.CreateRestore)
+	router.POST("/restore", authMiddleware, idempotencyMiddleware, maintenanceMiddleware, restoreHandler.CreateRestore)
+	router.GET("/restore/plan", authMiddleware, restoreHandler.PlanRestore)
 
 	// Schedules
 	schedules := router.Group("/schedules")
 	schedules.Use(authMiddleware)
 	{
 		schedules.POST("", scheduleHandler.CreateSchedule)
+		schedules.POST("/preset", scheduleHandler.CreatePreset)
 		schedules.GET("", scheduleHandler.ListSchedules)
+		schedules.GET("/health", scheduleHandler.ScheduleHealth)
+		schedules.GET("/cron", scheduleHandler.CronPreview)
+		schedules.POST("/resync-cron", scheduleHandler.ResyncCron)
 		schedules.GET("/:id", scheduleHandler.GetSchedule)
 		schedules.PUT("/:id", scheduleHandler.UpdateSchedule)
 		schedules.DELETE("/:id", scheduleHandler.DeleteSchedule)
+		schedules.POST("/:id/clone", scheduleHandler.CloneSchedule)
 	}
 
 	// Processes
@@ -105,6 +131,8 @@ func NewServer(
 	{
 		processes.GET("", processHandler.ListProcesses)
 		processes.GET("/:id", processHandler.GetProcess)
+		processes.GET("/:id/usage", processHandler.GetProcessUsage)
+		processes.POST("/:id/retry", idempotencyMiddleware, maintenanceMiddleware, processHandler.RetryProcess)
 	}
 
 	// Process status by command ID
@@ -124,12 +152,37 @@ func NewServer(
 	// Cleanup
 	router.POST("/cleanup", authMiddleware, cleanupHandler.Cleanup)
 
+	// Database server info (version/type detected by db-cmd)
+	router.GET("/server/info", authMiddleware, serverHandler.GetServerInfo)
+	router.POST("/server/test-connection", authMiddleware, serverHandler.TestConnection)
+
+	// Maintenance mode
+	router.GET("/maintenance", authMiddleware, maintenanceHandler.GetMaintenance)
+	router.POST("/maintenance", authMiddleware, maintenanceHandler.SetMaintenance)
+
+	// Catalog self-backup
+	system := router.Group("/system")
+	system.Use(authMiddleware)
+	{
+		system.POST("/catalog-backup", catalogHandler.BackupCatalog)
+		system.POST("/catalog-restore", catalogHandler.RestoreCatalog)
+	}
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		})
+		inMaintenance := false
+		if maintenance, err := maintenanceService.GetMaintenance(c.Request.Context()); err == nil {
+			inMaintenance = maintenance.Enabled
+		}
+		health := gin.H{
+			"status":      "ok",
+			"time":        time.Now().Format(time.RFC3339),
+			"maintenance": inMaintenance,
+		}
+		if diskMonitorService.Enabled() {
+			health["disk"] = toDiskUsageResponse(diskMonitorService.Usage())
+		}
+		c.JSON(http.StatusOK, health)
 	})
 
 	// OpenAPI/Swagger documentation
@@ -162,13 +215,23 @@ func (s *Server) Start() error {
 		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
 
-	// Start with or without SSL
+	// Start with or without SSL. Plain HTTP is meant for local development or running
+	// behind a TLS-terminating proxy.
 	if s.config.SSLCert != "" && s.config.SSLKey != "" {
+		reloader, err := newCertReloader(s.config.SSLCert, s.config.SSLKey)
+		if err != nil {
+			return err
+		}
+		s.srv.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+
 		fmt.Printf("Starting HTTPS server on %s\n", addr)
-		return s.srv.ListenAndServeTLS(s.config.SSLCert, s.config.SSLKey)
+		return s.srv.ListenAndServeTLS("", "")
 	}
 
-	fmt.Printf("Starting HTTP server on %s\n", addr)
+	fmt.Printf("Starting HTTP server on %s (TLS disabled)\n", addr)
 	return s.srv.ListenAndServe()
 }
 
@@ -179,3 +242,19 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	}
 	return nil
 }
+
+func toDiskUsageResponse(usage domain.DiskUsage) dto.DiskUsageResponse {
+	response := dto.DiskUsageResponse{
+		Path:              usage.Path,
+		State:             string(usage.State),
+		UsedPercent:       math.Round(usage.UsedPercent*10) / 10,
+		InodesUsedPercent: math.Round(usage.InodesUsedPercent*10) / 10,
+		FreeBytes:         usage.FreeBytes,
+		FreeInodes:        usage.FreeInodes,
+		Error:             usage.Error,
+	}
+	if !usage.CheckedAt.IsZero() {
+		response.CheckedAt = &usage.CheckedAt
+	}
+	return response
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -17,6 +18,7 @@ const (
 	OpLte       QueryOperator = "lte"
 	OpIn        QueryOperator = "in"
 	OpNin       QueryOperator = "nin"
+	OpContains  QueryOperator = "contains" // Case-insensitive substring match
 	OpIsNull    QueryOperator = "isnull"
 	OpIsNotNull QueryOperator = "isnotnull"
 )
@@ -51,6 +53,7 @@ var validOperators = map[string]QueryOperator{
 	"lte":       OpLte,
 	"in":        OpIn,
 	"nin":       OpNin,
+	"contains":  OpContains,
 	"isnull":    OpIsNull,
 	"isnotnull": OpIsNotNull,
 }
@@ -177,6 +180,34 @@ func ValidateFilterFields(filters []QueryFilter, allowedFields []string) error {
 	return nil
 }
 
+// ParseBooleanFilters turns the values of filters on the given boolean fields into bools.
+// Those fields only take eq and ne, with a value strconv.ParseBool accepts.
+func ParseBooleanFilters(filters []QueryFilter, booleanFields ...string) error {
+	for i, filter := range filters {
+		isBoolean := false
+		for _, field := range booleanFields {
+			if filter.Field == field {
+				isBoolean = true
+				break
+			}
+		}
+		if !isBoolean {
+			continue
+		}
+
+		if filter.Operator != OpEq && filter.Operator != OpNe {
+			return fmt.Errorf("invalid operator for %s: %s (expected eq or ne)", filter.Field, filter.Operator)
+		}
+		raw, _ := filter.Value.(string)
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s (expected true or false)", filter.Field, raw)
+		}
+		filters[i].Value = value
+	}
+	return nil
+}
+
 // ValidateOrderFields validates that all order fields are in the allowed set
 func ValidateOrderFields(orders []OrderClause, allowedFields []string) error {
 	allowed := make(map[string]bool)
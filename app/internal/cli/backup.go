@@ -1,14 +1,18 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/spf13/cobra"
 )
 
 var (
-	scheduleID int64
-	backupID   string
+	scheduleID     int64
+	backupID       string
+	backupStrategy string
 )
 
 var backupCmd = &cobra.Command{
@@ -36,12 +40,26 @@ var backupFullCmd = &cobra.Command{
 			scheduleIDPtr = &scheduleID
 		}
 
-		process, err := services.BackupService.CreateFullBackup(cmd.Context(), backupIDPtr, scheduleIDPtr)
+		if skipped, err := skipForMaintenance(cmd.Context(), services, domain.ProcessTypeBackup, scheduleID); skipped || err != nil {
+			return err
+		}
+		if skipped, err := skipOutsideWindow(cmd.Context(), services, scheduleID); skipped || err != nil {
+			return err
+		}
+		if skipped, err := skipForCooldown(cmd.Context(), services, scheduleID); skipped || err != nil {
+			return err
+		}
+
+		process, err := services.BackupService.CreateFullBackup(cmd.Context(), backupIDPtr, scheduleIDPtr, domain.BackupStrategy(backupStrategy), nil)
 		if err != nil {
 			return fmt.Errorf("failed to create backup: %w", err)
 		}
 
-		fmt.Printf("Full backup started\n")
+		if backupStrategy == string(domain.BackupStrategyLogical) {
+			fmt.Printf("Full backup started (logical dump)\n")
+		} else {
+			fmt.Printf("Full backup started\n")
+		}
 		fmt.Printf("Process ID: %d\n", process.ID)
 		fmt.Printf("Command ID: %s\n", process.CommandID)
 		if scheduleID > 0 {
@@ -71,12 +89,26 @@ var backupIncrementalCmd = &cobra.Command{
 			scheduleIDPtr = &scheduleID
 		}
 
-		process, err := services.BackupService.CreateIncrementalBackup(cmd.Context(), backupIDPtr, nil, scheduleIDPtr)
+		if skipped, err := skipForMaintenance(cmd.Context(), services, domain.ProcessTypeBackup, scheduleID); skipped || err != nil {
+			return err
+		}
+		if skipped, err := skipOutsideWindow(cmd.Context(), services, scheduleID); skipped || err != nil {
+			return err
+		}
+		if skipped, err := skipForCooldown(cmd.Context(), services, scheduleID); skipped || err != nil {
+			return err
+		}
+
+		process, err := services.BackupService.CreateIncrementalBackup(cmd.Context(), backupIDPtr, nil, scheduleIDPtr, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create backup: %w", err)
 		}
 
-		fmt.Printf("Incremental backup started\n")
+		if promoted, _ := process.Args["promoted_to_full"].(bool); promoted {
+			fmt.Printf("Full backup started (promoted: %v)\n", process.Args["promotion_reason"])
+		} else {
+			fmt.Printf("Incremental backup started\n")
+		}
 		fmt.Printf("Process ID: %d\n", process.ID)
 		fmt.Printf("Command ID: %s\n", process.CommandID)
 		if scheduleID > 0 {
@@ -87,6 +119,67 @@ var backupIncrementalCmd = &cobra.Command{
 	},
 }
 
+// skipForMaintenance records a skipped run and reports true while maintenance mode is on.
+// backup and cleanup are the entry points cron calls, so they exit cleanly instead of failing.
+func skipForMaintenance(ctx context.Context, services *Services, processType domain.ProcessType, scheduleID int64) (bool, error) {
+	args := map[string]interface{}{}
+	if scheduleID > 0 {
+		args["schedule_id"] = scheduleID
+	}
+
+	process, err := services.MaintenanceService.SkipScheduled(ctx, processType, args)
+	if err != nil {
+		return false, fmt.Errorf("failed to check maintenance mode: %w", err)
+	}
+	if process == nil {
+		return false, nil
+	}
+
+	fmt.Printf("Skipped: dbcalm is in maintenance mode\n")
+	fmt.Printf("Command ID: %s\n", process.CommandID)
+	return true, nil
+}
+
+// skipOutsideWindow records a skipped run and reports true when a scheduled backup is
+// started outside its schedule's backup window
+func skipOutsideWindow(ctx context.Context, services *Services, scheduleID int64) (bool, error) {
+	if scheduleID <= 0 {
+		return false, nil
+	}
+
+	process, err := services.ScheduleService.SkipOutsideWindow(ctx, scheduleID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup window: %w", err)
+	}
+	if process == nil {
+		return false, nil
+	}
+
+	fmt.Printf("Skipped: outside the backup window of schedule %d\n", scheduleID)
+	fmt.Printf("Command ID: %s\n", process.CommandID)
+	return true, nil
+}
+
+// skipForCooldown records a skipped run and reports true when a scheduled backup is
+// started while the latest backup finished within backup_cooldown
+func skipForCooldown(ctx context.Context, services *Services, scheduleID int64) (bool, error) {
+	if scheduleID <= 0 {
+		return false, nil
+	}
+
+	process, err := services.BackupService.SkipForCooldown(ctx, scheduleID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup cooldown: %w", err)
+	}
+	if process == nil {
+		return false, nil
+	}
+
+	fmt.Printf("Skipped: the latest backup finished within the backup cooldown\n")
+	fmt.Printf("Command ID: %s\n", process.CommandID)
+	return true, nil
+}
+
 func init() {
 	rootCmd.AddCommand(backupCmd)
 	backupCmd.AddCommand(backupFullCmd)
@@ -95,6 +188,7 @@ func init() {
 	// Add flags
 	backupFullCmd.Flags().Int64Var(&scheduleID, "schedule-id", 0, "Schedule ID (for cron jobs)")
 	backupFullCmd.Flags().StringVar(&backupID, "backup-id", "", "Custom backup ID")
+	backupFullCmd.Flags().StringVar(&backupStrategy, "strategy", string(domain.BackupStrategyPhysical), "Backup strategy (physical or logical)")
 
 	backupIncrementalCmd.Flags().Int64Var(&scheduleID, "schedule-id", 0, "Schedule ID (for cron jobs)")
 	backupIncrementalCmd.Flags().StringVar(&backupID, "backup-id", "", "Custom backup ID")
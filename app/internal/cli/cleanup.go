@@ -20,6 +20,35 @@ var cleanupCmd = &cobra.Command{
 		}
 		defer services.Close()
 
+		if skipped, err := skipForMaintenance(cmd.Context(), services, domain.ProcessTypeCleanupBackups, cleanupScheduleID); skipped || err != nil {
+			return err
+		}
+
+		var scheduleIDPtr *int64
+		if cleanupScheduleID > 0 {
+			scheduleIDPtr = &cleanupScheduleID
+		}
+
+		// Show what would be deleted before asking for confirmation
+		expired, err := services.CleanupService.PreviewCleanup(cmd.Context(), scheduleIDPtr)
+		if err != nil {
+			return fmt.Errorf("failed to preview cleanup: %w", err)
+		}
+		if len(expired) == 0 {
+			fmt.Println("No expired backups found")
+		}
+		for _, backup := range expired {
+			fmt.Printf("  %s (%s, started %s)\n", backup.ID, backup.Type, backup.StartTime.Format("2006-01-02 15:04:05"))
+		}
+
+		// Nothing is deleted without expired backups, so there is nothing to confirm
+		if len(expired) == 0 && dryRun {
+			return nil
+		}
+		if len(expired) > 0 && !confirmDestructive(fmt.Sprintf("delete %d expired backup(s)", len(expired))) {
+			return nil
+		}
+
 		var process *domain.Process
 		if cleanupScheduleID > 0 {
 			// Cleanup for specific schedule
@@ -30,7 +59,13 @@ var cleanupCmd = &cobra.Command{
 			fmt.Printf("Cleanup started for schedule %d\n", cleanupScheduleID)
 		} else {
 			// Cleanup for all schedules
-			process, err = services.CleanupService.CleanupAll(cmd.Context())
+			var outcomes []domain.CleanupOutcome
+			process, outcomes, err = services.CleanupService.CleanupAll(cmd.Context())
+			for _, outcome := range outcomes {
+				if outcome.Status != domain.CleanupStatusSucceeded {
+					fmt.Printf("  schedule %d %s: %s\n", outcome.ScheduleID, outcome.Status, outcome.Reason)
+				}
+			}
 			if err != nil {
 				return fmt.Errorf("failed to start cleanup: %w", err)
 			}
@@ -47,4 +82,5 @@ var cleanupCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(cleanupCmd)
 	cleanupCmd.Flags().Int64Var(&cleanupScheduleID, "schedule-id", 0, "Schedule ID (cleanup specific schedule)")
+	addConfirmFlags(cleanupCmd)
 }
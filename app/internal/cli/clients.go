@@ -10,6 +10,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var clientScopes []string
+
 var clientsCmd = &cobra.Command{
 	Use:   "clients",
 	Short: "Manage OAuth clients",
@@ -22,6 +24,9 @@ var clientsAddCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		label := args[0]
+		if err := domain.ValidateScopes(clientScopes); err != nil {
+			return err
+		}
 
 		services, err := initServices(cmd.Context())
 		if err != nil {
@@ -39,7 +44,7 @@ var clientsAddCmd = &cobra.Command{
 		}
 
 		// Create client
-		client := domain.NewClient(label, hashedSecret, []string{"all"})
+		client := domain.NewClient(label, hashedSecret, clientScopes)
 		if err := services.ClientRepo.Create(cmd.Context(), client); err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
@@ -67,11 +72,7 @@ var clientsDeleteCmd = &cobra.Command{
 		defer services.Close()
 
 		// Confirm deletion
-		fmt.Printf("Are you sure you want to delete client '%s'? (yes/no): ", clientID)
-		var confirm string
-		fmt.Scanln(&confirm)
-		if confirm != "yes" {
-			fmt.Println("Cancelled")
+		if !confirmDestructive(fmt.Sprintf("delete client '%s'", clientID)) {
 			return nil
 		}
 
@@ -156,4 +157,8 @@ func init() {
 	clientsCmd.AddCommand(clientsDeleteCmd)
 	clientsCmd.AddCommand(clientsUpdateCmd)
 	clientsCmd.AddCommand(clientsListCmd)
+
+	clientsAddCmd.Flags().StringSliceVar(&clientScopes, "scopes", []string{domain.ScopeAll}, "Scopes granted to the client (all, restore:database), empty allows everything but database restores")
+
+	addConfirmFlags(clientsDeleteCmd)
 }
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	assumeYes   bool
+	dryRun      bool
+	gracePeriod time.Duration
+)
+
+// addConfirmFlags registers the flags shared by all destructive commands
+func addConfirmFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Skip the confirmation prompt (for automation)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print what would happen without making any changes")
+	cmd.Flags().DurationVar(&gracePeriod, "grace-period", 0, "Wait this long before proceeding, giving a chance to abort with Ctrl+C")
+}
+
+// confirmDestructive guards a destructive action. It prints the action and
+// returns false for --dry-run, asks for a "yes" unless --yes was given, and
+// waits out the grace period before letting the caller proceed.
+func confirmDestructive(action string) bool {
+	if dryRun {
+		fmt.Printf("Dry run: would %s\n", action)
+		return false
+	}
+
+	if !assumeYes {
+		fmt.Printf("Are you sure you want to %s? (yes/no): ", action)
+		var confirm string
+		fmt.Scanln(&confirm)
+		if confirm != "yes" {
+			fmt.Println("Cancelled")
+			return false
+		}
+	}
+
+	if gracePeriod > 0 {
+		fmt.Printf("Proceeding in %s, press Ctrl+C to abort\n", gracePeriod)
+		time.Sleep(gracePeriod)
+	}
+
+	return true
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreTarget     string
+	restoreMode       string
+	restoreTargetPath string
+	restoreDatabases  []string
+	restoreRecord     bool
+	restoreArchive    bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup-id>",
+	Short: "Restore a backup",
+	Long: `Restore a backup (and its incremental chain) to the database or to a folder.
+
+Restoring to the database replaces the MySQL/MariaDB data directory and always
+asks for confirmation unless --yes is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := args[0]
+
+		if restoreTarget != "database" && restoreTarget != "folder" {
+			return fmt.Errorf("target must be 'database' or 'folder'")
+		}
+		if restoreMode != string(domain.RestoreModePhysical) && restoreMode != string(domain.RestoreModeLogical) &&
+			restoreMode != string(domain.RestoreModeGrants) {
+			return fmt.Errorf("mode must be 'physical', 'logical' or 'grants'")
+		}
+		if restoreMode != string(domain.RestoreModePhysical) && restoreTarget != "database" {
+			return fmt.Errorf("%s restore is only supported for the database target", restoreMode)
+		}
+		if restoreTargetPath != "" && restoreTarget != "folder" {
+			return fmt.Errorf("--target-path is only supported for the folder target")
+		}
+		if !restoreRecord && restoreTarget != "folder" {
+			return fmt.Errorf("--record=false is only supported for the folder target")
+		}
+		if restoreArchive && restoreTarget != "folder" {
+			return fmt.Errorf("--archive is only supported for the folder target")
+		}
+
+		services, err := initServices(cmd.Context())
+		if err != nil {
+			return err
+		}
+		defer services.Close()
+
+		chain, err := services.BackupService.GetBackupChain(cmd.Context(), id)
+		if err != nil {
+			return fmt.Errorf("failed to get backup chain: %w", err)
+		}
+		fmt.Printf("Backup chain (%d backup(s)):\n", len(chain))
+		for _, backup := range chain {
+			fmt.Printf("  %s (%s)\n", backup.ID, backup.Type)
+		}
+
+		var process *domain.Process
+		if restoreTarget == "database" {
+			action := fmt.Sprintf("restore backup '%s' to the database, replacing the current data directory", id)
+			if restoreMode == string(domain.RestoreModeLogical) {
+				action = fmt.Sprintf("replay backup '%s' into the running database, overwriting existing tables", id)
+			} else if restoreMode == string(domain.RestoreModeGrants) {
+				action = fmt.Sprintf("apply the users and grants captured with backup '%s' to the running database", id)
+			}
+			if !confirmDestructive(action) {
+				return nil
+			}
+			process, err = services.RestoreService.RestoreToDatabase(cmd.Context(), id, domain.RestoreMode(restoreMode), restoreDatabases)
+		} else {
+			if dryRun {
+				fmt.Printf("Dry run: would restore backup '%s' to a folder\n", id)
+				return nil
+			}
+			process, err = services.RestoreService.RestoreToFolder(cmd.Context(), id, restoreTargetPath, restoreDatabases, restoreRecord, restoreArchive)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start restore: %w", err)
+		}
+
+		fmt.Printf("Restore to %s started\n", restoreTarget)
+		fmt.Printf("Command ID: %s\n", process.CommandID)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVar(&restoreTarget, "target", "folder", "Restore target (database or folder)")
+	restoreCmd.Flags().StringVar(&restoreMode, "mode", string(domain.RestoreModePhysical), "Restore mode for database restores (physical, logical or grants)")
+	restoreCmd.Flags().StringVar(&restoreTargetPath, "target-path", "", "Folder to restore to, outside the backup directory (default: <backup_dir>/restores/<timestamp>)")
+	restoreCmd.Flags().StringSliceVar(&restoreDatabases, "databases", nil, "Restore only these databases (logical database restores and folder restores)")
+	restoreCmd.Flags().BoolVar(&restoreRecord, "record", true, "Add the restore to the restore history (--record=false for throwaway folder restores)")
+	restoreCmd.Flags().BoolVar(&restoreArchive, "archive", false, "Pack the prepared folder into a tar.zst archive (folder restores)")
+	addConfirmFlags(restoreCmd)
+}
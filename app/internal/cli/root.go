@@ -3,10 +3,10 @@ package cli
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/martijn/dbcalm/internal/adapter/cmd"
 	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 	"github.com/martijn/dbcalm/internal/core/service"
 	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
@@ -61,7 +61,11 @@ func init() {
 // initServices initializes all services
 func initServices(ctx context.Context) (*Services, error) {
 	// Initialize database
-	db, err := sqlite.New(cfg.DBPath)
+	db, err := sqlite.NewWithPool(cfg.DBPath, sqlite.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -76,51 +80,108 @@ func initServices(ctx context.Context) (*Services, error) {
 	processRepo := sqlite.NewProcessRepository(db)
 
 	// Initialize socket clients
-	dbClient := dbcmd.NewClient(cfg.MariaDBCmdSocketPath, 30*time.Second)
-	cmdClient := cmd.NewClient(cfg.CmdSocketPath, 30*time.Second)
+	dbClient := dbcmd.NewClient(cfg.MariaDBCmdSocketPath, cfg.SocketTimeout).WithRetry(cfg.SocketRetryAttempts, cfg.SocketRetryBackoff)
+	cmdClient := cmd.NewClient(cfg.CmdSocketPath, cfg.SocketTimeout).WithRetry(cfg.SocketRetryAttempts, cfg.SocketRetryBackoff)
+
+	scheduleLocation, err := cfg.ScheduleLocation()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, clientRepo, authCodeRepo, cfg.JWTSecretKey, cfg.JWTAlgorithm)
+	authService := service.NewAuthService(userRepo, clientRepo, authCodeRepo, service.TokenOptions{
+		JWTSecret:          cfg.JWTSecretKey,
+		JWTAlgorithm:       cfg.JWTAlgorithm,
+		JWTIssuer:          cfg.JWTIssuer,
+		JWTAudience:        cfg.JWTAudience,
+		JWTLeeway:          cfg.JWTLeeway,
+		AuthCodeExpiration: cfg.AuthCodeExpiration,
+	})
 	processService := service.NewProcessService(processRepo)
 	processService.Start() // Start process queue monitor
-
-	backupService := service.NewBackupService(backupRepo, processService, dbClient)
-	restoreService := service.NewRestoreService(restoreRepo, backupRepo, dbClient)
-	scheduleService := service.NewScheduleService(scheduleRepo, backupRepo, processService, cmdClient, "/usr/bin/dbcalm", cfg.LogFile)
-	cleanupService := service.NewCleanupService(backupRepo, scheduleRepo, processService, cmdClient, cfg.BackupDir)
+	processUsageService := service.NewProcessUsageService(processRepo, dbClient)
+
+	backupService := service.NewBackupService(backupRepo, scheduleRepo, processService, dbClient, cfg.MaxIncrementalAge).
+		WithCooldown(cfg.BackupCooldown)
+	restoreService := service.NewRestoreService(restoreRepo, backupRepo, processRepo, dbClient)
+	scheduleService := service.NewScheduleService(scheduleRepo, backupRepo, processService, cmdClient, "/usr/bin/dbcalm", cfg.LogFile, domain.CronSyncFailure(cfg.CronSyncFailure), domain.DuplicateSchedulePolicy(cfg.DuplicateSchedule), scheduleLocation)
+	cleanupService := service.NewCleanupService(backupRepo, scheduleRepo, processService, cmdClient, cfg.BackupDir, domain.RetentionAge(cfg.RetentionAge)).
+		WithDeletionCheck(cfg.CleanupCheckAttempts, cfg.CleanupCheckBackoff)
+	retryService := service.NewRetryService(processRepo, backupService, restoreService, cleanupService)
+	serverService := service.NewServerService(dbClient)
+	maintenanceService := service.NewMaintenanceService(sqlite.NewMaintenanceRepository(db), processRepo)
+	catchUpService := service.NewCatchUpService(scheduleRepo, processService, backupService, maintenanceService, cfg.CatchUpWindow, scheduleLocation)
+	idempotencyService := service.NewIdempotencyService(sqlite.NewIdempotencyRepository(db), cfg.IdempotencyTTL)
+	catalogService := service.NewCatalogService(sqlite.NewCatalogRepository(db), cfg.CatalogBackupDir, cfg.CatalogBackupInterval, cfg.CatalogBackupKeep)
+	authCodeSweepService := service.NewAuthCodeSweepService(authCodeRepo, cfg.AuthCodeSweepInterval)
+	diskMonitorService := service.NewDiskMonitorService(cfg.BackupDir, cfg.DiskCheckInterval, cfg.DiskWarningPercent, cfg.DiskCriticalPercent, cfg.DiskAlertWebhook)
+	reconcileService := service.NewReconcileService(backupRepo, processRepo, dbClient, cmdClient, cfg.ReconcileInterval, domain.OrphanBackupPolicy(cfg.OrphanBackupPolicy), cfg.ReconcileWebhook)
 
 	return &Services{
-		DB:              db,
-		UserRepo:        userRepo,
-		ClientRepo:      clientRepo,
-		ScheduleRepo:    scheduleRepo,
-		BackupRepo:      backupRepo,
-		AuthService:     authService,
-		ProcessService:  processService,
-		BackupService:   backupService,
-		RestoreService:  restoreService,
-		ScheduleService: scheduleService,
-		CleanupService:  cleanupService,
+		DB:                 db,
+		UserRepo:           userRepo,
+		ClientRepo:         clientRepo,
+		ScheduleRepo:       scheduleRepo,
+		BackupRepo:         backupRepo,
+		AuthService:        authService,
+		AuthCodeSweep:      authCodeSweepService,
+		ProcessService:     processService,
+		ProcessUsage:       processUsageService,
+		BackupService:      backupService,
+		RestoreService:     restoreService,
+		ScheduleService:    scheduleService,
+		CleanupService:     cleanupService,
+		RetryService:       retryService,
+		ServerService:      serverService,
+		MaintenanceService: maintenanceService,
+		CatalogService:     catalogService,
+		DiskMonitorService: diskMonitorService,
+		ReconcileService:   reconcileService,
+		CatchUpService:     catchUpService,
+		IdempotencyService: idempotencyService,
 	}, nil
 }
 
 // Services holds all initialized services
 type Services struct {
-	DB              *sqlite.DB
-	UserRepo        repository.UserRepository
-	ClientRepo      repository.ClientRepository
-	ScheduleRepo    repository.ScheduleRepository
-	BackupRepo      repository.BackupRepository
-	AuthService     *service.AuthService
-	ProcessService  *service.ProcessService
-	BackupService   *service.BackupService
-	RestoreService  *service.RestoreService
-	ScheduleService *service.ScheduleService
-	CleanupService  *service.CleanupService
+	DB                 *sqlite.DB
+	UserRepo           repository.UserRepository
+	ClientRepo         repository.ClientRepository
+	ScheduleRepo       repository.ScheduleRepository
+	BackupRepo         repository.BackupRepository
+	AuthService        *service.AuthService
+	AuthCodeSweep      *service.AuthCodeSweepService
+	ProcessService     *service.ProcessService
+	ProcessUsage       *service.ProcessUsageService
+	BackupService      *service.BackupService
+	RestoreService     *service.RestoreService
+	ScheduleService    *service.ScheduleService
+	CleanupService     *service.CleanupService
+	RetryService       *service.RetryService
+	ServerService      *service.ServerService
+	MaintenanceService *service.MaintenanceService
+	CatalogService     *service.CatalogService
+	DiskMonitorService *service.DiskMonitorService
+	ReconcileService   *service.ReconcileService
+	CatchUpService     *service.CatchUpService
+	IdempotencyService *service.IdempotencyService
 }
 
 // Close closes all resources
 func (s *Services) Close() {
+	if s.CatalogService != nil {
+		s.CatalogService.Stop()
+	}
+	if s.DiskMonitorService != nil {
+		s.DiskMonitorService.Stop()
+	}
+	if s.ReconcileService != nil {
+		s.ReconcileService.Stop()
+	}
+	if s.AuthCodeSweep != nil {
+		s.AuthCodeSweep.Stop()
+	}
 	if s.ProcessService != nil {
 		s.ProcessService.Stop()
 	}
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
@@ -29,15 +30,35 @@ var serverCmd = &cobra.Command{
 			cfg,
 			services.AuthService,
 			services.ProcessService,
+			services.ProcessUsage,
 			services.BackupService,
 			services.RestoreService,
 			services.ScheduleService,
 			services.CleanupService,
+			services.RetryService,
+			services.ServerService,
+			services.MaintenanceService,
+			services.CatalogService,
+			services.IdempotencyService,
+			services.DiskMonitorService,
 			services.ClientRepo,
 			services.ScheduleRepo,
 			services.BackupRepo,
 		)
 
+		// Only the long-running server backs up the catalog periodically
+		services.CatalogService.Start()
+		services.DiskMonitorService.Start()
+		services.ReconcileService.Start()
+		services.AuthCodeSweep.Start()
+
+		// Start the backups cron missed while the server was down, when catch_up_window is set
+		go func() {
+			if _, err := services.CatchUpService.Run(context.Background(), time.Now()); err != nil {
+				log.Printf("Warning: failed to catch up missed schedules: %v", err)
+			}
+		}()
+
 		// Start server in goroutine
 		serverErr := make(chan error, 1)
 		go func() {
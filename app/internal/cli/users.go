@@ -91,11 +91,7 @@ var usersDeleteCmd = &cobra.Command{
 		defer services.Close()
 
 		// Confirm deletion
-		fmt.Printf("Are you sure you want to delete user '%s'? (yes/no): ", username)
-		var confirm string
-		fmt.Scanln(&confirm)
-		if confirm != "yes" {
-			fmt.Println("Cancelled")
+		if !confirmDestructive(fmt.Sprintf("delete user '%s'", username)) {
 			return nil
 		}
 
@@ -209,4 +205,6 @@ func init() {
 	usersCmd.AddCommand(usersDeleteCmd)
 	usersCmd.AddCommand(usersUpdatePasswordCmd)
 	usersCmd.AddCommand(usersListCmd)
+
+	addConfirmFlags(usersDeleteCmd)
 }
@@ -14,13 +14,13 @@ type AuthCode struct {
 	CreatedAt time.Time `db:"created_at"`
 }
 
-func NewAuthCode(username string, scopes []string, expirationMinutes int) *AuthCode {
+func NewAuthCode(username string, scopes []string, expiration time.Duration) *AuthCode {
 	now := time.Now()
 	return &AuthCode{
 		Code:      uuid.New().String(),
 		Username:  username,
 		Scopes:    scopes,
-		ExpiresAt: now.Add(time.Duration(expirationMinutes) * time.Minute),
+		ExpiresAt: now.Add(expiration),
 		CreatedAt: now,
 	}
 }
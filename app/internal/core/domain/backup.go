@@ -1,6 +1,26 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// backupIDPattern keeps a backup ID safe as a single path element under backup_dir: no
+// separators, no leading dot (so no "." or ".."), at most 128 characters
+var backupIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// NormalizeBackupID trims the whitespace around a caller-supplied backup ID and checks
+// it can't escape backup_dir
+func NormalizeBackupID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if !backupIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid backup id %q: use up to 128 letters, digits, '.', '_' or '-', starting with a letter or digit", id)
+	}
+	return id, nil
+}
 
 type BackupType string
 
@@ -9,26 +29,85 @@ const (
 	BackupTypeIncremental BackupType = "incremental"
 )
 
+// BackupStrategy is how a backup was taken: physical (mariabackup/xtrabackup)
+// or logical (a compressed mariadb-dump/mysqldump SQL dump)
+type BackupStrategy string
+
+const (
+	BackupStrategyPhysical BackupStrategy = "physical"
+	BackupStrategyLogical  BackupStrategy = "logical"
+)
+
+// Roles of the server a backup was taken from, as configured with db-cmd's source
+const (
+	BackupSourcePrimary = "primary"
+	BackupSourceReplica = "replica"
+)
+
+// VerificationStatus is the outcome of preparing a backup in a temporary directory
+// to check it can be restored
+type VerificationStatus string
+
+const (
+	VerificationPassed VerificationStatus = "passed"
+	VerificationFailed VerificationStatus = "failed"
+)
+
 type Backup struct {
-	ID           string     `db:"id"`
-	Type         BackupType `db:"type"`
-	FromBackupID *string    `db:"from_backup_id"` // For incremental backups
-	ScheduleID   *int64     `db:"schedule_id"`  // For scheduled backups
-	StartTime    time.Time  `db:"start_time"`
-	EndTime      *time.Time `db:"end_time"`
-	ProcessID    int64      `db:"process_id"`
-	Size         *int64     `db:"size"` // In bytes
+	ID                string         `db:"id"`
+	Type              BackupType     `db:"type"`
+	FromBackupID      *string        `db:"from_backup_id"` // For incremental backups
+	ScheduleID        *int64         `db:"schedule_id"`    // For scheduled backups
+	Strategy          BackupStrategy `db:"strategy"`
+	ExcludedDatabases []string       `db:"excluded_databases"` // Databases deliberately left out, so restores aren't complete
+	Description       *string        `db:"description"`        // Operator's note on why the backup was taken
+	Source            *string        `db:"source"`             // Role of the server it was taken from, nil when not configured
+	// Verification is nil until the backup has been verified
+	Verification   *VerificationStatus `db:"verification_status"`
+	LastVerifiedAt *time.Time          `db:"last_verified_at"`
+	StartTime      time.Time           `db:"start_time"`
+	EndTime        *time.Time          `db:"end_time"`
+	ProcessID      int64               `db:"process_id"`
+	Size           *int64              `db:"size"` // In bytes
+	// UncompressedSize is nil when the backup isn't compressed
+	UncompressedSize *int64 `db:"uncompressed_size"`
+	// ExpiresAt overrides the schedule's retention: while it is in the future the backup,
+	// and with it its chain, is never cleaned up. Nil, or a time passed, leaves it to the
+	// retention policy.
+	ExpiresAt *time.Time `db:"expires_at"`
+	// GrantsCaptured is set when db-cmd captured the server's users and grants with the
+	// backup, which restore_mode grants applies
+	GrantsCaptured bool `db:"grants_captured"`
+	// RestoreCount and LastRestoredAt are derived from the restores of the backup
+	RestoreCount   int        `db:"restore_count"`
+	LastRestoredAt *time.Time `db:"last_restored_at"`
 }
 
 func NewBackup(id string, backupType BackupType, processID int64) *Backup {
 	return &Backup{
 		ID:        id,
 		Type:      backupType,
+		Strategy:  BackupStrategyPhysical,
 		StartTime: time.Now(),
 		ProcessID: processID,
 	}
 }
 
+// Healthy is false once verification found the backup could not be prepared
+func (b *Backup) Healthy() bool {
+	return b.Verification == nil || *b.Verification != VerificationFailed
+}
+
+// CompressionRatio is the uncompressed size divided by the size on disk, rounded to two
+// decimals. It is nil when the backup isn't compressed or its sizes weren't recorded.
+func (b *Backup) CompressionRatio() *float64 {
+	if b.Size == nil || b.UncompressedSize == nil || *b.Size <= 0 {
+		return nil
+	}
+	ratio := math.Round(float64(*b.UncompressedSize)/float64(*b.Size)*100) / 100
+	return &ratio
+}
+
 func (b *Backup) Complete(endTime time.Time, size *int64) {
 	b.EndTime = &endTime
 	b.Size = size
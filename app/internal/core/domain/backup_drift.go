@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// OrphanBackupPolicy decides what the periodic reconciliation does when the catalog and
+// backup_dir disagree
+type OrphanBackupPolicy string
+
+const (
+	OrphanBackupLog    OrphanBackupPolicy = "log"    // Only log the drift
+	OrphanBackupAlert  OrphanBackupPolicy = "alert"  // Log it and post it to the webhook
+	OrphanBackupImport OrphanBackupPolicy = "import" // Add catalog rows for backups found in backup_dir
+	OrphanBackupRemove OrphanBackupPolicy = "remove" // Delete orphan files and catalog rows without files
+)
+
+// BackupFile is a backup db-cmd found in backup_dir
+type BackupFile struct {
+	ID   string
+	Path string
+	Kind string // folder or stream
+	// Type is full or incremental, empty when it can't be told without unpacking a stream
+	Type     BackupType
+	Strategy BackupStrategy
+	// FromBackupID is the backup an incremental's LSN range starts at, nil when none is found
+	FromBackupID *string
+	ModifiedAt   time.Time
+}
+
+// BackupDrift is where the catalog and backup_dir disagree: backups in backup_dir without
+// a catalog row, and catalog rows whose backup is gone from backup_dir
+type BackupDrift struct {
+	Orphans []BackupFile
+	Missing []*Backup
+}
+
+// Empty reports whether the catalog and backup_dir agree
+func (d *BackupDrift) Empty() bool {
+	return len(d.Orphans) == 0 && len(d.Missing) == 0
+}
@@ -0,0 +1,97 @@
+package domain
+
+import "time"
+
+const (
+	// EstimateSamples is how many recent backups an estimate is based on
+	EstimateSamples = 10
+	// MinEstimateSamples is the history an estimate needs, with fewer there is none
+	MinEstimateSamples = 3
+)
+
+// BackupEstimate is how long the next backup of a type is expected to take, going by the
+// recent completed ones. The estimate fields are nil when there is too little history.
+type BackupEstimate struct {
+	Type     BackupType
+	Strategy BackupStrategy
+	Samples  int // Completed backups the estimate is based on, newest first
+	// AverageDuration is the mean duration of the samples
+	AverageDuration *time.Duration
+	// SizeTrend is by how many bytes per day the samples grew, nil when too few of them
+	// have a recorded size
+	SizeTrend *float64
+	// EstimatedSize is the size the trend puts the next backup at
+	EstimatedSize *int64
+	// EstimatedDuration is the average duration, scaled by the estimated size against the
+	// samples' average size when there is a trend
+	EstimatedDuration *time.Duration
+}
+
+// NewBackupEstimate estimates the next backup at now from completed backups of a type and
+// strategy, newest first. Only the first EstimateSamples with a positive duration count.
+func NewBackupEstimate(backupType BackupType, strategy BackupStrategy, backups []*Backup, now time.Time) *BackupEstimate {
+	estimate := &BackupEstimate{Type: backupType, Strategy: strategy}
+
+	var samples []*Backup
+	for _, backup := range backups {
+		if len(samples) == EstimateSamples {
+			break
+		}
+		if backup.EndTime != nil && backup.EndTime.After(backup.StartTime) {
+			samples = append(samples, backup)
+		}
+	}
+	estimate.Samples = len(samples)
+	if len(samples) < MinEstimateSamples {
+		return estimate
+	}
+
+	var total time.Duration
+	for _, backup := range samples {
+		total += backup.EndTime.Sub(backup.StartTime)
+	}
+	average := total / time.Duration(len(samples))
+	estimate.AverageDuration = &average
+	estimated := average
+	estimate.EstimatedDuration = &estimated
+
+	// Least squares fit of size against days before now, its value at now is the
+	// estimated size
+	var sized []*Backup
+	for _, backup := range samples {
+		if backup.Size != nil && *backup.Size > 0 {
+			sized = append(sized, backup)
+		}
+	}
+	if len(sized) < MinEstimateSamples {
+		return estimate
+	}
+	n := float64(len(sized))
+	var sumX, sumY, sumXX, sumXY float64
+	var sizedDuration time.Duration
+	for _, backup := range sized {
+		x := backup.EndTime.Sub(now).Hours() / 24
+		y := float64(*backup.Size)
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+		sizedDuration += backup.EndTime.Sub(backup.StartTime)
+	}
+	meanSize := sumY / n
+	slope := 0.0
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		slope = (n*sumXY - sumX*sumY) / denominator
+	}
+	projected := (sumY - slope*sumX) / n
+	if projected <= 0 {
+		projected = meanSize
+	}
+	size := int64(projected)
+	estimate.SizeTrend = &slope
+	estimate.EstimatedSize = &size
+
+	scaled := time.Duration(float64(sizedDuration) / n * projected / meanSize)
+	estimate.EstimatedDuration = &scaled
+	return estimate
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// CatalogBackup is a snapshot of dbcalm's own SQLite catalog
+type CatalogBackup struct {
+	Name      string
+	Path      string
+	Size      int64 // In bytes
+	CreatedAt time.Time
+}
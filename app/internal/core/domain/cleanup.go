@@ -0,0 +1,17 @@
+package domain
+
+type CleanupStatus string
+
+const (
+	CleanupStatusSucceeded CleanupStatus = "succeeded"
+	CleanupStatusSkipped   CleanupStatus = "skipped"
+	CleanupStatusError     CleanupStatus = "error"
+)
+
+// CleanupOutcome reports what a cleanup run did for a single schedule
+type CleanupOutcome struct {
+	ScheduleID     int64
+	Status         CleanupStatus
+	Reason         string // Why the schedule was skipped or errored
+	ExpiredBackups int    // Backups handed to cmd for deletion
+}
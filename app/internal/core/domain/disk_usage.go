@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+type DiskState string
+
+const (
+	DiskStateUnknown  DiskState = "unknown"  // Not checked yet, or the check failed
+	DiskStateOK       DiskState = "ok"       // Below the warning threshold
+	DiskStateWarning  DiskState = "warning"  // At or over the warning threshold
+	DiskStateCritical DiskState = "critical" // At or over the critical threshold, backups are likely to fail
+)
+
+// DiskUsage is the last check of the filesystem backup_dir lives on. The state is
+// the worse of its space and inode usage.
+type DiskUsage struct {
+	Path              string
+	State             DiskState
+	UsedPercent       float64
+	InodesUsedPercent float64 // Zero on filesystems without a fixed number of inodes
+	FreeBytes         uint64
+	FreeInodes        uint64
+	CheckedAt         time.Time
+	Error             string // Why the check failed, the state is unknown
+}
+
+// DiskStateFor returns the state of a filesystem used for usedPercent, with the
+// thresholds in percent used
+func DiskStateFor(usedPercent float64, warningPercent, criticalPercent int) DiskState {
+	switch {
+	case usedPercent >= float64(criticalPercent):
+		return DiskStateCritical
+	case usedPercent >= float64(warningPercent):
+		return DiskStateWarning
+	default:
+		return DiskStateOK
+	}
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// IdempotencyKey records a request made with an Idempotency-Key header, so a retry of it
+// gets the original response instead of starting the backup or restore again. Keys are
+// scoped to the caller that sent them.
+type IdempotencyKey struct {
+	Key        string    `db:"key"`
+	Owner      string    `db:"owner"` // Subject of the caller's token
+	Method     string    `db:"method"`
+	Path       string    `db:"path"`
+	StatusCode int       `db:"status_code"` // Zero while the original request is still running
+	Response   []byte    `db:"response"`
+	CommandID  *string   `db:"command_id"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// Completed reports whether the original request has finished and its response is stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
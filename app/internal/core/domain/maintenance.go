@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Maintenance is the global maintenance-mode state. While enabled, scheduled
+// backups and cleanups are skipped, and manual backups and restores are refused
+// when BlockManual is set.
+type Maintenance struct {
+	Enabled     bool      `db:"enabled"`
+	BlockManual bool      `db:"block_manual"`
+	Reason      *string   `db:"reason"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
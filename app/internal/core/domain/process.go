@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,30 +13,36 @@ const (
 	ProcessStatusRunning ProcessStatus = "running"
 	ProcessStatusSuccess ProcessStatus = "success"
 	ProcessStatusFailed  ProcessStatus = "failed"
+	ProcessStatusSkipped ProcessStatus = "skipped" // Scheduled run skipped, e.g. in maintenance mode
 )
 
 type ProcessType string
 
 const (
-	ProcessTypeBackup             ProcessType = "backup"
-	ProcessTypeRestore            ProcessType = "restore"
-	ProcessTypeCleanupBackups     ProcessType = "cleanup_backups"
+	ProcessTypeBackup              ProcessType = "backup"
+	ProcessTypeRestore             ProcessType = "restore"
+	ProcessTypeCleanupBackups      ProcessType = "cleanup_backups"
 	ProcessTypeUpdateCronSchedules ProcessType = "update_cron_schedules"
+	ProcessTypeConsolidateBackup   ProcessType = "consolidate_backup"
 )
 
 type Process struct {
-	ID        int64                  `db:"id"`
-	CommandID string                 `db:"command_id"` // UUID for API polling
-	Command   string                 `db:"command"`
-	PID       *int                   `db:"pid"`
-	Status    ProcessStatus          `db:"status"`
-	Output    *string                `db:"output"`
-	Error     *string                `db:"error"`
-	ReturnCode *int                  `db:"return_code"`
-	StartTime time.Time              `db:"start_time"`
-	EndTime   *time.Time             `db:"end_time"`
-	Type      ProcessType            `db:"type"`
-	Args      map[string]interface{} `db:"args"` // JSON-serializable args
+	ID         int64                  `db:"id"`
+	CommandID  string                 `db:"command_id"` // UUID for API polling
+	Command    string                 `db:"command"`
+	PID        *int                   `db:"pid"`
+	Status     ProcessStatus          `db:"status"`
+	Output     *string                `db:"output"`
+	Error      *string                `db:"error"`
+	ReturnCode *int                   `db:"return_code"`
+	StartTime  time.Time              `db:"start_time"`
+	EndTime    *time.Time             `db:"end_time"`
+	Type       ProcessType            `db:"type"`
+	Args       map[string]interface{} `db:"args"`        // JSON-serializable args
+	Progress   *int                   `db:"progress"`    // 0-100, set by db-cmd during restores
+	Phase      *string                `db:"phase"`       // e.g. copying, preparing, copying-back
+	ScheduleID *int64                 `db:"schedule_id"` // Schedule a backup process ran for, copied from its args
+	RetryOf    *string                `db:"retry_of"`    // Command ID of the failed process this one retries
 }
 
 func NewProcess(command string, processType ProcessType, args map[string]interface{}) *Process {
@@ -43,16 +50,71 @@ func NewProcess(command string, processType ProcessType, args map[string]interfa
 	// PID will be set later when the actual process starts
 	pid := 0
 	return &Process{
-		CommandID: uuid.New().String(),
-		Command:   command,
-		PID:       &pid,
-		Status:    ProcessStatusRunning,
-		StartTime: time.Now(),
-		Type:      processType,
-		Args:      args,
+		CommandID:  uuid.New().String(),
+		Command:    command,
+		PID:        &pid,
+		Status:     ProcessStatusRunning,
+		StartTime:  time.Now(),
+		Type:       processType,
+		Args:       args,
+		ScheduleID: scheduleIDArg(args),
 	}
 }
 
+// Schedule returns the schedule the process ran for, from its column or, for processes
+// whose column was never filled, its args
+func (p *Process) Schedule() *int64 {
+	if p.ScheduleID != nil {
+		return p.ScheduleID
+	}
+	return scheduleIDArg(p.Args)
+}
+
+// scheduleIDArg reads the schedule_id arg, which is an int64 in memory and a float64 once
+// it has been through JSON
+func scheduleIDArg(args map[string]interface{}) *int64 {
+	var id int64
+	switch v := args["schedule_id"].(type) {
+	case int64:
+		id = v
+	case int:
+		id = int64(v)
+	case float64:
+		id = int64(v)
+	}
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
+
+// ResourceID is the resource the process acts on: the backup taken, consolidated or
+// verified, the backup a restore brings back (the last of its chain), or the schedule a
+// cleanup applied the retention of. It is nil when there is no single resource.
+func (p *Process) ResourceID() *string {
+	switch p.Type {
+	case ProcessTypeRestore:
+		if ids, ok := p.Args["id_list"].([]interface{}); ok && len(ids) > 0 {
+			if id, ok := ids[len(ids)-1].(string); ok {
+				return &id
+			}
+		}
+		return nil
+	case ProcessTypeCleanupBackups:
+		if p.ScheduleID == nil {
+			return nil
+		}
+		id := strconv.FormatInt(*p.ScheduleID, 10)
+		return &id
+	case ProcessTypeUpdateCronSchedules:
+		return nil
+	}
+	if id, ok := p.Args["id"].(string); ok {
+		return &id
+	}
+	return nil
+}
+
 func (p *Process) SetPID(pid int) {
 	p.PID = &pid
 }
@@ -86,5 +148,5 @@ func (p *Process) Fail(errorOutput string) {
 }
 
 func (p *Process) IsComplete() bool {
-	return p.Status == ProcessStatusSuccess || p.Status == ProcessStatusFailed
+	return p.Status == ProcessStatusSuccess || p.Status == ProcessStatusFailed || p.Status == ProcessStatusSkipped
 }
@@ -0,0 +1,28 @@
+package domain
+
+// ProcessUsage is the resource usage of a running process, read by db-cmd from /proc.
+// CPU time and IO are totals since the process started, so a backup waiting on disk
+// shows IO wait and little CPU time over its elapsed time.
+type ProcessUsage struct {
+	PID                int
+	State              string // Kernel state: R running, S sleeping, D waiting on disk IO
+	Threads            int
+	ElapsedSeconds     float64
+	CPUUserSeconds     float64
+	CPUSystemSeconds   float64
+	BlockIOWaitSeconds float64 // Zero when the kernel's delay accounting is off
+	RSSBytes           int64
+	ReadBytes          int64 // Read from storage
+	WriteBytes         int64 // Written to storage
+}
+
+// UsageTracked reports whether the process is run by db-cmd, the only service that can
+// read its usage
+func (p *Process) UsageTracked() bool {
+	switch p.Type {
+	case ProcessTypeBackup, ProcessTypeRestore, ProcessTypeConsolidateBackup:
+		return true
+	default:
+		return false
+	}
+}
@@ -9,12 +9,27 @@ const (
 	RestoreTargetFolder   RestoreTarget = "folder"
 )
 
+type RestoreMode string
+
+const (
+	// RestoreModePhysical copies prepared data files into a stopped server's data directory
+	RestoreModePhysical RestoreMode = "physical"
+	// RestoreModeLogical replays a SQL dump into a running server
+	RestoreModeLogical RestoreMode = "logical"
+	// RestoreModeGrants applies only the users and grants captured with a backup to a running server
+	RestoreModeGrants RestoreMode = "grants"
+)
+
 type Restore struct {
 	ID              int64         `db:"id"`
 	BackupID        string        `db:"backup_id"`
 	BackupTimestamp time.Time     `db:"backup_timestamp"`
 	Target          RestoreTarget `db:"target"`
 	TargetPath      string        `db:"target_path"`
+	Archive         bool          `db:"archive"` // TargetPath is a tar.zst archive of the prepared folder
+	Mode            RestoreMode   `db:"mode"`
+	Databases       []string      `db:"databases"`        // The databases the restore was limited to, nil for all
+	SafetyCopyPath  *string       `db:"safety_copy_path"` // Copy of the data directory taken before a database restore, nil when none was
 	StartTime       time.Time     `db:"start_time"`
 	EndTime         *time.Time    `db:"end_time"`
 	ProcessID       int64         `db:"process_id"`
@@ -26,6 +41,7 @@ func NewRestore(backupID string, backupTimestamp time.Time, target RestoreTarget
 		BackupTimestamp: backupTimestamp,
 		Target:          target,
 		TargetPath:      targetPath,
+		Mode:            RestoreModePhysical,
 		StartTime:       time.Now(),
 		ProcessID:       processID,
 	}
@@ -34,3 +50,32 @@ func NewRestore(backupID string, backupTimestamp time.Time, target RestoreTarget
 func (r *Restore) Complete(endTime time.Time) {
 	r.EndTime = &endTime
 }
+
+// RestorePlan is what a restore to a point in time needs: the chain of the latest backup
+// completed by then, full backup first
+type RestorePlan struct {
+	TargetTime time.Time
+	Chain      []*Backup
+	// BackupTimestamp is the point in time the chain restores the data to, at or before
+	// TargetTime
+	BackupTimestamp time.Time
+	// TotalSize is the bytes to prepare, backups without a recorded size count as 0
+	TotalSize int64
+}
+
+func NewRestorePlan(targetTime time.Time, chain []*Backup) *RestorePlan {
+	plan := &RestorePlan{TargetTime: targetTime, Chain: chain}
+	if len(chain) > 0 {
+		latest := chain[len(chain)-1]
+		plan.BackupTimestamp = latest.StartTime
+		if latest.EndTime != nil {
+			plan.BackupTimestamp = *latest.EndTime
+		}
+	}
+	for _, backup := range chain {
+		if backup.Size != nil {
+			plan.TotalSize += *backup.Size
+		}
+	}
+	return plan
+}
@@ -1,6 +1,12 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
 
 type ScheduleFrequency string
 
@@ -22,26 +28,71 @@ const (
 type RetentionUnit string
 
 const (
+	RetentionUnitHours  RetentionUnit = "hours" // For hourly and interval schedules
 	RetentionUnitDays   RetentionUnit = "days"
 	RetentionUnitWeeks  RetentionUnit = "weeks"
 	RetentionUnitMonths RetentionUnit = "months"
 )
 
+// CronSyncFailure decides what happens to a schedule change the cron file can't be updated for
+type CronSyncFailure string
+
+const (
+	CronSyncRollback CronSyncFailure = "rollback" // Undo the change, the catalog and cron stay in sync
+	CronSyncKeep     CronSyncFailure = "keep"     // Keep the change, a cron resync catches up later
+)
+
+// DuplicateSchedulePolicy decides what happens to a new schedule that runs the same
+// backups at the same times as an enabled one
+type DuplicateSchedulePolicy string
+
+const (
+	DuplicateScheduleAllow  DuplicateSchedulePolicy = "allow"
+	DuplicateScheduleWarn   DuplicateSchedulePolicy = "warn"   // Create it and log the schedule it duplicates
+	DuplicateScheduleReject DuplicateSchedulePolicy = "reject" // Refuse it, naming the schedule it duplicates
+)
+
+// RetentionAge is the backup timestamp retention measures a backup's age from
+type RetentionAge string
+
+const (
+	RetentionAgeStartTime RetentionAge = "start_time"
+	RetentionAgeEndTime   RetentionAge = "end_time" // Counts a long backup from when it completed
+)
+
 type Schedule struct {
-	ID             int64             `db:"id"`
-	BackupType     BackupType        `db:"backup_type"`
-	Frequency      ScheduleFrequency `db:"frequency"`
-	DayOfWeek      *int              `db:"day_of_week"` // 0-6 (Sunday-Saturday)
-	DayOfMonth     *int              `db:"day_of_month"` // 1-31
-	Hour           *int              `db:"hour"` // 0-23
-	Minute         *int              `db:"minute"` // 0-59
-	IntervalValue  *int              `db:"interval_value"`
-	IntervalUnit   *IntervalUnit     `db:"interval_unit"`
-	RetentionValue *int              `db:"retention_value"`
-	RetentionUnit  *RetentionUnit    `db:"retention_unit"`
-	Enabled        bool              `db:"enabled"`
-	CreatedAt      time.Time         `db:"created_at"`
-	UpdatedAt      time.Time         `db:"updated_at"`
+	ID               int64             `db:"id"`
+	BackupType       BackupType        `db:"backup_type"`
+	Frequency        ScheduleFrequency `db:"frequency"`
+	DayOfWeek        *int              `db:"day_of_week"`  // 0-6 (Sunday-Saturday), the first day of DaysOfWeek
+	DaysOfWeek       []int             `db:"days_of_week"` // Set when a weekly schedule runs on more than one day
+	DayOfMonth       *int              `db:"day_of_month"` // 1-31
+	Hour             *int              `db:"hour"`         // 0-23
+	Minute           *int              `db:"minute"`       // 0-59
+	IntervalValue    *int              `db:"interval_value"`
+	IntervalUnit     *IntervalUnit     `db:"interval_unit"`
+	RetentionValue   *int              `db:"retention_value"`
+	RetentionUnit    *RetentionUnit    `db:"retention_unit"`
+	Strategy         BackupStrategy    `db:"strategy"`
+	ExcludeDatabases []string          `db:"exclude_databases"`
+	PreBackupHook    *string           `db:"pre_backup_hook"`  // Overrides db-cmd's global pre_backup_hook
+	PostBackupHook   *string           `db:"post_backup_hook"` // Overrides db-cmd's global post_backup_hook
+	// VerifyOnCompletion prepares every backup in a temporary directory right after it
+	// is taken. Off by default because it reads the whole backup again.
+	VerifyOnCompletion bool `db:"verify_on_completion"`
+	// CredentialsSuffix selects the [client<suffix>] section of db-cmd's credentials
+	// file, nil uses db-cmd's configured section (-dbcalm by default)
+	CredentialsSuffix *string `db:"credentials_suffix"`
+	// WindowStart and WindowEnd limit an hourly or interval schedule to runs starting from
+	// WindowStart up to, not including, WindowEnd (hours 0-23). A window ending before its
+	// start wraps past midnight, e.g. 22-6. Nil runs all day.
+	WindowStart *int `db:"window_start"`
+	WindowEnd   *int `db:"window_end"`
+	// PresetGroup links the schedules a preset created together, nil for others
+	PresetGroup *string   `db:"preset_group"`
+	Enabled     bool      `db:"enabled"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
 func NewSchedule(backupType BackupType, frequency ScheduleFrequency, enabled bool) *Schedule {
@@ -49,8 +100,255 @@ func NewSchedule(backupType BackupType, frequency ScheduleFrequency, enabled boo
 	return &Schedule{
 		BackupType: backupType,
 		Frequency:  frequency,
+		Strategy:   BackupStrategyPhysical,
 		Enabled:    enabled,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 }
+
+// Weekdays returns the days a weekly schedule runs on
+func (s *Schedule) Weekdays() []int {
+	if len(s.DaysOfWeek) > 0 {
+		return s.DaysOfWeek
+	}
+	if s.DayOfWeek != nil {
+		return []int{*s.DayOfWeek}
+	}
+	return nil
+}
+
+// SetWeekdays sets the days a weekly schedule runs on, sorted and without duplicates.
+// A single day is kept in DayOfWeek alone, as schedules were stored before DaysOfWeek.
+func (s *Schedule) SetWeekdays(days []int) {
+	seen := make(map[int]bool, len(days))
+	var unique []int
+	for _, day := range days {
+		if !seen[day] {
+			seen[day] = true
+			unique = append(unique, day)
+		}
+	}
+	sort.Ints(unique)
+
+	s.DayOfWeek = nil
+	s.DaysOfWeek = nil
+	if len(unique) == 0 {
+		return
+	}
+	first := unique[0]
+	s.DayOfWeek = &first
+	if len(unique) > 1 {
+		s.DaysOfWeek = unique
+	}
+}
+
+// NextRunAfter returns the first time after t that cron starts the schedule, in t's
+// location. It reports false when the schedule lacks the fields its frequency needs.
+func (s *Schedule) NextRunAfter(t time.Time) (time.Time, bool) {
+	start := t.Truncate(time.Minute).Add(time.Minute)
+
+	switch s.Frequency {
+	case FrequencyHourly, FrequencyInterval:
+		// Both repeat within a day, so stepping minute by minute finds the next run quickly
+		for candidate := start; candidate.Before(start.Add(48 * time.Hour)); candidate = candidate.Add(time.Minute) {
+			if s.runsAt(candidate) {
+				return candidate, true
+			}
+		}
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+		if s.Hour == nil || s.Minute == nil {
+			return time.Time{}, false
+		}
+		// A monthly schedule on the 31st skips short months, a year covers every case
+		for day := 0; day <= 366; day++ {
+			date := start.AddDate(0, 0, day)
+			candidate := time.Date(date.Year(), date.Month(), date.Day(), *s.Hour, *s.Minute, 0, 0, t.Location())
+			if !candidate.Before(start) && s.runsAt(candidate) {
+				return candidate, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Duplicates reports whether the schedule takes the same backups as other at the same
+// times: the type, strategy, credentials and every field its frequency runs on match.
+// Retention, hooks and exclusions don't matter, either way both back up at once.
+func (s *Schedule) Duplicates(other *Schedule) bool {
+	if s.BackupType != other.BackupType || s.Strategy != other.Strategy || s.Frequency != other.Frequency ||
+		!sameInt(s.WindowStart, other.WindowStart) || !sameInt(s.WindowEnd, other.WindowEnd) ||
+		!sameString(s.CredentialsSuffix, other.CredentialsSuffix) {
+		return false
+	}
+
+	switch s.Frequency {
+	case FrequencyHourly:
+		return sameInt(s.Minute, other.Minute)
+	case FrequencyInterval:
+		return sameInt(s.IntervalValue, other.IntervalValue) &&
+			(s.IntervalUnit == nil) == (other.IntervalUnit == nil) &&
+			(s.IntervalUnit == nil || *s.IntervalUnit == *other.IntervalUnit)
+	case FrequencyDaily:
+		return sameInt(s.Hour, other.Hour) && sameInt(s.Minute, other.Minute)
+	case FrequencyWeekly:
+		days, otherDays := s.Weekdays(), other.Weekdays()
+		if len(days) != len(otherDays) {
+			return false
+		}
+		for i := range days {
+			if days[i] != otherDays[i] {
+				return false
+			}
+		}
+		return sameInt(s.Hour, other.Hour) && sameInt(s.Minute, other.Minute)
+	case FrequencyMonthly:
+		return sameInt(s.DayOfMonth, other.DayOfMonth) && sameInt(s.Hour, other.Hour) && sameInt(s.Minute, other.Minute)
+	}
+	return false
+}
+
+func sameInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func sameString(a, b *string) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// InWindow reports whether t's hour is inside the schedule's backup window, always true
+// for a schedule without one
+func (s *Schedule) InWindow(t time.Time) bool {
+	if s.WindowStart == nil || s.WindowEnd == nil {
+		return true
+	}
+	start, end, hour := *s.WindowStart, *s.WindowEnd, t.Hour()
+	if start < end {
+		return hour >= start && hour < end
+	}
+	// Wraps past midnight
+	return hour >= start || hour < end
+}
+
+// runsAt reports whether the schedule starts a backup at t's minute: its cron entry
+// matches and t is inside its window
+func (s *Schedule) runsAt(t time.Time) bool {
+	return s.cronMatches(t) && s.InWindow(t)
+}
+
+// cronMatches reports whether the schedule's cron entry matches t's minute
+func (s *Schedule) cronMatches(t time.Time) bool {
+	switch s.Frequency {
+	case FrequencyHourly:
+		return s.Minute != nil && t.Minute() == *s.Minute
+	case FrequencyInterval:
+		if s.IntervalValue == nil || *s.IntervalValue < 1 || s.IntervalUnit == nil {
+			return false
+		}
+		if *s.IntervalUnit == IntervalUnitHours {
+			return t.Minute() == 0 && t.Hour()%*s.IntervalValue == 0
+		}
+		return t.Minute()%*s.IntervalValue == 0
+	case FrequencyDaily:
+		return t.Hour() == *s.Hour && t.Minute() == *s.Minute
+	case FrequencyWeekly:
+		if t.Hour() != *s.Hour || t.Minute() != *s.Minute {
+			return false
+		}
+		for _, day := range s.Weekdays() {
+			if int(t.Weekday()) == day {
+				return true
+			}
+		}
+		return false
+	case FrequencyMonthly:
+		return s.DayOfMonth != nil && t.Day() == *s.DayOfMonth && t.Hour() == *s.Hour && t.Minute() == *s.Minute
+	}
+	return false
+}
+
+// ValidateWeekdays checks that every day is 0-6 (Sunday-Saturday)
+func ValidateWeekdays(days []int) error {
+	for _, day := range days {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid day_of_week %d, must be 0-6", day)
+		}
+	}
+	return nil
+}
+
+// ValidateWindow checks a backup window: both hours or neither are set, each is 0-23,
+// they differ, and only hourly and interval schedules, which run all day, have one
+func ValidateWindow(frequency ScheduleFrequency, start, end *int) error {
+	if start == nil && end == nil {
+		return nil
+	}
+	if start == nil || end == nil {
+		return fmt.Errorf("window_start and window_end must be set together")
+	}
+	if frequency != FrequencyHourly && frequency != FrequencyInterval {
+		return fmt.Errorf("a backup window is only supported for hourly and interval schedules")
+	}
+	if *start < 0 || *start > 23 || *end < 0 || *end > 23 {
+		return fmt.Errorf("window_start and window_end must be hours 0-23")
+	}
+	if *start == *end {
+		return fmt.Errorf("window_start and window_end must differ, leave both unset to run all day")
+	}
+	return nil
+}
+
+// hookPathPattern matches the hook paths db-cmd accepts, it also checks they are inside its hook_dir
+var hookPathPattern = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+
+// ValidateHookPath checks that a hook is an absolute path without shell metacharacters
+func ValidateHookPath(path string) error {
+	if !hookPathPattern.MatchString(path) || filepath.Clean(path) != path {
+		return fmt.Errorf("invalid hook path: %q", path)
+	}
+	return nil
+}
+
+// ValidateRetention checks a schedule's retention policy: either both the value and the unit
+// are set, the value is at least 1 and the unit is a known one, or neither is set
+func ValidateRetention(value *int, unit *RetentionUnit) error {
+	if value == nil && unit == nil {
+		return nil
+	}
+	if value == nil || unit == nil {
+		return fmt.Errorf("retention_value and retention_unit must be set together")
+	}
+	if *value < 1 {
+		return fmt.Errorf("retention_value must be at least 1, got %d", *value)
+	}
+	switch *unit {
+	case RetentionUnitHours, RetentionUnitDays, RetentionUnitWeeks, RetentionUnitMonths:
+		return nil
+	default:
+		return fmt.Errorf("invalid retention_unit %q, must be one of hours, days, weeks, months", *unit)
+	}
+}
+
+// credentialsSuffixPattern matches the option group suffixes db-cmd accepts
+var credentialsSuffixPattern = regexp.MustCompile(`^-[A-Za-z0-9_]{1,32}$`)
+
+// ValidateCredentialsSuffix checks a credentials section suffix such as "-replica"
+func ValidateCredentialsSuffix(suffix string) error {
+	if !credentialsSuffixPattern.MatchString(suffix) {
+		return fmt.Errorf("invalid credentials suffix: %q", suffix)
+	}
+	return nil
+}
+
+// databaseNamePattern matches the database names db-cmd accepts in exclude lists
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$-]{1,64}$`)
+
+// ValidateDatabaseNames checks that every name is a plain database identifier
+func ValidateDatabaseNames(names []string) error {
+	for _, name := range names {
+		if !databaseNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid database name: %q", name)
+		}
+	}
+	return nil
+}
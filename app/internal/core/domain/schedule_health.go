@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+type ScheduleHealthStatus string
+
+const (
+	ScheduleHealthFailed  ScheduleHealthStatus = "failed"  // The last run failed
+	ScheduleHealthOverdue ScheduleHealthStatus = "overdue" // A run is past due, cron isn't starting the schedule
+)
+
+// ScheduleHealth reports an enabled schedule that needs attention
+type ScheduleHealth struct {
+	Schedule  *Schedule
+	Status    ScheduleHealthStatus
+	Reason    string
+	LastRun   *Process   // nil when the schedule has not run yet
+	NextRunAt *time.Time // The run due after the last one
+}
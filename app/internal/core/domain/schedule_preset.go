@@ -0,0 +1,67 @@
+package domain
+
+import "fmt"
+
+// SchedulePreset names a set of schedules created together
+type SchedulePreset string
+
+const (
+	// PresetWeeklyFullDailyIncremental takes a full backup once a week and an incremental
+	// on every other day, keeping the last RetentionDays days of backups restorable
+	PresetWeeklyFullDailyIncremental SchedulePreset = "weekly_full_daily_incremental"
+)
+
+// PresetOptions configures the schedules a preset creates
+type PresetOptions struct {
+	DayOfWeek     int // Day of the full backup, 0-6 (Sunday-Saturday)
+	Hour          int // 0-23, all backups of the preset run at the same time
+	Minute        int // 0-59
+	RetentionDays int // Days of backups kept restorable
+	Enabled       bool
+}
+
+// BuildPreset returns the schedules of a preset, linked by group. The full backups are kept
+// a week longer than the incrementals, so every incremental kept still has its full backup.
+func BuildPreset(preset SchedulePreset, opts PresetOptions, group string) ([]*Schedule, error) {
+	if preset != PresetWeeklyFullDailyIncremental {
+		return nil, fmt.Errorf("unknown schedule preset %q, must be %s", preset, PresetWeeklyFullDailyIncremental)
+	}
+	if opts.DayOfWeek < 0 || opts.DayOfWeek > 6 {
+		return nil, fmt.Errorf("day_of_week must be 0-6, got %d", opts.DayOfWeek)
+	}
+	if opts.Hour < 0 || opts.Hour > 23 {
+		return nil, fmt.Errorf("hour must be 0-23, got %d", opts.Hour)
+	}
+	if opts.Minute < 0 || opts.Minute > 59 {
+		return nil, fmt.Errorf("minute must be 0-59, got %d", opts.Minute)
+	}
+	if opts.RetentionDays < 1 {
+		return nil, fmt.Errorf("retention_days must be at least 1, got %d", opts.RetentionDays)
+	}
+
+	full := NewSchedule(BackupTypeFull, FrequencyWeekly, opts.Enabled)
+	full.SetWeekdays([]int{opts.DayOfWeek})
+
+	incremental := NewSchedule(BackupTypeIncremental, FrequencyWeekly, opts.Enabled)
+	var otherDays []int
+	for day := 0; day <= 6; day++ {
+		if day != opts.DayOfWeek {
+			otherDays = append(otherDays, day)
+		}
+	}
+	incremental.SetWeekdays(otherDays)
+
+	fullRetention := opts.RetentionDays + 7
+	days := RetentionUnitDays
+	full.RetentionValue, full.RetentionUnit = &fullRetention, &days
+	incrementalRetention := opts.RetentionDays
+	incremental.RetentionValue, incremental.RetentionUnit = &incrementalRetention, &days
+
+	schedules := []*Schedule{full, incremental}
+	for _, schedule := range schedules {
+		hour, minute := opts.Hour, opts.Minute
+		schedule.Hour, schedule.Minute = &hour, &minute
+		schedule.PresetGroup = &group
+	}
+	return schedules, nil
+}
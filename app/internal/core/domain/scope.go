@@ -0,0 +1,21 @@
+package domain
+
+import "fmt"
+
+// Token scopes. ScopeAll grants everything; the other scopes each grant an operation a
+// token without ScopeAll is refused, other operations need no specific scope.
+const (
+	ScopeAll = "all"
+	// ScopeRestoreDatabase allows restoring over the live data dir, folder restores need no scope
+	ScopeRestoreDatabase = "restore:database"
+)
+
+// ValidateScopes checks that every scope is a known one
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if scope != ScopeAll && scope != ScopeRestoreDatabase {
+			return fmt.Errorf("invalid scope %q, must be %s or %s", scope, ScopeAll, ScopeRestoreDatabase)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// ServerInfo describes the MySQL/MariaDB server as detected by db-cmd
+type ServerInfo struct {
+	DbType          string
+	Version         string
+	DumpAvailable   bool   // mariadb-dump/mysqldump installed, needed for logical backups
+	ClientAvailable bool   // mariadb/mysql client installed, needed for logical restores
+	Source          string // primary or replica as configured for db-cmd, empty when not set
+	DetectedAt      time.Time
+}
+
+// ConnectionTest is the outcome of db-cmd connecting with a credentials section
+type ConnectionTest struct {
+	Connected         bool
+	CredentialsSuffix string
+	DbType            string
+	Version           string // Empty when the connection failed
+	Error             string // Why the connection failed
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/martijn/dbcalm/internal/core/domain"
 )
@@ -10,5 +11,6 @@ type AuthCodeRepository interface {
 	Create(ctx context.Context, authCode *domain.AuthCode) error
 	FindByCode(ctx context.Context, code string) (*domain.AuthCode, error)
 	Delete(ctx context.Context, code string) error
-	DeleteExpired(ctx context.Context) error
+	// DeleteExpired removes the codes that expired before now and returns how many
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
@@ -10,17 +11,25 @@ import (
 // BackupFilter embeds ListFilter for generic query/order/pagination
 type BackupFilter struct {
 	util.ListFilter
+	// LatestPerSchedule keeps only the newest completed backup of each schedule, and
+	// the newest completed ad-hoc backup
+	LatestPerSchedule bool
 }
 
 type BackupRepository interface {
 	Create(ctx context.Context, backup *domain.Backup) error
 	FindByID(ctx context.Context, id string) (*domain.Backup, error)
 	Update(ctx context.Context, backup *domain.Backup) error
+	// SetExpiresAt sets a backup's retention override, nil clears it
+	SetExpiresAt(ctx context.Context, id string, expiresAt *time.Time) error
 	Delete(ctx context.Context, id string) error
 	DeleteMany(ctx context.Context, ids []string) error
 	List(ctx context.Context, filter BackupFilter) ([]*domain.Backup, error)
 	Count(ctx context.Context, filter BackupFilter) (int, error)
 
+	// Find the backup that finished last, of any schedule or none, nil when none has
+	FindLatestCompleted(ctx context.Context) (*domain.Backup, error)
+
 	// Find the latest backup for a given schedule and type
 	FindLatestByScheduleAndType(ctx context.Context, scheduleID *int64, backupType domain.BackupType) (*domain.Backup, error)
 
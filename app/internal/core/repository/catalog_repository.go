@@ -0,0 +1,10 @@
+package repository
+
+import "context"
+
+type CatalogRepository interface {
+	// BackupTo writes a consistent snapshot of the catalog to path, which must not exist
+	BackupTo(ctx context.Context, path string) error
+	// RestoreFrom replaces the catalog's contents with the snapshot at path
+	RestoreFrom(ctx context.Context, path string) error
+}
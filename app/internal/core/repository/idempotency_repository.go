@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+)
+
+type IdempotencyRepository interface {
+	// Create stores a new key, returning false when the caller already used it
+	Create(ctx context.Context, key *domain.IdempotencyKey) (bool, error)
+	// Find returns nil when the caller never used the key
+	Find(ctx context.Context, owner, key string) (*domain.IdempotencyKey, error)
+	SaveResponse(ctx context.Context, key *domain.IdempotencyKey) error
+	Delete(ctx context.Context, owner, key string) error
+	DeleteCreatedBefore(ctx context.Context, before time.Time) error
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+)
+
+type MaintenanceRepository interface {
+	// Get returns the current state, disabled when it was never set
+	Get(ctx context.Context) (*domain.Maintenance, error)
+	Save(ctx context.Context, maintenance *domain.Maintenance) error
+}
@@ -10,6 +10,8 @@ import (
 // ProcessFilter embeds ListFilter for generic query/order/pagination
 type ProcessFilter struct {
 	util.ListFilter
+	// ActiveFirst sorts running processes before finished ones, each in the requested order
+	ActiveFirst bool
 }
 
 type ProcessRepository interface {
@@ -20,6 +22,9 @@ type ProcessRepository interface {
 	List(ctx context.Context, filter ProcessFilter) ([]*domain.Process, error)
 	Count(ctx context.Context, filter ProcessFilter) (int, error)
 
+	// Link a process to the failed process it retries
+	SetRetryOf(ctx context.Context, commandID, retryOf string) error
+
 	// Find all running processes (for queue management)
 	FindRunning(ctx context.Context) ([]*domain.Process, error)
 }
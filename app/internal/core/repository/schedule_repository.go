@@ -7,14 +7,17 @@ import (
 )
 
 type ScheduleFilter struct {
-	BackupType *domain.BackupType
-	Enabled    *bool
-	Limit      int
-	Offset     int
+	BackupType  *domain.BackupType
+	Enabled     *bool
+	PresetGroup *string
+	Limit       int
+	Offset      int
 }
 
 type ScheduleRepository interface {
 	Create(ctx context.Context, schedule *domain.Schedule) error
+	// CreateAll creates the schedules in one transaction, none are created when one fails
+	CreateAll(ctx context.Context, schedules []*domain.Schedule) error
 	FindByID(ctx context.Context, id int64) (*domain.Schedule, error)
 	Update(ctx context.Context, schedule *domain.Schedule) error
 	Delete(ctx context.Context, id int64) error
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// AuthCodeSweepService periodically deletes expired auth codes, which logins only clean
+// up when someone logs in
+type AuthCodeSweepService struct {
+	authCodeRepo repository.AuthCodeRepository
+	interval     time.Duration // Zero disables the sweep
+	stop         chan struct{}
+}
+
+func NewAuthCodeSweepService(authCodeRepo repository.AuthCodeRepository, interval time.Duration) *AuthCodeSweepService {
+	return &AuthCodeSweepService{
+		authCodeRepo: authCodeRepo,
+		interval:     interval,
+	}
+}
+
+// Start runs the periodic sweep until Stop is called
+func (s *AuthCodeSweepService) Start() {
+	if s.interval <= 0 || s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if _, err := s.Sweep(context.Background(), now); err != nil {
+					log.Printf("Warning: failed to sweep expired auth codes: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+}
+
+// Stop ends the periodic sweep
+func (s *AuthCodeSweepService) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Sweep deletes the auth codes expired by now and returns how many
+func (s *AuthCodeSweepService) Sweep(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := s.authCodeRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired auth code(s)", deleted)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestAuthCodeSweepRemovesExpiredCodes(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	if _, err := db.Exec(`INSERT INTO user (username, password, created_at, updated_at) VALUES ('admin', 'x', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatalf("failed to seed user: %v", err)
+	}
+
+	authCodeRepo := sqlite.NewAuthCodeRepository(db)
+	expired := domain.NewAuthCode("admin", []string{domain.ScopeAll}, time.Minute)
+	valid := domain.NewAuthCode("admin", []string{domain.ScopeAll}, time.Hour)
+	for _, code := range []*domain.AuthCode{expired, valid} {
+		if err := authCodeRepo.Create(ctx, code); err != nil {
+			t.Fatalf("failed to seed auth code: %v", err)
+		}
+	}
+
+	// Ten minutes on, without any login in between
+	sweep := NewAuthCodeSweepService(authCodeRepo, time.Hour)
+	deleted, err := sweep.Sweep(ctx, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 expired code deleted, got %d", deleted)
+	}
+	if _, err := authCodeRepo.FindByCode(ctx, expired.Code); err == nil {
+		t.Error("expected the expired code to be gone")
+	}
+	if _, err := authCodeRepo.FindByCode(ctx, valid.Code); err != nil {
+		t.Errorf("expected the valid code to be kept: %v", err)
+	}
+
+	if deleted, err := sweep.Sweep(ctx, time.Now().Add(10*time.Minute)); err != nil || deleted != 0 {
+		t.Errorf("expected nothing left to sweep, got %d, %v", deleted, err)
+	}
+}
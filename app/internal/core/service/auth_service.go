@@ -12,9 +12,8 @@ import (
 )
 
 const (
-	AuthCodeExpirationMinutes = 10
-	TokenExpirationHours      = 1
-	BcryptCost                = 10
+	TokenExpirationHours = 1
+	BcryptCost           = 10
 )
 
 type AuthService struct {
@@ -23,21 +22,43 @@ type AuthService struct {
 	authCodeRepo repository.AuthCodeRepository
 	jwtSecret    string
 	jwtAlgorithm string
+	jwtIssuer    string // iss claim issued and required
+	jwtAudience  string // aud claim issued and required
+	jwtLeeway    time.Duration
+	// authCodeExpiration is how long an auth code can be exchanged for a token
+	authCodeExpiration time.Duration
+}
+
+// TokenOptions are the settings tokens and auth codes are issued and checked with
+type TokenOptions struct {
+	JWTSecret    string
+	JWTAlgorithm string
+	// JWTIssuer and JWTAudience are the iss and aud claims issued and required
+	JWTIssuer   string
+	JWTAudience string
+	// JWTLeeway is the clock skew tolerated when checking a token's times
+	JWTLeeway time.Duration
+	// AuthCodeExpiration is how long an auth code can be exchanged for a token
+	AuthCodeExpiration time.Duration
 }
 
 func NewAuthService(
 	userRepo repository.UserRepository,
 	clientRepo repository.ClientRepository,
 	authCodeRepo repository.AuthCodeRepository,
-	jwtSecret string,
-	jwtAlgorithm string,
+	opts TokenOptions,
 ) *AuthService {
 	return &AuthService{
 		userRepo:     userRepo,
 		clientRepo:   clientRepo,
 		authCodeRepo: authCodeRepo,
-		jwtSecret:    jwtSecret,
-		jwtAlgorithm: jwtAlgorithm,
+		jwtSecret:    opts.JWTSecret,
+		jwtAlgorithm: opts.JWTAlgorithm,
+		jwtIssuer:    opts.JWTIssuer,
+		jwtAudience:  opts.JWTAudience,
+		jwtLeeway:    opts.JWTLeeway,
+
+		authCodeExpiration: opts.AuthCodeExpiration,
 	}
 }
 
@@ -70,14 +91,14 @@ func (s *AuthService) AuthorizeUser(ctx context.Context, username, password stri
 	}
 
 	// Create auth code
-	authCode := domain.NewAuthCode(username, []string{"all"}, AuthCodeExpirationMinutes)
+	authCode := domain.NewAuthCode(username, []string{domain.ScopeAll}, s.authCodeExpiration)
 
 	if err := s.authCodeRepo.Create(ctx, authCode); err != nil {
 		return nil, fmt.Errorf("failed to create auth code: %w", err)
 	}
 
-	// Clean up expired codes
-	_ = s.authCodeRepo.DeleteExpired(ctx)
+	// Clean up expired codes, the periodic sweep catches them without logins
+	_, _ = s.authCodeRepo.DeleteExpired(ctx, time.Now())
 
 	return authCode, nil
 }
@@ -130,7 +151,9 @@ func (s *AuthService) AuthenticateClient(ctx context.Context, clientID, clientSe
 	return token, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// ValidateToken validates a JWT token and returns the claims. The token has to carry the
+// configured issuer and audience, so tokens another service signed with a shared secret
+// are refused. nbf and exp are checked with the leeway, to tolerate clock skew.
 func (s *AuthService) ValidateToken(tokenString string) (*TokenClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
@@ -138,7 +161,7 @@ func (s *AuthService) ValidateToken(tokenString string) (*TokenClaims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(s.jwtSecret), nil
-	})
+	}, jwt.WithIssuer(s.jwtIssuer), jwt.WithAudience(s.jwtAudience), jwt.WithLeeway(s.jwtLeeway))
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -164,7 +187,8 @@ func (s *AuthService) generateJWT(subject, subjectType string, scopes []string)
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    "dbcalm",
+			Issuer:    s.jwtIssuer,
+			Audience:  jwt.ClaimStrings{s.jwtAudience},
 		},
 	}
 
@@ -196,3 +220,13 @@ type TokenClaims struct {
 	Scopes      []string `json:"scopes"`
 	jwt.RegisteredClaims
 }
+
+// HasScope reports whether the token grants the scope, directly or through the all scope
+func (c *TokenClaims) HasScope(scope string) bool {
+	for _, granted := range c.Scopes {
+		if granted == domain.ScopeAll || granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateTokenIssuerAndAudience(t *testing.T) {
+	newAuthService := func(issuer, audience string) *AuthService {
+		return NewAuthService(nil, nil, nil, TokenOptions{
+			JWTSecret: "shared-secret", JWTAlgorithm: "HS256", JWTIssuer: issuer, JWTAudience: audience, JWTLeeway: 30 * time.Second,
+		})
+	}
+	authService := newAuthService("dbcalm", "dbcalm-api")
+
+	tests := []struct {
+		name        string
+		signer      *AuthService
+		expectError string // empty when the token is accepted
+	}{
+		{name: "own token", signer: authService},
+		{name: "wrong issuer", signer: newAuthService("other-service", "dbcalm-api"), expectError: "issuer"},
+		{name: "wrong audience", signer: newAuthService("dbcalm", "other-api"), expectError: "audience"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.signer.generateJWT("client-1", "client", []string{"*"})
+			if err != nil {
+				t.Fatalf("generateJWT failed: %v", err)
+			}
+
+			claims, err := authService.ValidateToken(token)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("expected the token to be accepted, got %v", err)
+				}
+				if claims.Subject != "client-1" || claims.Issuer != "dbcalm" {
+					t.Errorf("unexpected claims: %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("expected the token to be rejected for its %s, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestValidateTokenLeeway(t *testing.T) {
+	opts := TokenOptions{JWTSecret: "shared-secret", JWTAlgorithm: "HS256", JWTIssuer: "dbcalm", JWTAudience: "dbcalm-api", JWTLeeway: 30 * time.Second}
+	authService := NewAuthService(nil, nil, nil, opts)
+
+	// A token from an issuer whose clock runs ahead
+	sign := func(notBefore time.Time) string {
+		claims := TokenClaims{
+			Subject:     "client-1",
+			SubjectType: "client",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(notBefore.Add(time.Hour)),
+				IssuedAt:  jwt.NewNumericDate(notBefore),
+				NotBefore: jwt.NewNumericDate(notBefore),
+				Issuer:    "dbcalm",
+				Audience:  jwt.ClaimStrings{"dbcalm-api"},
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("shared-secret"))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	if _, err := authService.ValidateToken(sign(time.Now().Add(10 * time.Second))); err != nil {
+		t.Errorf("expected a token valid in 10s to be accepted within the leeway, got %v", err)
+	}
+	if _, err := authService.ValidateToken(sign(time.Now().Add(2 * time.Minute))); err == nil {
+		t.Error("expected a token valid in 2m to be rejected")
+	}
+
+	// Without leeway the skew is refused
+	opts.JWTLeeway = 0
+	strict := NewAuthService(nil, nil, nil, opts)
+	if _, err := strict.ValidateToken(sign(time.Now().Add(10 * time.Second))); err == nil {
+		t.Error("expected a token valid in 10s to be rejected without leeway")
+	}
+}
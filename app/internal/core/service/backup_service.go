@@ -3,46 +3,111 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
 
 type BackupService struct {
-	backupRepo repository.BackupRepository
-	processServ *ProcessService
-	dbClient   *dbcmd.Client
+	backupRepo        repository.BackupRepository
+	scheduleRepo      repository.ScheduleRepository
+	processServ       *ProcessService
+	dbClient          *dbcmd.Client
+	maxIncrementalAge time.Duration
+	cooldown          time.Duration // Zero disables it
 }
 
 func NewBackupService(
 	backupRepo repository.BackupRepository,
+	scheduleRepo repository.ScheduleRepository,
 	processServ *ProcessService,
 	dbClient *dbcmd.Client,
+	maxIncrementalAge time.Duration,
 ) *BackupService {
 	return &BackupService{
-		backupRepo:  backupRepo,
-		processServ: processServ,
-		dbClient:    dbClient,
+		backupRepo:        backupRepo,
+		scheduleRepo:      scheduleRepo,
+		processServ:       processServ,
+		dbClient:          dbClient,
+		maxIncrementalAge: maxIncrementalAge,
 	}
 }
 
-// CreateFullBackup creates a full backup via the socket service
-func (s *BackupService) CreateFullBackup(ctx context.Context, backupID *string, scheduleID *int64) (*domain.Process, error) {
+// WithCooldown sets the minimum time between the end of the latest backup and the next
+// scheduled run, see SkipForCooldown
+func (s *BackupService) WithCooldown(cooldown time.Duration) *BackupService {
+	s.cooldown = cooldown
+	return s
+}
+
+// SkipForCooldown is called by the scheduled backup entry points. When the latest
+// successful backup, of any schedule or none, finished less than the cooldown ago it
+// records a skipped process for the run and returns it, otherwise it returns nil. Backups
+// still running are left to the overlap checks.
+func (s *BackupService) SkipForCooldown(ctx context.Context, scheduleID int64, now time.Time) (*domain.Process, error) {
+	if s.cooldown <= 0 {
+		return nil, nil
+	}
+
+	latest, err := s.backupRepo.FindLatestCompleted(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the latest backup: %w", err)
+	}
+	if latest == nil || !now.Before(latest.EndTime.Add(s.cooldown)) {
+		return nil, nil
+	}
+
+	return s.processServ.RecordSkipped(ctx, "skipped: backup cooldown", domain.ProcessTypeBackup, map[string]interface{}{
+		"schedule_id":    scheduleID,
+		"skip_reason":    "cooldown",
+		"last_backup_id": latest.ID,
+		"cooldown_until": latest.EndTime.Add(s.cooldown).UTC().Format(time.RFC3339),
+	})
+}
+
+// CreateFullBackup creates a full backup via the socket service.
+// An empty strategy takes a physical backup, description is an optional note stored with it.
+func (s *BackupService) CreateFullBackup(ctx context.Context, backupID *string, scheduleID *int64, strategy domain.BackupStrategy, description *string) (*domain.Process, error) {
+	backupID, err := normalizeBackupID(backupID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate backup ID if not provided
 	if backupID == nil {
 		id := time.Now().Format("20060102-150405")
 		backupID = &id
 	}
 
+	if strategy == "" {
+		strategy = domain.BackupStrategyPhysical
+	}
+	if strategy != domain.BackupStrategyPhysical && strategy != domain.BackupStrategyLogical {
+		return nil, NewServiceError(400, fmt.Sprintf("invalid backup strategy: %s", strategy))
+	}
+
+	serverInfo, err := requireServerInfo(ctx, s.dbClient)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == domain.BackupStrategyLogical && !serverInfo.DumpAvailable {
+		return nil, NewServiceError(503, "cannot create logical backup, mariadb-dump/mysqldump is not installed")
+	}
+
 	// Build args for socket service
 	args := map[string]interface{}{
-		"id": *backupID,
+		"id":       *backupID,
+		"strategy": string(strategy),
 	}
 	if scheduleID != nil {
 		args["schedule_id"] = *scheduleID
 	}
+	s.addScheduleSettings(ctx, scheduleID, args)
+	addDescription(args, description)
 
 	// Call socket service - it will create the process, build command, and execute
 	response, err := s.dbClient.SendCommand(ctx, "full_backup", args)
@@ -69,17 +134,69 @@ func (s *BackupService) CreateFullBackup(ctx context.Context, backupID *string,
 }
 
 // CreateIncrementalBackup creates an incremental backup via the socket service
-func (s *BackupService) CreateIncrementalBackup(ctx context.Context, backupID *string, fromBackupID *string, scheduleID *int64) (*domain.Process, error) {
+func (s *BackupService) CreateIncrementalBackup(ctx context.Context, backupID *string, fromBackupID *string, scheduleID *int64, description *string) (*domain.Process, error) {
+	backupID, err := normalizeBackupID(backupID)
+	if err != nil {
+		return nil, err
+	}
+	fromBackupID, err = normalizeBackupID(fromBackupID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A preset's incrementals build on the full backups of its full schedule
+	chainSchedules, err := s.chainSchedules(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Find base backup if not specified
 	if fromBackupID == nil {
-		latestBackup, err := s.backupRepo.FindLatestByScheduleAndType(ctx, scheduleID, domain.BackupTypeFull)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find base backup: %w", err)
+		var latestBackup *domain.Backup
+		for _, id := range chainSchedules {
+			full, err := s.backupRepo.FindLatestByScheduleAndType(ctx, id, domain.BackupTypeFull)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find base backup: %w", err)
+			}
+			if full != nil && (latestBackup == nil || full.StartTime.After(latestBackup.StartTime)) {
+				latestBackup = full
+			}
 		}
 		if latestBackup == nil {
 			return nil, fmt.Errorf("no full backup found to use as base")
 		}
 		fromBackupID = &latestBackup.ID
+
+		// Promote to a full backup when the chain's root is older than the maximum incremental age
+		rootStartTime, expired, err := s.chainRootExpired(ctx, *fromBackupID)
+		if err != nil {
+			return nil, err
+		}
+		if expired {
+			process, err := s.CreateFullBackup(ctx, backupID, scheduleID, domain.BackupStrategyPhysical, description)
+			if err != nil {
+				return nil, err
+			}
+			if process.Args == nil {
+				process.Args = make(map[string]interface{})
+			}
+			process.Args["promoted_to_full"] = true
+			process.Args["promotion_reason"] = fmt.Sprintf("chain root %s started at %s, older than max incremental age %s",
+				*fromBackupID, rootStartTime.Format(time.RFC3339), s.maxIncrementalAge)
+			return process, nil
+		}
+	} else {
+		// Logical dumps carry no LSN, so they cannot serve as an incremental base
+		base, err := s.backupRepo.FindByID(ctx, *fromBackupID)
+		if err == nil && base.Strategy == domain.BackupStrategyLogical {
+			return nil, NewServiceError(400, fmt.Sprintf("backup %s is a logical dump and cannot be used as an incremental base", *fromBackupID))
+		}
+		// Retention expires a chain with its schedule, so a chain can't span schedules
+		// other than those of one preset
+		if err == nil && !inSchedules(base.ScheduleID, chainSchedules) {
+			return nil, NewServiceError(400, fmt.Sprintf("backup %s belongs to %s and cannot be the base of an incremental for %s",
+				*fromBackupID, describeSchedule(base.ScheduleID), describeSchedule(scheduleID)))
+		}
 	}
 
 	// Generate backup ID if not provided
@@ -88,6 +205,10 @@ func (s *BackupService) CreateIncrementalBackup(ctx context.Context, backupID *s
 		backupID = &id
 	}
 
+	if _, err := requireServerInfo(ctx, s.dbClient); err != nil {
+		return nil, err
+	}
+
 	// Build args for socket service
 	args := map[string]interface{}{
 		"id":             *backupID,
@@ -96,6 +217,8 @@ func (s *BackupService) CreateIncrementalBackup(ctx context.Context, backupID *s
 	if scheduleID != nil {
 		args["schedule_id"] = *scheduleID
 	}
+	s.addScheduleSettings(ctx, scheduleID, args)
+	addDescription(args, description)
 
 	// Call socket service - it will create the process, build command, and execute
 	response, err := s.dbClient.SendCommand(ctx, "incremental_backup", args)
@@ -120,11 +243,297 @@ func (s *BackupService) CreateIncrementalBackup(ctx context.Context, backupID *s
 	}, nil
 }
 
+// addDescription passes the note on a backup to the socket service, a blank one is left out
+func addDescription(args map[string]interface{}, description *string) {
+	if description == nil {
+		return
+	}
+	if note := strings.TrimSpace(*description); note != "" {
+		args["description"] = note
+	}
+}
+
+// normalizeBackupID normalizes a caller-supplied backup ID, nil is left for the default.
+// IDs end up in paths under backup_dir, so one that could escape it is refused.
+func normalizeBackupID(id *string) (*string, error) {
+	if id == nil {
+		return nil, nil
+	}
+	normalized, err := domain.NormalizeBackupID(*id)
+	if err != nil {
+		return nil, NewServiceError(400, err.Error())
+	}
+	return &normalized, nil
+}
+
+// addScheduleSettings adds the schedule's database exclusions, backup hooks,
+// verify-on-completion flag and credentials section to the db-cmd args. db-cmd adds the globally configured
+// exclusions on top and falls back to the global hooks for any hook the schedule
+// leaves unset.
+func (s *BackupService) addScheduleSettings(ctx context.Context, scheduleID *int64, args map[string]interface{}) {
+	if scheduleID == nil || s.scheduleRepo == nil {
+		return
+	}
+	schedule, err := s.scheduleRepo.FindByID(ctx, *scheduleID)
+	if err != nil {
+		return
+	}
+
+	if len(schedule.ExcludeDatabases) > 0 {
+		args["exclude_databases"] = schedule.ExcludeDatabases
+	}
+	if schedule.PreBackupHook != nil {
+		args["pre_backup_hook"] = *schedule.PreBackupHook
+	}
+	if schedule.PostBackupHook != nil {
+		args["post_backup_hook"] = *schedule.PostBackupHook
+	}
+	if schedule.VerifyOnCompletion {
+		args["verify"] = true
+	}
+	if schedule.CredentialsSuffix != nil {
+		args["credentials_suffix"] = *schedule.CredentialsSuffix
+	}
+}
+
+// chainRootExpired reports whether the root full backup of the chain containing baseID
+// is older than the configured maximum incremental age
+func (s *BackupService) chainRootExpired(ctx context.Context, baseID string) (time.Time, bool, error) {
+	if s.maxIncrementalAge <= 0 {
+		return time.Time{}, false, nil
+	}
+
+	chain, err := s.backupRepo.FindChain(ctx, baseID)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get backup chain: %w", err)
+	}
+	if len(chain) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	root := chain[0]
+	return root.StartTime, time.Since(root.StartTime) > s.maxIncrementalAge, nil
+}
+
+// ConsolidateBackup prepares the chain ending in the incremental backupID into a new
+// standalone full backup. With retire the chain is removed once the new backup is in
+// place, which is refused while other backups still build on the chain.
+func (s *BackupService) ConsolidateBackup(ctx context.Context, backupID string, newID *string, retire bool) (*domain.Process, error) {
+	newID, err := normalizeBackupID(newID)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := s.backupRepo.FindByID(ctx, backupID)
+	if err != nil {
+		return nil, NewServiceError(404, fmt.Sprintf("backup not found: %s", backupID))
+	}
+	if backup.Type != domain.BackupTypeIncremental {
+		return nil, NewServiceError(400, fmt.Sprintf("backup %s is already a full backup", backupID))
+	}
+
+	chain, err := s.backupRepo.FindChain(ctx, backupID)
+	if err != nil {
+		return nil, NewServiceError(409, fmt.Sprintf("backup chain of %s is incomplete: %v", backupID, err))
+	}
+	if err := validateChain(chain, backupID); err != nil {
+		return nil, NewServiceError(409, err.Error())
+	}
+
+	idList := make([]string, len(chain))
+	for i, link := range chain {
+		idList[i] = link.ID
+	}
+
+	if retire {
+		if err := s.checkRetirable(ctx, idList); err != nil {
+			return nil, err
+		}
+	}
+
+	if newID == nil {
+		id := time.Now().Format("20060102-150405")
+		newID = &id
+	}
+
+	if _, err := requireServerInfo(ctx, s.dbClient); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{
+		"id":      *newID,
+		"id_list": idList,
+	}
+	if chain[0].ScheduleID != nil {
+		args["schedule_id"] = *chain[0].ScheduleID
+	}
+	if retire {
+		args["retire"] = true
+	}
+
+	response, err := s.dbClient.SendCommand(ctx, "consolidate_backup", args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initiate consolidation: %w", err)
+	}
+	if response.Code != 202 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return nil, NewServiceError(response.Code, errMsg)
+	}
+
+	return &domain.Process{
+		CommandID: response.ID,
+		Status:    domain.ProcessStatusRunning,
+		Args: map[string]interface{}{
+			"id":      *newID,
+			"id_list": idList,
+		},
+	}, nil
+}
+
+// sameSchedule reports whether two backups belong to the same schedule, or both to none
+func sameSchedule(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// inSchedules reports whether scheduleID is one of ids
+func inSchedules(scheduleID *int64, ids []*int64) bool {
+	for _, id := range ids {
+		if sameSchedule(scheduleID, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// chainSchedules returns the schedules whose backups an incremental of scheduleID can
+// build on: the schedule itself and the other schedules of its preset, if any
+func (s *BackupService) chainSchedules(ctx context.Context, scheduleID *int64) ([]*int64, error) {
+	ids := []*int64{scheduleID}
+	if scheduleID == nil || s.scheduleRepo == nil {
+		return ids, nil
+	}
+	group, err := presetSchedules(ctx, s.scheduleRepo, *scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range group {
+		if schedule.ID != *scheduleID {
+			id := schedule.ID
+			ids = append(ids, &id)
+		}
+	}
+	return ids, nil
+}
+
+// presetSchedules returns the schedules created by the same preset as scheduleID, itself
+// included, or nil when it wasn't created by a preset
+func presetSchedules(ctx context.Context, scheduleRepo repository.ScheduleRepository, scheduleID int64) ([]*domain.Schedule, error) {
+	schedule, err := scheduleRepo.FindByID(ctx, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule %d: %w", scheduleID, err)
+	}
+	if schedule.PresetGroup == nil {
+		return nil, nil
+	}
+	schedules, err := scheduleRepo.List(ctx, repository.ScheduleFilter{PresetGroup: schedule.PresetGroup})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the schedules of preset group %s: %w", *schedule.PresetGroup, err)
+	}
+	return schedules, nil
+}
+
+// describeSchedule names a backup's schedule in error messages
+func describeSchedule(scheduleID *int64) string {
+	if scheduleID == nil {
+		return "no schedule"
+	}
+	return fmt.Sprintf("schedule %d", *scheduleID)
+}
+
+// validateChain checks the chain runs from a physical full backup through unbroken
+// links to backupID
+func validateChain(chain []*domain.Backup, backupID string) error {
+	if err := validateChainLinks(chain, backupID); err != nil {
+		return err
+	}
+	if chain[0].Strategy == domain.BackupStrategyLogical {
+		return fmt.Errorf("backup chain of %s starts with a logical dump", backupID)
+	}
+	return nil
+}
+
+// validateChainLinks checks the chain runs from a full backup to backupID with every
+// backup based on the one before it, the order its incrementals have to be applied in
+func validateChainLinks(chain []*domain.Backup, backupID string) error {
+	if len(chain) == 0 || chain[len(chain)-1].ID != backupID {
+		return fmt.Errorf("backup chain of %s is incomplete", backupID)
+	}
+
+	root := chain[0]
+	if root.Type != domain.BackupTypeFull || root.FromBackupID != nil {
+		return fmt.Errorf("backup chain of %s does not start with a full backup", backupID)
+	}
+
+	for i := 1; i < len(chain); i++ {
+		if chain[i].Type != domain.BackupTypeIncremental || chain[i].FromBackupID == nil || *chain[i].FromBackupID != chain[i-1].ID {
+			return fmt.Errorf("backup chain of %s is broken at %s", backupID, chain[i].ID)
+		}
+	}
+	return nil
+}
+
+// checkRetirable refuses to retire a chain other backups still build on
+func (s *BackupService) checkRetirable(ctx context.Context, idList []string) error {
+	inChain := make(map[string]bool, len(idList))
+	for _, id := range idList {
+		inChain[id] = true
+	}
+
+	for _, id := range idList {
+		dependents, err := s.backupRepo.List(ctx, repository.BackupFilter{
+			ListFilter: util.ListFilter{
+				Filters: []util.QueryFilter{{Field: "from_backup_id", Operator: util.OpEq, Value: id}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find backups based on %s: %w", id, err)
+		}
+		for _, dependent := range dependents {
+			if !inChain[dependent.ID] {
+				return NewServiceError(409, fmt.Sprintf("cannot retire the chain, backup %s is based on %s", dependent.ID, id))
+			}
+		}
+	}
+	return nil
+}
+
 // GetBackup retrieves a backup by ID
 func (s *BackupService) GetBackup(ctx context.Context, id string) (*domain.Backup, error) {
 	return s.backupRepo.FindByID(ctx, id)
 }
 
+// SetBackupExpiry sets the retention override of a backup, cleanup keeps it and its chain
+// until expiresAt. Nil clears the override.
+func (s *BackupService) SetBackupExpiry(ctx context.Context, id string, expiresAt *time.Time, now time.Time) (*domain.Backup, error) {
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, NewServiceError(400, "expires_at must be in the future, send null to clear the override")
+	}
+	if _, err := s.backupRepo.FindByID(ctx, id); err != nil {
+		return nil, NewServiceError(404, fmt.Sprintf("backup not found: %s", id))
+	}
+
+	if err := s.backupRepo.SetExpiresAt(ctx, id, expiresAt); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.FindByID(ctx, id)
+}
+
 // ListBackups lists backups with filtering
 func (s *BackupService) ListBackups(ctx context.Context, filter repository.BackupFilter) ([]*domain.Backup, error) {
 	return s.backupRepo.List(ctx, filter)
@@ -135,6 +544,37 @@ func (s *BackupService) CountBackups(ctx context.Context, filter repository.Back
 	return s.backupRepo.Count(ctx, filter)
 }
 
+// EstimateBackup estimates how long the next backup of a type and strategy takes, from the
+// recent completed ones in the catalog
+func (s *BackupService) EstimateBackup(ctx context.Context, backupType domain.BackupType, strategy domain.BackupStrategy, now time.Time) (*domain.BackupEstimate, error) {
+	if backupType != domain.BackupTypeFull && backupType != domain.BackupTypeIncremental {
+		return nil, NewServiceError(400, fmt.Sprintf("invalid backup type: %s", backupType))
+	}
+	if strategy == "" {
+		strategy = domain.BackupStrategyPhysical
+	}
+	if strategy != domain.BackupStrategyPhysical && strategy != domain.BackupStrategyLogical {
+		return nil, NewServiceError(400, fmt.Sprintf("invalid backup strategy: %s", strategy))
+	}
+
+	completed, err := s.backupRepo.List(ctx, repository.BackupFilter{
+		ListFilter: util.ListFilter{
+			Filters: []util.QueryFilter{
+				{Field: "type", Operator: util.OpEq, Value: string(backupType)},
+				{Field: "strategy", Operator: util.OpEq, Value: string(strategy)},
+				{Field: "end_time", Operator: util.OpIsNotNull},
+			},
+			Order:   []util.OrderClause{{Field: "end_time", Direction: util.OrderDesc}},
+			PerPage: domain.EstimateSamples,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	return domain.NewBackupEstimate(backupType, strategy, completed, now), nil
+}
+
 // GetBackupChain retrieves the full chain for a backup (for incrementals)
 func (s *BackupService) GetBackupChain(ctx context.Context, backupID string) ([]*domain.Backup, error) {
 	return s.backupRepo.FindChain(ctx, backupID)
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCreateIncrementalBackupMaxIncrementalAge(t *testing.T) {
+	tests := []struct {
+		name             string
+		rootAge          time.Duration
+		maxAge           time.Duration
+		expectedCommands []string
+		expectPromoted   bool
+	}{
+		{
+			name:             "old root promotes to full",
+			rootAge:          10 * 24 * time.Hour,
+			maxAge:           7 * 24 * time.Hour,
+			expectedCommands: []string{"server_info", "full_backup"},
+			expectPromoted:   true,
+		},
+		{
+			name:             "recent root stays incremental",
+			rootAge:          2 * 24 * time.Hour,
+			maxAge:           7 * 24 * time.Hour,
+			expectedCommands: []string{"server_info", "incremental_backup"},
+		},
+		{
+			name:             "disabled when max age is zero",
+			rootAge:          365 * 24 * time.Hour,
+			maxAge:           0,
+			expectedCommands: []string{"server_info", "incremental_backup"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			scheduleID := seedSchedule(t, db, "incremental")
+			seedBackup(t, db, "root-full", nil, &scheduleID, time.Now().Add(-tt.rootAge))
+
+			socket := newFakeSocket(t, nil)
+			backupService := NewBackupService(
+				sqlite.NewBackupRepository(db),
+				sqlite.NewScheduleRepository(db),
+				nil,
+				dbcmd.NewClient(socket.path, time.Second),
+				tt.maxAge,
+			)
+
+			process, err := backupService.CreateIncrementalBackup(context.Background(), ptr("next"), nil, &scheduleID, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := socket.commands(); !reflect.DeepEqual(got, tt.expectedCommands) {
+				t.Errorf("expected commands %v, got %v", tt.expectedCommands, got)
+			}
+
+			promoted, _ := process.Args["promoted_to_full"].(bool)
+			if promoted != tt.expectPromoted {
+				t.Errorf("expected promoted_to_full %v, got %v", tt.expectPromoted, promoted)
+			}
+		})
+	}
+}
+
+func TestCreateIncrementalBackupSkipsLogicalBase(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+	seedBackup(t, db, "physical-full", nil, &scheduleID, time.Now().Add(-2*time.Hour))
+	seedBackup(t, db, "logical-full", nil, &scheduleID, time.Now().Add(-time.Hour))
+	if _, err := db.Exec(`UPDATE backup SET strategy = 'logical' WHERE id = 'logical-full'`); err != nil {
+		t.Fatalf("failed to mark backup as logical: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	// Auto-selected base skips the newer logical dump
+	if _, err := backupService.CreateIncrementalBackup(context.Background(), ptr("auto"), nil, &scheduleID, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := socket.request(t, "incremental_backup").Args["from_backup_id"]
+	if base != "physical-full" {
+		t.Errorf("expected base physical-full, got %v", base)
+	}
+
+	// An explicit logical base is rejected before reaching db-cmd
+	_, err := backupService.CreateIncrementalBackup(context.Background(), ptr("explicit"), ptr("logical-full"), &scheduleID, nil)
+	if err == nil {
+		t.Fatalf("expected error for logical base")
+	}
+	if got := socket.commands(); len(got) != 2 {
+		t.Errorf("expected 2 commands sent, got %v", got)
+	}
+}
+
+func TestCreateFullBackupSendsScheduleExclusions(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+	if _, err := db.Exec(`UPDATE schedule SET exclude_databases = '["analytics","scratch"]' WHERE id = ?`, scheduleID); err != nil {
+		t.Fatalf("failed to set schedule exclusions: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	if _, err := backupService.CreateFullBackup(context.Background(), ptr("full"), &scheduleID, "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exclude := socket.request(t, "full_backup").Args["exclude_databases"]
+	expected := []interface{}{"analytics", "scratch"}
+	if !reflect.DeepEqual(exclude, expected) {
+		t.Errorf("expected exclude_databases %v, got %v", expected, exclude)
+	}
+}
+
+func TestCreateFullBackupSendsScheduleHooks(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+	if _, err := db.Exec(`UPDATE schedule SET pre_backup_hook = '/etc/dbcalm/hooks/pre.sh' WHERE id = ?`, scheduleID); err != nil {
+		t.Fatalf("failed to set schedule hook: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	if _, err := backupService.CreateFullBackup(context.Background(), ptr("full"), &scheduleID, "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	args := socket.request(t, "full_backup").Args
+	if args["pre_backup_hook"] != "/etc/dbcalm/hooks/pre.sh" {
+		t.Errorf("expected pre_backup_hook /etc/dbcalm/hooks/pre.sh, got %v", args["pre_backup_hook"])
+	}
+	if _, ok := args["post_backup_hook"]; ok {
+		t.Errorf("expected no post_backup_hook so db-cmd falls back to its global hook, got %v", args["post_backup_hook"])
+	}
+}
+
+func TestCreateIncrementalBackupSendsScheduleCredentialsSuffix(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "incremental")
+	seedBackup(t, db, "base", nil, &scheduleID, time.Now().Add(-time.Hour))
+	if _, err := db.Exec(`UPDATE schedule SET credentials_suffix = '-replica' WHERE id = ?`, scheduleID); err != nil {
+		t.Fatalf("failed to set credentials suffix: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	if _, err := backupService.CreateIncrementalBackup(context.Background(), ptr("next"), nil, &scheduleID, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := socket.request(t, "incremental_backup").Args["credentials_suffix"]; got != "-replica" {
+		t.Errorf("expected credentials_suffix -replica, got %v", got)
+	}
+}
+
+func TestCreateBackupRequiresServerInfo(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+
+	socket := newFakeSocket(t, func(req socketRequest) socketResponse {
+		if req.Cmd == "server_info" {
+			return socketResponse{Code: 503, Status: "Service Unavailable", Message: "cannot determine MySQL/MariaDB server version"}
+		}
+		return acceptAll(req)
+	})
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	_, err := backupService.CreateFullBackup(context.Background(), ptr("full"), &scheduleID, "", nil)
+	svcErr, ok := err.(*ServiceError)
+	if !ok || svcErr.Code != 503 {
+		t.Fatalf("expected 503 service error, got %v", err)
+	}
+
+	if got := socket.commands(); !reflect.DeepEqual(got, []string{"server_info"}) {
+		t.Errorf("expected only server_info to be sent, got %v", got)
+	}
+}
+
+func TestConsolidateBackup(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		retire       bool
+		expectedCode int
+		expectedList []interface{}
+	}{
+		{name: "chain is consolidated", target: "incr-2", expectedList: []interface{}{"full", "incr-1", "incr-2"}},
+		{name: "chain in the middle is kept", target: "incr-1", expectedList: []interface{}{"full", "incr-1"}},
+		{name: "retiring a chain others build on", target: "incr-1", retire: true, expectedCode: 409},
+		{name: "retiring the whole chain", target: "incr-2", retire: true, expectedList: []interface{}{"full", "incr-1", "incr-2"}},
+		{name: "full backup", target: "full", expectedCode: 400},
+		{name: "unknown backup", target: "missing", expectedCode: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			start := time.Now().Add(-72 * time.Hour)
+			seedBackup(t, db, "full", nil, nil, start)
+			seedBackup(t, db, "incr-1", ptr("full"), nil, start.Add(24*time.Hour))
+			seedBackup(t, db, "incr-2", ptr("incr-1"), nil, start.Add(48*time.Hour))
+
+			socket := newFakeSocket(t, nil)
+			backupService := NewBackupService(
+				sqlite.NewBackupRepository(db),
+				sqlite.NewScheduleRepository(db),
+				nil,
+				dbcmd.NewClient(socket.path, time.Second),
+				0,
+			)
+
+			_, err := backupService.ConsolidateBackup(context.Background(), tt.target, ptr("consolidated"), tt.retire)
+			if tt.expectedCode != 0 {
+				svcErr, ok := err.(*ServiceError)
+				if !ok || svcErr.Code != tt.expectedCode {
+					t.Fatalf("expected a %d error, got %v", tt.expectedCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := socket.request(t, "consolidate_backup")
+			if req.Args["id"] != "consolidated" {
+				t.Errorf("expected id consolidated, got %v", req.Args["id"])
+			}
+			if !reflect.DeepEqual(req.Args["id_list"], tt.expectedList) {
+				t.Errorf("expected id_list %v, got %v", tt.expectedList, req.Args["id_list"])
+			}
+			if retire, _ := req.Args["retire"].(bool); retire != tt.retire {
+				t.Errorf("expected retire %v, got %v", tt.retire, req.Args["retire"])
+			}
+		})
+	}
+}
+
+func TestCreateBackupRejectsUnsafeIDs(t *testing.T) {
+	db := newTestDB(t)
+	seedBackup(t, db, "base", nil, nil, time.Now().Add(-time.Hour))
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+	ctx := context.Background()
+
+	for _, id := range []string{"../../etc", "..", ".hidden", "nested/backup", `back\slash`, "/etc/passwd", "with space", "", strings.Repeat("a", 129)} {
+		_, err := backupService.CreateFullBackup(ctx, ptr(id), nil, "", nil)
+		if svcErr, ok := err.(*ServiceError); !ok || svcErr.Code != 400 {
+			t.Errorf("expected 400 for full backup id %q, got %v", id, err)
+		}
+		_, err = backupService.CreateIncrementalBackup(ctx, ptr("incr"), ptr(id), nil, nil)
+		if svcErr, ok := err.(*ServiceError); !ok || svcErr.Code != 400 {
+			t.Errorf("expected 400 for base backup id %q, got %v", id, err)
+		}
+	}
+	if got := socket.commands(); len(got) != 0 {
+		t.Errorf("expected nothing to be sent to db-cmd, got %v", got)
+	}
+
+	// Surrounding whitespace is trimmed off a safe ID
+	if _, err := backupService.CreateFullBackup(ctx, ptr(" nightly-1.full "), nil, "", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id := socket.request(t, "full_backup").Args["id"]; id != "nightly-1.full" {
+		t.Errorf("expected the normalized id nightly-1.full, got %v", id)
+	}
+}
+
+func TestCreateIncrementalBackupRejectsCrossScheduleBase(t *testing.T) {
+	db := newTestDB(t)
+	scheduleA := seedSchedule(t, db, "full")
+	scheduleB := seedSchedule(t, db, "incremental")
+	seedBackup(t, db, "full-a", nil, &scheduleA, time.Now().Add(-2*time.Hour))
+	seedBackup(t, db, "full-manual", nil, nil, time.Now().Add(-time.Hour))
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		base       string
+		scheduleID *int64
+		expectErr  bool
+	}{
+		{name: "base from another schedule", base: "full-a", scheduleID: &scheduleB, expectErr: true},
+		{name: "scheduled base for a manual incremental", base: "full-a", expectErr: true},
+		{name: "manual base for a scheduled incremental", base: "full-manual", scheduleID: &scheduleA, expectErr: true},
+		{name: "base from the same schedule", base: "full-a", scheduleID: &scheduleA},
+		{name: "manual base for a manual incremental", base: "full-manual"},
+	}
+	sent := 0
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := backupService.CreateIncrementalBackup(ctx, ptr(fmt.Sprintf("incr-%d", i)), ptr(tt.base), tt.scheduleID, nil)
+			if tt.expectErr {
+				var svcErr *ServiceError
+				if !errors.As(err, &svcErr) || svcErr.Code != 400 {
+					t.Fatalf("expected a 400, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sent++
+		})
+	}
+
+	var incrementals int
+	for _, cmd := range socket.commands() {
+		if cmd == "incremental_backup" {
+			incrementals++
+		}
+	}
+	if incrementals != sent {
+		t.Errorf("expected only the %d same-schedule incrementals to be sent, got %d", sent, incrementals)
+	}
+}
+
+func TestCreateIncrementalBackupOfPresetFindsFullScheduleBase(t *testing.T) {
+	db := newTestDB(t)
+	fullSchedule := seedSchedule(t, db, "full")
+	incrementalSchedule := seedSchedule(t, db, "incremental")
+	if _, err := db.Exec(`UPDATE schedule SET preset_group = 'preset-1'`); err != nil {
+		t.Fatalf("failed to group schedules: %v", err)
+	}
+	seedBackup(t, db, "weekly-full", nil, &fullSchedule, time.Now().Add(-24*time.Hour))
+
+	socket := newFakeSocket(t, nil)
+	backupService := NewBackupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, dbcmd.NewClient(socket.path, time.Second), 0)
+
+	// The incremental schedule takes no full backups itself
+	if _, err := backupService.CreateIncrementalBackup(context.Background(), ptr("daily-incr"), nil, &incrementalSchedule, nil); err != nil {
+		t.Fatalf("expected the preset's full backup to be found as base: %v", err)
+	}
+	if got := socket.request(t, "incremental_backup").Args["from_backup_id"]; got != "weekly-full" {
+		t.Errorf("expected base weekly-full, got %v", got)
+	}
+
+	// An explicit base from the preset's full schedule is accepted too
+	if _, err := backupService.CreateIncrementalBackup(context.Background(), ptr("explicit-incr"), ptr("weekly-full"), &incrementalSchedule, nil); err != nil {
+		t.Errorf("expected a base from the preset's full schedule to be accepted: %v", err)
+	}
+}
+
+func TestSkipForCooldown(t *testing.T) {
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	finished := started.Add(10 * time.Minute) // seedBackup's backups take 10 minutes
+
+	tests := []struct {
+		name       string
+		cooldown   time.Duration
+		now        time.Time
+		expectSkip bool
+	}{
+		{name: "within the cooldown", cooldown: 30 * time.Minute, now: finished.Add(30*time.Minute - time.Second), expectSkip: true},
+		{name: "cooldown over", cooldown: 30 * time.Minute, now: finished.Add(30 * time.Minute)},
+		{name: "disabled when cooldown is zero", cooldown: 0, now: finished.Add(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			scheduleID := seedSchedule(t, db, "full")
+			// The cooldown counts from any backup, here a manual one after the schedule's own
+			seedBackup(t, db, "scheduled", nil, &scheduleID, started.Add(-24*time.Hour))
+			seedBackup(t, db, "manual", nil, nil, started)
+
+			processRepo := sqlite.NewProcessRepository(db)
+			backupService := NewBackupService(
+				sqlite.NewBackupRepository(db),
+				sqlite.NewScheduleRepository(db),
+				NewProcessService(processRepo),
+				nil,
+				0,
+			).WithCooldown(tt.cooldown)
+
+			process, err := backupService.SkipForCooldown(context.Background(), scheduleID, tt.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.expectSkip {
+				if process != nil {
+					t.Errorf("expected the run not to be skipped, got %v", process.Args)
+				}
+				return
+			}
+
+			if process == nil {
+				t.Fatal("expected the run to be skipped")
+			}
+			recorded, err := processRepo.FindByCommandID(context.Background(), process.CommandID)
+			if err != nil {
+				t.Fatalf("expected the skipped run to be recorded: %v", err)
+			}
+			if recorded.Status != domain.ProcessStatusSkipped || recorded.Args["skip_reason"] != "cooldown" ||
+				recorded.Args["last_backup_id"] != "manual" {
+				t.Errorf("expected a run skipped for the cooldown of manual, got %s %v", recorded.Status, recorded.Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+const (
+	catalogBackupPrefix = "catalog-"
+	catalogBackupSuffix = ".sqlite3"
+)
+
+// CatalogService backs up and restores dbcalm's own SQLite catalog, so the backup
+// history survives losing /var/lib/dbcalm
+type CatalogService struct {
+	catalogRepo repository.CatalogRepository
+	backupDir   string
+	interval    time.Duration // Zero disables the periodic backup
+	keep        int           // Number of snapshots kept, older ones are removed
+	stop        chan struct{}
+}
+
+func NewCatalogService(catalogRepo repository.CatalogRepository, backupDir string, interval time.Duration, keep int) *CatalogService {
+	return &CatalogService{
+		catalogRepo: catalogRepo,
+		backupDir:   backupDir,
+		interval:    interval,
+		keep:        keep,
+	}
+}
+
+// Start runs the periodic catalog backup until Stop is called
+func (s *CatalogService) Start() {
+	if s.interval <= 0 || s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.Backup(context.Background()); err != nil {
+					log.Printf("Warning: periodic catalog backup failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+}
+
+// Stop ends the periodic catalog backup
+func (s *CatalogService) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Backup writes a snapshot of the catalog to the backup directory and removes
+// snapshots beyond the configured number to keep
+func (s *CatalogService) Backup(ctx context.Context) (*domain.CatalogBackup, error) {
+	if err := os.MkdirAll(s.backupDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create catalog backup directory: %w", err)
+	}
+
+	createdAt := time.Now().UTC()
+	name := catalogBackupPrefix + createdAt.Format("20060102T150405.000000000Z") + catalogBackupSuffix
+	path := filepath.Join(s.backupDir, name)
+
+	if err := s.catalogRepo.BackupTo(ctx, path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat catalog backup: %w", err)
+	}
+
+	if err := s.prune(); err != nil {
+		log.Printf("Warning: failed to remove old catalog backups: %v", err)
+	}
+
+	return &domain.CatalogBackup{
+		Name:      name,
+		Path:      path,
+		Size:      info.Size(),
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// Restore replaces the catalog's contents with the named snapshot from the backup directory
+func (s *CatalogService) Restore(ctx context.Context, name string) error {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, catalogBackupPrefix) || !strings.HasSuffix(name, catalogBackupSuffix) {
+		return NewServiceError(http.StatusBadRequest, fmt.Sprintf("invalid catalog backup name: %s", name))
+	}
+
+	path := filepath.Join(s.backupDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return NewServiceError(http.StatusNotFound, fmt.Sprintf("catalog backup not found: %s", name))
+	}
+
+	return s.catalogRepo.RestoreFrom(ctx, path)
+}
+
+// prune removes the oldest snapshots beyond the number to keep. Names sort by creation time.
+func (s *CatalogService) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(s.backupDir, catalogBackupPrefix+"*"+catalogBackupSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	for len(matches) > s.keep {
+		if err := os.Remove(matches[0]); err != nil {
+			return err
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
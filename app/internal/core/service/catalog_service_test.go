@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCatalogBackupAndRestore(t *testing.T) {
+	// A file database, since ATTACH needs its own connection to see the same catalog
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	scheduleID := seedSchedule(t, db, "full")
+	seedBackup(t, db, "before-snapshot", nil, &scheduleID, time.Now().Add(-time.Hour))
+
+	backupDir := filepath.Join(t.TempDir(), "catalog")
+	catalogService := NewCatalogService(sqlite.NewCatalogRepository(db), backupDir, 0, 2)
+	ctx := context.Background()
+
+	snapshot, err := catalogService.Backup(ctx)
+	if err != nil {
+		t.Fatalf("unexpected backup error: %v", err)
+	}
+	if snapshot.Size == 0 {
+		t.Error("expected a non-empty snapshot")
+	}
+
+	// Lose one backup record and gain another after the snapshot
+	if _, err := db.Exec(`DELETE FROM backup WHERE id = 'before-snapshot'`); err != nil {
+		t.Fatalf("failed to delete backup: %v", err)
+	}
+	seedBackup(t, db, "after-snapshot", nil, &scheduleID, time.Now())
+
+	if err := catalogService.Restore(ctx, snapshot.Name); err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+
+	var ids []string
+	if err := db.Select(&ids, `SELECT id FROM backup ORDER BY id`); err != nil {
+		t.Fatalf("failed to list backups: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "before-snapshot" {
+		t.Errorf("expected the catalog as of the snapshot, got %v", ids)
+	}
+
+	// Only the configured number of snapshots is kept
+	for i := 0; i < 3; i++ {
+		if _, err := catalogService.Backup(ctx); err != nil {
+			t.Fatalf("unexpected backup error: %v", err)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(backupDir, "catalog-*.sqlite3"))
+	if len(matches) != 2 {
+		t.Errorf("expected 2 snapshots to be kept, got %d", len(matches))
+	}
+
+	if err := catalogService.Restore(ctx, "../db.sqlite3"); err == nil {
+		t.Error("expected a path outside the backup directory to be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// CatchUpService starts the backups cron missed while the host was down. It is opt-in:
+// only runs missed within the window are caught up, and each schedule at most once.
+type CatchUpService struct {
+	scheduleRepo       repository.ScheduleRepository
+	processService     *ProcessService
+	backupService      *BackupService
+	maintenanceService *MaintenanceService
+	window             time.Duration  // Zero disables catching up
+	location           *time.Location // Zone schedules run in
+}
+
+func NewCatchUpService(
+	scheduleRepo repository.ScheduleRepository,
+	processService *ProcessService,
+	backupService *BackupService,
+	maintenanceService *MaintenanceService,
+	window time.Duration,
+	location *time.Location,
+) *CatchUpService {
+	return &CatchUpService{
+		scheduleRepo:       scheduleRepo,
+		processService:     processService,
+		backupService:      backupService,
+		maintenanceService: maintenanceService,
+		window:             window,
+		location:           location,
+	}
+}
+
+// Run starts one backup for every enabled schedule that missed a run between its
+// last run and now, no longer than the window ago. It returns the schedules caught up.
+func (s *CatchUpService) Run(ctx context.Context, now time.Time) ([]*domain.Schedule, error) {
+	if s.window <= 0 {
+		return nil, nil
+	}
+
+	schedules, err := s.scheduleRepo.FindAllEnabled(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enabled schedules: %w", err)
+	}
+
+	var caughtUp []*domain.Schedule
+	for _, schedule := range schedules {
+		lastRun, err := s.lastRun(ctx, schedule)
+		if err != nil {
+			return caughtUp, err
+		}
+		missed, ok := s.missedRun(schedule, lastRun, now)
+		if !ok {
+			continue
+		}
+
+		log.Printf("Schedule %d missed its run at %s, catching up", schedule.ID, missed.Format(time.RFC3339))
+		if err := s.start(ctx, schedule, now); err != nil {
+			log.Printf("Warning: failed to catch up schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		caughtUp = append(caughtUp, schedule)
+	}
+
+	return caughtUp, nil
+}
+
+// missedRun returns a run of the schedule after its last run that is no older than the
+// window and was due before now
+func (s *CatchUpService) missedRun(schedule *domain.Schedule, lastRun, now time.Time) (time.Time, bool) {
+	from := now.Add(-s.window)
+	if lastRun.After(from) {
+		from = lastRun
+	}
+
+	next, ok := schedule.NextRunAfter(from.In(s.location))
+	// A run due in the current minute is still cron's to start
+	if !ok || !next.Before(now.Truncate(time.Minute)) {
+		return time.Time{}, false
+	}
+	// Catching up runs now, which has to be inside the schedule's window as well
+	if !schedule.InWindow(now.In(s.location)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// lastRun is the start of the schedule's latest backup process, including skipped ones,
+// or its creation when it has not run yet
+func (s *CatchUpService) lastRun(ctx context.Context, schedule *domain.Schedule) (time.Time, error) {
+	process, err := s.processService.LastScheduledRun(ctx, schedule.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if process == nil {
+		return schedule.CreatedAt, nil
+	}
+	return process.StartTime, nil
+}
+
+// start runs the schedule's backup the way cron would, skipping it in maintenance mode
+// and within the backup cooldown
+func (s *CatchUpService) start(ctx context.Context, schedule *domain.Schedule, now time.Time) error {
+	scheduleID := schedule.ID
+	skipped, err := s.maintenanceService.SkipScheduled(ctx, domain.ProcessTypeBackup, map[string]interface{}{
+		"schedule_id": scheduleID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check maintenance mode: %w", err)
+	}
+	if skipped != nil {
+		return nil
+	}
+	skipped, err = s.backupService.SkipForCooldown(ctx, scheduleID, now)
+	if err != nil {
+		return fmt.Errorf("failed to check backup cooldown: %w", err)
+	}
+	if skipped != nil {
+		return nil
+	}
+
+	// Several schedules can be caught up within the same second, the default ID would collide
+	backupID := fmt.Sprintf("%s-schedule-%d", now.Format("20060102-150405"), scheduleID)
+	if schedule.BackupType == domain.BackupTypeIncremental {
+		_, err = s.backupService.CreateIncrementalBackup(ctx, &backupID, nil, &scheduleID, nil)
+	} else {
+		_, err = s.backupService.CreateFullBackup(ctx, &backupID, &scheduleID, schedule.Strategy, nil)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCatchUpWindowBoundary(t *testing.T) {
+	day := func(d, hour, minute int) time.Time {
+		return time.Date(2026, time.March, d, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name        string
+		window      time.Duration
+		lastRun     time.Time
+		now         time.Time
+		expectCatch bool
+	}{
+		{name: "missed run inside window", window: 6 * time.Hour, lastRun: day(9, 2, 0), now: day(10, 7, 59), expectCatch: true},
+		{name: "missed run exactly at window edge", window: 6 * time.Hour, lastRun: day(9, 2, 0), now: day(10, 8, 0)},
+		{name: "missed run outside window", window: 6 * time.Hour, lastRun: day(9, 2, 0), now: day(10, 8, 1)},
+		{name: "already ran", window: 6 * time.Hour, lastRun: day(10, 2, 0), now: day(10, 7, 0)},
+		{name: "run due this minute is left to cron", window: 6 * time.Hour, lastRun: day(9, 2, 0), now: day(10, 2, 0).Add(30 * time.Second)},
+		{name: "disabled", lastRun: day(9, 2, 0), now: day(10, 3, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, nil)
+			scheduleID := seedSchedule(t, db, "full")
+
+			// The schedule's last run, as recorded by db-cmd
+			_, err := db.Exec(`
+				INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args, schedule_id)
+				VALUES ('last-run', 'mariabackup --backup', 0, 'success', ?, ?, 'backup', '{}', ?)
+			`, tt.lastRun, tt.lastRun.Add(10*time.Minute), scheduleID)
+			if err != nil {
+				t.Fatalf("failed to seed last run: %v", err)
+			}
+
+			scheduleRepo := sqlite.NewScheduleRepository(db)
+			processRepo := sqlite.NewProcessRepository(db)
+			processService := NewProcessService(processRepo)
+			catchUpService := NewCatchUpService(
+				scheduleRepo,
+				processService,
+				NewBackupService(sqlite.NewBackupRepository(db), scheduleRepo, processService, dbcmd.NewClient(socket.path, time.Second), 0),
+				NewMaintenanceService(sqlite.NewMaintenanceRepository(db), processRepo),
+				tt.window,
+				time.Local,
+			)
+
+			caughtUp, err := catchUpService.Run(context.Background(), tt.now)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			if !tt.expectCatch {
+				if len(caughtUp) != 0 {
+					t.Fatalf("expected no catch-up, got %d schedules", len(caughtUp))
+				}
+				for _, cmd := range socket.commands() {
+					if cmd == "full_backup" {
+						t.Fatal("expected no full_backup command")
+					}
+				}
+				return
+			}
+
+			if len(caughtUp) != 1 || caughtUp[0].ID != scheduleID {
+				t.Fatalf("expected schedule %d to be caught up, got %v", scheduleID, caughtUp)
+			}
+			req := socket.request(t, "full_backup")
+			if req.Args["schedule_id"] != float64(scheduleID) {
+				t.Errorf("expected schedule_id %d, got %v", scheduleID, req.Args["schedule_id"])
+			}
+		})
+	}
+}
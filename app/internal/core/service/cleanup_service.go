@@ -3,21 +3,34 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
 
+// Defaults for confirming cleaned up folders are gone, see WithDeletionCheck
+const (
+	DefaultDeletionCheckAttempts = 5
+	DefaultDeletionCheckBackoff  = 500 * time.Millisecond
+)
+
 type CleanupService struct {
 	backupRepo   repository.BackupRepository
 	scheduleRepo repository.ScheduleRepository
 	processServ  *ProcessService
 	cmdClient    *cmd.Client
 	backupDir    string
+	retentionAge domain.RetentionAge
+	// checkAttempts and checkBackoff bound how long a folder cmd removed may take to
+	// disappear before its catalog row is kept
+	checkAttempts int
+	checkBackoff  time.Duration
 }
 
 func NewCleanupService(
@@ -26,14 +39,30 @@ func NewCleanupService(
 	processServ *ProcessService,
 	cmdClient *cmd.Client,
 	backupDir string,
+	retentionAge domain.RetentionAge,
 ) *CleanupService {
 	return &CleanupService{
-		backupRepo:   backupRepo,
-		scheduleRepo: scheduleRepo,
-		processServ:  processServ,
-		cmdClient:    cmdClient,
-		backupDir:    backupDir,
+		backupRepo:    backupRepo,
+		scheduleRepo:  scheduleRepo,
+		processServ:   processServ,
+		cmdClient:     cmdClient,
+		backupDir:     backupDir,
+		retentionAge:  retentionAge,
+		checkAttempts: DefaultDeletionCheckAttempts,
+		checkBackoff:  DefaultDeletionCheckBackoff,
+	}
+}
+
+// WithDeletionCheck sets how often a cleanup checks whether the folders cmd removed are
+// gone before deleting their catalog rows. On NFS and other slow filesystems a removal
+// can take a while to show. The backoff doubles after every attempt.
+func (s *CleanupService) WithDeletionCheck(attempts int, backoff time.Duration) *CleanupService {
+	if attempts < 1 {
+		attempts = 1
 	}
+	s.checkAttempts = attempts
+	s.checkBackoff = backoff
+	return s
 }
 
 // CleanupBySchedule runs cleanup for a specific schedule
@@ -60,14 +89,15 @@ func (s *CleanupService) CleanupBySchedule(ctx context.Context, scheduleID int64
 	var folders []string
 	for _, backup := range expiredBackups {
 		backupIDs = append(backupIDs, backup.ID)
-		folders = append(folders, filepath.Join(s.backupDir, backup.ID))
+		folders = append(folders, backupPaths(s.backupDir, backup.ID)...)
 	}
 
 	// Call cleanup via socket service (it will create the process)
 	// Even if no backups to delete, cmd service will create a process that succeeds immediately
 	cleanupArgs := map[string]interface{}{
-		"backup_ids": backupIDs,
-		"folders":    folders,
+		"backup_ids":  backupIDs,
+		"folders":     folders,
+		"schedule_id": scheduleID,
 	}
 	response, err := s.cmdClient.SendCommand(ctx, "cleanup_backups", cleanupArgs)
 	if err != nil {
@@ -77,10 +107,9 @@ func (s *CleanupService) CleanupBySchedule(ctx context.Context, scheduleID int64
 		return nil, fmt.Errorf("cleanup failed: %s", response.Status)
 	}
 
-	// Start background goroutine to wait for completion and delete DB records
-	if len(expiredBackups) > 0 {
-		go s.waitAndDeleteRecords(response.ID, expiredBackups)
-	}
+	// Start background goroutine to wait for completion, delete DB records and record
+	// what was freed, also for a run that deleted nothing
+	go s.waitAndDeleteRecords(response.ID, expiredBackups)
 
 	// Return process stub - actual process was created by socket service
 	return &domain.Process{
@@ -89,28 +118,40 @@ func (s *CleanupService) CleanupBySchedule(ctx context.Context, scheduleID int64
 	}, nil
 }
 
-// CleanupAll runs cleanup for all schedules with retention policies
-func (s *CleanupService) CleanupAll(ctx context.Context) (*domain.Process, error) {
+// CleanupAll runs cleanup for all schedules with retention policies. A schedule that
+// fails doesn't stop the others; the returned outcomes report each schedule's result.
+func (s *CleanupService) CleanupAll(ctx context.Context) (*domain.Process, []domain.CleanupOutcome, error) {
 	// Get all schedules (synchronously)
 	schedules, err := s.scheduleRepo.List(ctx, repository.ScheduleFilter{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get schedules: %w", err)
+		return nil, nil, fmt.Errorf("failed to get schedules: %w", err)
 	}
 
 	var allExpiredBackups []*domain.Backup
+	outcomes := make([]domain.CleanupOutcome, 0, len(schedules))
 
 	// Get expired backups for each schedule with retention policy
 	for _, schedule := range schedules {
+		outcome := domain.CleanupOutcome{ScheduleID: schedule.ID, Status: domain.CleanupStatusSucceeded}
+
 		if schedule.RetentionValue == nil || schedule.RetentionUnit == nil {
+			outcome.Status = domain.CleanupStatusSkipped
+			outcome.Reason = "schedule does not have a retention policy"
+			outcomes = append(outcomes, outcome)
 			continue
 		}
 
 		expiredBackups, err := s.getExpiredBackupsForSchedule(ctx, schedule)
 		if err != nil {
-			// Log warning but continue with other schedules
+			log.Printf("Warning: cleanup of schedule %d skipped: %v", schedule.ID, err)
+			outcome.Status = domain.CleanupStatusError
+			outcome.Reason = err.Error()
+			outcomes = append(outcomes, outcome)
 			continue
 		}
 
+		outcome.ExpiredBackups = len(expiredBackups)
+		outcomes = append(outcomes, outcome)
 		allExpiredBackups = append(allExpiredBackups, expiredBackups...)
 	}
 
@@ -119,7 +160,7 @@ func (s *CleanupService) CleanupAll(ctx context.Context) (*domain.Process, error
 	var folders []string
 	for _, backup := range allExpiredBackups {
 		backupIDs = append(backupIDs, backup.ID)
-		folders = append(folders, filepath.Join(s.backupDir, backup.ID))
+		folders = append(folders, backupPaths(s.backupDir, backup.ID)...)
 	}
 
 	// Call cleanup via socket service (it will create the process)
@@ -130,22 +171,51 @@ func (s *CleanupService) CleanupAll(ctx context.Context) (*domain.Process, error
 	}
 	response, err := s.cmdClient.SendCommand(ctx, "cleanup_backups", cleanupArgs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initiate cleanup: %w", err)
+		return nil, outcomes, fmt.Errorf("failed to initiate cleanup: %w", err)
 	}
 	if response.Code != 202 {
-		return nil, fmt.Errorf("cleanup failed: %s", response.Status)
+		return nil, outcomes, fmt.Errorf("cleanup failed: %s", response.Status)
 	}
 
-	// Start background goroutine to wait for completion and delete DB records
-	if len(allExpiredBackups) > 0 {
-		go s.waitAndDeleteRecords(response.ID, allExpiredBackups)
-	}
+	// Start background goroutine to wait for completion, delete DB records and record
+	// what was freed, also for a run that deleted nothing
+	go s.waitAndDeleteRecords(response.ID, allExpiredBackups)
 
 	// Return process stub - actual process was created by socket service
 	return &domain.Process{
 		CommandID: response.ID,
 		Status:    domain.ProcessStatusRunning,
-	}, nil
+	}, outcomes, nil
+}
+
+// PreviewCleanup returns the backups a cleanup run would delete without deleting anything.
+// A nil scheduleID previews cleanup for all schedules.
+func (s *CleanupService) PreviewCleanup(ctx context.Context, scheduleID *int64) ([]*domain.Backup, error) {
+	var schedules []*domain.Schedule
+	if scheduleID != nil {
+		schedule, err := s.scheduleRepo.FindByID(ctx, *scheduleID)
+		if err != nil {
+			return nil, fmt.Errorf("schedule not found: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	} else {
+		all, err := s.scheduleRepo.List(ctx, repository.ScheduleFilter{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schedules: %w", err)
+		}
+		schedules = all
+	}
+
+	var expired []*domain.Backup
+	for _, schedule := range schedules {
+		backups, err := s.getExpiredBackupsForSchedule(ctx, schedule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get expired backups: %w", err)
+		}
+		expired = append(expired, backups...)
+	}
+
+	return expired, nil
 }
 
 // getExpiredBackupsForSchedule gets all expired backups for a schedule
@@ -154,24 +224,51 @@ func (s *CleanupService) getExpiredBackupsForSchedule(ctx context.Context, sched
 		return nil, nil
 	}
 
-	// Calculate cutoff date
-	cutoffDate := s.calculateCutoffDate(*schedule.RetentionValue, *schedule.RetentionUnit)
-
-	// Get all backups for this schedule
-	backups, err := s.backupRepo.FindBySchedule(ctx, schedule.ID)
+	// A preset's incrementals build on the full backups of another schedule of the
+	// preset, so its chains are made of the backups of all of them. Each backup expires
+	// by the retention of its own schedule, never without one.
+	schedules, err := presetSchedules(ctx, s.scheduleRepo, schedule.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get backups: %w", err)
+		return nil, err
+	}
+	if schedules == nil {
+		schedules = []*domain.Schedule{schedule}
+	}
+	cutoffs := make(map[int64]time.Time, len(schedules))
+	var backups []*domain.Backup
+	for _, member := range schedules {
+		if member.RetentionValue != nil && member.RetentionUnit != nil {
+			cutoffs[member.ID] = s.calculateCutoffDate(*member.RetentionValue, *member.RetentionUnit)
+		}
+		memberBackups, err := s.backupRepo.FindBySchedule(ctx, member.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get backups: %w", err)
+		}
+		backups = append(backups, memberBackups...)
 	}
 
 	// Group backups into chains
-	chains := s.groupBackupsIntoChains(backups)
+	chains, err := s.groupBackupsIntoChains(backups)
+	if err != nil {
+		return nil, err
+	}
 
-	// Find chains where ALL backups are older than cutoff
+	pinned, err := s.pinnedBackups(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Find chains of this schedule's full backups where ALL backups are older than their
+	// cutoff and none is pinned or needed by a pinned backup
 	var expiredBackups []*domain.Backup
 	for _, chain := range chains {
+		if !sameSchedule(chain[0].ScheduleID, &schedule.ID) {
+			continue
+		}
 		allExpired := true
 		for _, backup := range chain {
-			if backup.StartTime.After(cutoffDate) {
+			cutoff, ok := cutoffs[*backup.ScheduleID]
+			if !ok || s.retentionTimestamp(backup).After(cutoff) || pinned[backup.ID] {
 				allExpired = false
 				break
 			}
@@ -186,11 +283,42 @@ func (s *CleanupService) getExpiredBackupsForSchedule(ctx context.Context, sched
 	return expiredBackups, nil
 }
 
+// pinnedBackups returns the IDs of the backups whose expires_at is after now, along with
+// every backup their chains need to restore, down to the full backup. Those can be in
+// another schedule's chain, an incremental's base isn't always taken by its own schedule.
+func (s *CleanupService) pinnedBackups(ctx context.Context, now time.Time) (map[string]bool, error) {
+	overridden, err := s.backupRepo.List(ctx, repository.BackupFilter{
+		ListFilter: util.ListFilter{
+			Filters: []util.QueryFilter{{Field: "expires_at", Operator: util.OpGt, Value: now.Format(time.RFC3339Nano)}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned backups: %w", err)
+	}
+
+	pinned := make(map[string]bool)
+	for _, backup := range overridden {
+		if pinned[backup.ID] {
+			continue
+		}
+		chain, err := s.backupRepo.FindChain(ctx, backup.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain of pinned backup %s: %w", backup.ID, err)
+		}
+		for _, link := range chain {
+			pinned[link.ID] = true
+		}
+	}
+	return pinned, nil
+}
+
 // calculateCutoffDate calculates the cutoff date for retention policy
 func (s *CleanupService) calculateCutoffDate(retentionValue int, retentionUnit domain.RetentionUnit) time.Time {
 	now := time.Now()
 
 	switch retentionUnit {
+	case domain.RetentionUnitHours:
+		return now.Add(-time.Duration(retentionValue) * time.Hour)
 	case domain.RetentionUnitDays:
 		return now.AddDate(0, 0, -retentionValue)
 	case domain.RetentionUnitWeeks:
@@ -202,8 +330,20 @@ func (s *CleanupService) calculateCutoffDate(retentionValue int, retentionUnit d
 	}
 }
 
+// retentionTimestamp is the time retention counts a backup's age from. A backup that hasn't
+// completed yet is never old enough to expire under end_time.
+func (s *CleanupService) retentionTimestamp(backup *domain.Backup) time.Time {
+	if s.retentionAge != domain.RetentionAgeEndTime {
+		return backup.StartTime
+	}
+	if backup.EndTime == nil {
+		return time.Now()
+	}
+	return *backup.EndTime
+}
+
 // groupBackupsIntoChains groups backups into chains (full backup + its incrementals)
-func (s *CleanupService) groupBackupsIntoChains(backups []*domain.Backup) [][]*domain.Backup {
+func (s *CleanupService) groupBackupsIntoChains(backups []*domain.Backup) ([][]*domain.Backup, error) {
 	// Build a map of backup ID to backup
 	backupMap := make(map[string]*domain.Backup)
 	for _, backup := range backups {
@@ -227,7 +367,11 @@ func (s *CleanupService) groupBackupsIntoChains(backups []*domain.Backup) [][]*d
 		for _, backup := range backups {
 			if backup.Type == domain.BackupTypeIncremental && backup.FromBackupID != nil {
 				// Check if this incremental is part of this chain
-				if s.isInChain(backup, fullBackup.ID, backupMap) {
+				inChain, err := s.isInChain(backup, fullBackup.ID, backupMap)
+				if err != nil {
+					return nil, err
+				}
+				if inChain {
 					chain = append(chain, backup)
 				}
 			}
@@ -236,25 +380,31 @@ func (s *CleanupService) groupBackupsIntoChains(backups []*domain.Backup) [][]*d
 		chains = append(chains, chain)
 	}
 
-	return chains
+	return chains, nil
 }
 
-// isInChain checks if a backup is part of a chain starting from rootID
-func (s *CleanupService) isInChain(backup *domain.Backup, rootID string, backupMap map[string]*domain.Backup) bool {
+// isInChain checks if a backup is part of a chain starting from rootID. A chain that
+// leads back to a backup already walked is corrupt and returned as an error.
+func (s *CleanupService) isInChain(backup *domain.Backup, rootID string, backupMap map[string]*domain.Backup) (bool, error) {
 	if backup.FromBackupID == nil {
-		return false
+		return false, nil
 	}
 
 	// Walk backward from this backup to find the root
+	visited := map[string]bool{backup.ID: true}
 	currentID := *backup.FromBackupID
 	for {
 		if currentID == rootID {
-			return true
+			return true, nil
+		}
+		if visited[currentID] {
+			return false, fmt.Errorf("circular backup chain: %s leads back to %s", backup.ID, currentID)
 		}
+		visited[currentID] = true
 
 		currentBackup, exists := backupMap[currentID]
 		if !exists || currentBackup.FromBackupID == nil {
-			return false
+			return false, nil
 		}
 
 		currentID = *currentBackup.FromBackupID
@@ -280,16 +430,91 @@ func (s *CleanupService) waitAndDeleteRecords(commandID string, backups []*domai
 	}
 
 	// Delete records for folders that are gone
-	var idsToDelete []string
-	for _, backup := range backups {
-		folderPath := filepath.Join(s.backupDir, backup.ID)
-		if _, err := os.Stat(folderPath); os.IsNotExist(err) {
-			idsToDelete = append(idsToDelete, backup.ID)
-		}
+	deleted := s.goneFolders(backups)
+	idsToDelete := make([]string, 0, len(deleted))
+	for _, backup := range deleted {
+		idsToDelete = append(idsToDelete, backup.ID)
 	}
 
 	// Delete all records in one query (avoids CASCADE race condition)
 	if len(idsToDelete) > 0 {
-		_ = s.backupRepo.DeleteMany(ctx, idsToDelete)
+		if err := s.backupRepo.DeleteMany(ctx, idsToDelete); err != nil {
+			log.Printf("Warning: failed to delete records of cleaned up backups: %v", err)
+			return
+		}
+	}
+
+	result := map[string]interface{}{
+		"deleted_count": len(deleted),
+		"freed_bytes":   freedBytes(deleted),
+	}
+	if err := s.processServ.RecordResult(ctx, commandID, result); err != nil {
+		log.Printf("Warning: failed to record cleanup result: %v", err)
+	}
+}
+
+// streamSuffixes are the names a backup streamed to backup_dir can have, by the
+// compression it was written with, as db-cmd names them
+var streamSuffixes = []string{".xbstream", ".xbstream.gz", ".xbstream.zst"}
+
+// backupPaths returns everything a backup can take in backup_dir: its folder and the
+// files it could have been streamed to, whichever compression was configured then
+func backupPaths(backupDir, id string) []string {
+	paths := []string{filepath.Join(backupDir, id)}
+	for _, suffix := range streamSuffixes {
+		paths = append(paths, filepath.Join(backupDir, "backup-"+id+suffix))
+	}
+	return paths
+}
+
+// backupGone reports whether none of a backup's paths are left in backupDir
+func backupGone(backupDir, id string) bool {
+	for _, path := range backupPaths(backupDir, id) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// goneFolders returns the backups whose folder and stream file are gone from backup_dir.
+// Backups still there are checked again, with backoff, until they are gone or the
+// attempts run out.
+func (s *CleanupService) goneFolders(backups []*domain.Backup) []*domain.Backup {
+	var gone []*domain.Backup
+	remaining := backups
+	backoff := s.checkBackoff
+	for attempt := 1; ; attempt++ {
+		var present []*domain.Backup
+		for _, backup := range remaining {
+			if backupGone(s.backupDir, backup.ID) {
+				gone = append(gone, backup)
+			} else {
+				present = append(present, backup)
+			}
+		}
+		remaining = present
+		if len(remaining) == 0 || attempt >= s.checkAttempts {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	for _, backup := range remaining {
+		log.Printf("Warning: backup %s is still in the backup directory after cleanup, keeping its catalog row", backup.ID)
+	}
+	return gone
+}
+
+// freedBytes is the space the deleted backups took in backup_dir, as recorded in the
+// catalog. Backups without a recorded size count as zero.
+func freedBytes(deleted []*domain.Backup) int64 {
+	var total int64
+	for _, backup := range deleted {
+		if backup.Size != nil {
+			total += *backup.Size
+		}
 	}
+	return total
 }
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCleanupAllReportsScheduleErrors(t *testing.T) {
+	db := newTestDB(t)
+	healthyID := seedSchedule(t, db, "full")
+	brokenID := seedSchedule(t, db, "full")
+	unmanagedID := seedSchedule(t, db, "full")
+
+	if _, err := db.Exec(`UPDATE schedule SET retention_value = 7, retention_unit = 'days' WHERE id IN (?, ?)`, healthyID, brokenID); err != nil {
+		t.Fatalf("failed to set retention: %v", err)
+	}
+
+	seedBackup(t, db, "healthy-old", nil, &healthyID, time.Now().Add(-30*24*time.Hour))
+	seedBackup(t, db, "broken-old", nil, &brokenID, time.Now().Add(-30*24*time.Hour))
+	// A corrupt row makes reading the broken schedule's backups fail
+	if _, err := db.Exec(`UPDATE backup SET excluded_databases = 'not json' WHERE id = 'broken-old'`); err != nil {
+		t.Fatalf("failed to corrupt backup: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	cleanupService := NewCleanupService(
+		sqlite.NewBackupRepository(db),
+		sqlite.NewScheduleRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		cmd.NewClient(socket.path, time.Second),
+		t.TempDir(),
+		domain.RetentionAgeStartTime,
+	)
+
+	process, outcomes, err := cleanupService.CleanupAll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if process.CommandID != "cmd-cleanup_backups" {
+		t.Errorf("expected the cleanup to run, got command ID %q", process.CommandID)
+	}
+
+	// The healthy schedule is still cleaned up
+	backupIDs := socket.request(t, "cleanup_backups").Args["backup_ids"]
+	if !reflect.DeepEqual(backupIDs, []interface{}{"healthy-old"}) {
+		t.Errorf("expected healthy-old to be cleaned up, got %v", backupIDs)
+	}
+
+	statuses := make(map[int64]domain.CleanupStatus)
+	for _, outcome := range outcomes {
+		statuses[outcome.ScheduleID] = outcome.Status
+		if outcome.Status == domain.CleanupStatusError && outcome.Reason == "" {
+			t.Errorf("expected a reason for schedule %d's error", outcome.ScheduleID)
+		}
+	}
+	expected := map[int64]domain.CleanupStatus{
+		healthyID:   domain.CleanupStatusSucceeded,
+		brokenID:    domain.CleanupStatusError,
+		unmanagedID: domain.CleanupStatusSkipped,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected outcomes %v, got %v", expected, statuses)
+	}
+}
+
+func TestPreviewCleanupHourlyRetention(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+	if _, err := db.Exec(`UPDATE schedule SET frequency = 'hourly', retention_value = 48, retention_unit = 'hours' WHERE id = ?`, scheduleID); err != nil {
+		t.Fatalf("failed to set retention: %v", err)
+	}
+
+	now := time.Now()
+	// Entirely older than 48 hours
+	seedBackup(t, db, "expired-full", nil, &scheduleID, now.Add(-60*time.Hour))
+	seedBackup(t, db, "expired-incr", ptr("expired-full"), &scheduleID, now.Add(-55*time.Hour))
+	// Started before the cutoff but its incremental is newer, so the chain is kept
+	seedBackup(t, db, "straddling-full", nil, &scheduleID, now.Add(-50*time.Hour))
+	seedBackup(t, db, "straddling-incr", ptr("straddling-full"), &scheduleID, now.Add(-47*time.Hour))
+	seedBackup(t, db, "recent-full", nil, &scheduleID, now.Add(-2*time.Hour))
+
+	cleanupService := NewCleanupService(
+		sqlite.NewBackupRepository(db),
+		sqlite.NewScheduleRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		nil,
+		t.TempDir(),
+		domain.RetentionAgeStartTime,
+	)
+
+	expired, err := cleanupService.PreviewCleanup(context.Background(), &scheduleID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ids []string
+	for _, backup := range expired {
+		ids = append(ids, backup.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"expired-full", "expired-incr"}) {
+		t.Errorf("expected only the chain older than 48 hours to expire, got %v", ids)
+	}
+}
+
+func TestExpiresAtOverrideKeepsBackups(t *testing.T) {
+	db := newTestDB(t)
+	scheduleID := seedSchedule(t, db, "full")
+	otherScheduleID := seedSchedule(t, db, "incremental")
+	if _, err := db.Exec(`UPDATE schedule SET frequency = 'hourly', retention_value = 48, retention_unit = 'hours'`); err != nil {
+		t.Fatalf("failed to set retention: %v", err)
+	}
+
+	now := time.Now()
+	// Every chain is older than 48 hours
+	seedBackup(t, db, "expired-full", nil, &scheduleID, now.Add(-90*time.Hour))
+	seedBackup(t, db, "pinned-full", nil, &scheduleID, now.Add(-80*time.Hour))
+	seedBackup(t, db, "pinned-incr", ptr("pinned-full"), &scheduleID, now.Add(-75*time.Hour))
+	seedBackup(t, db, "lapsed-full", nil, &scheduleID, now.Add(-70*time.Hour))
+	// Taken by another schedule, pinning it keeps the full backup it builds on
+	seedBackup(t, db, "base-full", nil, &scheduleID, now.Add(-60*time.Hour))
+	seedBackup(t, db, "other-incr", ptr("base-full"), &otherScheduleID, now.Add(-55*time.Hour))
+
+	backupRepo := sqlite.NewBackupRepository(db)
+	ctx := context.Background()
+	for id, expiresAt := range map[string]time.Time{
+		"pinned-incr": now.Add(24 * time.Hour),
+		"lapsed-full": now.Add(-time.Hour),
+		"other-incr":  now.Add(24 * time.Hour),
+	} {
+		if err := backupRepo.SetExpiresAt(ctx, id, &expiresAt); err != nil {
+			t.Fatalf("failed to set expires_at: %v", err)
+		}
+	}
+
+	cleanupService := NewCleanupService(
+		backupRepo,
+		sqlite.NewScheduleRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		nil,
+		t.TempDir(),
+		domain.RetentionAgeStartTime,
+	)
+
+	expired, err := cleanupService.PreviewCleanup(ctx, &scheduleID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ids []string
+	for _, backup := range expired {
+		ids = append(ids, backup.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"expired-full", "lapsed-full"}) {
+		t.Errorf("expected pinned chains to be kept, got %v", ids)
+	}
+}
+
+func TestRetentionAgeStartVersusEndTime(t *testing.T) {
+	tests := []struct {
+		name         string
+		retentionAge domain.RetentionAge
+		expected     []string
+	}{
+		{name: "start_time expires the long backup", retentionAge: domain.RetentionAgeStartTime, expected: []string{"long-full"}},
+		{name: "end_time keeps the long backup", retentionAge: domain.RetentionAgeEndTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			scheduleID := seedSchedule(t, db, "full")
+			if _, err := db.Exec(`UPDATE schedule SET frequency = 'hourly', retention_value = 48, retention_unit = 'hours' WHERE id = ?`, scheduleID); err != nil {
+				t.Fatalf("failed to set retention: %v", err)
+			}
+
+			// Started before the 48 hour cutoff, completed after it
+			now := time.Now()
+			seedBackup(t, db, "long-full", nil, &scheduleID, now.Add(-50*time.Hour))
+			if _, err := db.Exec(`UPDATE backup SET end_time = ? WHERE id = 'long-full'`, now.Add(-46*time.Hour).Format(time.RFC3339)); err != nil {
+				t.Fatalf("failed to set end time: %v", err)
+			}
+
+			cleanupService := NewCleanupService(
+				sqlite.NewBackupRepository(db),
+				sqlite.NewScheduleRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				nil,
+				t.TempDir(),
+				tt.retentionAge,
+			)
+
+			expired, err := cleanupService.PreviewCleanup(context.Background(), &scheduleID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var ids []string
+			for _, backup := range expired {
+				ids = append(ids, backup.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("expected %v to expire, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestPreviewCleanupExpiresPresetChains(t *testing.T) {
+	db := newTestDB(t)
+	fullSchedule := seedSchedule(t, db, "full")
+	incrementalSchedule := seedSchedule(t, db, "incremental")
+	if _, err := db.Exec(`UPDATE schedule SET preset_group = 'preset-1', retention_unit = 'days'`); err != nil {
+		t.Fatalf("failed to group schedules: %v", err)
+	}
+	// Fulls are kept a week longer than the incrementals built on them
+	if _, err := db.Exec(`UPDATE schedule SET retention_value = CASE backup_type WHEN 'full' THEN 21 ELSE 14 END`); err != nil {
+		t.Fatalf("failed to set retention: %v", err)
+	}
+
+	now := time.Now()
+	// Expired: the full is past 21 days and its incrementals past 14
+	seedBackup(t, db, "old-full", nil, &fullSchedule, now.Add(-30*24*time.Hour))
+	seedBackup(t, db, "old-incr", ptr("old-full"), &incrementalSchedule, now.Add(-25*24*time.Hour))
+	// Kept: the full is past 14 but not 21 days
+	seedBackup(t, db, "recent-full", nil, &fullSchedule, now.Add(-16*24*time.Hour))
+	seedBackup(t, db, "recent-incr", ptr("recent-full"), &incrementalSchedule, now.Add(-15*24*time.Hour))
+
+	cleanupService := NewCleanupService(sqlite.NewBackupRepository(db), sqlite.NewScheduleRepository(db), nil, nil, t.TempDir(), domain.RetentionAgeStartTime)
+	expired, err := cleanupService.PreviewCleanup(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("PreviewCleanup failed: %v", err)
+	}
+	var ids []string
+	for _, backup := range expired {
+		ids = append(ids, backup.ID)
+	}
+	// The chain is expired once, by the schedule its full backup belongs to
+	if !reflect.DeepEqual(ids, []string{"old-full", "old-incr"}) {
+		t.Errorf("expected the old chain to expire once, got %v", ids)
+	}
+}
+
+func TestCleanupRecordsFreedBytes(t *testing.T) {
+	db := newTestDB(t)
+	backupDir := t.TempDir()
+	start := time.Now().Add(-30 * 24 * time.Hour)
+	seedBackup(t, db, "full", nil, nil, start)
+	seedBackup(t, db, "incr", ptr("full"), nil, start.Add(time.Hour))
+	seedBackup(t, db, "unsized", nil, nil, start)
+	seedBackup(t, db, "kept", nil, nil, start)
+	seedBackup(t, db, "streamed", nil, nil, start)
+	for id, size := range map[string]int64{"full": 5 << 30, "incr": 300 << 20, "kept": 1 << 30, "streamed": 2 << 30} {
+		if _, err := db.Exec(`UPDATE backup SET size = ? WHERE id = ?`, size, id); err != nil {
+			t.Fatalf("failed to set size of %s: %v", id, err)
+		}
+	}
+	// cmd couldn't remove this folder, so it isn't counted as freed
+	if err := os.MkdirAll(filepath.Join(backupDir, "kept"), 0755); err != nil {
+		t.Fatalf("failed to create backup folder: %v", err)
+	}
+	// Nor this stream file, a streamed backup has no folder
+	if err := os.WriteFile(filepath.Join(backupDir, "backup-streamed.xbstream.gz"), []byte("stream"), 0644); err != nil {
+		t.Fatalf("failed to create stream file: %v", err)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES ('cleanup-1', 'rm -rf', 0, 'success', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'cleanup_backups', '{}')
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed cleanup process: %v", err)
+	}
+
+	backupRepo := sqlite.NewBackupRepository(db)
+	processService := NewProcessService(sqlite.NewProcessRepository(db))
+	cleanupService := NewCleanupService(backupRepo, sqlite.NewScheduleRepository(db), processService, nil, backupDir, domain.RetentionAgeStartTime).
+		WithDeletionCheck(2, time.Millisecond)
+
+	var expired []*domain.Backup
+	for _, id := range []string{"full", "incr", "unsized", "kept", "streamed"} {
+		backup, err := backupRepo.FindByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("failed to read backup %s: %v", id, err)
+		}
+		expired = append(expired, backup)
+	}
+	cleanupService.waitAndDeleteRecords("cleanup-1", expired)
+
+	process, err := processService.GetProcessByCommandID(context.Background(), "cleanup-1")
+	if err != nil {
+		t.Fatalf("failed to read cleanup process: %v", err)
+	}
+	// Stored as JSON, so the numbers come back as float64
+	if got := process.Args["deleted_count"]; got != float64(3) {
+		t.Errorf("expected deleted_count 3, got %v", got)
+	}
+	if got := process.Args["freed_bytes"]; got != float64(5<<30+300<<20) {
+		t.Errorf("expected freed_bytes %d, got %v", int64(5<<30+300<<20), got)
+	}
+	if _, err := backupRepo.FindByID(context.Background(), "streamed"); err != nil {
+		t.Errorf("expected the row of the backup whose stream file stayed to be kept, got %v", err)
+	}
+}
+
+func TestCleanupWaitsForFolderRemovalToShow(t *testing.T) {
+	db := newTestDB(t)
+	backupDir := t.TempDir()
+	start := time.Now().Add(-30 * 24 * time.Hour)
+	for _, id := range []string{"slow", "stuck"} {
+		seedBackup(t, db, id, nil, nil, start)
+		if err := os.MkdirAll(filepath.Join(backupDir, id), 0755); err != nil {
+			t.Fatalf("failed to create backup folder: %v", err)
+		}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES ('cleanup-1', 'rm -rf', 0, 'success', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'cleanup_backups', '{}')
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed cleanup process: %v", err)
+	}
+
+	backupRepo := sqlite.NewBackupRepository(db)
+	cleanupService := NewCleanupService(backupRepo, sqlite.NewScheduleRepository(db), NewProcessService(sqlite.NewProcessRepository(db)), nil, backupDir, domain.RetentionAgeStartTime).
+		WithDeletionCheck(5, 20*time.Millisecond)
+
+	var expired []*domain.Backup
+	for _, id := range []string{"slow", "stuck"} {
+		backup, err := backupRepo.FindByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("failed to read backup %s: %v", id, err)
+		}
+		expired = append(expired, backup)
+	}
+
+	// The removal of slow only shows after the first checks, as on NFS
+	removed := make(chan error, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		removed <- os.RemoveAll(filepath.Join(backupDir, "slow"))
+	}()
+	cleanupService.waitAndDeleteRecords("cleanup-1", expired)
+	if err := <-removed; err != nil {
+		t.Fatalf("failed to remove backup folder: %v", err)
+	}
+
+	if _, err := backupRepo.FindByID(context.Background(), "slow"); err == nil {
+		t.Error("expected the row of the folder that disappeared late to be deleted")
+	}
+	if _, err := backupRepo.FindByID(context.Background(), "stuck"); err != nil {
+		t.Errorf("expected the row of the folder that stayed to be kept, got %v", err)
+	}
+}
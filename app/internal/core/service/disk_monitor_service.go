@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+)
+
+// DiskMonitorService periodically checks the free space and inodes of the filesystem
+// backup_dir lives on, so a filling disk is reported before a backup fails writing to it
+type DiskMonitorService struct {
+	path            string
+	interval        time.Duration // Zero disables the monitor
+	warningPercent  int
+	criticalPercent int
+	webhook         string // Notified of state changes when set
+	client          *http.Client
+	statfs          func(path string, stat *syscall.Statfs_t) error
+
+	mu    sync.RWMutex
+	usage *domain.DiskUsage
+	stop  chan struct{}
+}
+
+func NewDiskMonitorService(path string, interval time.Duration, warningPercent, criticalPercent int, webhook string) *DiskMonitorService {
+	return &DiskMonitorService{
+		path:            path,
+		interval:        interval,
+		warningPercent:  warningPercent,
+		criticalPercent: criticalPercent,
+		webhook:         webhook,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		statfs:          syscall.Statfs,
+	}
+}
+
+// Enabled reports whether the monitor checks the disk at all
+func (s *DiskMonitorService) Enabled() bool {
+	return s.interval > 0
+}
+
+// Start checks the disk right away and then every interval until Stop is called
+func (s *DiskMonitorService) Start() {
+	if !s.Enabled() || s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		s.Check(time.Now())
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				s.Check(now)
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+}
+
+// Stop ends the periodic check
+func (s *DiskMonitorService) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Usage returns the last check, with an unknown state before the first one
+func (s *DiskMonitorService) Usage() domain.DiskUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.usage == nil {
+		return domain.DiskUsage{Path: s.path, State: domain.DiskStateUnknown}
+	}
+	return *s.usage
+}
+
+// Check measures the filesystem now and records the result. A change of state is
+// logged, and sent to the webhook unless it is the first check finding the disk fine.
+func (s *DiskMonitorService) Check(now time.Time) domain.DiskUsage {
+	usage := s.measure(now)
+
+	s.mu.Lock()
+	previous := domain.DiskStateUnknown
+	if s.usage != nil {
+		previous = s.usage.State
+	}
+	s.usage = &usage
+	s.mu.Unlock()
+
+	if usage.State == previous {
+		return usage
+	}
+	switch usage.State {
+	case domain.DiskStateUnknown:
+		log.Printf("Warning: failed to check disk usage of %s: %s", s.path, usage.Error)
+	case domain.DiskStateOK:
+		log.Printf("Disk usage of %s is back to normal: %.1f%% used", s.path, usage.UsedPercent)
+	default:
+		log.Printf("Warning: disk usage of %s is %s: %.1f%% space, %.1f%% inodes used",
+			s.path, usage.State, usage.UsedPercent, usage.InodesUsedPercent)
+	}
+	if previous == domain.DiskStateUnknown && usage.State == domain.DiskStateOK {
+		return usage
+	}
+	if err := s.notify(usage, previous); err != nil {
+		log.Printf("Warning: failed to send disk usage notification: %v", err)
+	}
+
+	return usage
+}
+
+// measure reads the filesystem's usage the way df does, the space reserved for root
+// counts as used
+func (s *DiskMonitorService) measure(now time.Time) domain.DiskUsage {
+	usage := domain.DiskUsage{Path: s.path, State: domain.DiskStateUnknown, CheckedAt: now}
+
+	var stat syscall.Statfs_t
+	if err := s.statfs(s.path, &stat); err != nil {
+		usage.Error = err.Error()
+		return usage
+	}
+
+	used := stat.Blocks - stat.Bfree
+	if total := used + stat.Bavail; total > 0 {
+		usage.UsedPercent = float64(used) / float64(total) * 100
+	}
+	if stat.Files > 0 {
+		usage.InodesUsedPercent = float64(stat.Files-stat.Ffree) / float64(stat.Files) * 100
+	}
+	usage.FreeBytes = stat.Bavail * uint64(stat.Bsize)
+	usage.FreeInodes = stat.Ffree
+
+	worst := usage.UsedPercent
+	if usage.InodesUsedPercent > worst {
+		worst = usage.InodesUsedPercent
+	}
+	usage.State = domain.DiskStateFor(worst, s.warningPercent, s.criticalPercent)
+
+	return usage
+}
+
+// notify posts the new state to the webhook
+func (s *DiskMonitorService) notify(usage domain.DiskUsage, previous domain.DiskState) error {
+	if s.webhook == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event":               "disk_usage",
+		"path":                usage.Path,
+		"state":               usage.State,
+		"previous_state":      previous,
+		"used_percent":        usage.UsedPercent,
+		"inodes_used_percent": usage.InodesUsedPercent,
+		"free_bytes":          usage.FreeBytes,
+		"free_inodes":         usage.FreeInodes,
+		"checked_at":          usage.CheckedAt,
+		"error":               usage.Error,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	resp, err := s.client.Post(s.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
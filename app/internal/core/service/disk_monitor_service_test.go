@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+)
+
+func TestDiskMonitorThresholdStates(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		notifications []map[string]interface{}
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		mu.Lock()
+		notifications = append(notifications, payload)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	// 1000 blocks and 100 inodes, the tests set how many are in use
+	var usedBlocks, usedInodes uint64
+	var statErr error
+	monitor := NewDiskMonitorService("/backups", time.Minute, 80, 90, webhook.URL)
+	monitor.statfs = func(path string, stat *syscall.Statfs_t) error {
+		if statErr != nil {
+			return statErr
+		}
+		stat.Bsize = 4096
+		stat.Blocks = 1000
+		stat.Bfree = 1000 - usedBlocks
+		stat.Bavail = 1000 - usedBlocks
+		stat.Files = 100
+		stat.Ffree = 100 - usedInodes
+		return nil
+	}
+
+	if usage := monitor.Usage(); usage.State != domain.DiskStateUnknown {
+		t.Fatalf("expected unknown before the first check, got %s", usage.State)
+	}
+
+	steps := []struct {
+		name          string
+		usedBlocks    uint64
+		usedInodes    uint64
+		statErr       error
+		expectedState domain.DiskState
+		expectNotify  bool
+	}{
+		{name: "first check finds the disk fine", usedBlocks: 500, usedInodes: 10, expectedState: domain.DiskStateOK},
+		{name: "just below warning", usedBlocks: 799, usedInodes: 10, expectedState: domain.DiskStateOK},
+		{name: "warning threshold", usedBlocks: 800, usedInodes: 10, expectedState: domain.DiskStateWarning, expectNotify: true},
+		{name: "still warning", usedBlocks: 850, usedInodes: 10, expectedState: domain.DiskStateWarning},
+		{name: "critical threshold", usedBlocks: 900, usedInodes: 10, expectedState: domain.DiskStateCritical, expectNotify: true},
+		{name: "space freed", usedBlocks: 100, usedInodes: 10, expectedState: domain.DiskStateOK, expectNotify: true},
+		{name: "inodes running out", usedBlocks: 100, usedInodes: 95, expectedState: domain.DiskStateCritical, expectNotify: true},
+		{name: "check fails", statErr: errors.New("no such file or directory"), expectedState: domain.DiskStateUnknown, expectNotify: true},
+	}
+
+	for _, step := range steps {
+		usedBlocks, usedInodes, statErr = step.usedBlocks, step.usedInodes, step.statErr
+		mu.Lock()
+		before := len(notifications)
+		mu.Unlock()
+
+		usage := monitor.Check(time.Now())
+		if usage.State != step.expectedState {
+			t.Fatalf("%s: expected state %s, got %s (%.1f%% space, %.1f%% inodes)",
+				step.name, step.expectedState, usage.State, usage.UsedPercent, usage.InodesUsedPercent)
+		}
+		if monitor.Usage().State != step.expectedState {
+			t.Errorf("%s: expected the check to be recorded", step.name)
+		}
+
+		mu.Lock()
+		sent := len(notifications) - before
+		var last map[string]interface{}
+		if sent > 0 {
+			last = notifications[len(notifications)-1]
+		}
+		mu.Unlock()
+		if step.expectNotify != (sent == 1) || sent > 1 {
+			t.Fatalf("%s: expected notification %v, got %d", step.name, step.expectNotify, sent)
+		}
+		if last != nil && last["state"] != string(step.expectedState) {
+			t.Errorf("%s: expected notified state %s, got %v", step.name, step.expectedState, last["state"])
+		}
+	}
+
+	// Free space is reported in bytes, from the blocks available to unprivileged users
+	usedBlocks, usedInodes, statErr = 250, 0, nil
+	usage := monitor.Check(time.Now())
+	if usage.FreeBytes != 750*4096 || usage.UsedPercent != 25 {
+		t.Errorf("expected 25%% used and %d bytes free, got %.1f%% and %d", 750*4096, usage.UsedPercent, usage.FreeBytes)
+	}
+}
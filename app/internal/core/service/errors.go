@@ -1,5 +1,10 @@
 package service
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ServiceError preserves the original error code and message from the socket service
 type ServiceError struct {
 	Code    int
@@ -13,3 +18,28 @@ func (e *ServiceError) Error() string {
 func NewServiceError(code int, message string) *ServiceError {
 	return &ServiceError{Code: code, Message: message}
 }
+
+// FieldError is one invalid field of a request and why it was rejected
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError lists every invalid field of a request at once, so a client can
+// point out all of them instead of one per attempt
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, reason string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: reason})
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		reasons[i] = fmt.Sprintf("%s: %s", field.Field, field.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header stored per request
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyService remembers the responses of requests sent with an Idempotency-Key, so
+// a client retrying a backup or restore after a timeout doesn't start a second one
+type IdempotencyService struct {
+	idempotencyRepo repository.IdempotencyRepository
+	ttl             time.Duration // Zero disables idempotency keys
+}
+
+func NewIdempotencyService(idempotencyRepo repository.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{
+		idempotencyRepo: idempotencyRepo,
+		ttl:             ttl,
+	}
+}
+
+// Enabled reports whether Idempotency-Key headers are honoured
+func (s *IdempotencyService) Enabled() bool {
+	return s.ttl > 0
+}
+
+// Begin claims the key for a request. It returns the stored key when the caller already
+// completed a request with it within the TTL, whose response is to be replayed, and nil
+// when the request is to run. A key that is still running or was used for another
+// endpoint is refused.
+func (s *IdempotencyService) Begin(ctx context.Context, owner, key, method, path string, now time.Time) (*domain.IdempotencyKey, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, NewServiceError(400, fmt.Sprintf("Idempotency-Key cannot be longer than %d characters", maxIdempotencyKeyLength))
+	}
+
+	if err := s.idempotencyRepo.DeleteCreatedBefore(ctx, now.Add(-s.ttl)); err != nil {
+		return nil, err
+	}
+
+	created, err := s.idempotencyRepo.Create(ctx, &domain.IdempotencyKey{
+		Key:       key,
+		Owner:     owner,
+		Method:    method,
+		Path:      path,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		return nil, nil
+	}
+
+	existing, err := s.idempotencyRepo.Find(ctx, owner, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// Released between the insert and the lookup, the caller may retry right away
+		return nil, NewServiceError(409, "a request with this Idempotency-Key is still in progress")
+	}
+	if existing.Method != method || existing.Path != path {
+		return nil, NewServiceError(422, fmt.Sprintf("Idempotency-Key was already used for %s %s", existing.Method, existing.Path))
+	}
+	if !existing.Completed() {
+		return nil, NewServiceError(409, "a request with this Idempotency-Key is still in progress")
+	}
+	return existing, nil
+}
+
+// Finish stores the response of a request begun with the key. Only accepted requests are
+// remembered, a refused one releases the key so it can be retried.
+func (s *IdempotencyService) Finish(ctx context.Context, owner, key string, statusCode int, response []byte) error {
+	if statusCode < 200 || statusCode >= 300 {
+		return s.idempotencyRepo.Delete(ctx, owner, key)
+	}
+
+	return s.idempotencyRepo.SaveResponse(ctx, &domain.IdempotencyKey{
+		Key:        key,
+		Owner:      owner,
+		StatusCode: statusCode,
+		Response:   response,
+		CommandID:  responseCommandID(response),
+	})
+}
+
+// responseCommandID returns the command_id an async response links to, if any
+func responseCommandID(response []byte) *string {
+	var body struct {
+		PID *string `json:"pid"`
+	}
+	if err := json.Unmarshal(response, &body); err != nil {
+		return nil
+	}
+	return body.PID
+}
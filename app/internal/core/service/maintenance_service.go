@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+type MaintenanceService struct {
+	maintenanceRepo repository.MaintenanceRepository
+	processRepo     repository.ProcessRepository
+}
+
+func NewMaintenanceService(maintenanceRepo repository.MaintenanceRepository, processRepo repository.ProcessRepository) *MaintenanceService {
+	return &MaintenanceService{
+		maintenanceRepo: maintenanceRepo,
+		processRepo:     processRepo,
+	}
+}
+
+// GetMaintenance returns the current maintenance-mode state
+func (s *MaintenanceService) GetMaintenance(ctx context.Context) (*domain.Maintenance, error) {
+	return s.maintenanceRepo.Get(ctx)
+}
+
+// SetMaintenance enables or disables maintenance mode
+func (s *MaintenanceService) SetMaintenance(ctx context.Context, enabled, blockManual bool, reason *string) (*domain.Maintenance, error) {
+	maintenance := &domain.Maintenance{
+		Enabled:     enabled,
+		BlockManual: blockManual,
+		Reason:      reason,
+		UpdatedAt:   time.Now(),
+	}
+	if !enabled {
+		maintenance.Reason = nil
+	}
+
+	if err := s.maintenanceRepo.Save(ctx, maintenance); err != nil {
+		return nil, err
+	}
+	return maintenance, nil
+}
+
+// SkipScheduled is called by the cron-triggered entry points. In maintenance mode it
+// records a skipped process for the run and returns it, otherwise it returns nil.
+func (s *MaintenanceService) SkipScheduled(ctx context.Context, processType domain.ProcessType, args map[string]interface{}) (*domain.Process, error) {
+	maintenance, err := s.maintenanceRepo.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !maintenance.Enabled {
+		return nil, nil
+	}
+
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	args["skip_reason"] = "maintenance"
+
+	process := domain.NewProcess("skipped: maintenance mode", processType, args)
+	process.Status = domain.ProcessStatusSkipped
+	process.EndTime = &process.StartTime
+	if maintenance.Reason != nil {
+		output := *maintenance.Reason
+		process.Output = &output
+	}
+
+	if err := s.processRepo.Create(ctx, process); err != nil {
+		return nil, fmt.Errorf("failed to record skipped run: %w", err)
+	}
+	return process, nil
+}
+
+// CheckManual returns a 503 ServiceError when maintenance mode blocks manual backups and restores
+func (s *MaintenanceService) CheckManual(ctx context.Context) error {
+	maintenance, err := s.maintenanceRepo.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if !maintenance.Enabled || !maintenance.BlockManual {
+		return nil
+	}
+
+	msg := "dbcalm is in maintenance mode, backups and restores are paused"
+	if maintenance.Reason != nil && *maintenance.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, *maintenance.Reason)
+	}
+	return NewServiceError(503, msg)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestSkipScheduledInMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		enabled       bool
+		expectSkipped bool
+	}{
+		{
+			name:          "maintenance mode records a skipped run",
+			enabled:       true,
+			expectSkipped: true,
+		},
+		{
+			name:    "scheduled runs proceed outside maintenance mode",
+			enabled: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			processRepo := sqlite.NewProcessRepository(db)
+			maintenanceService := NewMaintenanceService(sqlite.NewMaintenanceRepository(db), processRepo)
+			ctx := context.Background()
+
+			if _, err := maintenanceService.SetMaintenance(ctx, tt.enabled, true, ptr("kernel upgrade")); err != nil {
+				t.Fatalf("failed to set maintenance mode: %v", err)
+			}
+
+			process, err := maintenanceService.SkipScheduled(ctx, domain.ProcessTypeBackup, map[string]interface{}{"schedule_id": 3})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if (process != nil) != tt.expectSkipped {
+				t.Fatalf("expected skipped %v, got process %v", tt.expectSkipped, process)
+			}
+
+			var count int
+			if err := db.Get(&count, `SELECT COUNT(*) FROM process WHERE status = 'skipped'`); err != nil {
+				t.Fatalf("failed to count processes: %v", err)
+			}
+			expectedCount := 0
+			if tt.expectSkipped {
+				expectedCount = 1
+			}
+			if count != expectedCount {
+				t.Errorf("expected %d skipped process records, got %d", expectedCount, count)
+			}
+		})
+	}
+}
+
+func TestCheckManualInMaintenanceMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     bool
+		blockManual bool
+		expectError bool
+	}{
+		{name: "blocked", enabled: true, blockManual: true, expectError: true},
+		{name: "manual operations allowed", enabled: true, blockManual: false},
+		{name: "maintenance off", enabled: false, blockManual: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			maintenanceService := NewMaintenanceService(sqlite.NewMaintenanceRepository(db), sqlite.NewProcessRepository(db))
+			ctx := context.Background()
+
+			if _, err := maintenanceService.SetMaintenance(ctx, tt.enabled, tt.blockManual, nil); err != nil {
+				t.Fatalf("failed to set maintenance mode: %v", err)
+			}
+
+			err := maintenanceService.CheckManual(ctx)
+			if !tt.expectError {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			svcErr, ok := err.(*ServiceError)
+			if !ok || svcErr.Code != 503 {
+				t.Errorf("expected 503 service error, got %v", err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
@@ -37,6 +38,40 @@ func (s *ProcessService) CreateProcess(ctx context.Context, command string, proc
 	return process, nil
 }
 
+// RecordSkipped records a scheduled run that was skipped, finished as soon as it starts
+func (s *ProcessService) RecordSkipped(ctx context.Context, command string, processType domain.ProcessType, args map[string]interface{}) (*domain.Process, error) {
+	process := domain.NewProcess(command, processType, args)
+	process.Status = domain.ProcessStatusSkipped
+	process.EndTime = &process.StartTime
+
+	if err := s.processRepo.Create(ctx, process); err != nil {
+		return nil, fmt.Errorf("failed to record skipped run: %w", err)
+	}
+
+	return process, nil
+}
+
+// RecordResult adds result values to the args of a finished process, for work that
+// completes after the process itself, such as deleting catalog records
+func (s *ProcessService) RecordResult(ctx context.Context, commandID string, result map[string]interface{}) error {
+	process, err := s.processRepo.FindByCommandID(ctx, commandID)
+	if err != nil {
+		return fmt.Errorf("failed to find process %s: %w", commandID, err)
+	}
+
+	if process.Args == nil {
+		process.Args = make(map[string]interface{})
+	}
+	for key, value := range result {
+		process.Args[key] = value
+	}
+
+	if err := s.processRepo.Update(ctx, process); err != nil {
+		return fmt.Errorf("failed to record result of process %s: %w", commandID, err)
+	}
+	return nil
+}
+
 // GetProcess retrieves a process by ID
 func (s *ProcessService) GetProcess(ctx context.Context, id int64) (*domain.Process, error) {
 	return s.processRepo.FindByID(ctx, id)
@@ -57,3 +92,24 @@ func (s *ProcessService) CountProcesses(ctx context.Context, filter repository.P
 	return s.processRepo.Count(ctx, filter)
 }
 
+// LastScheduledRun returns the latest backup process a schedule started, including
+// skipped runs, or nil when it has not run yet
+func (s *ProcessService) LastScheduledRun(ctx context.Context, scheduleID int64) (*domain.Process, error) {
+	processes, err := s.processRepo.List(ctx, repository.ProcessFilter{
+		ListFilter: util.ListFilter{
+			Filters: []util.QueryFilter{
+				{Field: "schedule_id", Operator: util.OpEq, Value: scheduleID},
+				{Field: "type", Operator: util.OpEq, Value: string(domain.ProcessTypeBackup)},
+			},
+			Order:   []util.OrderClause{{Field: "start_time", Direction: util.OrderDesc}},
+			PerPage: 1,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last run of schedule %d: %w", scheduleID, err)
+	}
+	if len(processes) == 0 {
+		return nil, nil
+	}
+	return processes[0], nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// ProcessUsageService reports the live CPU, memory and IO usage of running processes.
+// The API can't read another user's /proc/<pid>/io, so db-cmd reads it.
+type ProcessUsageService struct {
+	processRepo repository.ProcessRepository
+	dbClient    *dbcmd.Client
+}
+
+func NewProcessUsageService(processRepo repository.ProcessRepository, dbClient *dbcmd.Client) *ProcessUsageService {
+	return &ProcessUsageService{
+		processRepo: processRepo,
+		dbClient:    dbClient,
+	}
+}
+
+// Usage returns the usage of the process with commandID. A process that doesn't exist,
+// isn't running or isn't run by db-cmd is a 404.
+func (s *ProcessUsageService) Usage(ctx context.Context, commandID string) (*domain.ProcessUsage, error) {
+	process, err := s.processRepo.FindByCommandID(ctx, commandID)
+	if err != nil {
+		return nil, NewServiceError(404, fmt.Sprintf("Process not found: %s", commandID))
+	}
+	if process.Status != domain.ProcessStatusRunning || process.PID == nil || *process.PID <= 0 {
+		return nil, NewServiceError(404, fmt.Sprintf("Process %s is not running", commandID))
+	}
+	if !process.UsageTracked() {
+		return nil, NewServiceError(404, fmt.Sprintf("Usage of %s processes is not tracked", process.Type))
+	}
+
+	response, err := s.dbClient.SendCommand(ctx, "process_usage", map[string]interface{}{
+		"pid":     *process.PID,
+		"command": process.Command,
+	})
+	if err != nil {
+		return nil, NewServiceError(503, fmt.Sprintf("cannot read process usage, db-cmd service is unreachable: %v", err))
+	}
+	if response.Code == 404 {
+		return nil, NewServiceError(404, fmt.Sprintf("Process %s is not running", commandID))
+	}
+	if response.Code != 200 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return nil, NewServiceError(503, fmt.Sprintf("cannot read process usage: %s", errMsg))
+	}
+
+	number := func(key string) float64 {
+		value, _ := response.Data[key].(float64)
+		return value
+	}
+	usage := &domain.ProcessUsage{
+		PID:                int(number("pid")),
+		Threads:            int(number("threads")),
+		ElapsedSeconds:     number("elapsed_seconds"),
+		CPUUserSeconds:     number("cpu_user_seconds"),
+		CPUSystemSeconds:   number("cpu_system_seconds"),
+		BlockIOWaitSeconds: number("block_io_wait_seconds"),
+		RSSBytes:           int64(number("rss_bytes")),
+		ReadBytes:          int64(number("read_bytes")),
+		WriteBytes:         int64(number("write_bytes")),
+	}
+	usage.State, _ = response.Data["state"].(string)
+	return usage, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestProcessUsage(t *testing.T) {
+	// db-cmd finds pid 4242 running, every other pid has exited
+	socket := newFakeSocket(t, func(req socketRequest) socketResponse {
+		if req.Args["pid"] != float64(4242) {
+			return socketResponse{Code: 404, Status: "Not Found", Message: "process is not running"}
+		}
+		return socketResponse{Code: 200, Status: "OK", Data: map[string]interface{}{
+			"pid":                   4242,
+			"state":                 "D",
+			"threads":               4,
+			"elapsed_seconds":       120.5,
+			"cpu_user_seconds":      10.25,
+			"cpu_system_seconds":    4.5,
+			"block_io_wait_seconds": 90,
+			"rss_bytes":             52428800,
+			"read_bytes":            1073741824,
+			"write_bytes":           536870912,
+		}}
+	})
+
+	db := newTestDB(t)
+	seed := func(commandID string, pid int, status, processType string) {
+		_, err := db.Exec(`
+			INSERT INTO process (command_id, command, pid, status, start_time, type, args)
+			VALUES (?, 'mariabackup --backup', ?, ?, ?, ?, '{}')
+		`, commandID, pid, status, time.Now(), processType)
+		if err != nil {
+			t.Fatalf("failed to seed process: %v", err)
+		}
+	}
+	seed("running", 4242, "running", "backup")
+	seed("exited", 4343, "running", "backup")
+	seed("finished", 4444, "success", "backup")
+	seed("cleanup", 4545, "running", "cleanup_backups")
+
+	usageService := NewProcessUsageService(sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+
+	usage, err := usageService.Usage(context.Background(), "running")
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.PID != 4242 || usage.State != "D" || usage.Threads != 4 || usage.BlockIOWaitSeconds != 90 {
+		t.Errorf("expected the usage of pid 4242, got %+v", usage)
+	}
+	if usage.ReadBytes != 1073741824 || usage.WriteBytes != 536870912 || usage.RSSBytes != 52428800 {
+		t.Errorf("expected the IO and memory totals, got %+v", usage)
+	}
+	if args := socket.request(t, "process_usage").Args; args["command"] != "mariabackup --backup" {
+		t.Errorf("expected the command to be sent to match the pid against, got %v", args)
+	}
+
+	for _, commandID := range []string{"exited", "finished", "cleanup", "missing"} {
+		_, err := usageService.Usage(context.Background(), commandID)
+		var svcErr *ServiceError
+		if !errors.As(err, &svcErr) || svcErr.Code != 404 {
+			t.Errorf("%s: expected a 404, got %v", commandID, err)
+		}
+	}
+	// Only the first two reached db-cmd, the others were refused from the catalog
+	if sent := len(socket.commands()); sent != 2 {
+		t.Errorf("expected 2 requests to db-cmd, got %d", sent)
+	}
+}
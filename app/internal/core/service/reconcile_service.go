@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// orphanGracePeriod is how long a backup file has to be left alone before it counts as
+// an orphan, and a backup row before its missing file counts. A backup's process finishes
+// before db-cmd records the backup, so a file that was just written may still get its
+// catalog row, and a consolidation renames the files of a backup it just recorded.
+const orphanGracePeriod = 15 * time.Minute
+
+// ReconcileService periodically compares the catalog with the backups in backup_dir, so
+// the two can't drift apart unnoticed. db-cmd lists backup_dir, as it owns the backups
+// and knows which of them are streamed elsewhere.
+type ReconcileService struct {
+	backupRepo  repository.BackupRepository
+	processRepo repository.ProcessRepository
+	dbClient    *dbcmd.Client
+	cmdClient   *cmd.Client
+	interval    time.Duration // Zero disables the periodic check
+	policy      domain.OrphanBackupPolicy
+	webhook     string // Notified of new drift under the alert policy
+	client      *http.Client
+
+	// reported is the drift already logged or alerted, so an unchanged drift isn't
+	// reported again every interval
+	reported map[string]bool
+	// missing is the backups found missing by the previous run. Only a backup missing on
+	// two runs in a row has its row removed, a file can be briefly gone while it is moved.
+	missing map[string]bool
+	stop    chan struct{}
+}
+
+func NewReconcileService(
+	backupRepo repository.BackupRepository,
+	processRepo repository.ProcessRepository,
+	dbClient *dbcmd.Client,
+	cmdClient *cmd.Client,
+	interval time.Duration,
+	policy domain.OrphanBackupPolicy,
+	webhook string,
+) *ReconcileService {
+	return &ReconcileService{
+		backupRepo:  backupRepo,
+		processRepo: processRepo,
+		dbClient:    dbClient,
+		cmdClient:   cmdClient,
+		interval:    interval,
+		policy:      policy,
+		webhook:     webhook,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		reported:    make(map[string]bool),
+		missing:     make(map[string]bool),
+	}
+}
+
+// Start reconciles every interval until Stop is called
+func (s *ReconcileService) Start() {
+	if s.interval <= 0 || s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if _, err := s.Reconcile(context.Background(), now); err != nil {
+					log.Printf("Warning: backup reconciliation failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+}
+
+// Stop ends the periodic check
+func (s *ReconcileService) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+// Reconcile finds the drift between the catalog and backup_dir and handles it per the
+// policy. It returns the drift found, before it was handled.
+func (s *ReconcileService) Reconcile(ctx context.Context, now time.Time) (*domain.BackupDrift, error) {
+	drift, err := s.findDrift(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	missingBefore := s.missing
+	s.missing = make(map[string]bool, len(drift.Missing))
+	for _, backup := range drift.Missing {
+		s.missing[backup.ID] = true
+	}
+
+	switch s.policy {
+	case domain.OrphanBackupImport:
+		remaining := s.importOrphans(ctx, drift.Orphans)
+		s.report(&domain.BackupDrift{Orphans: remaining, Missing: drift.Missing}, false)
+	case domain.OrphanBackupRemove:
+		s.removeDrift(ctx, drift, missingBefore)
+	case domain.OrphanBackupAlert:
+		s.report(drift, true)
+	default:
+		s.report(drift, false)
+	}
+
+	return drift, nil
+}
+
+// findDrift lists backup_dir through db-cmd and compares it with the catalog. Backups
+// that are being taken or consolidated, and files and rows written within the grace
+// period, are left out, as their catalog rows or files may not be in place yet.
+func (s *ReconcileService) findDrift(ctx context.Context, now time.Time) (*domain.BackupDrift, error) {
+	files, forwarded, err := s.listBackupFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backups, err := s.backupRepo.List(ctx, repository.BackupFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	running, err := s.processRepo.FindRunning(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find running processes: %w", err)
+	}
+
+	busy := make(map[string]bool)
+	for _, process := range running {
+		if process.Type != domain.ProcessTypeBackup && process.Type != domain.ProcessTypeConsolidateBackup {
+			continue
+		}
+		if id := process.ResourceID(); id != nil {
+			busy[*id] = true
+		}
+		// A consolidation replaces the files of the chain it merges
+		if ids, ok := process.Args["id_list"].([]interface{}); ok {
+			for _, id := range ids {
+				if id, ok := id.(string); ok {
+					busy[id] = true
+				}
+			}
+		}
+	}
+
+	inCatalog := make(map[string]bool, len(backups))
+	for _, backup := range backups {
+		inCatalog[backup.ID] = true
+	}
+	onDisk := make(map[string]bool, len(files))
+	drift := &domain.BackupDrift{}
+	for _, file := range files {
+		onDisk[file.ID] = true
+		if inCatalog[file.ID] || busy[file.ID] || now.Sub(file.ModifiedAt) < orphanGracePeriod {
+			continue
+		}
+		drift.Orphans = append(drift.Orphans, file)
+	}
+
+	// Forwarded streams never land in backup_dir, so a missing file says nothing
+	if !forwarded {
+		for _, backup := range backups {
+			recorded := backup.StartTime
+			if backup.EndTime != nil {
+				recorded = *backup.EndTime
+			}
+			if onDisk[backup.ID] || busy[backup.ID] || now.Sub(recorded) < orphanGracePeriod {
+				continue
+			}
+			drift.Missing = append(drift.Missing, backup)
+		}
+	}
+
+	return drift, nil
+}
+
+// listBackupFiles asks db-cmd for the backups in backup_dir. forwarded reports whether
+// streams are forwarded to another host instead of written to backup_dir.
+func (s *ReconcileService) listBackupFiles(ctx context.Context) (files []domain.BackupFile, forwarded bool, err error) {
+	response, err := s.dbClient.SendCommand(ctx, "list_backup_files", map[string]interface{}{})
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot list backup files, db-cmd service is unreachable: %w", err)
+	}
+	if response.Code != 200 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return nil, false, fmt.Errorf("cannot list backup files: %s", errMsg)
+	}
+
+	forwarded, _ = response.Data["forwarded"].(bool)
+	entries, _ := response.Data["backups"].([]interface{})
+	for _, raw := range entries {
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text := func(key string) string {
+			value, _ := entry[key].(string)
+			return value
+		}
+		file := domain.BackupFile{
+			ID:       text("id"),
+			Path:     text("path"),
+			Kind:     text("kind"),
+			Type:     domain.BackupType(text("type")),
+			Strategy: domain.BackupStrategy(text("strategy")),
+		}
+		if from := text("from_backup_id"); from != "" {
+			file.FromBackupID = &from
+		}
+		file.ModifiedAt, _ = time.Parse(time.RFC3339, text("modified_at"))
+		if file.ID == "" {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, forwarded, nil
+}
+
+// importOrphans adds catalog rows for orphan backups whose type can be told, bases
+// first. Each import is recorded as a finished backup process, which the row refers to.
+// It returns the orphans it couldn't import.
+func (s *ReconcileService) importOrphans(ctx context.Context, orphans []domain.BackupFile) []domain.BackupFile {
+	var failed []domain.BackupFile
+	imported := make(map[string]bool)
+	pending := orphans
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		var waiting []domain.BackupFile
+		for _, file := range pending {
+			if file.Type == domain.BackupTypeIncremental && (file.FromBackupID == nil || !s.known(ctx, *file.FromBackupID, imported)) {
+				waiting = append(waiting, file)
+				continue
+			}
+			if file.Type != domain.BackupTypeFull && file.Type != domain.BackupTypeIncremental {
+				failed = append(failed, file)
+				continue
+			}
+			if err := s.importBackup(ctx, file); err != nil {
+				log.Printf("Warning: failed to import orphan backup %s: %v", file.ID, err)
+				failed = append(failed, file)
+				continue
+			}
+			log.Printf("Imported orphan %s backup %s from %s", file.Type, file.ID, file.Path)
+			imported[file.ID] = true
+			progress = true
+		}
+		pending = waiting
+	}
+
+	// Streams can't be told apart without unpacking them, and an incremental whose base
+	// is gone can't be restored
+	return append(failed, pending...)
+}
+
+// known reports whether id is in the catalog or was just imported
+func (s *ReconcileService) known(ctx context.Context, id string, imported map[string]bool) bool {
+	if imported[id] {
+		return true
+	}
+	_, err := s.backupRepo.FindByID(ctx, id)
+	return err == nil
+}
+
+func (s *ReconcileService) importBackup(ctx context.Context, file domain.BackupFile) error {
+	process := domain.NewProcess("import: "+file.Path, domain.ProcessTypeBackup, map[string]interface{}{
+		"id":       file.ID,
+		"type":     string(file.Type),
+		"imported": true,
+	})
+	process.Status = domain.ProcessStatusSuccess
+	process.StartTime = file.ModifiedAt
+	process.EndTime = &file.ModifiedAt
+	if err := s.processRepo.Create(ctx, process); err != nil {
+		return fmt.Errorf("failed to record import: %w", err)
+	}
+
+	backup := domain.NewBackup(file.ID, file.Type, process.ID)
+	backup.FromBackupID = file.FromBackupID
+	if file.Strategy != "" {
+		backup.Strategy = file.Strategy
+	}
+	backup.StartTime = file.ModifiedAt
+	backup.EndTime = &file.ModifiedAt
+	return s.backupRepo.Create(ctx, backup)
+}
+
+// removeDrift deletes orphan files through the cmd service and the catalog rows of
+// backups whose files were already gone on the previous run, missingBefore. The catalog
+// removes incrementals along with their base, so a row other rows still build on is kept.
+func (s *ReconcileService) removeDrift(ctx context.Context, drift *domain.BackupDrift, missingBefore map[string]bool) {
+	if len(drift.Orphans) > 0 {
+		backupIDs := make([]string, 0, len(drift.Orphans))
+		paths := make([]string, 0, len(drift.Orphans))
+		for _, file := range drift.Orphans {
+			backupIDs = append(backupIDs, file.ID)
+			paths = append(paths, file.Path)
+		}
+		response, err := s.cmdClient.SendCommand(ctx, "cleanup_backups", map[string]interface{}{
+			"backup_ids": backupIDs,
+			"folders":    paths,
+		})
+		if err != nil {
+			log.Printf("Warning: failed to remove orphan backups %v: %v", backupIDs, err)
+		} else if response.Code != 202 {
+			log.Printf("Warning: failed to remove orphan backups %v: %s", backupIDs, response.Status)
+		} else {
+			log.Printf("Removing orphan backups %v, cleanup %s", backupIDs, response.ID)
+		}
+	}
+
+	removable := make(map[string]bool)
+	for _, backup := range drift.Missing {
+		if missingBefore[backup.ID] {
+			removable[backup.ID] = true
+		}
+	}
+	if len(removable) == 0 {
+		return
+	}
+
+	backups, err := s.backupRepo.List(ctx, repository.BackupFilter{})
+	if err != nil {
+		log.Printf("Warning: failed to list backups, keeping the rows of missing backups: %v", err)
+		return
+	}
+	// Keep every row an incremental that stays builds on, down the chain
+	for changed := true; changed; {
+		changed = false
+		for _, backup := range backups {
+			if removable[backup.ID] || backup.FromBackupID == nil || !removable[*backup.FromBackupID] {
+				continue
+			}
+			log.Printf("Warning: backup %s is missing from backup_dir but incremental %s builds on it, keeping its catalog row", *backup.FromBackupID, backup.ID)
+			delete(removable, *backup.FromBackupID)
+			changed = true
+		}
+	}
+
+	var ids []string
+	for _, backup := range drift.Missing {
+		if removable[backup.ID] {
+			ids = append(ids, backup.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.backupRepo.DeleteMany(ctx, ids); err != nil {
+		log.Printf("Warning: failed to delete catalog rows of missing backups %v: %v", ids, err)
+	} else {
+		log.Printf("Deleted catalog rows of backups missing from backup_dir: %v", ids)
+	}
+}
+
+// report logs the drift not reported before and, when alert is set, posts it to the
+// webhook
+func (s *ReconcileService) report(drift *domain.BackupDrift, alert bool) {
+	current := make(map[string]bool)
+	var orphans, missing []string
+	for _, file := range drift.Orphans {
+		key := "orphan:" + file.ID
+		current[key] = true
+		if !s.reported[key] {
+			orphans = append(orphans, file.ID)
+			log.Printf("Warning: backup %s in %s has no catalog row", file.ID, file.Path)
+		}
+	}
+	for _, backup := range drift.Missing {
+		key := "missing:" + backup.ID
+		current[key] = true
+		if !s.reported[key] {
+			missing = append(missing, backup.ID)
+			log.Printf("Warning: backup %s is in the catalog but not in backup_dir", backup.ID)
+		}
+	}
+	s.reported = current
+
+	if !alert || (len(orphans) == 0 && len(missing) == 0) {
+		return
+	}
+	if err := s.notify(orphans, missing); err != nil {
+		log.Printf("Warning: failed to send backup drift notification: %v", err)
+	}
+}
+
+// notify posts newly found drift to the webhook
+func (s *ReconcileService) notify(orphans, missing []string) error {
+	if s.webhook == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event":           "backup_drift",
+		"orphan_backups":  orphans,
+		"missing_backups": missing,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	resp, err := s.client.Post(s.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/api/util"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestReconcileHandlesOrphansPerPolicy(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour).UTC().Format(time.RFC3339)
+	listing := func(req socketRequest) socketResponse {
+		if req.Cmd != "list_backup_files" {
+			return acceptAll(req)
+		}
+		return socketResponse{
+			Code:   200,
+			Status: "OK",
+			Data: map[string]interface{}{
+				"forwarded": false,
+				"backups": []interface{}{
+					map[string]interface{}{"id": "known", "path": "/backups/known", "kind": "folder", "type": "full", "strategy": "physical", "modified_at": old},
+					map[string]interface{}{"id": "orphan-full", "path": "/backups/orphan-full", "kind": "folder", "type": "full", "strategy": "physical", "modified_at": old},
+					map[string]interface{}{"id": "orphan-incr", "path": "/backups/orphan-incr", "kind": "folder", "type": "incremental", "strategy": "physical", "from_backup_id": "orphan-full", "modified_at": old},
+					// Still within the grace period, its catalog row may be on its way
+					map[string]interface{}{"id": "fresh", "path": "/backups/fresh", "kind": "folder", "type": "full", "strategy": "physical", "modified_at": now.UTC().Format(time.RFC3339)},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		policy          domain.OrphanBackupPolicy
+		expectedCatalog []string
+		expectedRemoved []interface{}
+	}{
+		{policy: domain.OrphanBackupLog, expectedCatalog: []string{"gone", "known"}},
+		{policy: domain.OrphanBackupImport, expectedCatalog: []string{"gone", "known", "orphan-full", "orphan-incr"}},
+		{policy: domain.OrphanBackupRemove, expectedCatalog: []string{"known"}, expectedRemoved: []interface{}{"/backups/orphan-full", "/backups/orphan-incr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			db := newTestDB(t)
+			seedBackup(t, db, "known", nil, nil, now.Add(-2*time.Hour))
+			seedBackup(t, db, "gone", nil, nil, now.Add(-2*time.Hour))
+
+			dbSocket := newFakeSocket(t, listing)
+			cmdSocket := newFakeSocket(t, nil)
+			backupRepo := sqlite.NewBackupRepository(db)
+			reconcileService := NewReconcileService(
+				backupRepo,
+				sqlite.NewProcessRepository(db),
+				dbcmd.NewClient(dbSocket.path, time.Second),
+				cmd.NewClient(cmdSocket.path, time.Second),
+				time.Hour,
+				tt.policy,
+				"",
+			)
+
+			drift, err := reconcileService.Reconcile(context.Background(), now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var orphans []string
+			for _, file := range drift.Orphans {
+				orphans = append(orphans, file.ID)
+			}
+			if !reflect.DeepEqual(orphans, []string{"orphan-full", "orphan-incr"}) {
+				t.Errorf("expected the orphans to be detected, got %v", orphans)
+			}
+			if len(drift.Missing) != 1 || drift.Missing[0].ID != "gone" {
+				t.Errorf("expected the backup without files to be detected, got %v", drift.Missing)
+			}
+
+			// A missing backup's row is only removed once it is missing on the next run too
+			if tt.policy == domain.OrphanBackupRemove {
+				if _, err := backupRepo.FindByID(context.Background(), "gone"); err != nil {
+					t.Errorf("expected the missing backup to be kept after one run, got %v", err)
+				}
+				if _, err := reconcileService.Reconcile(context.Background(), now.Add(time.Hour)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			backups, err := backupRepo.List(context.Background(), repository.BackupFilter{
+				ListFilter: util.ListFilter{Order: []util.OrderClause{{Field: "id", Direction: util.OrderAsc}}},
+			})
+			if err != nil {
+				t.Fatalf("failed to list backups: %v", err)
+			}
+			var catalog []string
+			for _, backup := range backups {
+				catalog = append(catalog, backup.ID)
+			}
+			if !reflect.DeepEqual(catalog, tt.expectedCatalog) {
+				t.Errorf("expected catalog %v, got %v", tt.expectedCatalog, catalog)
+			}
+
+			if tt.policy == domain.OrphanBackupImport {
+				imported, err := backupRepo.FindByID(context.Background(), "orphan-incr")
+				if err != nil {
+					t.Fatalf("failed to find imported backup: %v", err)
+				}
+				if imported.Type != domain.BackupTypeIncremental || imported.FromBackupID == nil || *imported.FromBackupID != "orphan-full" {
+					t.Errorf("expected an incremental based on orphan-full, got %s from %v", imported.Type, imported.FromBackupID)
+				}
+			}
+
+			if tt.expectedRemoved == nil {
+				if len(cmdSocket.commands()) != 0 {
+					t.Errorf("expected no files to be removed, got %v", cmdSocket.commands())
+				}
+				return
+			}
+			folders := cmdSocket.request(t, "cleanup_backups").Args["folders"]
+			if !reflect.DeepEqual(folders, tt.expectedRemoved) {
+				t.Errorf("expected %v to be removed, got %v", tt.expectedRemoved, folders)
+			}
+		})
+	}
+}
+
+func TestReconcileKeepsMissingBackupsInUse(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-time.Hour).UTC().Format(time.RFC3339)
+	listing := func(req socketRequest) socketResponse {
+		if req.Cmd != "list_backup_files" {
+			return acceptAll(req)
+		}
+		return socketResponse{
+			Code:   200,
+			Status: "OK",
+			Data: map[string]interface{}{
+				"forwarded": false,
+				"backups": []interface{}{
+					map[string]interface{}{"id": "incr", "path": "/backups/incr", "kind": "folder", "type": "incremental", "strategy": "physical", "from_backup_id": "base", "modified_at": old},
+				},
+			},
+		}
+	}
+
+	db := newTestDB(t)
+	// The base of an incremental that is still there
+	seedBackup(t, db, "base", nil, nil, now.Add(-2*time.Hour))
+	seedBackup(t, db, "incr", ptr("base"), nil, now.Add(-2*time.Hour))
+	// Recorded within the grace period
+	seedBackup(t, db, "recent", nil, nil, now.Add(-12*time.Minute))
+	// Being consolidated
+	seedBackup(t, db, "merging", nil, nil, now.Add(-2*time.Hour))
+	if _, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, type, args)
+		VALUES ('consolidate-1', 'mariabackup --prepare', 0, 'running', ?, 'consolidate_backup', '{"id":"consolidated","id_list":["merging"]}')
+	`, now.Format(time.RFC3339)); err != nil {
+		t.Fatalf("failed to seed consolidation: %v", err)
+	}
+
+	backupRepo := sqlite.NewBackupRepository(db)
+	reconcileService := NewReconcileService(
+		backupRepo,
+		sqlite.NewProcessRepository(db),
+		dbcmd.NewClient(newFakeSocket(t, listing).path, time.Second),
+		cmd.NewClient(newFakeSocket(t, nil).path, time.Second),
+		time.Hour,
+		domain.OrphanBackupRemove,
+		"",
+	)
+
+	var drift *domain.BackupDrift
+	for run := 0; run < 2; run++ {
+		var err error
+		if drift, err = reconcileService.Reconcile(context.Background(), now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(drift.Missing) != 1 || drift.Missing[0].ID != "base" {
+		t.Errorf("expected only base to be missing, got %v", drift.Missing)
+	}
+	for _, id := range []string{"base", "incr", "recent", "merging"} {
+		if _, err := backupRepo.FindByID(context.Background(), id); err != nil {
+			t.Errorf("expected the row of %s to be kept, got %v", id, err)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
@@ -12,41 +15,98 @@ import (
 type RestoreService struct {
 	restoreRepo repository.RestoreRepository
 	backupRepo  repository.BackupRepository
+	processRepo repository.ProcessRepository
 	dbClient    *dbcmd.Client
 }
 
 func NewRestoreService(
 	restoreRepo repository.RestoreRepository,
 	backupRepo repository.BackupRepository,
+	processRepo repository.ProcessRepository,
 	dbClient *dbcmd.Client,
 ) *RestoreService {
 	return &RestoreService{
 		restoreRepo: restoreRepo,
 		backupRepo:  backupRepo,
+		processRepo: processRepo,
 		dbClient:    dbClient,
 	}
 }
 
 // RestoreToDatabase restores a backup to the MySQL data directory
 // Following Python's lean approach: validate, get backup chain, pass to db-cmd, return immediately
-func (s *RestoreService) RestoreToDatabase(ctx context.Context, backupID string) (*domain.Process, error) {
+// Logical mode replays the backup's SQL dump into the running server instead, limited to
+// databases when given. Grants mode only applies the users and grants captured with the
+// backup, whatever its strategy.
+func (s *RestoreService) RestoreToDatabase(ctx context.Context, backupID string, mode domain.RestoreMode, databases []string) (*domain.Process, error) {
 	// Get backup chain (for incrementals) - returns list from oldest (full) to newest
 	chain, err := s.backupRepo.FindChain(ctx, backupID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get backup chain: %w", err)
 	}
+	// db-cmd applies the incrementals in id_list order, so the links have to hold
+	if err := validateChainLinks(chain, backupID); err != nil {
+		return nil, NewServiceError(409, err.Error())
+	}
+
+	// Dumps cannot be applied incrementally, so a logical restore needs a single full backup
+	if mode == domain.RestoreModeLogical && len(chain) > 1 {
+		return nil, NewServiceError(400, "logical restore requires a full backup, incremental chains can only be restored physically")
+	}
+
+	// The restore mode has to match how the backup was taken
+	if len(chain) > 0 && mode != domain.RestoreModeGrants {
+		root := chain[0]
+		if root.Strategy == domain.BackupStrategyLogical && mode != domain.RestoreModeLogical {
+			return nil, NewServiceError(400, fmt.Sprintf("backup %s is a logical dump, restore it with restore_mode logical", root.ID))
+		}
+		if root.Strategy != domain.BackupStrategyLogical && mode == domain.RestoreModeLogical {
+			return nil, NewServiceError(400, fmt.Sprintf("backup %s is a physical backup and has no dump to replay", root.ID))
+		}
+	}
+
+	// Copying back replaces the whole data dir, a selection only works on a replayed dump
+	if len(databases) > 0 && mode != domain.RestoreModeLogical {
+		return nil, NewServiceError(400, "only logical restores to the database can be limited to databases, restore a physical backup to a folder instead")
+	}
+	if err := validateRestoreDatabases(chain, databases); err != nil {
+		return nil, err
+	}
+
+	if err := s.requireNoRunningBackup(ctx); err != nil {
+		return nil, err
+	}
+
+	serverInfo, err := requireServerInfo(ctx, s.dbClient)
+	if err != nil {
+		return nil, err
+	}
+	if (mode == domain.RestoreModeLogical || mode == domain.RestoreModeGrants) && !serverInfo.ClientAvailable {
+		return nil, NewServiceError(503, fmt.Sprintf("cannot run %s restore, the mariadb/mysql client is not installed", mode))
+	}
 
 	// Build list of backup IDs for db-cmd service (matching Python's id_list)
 	idList := make([]string, len(chain))
 	for i, backup := range chain {
 		idList[i] = backup.ID
 	}
+	// The grants are captured with each backup, the rest of the chain isn't needed
+	if mode == domain.RestoreModeGrants {
+		if !chain[len(chain)-1].GrantsCaptured {
+			return nil, NewServiceError(400, fmt.Sprintf("backup %s has no captured grants, it was taken without capture_grants", backupID))
+		}
+		idList = []string{backupID}
+	}
 
 	// Send command to db-cmd service - it handles all the heavy lifting
 	// (temp dirs, preparation, applying incrementals, cleanup, process updates, restore records)
 	restoreArgs := map[string]interface{}{
-		"id_list": idList,
-		"target":  "database",
+		"id_list":      idList,
+		"target":       "database",
+		"restore_mode": string(mode),
+	}
+	if len(databases) > 0 {
+		restoreArgs["databases"] = databases
 	}
 
 	resp, err := s.dbClient.SendCommand(ctx, "restore_backup", restoreArgs)
@@ -71,18 +131,60 @@ func (s *RestoreService) RestoreToDatabase(ctx context.Context, backupID string)
 		CommandID: resp.ID,
 		Status:    domain.ProcessStatus(resp.Status),
 	}
+	process.Args = restoreMetadata(chain, databases)
+	if warning := sourceWarning(chain, serverInfo); warning != "" {
+		log.Printf("Warning: %s", warning)
+		if process.Args == nil {
+			process.Args = map[string]interface{}{}
+		}
+		process.Args["warning"] = warning
+	}
 
 	return process, nil
 }
 
+// sourceWarning explains why restoring the chain onto the server deserves a second look:
+// a backup taken on a replica may lag behind the primary it is restored onto, or carry
+// replica-only settings. Empty when the roles aren't configured or don't clash.
+func sourceWarning(chain []*domain.Backup, serverInfo *domain.ServerInfo) string {
+	if len(chain) == 0 || serverInfo.Source != domain.BackupSourcePrimary {
+		return ""
+	}
+	latest := chain[len(chain)-1]
+	if latest.Source == nil || *latest.Source != domain.BackupSourceReplica {
+		return ""
+	}
+	return fmt.Sprintf("backup %s was taken on a replica and is being restored onto a primary, it may lag behind the primary's data", latest.ID)
+}
+
 // RestoreToFolder restores a backup to a folder for inspection
 // Following Python's lean approach: validate, get backup chain, pass to db-cmd, return immediately
-func (s *RestoreService) RestoreToFolder(ctx context.Context, backupID string) (*domain.Process, error) {
+// An empty targetPath leaves the folder to db-cmd, which restores under backup_dir/restores.
+// With databases given, only their directories are kept in the prepared folder. Without
+// record the restore runs as a process but leaves no restore record. With archive the
+// prepared folder is packed into a tar.zst archive, which the restore record points to.
+func (s *RestoreService) RestoreToFolder(ctx context.Context, backupID, targetPath string, databases []string, record, archive bool) (*domain.Process, error) {
 	// Get backup chain (for incrementals) - returns list from oldest (full) to newest
 	chain, err := s.backupRepo.FindChain(ctx, backupID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get backup chain: %w", err)
 	}
+	// db-cmd applies the incrementals in id_list order, so the links have to hold
+	if err := validateChainLinks(chain, backupID); err != nil {
+		return nil, NewServiceError(409, err.Error())
+	}
+
+	// Folder restores prepare a data directory, which a SQL dump doesn't have
+	if len(chain) > 0 && chain[0].Strategy == domain.BackupStrategyLogical {
+		return nil, NewServiceError(400, fmt.Sprintf("backup %s is a logical dump and can only be restored to the database", chain[0].ID))
+	}
+	if err := validateRestoreDatabases(chain, databases); err != nil {
+		return nil, err
+	}
+
+	if _, err := requireServerInfo(ctx, s.dbClient); err != nil {
+		return nil, err
+	}
 
 	// Build list of backup IDs for db-cmd service (matching Python's id_list)
 	idList := make([]string, len(chain))
@@ -96,6 +198,18 @@ func (s *RestoreService) RestoreToFolder(ctx context.Context, backupID string) (
 		"id_list": idList,
 		"target":  "folder",
 	}
+	if targetPath != "" {
+		restoreArgs["target_path"] = targetPath
+	}
+	if len(databases) > 0 {
+		restoreArgs["databases"] = databases
+	}
+	if !record {
+		restoreArgs["record"] = false
+	}
+	if archive {
+		restoreArgs["archive"] = true
+	}
 
 	resp, err := s.dbClient.SendCommand(ctx, "restore_backup", restoreArgs)
 	if err != nil {
@@ -119,10 +233,127 @@ func (s *RestoreService) RestoreToFolder(ctx context.Context, backupID string) (
 		CommandID: resp.ID,
 		Status:    domain.ProcessStatus(resp.Status),
 	}
+	process.Args = restoreMetadata(chain, databases)
 
 	return process, nil
 }
 
+// requireNoRunningBackup refuses a database restore while a backup is reading the data
+// the restore replaces, which would leave both the backup and the restored data corrupt
+func (s *RestoreService) requireNoRunningBackup(ctx context.Context) error {
+	running, err := s.processRepo.FindRunning(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check running processes: %w", err)
+	}
+	for _, process := range running {
+		if process.Type == domain.ProcessTypeBackup {
+			return NewServiceError(409, fmt.Sprintf("cannot restore the database while backup process %s is running", process.CommandID))
+		}
+	}
+	return nil
+}
+
+// validateRestoreDatabases checks a database selection holds valid names the chain
+// didn't leave out. db-cmd checks the databases are actually in the backup.
+func validateRestoreDatabases(chain []*domain.Backup, databases []string) error {
+	if err := domain.ValidateDatabaseNames(databases); err != nil {
+		return NewServiceError(400, err.Error())
+	}
+
+	excluded := excludedDatabases(chain)
+	for _, name := range databases {
+		for _, left := range excluded {
+			if name == left {
+				return NewServiceError(400, fmt.Sprintf("database %s was excluded from the backup and can't be restored", name))
+			}
+		}
+	}
+	return nil
+}
+
+// restoreMetadata describes what a restore of the chain brings back: the point in time
+// of the data, the databases missing from it and the databases it was limited to
+func restoreMetadata(chain []*domain.Backup, databases []string) map[string]interface{} {
+	metadata := map[string]interface{}{}
+	if timestamp := backupTimestamp(chain); timestamp != nil {
+		metadata["backup_timestamp"] = timestamp.UTC().Format(time.RFC3339)
+	}
+	if excluded := excludedDatabases(chain); len(excluded) > 0 {
+		metadata["excluded_databases"] = excluded
+	}
+	if len(databases) > 0 {
+		metadata["databases"] = databases
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// backupTimestamp is the point in time the chain restores the data to: the completion
+// of its latest backup, or its start when the end time was never recorded
+func backupTimestamp(chain []*domain.Backup) *time.Time {
+	if len(chain) == 0 {
+		return nil
+	}
+	latest := chain[len(chain)-1]
+	if latest.EndTime != nil {
+		return latest.EndTime
+	}
+	return &latest.StartTime
+}
+
+// excludedDatabases collects the databases left out of any backup in the chain,
+// so callers can tell the restore is not a complete copy of the server
+func excludedDatabases(chain []*domain.Backup) []string {
+	seen := map[string]bool{}
+	var excluded []string
+	for _, backup := range chain {
+		for _, name := range backup.ExcludedDatabases {
+			if !seen[name] {
+				seen[name] = true
+				excluded = append(excluded, name)
+			}
+		}
+	}
+	return excluded
+}
+
+// PlanRestore works out which backups a restore to targetTime needs without starting it:
+// the chain of the latest backup completed at or before targetTime. Backups whose chain is
+// broken or holds a backup that failed verification are passed over for an earlier one.
+func (s *RestoreService) PlanRestore(ctx context.Context, targetTime time.Time) (*domain.RestorePlan, error) {
+	completed, err := s.backupRepo.List(ctx, repository.BackupFilter{
+		ListFilter: util.ListFilter{
+			Filters: []util.QueryFilter{{Field: "end_time", Operator: util.OpLte, Value: targetTime.Format(time.RFC3339Nano)}},
+			Order:   []util.OrderClause{{Field: "end_time", Direction: util.OrderDesc}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	for _, candidate := range completed {
+		chain, err := s.backupRepo.FindChain(ctx, candidate.ID)
+		if err != nil || validateChainLinks(chain, candidate.ID) != nil || !chainHealthy(chain) {
+			continue
+		}
+		return domain.NewRestorePlan(targetTime, chain), nil
+	}
+
+	return nil, NewServiceError(404, fmt.Sprintf("no restorable backup completed at or before %s", targetTime.UTC().Format(time.RFC3339)))
+}
+
+// chainHealthy reports whether none of the chain's backups failed verification
+func chainHealthy(chain []*domain.Backup) bool {
+	for _, backup := range chain {
+		if !backup.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
 // GetRestore retrieves a restore by ID
 func (s *RestoreService) GetRestore(ctx context.Context, id int64) (*domain.Restore, error) {
 	return s.restoreRepo.FindByID(ctx, id)
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestRestoreReportsChainCompletionAsBackupTimestamp(t *testing.T) {
+	db := newTestDB(t)
+	fullStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	incrStart := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	seedBackup(t, db, "full", nil, nil, fullStart)
+	seedBackup(t, db, "incr", ptr("full"), nil, incrStart)
+
+	socket := newFakeSocket(t, nil)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+
+	process, err := restoreService.RestoreToFolder(context.Background(), "incr", "", nil, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// seedBackup completes backups ten minutes after they start
+	expected := incrStart.Add(10 * time.Minute).Format(time.RFC3339)
+	if got := process.Args["backup_timestamp"]; got != expected {
+		t.Errorf("expected backup_timestamp %s, got %v", expected, got)
+	}
+}
+
+func TestDatabaseRestoreRefusedWhileBackupRuns(t *testing.T) {
+	db := newTestDB(t)
+	seedBackup(t, db, "full", nil, nil, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// A backup still reading the data dir
+	_, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, type, args)
+		VALUES ('backup-running', 'mariabackup --backup', 0, 'running', CURRENT_TIMESTAMP, 'backup', '{}')
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed running backup: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+
+	_, err = restoreService.RestoreToDatabase(context.Background(), "full", domain.RestoreModePhysical, nil)
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) || svcErr.Code != 409 {
+		t.Fatalf("expected a 409 while a backup runs, got %v", err)
+	}
+	for _, cmd := range socket.commands() {
+		if cmd == "restore_backup" {
+			t.Fatal("expected no restore_backup command")
+		}
+	}
+
+	// Folder restores don't touch the data dir and go ahead
+	if _, err := restoreService.RestoreToFolder(context.Background(), "full", "", nil, true, false); err != nil {
+		t.Fatalf("expected the folder restore to start, got %v", err)
+	}
+
+	// Once the backup finished the database restore goes ahead as well
+	if _, err := db.Exec(`UPDATE process SET status = 'success' WHERE command_id = 'backup-running'`); err != nil {
+		t.Fatalf("failed to finish backup: %v", err)
+	}
+	if _, err := restoreService.RestoreToDatabase(context.Background(), "full", domain.RestoreModePhysical, nil); err != nil {
+		t.Fatalf("expected the database restore to start, got %v", err)
+	}
+}
+
+func TestRestoreOrdersChainByParentLinks(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedBackup(t, db, "full", nil, nil, start)
+	// Both incrementals share a timestamp, only the links tell their order
+	sameTime := start.Add(time.Hour)
+	seedBackup(t, db, "incr-a", ptr("full"), nil, sameTime)
+	seedBackup(t, db, "incr-b", ptr("incr-a"), nil, sameTime)
+	// An incremental that lost its parent link, as an imported catalog can leave one
+	seedBackup(t, db, "orphan", ptr("full"), nil, sameTime)
+	if _, err := db.Exec(`UPDATE backup SET from_backup_id = NULL WHERE id = 'orphan'`); err != nil {
+		t.Fatalf("failed to unlink orphan: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+
+	if _, err := restoreService.RestoreToDatabase(context.Background(), "incr-b", domain.RestoreModePhysical, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	idList, _ := socket.request(t, "restore_backup").Args["id_list"].([]interface{})
+	if len(idList) != 3 || idList[0] != "full" || idList[1] != "incr-a" || idList[2] != "incr-b" {
+		t.Fatalf("expected id_list [full incr-a incr-b], got %v", idList)
+	}
+
+	_, err := restoreService.RestoreToFolder(context.Background(), "orphan", "", nil, true, false)
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) || svcErr.Code != 409 {
+		t.Fatalf("expected a 409 for a broken chain, got %v", err)
+	}
+}
+
+func TestRestoreLimitedToDatabases(t *testing.T) {
+	db := newTestDB(t)
+	seedBackup(t, db, "full", nil, nil, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if _, err := db.Exec(`UPDATE backup SET excluded_databases = '["crm"]' WHERE id = 'full'`); err != nil {
+		t.Fatalf("failed to exclude crm: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+	ctx := context.Background()
+
+	rejected := []struct {
+		name    string
+		restore func() error
+	}{
+		{name: "physical restore to the database", restore: func() error {
+			_, err := restoreService.RestoreToDatabase(ctx, "full", domain.RestoreModePhysical, []string{"shop"})
+			return err
+		}},
+		{name: "invalid name", restore: func() error {
+			_, err := restoreService.RestoreToFolder(ctx, "full", "", []string{"shop`; DROP"}, true, false)
+			return err
+		}},
+		{name: "excluded database", restore: func() error {
+			_, err := restoreService.RestoreToFolder(ctx, "full", "", []string{"crm"}, true, false)
+			return err
+		}},
+	}
+	for _, tt := range rejected {
+		var svcErr *ServiceError
+		if err := tt.restore(); !errors.As(err, &svcErr) || svcErr.Code != 400 {
+			t.Errorf("%s: expected a 400, got %v", tt.name, err)
+		}
+	}
+	for _, cmd := range socket.commands() {
+		if cmd == "restore_backup" {
+			t.Fatal("expected no restore_backup command for rejected selections")
+		}
+	}
+
+	process, err := restoreService.RestoreToFolder(ctx, "full", "", []string{"shop"}, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	databases, _ := socket.request(t, "restore_backup").Args["databases"].([]interface{})
+	if len(databases) != 1 || databases[0] != "shop" {
+		t.Errorf("expected databases [shop] to be sent, got %v", databases)
+	}
+	if selected, _ := process.Args["databases"].([]string); len(selected) != 1 || selected[0] != "shop" {
+		t.Errorf("expected the selection on the process, got %v", process.Args["databases"])
+	}
+}
+
+func TestGrantsRestoreNeedsCapturedGrants(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedBackup(t, db, "full", nil, nil, start)
+	seedBackup(t, db, "incr", ptr("full"), nil, start.Add(time.Hour))
+	if _, err := db.Exec(`UPDATE backup SET grants_captured = 1 WHERE id = 'incr'`); err != nil {
+		t.Fatalf("failed to mark grants captured: %v", err)
+	}
+
+	socket := newFakeSocket(t, nil)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+	ctx := context.Background()
+
+	_, err := restoreService.RestoreToDatabase(ctx, "full", domain.RestoreModeGrants, nil)
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) || svcErr.Code != 400 {
+		t.Fatalf("expected a 400 for a backup without captured grants, got %v", err)
+	}
+
+	if _, err := restoreService.RestoreToDatabase(ctx, "incr", domain.RestoreModeGrants, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	idList, _ := socket.request(t, "restore_backup").Args["id_list"].([]interface{})
+	if len(idList) != 1 || idList[0] != "incr" {
+		t.Errorf("expected only the backup's own grants applied, got id_list %v", idList)
+	}
+}
+
+func TestRestoreWarnsAboutReplicaBackupOnPrimary(t *testing.T) {
+	db := newTestDB(t)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seedBackup(t, db, "from-replica", nil, nil, start)
+	seedBackup(t, db, "from-primary", nil, nil, start.Add(time.Hour))
+	if _, err := db.Exec(`UPDATE backup SET source = 'replica' WHERE id = 'from-replica'`); err != nil {
+		t.Fatalf("failed to set backup source: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE backup SET source = 'primary' WHERE id = 'from-primary'`); err != nil {
+		t.Fatalf("failed to set backup source: %v", err)
+	}
+
+	primary := func(req socketRequest) socketResponse {
+		resp := acceptAll(req)
+		if req.Cmd == "server_info" {
+			resp.Data["source"] = "primary"
+		}
+		return resp
+	}
+	socket := newFakeSocket(t, primary)
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), dbcmd.NewClient(socket.path, time.Second))
+
+	process, err := restoreService.RestoreToDatabase(context.Background(), "from-replica", domain.RestoreModePhysical, nil)
+	if err != nil {
+		t.Fatalf("expected the restore to go ahead despite the warning, got %v", err)
+	}
+	if warning, _ := process.Args["warning"].(string); warning == "" {
+		t.Errorf("expected a warning for a replica backup restored onto a primary, got %v", process.Args)
+	}
+
+	process, err = restoreService.RestoreToDatabase(context.Background(), "from-primary", domain.RestoreModePhysical, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := process.Args["warning"]; ok {
+		t.Errorf("expected no warning for a primary backup, got %v", process.Args["warning"])
+	}
+}
+
+func TestPlanRestoreAcrossChains(t *testing.T) {
+	db := newTestDB(t)
+	day1 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	seedBackup(t, db, "full-1", nil, nil, day1)
+	seedBackup(t, db, "incr-1a", ptr("full-1"), nil, day1.Add(6*time.Hour))
+	seedBackup(t, db, "incr-1b", ptr("incr-1a"), nil, day1.Add(12*time.Hour))
+	seedBackup(t, db, "full-2", nil, nil, day2)
+	seedBackup(t, db, "incr-2a", ptr("full-2"), nil, day2.Add(6*time.Hour))
+	if _, err := db.Exec(`UPDATE backup SET size = 100`); err != nil {
+		t.Fatalf("failed to set backup sizes: %v", err)
+	}
+	// A backup that failed verification can't be restored, nor can anything built on it
+	if _, err := db.Exec(`UPDATE backup SET verification_status = 'failed' WHERE id = 'incr-1b'`); err != nil {
+		t.Fatalf("failed to fail verification: %v", err)
+	}
+
+	restoreService := NewRestoreService(sqlite.NewRestoreRepository(db), sqlite.NewBackupRepository(db), sqlite.NewProcessRepository(db), nil)
+
+	// seedBackup completes backups ten minutes after they start
+	tests := []struct {
+		name          string
+		target        time.Time
+		expectedChain []string
+	}{
+		{name: "at the full's completion", target: day1.Add(10 * time.Minute), expectedChain: []string{"full-1"}},
+		{name: "within the first chain", target: day1.Add(7 * time.Hour), expectedChain: []string{"full-1", "incr-1a"}},
+		{name: "past a failed incremental", target: day1.Add(18 * time.Hour), expectedChain: []string{"full-1", "incr-1a"}},
+		{name: "while the next full runs", target: day2.Add(5 * time.Minute), expectedChain: []string{"full-1", "incr-1a"}},
+		{name: "within the second chain", target: day2.Add(48 * time.Hour), expectedChain: []string{"full-2", "incr-2a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := restoreService.PlanRestore(context.Background(), tt.target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var chain []string
+			for _, backup := range plan.Chain {
+				chain = append(chain, backup.ID)
+			}
+			if !reflect.DeepEqual(chain, tt.expectedChain) {
+				t.Errorf("expected chain %v, got %v", tt.expectedChain, chain)
+			}
+			if plan.TotalSize != int64(100*len(tt.expectedChain)) {
+				t.Errorf("expected total size %d, got %d", 100*len(tt.expectedChain), plan.TotalSize)
+			}
+			if plan.BackupTimestamp.After(tt.target) {
+				t.Errorf("expected the plan to restore to at most %s, got %s", tt.target, plan.BackupTimestamp)
+			}
+		})
+	}
+
+	_, err := restoreService.PlanRestore(context.Background(), day1.Add(5*time.Minute))
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) || svcErr.Code != 404 {
+		t.Fatalf("expected a 404 before the first backup completed, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// RetryService re-runs failed processes from the args they were started with
+type RetryService struct {
+	processRepo    repository.ProcessRepository
+	backupService  *BackupService
+	restoreService *RestoreService
+	cleanupService *CleanupService
+}
+
+func NewRetryService(
+	processRepo repository.ProcessRepository,
+	backupService *BackupService,
+	restoreService *RestoreService,
+	cleanupService *CleanupService,
+) *RetryService {
+	return &RetryService{
+		processRepo:    processRepo,
+		backupService:  backupService,
+		restoreService: restoreService,
+		cleanupService: cleanupService,
+	}
+}
+
+// Retry starts the backup, restore or cleanup the failed process commandID ran again and
+// links the new process to it. Backups get a new ID, the failed attempt may have left its
+// own behind. Folder restores go to a new folder for the same reason. Cleanups work out
+// the expired backups afresh, the failed run may have removed some of them.
+func (s *RetryService) Retry(ctx context.Context, commandID string) (*domain.Process, error) {
+	original, err := s.processRepo.FindByCommandID(ctx, commandID)
+	if err != nil {
+		return nil, NewServiceError(404, fmt.Sprintf("process %s not found", commandID))
+	}
+	if original.Status != domain.ProcessStatusFailed {
+		return nil, NewServiceError(409, fmt.Sprintf("process %s is %s, only failed processes can be retried", commandID, original.Status))
+	}
+
+	var process *domain.Process
+	switch original.Type {
+	case domain.ProcessTypeBackup:
+		process, err = s.retryBackup(ctx, original)
+	case domain.ProcessTypeRestore:
+		process, err = s.retryRestore(ctx, original)
+	case domain.ProcessTypeCleanupBackups:
+		if scheduleID := original.Schedule(); scheduleID != nil {
+			process, err = s.cleanupService.CleanupBySchedule(ctx, *scheduleID)
+		} else {
+			process, _, err = s.cleanupService.CleanupAll(ctx)
+		}
+	default:
+		return nil, NewServiceError(400, fmt.Sprintf("%s processes can't be retried", original.Type))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The retry runs either way, a missing link only loses where it came from
+	if err := s.processRepo.SetRetryOf(ctx, process.CommandID, original.CommandID); err != nil {
+		log.Printf("Warning: failed to link retry %s to process %s: %v", process.CommandID, original.CommandID, err)
+	}
+	process.RetryOf = &original.CommandID
+	return process, nil
+}
+
+func (s *RetryService) retryBackup(ctx context.Context, original *domain.Process) (*domain.Process, error) {
+	scheduleID := original.Schedule()
+	var description *string
+	if note, _ := original.Args["description"].(string); note != "" {
+		description = &note
+	}
+
+	if fromBackupID, _ := original.Args["from_backup_id"].(string); fromBackupID != "" {
+		return s.backupService.CreateIncrementalBackup(ctx, nil, &fromBackupID, scheduleID, description)
+	}
+	strategy, _ := original.Args["strategy"].(string)
+	return s.backupService.CreateFullBackup(ctx, nil, scheduleID, domain.BackupStrategy(strategy), description)
+}
+
+func (s *RetryService) retryRestore(ctx context.Context, original *domain.Process) (*domain.Process, error) {
+	idList := stringsArg(original.Args["id_list"])
+	if len(idList) == 0 {
+		return nil, NewServiceError(400, fmt.Sprintf("process %s has no backups to restore in its args", original.CommandID))
+	}
+	// The chain is looked up again from the backup restored, as a new restore would
+	backupID := idList[len(idList)-1]
+	databases := stringsArg(original.Args["databases"])
+
+	if target, _ := original.Args["target"].(string); target == string(domain.RestoreTargetDatabase) {
+		mode := domain.RestoreModePhysical
+		if raw, _ := original.Args["restore_mode"].(string); raw != "" {
+			mode = domain.RestoreMode(raw)
+		}
+		return s.restoreService.RestoreToDatabase(ctx, backupID, mode, databases)
+	}
+
+	record := true
+	if raw, ok := original.Args["record"].(bool); ok {
+		record = raw
+	}
+	archive, _ := original.Args["archive"].(bool)
+	return s.restoreService.RestoreToFolder(ctx, backupID, "", databases, record, archive)
+}
+
+// stringsArg reads a list of strings from process args, which JSON leaves as []interface{}
+func stringsArg(raw interface{}) []string {
+	switch values := raw.(type) {
+	case []string:
+		return values
+	case []interface{}:
+		var result []string
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/martijn/dbcalm/internal/adapter/cmd"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
@@ -17,6 +19,9 @@ type ScheduleService struct {
 	cmdClient    *cmd.Client
 	dbcalmBinary string // Path to dbcalm binary
 	logDir       string // Log directory
+	cronFailure  domain.CronSyncFailure
+	duplicates   domain.DuplicateSchedulePolicy
+	location     *time.Location // Zone schedules run in
 }
 
 func NewScheduleService(
@@ -26,6 +31,9 @@ func NewScheduleService(
 	cmdClient *cmd.Client,
 	dbcalmBinary string,
 	logDir string,
+	cronFailure domain.CronSyncFailure,
+	duplicates domain.DuplicateSchedulePolicy,
+	location *time.Location,
 ) *ScheduleService {
 	return &ScheduleService{
 		scheduleRepo: scheduleRepo,
@@ -34,15 +42,26 @@ func NewScheduleService(
 		cmdClient:    cmdClient,
 		dbcalmBinary: dbcalmBinary,
 		logDir:       logDir,
+		cronFailure:  cronFailure,
+		duplicates:   duplicates,
+		location:     location,
 	}
 }
 
+// Timezone is the name of the zone schedules run in, "Local" for the host's zone
+func (s *ScheduleService) Timezone() string {
+	return s.location.String()
+}
+
 // CreateSchedule creates a new schedule
 func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule *domain.Schedule) error {
 	// Validate schedule
 	if err := s.validateSchedule(ctx, schedule); err != nil {
 		return err
 	}
+	if err := s.checkDuplicate(ctx, schedule); err != nil {
+		return err
+	}
 
 	// Create schedule
 	if err := s.scheduleRepo.Create(ctx, schedule); err != nil {
@@ -51,14 +70,73 @@ func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule *domain.S
 
 	// Update cron file
 	if err := s.updateCronFile(ctx); err != nil {
+		if s.keepOnCronFailure(err) {
+			return nil
+		}
 		// Rollback schedule creation
 		_ = s.scheduleRepo.Delete(ctx, schedule.ID)
-		return fmt.Errorf("failed to update cron file: %w", err)
+		return cronSyncError(err)
 	}
 
 	return nil
 }
 
+// CreatePreset creates the schedules of a preset in one transaction and then updates
+// cron once. A failed cron update removes all of them, unless failed updates are kept.
+func (s *ScheduleService) CreatePreset(ctx context.Context, preset domain.SchedulePreset, opts domain.PresetOptions) ([]*domain.Schedule, error) {
+	schedules, err := domain.BuildPreset(preset, opts, uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		if err := s.validateSchedule(ctx, schedule, schedules...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.scheduleRepo.CreateAll(ctx, schedules); err != nil {
+		return nil, fmt.Errorf("failed to create schedules: %w", err)
+	}
+
+	if err := s.updateCronFile(ctx); err != nil {
+		if s.keepOnCronFailure(err) {
+			return schedules, nil
+		}
+		// Rollback the preset's schedules
+		for _, schedule := range schedules {
+			if rollbackErr := s.scheduleRepo.Delete(ctx, schedule.ID); rollbackErr != nil {
+				log.Printf("Warning: preset schedule %d was not written to cron and could not be removed: %v", schedule.ID, rollbackErr)
+			}
+		}
+		return nil, cronSyncError(err)
+	}
+
+	return schedules, nil
+}
+
+// CloneSchedule creates a copy of a schedule. The copy is disabled unless enabled is set,
+// so it doesn't start running before it has been adjusted.
+func (s *ScheduleService) CloneSchedule(ctx context.Context, id int64, enabled bool) (*domain.Schedule, error) {
+	source, err := s.scheduleRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, NewServiceError(404, fmt.Sprintf("schedule not found: %d", id))
+	}
+
+	clone := *source
+	clone.ID = 0
+	clone.Enabled = enabled
+	clone.PresetGroup = nil // The copy is not part of the source's preset
+	clone.DaysOfWeek = append([]int(nil), source.DaysOfWeek...)
+	clone.ExcludeDatabases = append([]string(nil), source.ExcludeDatabases...)
+	clone.CreatedAt = time.Now()
+	clone.UpdatedAt = clone.CreatedAt
+
+	if err := s.CreateSchedule(ctx, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
 // UpdateSchedule updates an existing schedule
 func (s *ScheduleService) UpdateSchedule(ctx context.Context, schedule *domain.Schedule) error {
 	// Validate schedule
@@ -66,6 +144,11 @@ func (s *ScheduleService) UpdateSchedule(ctx context.Context, schedule *domain.S
 		return err
 	}
 
+	previous, err := s.scheduleRepo.FindByID(ctx, schedule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+
 	// Update schedule
 	schedule.UpdatedAt = time.Now()
 	if err := s.scheduleRepo.Update(ctx, schedule); err != nil {
@@ -74,26 +157,97 @@ func (s *ScheduleService) UpdateSchedule(ctx context.Context, schedule *domain.S
 
 	// Update cron file
 	if err := s.updateCronFile(ctx); err != nil {
-		return fmt.Errorf("failed to update cron file: %w", err)
+		if s.keepOnCronFailure(err) {
+			return nil
+		}
+		// Rollback to the schedule cron still runs
+		if rollbackErr := s.scheduleRepo.Update(ctx, previous); rollbackErr != nil {
+			log.Printf("Warning: schedule %d was changed but not written to cron, and could not be restored: %v", schedule.ID, rollbackErr)
+		}
+		return cronSyncError(err)
 	}
 
 	return nil
 }
 
-// DeleteSchedule deletes a schedule
+// DeleteSchedule deletes a schedule. Unless failed cron updates are kept, cron drops the
+// schedule first, so a failed update leaves the schedule in place.
 func (s *ScheduleService) DeleteSchedule(ctx context.Context, id int64) error {
+	if s.cronFailure != domain.CronSyncKeep {
+		if _, err := s.scheduleRepo.FindByID(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete schedule: %w", err)
+		}
+		if err := s.writeCronFile(ctx, id); err != nil {
+			return cronSyncError(err)
+		}
+		if err := s.scheduleRepo.Delete(ctx, id); err != nil {
+			// Cron no longer runs the schedule, put it back
+			if resyncErr := s.updateCronFile(ctx); resyncErr != nil {
+				log.Printf("Warning: cron file lacks schedule %d, which could not be deleted: %v", id, resyncErr)
+			}
+			return fmt.Errorf("failed to delete schedule: %w", err)
+		}
+		return nil
+	}
+
 	if err := s.scheduleRepo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete schedule: %w", err)
 	}
 
 	// Update cron file
 	if err := s.updateCronFile(ctx); err != nil {
-		return fmt.Errorf("failed to update cron file: %w", err)
+		s.keepOnCronFailure(err)
 	}
 
 	return nil
 }
 
+// ResyncCron rewrites the cron file from the enabled schedules, recovering from a cron
+// file that drifted from the catalog. It returns the number of schedules written.
+func (s *ScheduleService) ResyncCron(ctx context.Context) (int, error) {
+	schedules, err := s.scheduleRepo.FindAllEnabled(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get enabled schedules: %w", err)
+	}
+	if err := s.sendCronSchedules(ctx, schedules); err != nil {
+		return 0, cronSyncError(err)
+	}
+	return len(schedules), nil
+}
+
+// keepOnCronFailure reports whether a schedule change is kept although cron couldn't be
+// updated, logging the failure when it is
+func (s *ScheduleService) keepOnCronFailure(err error) bool {
+	if s.cronFailure != domain.CronSyncKeep {
+		return false
+	}
+	log.Printf("Warning: schedule change saved but the cron file is out of sync, resync it with POST /schedules/resync-cron: %v", err)
+	return true
+}
+
+// cronSyncError reports a failed cron update, cmd is unreachable or refused it
+func cronSyncError(err error) error {
+	return NewServiceError(503, fmt.Sprintf("failed to update cron file: %v", err))
+}
+
+// SkipOutsideWindow is called by the cron-triggered backup. Cron starts a windowed schedule
+// all day, so outside the schedule's window it records a skipped process for the run and
+// returns it, otherwise it returns nil. The window is in the zone schedules run in.
+func (s *ScheduleService) SkipOutsideWindow(ctx context.Context, scheduleID int64, now time.Time) (*domain.Process, error) {
+	schedule, err := s.scheduleRepo.FindByID(ctx, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule %d: %w", scheduleID, err)
+	}
+	if schedule.InWindow(now.In(s.location)) {
+		return nil, nil
+	}
+
+	return s.processServ.RecordSkipped(ctx, "skipped: outside backup window", domain.ProcessTypeBackup, map[string]interface{}{
+		"schedule_id": scheduleID,
+		"skip_reason": "outside_window",
+	})
+}
+
 // GetSchedule retrieves a schedule by ID
 func (s *ScheduleService) GetSchedule(ctx context.Context, id int64) (*domain.Schedule, error) {
 	return s.scheduleRepo.FindByID(ctx, id)
@@ -109,84 +263,270 @@ func (s *ScheduleService) CountSchedules(ctx context.Context, filter repository.
 	return s.scheduleRepo.Count(ctx, filter)
 }
 
-// validateSchedule validates a schedule
-func (s *ScheduleService) validateSchedule(ctx context.Context, schedule *domain.Schedule) error {
+// UnhealthySchedules returns the enabled schedules whose last run failed, or whose next
+// run is overdue by more than grace. An overdue run means cron isn't starting the schedule,
+// which is reported over a failed run.
+func (s *ScheduleService) UnhealthySchedules(ctx context.Context, now time.Time, grace time.Duration) ([]*domain.ScheduleHealth, error) {
+	schedules, err := s.scheduleRepo.FindAllEnabled(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enabled schedules: %w", err)
+	}
+
+	var unhealthy []*domain.ScheduleHealth
+	for _, schedule := range schedules {
+		lastRun, err := s.processServ.LastScheduledRun(ctx, schedule.ID)
+		if err != nil {
+			return nil, err
+		}
+		health := &domain.ScheduleHealth{Schedule: schedule, LastRun: lastRun}
+
+		from := schedule.CreatedAt
+		if lastRun != nil {
+			from = lastRun.StartTime
+		}
+		if next, ok := schedule.NextRunAfter(from.In(s.location)); ok {
+			health.NextRunAt = &next
+			if now.Sub(next) > grace {
+				health.Status = domain.ScheduleHealthOverdue
+				health.Reason = fmt.Sprintf("run due at %s has not started", next.Format(time.RFC3339))
+				unhealthy = append(unhealthy, health)
+				continue
+			}
+		}
+
+		if lastRun != nil && lastRun.Status == domain.ProcessStatusFailed {
+			health.Status = domain.ScheduleHealthFailed
+			health.Reason = fmt.Sprintf("last run at %s failed", lastRun.StartTime.Format(time.RFC3339))
+			unhealthy = append(unhealthy, health)
+		}
+	}
+
+	return unhealthy, nil
+}
+
+// validateSchedule validates a schedule. pending are schedules created along with it,
+// an enabled full schedule among them satisfies an incremental schedule. Invalid fields
+// are returned together as a *ValidationError.
+func (s *ScheduleService) validateSchedule(ctx context.Context, schedule *domain.Schedule, pending ...*domain.Schedule) error {
+	var invalid ValidationError
+
 	// If incremental backup, ensure there's at least one enabled full schedule
-	if schedule.BackupType == domain.BackupTypeIncremental && schedule.Enabled {
+	if schedule.BackupType == domain.BackupTypeIncremental && schedule.Enabled && !hasEnabledFull(pending) {
 		fullSchedules, err := s.scheduleRepo.FindEnabledFullSchedules(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to check full schedules: %w", err)
 		}
 		if len(fullSchedules) == 0 {
-			return fmt.Errorf("incremental backups require at least one enabled full backup schedule")
+			invalid.Add("backup_type", "incremental backups require at least one enabled full backup schedule")
+		}
+	}
+
+	// Logical dumps are always full backups
+	if schedule.Strategy == domain.BackupStrategyLogical && schedule.BackupType != domain.BackupTypeFull {
+		invalid.Add("strategy", "the logical strategy is only supported for full backup schedules")
+	}
+
+	if err := domain.ValidateRetention(schedule.RetentionValue, schedule.RetentionUnit); err != nil {
+		field := "retention_value"
+		if schedule.RetentionUnit == nil || (schedule.RetentionValue != nil && *schedule.RetentionValue >= 1) {
+			field = "retention_unit"
 		}
+		invalid.Add(field, err.Error())
 	}
 
-	// Validate frequency-specific fields
+	if err := domain.ValidateDatabaseNames(schedule.ExcludeDatabases); err != nil {
+		invalid.Add("exclude_databases", err.Error())
+	}
+	if schedule.PreBackupHook != nil {
+		if err := domain.ValidateHookPath(*schedule.PreBackupHook); err != nil {
+			invalid.Add("pre_backup_hook", err.Error())
+		}
+	}
+	if schedule.PostBackupHook != nil {
+		if err := domain.ValidateHookPath(*schedule.PostBackupHook); err != nil {
+			invalid.Add("post_backup_hook", err.Error())
+		}
+	}
+	if schedule.CredentialsSuffix != nil {
+		if err := domain.ValidateCredentialsSuffix(*schedule.CredentialsSuffix); err != nil {
+			invalid.Add("credentials_suffix", err.Error())
+		}
+	}
+	if err := domain.ValidateWindow(schedule.Frequency, schedule.WindowStart, schedule.WindowEnd); err != nil {
+		field := "window_start"
+		if schedule.WindowStart != nil && schedule.WindowEnd == nil {
+			field = "window_end"
+		}
+		invalid.Add(field, err.Error())
+	}
+
+	// Validate frequency-specific fields, reporting every one that is missing
+	required := func(field string, missing bool) {
+		if missing {
+			invalid.Add(field, fmt.Sprintf("required for %s schedules", schedule.Frequency))
+		}
+	}
 	switch schedule.Frequency {
 	case domain.FrequencyDaily:
-		if schedule.Hour == nil || schedule.Minute == nil {
-			return fmt.Errorf("daily schedules require hour and minute")
-		}
+		required("hour", schedule.Hour == nil)
+		required("minute", schedule.Minute == nil)
 	case domain.FrequencyWeekly:
-		if schedule.DayOfWeek == nil || schedule.Hour == nil || schedule.Minute == nil {
-			return fmt.Errorf("weekly schedules require day_of_week, hour, and minute")
+		required("days_of_week", len(schedule.Weekdays()) == 0)
+		required("hour", schedule.Hour == nil)
+		required("minute", schedule.Minute == nil)
+		if err := domain.ValidateWeekdays(schedule.Weekdays()); err != nil {
+			invalid.Add("days_of_week", err.Error())
 		}
 	case domain.FrequencyMonthly:
-		if schedule.DayOfMonth == nil || schedule.Hour == nil || schedule.Minute == nil {
-			return fmt.Errorf("monthly schedules require day_of_month, hour, and minute")
-		}
+		required("day_of_month", schedule.DayOfMonth == nil)
+		required("hour", schedule.Hour == nil)
+		required("minute", schedule.Minute == nil)
 	case domain.FrequencyHourly:
-		if schedule.Minute == nil {
-			return fmt.Errorf("hourly schedules require minute")
-		}
+		required("minute", schedule.Minute == nil)
 	case domain.FrequencyInterval:
-		if schedule.IntervalValue == nil || schedule.IntervalUnit == nil {
-			return fmt.Errorf("interval schedules require interval_value and interval_unit")
-		}
+		required("interval_value", schedule.IntervalValue == nil)
+		required("interval_unit", schedule.IntervalUnit == nil)
 	}
 
+	if len(invalid.Fields) > 0 {
+		return &invalid
+	}
 	return nil
 }
 
+// checkDuplicate applies the duplicate schedule policy to a new schedule that takes the
+// same backups at the same times as an enabled one, as a form submitted twice would.
+// Rejected schedules get a 409 naming the schedule they duplicate.
+func (s *ScheduleService) checkDuplicate(ctx context.Context, schedule *domain.Schedule) error {
+	if s.duplicates == domain.DuplicateScheduleAllow || !schedule.Enabled {
+		return nil
+	}
+
+	enabled, err := s.scheduleRepo.FindAllEnabled(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for duplicate schedules: %w", err)
+	}
+	for _, existing := range enabled {
+		if !schedule.Duplicates(existing) {
+			continue
+		}
+		if s.duplicates == domain.DuplicateScheduleReject {
+			return NewServiceError(409, fmt.Sprintf("schedule duplicates enabled schedule %d", existing.ID))
+		}
+		log.Printf("Warning: new %s %s schedule duplicates enabled schedule %d, both will run", schedule.Frequency, schedule.BackupType, existing.ID)
+		return nil
+	}
+	return nil
+}
+
+// hasEnabledFull reports whether one of the schedules takes enabled physical full backups
+func hasEnabledFull(schedules []*domain.Schedule) bool {
+	for _, schedule := range schedules {
+		if schedule.BackupType == domain.BackupTypeFull && schedule.Enabled && schedule.Strategy == domain.BackupStrategyPhysical {
+			return true
+		}
+	}
+	return false
+}
+
 // updateCronFile updates the system cron file with all enabled schedules via socket service
 func (s *ScheduleService) updateCronFile(ctx context.Context) error {
+	return s.writeCronFile(ctx, 0)
+}
+
+// writeCronFile writes the cron file with all enabled schedules but the excluded one
+// (zero excludes none)
+func (s *ScheduleService) writeCronFile(ctx context.Context, excludeID int64) error {
 	// Get all enabled schedules
-	schedules, err := s.scheduleRepo.FindAllEnabled(ctx)
+	enabled, err := s.scheduleRepo.FindAllEnabled(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get enabled schedules: %w", err)
 	}
 
+	schedules := enabled[:0]
+	for _, schedule := range enabled {
+		if schedule.ID != excludeID {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return s.sendCronSchedules(ctx, schedules)
+}
+
+// CronPreview returns the cron file cmd would write for the enabled schedules, without
+// writing it, to find out why a schedule isn't firing. It also returns the number of
+// schedules rendered.
+func (s *ScheduleService) CronPreview(ctx context.Context) (string, int, error) {
+	schedules, err := s.scheduleRepo.FindAllEnabled(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get enabled schedules: %w", err)
+	}
+
+	cronArgs := s.cronScheduleArgs(schedules)
+	cronArgs["dry_run"] = true
+	response, err := s.cmdClient.SendCommand(ctx, "update_cron_schedules", cronArgs)
+	if err != nil {
+		return "", 0, NewServiceError(503, fmt.Sprintf("cannot render cron file, cmd service is unreachable: %v", err))
+	}
+	if response.Code != 200 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return "", 0, NewServiceError(503, fmt.Sprintf("cannot render cron file: %s", errMsg))
+	}
+
+	content, ok := response.Data["content"].(string)
+	if !ok {
+		return "", 0, NewServiceError(503, "cannot render cron file: cmd did not return it")
+	}
+	return content, len(schedules), nil
+}
+
+// sendCronSchedules has cmd replace the cron file with the given schedules
+func (s *ScheduleService) sendCronSchedules(ctx context.Context, schedules []*domain.Schedule) error {
+	// Update cron schedules via socket service (matches Python architecture)
+	response, err := s.cmdClient.SendCommand(ctx, "update_cron_schedules", s.cronScheduleArgs(schedules))
+	if err != nil {
+		return fmt.Errorf("failed to update cron schedules via socket service: %w", err)
+	}
+	if response.Code != 200 && response.Code != 202 {
+		return fmt.Errorf("update cron schedules failed: %s", response.Status)
+	}
+
+	return nil
+}
+
+// cronScheduleArgs are the update_cron_schedules arguments for the given schedules
+func (s *ScheduleService) cronScheduleArgs(schedules []*domain.Schedule) map[string]interface{} {
+	// The host's zone is cron's own, other zones are set on every entry
+	timezone := ""
+	if s.location != time.Local {
+		timezone = s.location.String()
+	}
+
 	// Convert schedules to format expected by socket service
 	scheduleData := make([]map[string]interface{}, len(schedules))
 	for i, schedule := range schedules {
 		scheduleData[i] = map[string]interface{}{
 			"id":             schedule.ID,
 			"backup_type":    string(schedule.BackupType),
+			"strategy":       string(schedule.Strategy),
 			"frequency":      string(schedule.Frequency),
 			"day_of_week":    schedule.DayOfWeek,
+			"days_of_week":   schedule.DaysOfWeek,
 			"day_of_month":   schedule.DayOfMonth,
 			"hour":           schedule.Hour,
 			"minute":         schedule.Minute,
 			"interval_value": schedule.IntervalValue,
 			"interval_unit":  schedule.IntervalUnit,
 			"enabled":        schedule.Enabled,
+			"timezone":       timezone,
 		}
 	}
 
-	// Update cron schedules via socket service (matches Python architecture)
-	cronArgs := map[string]interface{}{
+	return map[string]interface{}{
 		"schedules": scheduleData,
 	}
-	response, err := s.cmdClient.SendCommand(ctx, "update_cron_schedules", cronArgs)
-	if err != nil {
-		return fmt.Errorf("failed to update cron schedules via socket service: %w", err)
-	}
-	if response.Code != 200 && response.Code != 202 {
-		return fmt.Errorf("update cron schedules failed: %s", response.Status)
-	}
-
-	return nil
 }
 
 // GetBackupsForSchedule gets all backups for a schedule
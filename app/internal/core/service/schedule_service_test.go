@@ -0,0 +1,700 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/cmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+func TestCreateScheduleValidatesRetention(t *testing.T) {
+	unit := func(u string) *domain.RetentionUnit {
+		ru := domain.RetentionUnit(u)
+		return &ru
+	}
+
+	tests := []struct {
+		name           string
+		retentionValue *int
+		retentionUnit  *domain.RetentionUnit
+		expectedError  string
+	}{
+		{name: "zero value", retentionValue: ptr(0), retentionUnit: unit("days"), expectedError: "retention_value must be at least 1"},
+		{name: "negative value", retentionValue: ptr(-3), retentionUnit: unit("weeks"), expectedError: "retention_value must be at least 1"},
+		{name: "unknown unit", retentionValue: ptr(2), retentionUnit: unit("fortnights"), expectedError: "invalid retention_unit"},
+		{name: "value without unit", retentionValue: ptr(7), expectedError: "must be set together"},
+		{name: "unit without value", retentionUnit: unit("days"), expectedError: "must be set together"},
+		{name: "valid retention", retentionValue: ptr(48), retentionUnit: unit("hours")},
+		{name: "no retention"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, nil)
+			scheduleService := NewScheduleService(
+				sqlite.NewScheduleRepository(db),
+				sqlite.NewBackupRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				cmd.NewClient(socket.path, time.Second),
+				"/usr/bin/dbcalm",
+				t.TempDir(),
+				domain.CronSyncRollback,
+				domain.DuplicateScheduleAllow,
+				time.Local,
+			)
+
+			schedule := &domain.Schedule{
+				BackupType:     domain.BackupTypeFull,
+				Frequency:      domain.FrequencyDaily,
+				Hour:           ptr(2),
+				Minute:         ptr(0),
+				RetentionValue: tt.retentionValue,
+				RetentionUnit:  tt.retentionUnit,
+				Strategy:       domain.BackupStrategyPhysical,
+				Enabled:        true,
+			}
+
+			err := scheduleService.CreateSchedule(context.Background(), schedule)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCreateScheduleOnSeveralWeekdays(t *testing.T) {
+	db := newTestDB(t)
+	socket := newFakeSocket(t, nil)
+	scheduleRepo := sqlite.NewScheduleRepository(db)
+	scheduleService := NewScheduleService(
+		scheduleRepo,
+		sqlite.NewBackupRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		cmd.NewClient(socket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+
+	schedule := &domain.Schedule{
+		BackupType: domain.BackupTypeFull,
+		Frequency:  domain.FrequencyWeekly,
+		Hour:       ptr(2),
+		Minute:     ptr(0),
+		Strategy:   domain.BackupStrategyPhysical,
+		Enabled:    true,
+	}
+	schedule.SetWeekdays([]int{4, 1, 4})
+
+	if err := scheduleService.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatalf("CreateSchedule failed: %v", err)
+	}
+
+	stored, err := scheduleRepo.FindByID(context.Background(), schedule.ID)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if stored.DayOfWeek == nil || *stored.DayOfWeek != 1 {
+		t.Errorf("expected day_of_week 1, got %v", stored.DayOfWeek)
+	}
+	if got := stored.Weekdays(); len(got) != 2 || got[0] != 1 || got[1] != 4 {
+		t.Errorf("expected weekdays [1 4], got %v", got)
+	}
+
+	schedules := socket.request(t, "update_cron_schedules").Args["schedules"].([]interface{})
+	days := schedules[0].(map[string]interface{})["days_of_week"]
+	if got, ok := days.([]interface{}); !ok || len(got) != 2 || got[0] != float64(1) || got[1] != float64(4) {
+		t.Errorf("expected days_of_week [1 4] in cron update, got %v", days)
+	}
+
+	invalid := *schedule
+	invalid.SetWeekdays([]int{1, 7})
+	err = scheduleService.CreateSchedule(context.Background(), &invalid)
+	if err == nil || !strings.Contains(err.Error(), "must be 0-6") {
+		t.Fatalf("expected day out of range error, got %v", err)
+	}
+}
+
+func TestCreateDuplicateSchedule(t *testing.T) {
+	daily := func(minute int, enabled bool) *domain.Schedule {
+		return &domain.Schedule{
+			BackupType: domain.BackupTypeFull,
+			Frequency:  domain.FrequencyDaily,
+			Hour:       ptr(2),
+			Minute:     ptr(minute),
+			Strategy:   domain.BackupStrategyPhysical,
+			Enabled:    enabled,
+		}
+	}
+
+	tests := []struct {
+		policy    domain.DuplicateSchedulePolicy
+		expectErr bool
+	}{
+		{policy: domain.DuplicateScheduleAllow},
+		{policy: domain.DuplicateScheduleWarn},
+		{policy: domain.DuplicateScheduleReject, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, nil)
+			scheduleRepo := sqlite.NewScheduleRepository(db)
+			scheduleService := NewScheduleService(
+				scheduleRepo,
+				sqlite.NewBackupRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				cmd.NewClient(socket.path, time.Second),
+				"/usr/bin/dbcalm",
+				t.TempDir(),
+				domain.CronSyncRollback,
+				tt.policy,
+				time.Local,
+			)
+			ctx := context.Background()
+
+			original := daily(0, true)
+			if err := scheduleService.CreateSchedule(ctx, original); err != nil {
+				t.Fatalf("CreateSchedule failed: %v", err)
+			}
+			// Another time, or a disabled copy, is never a duplicate
+			if err := scheduleService.CreateSchedule(ctx, daily(30, true)); err != nil {
+				t.Fatalf("expected a schedule at another time to be created, got %v", err)
+			}
+			if err := scheduleService.CreateSchedule(ctx, daily(0, false)); err != nil {
+				t.Fatalf("expected a disabled copy to be created, got %v", err)
+			}
+
+			err := scheduleService.CreateSchedule(ctx, daily(0, true))
+			if !tt.expectErr {
+				if err != nil {
+					t.Fatalf("expected the duplicate to be created, got %v", err)
+				}
+				return
+			}
+
+			var svcErr *ServiceError
+			if !errors.As(err, &svcErr) || svcErr.Code != 409 {
+				t.Fatalf("expected a 409, got %v", err)
+			}
+			if !strings.Contains(err.Error(), fmt.Sprintf("schedule %d", original.ID)) {
+				t.Errorf("expected the error to name schedule %d, got %q", original.ID, err.Error())
+			}
+			if count, _ := scheduleRepo.Count(ctx, repository.ScheduleFilter{}); count != 3 {
+				t.Errorf("expected the duplicate not to be stored, got %d schedules", count)
+			}
+		})
+	}
+}
+
+func TestUnhealthySchedules(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2026, time.March, d, hour, 0, 0, 0, time.Local)
+	}
+	now := day(10, 12)
+
+	db := newTestDB(t)
+	seed := func(createdAt time.Time, enabled bool, lastRun *time.Time, status string) int64 {
+		id := seedSchedule(t, db, "full")
+		if _, err := db.Exec(`UPDATE schedule SET created_at = ?, enabled = ? WHERE id = ?`, createdAt, enabled, id); err != nil {
+			t.Fatalf("failed to update schedule: %v", err)
+		}
+		if lastRun != nil {
+			_, err := db.Exec(`
+				INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args, schedule_id)
+				VALUES (?, 'mariabackup --backup', 0, ?, ?, ?, 'backup', '{}', ?)
+			`, fmt.Sprintf("run-%d", id), status, *lastRun, lastRun.Add(10*time.Minute), id)
+			if err != nil {
+				t.Fatalf("failed to seed last run: %v", err)
+			}
+		}
+		return id
+	}
+
+	// Every schedule runs daily at 02:00
+	seed(day(1, 0), true, ptr(day(10, 2)), "success")
+	failedID := seed(day(1, 0), true, ptr(day(10, 2)), "failed")
+	overdueID := seed(day(1, 0), true, ptr(day(8, 2)), "success")
+	seed(day(10, 10), true, nil, "")
+	seed(day(1, 0), false, nil, "")
+
+	scheduleService := NewScheduleService(
+		sqlite.NewScheduleRepository(db),
+		sqlite.NewBackupRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		nil,
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+
+	unhealthy, err := scheduleService.UnhealthySchedules(context.Background(), now, time.Hour)
+	if err != nil {
+		t.Fatalf("UnhealthySchedules failed: %v", err)
+	}
+
+	statuses := make(map[int64]domain.ScheduleHealthStatus)
+	for _, health := range unhealthy {
+		statuses[health.Schedule.ID] = health.Status
+		if health.Reason == "" {
+			t.Errorf("expected a reason for schedule %d", health.Schedule.ID)
+		}
+	}
+	expected := map[int64]domain.ScheduleHealthStatus{
+		failedID:  domain.ScheduleHealthFailed,
+		overdueID: domain.ScheduleHealthOverdue,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	}
+
+	// Within the grace period a late run isn't overdue yet
+	unhealthy, err = scheduleService.UnhealthySchedules(context.Background(), day(9, 2).Add(30*time.Minute), time.Hour)
+	if err != nil {
+		t.Fatalf("UnhealthySchedules failed: %v", err)
+	}
+	for _, health := range unhealthy {
+		if health.Schedule.ID == overdueID {
+			t.Errorf("expected schedule %d within its grace period, got %s", overdueID, health.Status)
+		}
+	}
+}
+
+func TestCronSyncFailure(t *testing.T) {
+	failCron := func(req socketRequest) socketResponse {
+		if req.Cmd == "update_cron_schedules" {
+			return socketResponse{Code: 500, Status: "failed to write cron file"}
+		}
+		return acceptAll(req)
+	}
+
+	tests := []struct {
+		name        string
+		cronFailure domain.CronSyncFailure
+		expectKept  bool
+	}{
+		{name: "rollback", cronFailure: domain.CronSyncRollback},
+		{name: "keep", cronFailure: domain.CronSyncKeep, expectKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, failCron)
+			scheduleRepo := sqlite.NewScheduleRepository(db)
+			scheduleService := NewScheduleService(
+				scheduleRepo,
+				sqlite.NewBackupRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				cmd.NewClient(socket.path, time.Second),
+				"/usr/bin/dbcalm",
+				t.TempDir(),
+				tt.cronFailure,
+				domain.DuplicateScheduleAllow,
+				time.Local,
+			)
+			ctx := context.Background()
+			scheduleID := seedSchedule(t, db, "full")
+
+			schedule, err := scheduleRepo.FindByID(ctx, scheduleID)
+			if err != nil {
+				t.Fatalf("FindByID failed: %v", err)
+			}
+			schedule.Hour = ptr(5)
+			err = scheduleService.UpdateSchedule(ctx, schedule)
+			if tt.expectKept != (err == nil) {
+				t.Fatalf("unexpected update result: %v", err)
+			}
+			var svcErr *ServiceError
+			if err != nil && (!errors.As(err, &svcErr) || svcErr.Code != 503) {
+				t.Fatalf("expected a 503 service error, got %v", err)
+			}
+
+			stored, err := scheduleRepo.FindByID(ctx, scheduleID)
+			if err != nil {
+				t.Fatalf("FindByID failed: %v", err)
+			}
+			expectedHour := 2
+			if tt.expectKept {
+				expectedHour = 5
+			}
+			if stored.Hour == nil || *stored.Hour != expectedHour {
+				t.Errorf("expected hour %d after failed cron update, got %v", expectedHour, stored.Hour)
+			}
+
+			err = scheduleService.DeleteSchedule(ctx, scheduleID)
+			if tt.expectKept != (err == nil) {
+				t.Fatalf("unexpected delete result: %v", err)
+			}
+			_, err = scheduleRepo.FindByID(ctx, scheduleID)
+			if tt.expectKept && err == nil {
+				t.Error("expected schedule to be deleted")
+			}
+			if !tt.expectKept && err != nil {
+				t.Errorf("expected schedule to remain after failed cron update, got %v", err)
+			}
+		})
+	}
+}
+
+func TestResyncCron(t *testing.T) {
+	db := newTestDB(t)
+	socket := newFakeSocket(t, nil)
+	scheduleService := NewScheduleService(
+		sqlite.NewScheduleRepository(db),
+		sqlite.NewBackupRepository(db),
+		NewProcessService(sqlite.NewProcessRepository(db)),
+		cmd.NewClient(socket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+	seedSchedule(t, db, "full")
+	seedSchedule(t, db, "incremental")
+	if _, err := db.Exec(`UPDATE schedule SET enabled = 0 WHERE backup_type = 'incremental'`); err != nil {
+		t.Fatalf("failed to disable schedule: %v", err)
+	}
+
+	count, err := scheduleService.ResyncCron(context.Background())
+	if err != nil {
+		t.Fatalf("ResyncCron failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 schedule written, got %d", count)
+	}
+	schedules := socket.request(t, "update_cron_schedules").Args["schedules"].([]interface{})
+	if len(schedules) != 1 {
+		t.Errorf("expected 1 schedule in cron update, got %d", len(schedules))
+	}
+}
+
+func TestCronPreview(t *testing.T) {
+	tests := []struct {
+		name       string
+		respond    func(req socketRequest) socketResponse
+		expectCode int // Zero expects the preview
+	}{
+		{
+			name: "rendered by cmd",
+			respond: func(req socketRequest) socketResponse {
+				return socketResponse{Code: 200, Status: "OK", Data: map[string]interface{}{"content": "0 2 * * * root /usr/bin/dbcalm backup full\n"}}
+			},
+		},
+		{
+			name: "cmd without dry runs writes the file instead",
+			respond: func(req socketRequest) socketResponse {
+				return socketResponse{Code: 202, Status: "Accepted", ID: "cron-1"}
+			},
+			expectCode: 503,
+		},
+		{
+			name: "refused by cmd",
+			respond: func(req socketRequest) socketResponse {
+				return socketResponse{Code: 400, Status: "Bad Request", Message: "dry_run must be a boolean"}
+			},
+			expectCode: 503,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, tt.respond)
+			scheduleService := NewScheduleService(
+				sqlite.NewScheduleRepository(db),
+				sqlite.NewBackupRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				cmd.NewClient(socket.path, time.Second),
+				"/usr/bin/dbcalm",
+				t.TempDir(),
+				domain.CronSyncRollback,
+				domain.DuplicateScheduleAllow,
+				time.Local,
+			)
+			seedSchedule(t, db, "full")
+
+			content, count, err := scheduleService.CronPreview(context.Background())
+			req := socket.request(t, "update_cron_schedules")
+			if req.Args["dry_run"] != true {
+				t.Errorf("expected a dry run, got dry_run %v", req.Args["dry_run"])
+			}
+
+			if tt.expectCode != 0 {
+				var svcErr *ServiceError
+				if !errors.As(err, &svcErr) || svcErr.Code != tt.expectCode {
+					t.Fatalf("expected a %d ServiceError, got %v", tt.expectCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CronPreview failed: %v", err)
+			}
+			if count != 1 || !strings.Contains(content, "dbcalm backup full") {
+				t.Errorf("expected the rendered cron file for 1 schedule, got %d schedules and %q", count, content)
+			}
+		})
+	}
+}
+
+func TestBackupWindow(t *testing.T) {
+	at := func(d, hour, minute int) time.Time {
+		return time.Date(2026, time.March, d, hour, minute, 0, 0, time.UTC)
+	}
+	every := func(minutes int) *domain.Schedule {
+		unit := domain.IntervalUnitMinutes
+		return &domain.Schedule{Frequency: domain.FrequencyInterval, IntervalValue: ptr(minutes), IntervalUnit: &unit}
+	}
+
+	tests := []struct {
+		name        string
+		start, end  int
+		after       time.Time
+		expectNext  time.Time
+		expectInRun bool // Whether a run at after is inside the window
+	}{
+		{name: "inside window", start: 1, end: 5, after: at(10, 2, 0), expectNext: at(10, 2, 15), expectInRun: true},
+		{name: "last slot before window end", start: 1, end: 5, after: at(10, 4, 30), expectNext: at(10, 4, 45), expectInRun: true},
+		{name: "window end is exclusive", start: 1, end: 5, after: at(10, 4, 45), expectNext: at(11, 1, 0), expectInRun: true},
+		{name: "before window start", start: 1, end: 5, after: at(10, 0, 59), expectNext: at(10, 1, 0)},
+		{name: "wrapped window before midnight", start: 22, end: 6, after: at(10, 23, 50), expectNext: at(11, 0, 0), expectInRun: true},
+		{name: "wrapped window after midnight", start: 22, end: 6, after: at(11, 5, 45), expectNext: at(11, 22, 0), expectInRun: true},
+		{name: "outside wrapped window", start: 22, end: 6, after: at(11, 12, 0), expectNext: at(11, 22, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := every(15)
+			schedule.WindowStart = ptr(tt.start)
+			schedule.WindowEnd = ptr(tt.end)
+
+			next, ok := schedule.NextRunAfter(tt.after)
+			if !ok || !next.Equal(tt.expectNext) {
+				t.Errorf("expected next run %s, got %s (%v)", tt.expectNext, next, ok)
+			}
+			if got := schedule.InWindow(tt.after); got != tt.expectInRun {
+				t.Errorf("expected InWindow %v at %s, got %v", tt.expectInRun, tt.after, got)
+			}
+		})
+	}
+}
+
+func TestBackupWindowValidationAndSkip(t *testing.T) {
+	db := newTestDB(t)
+	socket := newFakeSocket(t, nil)
+	processRepo := sqlite.NewProcessRepository(db)
+	scheduleService := NewScheduleService(
+		sqlite.NewScheduleRepository(db),
+		sqlite.NewBackupRepository(db),
+		NewProcessService(processRepo),
+		cmd.NewClient(socket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.Local,
+	)
+	ctx := context.Background()
+	unit := domain.IntervalUnitMinutes
+
+	invalid := []struct {
+		name       string
+		frequency  domain.ScheduleFrequency
+		start, end *int
+		expected   string
+	}{
+		{name: "start without end", frequency: domain.FrequencyInterval, start: ptr(1), expected: "must be set together"},
+		{name: "hour out of range", frequency: domain.FrequencyInterval, start: ptr(22), end: ptr(24), expected: "must be hours 0-23"},
+		{name: "empty window", frequency: domain.FrequencyInterval, start: ptr(3), end: ptr(3), expected: "must differ"},
+		{name: "daily schedule", frequency: domain.FrequencyDaily, start: ptr(1), end: ptr(5), expected: "only supported for hourly and interval"},
+	}
+	for _, tt := range invalid {
+		schedule := &domain.Schedule{
+			BackupType:    domain.BackupTypeFull,
+			Frequency:     tt.frequency,
+			Hour:          ptr(2),
+			Minute:        ptr(0),
+			IntervalValue: ptr(15),
+			IntervalUnit:  &unit,
+			Strategy:      domain.BackupStrategyPhysical,
+			WindowStart:   tt.start,
+			WindowEnd:     tt.end,
+			Enabled:       true,
+		}
+		err := scheduleService.CreateSchedule(ctx, schedule)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	schedule := &domain.Schedule{
+		BackupType:    domain.BackupTypeFull,
+		Frequency:     domain.FrequencyInterval,
+		IntervalValue: ptr(15),
+		IntervalUnit:  &unit,
+		Strategy:      domain.BackupStrategyPhysical,
+		WindowStart:   ptr(22),
+		WindowEnd:     ptr(6),
+		Enabled:       true,
+	}
+	if err := scheduleService.CreateSchedule(ctx, schedule); err != nil {
+		t.Fatalf("CreateSchedule failed: %v", err)
+	}
+
+	inside := time.Date(2026, time.March, 10, 23, 15, 0, 0, time.Local)
+	if skipped, err := scheduleService.SkipOutsideWindow(ctx, schedule.ID, inside); err != nil || skipped != nil {
+		t.Fatalf("expected a run inside the window to go ahead, got %v, %v", skipped, err)
+	}
+
+	outside := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.Local)
+	skipped, err := scheduleService.SkipOutsideWindow(ctx, schedule.ID, outside)
+	if err != nil || skipped == nil {
+		t.Fatalf("expected a run outside the window to be skipped, got %v, %v", skipped, err)
+	}
+	stored, err := processRepo.FindByID(ctx, skipped.ID)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if stored.Status != domain.ProcessStatusSkipped || stored.Args["skip_reason"] != "outside_window" {
+		t.Errorf("expected a skipped process outside the window, got %s %v", stored.Status, stored.Args)
+	}
+
+	// The window is in the zone schedules run in, not the zone now happens to be in
+	zoned := NewScheduleService(
+		sqlite.NewScheduleRepository(db),
+		sqlite.NewBackupRepository(db),
+		NewProcessService(processRepo),
+		cmd.NewClient(socket.path, time.Second),
+		"/usr/bin/dbcalm",
+		t.TempDir(),
+		domain.CronSyncRollback,
+		domain.DuplicateScheduleAllow,
+		time.FixedZone("UTC+9", 9*60*60),
+	)
+	insideZoned := time.Date(2026, time.March, 10, 14, 15, 0, 0, time.UTC) // 23:15 at UTC+9
+	if skipped, err := zoned.SkipOutsideWindow(ctx, schedule.ID, insideZoned); err != nil || skipped != nil {
+		t.Errorf("expected a run inside the window in the schedule zone to go ahead, got %v, %v", skipped, err)
+	}
+}
+
+func TestCreatePreset(t *testing.T) {
+	failCron := func(req socketRequest) socketResponse {
+		if req.Cmd == "update_cron_schedules" {
+			return socketResponse{Code: 500, Status: "failed to write cron file"}
+		}
+		return acceptAll(req)
+	}
+	opts := domain.PresetOptions{DayOfWeek: 0, Hour: 2, Minute: 30, RetentionDays: 14, Enabled: true}
+
+	tests := []struct {
+		name          string
+		respond       func(socketRequest) socketResponse
+		failInsert    bool // The incremental schedule's insert fails
+		expectCreated bool
+	}{
+		{name: "created together", expectCreated: true},
+		{name: "cron failure rolls back", respond: failCron},
+		{name: "failed insert rolls back", failInsert: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			socket := newFakeSocket(t, tt.respond)
+			scheduleRepo := sqlite.NewScheduleRepository(db)
+			scheduleService := NewScheduleService(
+				scheduleRepo,
+				sqlite.NewBackupRepository(db),
+				NewProcessService(sqlite.NewProcessRepository(db)),
+				cmd.NewClient(socket.path, time.Second),
+				"/usr/bin/dbcalm",
+				t.TempDir(),
+				domain.CronSyncRollback,
+				domain.DuplicateScheduleAllow,
+				time.Local,
+			)
+			ctx := context.Background()
+			if tt.failInsert {
+				_, err := db.Exec(`
+					CREATE TRIGGER fail_incremental BEFORE INSERT ON schedule WHEN NEW.backup_type = 'incremental'
+					BEGIN SELECT RAISE(ABORT, 'insert failed'); END
+				`)
+				if err != nil {
+					t.Fatalf("failed to create trigger: %v", err)
+				}
+			}
+
+			schedules, err := scheduleService.CreatePreset(ctx, domain.PresetWeeklyFullDailyIncremental, opts)
+			stored, listErr := scheduleRepo.List(ctx, repository.ScheduleFilter{})
+			if listErr != nil {
+				t.Fatalf("List failed: %v", listErr)
+			}
+
+			if !tt.expectCreated {
+				if err == nil {
+					t.Fatal("expected CreatePreset to fail")
+				}
+				if len(stored) != 0 {
+					t.Errorf("expected no schedules after rollback, got %d", len(stored))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreatePreset failed: %v", err)
+			}
+			if len(schedules) != 2 || len(stored) != 2 {
+				t.Fatalf("expected 2 schedules, got %d created and %d stored", len(schedules), len(stored))
+			}
+			full, incremental := stored[0], stored[1]
+			if full.BackupType != domain.BackupTypeFull || !reflect.DeepEqual(full.Weekdays(), []int{0}) {
+				t.Errorf("expected a weekly full backup on Sunday, got %s on %v", full.BackupType, full.Weekdays())
+			}
+			if incremental.BackupType != domain.BackupTypeIncremental || !reflect.DeepEqual(incremental.Weekdays(), []int{1, 2, 3, 4, 5, 6}) {
+				t.Errorf("expected incrementals on the other days, got %s on %v", incremental.BackupType, incremental.Weekdays())
+			}
+			if *full.RetentionValue != 21 || *incremental.RetentionValue != 14 {
+				t.Errorf("expected retention of 21 and 14 days, got %d and %d", *full.RetentionValue, *incremental.RetentionValue)
+			}
+			if full.PresetGroup == nil || incremental.PresetGroup == nil || *full.PresetGroup != *incremental.PresetGroup {
+				t.Errorf("expected the schedules to share a preset group, got %v and %v", full.PresetGroup, incremental.PresetGroup)
+			}
+
+			// Cron is updated once, with both schedules
+			var cronUpdates int
+			for _, command := range socket.commands() {
+				if command == "update_cron_schedules" {
+					cronUpdates++
+				}
+			}
+			if cronUpdates != 1 {
+				t.Errorf("expected 1 cron update, got %d", cronUpdates)
+			}
+			cron := socket.request(t, "update_cron_schedules").Args["schedules"].([]interface{})
+			if len(cron) != 2 {
+				t.Errorf("expected 2 schedules in the cron update, got %d", len(cron))
+			}
+		})
+	}
+}
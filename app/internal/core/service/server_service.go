@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+	"github.com/martijn/dbcalm/internal/core/domain"
+)
+
+type ServerService struct {
+	dbClient *dbcmd.Client
+}
+
+func NewServerService(dbClient *dbcmd.Client) *ServerService {
+	return &ServerService{
+		dbClient: dbClient,
+	}
+}
+
+// GetServerInfo returns the server version and type as detected by db-cmd
+func (s *ServerService) GetServerInfo(ctx context.Context) (*domain.ServerInfo, error) {
+	return requireServerInfo(ctx, s.dbClient)
+}
+
+// TestConnection asks db-cmd to connect with a credentials section, nil for its configured
+// one. A refused connection is reported in the result, not as an error.
+func (s *ServerService) TestConnection(ctx context.Context, credentialsSuffix *string) (*domain.ConnectionTest, error) {
+	args := map[string]interface{}{}
+	if credentialsSuffix != nil {
+		if err := domain.ValidateCredentialsSuffix(*credentialsSuffix); err != nil {
+			return nil, NewServiceError(400, err.Error())
+		}
+		args["credentials_suffix"] = *credentialsSuffix
+	}
+
+	response, err := s.dbClient.SendCommand(ctx, "test_connection", args)
+	if err != nil {
+		return nil, NewServiceError(503, fmt.Sprintf("cannot test connection, db-cmd service is unreachable: %v", err))
+	}
+	if response.Code != 200 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return nil, NewServiceError(response.Code, errMsg)
+	}
+
+	result := &domain.ConnectionTest{}
+	result.Connected, _ = response.Data["connected"].(bool)
+	result.CredentialsSuffix, _ = response.Data["credentials_suffix"].(string)
+	result.DbType, _ = response.Data["db_type"].(string)
+	result.Version, _ = response.Data["version"].(string)
+	result.Error, _ = response.Data["error"].(string)
+	return result, nil
+}
+
+// requireServerInfo asks db-cmd for the server info and returns a 503 ServiceError
+// when it can't be determined. Backups and restores are gated on it.
+func requireServerInfo(ctx context.Context, dbClient *dbcmd.Client) (*domain.ServerInfo, error) {
+	response, err := dbClient.SendCommand(ctx, "server_info", nil)
+	if err != nil {
+		return nil, NewServiceError(503, fmt.Sprintf("cannot determine server info, db-cmd service is unreachable: %v", err))
+	}
+
+	if response.Code != 200 {
+		errMsg := response.Message
+		if errMsg == "" {
+			errMsg = response.Status
+		}
+		return nil, NewServiceError(503, fmt.Sprintf("cannot determine server info: %s", errMsg))
+	}
+
+	info := &domain.ServerInfo{}
+	info.DbType, _ = response.Data["db_type"].(string)
+	info.Version, _ = response.Data["version"].(string)
+	info.DumpAvailable, _ = response.Data["dump_available"].(bool)
+	info.ClientAvailable, _ = response.Data["client_available"].(bool)
+	info.Source, _ = response.Data["source"].(string)
+	if detectedAt, ok := response.Data["detected_at"].(string); ok {
+		info.DetectedAt, _ = time.Parse(time.RFC3339, detectedAt)
+	}
+
+	if info.Version == "" {
+		return nil, NewServiceError(503, "cannot determine server info: db-cmd did not report a server version")
+	}
+
+	return info, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/adapter/dbcmd"
+)
+
+func TestTestConnection(t *testing.T) {
+	socket := newFakeSocket(t, func(req socketRequest) socketResponse {
+		if req.Args["credentials_suffix"] == "-replica" {
+			return socketResponse{Code: 200, Status: "OK", Data: map[string]interface{}{
+				"connected":          false,
+				"credentials_suffix": "-replica",
+				"db_type":            "mariadb",
+				"error":              "connection with credentials [client-replica] failed: Access denied",
+			}}
+		}
+		return socketResponse{Code: 200, Status: "OK", Data: map[string]interface{}{
+			"connected":          true,
+			"credentials_suffix": "-dbcalm",
+			"db_type":            "mariadb",
+			"version":            "10.11.6",
+		}}
+	})
+	serverService := NewServerService(dbcmd.NewClient(socket.path, time.Second))
+
+	result, err := serverService.TestConnection(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("TestConnection failed: %v", err)
+	}
+	if !result.Connected || result.Version != "10.11.6" || result.CredentialsSuffix != "-dbcalm" {
+		t.Errorf("expected a connection to 10.11.6 with -dbcalm, got %+v", result)
+	}
+	if _, sent := socket.request(t, "test_connection").Args["credentials_suffix"]; sent {
+		t.Error("expected no credentials_suffix to be sent for the configured section")
+	}
+
+	result, err = serverService.TestConnection(context.Background(), ptr("-replica"))
+	if err != nil {
+		t.Fatalf("TestConnection failed: %v", err)
+	}
+	if result.Connected || result.Error == "" {
+		t.Errorf("expected a failed connection with an error, got %+v", result)
+	}
+
+	_, err = serverService.TestConnection(context.Background(), ptr("replica; rm -rf /"))
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) || svcErr.Code != 400 {
+		t.Fatalf("expected a 400 for an invalid suffix, got %v", err)
+	}
+}
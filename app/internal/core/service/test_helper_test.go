@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/infrastructure/sqlite"
+)
+
+// socketRequest mirrors the request sent by the dbcmd and cmd socket clients
+type socketRequest struct {
+	Cmd  string                 `json:"cmd"`
+	Args map[string]interface{} `json:"args"`
+}
+
+// socketResponse mirrors the response read by the dbcmd and cmd socket clients
+type socketResponse struct {
+	Code    int                    `json:"code"`
+	Status  string                 `json:"status"`
+	ID      string                 `json:"id,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// fakeSocket is a Unix socket server standing in for db-cmd/cmd in service tests
+type fakeSocket struct {
+	path     string
+	respond  func(req socketRequest) socketResponse
+	mu       sync.Mutex
+	requests []socketRequest
+}
+
+// newFakeSocket starts a fake socket server that answers every request with respond.
+// A nil respond reports a MariaDB server for server_info and accepts every other command with a 202.
+func newFakeSocket(t *testing.T, respond func(req socketRequest) socketResponse) *fakeSocket {
+	t.Helper()
+
+	if respond == nil {
+		respond = acceptAll
+	}
+
+	fs := &fakeSocket{
+		path:    filepath.Join(t.TempDir(), "test.sock"),
+		respond: respond,
+	}
+
+	listener, err := net.Listen("unix", fs.path)
+	if err != nil {
+		t.Fatalf("failed to listen on fake socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fs.handle(conn)
+		}
+	}()
+
+	return fs
+}
+
+func (fs *fakeSocket) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req socketRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	fs.mu.Lock()
+	fs.requests = append(fs.requests, req)
+	fs.mu.Unlock()
+
+	data, _ := json.Marshal(fs.respond(req))
+	conn.Write(data)
+}
+
+// acceptAll is the default fake socket responder
+func acceptAll(req socketRequest) socketResponse {
+	if req.Cmd == "server_info" {
+		return socketResponse{
+			Code:   200,
+			Status: "OK",
+			Data: map[string]interface{}{
+				"db_type":          "mariadb",
+				"version":          "10.11.6",
+				"dump_available":   true,
+				"client_available": true,
+			},
+		}
+	}
+	return socketResponse{Code: 202, Status: "Accepted", ID: "cmd-" + req.Cmd}
+}
+
+// request returns the first request received for cmd
+func (fs *fakeSocket) request(t *testing.T, cmd string) socketRequest {
+	t.Helper()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, req := range fs.requests {
+		if req.Cmd == cmd {
+			return req
+		}
+	}
+	t.Fatalf("no %s request received", cmd)
+	return socketRequest{}
+}
+
+// commands returns the commands received so far, in order
+func (fs *fakeSocket) commands() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	cmds := make([]string, len(fs.requests))
+	for i, req := range fs.requests {
+		cmds[i] = req.Cmd
+	}
+	return cmds
+}
+
+// newTestDB creates an in-memory SQLite database with the full schema
+func newTestDB(t *testing.T) *sqlite.DB {
+	t.Helper()
+
+	db, err := sqlite.New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// seedBackup inserts a backup (and the process it references) into the test database
+func seedBackup(t *testing.T, db *sqlite.DB, id string, fromBackupID *string, scheduleID *int64, startTime time.Time) {
+	t.Helper()
+
+	result, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES (?, 'mariabackup --backup', 0, 'success', ?, ?, 'backup', '{}')
+	`, "proc-"+id, startTime.Format(time.RFC3339), startTime.Add(10*time.Minute).Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("failed to seed process for %s: %v", id, err)
+	}
+	processID, _ := result.LastInsertId()
+
+	backupType := "full"
+	if fromBackupID != nil {
+		backupType = "incremental"
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO backup (id, type, from_backup_id, schedule_id, start_time, end_time, process_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, backupType, fromBackupID, scheduleID, startTime.Format(time.RFC3339), startTime.Add(10*time.Minute).Format(time.RFC3339), processID)
+	if err != nil {
+		t.Fatalf("failed to seed backup %s: %v", id, err)
+	}
+}
+
+// seedSchedule inserts a daily schedule and returns its ID
+func seedSchedule(t *testing.T, db *sqlite.DB, backupType string) int64 {
+	t.Helper()
+
+	now := time.Now().Format(time.RFC3339)
+	result, err := db.Exec(`
+		INSERT INTO schedule (backup_type, frequency, hour, minute, enabled, created_at, updated_at)
+		VALUES (?, 'daily', 2, 0, 1, ?, ?)
+	`, backupType, now, now)
+	if err != nil {
+		t.Fatalf("failed to seed schedule: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return id
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -89,11 +89,15 @@ func (r *authCodeRepository) Delete(ctx context.Context, code string) error {
 	return nil
 }
 
-func (r *authCodeRepository) DeleteExpired(ctx context.Context) error {
+func (r *authCodeRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
 	query := `DELETE FROM auth_code WHERE expires_at < ?`
-	_, err := r.db.ExecContext(ctx, query, time.Now())
+	result, err := r.db.ExecContext(ctx, query, FormatTime(now))
 	if err != nil {
-		return fmt.Errorf("failed to delete expired auth codes: %w", err)
+		return 0, fmt.Errorf("failed to delete expired auth codes: %w", err)
 	}
-	return nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return deleted, nil
 }
@@ -5,11 +5,28 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
 
+// restoreStatsJoin adds how often each backup was restored. The bare end_time is taken
+// from the row with MAX(end_time), and keeps its DATETIME type so it scans as a time.
+const restoreStatsJoin = `LEFT JOIN (
+			SELECT backup_id, COUNT(*) AS restore_count, end_time AS last_restored_at, MAX(end_time)
+			FROM restore GROUP BY backup_id
+		) restores ON restores.backup_id = backup.id`
+
+// latestPerScheduleCondition keeps the newest completed backup of every schedule. Ad-hoc
+// backups have a NULL schedule_id, which partitions them together.
+const latestPerScheduleCondition = ` AND backup.id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY schedule_id ORDER BY start_time DESC, id DESC) AS position
+				FROM backup WHERE end_time IS NOT NULL
+			) WHERE position = 1
+		)`
+
 type backupRepository struct {
 	db *DB
 }
@@ -20,8 +37,8 @@ func NewBackupRepository(db *DB) repository.BackupRepository {
 
 func (r *backupRepository) Create(ctx context.Context, backup *domain.Backup) error {
 	query := `
-		INSERT INTO backup (id, from_backup_id, schedule_id, start_time, end_time, process_id)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO backup (id, type, from_backup_id, schedule_id, strategy, excluded_databases, start_time, end_time, process_id, description, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var endTime sql.NullTime
@@ -29,13 +46,23 @@ func (r *backupRepository) Create(ctx context.Context, backup *domain.Backup) er
 		endTime = sql.NullTime{Valid: true, Time: *backup.EndTime}
 	}
 
-	_, err := r.db.ExecContext(ctx, query,
+	excludedDatabases, err := NullStringList(backup.ExcludedDatabases)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, query,
 		backup.ID,
+		backupType(backup),
 		NullString(backup.FromBackupID),
 		NullInt64(backup.ScheduleID),
+		backupStrategy(backup.Strategy),
+		excludedDatabases,
 		backup.StartTime,
 		endTime,
 		backup.ProcessID,
+		NullString(backup.Description),
+		NullString(backup.Source),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create backup: %w", err)
@@ -45,8 +72,9 @@ func (r *backupRepository) Create(ctx context.Context, backup *domain.Backup) er
 
 func (r *backupRepository) FindByID(ctx context.Context, id string) (*domain.Backup, error) {
 	query := `
-		SELECT id, from_backup_id, schedule_id, start_time, end_time, process_id
-		FROM backup
+		SELECT id, type, from_backup_id, schedule_id, strategy, excluded_databases, verification_status, last_verified_at, start_time, end_time, process_id, size, uncompressed_size, description, source, expires_at, grants_captured,
+			COALESCE(restores.restore_count, 0), restores.last_restored_at
+		FROM backup ` + restoreStatsJoin + `
 		WHERE id = ?
 	`
 	return r.scanBackup(r.db.QueryRowContext(ctx, query, id))
@@ -85,6 +113,29 @@ func (r *backupRepository) Update(ctx context.Context, backup *domain.Backup) er
 	return nil
 }
 
+// SetExpiresAt sets or, with nil, clears a backup's retention override
+func (r *backupRepository) SetExpiresAt(ctx context.Context, id string, expiresAt *time.Time) error {
+	var value sql.NullTime
+	if expiresAt != nil {
+		value = sql.NullTime{Valid: true, Time: *expiresAt}
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE backup SET expires_at = ? WHERE id = ?`, value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update backup expiry: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("backup not found: %s", id)
+	}
+
+	return nil
+}
+
 func (r *backupRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM backup WHERE id = ?`
 	result, err := r.db.ExecContext(ctx, query, id)
@@ -126,12 +177,17 @@ func (r *backupRepository) DeleteMany(ctx context.Context, ids []string) error {
 
 func (r *backupRepository) List(ctx context.Context, filter repository.BackupFilter) ([]*domain.Backup, error) {
 	query := `
-		SELECT id, from_backup_id, schedule_id, start_time, end_time, process_id
-		FROM backup
+		SELECT id, type, from_backup_id, schedule_id, strategy, excluded_databases, verification_status, last_verified_at, start_time, end_time, process_id, size, uncompressed_size, description, source, expires_at, grants_captured,
+			COALESCE(restores.restore_count, 0), restores.last_restored_at
+		FROM backup ` + restoreStatsJoin + `
 		WHERE 1=1
 	`
 	args := []interface{}{}
 
+	if filter.LatestPerSchedule {
+		query += latestPerScheduleCondition
+	}
+
 	// Apply filters
 	query, args = ApplyFilters(query, args, filter.Filters)
 
@@ -167,6 +223,10 @@ func (r *backupRepository) Count(ctx context.Context, filter repository.BackupFi
 	query := `SELECT COUNT(*) FROM backup WHERE 1=1`
 	args := []interface{}{}
 
+	if filter.LatestPerSchedule {
+		query += latestPerScheduleCondition
+	}
+
 	// Apply filters
 	query, args = ApplyFilters(query, args, filter.Filters)
 
@@ -179,21 +239,38 @@ func (r *backupRepository) Count(ctx context.Context, filter repository.BackupFi
 	return count, nil
 }
 
-func (r *backupRepository) FindLatestByScheduleAndType(ctx context.Context, scheduleID *int64, backupType domain.BackupType) (*domain.Backup, error) {
+func (r *backupRepository) FindLatestCompleted(ctx context.Context) (*domain.Backup, error) {
 	query := `
-		SELECT id, from_backup_id, schedule_id, start_time, end_time, process_id
-		FROM backup
+		SELECT id, type, from_backup_id, schedule_id, strategy, excluded_databases, verification_status, last_verified_at, start_time, end_time, process_id, size, uncompressed_size, description, source, expires_at, grants_captured,
+			COALESCE(restores.restore_count, 0), restores.last_restored_at
+		FROM backup ` + restoreStatsJoin + `
 		WHERE end_time IS NOT NULL
+		ORDER BY end_time DESC LIMIT 1
 	`
-	args := []interface{}{}
 
-	// Filter by type based on from_backup_id
-	if backupType == domain.BackupTypeFull {
-		query += " AND from_backup_id IS NULL"
-	} else {
-		query += " AND from_backup_id IS NOT NULL"
+	backup, err := r.scanBackup(r.db.QueryRowContext(ctx, query))
+	if err != nil {
+		if err.Error() == "backup not found" {
+			return nil, nil
+		}
+		return nil, err
 	}
 
+	return backup, nil
+}
+
+func (r *backupRepository) FindLatestByScheduleAndType(ctx context.Context, scheduleID *int64, backupType domain.BackupType) (*domain.Backup, error) {
+	query := `
+		SELECT id, type, from_backup_id, schedule_id, strategy, excluded_databases, verification_status, last_verified_at, start_time, end_time, process_id, size, uncompressed_size, description, source, expires_at, grants_captured,
+			COALESCE(restores.restore_count, 0), restores.last_restored_at
+		FROM backup ` + restoreStatsJoin + `
+		WHERE end_time IS NOT NULL AND type = ?
+	`
+	args := []interface{}{backupType}
+
+	// Logical dumps can't serve as an incremental base, so never hand one out here
+	query += " AND strategy = 'physical'"
+
 	if scheduleID != nil {
 		query += " AND schedule_id = ?"
 		args = append(args, *scheduleID)
@@ -214,12 +291,21 @@ func (r *backupRepository) FindLatestByScheduleAndType(ctx context.Context, sche
 	return backup, nil
 }
 
+// FindChain returns the chain ending in backupID, full backup first. The order follows
+// the from_backup_id links, never the timestamps, which incrementals can share.
 func (r *backupRepository) FindChain(ctx context.Context, backupID string) ([]*domain.Backup, error) {
 	// Walk backward from the given backup to find all backups in the chain
 	var chain []*domain.Backup
+	visited := make(map[string]bool)
 	currentID := backupID
 
 	for currentID != "" {
+		// A corrupt catalog could link backups in a loop, which would never reach a full backup
+		if visited[currentID] {
+			return nil, fmt.Errorf("circular backup chain: %s leads back to %s", backupID, currentID)
+		}
+		visited[currentID] = true
+
 		backup, err := r.FindByID(ctx, currentID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to find backup in chain: %w", err)
@@ -246,8 +332,9 @@ func (r *backupRepository) FindChain(ctx context.Context, backupID string) ([]*d
 
 func (r *backupRepository) FindBySchedule(ctx context.Context, scheduleID int64) ([]*domain.Backup, error) {
 	query := `
-		SELECT id, from_backup_id, schedule_id, start_time, end_time, process_id
-		FROM backup
+		SELECT id, type, from_backup_id, schedule_id, strategy, excluded_databases, verification_status, last_verified_at, start_time, end_time, process_id, size, uncompressed_size, description, source, expires_at, grants_captured,
+			COALESCE(restores.restore_count, 0), restores.last_restored_at
+		FROM backup ` + restoreStatsJoin + `
 		WHERE schedule_id = ?
 		ORDER BY start_time ASC
 	`
@@ -277,15 +364,32 @@ func (r *backupRepository) scanBackup(row *sql.Row) (*domain.Backup, error) {
 	var backup domain.Backup
 	var fromBackupID sql.NullString
 	var scheduleIDInt sql.NullInt64
-	var endTime sql.NullTime
+	var backupTypeStr, excludedDatabases, verification sql.NullString
+	var endTime, lastVerifiedAt, expiresAt sql.NullTime
+	var size, uncompressedSize sql.NullInt64
+	var description, source sql.NullString
+	var lastRestoredAt sql.NullTime
 
 	err := row.Scan(
 		&backup.ID,
+		&backupTypeStr,
 		&fromBackupID,
 		&scheduleIDInt,
+		&backup.Strategy,
+		&excludedDatabases,
+		&verification,
+		&lastVerifiedAt,
 		&backup.StartTime,
 		&endTime,
 		&backup.ProcessID,
+		&size,
+		&uncompressedSize,
+		&description,
+		&source,
+		&expiresAt,
+		&backup.GrantsCaptured,
+		&backup.RestoreCount,
+		&lastRestoredAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("backup not found")
@@ -294,12 +398,12 @@ func (r *backupRepository) scanBackup(row *sql.Row) (*domain.Backup, error) {
 		return nil, fmt.Errorf("failed to scan backup: %w", err)
 	}
 
-	// Infer type from from_backup_id: NULL = full, non-NULL = incremental
 	if fromBackupID.Valid {
 		backup.FromBackupID = &fromBackupID.String
-		backup.Type = domain.BackupTypeIncremental
-	} else {
-		backup.Type = domain.BackupTypeFull
+	}
+	backup.Type = domain.BackupType(backupTypeStr.String)
+	if !backupTypeStr.Valid {
+		backup.Type = backupType(&backup)
 	}
 
 	if scheduleIDInt.Valid {
@@ -308,6 +412,34 @@ func (r *backupRepository) scanBackup(row *sql.Row) (*domain.Backup, error) {
 	if endTime.Valid {
 		backup.EndTime = &endTime.Time
 	}
+	if backup.ExcludedDatabases, err = ParseStringList(excludedDatabases); err != nil {
+		return nil, fmt.Errorf("failed to scan backup: %w", err)
+	}
+	if verification.Valid {
+		status := domain.VerificationStatus(verification.String)
+		backup.Verification = &status
+	}
+	if lastVerifiedAt.Valid {
+		backup.LastVerifiedAt = &lastVerifiedAt.Time
+	}
+	if size.Valid {
+		backup.Size = &size.Int64
+	}
+	if uncompressedSize.Valid {
+		backup.UncompressedSize = &uncompressedSize.Int64
+	}
+	if description.Valid {
+		backup.Description = &description.String
+	}
+	if source.Valid {
+		backup.Source = &source.String
+	}
+	if expiresAt.Valid {
+		backup.ExpiresAt = &expiresAt.Time
+	}
+	if lastRestoredAt.Valid {
+		backup.LastRestoredAt = &lastRestoredAt.Time
+	}
 
 	return &backup, nil
 }
@@ -316,26 +448,43 @@ func (r *backupRepository) scanBackupRow(rows *sql.Rows) (*domain.Backup, error)
 	var backup domain.Backup
 	var fromBackupID sql.NullString
 	var scheduleID sql.NullInt64
-	var endTime sql.NullTime
+	var backupTypeStr, excludedDatabases, verification sql.NullString
+	var endTime, lastVerifiedAt, expiresAt sql.NullTime
+	var size, uncompressedSize sql.NullInt64
+	var description, source sql.NullString
+	var lastRestoredAt sql.NullTime
 
 	err := rows.Scan(
 		&backup.ID,
+		&backupTypeStr,
 		&fromBackupID,
 		&scheduleID,
+		&backup.Strategy,
+		&excludedDatabases,
+		&verification,
+		&lastVerifiedAt,
 		&backup.StartTime,
 		&endTime,
 		&backup.ProcessID,
+		&size,
+		&uncompressedSize,
+		&description,
+		&source,
+		&expiresAt,
+		&backup.GrantsCaptured,
+		&backup.RestoreCount,
+		&lastRestoredAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan backup: %w", err)
 	}
 
-	// Infer type from from_backup_id: NULL = full, non-NULL = incremental
 	if fromBackupID.Valid {
 		backup.FromBackupID = &fromBackupID.String
-		backup.Type = domain.BackupTypeIncremental
-	} else {
-		backup.Type = domain.BackupTypeFull
+	}
+	backup.Type = domain.BackupType(backupTypeStr.String)
+	if !backupTypeStr.Valid {
+		backup.Type = backupType(&backup)
 	}
 
 	if scheduleID.Valid {
@@ -344,6 +493,54 @@ func (r *backupRepository) scanBackupRow(rows *sql.Rows) (*domain.Backup, error)
 	if endTime.Valid {
 		backup.EndTime = &endTime.Time
 	}
+	if backup.ExcludedDatabases, err = ParseStringList(excludedDatabases); err != nil {
+		return nil, fmt.Errorf("failed to scan backup: %w", err)
+	}
+	if verification.Valid {
+		status := domain.VerificationStatus(verification.String)
+		backup.Verification = &status
+	}
+	if lastVerifiedAt.Valid {
+		backup.LastVerifiedAt = &lastVerifiedAt.Time
+	}
+	if size.Valid {
+		backup.Size = &size.Int64
+	}
+	if uncompressedSize.Valid {
+		backup.UncompressedSize = &uncompressedSize.Int64
+	}
+	if description.Valid {
+		backup.Description = &description.String
+	}
+	if source.Valid {
+		backup.Source = &source.String
+	}
+	if expiresAt.Valid {
+		backup.ExpiresAt = &expiresAt.Time
+	}
+	if lastRestoredAt.Valid {
+		backup.LastRestoredAt = &lastRestoredAt.Time
+	}
 
 	return &backup, nil
 }
+
+// backupType is the backup's type, inferred from its parent when unset: rows recorded
+// before the type column existed, and callers that only set from_backup_id
+func backupType(backup *domain.Backup) domain.BackupType {
+	if backup.Type != "" {
+		return backup.Type
+	}
+	if backup.FromBackupID != nil {
+		return domain.BackupTypeIncremental
+	}
+	return domain.BackupTypeFull
+}
+
+// backupStrategy defaults an unset strategy to physical
+func backupStrategy(strategy domain.BackupStrategy) domain.BackupStrategy {
+	if strategy == "" {
+		return domain.BackupStrategyPhysical
+	}
+	return strategy
+}
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFindChainRejectsCycle(t *testing.T) {
+	db, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, start_time, end_time, type, args)
+		VALUES ('proc-1', 'mariabackup --backup', 0, 'success', '2026-03-01T02:00:00Z', '2026-03-01T02:10:00Z', 'backup', '{}')
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed process: %v", err)
+	}
+	processID, _ := result.LastInsertId()
+
+	for _, stmt := range []string{
+		`INSERT INTO backup (id, type, from_backup_id, start_time, end_time, process_id)
+			VALUES ('full-1', 'full', NULL, '2026-03-01T02:00:00Z', '2026-03-01T02:10:00Z', ?)`,
+		`INSERT INTO backup (id, type, from_backup_id, start_time, end_time, process_id)
+			VALUES ('inc-1', 'incremental', 'full-1', '2026-03-02T02:00:00Z', '2026-03-02T02:10:00Z', ?)`,
+		`INSERT INTO backup (id, type, from_backup_id, start_time, end_time, process_id)
+			VALUES ('inc-2', 'incremental', 'inc-1', '2026-03-03T02:00:00Z', '2026-03-03T02:10:00Z', ?)`,
+	} {
+		if _, err := db.Exec(stmt, processID); err != nil {
+			t.Fatalf("failed to seed backup: %v", err)
+		}
+	}
+
+	repo := NewBackupRepository(db)
+
+	chain, err := repo.FindChain(context.Background(), "inc-2")
+	if err != nil {
+		t.Fatalf("FindChain failed on an intact chain: %v", err)
+	}
+	if len(chain) != 3 || chain[0].ID != "full-1" || chain[2].ID != "inc-2" {
+		t.Fatalf("expected chain full-1 -> inc-2, got %d backups", len(chain))
+	}
+
+	// Corrupt the catalog: the full backup now points at the newest incremental
+	if _, err := db.Exec(`UPDATE backup SET from_backup_id = 'inc-2' WHERE id = 'full-1'`); err != nil {
+		t.Fatalf("failed to create cycle: %v", err)
+	}
+
+	_, err = repo.FindChain(context.Background(), "inc-2")
+	if err == nil {
+		t.Fatal("expected an error for a circular chain")
+	}
+	if !strings.Contains(err.Error(), "circular backup chain") {
+		t.Errorf("expected circular backup chain error, got %v", err)
+	}
+}
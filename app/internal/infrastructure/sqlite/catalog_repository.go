@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+type catalogRepository struct {
+	db *DB
+}
+
+func NewCatalogRepository(db *DB) repository.CatalogRepository {
+	return &catalogRepository{db: db}
+}
+
+// BackupTo uses VACUUM INTO, which reads inside a transaction so the snapshot is
+// consistent while the API and db-cmd keep writing
+func (r *catalogRepository) BackupTo(ctx context.Context, path string) error {
+	if _, err := r.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up catalog: %w", err)
+	}
+	return nil
+}
+
+// RestoreFrom copies every table from the attached snapshot in a single transaction.
+// Columns are matched by name so snapshots taken before a column migration still restore.
+func (r *catalogRepository) RestoreFrom(ctx context.Context, path string) error {
+	// ATTACH and the foreign_keys pragma are per connection
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS snapshot", path); err != nil {
+		return fmt.Errorf("failed to open catalog snapshot: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE snapshot")
+
+	var check string
+	if err := conn.QueryRowContext(ctx, "PRAGMA snapshot.quick_check").Scan(&check); err != nil {
+		return fmt.Errorf("failed to check catalog snapshot: %w", err)
+	}
+	if check != "ok" {
+		return fmt.Errorf("catalog snapshot is corrupt: %s", check)
+	}
+
+	// Rows are restored table by table, so foreign keys are only consistent at the end
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("failed to disable foreign keys: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables, err := queryStrings(ctx, tx, "SELECT name FROM main.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for _, table := range tables {
+		columns, err := queryStrings(ctx, tx, `
+			SELECT m.name FROM pragma_table_info(?, 'main') m
+			JOIN pragma_table_info(?, 'snapshot') s ON s.name = m.name
+		`, table, table)
+		if err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM main.%s", table)); err != nil {
+			return fmt.Errorf("failed to clear table %s: %w", table, err)
+		}
+		// Tables the snapshot doesn't have yet are left empty
+		if len(columns) == 0 {
+			continue
+		}
+
+		columnList := strings.Join(columns, ", ")
+		query := fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM snapshot.%s", table, columnList, columnList, table)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to restore table %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit catalog restore: %w", err)
+	}
+	return nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryStrings returns the single string column of every row
+func queryStrings(ctx context.Context, q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
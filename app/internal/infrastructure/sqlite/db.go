@@ -2,7 +2,12 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
@@ -39,6 +44,7 @@ CREATE TABLE IF NOT EXISTS schedule (
 	backup_type TEXT NOT NULL,
 	frequency TEXT NOT NULL,
 	day_of_week INTEGER,
+	days_of_week TEXT, -- comma-separated, for weekly schedules on more than one day
 	day_of_month INTEGER,
 	hour INTEGER,
 	minute INTEGER,
@@ -46,6 +52,15 @@ CREATE TABLE IF NOT EXISTS schedule (
 	interval_unit TEXT,
 	retention_value INTEGER,
 	retention_unit TEXT,
+	strategy TEXT NOT NULL DEFAULT 'physical', -- physical or logical
+	exclude_databases TEXT, -- JSON array
+	pre_backup_hook TEXT,
+	post_backup_hook TEXT,
+	verify_on_completion INTEGER NOT NULL DEFAULT 0,
+	credentials_suffix TEXT,
+	window_start INTEGER, -- hour runs may start from, 0-23
+	window_end INTEGER, -- hour runs must start before, can wrap past midnight
+	preset_group TEXT, -- shared by the schedules a preset created together
 	enabled INTEGER NOT NULL DEFAULT 1,
 	created_at DATETIME NOT NULL,
 	updated_at DATETIME NOT NULL
@@ -63,17 +78,31 @@ CREATE TABLE IF NOT EXISTS process (
 	start_time DATETIME NOT NULL,
 	end_time DATETIME,
 	type TEXT NOT NULL,
-	args TEXT NOT NULL -- JSON object
+	args TEXT NOT NULL, -- JSON object
+	progress INTEGER, -- 0-100, reported by db-cmd during restores
+	phase TEXT,
+	schedule_id INTEGER, -- schedule of a backup process, denormalized from the backup for filtering
+	retry_of TEXT -- command_id of the failed process this one retries
 );
 
 CREATE TABLE IF NOT EXISTS backup (
 	id TEXT PRIMARY KEY,
+	type TEXT, -- full or incremental, NULL only on rows from before the column existed
 	from_backup_id TEXT,
 	schedule_id INTEGER,
+	strategy TEXT NOT NULL DEFAULT 'physical', -- physical or logical
+	excluded_databases TEXT, -- JSON array, databases deliberately left out of the backup
+	verification_status TEXT, -- passed or failed, NULL until verified
+	last_verified_at DATETIME,
 	start_time DATETIME NOT NULL,
 	end_time DATETIME,
 	process_id INTEGER NOT NULL,
-	size INTEGER,
+	size INTEGER, -- bytes on disk
+	uncompressed_size INTEGER, -- bytes before compression, NULL when the backup isn't compressed
+	description TEXT, -- operator's note on why the backup was taken
+	source TEXT, -- primary or replica, the role of the server the backup was taken from
+	expires_at DATETIME, -- overrides the schedule's retention while in the future
+	grants_captured INTEGER NOT NULL DEFAULT 0, -- grants.sql was captured with the backup, for grants restores
 	FOREIGN KEY (from_backup_id) REFERENCES backup(id) ON DELETE CASCADE,
 	FOREIGN KEY (schedule_id) REFERENCES schedule(id) ON DELETE SET NULL,
 	FOREIGN KEY (process_id) REFERENCES process(id) ON DELETE CASCADE
@@ -85,6 +114,10 @@ CREATE TABLE IF NOT EXISTS restore (
 	backup_timestamp DATETIME NOT NULL,
 	target TEXT NOT NULL,
 	target_path TEXT NOT NULL,
+	archive INTEGER NOT NULL DEFAULT 0, -- target_path is a tar.zst archive of the prepared folder
+	mode TEXT NOT NULL DEFAULT 'physical', -- physical, logical or grants
+	databases TEXT, -- JSON array, the databases the restore was limited to
+	safety_copy_path TEXT, -- copy of the data directory taken before a database restore
 	start_time DATETIME NOT NULL,
 	end_time DATETIME,
 	process_id INTEGER NOT NULL,
@@ -92,47 +125,300 @@ CREATE TABLE IF NOT EXISTS restore (
 	FOREIGN KEY (process_id) REFERENCES process(id) ON DELETE CASCADE
 );
 
+-- Single row (id = 1) holding the global maintenance-mode state
+CREATE TABLE IF NOT EXISTS maintenance (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	enabled INTEGER NOT NULL DEFAULT 0,
+	block_manual INTEGER NOT NULL DEFAULT 1,
+	reason TEXT,
+	updated_at DATETIME NOT NULL
+);
+
+-- Idempotency-Key headers of backup and restore requests, with the response they got
+CREATE TABLE IF NOT EXISTS idempotency_key (
+	key TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0, -- 0 while the request is running
+	response TEXT,
+	command_id TEXT,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (owner, key)
+);
+
 CREATE INDEX IF NOT EXISTS idx_backups_schedule_id ON backup(schedule_id);
 CREATE INDEX IF NOT EXISTS idx_backups_start_time ON backup(start_time);
 CREATE INDEX IF NOT EXISTS idx_processes_status ON process(status);
 CREATE INDEX IF NOT EXISTS idx_processes_type ON process(type);
 CREATE INDEX IF NOT EXISTS idx_processes_command_id ON process(command_id);
 CREATE INDEX IF NOT EXISTS idx_auth_codes_expires_at ON auth_code(expires_at);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_key(created_at);
+`
+
+// columnMigrations adds columns introduced after the initial schema to existing databases.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so new columns go in both places.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"process", "progress", "INTEGER"},
+	{"process", "phase", "TEXT"},
+	{"restore", "mode", "TEXT NOT NULL DEFAULT 'physical'"},
+	{"backup", "strategy", "TEXT NOT NULL DEFAULT 'physical'"},
+	{"schedule", "strategy", "TEXT NOT NULL DEFAULT 'physical'"},
+	{"backup", "excluded_databases", "TEXT"},
+	{"schedule", "exclude_databases", "TEXT"},
+	{"schedule", "pre_backup_hook", "TEXT"},
+	{"schedule", "post_backup_hook", "TEXT"},
+	{"schedule", "verify_on_completion", "INTEGER NOT NULL DEFAULT 0"},
+	{"schedule", "credentials_suffix", "TEXT"},
+	{"backup", "verification_status", "TEXT"},
+	{"backup", "last_verified_at", "DATETIME"},
+	{"process", "schedule_id", "INTEGER"},
+	{"backup", "type", "TEXT"},
+	{"schedule", "days_of_week", "TEXT"},
+	{"backup", "uncompressed_size", "INTEGER"},
+	{"schedule", "window_start", "INTEGER"},
+	{"schedule", "window_end", "INTEGER"},
+	{"restore", "databases", "TEXT"},
+	{"schedule", "preset_group", "TEXT"},
+	{"backup", "description", "TEXT"},
+	{"restore", "archive", "INTEGER NOT NULL DEFAULT 0"},
+	{"backup", "source", "TEXT"},
+	{"process", "retry_of", "TEXT"},
+	{"restore", "safety_copy_path", "TEXT"},
+	{"backup", "expires_at", "DATETIME"},
+	{"backup", "grants_captured", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// TimeFormat is how the catalog stores timestamps: UTC to the millisecond, the format
+// SQLite's strftime('%Y-%m-%d %H:%M:%f') produces. Stored alike, they sort and compare
+// as strings, so SQL can order and filter on them.
+const TimeFormat = "2006-01-02 15:04:05.000"
+
+// FormatTime formats t the way the catalog stores timestamps, for comparing against them
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// timestampColumns are the DATETIME columns kept in TimeFormat
+var timestampColumns = []struct {
+	table  string
+	column string
+}{
+	{"user", "created_at"}, {"user", "updated_at"},
+	{"client", "created_at"}, {"client", "updated_at"},
+	{"auth_code", "expires_at"}, {"auth_code", "created_at"},
+	{"schedule", "created_at"}, {"schedule", "updated_at"},
+	{"process", "start_time"}, {"process", "end_time"},
+	{"backup", "last_verified_at"}, {"backup", "start_time"}, {"backup", "end_time"}, {"backup", "expires_at"},
+	{"restore", "backup_timestamp"}, {"restore", "start_time"}, {"restore", "end_time"},
+	{"maintenance", "updated_at"},
+	{"idempotency_key", "created_at"},
+}
+
+// sqliteTimeFormat is TimeFormat as a SQLite expression, applied to the column named by %s
+const sqliteTimeFormat = "strftime('%%Y-%%m-%%d %%H:%%M:%%f', %s)"
+
+// timestampTriggers rewrite every timestamp written in another format SQLite can parse,
+// whoever writes it: the app, db-cmd or an older version. The condition is NULL, and
+// the trigger skipped, for NULL and unparseable values.
+const timestampTriggers = `
+CREATE TRIGGER IF NOT EXISTS normalize_{table}_{column}_insert AFTER INSERT ON {table}
+WHEN NEW.{column} != {normalized}
+BEGIN UPDATE {table} SET {column} = {normalized} WHERE rowid = NEW.rowid; END;
+CREATE TRIGGER IF NOT EXISTS normalize_{table}_{column}_update AFTER UPDATE OF {column} ON {table}
+WHEN NEW.{column} != {normalized}
+BEGIN UPDATE {table} SET {column} = {normalized} WHERE rowid = NEW.rowid; END;
 `
 
+// legacyTimeFormat is how the driver wrote time.Time values before _time_format was set,
+// time.Time.String() without the monotonic clock reading
+const legacyTimeFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+
 type DB struct {
 	*sqlx.DB
 }
 
+// PoolOptions limits the connections the DB handle keeps to the catalog. WAL lets many
+// readers work next to the single writer, more connections than that only queue up on
+// the lock. Zero values leave database/sql's own defaults.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Pool limits New uses
+const (
+	DefaultMaxOpenConns    = 8
+	DefaultMaxIdleConns    = 4
+	DefaultConnMaxLifetime = time.Hour
+)
+
+// DefaultPoolOptions is the pool New opens the catalog with
+func DefaultPoolOptions() PoolOptions {
+	return PoolOptions{
+		MaxOpenConns:    DefaultMaxOpenConns,
+		MaxIdleConns:    DefaultMaxIdleConns,
+		ConnMaxLifetime: DefaultConnMaxLifetime,
+	}
+}
+
 func New(dbPath string) (*DB, error) {
-	db, err := sqlx.Connect("sqlite", dbPath)
+	return NewWithPool(dbPath, DefaultPoolOptions())
+}
+
+// NewWithPool opens the catalog at dbPath with the given pool limits
+func NewWithPool(dbPath string, pool PoolOptions) (*DB, error) {
+	// Pragmas in the DSN run on every connection the pool opens, not only the first.
+	// busy_timeout handles concurrent access from multiple services. _time_format writes
+	// times in a format SQLite parses, so the timestamp triggers can normalize them.
+	db, err := sqlx.Connect("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_time_format=sqlite")
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Every connection to :memory: gets a database of its own, so it has to stay at one
+	if dbPath == ":memory:" {
+		pool = PoolOptions{MaxOpenConns: 1, MaxIdleConns: 1}
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
 	// Enable WAL mode for better concurrency (allows concurrent reads/writes)
 	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
 		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
-	// Set busy timeout to handle concurrent access from multiple services
-	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
-		return nil, fmt.Errorf("failed to set busy timeout: %w", err)
+	// Create tables
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	// Add columns missing from databases created by older versions
+	if err := migrateColumns(db); err != nil {
+		return nil, err
 	}
 
-	// Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+	if err := normalizeTimestamps(db); err != nil {
+		return nil, err
 	}
 
-	// Create tables
-	if _, err := db.Exec(schema); err != nil {
-		return nil, fmt.Errorf("failed to create schema: %w", err)
+	// Backups recorded before backup.type existed get the type their parent implies
+	if _, err := db.Exec(`
+		UPDATE backup SET type = CASE WHEN from_backup_id IS NULL THEN 'full' ELSE 'incremental' END
+		WHERE type IS NULL
+	`); err != nil {
+		return nil, fmt.Errorf("failed to backfill backup types: %w", err)
+	}
+
+	// Backup processes recorded before process.schedule_id existed take it from their backup
+	if _, err := db.Exec(`
+		UPDATE process SET schedule_id = (SELECT backup.schedule_id FROM backup WHERE backup.process_id = process.id)
+		WHERE schedule_id IS NULL AND type = 'backup'
+	`); err != nil {
+		return nil, fmt.Errorf("failed to backfill process schedules: %w", err)
 	}
 
 	return &DB{db}, nil
 }
 
+// migrateColumns adds any column from columnMigrations that the table does not have yet
+func migrateColumns(db *sqlx.DB) error {
+	for _, m := range columnMigrations {
+		var count int
+		err := db.Get(&count, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", m.table, m.column)
+		if err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", m.table, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+// normalizeTimestamps creates the triggers keeping timestamps in TimeFormat. A column gets
+// them together with the rewrite of the timestamps stored before, so one that has them
+// was rewritten already and is skipped.
+func normalizeTimestamps(db *sqlx.DB) error {
+	var names []string
+	if err := db.Select(&names, `SELECT name FROM sqlite_master WHERE type = 'trigger'`); err != nil {
+		return fmt.Errorf("failed to list triggers: %w", err)
+	}
+	triggers := make(map[string]bool, len(names))
+	for _, name := range names {
+		triggers[name] = true
+	}
+
+	for _, c := range timestampColumns {
+		if triggers[fmt.Sprintf("normalize_%s_%s_update", c.table, c.column)] {
+			continue
+		}
+		if err := normalizeColumn(db, c.table, c.column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeColumn rewrites the timestamps of one column into TimeFormat and creates its
+// triggers. Values SQLite can't parse were written by older versions of the driver and
+// are parsed here instead, any other value is logged and left as it is.
+func normalizeColumn(db *sqlx.DB, table, column string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	normalized := fmt.Sprintf(sqliteTimeFormat, column)
+	if _, err := tx.Exec(fmt.Sprintf(`UPDATE "%s" SET %s = %s WHERE %[2]s != %[3]s`, table, column, normalized)); err != nil {
+		return fmt.Errorf("failed to normalize %s.%s: %w", table, column, err)
+	}
+
+	// CAST drops the column type, so the driver hands over the stored text as is
+	var legacy []struct {
+		RowID int64  `db:"row_id"`
+		Value string `db:"value"`
+	}
+	query := fmt.Sprintf(`SELECT rowid AS row_id, CAST(%[1]s AS TEXT) AS value FROM "%[2]s" WHERE %[1]s IS NOT NULL AND %[3]s IS NULL`,
+		column, table, normalized)
+	if err := tx.Select(&legacy, query); err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+	}
+	for _, row := range legacy {
+		value, _, _ := strings.Cut(row.Value, " m=")
+		t, err := time.Parse(legacyTimeFormat, value)
+		if err != nil {
+			log.Printf("Warning: leaving %s.%s of row %d as %q, it isn't a timestamp: %v", table, column, row.RowID, row.Value, err)
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE "%s" SET %s = ? WHERE rowid = ?`, table, column), FormatTime(t), row.RowID); err != nil {
+			return fmt.Errorf("failed to normalize %s.%s: %w", table, column, err)
+		}
+	}
+
+	replacer := strings.NewReplacer("{table}", table, "{column}", column,
+		"{normalized}", fmt.Sprintf(sqliteTimeFormat, "NEW."+column))
+	if _, err := tx.Exec(replacer.Replace(timestampTriggers)); err != nil {
+		return fmt.Errorf("failed to create timestamp triggers for %s.%s: %w", table, column, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
@@ -161,6 +447,59 @@ func NullInt(i *int) sql.NullInt64 {
 	return sql.NullInt64{Int64: int64(*i), Valid: true}
 }
 
+// NullStringList stores an optional string list as a JSON array, NULL when empty
+func NullStringList(list []string) (sql.NullString, error) {
+	if len(list) == 0 {
+		return sql.NullString{Valid: false}, nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal list: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// ParseStringList reads a list stored by NullStringList
+func ParseStringList(s sql.NullString) ([]string, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(s.String), &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal list: %w", err)
+	}
+	return list, nil
+}
+
+// NullIntList stores an optional int list as a comma-separated string, NULL when empty
+func NullIntList(list []int) sql.NullString {
+	if len(list) == 0 {
+		return sql.NullString{Valid: false}
+	}
+	parts := make([]string, len(list))
+	for i, v := range list {
+		parts[i] = strconv.Itoa(v)
+	}
+	return sql.NullString{String: strings.Join(parts, ","), Valid: true}
+}
+
+// ParseIntList reads a list stored by NullIntList
+func ParseIntList(s sql.NullString) ([]int, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s.String, ",")
+	list := make([]int, len(parts))
+	for i, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse int list %q: %w", s.String, err)
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
 // NullTime helper for optional time fields
 func NullTime(t *interface{}) sql.NullTime {
 	if t == nil {
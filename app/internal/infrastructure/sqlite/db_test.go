@@ -0,0 +1,204 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/api/util"
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+// writeBackup records a backup and the process that took it, as db-cmd would
+func writeBackup(ctx context.Context, db *DB, id string) error {
+	now := time.Now()
+	process := &domain.Process{
+		CommandID: "proc-" + id,
+		Command:   "mariabackup --backup",
+		Status:    domain.ProcessStatusSuccess,
+		StartTime: now,
+		EndTime:   &now,
+		Type:      domain.ProcessTypeBackup,
+	}
+	if err := NewProcessRepository(db).Create(ctx, process); err != nil {
+		return err
+	}
+	return NewBackupRepository(db).Create(ctx, &domain.Backup{
+		ID:        id,
+		Type:      domain.BackupTypeFull,
+		Strategy:  domain.BackupStrategyPhysical,
+		StartTime: now,
+		EndTime:   &now,
+		ProcessID: process.ID,
+	})
+}
+
+// listAndWrite runs writers goroutines recording backups next to as many listing the
+// catalog, and returns the first error any of them ran into
+func listAndWrite(ctx context.Context, db *DB, prefix string, writers, perWriter int) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	backupRepo := NewBackupRepository(db)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := writeBackup(ctx, db, fmt.Sprintf("%s-%d-%d", prefix, w, i)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if _, err := backupRepo.List(ctx, repository.BackupFilter{ListFilter: util.ListFilter{PerPage: 25}}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func TestPoolHandlesConcurrentListsAndWrites(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	const writers, perWriter = 16, 20
+	if err := listAndWrite(ctx, db, "backup", writers, perWriter); err != nil {
+		t.Fatalf("concurrent list and write failed: %v", err)
+	}
+
+	count, err := NewBackupRepository(db).Count(ctx, repository.BackupFilter{})
+	if err != nil {
+		t.Fatalf("failed to count backups: %v", err)
+	}
+	if count != writers*perWriter {
+		t.Errorf("expected %d backups, got %d", writers*perWriter, count)
+	}
+	if open := db.Stats().MaxOpenConnections; open != DefaultMaxOpenConns {
+		t.Errorf("expected at most %d connections, got %d", DefaultMaxOpenConns, open)
+	}
+
+	// Every connection the pool opened enforces foreign keys, not only the first
+	var conns []*sql.Conn
+	for i := 0; i < DefaultMaxOpenConns; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get connection: %v", err)
+		}
+		conns = append(conns, conn)
+
+		var enabled int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled); err != nil {
+			t.Fatalf("failed to read foreign_keys: %v", err)
+		}
+		if enabled != 1 {
+			t.Errorf("expected foreign keys on connection %d", i)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func BenchmarkConcurrentListAndWrite(b *testing.B) {
+	db, err := New(filepath.Join(b.TempDir(), "db.sqlite3"))
+	if err != nil {
+		b.Fatalf("failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := listAndWrite(context.Background(), db, fmt.Sprintf("run%d", n), 8, 5); err != nil {
+			b.Fatalf("concurrent list and write failed: %v", err)
+		}
+	}
+}
+
+func TestTimestampsNormalized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.sqlite3")
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+
+	// A catalog of an older version has no triggers yet
+	if _, err := db.Exec(`DROP TRIGGER normalize_process_start_time_insert; DROP TRIGGER normalize_process_start_time_update`); err != nil {
+		t.Fatalf("failed to drop triggers: %v", err)
+	}
+
+	// Written the ways older versions, db-cmd and Python did
+	written := map[string]string{
+		"rfc3339": "2025-11-16T10:00:00Z",
+		"offset":  "2025-11-16 12:00:00.5+02:00",
+		"python":  "2025-11-16 10:00:00",
+		"legacy":  "2025-11-16 12:00:00.25 +0200 CEST m=+0.000012",
+		"garbage": "sometime on sunday",
+	}
+	for id, value := range written {
+		if _, err := db.Exec(`INSERT INTO process (command_id, command, status, start_time, type, args) VALUES (?, 'mariabackup', 'success', ?, 'backup', '{}')`, id, value); err != nil {
+			t.Fatalf("failed to insert %s: %v", id, err)
+		}
+	}
+	db.Close()
+
+	// Reopening rewrites them and creates the triggers
+	db, err = New(path)
+	if err != nil {
+		t.Fatalf("failed to reopen test database: %v", err)
+	}
+	defer db.Close()
+
+	expected := map[string]string{
+		"rfc3339": "2025-11-16 10:00:00.000",
+		"offset":  "2025-11-16 10:00:00.500",
+		"python":  "2025-11-16 10:00:00.000",
+		"legacy":  "2025-11-16 10:00:00.250",
+		"garbage": "sometime on sunday",
+	}
+	for id, want := range expected {
+		var stored string
+		if err := db.QueryRow(`SELECT CAST(start_time AS TEXT) FROM process WHERE command_id = ?`, id).Scan(&stored); err != nil {
+			t.Fatalf("failed to read %s: %v", id, err)
+		}
+		if stored != want {
+			t.Errorf("%s: expected %q, got %q", id, want, stored)
+		}
+	}
+
+	// Times the app writes go through the same triggers
+	process := &domain.Process{
+		CommandID: "written",
+		Command:   "mariabackup",
+		Status:    domain.ProcessStatusSuccess,
+		StartTime: time.Date(2025, 11, 16, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Type:      domain.ProcessTypeBackup,
+	}
+	if err := NewProcessRepository(db).Create(context.Background(), process); err != nil {
+		t.Fatalf("failed to create process: %v", err)
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT CAST(start_time AS TEXT) FROM process WHERE command_id = 'written'`).Scan(&stored); err != nil {
+		t.Fatalf("failed to read process: %v", err)
+	}
+	if stored != "2025-11-16 10:00:00.000" {
+		t.Errorf("expected the written time in UTC, got %q", stored)
+	}
+}
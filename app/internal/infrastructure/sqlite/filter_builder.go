@@ -15,21 +15,28 @@ var datetimeFields = map[string]bool{
 	"backup_timestamp": true,
 	"created_at":       true,
 	"updated_at":       true,
+	"last_verified_at": true,
+	"expires_at":       true,
 }
 
+// booleanFields are computed fields filtered on as true or false, mapped to the condition
+// that makes them true. COALESCE keeps the negated condition true for NULL columns.
+var booleanFields = map[string]string{
+	"verified": "COALESCE(verification_status, '') = 'passed'",
+	"healthy":  "COALESCE(verification_status, '') != 'failed'",
+}
+
+// likeEscaper escapes LIKE's wildcards, and the escape character itself, in a contains value
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // isDatetimeField checks if a field is a datetime field
 func isDatetimeField(field string) bool {
 	return datetimeFields[field]
 }
 
-// normalizeDateTime attempts to parse and normalize datetime strings for consistent comparison
-// Python's Peewee ORM stores datetime as "2025-11-24 14:00:00" (with space, no timezone)
-// Go's modernc/sqlite stores as "2025-11-24T14:00:00.123456789Z" (with T and timezone)
-// User input like "2025-11-24T00:00" needs to be normalized to work with both formats.
-// We use space separator format since it compares correctly with both stored formats:
-// - "2025-11-24 00:00:00" <= "2025-11-24 14:00:00" (Python format) ✓
-// - "2025-11-24 00:00:00" <= "2025-11-24T14:00:00.123456789Z" (Go format) ✓
-//   (space ASCII 32 < T ASCII 84)
+// normalizeDateTime attempts to parse and normalize datetime strings for consistent comparison.
+// Stored timestamps are in TimeFormat, user input like "2025-11-24T00:00" is brought into
+// the same format so it compares correctly as a string.
 func normalizeDateTime(value string) string {
 	// Try various input formats that users might provide
 	formats := []string{
@@ -44,9 +51,7 @@ func normalizeDateTime(value string) string {
 
 	for _, format := range formats {
 		if t, err := time.Parse(format, value); err == nil {
-			// Return in space-separated format (like Python's Peewee uses)
-			// This compares correctly with both Python and Go stored formats
-			return t.UTC().Format("2006-01-02 15:04:05")
+			return FormatTime(t)
 		}
 	}
 
@@ -56,6 +61,17 @@ func normalizeDateTime(value string) string {
 
 // BuildFilterClause builds a SQL WHERE clause from a QueryFilter
 func BuildFilterClause(f util.QueryFilter) (string, []interface{}) {
+	if condition, ok := booleanFields[f.Field]; ok {
+		want, _ := f.Value.(bool)
+		if f.Operator == util.OpNe {
+			want = !want
+		}
+		if !want {
+			return fmt.Sprintf("NOT (%s)", condition), nil
+		}
+		return condition, nil
+	}
+
 	// Normalize datetime values for consistent string comparison in SQLite
 	value := f.Value
 	if isDatetimeField(f.Field) {
@@ -77,6 +93,10 @@ func BuildFilterClause(f util.QueryFilter) (string, []interface{}) {
 		return fmt.Sprintf("%s < ?", f.Field), []interface{}{value}
 	case util.OpLte:
 		return fmt.Sprintf("%s <= ?", f.Field), []interface{}{value}
+	case util.OpContains:
+		// LIKE is case-insensitive for ASCII in SQLite, the value's wildcards match literally
+		escaped := likeEscaper.Replace(fmt.Sprint(f.Value))
+		return fmt.Sprintf("%s LIKE ? ESCAPE '\\'", f.Field), []interface{}{"%" + escaped + "%"}
 	case util.OpIsNull:
 		return fmt.Sprintf("%s IS NULL", f.Field), nil
 	case util.OpIsNotNull:
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+type idempotencyRepository struct {
+	db *DB
+}
+
+func NewIdempotencyRepository(db *DB) repository.IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Create(ctx context.Context, key *domain.IdempotencyKey) (bool, error) {
+	query := `
+		INSERT INTO idempotency_key (key, owner, method, path, status_code, created_at)
+		VALUES (?, ?, ?, ?, 0, ?)
+		ON CONFLICT(owner, key) DO NOTHING
+	`
+	result, err := r.db.ExecContext(ctx, query, key.Key, key.Owner, key.Method, key.Path, key.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create idempotency key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to create idempotency key: %w", err)
+	}
+	return rows == 1, nil
+}
+
+func (r *idempotencyRepository) Find(ctx context.Context, owner, key string) (*domain.IdempotencyKey, error) {
+	query := `
+		SELECT key, owner, method, path, status_code, response, command_id, created_at
+		FROM idempotency_key
+		WHERE owner = ? AND key = ?
+	`
+	var found domain.IdempotencyKey
+	var response, commandID sql.NullString
+	err := r.db.QueryRowContext(ctx, query, owner, key).Scan(
+		&found.Key,
+		&found.Owner,
+		&found.Method,
+		&found.Path,
+		&found.StatusCode,
+		&response,
+		&commandID,
+		&found.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if response.Valid {
+		found.Response = []byte(response.String)
+	}
+	if commandID.Valid {
+		found.CommandID = &commandID.String
+	}
+	return &found, nil
+}
+
+func (r *idempotencyRepository) SaveResponse(ctx context.Context, key *domain.IdempotencyKey) error {
+	query := `
+		UPDATE idempotency_key
+		SET status_code = ?, response = ?, command_id = ?
+		WHERE owner = ? AND key = ?
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		key.StatusCode,
+		string(key.Response),
+		NullString(key.CommandID),
+		key.Owner,
+		key.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, owner, key string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE owner = ? AND key = ?`, owner, key); err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *idempotencyRepository) DeleteCreatedBefore(ctx context.Context, before time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE created_at < ?`, FormatTime(before)); err != nil {
+		return fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/martijn/dbcalm/internal/core/domain"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+type maintenanceRepository struct {
+	db *DB
+}
+
+func NewMaintenanceRepository(db *DB) repository.MaintenanceRepository {
+	return &maintenanceRepository{db: db}
+}
+
+func (r *maintenanceRepository) Get(ctx context.Context) (*domain.Maintenance, error) {
+	query := `
+		SELECT enabled, block_manual, reason, updated_at
+		FROM maintenance
+		WHERE id = 1
+	`
+	var maintenance domain.Maintenance
+	var reason sql.NullString
+	err := r.db.QueryRowContext(ctx, query).Scan(
+		&maintenance.Enabled,
+		&maintenance.BlockManual,
+		&reason,
+		&maintenance.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return &domain.Maintenance{BlockManual: true}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance state: %w", err)
+	}
+	if reason.Valid {
+		maintenance.Reason = &reason.String
+	}
+	return &maintenance, nil
+}
+
+func (r *maintenanceRepository) Save(ctx context.Context, maintenance *domain.Maintenance) error {
+	query := `
+		INSERT INTO maintenance (id, enabled, block_manual, reason, updated_at)
+		VALUES (1, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			enabled = excluded.enabled,
+			block_manual = excluded.block_manual,
+			reason = excluded.reason,
+			updated_at = excluded.updated_at
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		maintenance.Enabled,
+		maintenance.BlockManual,
+		NullString(maintenance.Reason),
+		maintenance.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance state: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package sqlite
 
 import (
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 
+	"github.com/martijn/dbcalm/internal/api/util"
 	"github.com/martijn/dbcalm/internal/core/domain"
 	"github.com/martijn/dbcalm/internal/core/repository"
 )
@@ -25,8 +29,8 @@ func (r *processRepository) Create(ctx context.Context, process *domain.Process)
 	}
 
 	query := `
-		INSERT INTO process (command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO process (command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args, schedule_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var endTime sql.NullTime
@@ -46,6 +50,7 @@ func (r *processRepository) Create(ctx context.Context, process *domain.Process)
 		endTime,
 		process.Type,
 		string(argsJSON),
+		NullInt64(process.ScheduleID),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create process: %w", err)
@@ -62,7 +67,7 @@ func (r *processRepository) Create(ctx context.Context, process *domain.Process)
 
 func (r *processRepository) FindByID(ctx context.Context, id int64) (*domain.Process, error) {
 	query := `
-		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args
+		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args, progress, phase, schedule_id, retry_of
 		FROM process
 		WHERE id = ?
 	`
@@ -71,7 +76,7 @@ func (r *processRepository) FindByID(ctx context.Context, id int64) (*domain.Pro
 
 func (r *processRepository) FindByCommandID(ctx context.Context, commandID string) (*domain.Process, error) {
 	query := `
-		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args
+		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args, progress, phase, schedule_id, retry_of
 		FROM process
 		WHERE command_id = ?
 		ORDER BY id DESC
@@ -122,12 +127,41 @@ func (r *processRepository) Update(ctx context.Context, process *domain.Process)
 	return nil
 }
 
+// SetRetryOf links a process to the failed process it retries. Only the retry_of column is
+// written, db-cmd and cmd keep updating the rest of the row while the process runs.
+func (r *processRepository) SetRetryOf(ctx context.Context, commandID, retryOf string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE process SET retry_of = ? WHERE command_id = ?`, retryOf, commandID)
+	if err != nil {
+		return fmt.Errorf("failed to link retry: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("process not found: %s", commandID)
+	}
+
+	return nil
+}
+
+// activeFirstOrder sorts running processes to the top, ahead of the requested order
+var activeFirstOrder = util.OrderClause{Field: "status = 'running'", Direction: util.OrderDesc}
+
 func (r *processRepository) List(ctx context.Context, filter repository.ProcessFilter) ([]*domain.Process, error) {
-	query := `SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args FROM process WHERE 1=1`
+	query := `SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args, progress, phase, schedule_id, retry_of FROM process WHERE 1=1`
 	args := []interface{}{}
 
 	query, args = ApplyFilters(query, args, filter.Filters)
-	query = ApplyOrdering(query, filter.Order, "start_time DESC")
+	orders := filter.Order
+	if filter.ActiveFirst {
+		if len(orders) == 0 {
+			orders = []util.OrderClause{{Field: "start_time", Direction: util.OrderDesc}}
+		}
+		orders = append([]util.OrderClause{activeFirstOrder}, orders...)
+	}
+	query = ApplyOrdering(query, orders, "start_time DESC")
 	query, args = ApplyPagination(query, args, filter.Page, filter.PerPage)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
@@ -169,7 +203,7 @@ func (r *processRepository) Count(ctx context.Context, filter repository.Process
 
 func (r *processRepository) FindRunning(ctx context.Context) ([]*domain.Process, error) {
 	query := `
-		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args
+		SELECT id, command_id, command, pid, status, output, error, return_code, start_time, end_time, type, args, progress, phase, schedule_id, retry_of
 		FROM process
 		WHERE status = ?
 		ORDER BY start_time ASC
@@ -196,11 +230,38 @@ func (r *processRepository) FindRunning(ctx context.Context) ([]*domain.Process,
 	return processes, nil
 }
 
+// gzipMagic starts output db-cmd stored gzipped (compress_output), captured output is
+// text and never does
+const gzipMagic = "\x1f\x8b"
+
+// decodeOutput returns stored process output as text, decompressing it when it was gzipped
+func decodeOutput(stored sql.NullString) (*string, error) {
+	if !stored.Valid {
+		return nil, nil
+	}
+	if !strings.HasPrefix(stored.String, gzipMagic) {
+		return &stored.String, nil
+	}
+
+	zr, err := gzip.NewReader(strings.NewReader(stored.String))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress process output: %w", err)
+	}
+	defer zr.Close()
+
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress process output: %w", err)
+	}
+	decoded := string(text)
+	return &decoded, nil
+}
+
 func (r *processRepository) scanProcess(row *sql.Row) (*domain.Process, error) {
 	var process domain.Process
 	var argsJSON string
-	var pid, returnCode sql.NullInt64
-	var output, errorOutput sql.NullString
+	var pid, returnCode, progress, scheduleID sql.NullInt64
+	var output, errorOutput, phase, retryOf sql.NullString
 	var endTime sql.NullTime
 
 	err := row.Scan(
@@ -216,6 +277,10 @@ func (r *processRepository) scanProcess(row *sql.Row) (*domain.Process, error) {
 		&endTime,
 		&process.Type,
 		&argsJSON,
+		&progress,
+		&phase,
+		&scheduleID,
+		&retryOf,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("process not found")
@@ -228,11 +293,11 @@ func (r *processRepository) scanProcess(row *sql.Row) (*domain.Process, error) {
 		pidInt := int(pid.Int64)
 		process.PID = &pidInt
 	}
-	if output.Valid {
-		process.Output = &output.String
+	if process.Output, err = decodeOutput(output); err != nil {
+		return nil, err
 	}
-	if errorOutput.Valid {
-		process.Error = &errorOutput.String
+	if process.Error, err = decodeOutput(errorOutput); err != nil {
+		return nil, err
 	}
 	if returnCode.Valid {
 		rcInt := int(returnCode.Int64)
@@ -241,6 +306,19 @@ func (r *processRepository) scanProcess(row *sql.Row) (*domain.Process, error) {
 	if endTime.Valid {
 		process.EndTime = &endTime.Time
 	}
+	if progress.Valid {
+		progressInt := int(progress.Int64)
+		process.Progress = &progressInt
+	}
+	if phase.Valid {
+		process.Phase = &phase.String
+	}
+	if scheduleID.Valid {
+		process.ScheduleID = &scheduleID.Int64
+	}
+	if retryOf.Valid {
+		process.RetryOf = &retryOf.String
+	}
 
 	if err := json.Unmarshal([]byte(argsJSON), &process.Args); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal args: %w", err)
@@ -252,8 +330,8 @@ func (r *processRepository) scanProcess(row *sql.Row) (*domain.Process, error) {
 func (r *processRepository) scanProcessRow(rows *sql.Rows) (*domain.Process, error) {
 	var process domain.Process
 	var argsJSON string
-	var pid, returnCode sql.NullInt64
-	var output, errorOutput sql.NullString
+	var pid, returnCode, progress, scheduleID sql.NullInt64
+	var output, errorOutput, phase, retryOf sql.NullString
 	var endTime sql.NullTime
 
 	err := rows.Scan(
@@ -269,6 +347,10 @@ func (r *processRepository) scanProcessRow(rows *sql.Rows) (*domain.Process, err
 		&endTime,
 		&process.Type,
 		&argsJSON,
+		&progress,
+		&phase,
+		&scheduleID,
+		&retryOf,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan process: %w", err)
@@ -278,11 +360,11 @@ func (r *processRepository) scanProcessRow(rows *sql.Rows) (*domain.Process, err
 		pidInt := int(pid.Int64)
 		process.PID = &pidInt
 	}
-	if output.Valid {
-		process.Output = &output.String
+	if process.Output, err = decodeOutput(output); err != nil {
+		return nil, err
 	}
-	if errorOutput.Valid {
-		process.Error = &errorOutput.String
+	if process.Error, err = decodeOutput(errorOutput); err != nil {
+		return nil, err
 	}
 	if returnCode.Valid {
 		rcInt := int(returnCode.Int64)
@@ -291,6 +373,19 @@ func (r *processRepository) scanProcessRow(rows *sql.Rows) (*domain.Process, err
 	if endTime.Valid {
 		process.EndTime = &endTime.Time
 	}
+	if progress.Valid {
+		progressInt := int(progress.Int64)
+		process.Progress = &progressInt
+	}
+	if phase.Valid {
+		process.Phase = &phase.String
+	}
+	if scheduleID.Valid {
+		process.ScheduleID = &scheduleID.Int64
+	}
+	if retryOf.Valid {
+		process.RetryOf = &retryOf.String
+	}
 
 	if err := json.Unmarshal([]byte(argsJSON), &process.Args); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal args: %w", err)
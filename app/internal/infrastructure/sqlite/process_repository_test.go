@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/martijn/dbcalm/internal/api/util"
+	"github.com/martijn/dbcalm/internal/core/repository"
+)
+
+func TestProcessOutputDecompressedOnRead(t *testing.T) {
+	db, err := New(":memory:")
+	if err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	defer db.Close()
+
+	output := strings.Repeat("[00] Copying ./ibdata1 to /backups/ibdata1\n", 200)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(output))
+	zw.Close()
+
+	// db-cmd stores long output gzipped and short errors as text
+	result, err := db.Exec(`
+		INSERT INTO process (command_id, command, pid, status, output, error, start_time, type, args)
+		VALUES ('proc-1', 'mariabackup --backup', 0, 'failed', ?, 'completed with errors', '2026-03-01T02:00:00Z', 'backup', '{}')
+	`, compressed.Bytes())
+	if err != nil {
+		t.Fatalf("failed to seed process: %v", err)
+	}
+	id, _ := result.LastInsertId()
+
+	repo := NewProcessRepository(db)
+	process, err := repo.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if process.Output == nil || *process.Output != output {
+		t.Errorf("expected the decompressed output back")
+	}
+	if process.Error == nil || *process.Error != "completed with errors" {
+		t.Errorf("expected the plain error back, got %v", process.Error)
+	}
+
+	processes, err := repo.List(context.Background(), repository.ProcessFilter{ListFilter: util.ListFilter{Page: 1, PerPage: 10}})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(processes) != 1 || processes[0].Output == nil || *processes[0].Output != output {
+		t.Errorf("expected listed processes to carry the decompressed output")
+	}
+}
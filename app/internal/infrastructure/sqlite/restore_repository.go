@@ -19,10 +19,15 @@ func NewRestoreRepository(db *DB) repository.RestoreRepository {
 
 func (r *restoreRepository) Create(ctx context.Context, restore *domain.Restore) error {
 	query := `
-		INSERT INTO restore (backup_id, backup_timestamp, target, target_path, start_time, end_time, process_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO restore (backup_id, backup_timestamp, target, target_path, archive, mode, databases, safety_copy_path, start_time, end_time, process_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	databases, err := NullStringList(restore.Databases)
+	if err != nil {
+		return fmt.Errorf("failed to encode databases: %w", err)
+	}
+
 	var endTime sql.NullTime
 	if restore.EndTime != nil {
 		endTime = sql.NullTime{Valid: true, Time: *restore.EndTime}
@@ -33,6 +38,10 @@ func (r *restoreRepository) Create(ctx context.Context, restore *domain.Restore)
 		restore.BackupTimestamp,
 		restore.Target,
 		restore.TargetPath,
+		restore.Archive,
+		restore.Mode,
+		databases,
+		restore.SafetyCopyPath,
 		restore.StartTime,
 		endTime,
 		restore.ProcessID,
@@ -52,7 +61,7 @@ func (r *restoreRepository) Create(ctx context.Context, restore *domain.Restore)
 
 func (r *restoreRepository) FindByID(ctx context.Context, id int64) (*domain.Restore, error) {
 	query := `
-		SELECT id, backup_id, backup_timestamp, target, target_path, start_time, end_time, process_id
+		SELECT id, backup_id, backup_timestamp, target, target_path, archive, mode, databases, safety_copy_path, start_time, end_time, process_id
 		FROM restore
 		WHERE id = ?
 	`
@@ -95,7 +104,7 @@ func (r *restoreRepository) Update(ctx context.Context, restore *domain.Restore)
 }
 
 func (r *restoreRepository) List(ctx context.Context, filter repository.RestoreFilter) ([]*domain.Restore, error) {
-	query := `SELECT id, backup_id, backup_timestamp, target, target_path, start_time, end_time, process_id FROM restore WHERE 1=1`
+	query := `SELECT id, backup_id, backup_timestamp, target, target_path, archive, mode, databases, safety_copy_path, start_time, end_time, process_id FROM restore WHERE 1=1`
 	args := []interface{}{}
 
 	query, args = ApplyFilters(query, args, filter.Filters)
@@ -142,6 +151,7 @@ func (r *restoreRepository) Count(ctx context.Context, filter repository.Restore
 func (r *restoreRepository) scanRestore(row *sql.Row) (*domain.Restore, error) {
 	var restore domain.Restore
 	var endTime sql.NullTime
+	var databases sql.NullString
 
 	err := row.Scan(
 		&restore.ID,
@@ -149,6 +159,10 @@ func (r *restoreRepository) scanRestore(row *sql.Row) (*domain.Restore, error) {
 		&restore.BackupTimestamp,
 		&restore.Target,
 		&restore.TargetPath,
+		&restore.Archive,
+		&restore.Mode,
+		&databases,
+		&restore.SafetyCopyPath,
 		&restore.StartTime,
 		&endTime,
 		&restore.ProcessID,
@@ -163,6 +177,9 @@ func (r *restoreRepository) scanRestore(row *sql.Row) (*domain.Restore, error) {
 	if endTime.Valid {
 		restore.EndTime = &endTime.Time
 	}
+	if restore.Databases, err = ParseStringList(databases); err != nil {
+		return nil, fmt.Errorf("failed to parse databases: %w", err)
+	}
 
 	return &restore, nil
 }
@@ -170,6 +187,7 @@ func (r *restoreRepository) scanRestore(row *sql.Row) (*domain.Restore, error) {
 func (r *restoreRepository) scanRestoreRow(rows *sql.Rows) (*domain.Restore, error) {
 	var restore domain.Restore
 	var endTime sql.NullTime
+	var databases sql.NullString
 
 	err := rows.Scan(
 		&restore.ID,
@@ -177,6 +195,10 @@ func (r *restoreRepository) scanRestoreRow(rows *sql.Rows) (*domain.Restore, err
 		&restore.BackupTimestamp,
 		&restore.Target,
 		&restore.TargetPath,
+		&restore.Archive,
+		&restore.Mode,
+		&databases,
+		&restore.SafetyCopyPath,
 		&restore.StartTime,
 		&endTime,
 		&restore.ProcessID,
@@ -188,6 +210,9 @@ func (r *restoreRepository) scanRestoreRow(rows *sql.Rows) (*domain.Restore, err
 	if endTime.Valid {
 		restore.EndTime = &endTime.Time
 	}
+	if restore.Databases, err = ParseStringList(databases); err != nil {
+		return nil, fmt.Errorf("failed to parse databases: %w", err)
+	}
 
 	return &restore, nil
 }
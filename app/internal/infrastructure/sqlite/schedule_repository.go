@@ -18,10 +18,45 @@ func NewScheduleRepository(db *DB) repository.ScheduleRepository {
 }
 
 func (r *scheduleRepository) Create(ctx context.Context, schedule *domain.Schedule) error {
+	return createSchedule(ctx, r.db, schedule)
+}
+
+// CreateAll creates the schedules in one transaction, none are created when one fails
+func (r *scheduleRepository) CreateAll(ctx context.Context, schedules []*domain.Schedule) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, schedule := range schedules {
+		if err := createSchedule(ctx, tx, schedule); err != nil {
+			for _, created := range schedules {
+				created.ID = 0
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		for _, created := range schedules {
+			created.ID = 0
+		}
+		return fmt.Errorf("failed to commit schedules: %w", err)
+	}
+	return nil
+}
+
+// execer is the part of *DB and *sql.Tx inserting a schedule needs
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func createSchedule(ctx context.Context, db execer, schedule *domain.Schedule) error {
 	query := `
-		INSERT INTO schedule (backup_type, frequency, day_of_week, day_of_month, hour, minute,
-			interval_value, interval_unit, retention_value, retention_unit, enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO schedule (backup_type, frequency, day_of_week, days_of_week, day_of_month, hour, minute,
+			interval_value, interval_unit, retention_value, retention_unit, strategy, exclude_databases, pre_backup_hook, post_backup_hook, verify_on_completion, credentials_suffix, window_start, window_end, preset_group, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	var intervalUnit, retentionUnit sql.NullString
@@ -31,11 +66,16 @@ func (r *scheduleRepository) Create(ctx context.Context, schedule *domain.Schedu
 	if schedule.RetentionUnit != nil {
 		retentionUnit = sql.NullString{String: string(*schedule.RetentionUnit), Valid: true}
 	}
+	excludeDatabases, err := NullStringList(schedule.ExcludeDatabases)
+	if err != nil {
+		return fmt.Errorf("failed to encode exclude_databases: %w", err)
+	}
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := db.ExecContext(ctx, query,
 		schedule.BackupType,
 		schedule.Frequency,
 		NullInt(schedule.DayOfWeek),
+		NullIntList(schedule.DaysOfWeek),
 		NullInt(schedule.DayOfMonth),
 		NullInt(schedule.Hour),
 		NullInt(schedule.Minute),
@@ -43,6 +83,15 @@ func (r *scheduleRepository) Create(ctx context.Context, schedule *domain.Schedu
 		intervalUnit,
 		NullInt(schedule.RetentionValue),
 		retentionUnit,
+		backupStrategy(schedule.Strategy),
+		excludeDatabases,
+		NullString(schedule.PreBackupHook),
+		NullString(schedule.PostBackupHook),
+		schedule.VerifyOnCompletion,
+		NullString(schedule.CredentialsSuffix),
+		NullInt(schedule.WindowStart),
+		NullInt(schedule.WindowEnd),
+		NullString(schedule.PresetGroup),
 		schedule.Enabled,
 		schedule.CreatedAt,
 		schedule.UpdatedAt,
@@ -62,8 +111,8 @@ func (r *scheduleRepository) Create(ctx context.Context, schedule *domain.Schedu
 
 func (r *scheduleRepository) FindByID(ctx context.Context, id int64) (*domain.Schedule, error) {
 	query := `
-		SELECT id, backup_type, frequency, day_of_week, day_of_month, hour, minute,
-			interval_value, interval_unit, retention_value, retention_unit, enabled, created_at, updated_at
+		SELECT id, backup_type, frequency, day_of_week, days_of_week, day_of_month, hour, minute,
+			interval_value, interval_unit, retention_value, retention_unit, strategy, exclude_databases, pre_backup_hook, post_backup_hook, verify_on_completion, credentials_suffix, window_start, window_end, preset_group, enabled, created_at, updated_at
 		FROM schedule
 		WHERE id = ?
 	`
@@ -73,8 +122,8 @@ func (r *scheduleRepository) FindByID(ctx context.Context, id int64) (*domain.Sc
 func (r *scheduleRepository) Update(ctx context.Context, schedule *domain.Schedule) error {
 	query := `
 		UPDATE schedule
-		SET backup_type = ?, frequency = ?, day_of_week = ?, day_of_month = ?, hour = ?, minute = ?,
-			interval_value = ?, interval_unit = ?, retention_value = ?, retention_unit = ?, enabled = ?, updated_at = ?
+		SET backup_type = ?, frequency = ?, day_of_week = ?, days_of_week = ?, day_of_month = ?, hour = ?, minute = ?,
+			interval_value = ?, interval_unit = ?, retention_value = ?, retention_unit = ?, strategy = ?, exclude_databases = ?, pre_backup_hook = ?, post_backup_hook = ?, verify_on_completion = ?, credentials_suffix = ?, window_start = ?, window_end = ?, enabled = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -85,11 +134,16 @@ func (r *scheduleRepository) Update(ctx context.Context, schedule *domain.Schedu
 	if schedule.RetentionUnit != nil {
 		retentionUnit = sql.NullString{String: string(*schedule.RetentionUnit), Valid: true}
 	}
+	excludeDatabases, err := NullStringList(schedule.ExcludeDatabases)
+	if err != nil {
+		return fmt.Errorf("failed to encode exclude_databases: %w", err)
+	}
 
 	result, err := r.db.ExecContext(ctx, query,
 		schedule.BackupType,
 		schedule.Frequency,
 		NullInt(schedule.DayOfWeek),
+		NullIntList(schedule.DaysOfWeek),
 		NullInt(schedule.DayOfMonth),
 		NullInt(schedule.Hour),
 		NullInt(schedule.Minute),
@@ -97,6 +151,14 @@ func (r *scheduleRepository) Update(ctx context.Context, schedule *domain.Schedu
 		intervalUnit,
 		NullInt(schedule.RetentionValue),
 		retentionUnit,
+		backupStrategy(schedule.Strategy),
+		excludeDatabases,
+		NullString(schedule.PreBackupHook),
+		NullString(schedule.PostBackupHook),
+		schedule.VerifyOnCompletion,
+		NullString(schedule.CredentialsSuffix),
+		NullInt(schedule.WindowStart),
+		NullInt(schedule.WindowEnd),
 		schedule.Enabled,
 		schedule.UpdatedAt,
 		schedule.ID,
@@ -136,8 +198,8 @@ func (r *scheduleRepository) Delete(ctx context.Context, id int64) error {
 
 func (r *scheduleRepository) List(ctx context.Context, filter repository.ScheduleFilter) ([]*domain.Schedule, error) {
 	query := `
-		SELECT id, backup_type, frequency, day_of_week, day_of_month, hour, minute,
-			interval_value, interval_unit, retention_value, retention_unit, enabled, created_at, updated_at
+		SELECT id, backup_type, frequency, day_of_week, days_of_week, day_of_month, hour, minute,
+			interval_value, interval_unit, retention_value, retention_unit, strategy, exclude_databases, pre_backup_hook, post_backup_hook, verify_on_completion, credentials_suffix, window_start, window_end, preset_group, enabled, created_at, updated_at
 		FROM schedule
 		WHERE 1=1
 	`
@@ -153,6 +215,11 @@ func (r *scheduleRepository) List(ctx context.Context, filter repository.Schedul
 		args = append(args, *filter.Enabled)
 	}
 
+	if filter.PresetGroup != nil {
+		query += " AND preset_group = ?"
+		args = append(args, *filter.PresetGroup)
+	}
+
 	query += " ORDER BY id ASC"
 
 	if filter.Limit > 0 {
@@ -212,10 +279,10 @@ func (r *scheduleRepository) Count(ctx context.Context, filter repository.Schedu
 
 func (r *scheduleRepository) FindEnabledFullSchedules(ctx context.Context) ([]*domain.Schedule, error) {
 	query := `
-		SELECT id, backup_type, frequency, day_of_week, day_of_month, hour, minute,
-			interval_value, interval_unit, retention_value, retention_unit, enabled, created_at, updated_at
+		SELECT id, backup_type, frequency, day_of_week, days_of_week, day_of_month, hour, minute,
+			interval_value, interval_unit, retention_value, retention_unit, strategy, exclude_databases, pre_backup_hook, post_backup_hook, verify_on_completion, credentials_suffix, window_start, window_end, preset_group, enabled, created_at, updated_at
 		FROM schedule
-		WHERE backup_type = ? AND enabled = 1
+		WHERE backup_type = ? AND enabled = 1 AND strategy = 'physical'
 		ORDER BY id ASC
 	`
 	rows, err := r.db.QueryContext(ctx, query, domain.BackupTypeFull)
@@ -242,8 +309,8 @@ func (r *scheduleRepository) FindEnabledFullSchedules(ctx context.Context) ([]*d
 
 func (r *scheduleRepository) FindAllEnabled(ctx context.Context) ([]*domain.Schedule, error) {
 	query := `
-		SELECT id, backup_type, frequency, day_of_week, day_of_month, hour, minute,
-			interval_value, interval_unit, retention_value, retention_unit, enabled, created_at, updated_at
+		SELECT id, backup_type, frequency, day_of_week, days_of_week, day_of_month, hour, minute,
+			interval_value, interval_unit, retention_value, retention_unit, strategy, exclude_databases, pre_backup_hook, post_backup_hook, verify_on_completion, credentials_suffix, window_start, window_end, preset_group, enabled, created_at, updated_at
 		FROM schedule
 		WHERE enabled = 1
 		ORDER BY id ASC
@@ -272,14 +339,15 @@ func (r *scheduleRepository) FindAllEnabled(ctx context.Context) ([]*domain.Sche
 
 func (r *scheduleRepository) scanSchedule(row *sql.Row) (*domain.Schedule, error) {
 	var schedule domain.Schedule
-	var dayOfWeek, dayOfMonth, hour, minute, intervalValue, retentionValue sql.NullInt64
-	var intervalUnit, retentionUnit sql.NullString
+	var dayOfWeek, dayOfMonth, hour, minute, intervalValue, retentionValue, windowStart, windowEnd sql.NullInt64
+	var daysOfWeek, intervalUnit, retentionUnit, excludeDatabases, preBackupHook, postBackupHook, credentialsSuffix, presetGroup sql.NullString
 
 	err := row.Scan(
 		&schedule.ID,
 		&schedule.BackupType,
 		&schedule.Frequency,
 		&dayOfWeek,
+		&daysOfWeek,
 		&dayOfMonth,
 		&hour,
 		&minute,
@@ -287,6 +355,15 @@ func (r *scheduleRepository) scanSchedule(row *sql.Row) (*domain.Schedule, error
 		&intervalUnit,
 		&retentionValue,
 		&retentionUnit,
+		&schedule.Strategy,
+		&excludeDatabases,
+		&preBackupHook,
+		&postBackupHook,
+		&schedule.VerifyOnCompletion,
+		&credentialsSuffix,
+		&windowStart,
+		&windowEnd,
+		&presetGroup,
 		&schedule.Enabled,
 		&schedule.CreatedAt,
 		&schedule.UpdatedAt,
@@ -302,6 +379,9 @@ func (r *scheduleRepository) scanSchedule(row *sql.Row) (*domain.Schedule, error
 		dow := int(dayOfWeek.Int64)
 		schedule.DayOfWeek = &dow
 	}
+	if schedule.DaysOfWeek, err = ParseIntList(daysOfWeek); err != nil {
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
 	if dayOfMonth.Valid {
 		dom := int(dayOfMonth.Int64)
 		schedule.DayOfMonth = &dom
@@ -330,20 +410,44 @@ func (r *scheduleRepository) scanSchedule(row *sql.Row) (*domain.Schedule, error
 		ru := domain.RetentionUnit(retentionUnit.String)
 		schedule.RetentionUnit = &ru
 	}
+	if schedule.ExcludeDatabases, err = ParseStringList(excludeDatabases); err != nil {
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
+	if preBackupHook.Valid {
+		schedule.PreBackupHook = &preBackupHook.String
+	}
+	if postBackupHook.Valid {
+		schedule.PostBackupHook = &postBackupHook.String
+	}
+	if credentialsSuffix.Valid {
+		schedule.CredentialsSuffix = &credentialsSuffix.String
+	}
+	if windowStart.Valid {
+		ws := int(windowStart.Int64)
+		schedule.WindowStart = &ws
+	}
+	if windowEnd.Valid {
+		we := int(windowEnd.Int64)
+		schedule.WindowEnd = &we
+	}
+	if presetGroup.Valid {
+		schedule.PresetGroup = &presetGroup.String
+	}
 
 	return &schedule, nil
 }
 
 func (r *scheduleRepository) scanScheduleRow(rows *sql.Rows) (*domain.Schedule, error) {
 	var schedule domain.Schedule
-	var dayOfWeek, dayOfMonth, hour, minute, intervalValue, retentionValue sql.NullInt64
-	var intervalUnit, retentionUnit sql.NullString
+	var dayOfWeek, dayOfMonth, hour, minute, intervalValue, retentionValue, windowStart, windowEnd sql.NullInt64
+	var daysOfWeek, intervalUnit, retentionUnit, excludeDatabases, preBackupHook, postBackupHook, credentialsSuffix, presetGroup sql.NullString
 
 	err := rows.Scan(
 		&schedule.ID,
 		&schedule.BackupType,
 		&schedule.Frequency,
 		&dayOfWeek,
+		&daysOfWeek,
 		&dayOfMonth,
 		&hour,
 		&minute,
@@ -351,6 +455,15 @@ func (r *scheduleRepository) scanScheduleRow(rows *sql.Rows) (*domain.Schedule,
 		&intervalUnit,
 		&retentionValue,
 		&retentionUnit,
+		&schedule.Strategy,
+		&excludeDatabases,
+		&preBackupHook,
+		&postBackupHook,
+		&schedule.VerifyOnCompletion,
+		&credentialsSuffix,
+		&windowStart,
+		&windowEnd,
+		&presetGroup,
 		&schedule.Enabled,
 		&schedule.CreatedAt,
 		&schedule.UpdatedAt,
@@ -363,6 +476,9 @@ func (r *scheduleRepository) scanScheduleRow(rows *sql.Rows) (*domain.Schedule,
 		dow := int(dayOfWeek.Int64)
 		schedule.DayOfWeek = &dow
 	}
+	if schedule.DaysOfWeek, err = ParseIntList(daysOfWeek); err != nil {
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
 	if dayOfMonth.Valid {
 		dom := int(dayOfMonth.Int64)
 		schedule.DayOfMonth = &dom
@@ -391,6 +507,29 @@ func (r *scheduleRepository) scanScheduleRow(rows *sql.Rows) (*domain.Schedule,
 		ru := domain.RetentionUnit(retentionUnit.String)
 		schedule.RetentionUnit = &ru
 	}
+	if schedule.ExcludeDatabases, err = ParseStringList(excludeDatabases); err != nil {
+		return nil, fmt.Errorf("failed to scan schedule: %w", err)
+	}
+	if preBackupHook.Valid {
+		schedule.PreBackupHook = &preBackupHook.String
+	}
+	if postBackupHook.Valid {
+		schedule.PostBackupHook = &postBackupHook.String
+	}
+	if credentialsSuffix.Valid {
+		schedule.CredentialsSuffix = &credentialsSuffix.String
+	}
+	if windowStart.Valid {
+		ws := int(windowStart.Int64)
+		schedule.WindowStart = &ws
+	}
+	if windowEnd.Valid {
+		we := int(windowEnd.Int64)
+		schedule.WindowEnd = &we
+	}
+	if presetGroup.Valid {
+		schedule.PresetGroup = &presetGroup.String
+	}
 
 	return &schedule, nil
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -28,8 +30,97 @@ type Config struct {
 	LogFile  string `mapstructure:"log_file"`
 	LogLevel string `mapstructure:"log_level"`
 
-	// Optional JWT settings
+	// Optional JWT settings. Tokens are issued with JWTIssuer and JWTAudience and only
+	// accepted with both, set them apart from other services sharing the secret.
 	JWTAlgorithm string `mapstructure:"jwt_algorithm"`
+	JWTIssuer    string `mapstructure:"jwt_issuer"`
+	JWTAudience  string `mapstructure:"jwt_audience"`
+	// JWTLeeway tolerates clock skew between issuer and validator when checking nbf and exp
+	JWTLeeway time.Duration `mapstructure:"jwt_leeway"`
+	// AuthCodeExpiration is how long a login's auth code can be exchanged for a token.
+	// Expired codes are deleted every AuthCodeSweepInterval, zero leaves it to logins.
+	AuthCodeExpiration    time.Duration `mapstructure:"auth_code_expiration"`
+	AuthCodeSweepInterval time.Duration `mapstructure:"auth_code_sweep_interval"`
+
+	// Optional backup settings
+	// MaxIncrementalAge promotes an incremental to a full backup once the chain's
+	// root full backup is older than this (e.g. "168h"). Zero disables the check.
+	MaxIncrementalAge time.Duration `mapstructure:"max_incremental_age"`
+	// CatchUpWindow starts a schedule's missed run once when the server starts, if it
+	// was due no longer than this ago (e.g. "6h"). Zero disables catching up.
+	CatchUpWindow time.Duration `mapstructure:"catch_up_window"`
+	// BackupCooldown skips a scheduled run when the latest backup, scheduled or manual,
+	// finished less than this ago (e.g. "30m"). Zero disables the cooldown.
+	BackupCooldown time.Duration `mapstructure:"backup_cooldown"`
+
+	// DefaultRestoreTarget is used when a restore request names no target. Only "folder"
+	// is allowed, restoring over the data dir always has to be asked for explicitly.
+	DefaultRestoreTarget string `mapstructure:"default_restore_target"`
+
+	// RetentionAge is the timestamp a backup's age is measured from when applying a
+	// schedule's retention: "start_time" (default) or "end_time"
+	RetentionAge string `mapstructure:"retention_age"`
+
+	// CronSyncFailure is what happens to a schedule change when the cron file can't be
+	// updated: "rollback" (default) undoes it, "keep" saves it for a later cron resync
+	CronSyncFailure string `mapstructure:"cron_sync_failure"`
+
+	// DuplicateSchedule is what happens to a new enabled schedule taking the same backups
+	// at the same times as an enabled one: "allow", "warn" (default) logs it, "reject"
+	// refuses it
+	DuplicateSchedule string `mapstructure:"duplicate_schedule"`
+
+	// ScheduleTimezone is the IANA time zone schedules run in, e.g. "Europe/Amsterdam".
+	// "Local" (default) is the host's zone, the one cron uses on its own.
+	ScheduleTimezone string `mapstructure:"schedule_timezone"`
+
+	// IdempotencyTTL is how long the response of a backup or restore request sent with an
+	// Idempotency-Key is replayed for repeats of the key. Zero ignores the header.
+	IdempotencyTTL time.Duration `mapstructure:"idempotency_ttl"`
+
+	// RequestTimeout is how long an API request may take before its context is cancelled,
+	// aborting socket calls still waiting on db-cmd or cmd. Zero disables it.
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	// Optional socket settings for talking to db-cmd and cmd
+	SocketTimeout time.Duration `mapstructure:"socket_timeout"`
+	// SocketRetryAttempts and SocketRetryBackoff control reconnecting while a
+	// socket service restarts. Commands that were sent are never retried.
+	SocketRetryAttempts int           `mapstructure:"socket_retry_attempts"`
+	SocketRetryBackoff  time.Duration `mapstructure:"socket_retry_backoff"`
+
+	// CleanupCheckAttempts and CleanupCheckBackoff control how long a cleanup waits for the
+	// folders cmd removed to disappear before deleting their catalog rows, for NFS and
+	// other filesystems where a removal takes a while to show. The backoff doubles.
+	CleanupCheckAttempts int           `mapstructure:"cleanup_check_attempts"`
+	CleanupCheckBackoff  time.Duration `mapstructure:"cleanup_check_backoff"`
+
+	// Optional catalog self-backup settings. CatalogBackupInterval zero disables the
+	// periodic backup; POST /system/catalog-backup still works.
+	CatalogBackupDir      string        `mapstructure:"catalog_backup_dir"`
+	CatalogBackupInterval time.Duration `mapstructure:"catalog_backup_interval"`
+	CatalogBackupKeep     int           `mapstructure:"catalog_backup_keep"`
+
+	// Optional backup_dir disk monitor. DiskCheckInterval zero disables it. The state is
+	// warning or critical once space or inode usage reaches the thresholds (percent
+	// used), changes of state are posted to DiskAlertWebhook when set.
+	DiskCheckInterval   time.Duration `mapstructure:"disk_check_interval"`
+	DiskWarningPercent  int           `mapstructure:"disk_warning_percent"`
+	DiskCriticalPercent int           `mapstructure:"disk_critical_percent"`
+	DiskAlertWebhook    string        `mapstructure:"disk_alert_webhook"`
+
+	// Optional reconciliation of the catalog with backup_dir. ReconcileInterval zero
+	// disables it. OrphanBackupPolicy is log, alert (also posted to ReconcileWebhook),
+	// import or remove.
+	ReconcileInterval  time.Duration `mapstructure:"reconcile_interval"`
+	OrphanBackupPolicy string        `mapstructure:"orphan_backup_policy"`
+	ReconcileWebhook   string        `mapstructure:"reconcile_webhook"`
+
+	// Connection pool of the catalog database, shared by API requests and the
+	// background services. DBMaxOpenConns zero leaves the number of connections unbounded.
+	DBMaxOpenConns    int           `mapstructure:"db_max_open_conns"`
+	DBMaxIdleConns    int           `mapstructure:"db_max_idle_conns"`
+	DBConnMaxLifetime time.Duration `mapstructure:"db_conn_max_lifetime"`
 
 	// Static paths
 	ConfigPath           string
@@ -39,14 +130,41 @@ type Config struct {
 }
 
 const (
-	DefaultConfigPath           = "/etc/dbcalm/config.yml"
-	DefaultMariaDBCmdSocketPath = "/var/run/dbcalm/db-cmd.sock"
-	DefaultCmdSocketPath        = "/var/run/dbcalm/cmd.sock"
-	DefaultDBPath               = "/var/lib/dbcalm/db.sqlite3"
-	DefaultAPIHost              = "0.0.0.0"
-	DefaultAPIPort              = 8335
-	DefaultLogLevel             = "info"
-	DefaultJWTAlgorithm         = "HS256"
+	DefaultConfigPath            = "/etc/dbcalm/config.yml"
+	DefaultMariaDBCmdSocketPath  = "/var/run/dbcalm/db-cmd.sock"
+	DefaultCmdSocketPath         = "/var/run/dbcalm/cmd.sock"
+	DefaultDBPath                = "/var/lib/dbcalm/db.sqlite3"
+	DefaultAPIHost               = "0.0.0.0"
+	DefaultAPIPort               = 8335
+	DefaultLogLevel              = "info"
+	DefaultJWTAlgorithm          = "HS256"
+	DefaultJWTIssuer             = "dbcalm"
+	DefaultJWTAudience           = "dbcalm-api"
+	DefaultJWTLeeway             = 30 * time.Second
+	DefaultAuthCodeExpiration    = 10 * time.Minute
+	DefaultAuthCodeSweepInterval = time.Hour
+	DefaultRequestTimeout        = time.Minute
+	DefaultSocketTimeout         = 30 * time.Second
+	DefaultSocketRetryAttempts   = 3
+	DefaultSocketRetryBackoff    = 200 * time.Millisecond
+	DefaultCleanupCheckAttempts  = 5
+	DefaultCleanupCheckBackoff   = 500 * time.Millisecond
+	DefaultCatalogBackupDir      = "/var/lib/dbcalm/catalog-backups"
+	DefaultCatalogBackupInterval = 24 * time.Hour
+	DefaultCatalogBackupKeep     = 7
+	DefaultRetentionAge          = "start_time"
+	DefaultCronSyncFailure       = "rollback"
+	DefaultDuplicateSchedule     = "warn"
+	DefaultScheduleTimezone      = "Local"
+	DefaultIdempotencyTTL        = 24 * time.Hour
+	DefaultDiskCheckInterval     = 5 * time.Minute
+	DefaultDiskWarningPercent    = 80
+	DefaultDiskCriticalPercent   = 90
+	DefaultReconcileInterval     = time.Hour
+	DefaultOrphanBackupPolicy    = "log"
+	DefaultDBMaxOpenConns        = 8
+	DefaultDBMaxIdleConns        = 4
+	DefaultDBConnMaxLifetime     = time.Hour
 )
 
 func Load(configPath string) (*Config, error) {
@@ -62,6 +180,33 @@ func Load(configPath string) (*Config, error) {
 	viper.SetDefault("api_port", DefaultAPIPort)
 	viper.SetDefault("log_level", DefaultLogLevel)
 	viper.SetDefault("jwt_algorithm", DefaultJWTAlgorithm)
+	viper.SetDefault("jwt_issuer", DefaultJWTIssuer)
+	viper.SetDefault("jwt_audience", DefaultJWTAudience)
+	viper.SetDefault("jwt_leeway", DefaultJWTLeeway)
+	viper.SetDefault("auth_code_expiration", DefaultAuthCodeExpiration)
+	viper.SetDefault("auth_code_sweep_interval", DefaultAuthCodeSweepInterval)
+	viper.SetDefault("request_timeout", DefaultRequestTimeout)
+	viper.SetDefault("socket_timeout", DefaultSocketTimeout)
+	viper.SetDefault("socket_retry_attempts", DefaultSocketRetryAttempts)
+	viper.SetDefault("socket_retry_backoff", DefaultSocketRetryBackoff)
+	viper.SetDefault("cleanup_check_attempts", DefaultCleanupCheckAttempts)
+	viper.SetDefault("cleanup_check_backoff", DefaultCleanupCheckBackoff)
+	viper.SetDefault("catalog_backup_dir", DefaultCatalogBackupDir)
+	viper.SetDefault("catalog_backup_interval", DefaultCatalogBackupInterval)
+	viper.SetDefault("catalog_backup_keep", DefaultCatalogBackupKeep)
+	viper.SetDefault("retention_age", DefaultRetentionAge)
+	viper.SetDefault("cron_sync_failure", DefaultCronSyncFailure)
+	viper.SetDefault("duplicate_schedule", DefaultDuplicateSchedule)
+	viper.SetDefault("schedule_timezone", DefaultScheduleTimezone)
+	viper.SetDefault("idempotency_ttl", DefaultIdempotencyTTL)
+	viper.SetDefault("disk_check_interval", DefaultDiskCheckInterval)
+	viper.SetDefault("disk_warning_percent", DefaultDiskWarningPercent)
+	viper.SetDefault("disk_critical_percent", DefaultDiskCriticalPercent)
+	viper.SetDefault("reconcile_interval", DefaultReconcileInterval)
+	viper.SetDefault("orphan_backup_policy", DefaultOrphanBackupPolicy)
+	viper.SetDefault("db_max_open_conns", DefaultDBMaxOpenConns)
+	viper.SetDefault("db_max_idle_conns", DefaultDBMaxIdleConns)
+	viper.SetDefault("db_conn_max_lifetime", DefaultDBConnMaxLifetime)
 
 	// Allow environment variable overrides
 	viper.AutomaticEnv()
@@ -107,6 +252,121 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("jwt_secret_key is required")
 	}
 
+	if c.JWTIssuer == "" || c.JWTAudience == "" {
+		return fmt.Errorf("jwt_issuer and jwt_audience cannot be empty")
+	}
+
+	if c.JWTLeeway < 0 {
+		return fmt.Errorf("jwt_leeway cannot be negative")
+	}
+
+	if c.AuthCodeExpiration <= 0 {
+		return fmt.Errorf("auth_code_expiration must be positive")
+	}
+
+	if c.AuthCodeSweepInterval < 0 {
+		return fmt.Errorf("auth_code_sweep_interval cannot be negative")
+	}
+
+	if c.MaxIncrementalAge < 0 {
+		return fmt.Errorf("max_incremental_age cannot be negative")
+	}
+
+	if c.CatchUpWindow < 0 {
+		return fmt.Errorf("catch_up_window cannot be negative")
+	}
+
+	if c.BackupCooldown < 0 {
+		return fmt.Errorf("backup_cooldown cannot be negative")
+	}
+
+	if c.DefaultRestoreTarget != "" && c.DefaultRestoreTarget != "folder" {
+		return fmt.Errorf("default_restore_target can only be 'folder', database restores must name their target, got: %s", c.DefaultRestoreTarget)
+	}
+
+	if c.RetentionAge != "start_time" && c.RetentionAge != "end_time" {
+		return fmt.Errorf("retention_age must be 'start_time' or 'end_time', got: %s", c.RetentionAge)
+	}
+
+	if c.CronSyncFailure != "rollback" && c.CronSyncFailure != "keep" {
+		return fmt.Errorf("cron_sync_failure must be 'rollback' or 'keep', got: %s", c.CronSyncFailure)
+	}
+
+	if c.DuplicateSchedule != "allow" && c.DuplicateSchedule != "warn" && c.DuplicateSchedule != "reject" {
+		return fmt.Errorf("duplicate_schedule must be 'allow', 'warn' or 'reject', got: %s", c.DuplicateSchedule)
+	}
+
+	if _, err := c.ScheduleLocation(); err != nil {
+		return err
+	}
+
+	if c.IdempotencyTTL < 0 {
+		return fmt.Errorf("idempotency_ttl cannot be negative")
+	}
+
+	if c.RequestTimeout < 0 {
+		return fmt.Errorf("request_timeout cannot be negative")
+	}
+
+	if c.SocketTimeout <= 0 {
+		return fmt.Errorf("socket_timeout must be positive")
+	}
+
+	if c.SocketRetryAttempts < 1 {
+		return fmt.Errorf("socket_retry_attempts must be at least 1")
+	}
+
+	if c.SocketRetryBackoff < 0 {
+		return fmt.Errorf("socket_retry_backoff cannot be negative")
+	}
+
+	if c.CleanupCheckAttempts < 1 {
+		return fmt.Errorf("cleanup_check_attempts must be at least 1")
+	}
+
+	if c.CleanupCheckBackoff < 0 {
+		return fmt.Errorf("cleanup_check_backoff cannot be negative")
+	}
+
+	if c.CatalogBackupInterval < 0 {
+		return fmt.Errorf("catalog_backup_interval cannot be negative")
+	}
+
+	if c.CatalogBackupKeep < 1 {
+		return fmt.Errorf("catalog_backup_keep must be at least 1")
+	}
+
+	if c.DiskCheckInterval < 0 {
+		return fmt.Errorf("disk_check_interval cannot be negative")
+	}
+
+	if c.DiskWarningPercent < 1 || c.DiskCriticalPercent > 100 || c.DiskWarningPercent >= c.DiskCriticalPercent {
+		return fmt.Errorf("disk_warning_percent and disk_critical_percent must satisfy 1 <= warning < critical <= 100, got %d and %d",
+			c.DiskWarningPercent, c.DiskCriticalPercent)
+	}
+
+	if c.ReconcileInterval < 0 {
+		return fmt.Errorf("reconcile_interval cannot be negative")
+	}
+
+	switch c.OrphanBackupPolicy {
+	case "log", "import", "remove":
+	case "alert":
+		if c.ReconcileWebhook == "" {
+			return fmt.Errorf("orphan_backup_policy 'alert' needs reconcile_webhook")
+		}
+	default:
+		return fmt.Errorf("orphan_backup_policy must be 'log', 'alert', 'import' or 'remove', got: %s", c.OrphanBackupPolicy)
+	}
+
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 || c.DBConnMaxLifetime < 0 {
+		return fmt.Errorf("db_max_open_conns, db_max_idle_conns and db_conn_max_lifetime cannot be negative")
+	}
+
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		return fmt.Errorf("db_max_idle_conns (%d) cannot exceed db_max_open_conns (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns)
+	}
+
 	// Validate backup directory exists
 	if _, err := os.Stat(c.BackupDir); os.IsNotExist(err) {
 		return fmt.Errorf("backup_dir does not exist: %s", c.BackupDir)
@@ -123,11 +383,26 @@ func (c *Config) Validate() error {
 		if _, err := os.Stat(c.SSLKey); os.IsNotExist(err) {
 			return fmt.Errorf("ssl_key file does not exist: %s", c.SSLKey)
 		}
+		if _, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey); err != nil {
+			return fmt.Errorf("ssl_cert and ssl_key are not a valid certificate/key pair: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// ScheduleLocation loads schedule_timezone
+func (c *Config) ScheduleLocation() (*time.Location, error) {
+	if c.ScheduleTimezone == "" {
+		return nil, fmt.Errorf("schedule_timezone cannot be empty")
+	}
+	loc, err := time.LoadLocation(c.ScheduleTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule_timezone %q is not a valid time zone: %w", c.ScheduleTimezone, err)
+	}
+	return loc, nil
+}
+
 func (c *Config) IsDevMode() bool {
 	return os.Getenv("DBCALM_DEV_MODE") == "1"
 }
@@ -7,6 +7,8 @@ import (
 
 type Adapter interface {
 	UpdateCronSchedules(schedules []model.Schedule) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	// RenderCronSchedules returns the cron file UpdateCronSchedules would write, without writing it
+	RenderCronSchedules(schedules []model.Schedule) string
 	DeleteDirectory(path string) (*sharedProcess.Process, chan *sharedProcess.Process, error)
-	CleanupBackups(backupIDs []string, folders []string) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	CleanupBackups(backupIDs []string, folders []string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error)
 }
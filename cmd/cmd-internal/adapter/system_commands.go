@@ -12,6 +12,10 @@ import (
 	"github.com/martijn/dbcalm-cmd/cmd-internal/process"
 )
 
+// AllowedExecutables lists the executables the system commands are run with,
+// for the process runner's allowlist
+var AllowedExecutables = []string{"/bin/sh", "/bin/rm"}
+
 type SystemCommands struct {
 	runner      *sharedProcess.Runner
 	cronBuilder *builder.CronFileBuilder
@@ -61,6 +65,12 @@ func (s *SystemCommands) UpdateCronSchedules(schedules []model.Schedule) (*share
 	return proc, procChan, nil
 }
 
+// RenderCronSchedules returns the cron file content UpdateCronSchedules would write for
+// the schedules, to see what cron runs without touching /etc/cron.d/dbcalm.
+func (s *SystemCommands) RenderCronSchedules(schedules []model.Schedule) string {
+	return s.cronBuilder.BuildCronFileContent(schedules)
+}
+
 // DeleteDirectory deletes a directory and all its contents.
 func (s *SystemCommands) DeleteDirectory(path string) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
 	// Use rm -rf to recursively delete directory
@@ -79,8 +89,9 @@ func (s *SystemCommands) DeleteDirectory(path string) (*sharedProcess.Process, c
 	return proc, procChan, nil
 }
 
-// CleanupBackups deletes multiple backup folders.
-func (s *SystemCommands) CleanupBackups(backupIDs []string, folders []string) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+// CleanupBackups deletes multiple backup folders. scheduleID is the schedule whose
+// retention the cleanup applies, nil for a cleanup of every schedule.
+func (s *SystemCommands) CleanupBackups(backupIDs []string, folders []string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
 	// Build command to delete all folders in a single rm call
 	// This is more efficient than running separate commands
 	command := []string{"/bin/rm", "-rf"}
@@ -91,6 +102,9 @@ func (s *SystemCommands) CleanupBackups(backupIDs []string, folders []string) (*
 	args := map[string]interface{}{
 		"backup_ids": string(backupIDsJSON),
 	}
+	if scheduleID != nil {
+		args["schedule_id"] = *scheduleID
+	}
 
 	proc, procChan := s.runner.Execute(command, process.TypeCleanupBackups, nil, args)
 	return proc, procChan, nil
@@ -63,7 +63,14 @@ func (c *CronFileBuilder) GenerateCronExpression(schedule *model.Schedule) (stri
 		return fmt.Sprintf("%s %s * * *", minute, hour), nil
 	case "weekly":
 		dayOfWeek := "*"
-		if schedule.DayOfWeek != nil {
+		if len(schedule.DaysOfWeek) > 0 {
+			// Several days share one entry as a cron list: 1,4
+			days := make([]string, len(schedule.DaysOfWeek))
+			for i, day := range schedule.DaysOfWeek {
+				days[i] = fmt.Sprintf("%d", day)
+			}
+			dayOfWeek = strings.Join(days, ",")
+		} else if schedule.DayOfWeek != nil {
 			dayOfWeek = fmt.Sprintf("%d", *schedule.DayOfWeek)
 		}
 		return fmt.Sprintf("%s %s * * %s", minute, hour, dayOfWeek), nil
@@ -83,6 +90,9 @@ func (c *CronFileBuilder) GenerateCronCommand(schedule *model.Schedule) string {
 	// Build command to call dbcalm backup CLI with schedule_id
 	backupCmd := fmt.Sprintf("/usr/bin/dbcalm backup %s", schedule.BackupType)
 	scheduleArg := fmt.Sprintf("--schedule-id %d", schedule.ID)
+	if schedule.Strategy == "logical" {
+		scheduleArg += " --strategy logical"
+	}
 	logFile := fmt.Sprintf("/var/log/%s/cron-%d.log", c.projectName, schedule.ID)
 	logRedirect := fmt.Sprintf(">> %s 2>&1", logFile)
 	return fmt.Sprintf("%s %s %s", backupCmd, scheduleArg, logRedirect)
@@ -113,7 +123,7 @@ func (c *CronFileBuilder) BuildCronFileContent(schedules []model.Schedule) strin
 	// Add daily cleanup job (runs at 2:00 AM)
 	lines = append(lines, "# Daily cleanup job")
 	lines = append(lines, fmt.Sprintf(
-		"0 2 * * * root /usr/bin/dbcalm cleanup >> /var/log/%s/cleanup.log 2>&1",
+		"0 2 * * * root /usr/bin/dbcalm cleanup --yes >> /var/log/%s/cleanup.log 2>&1",
 		c.projectName,
 	))
 	lines = append(lines, "")
@@ -130,6 +140,12 @@ func (c *CronFileBuilder) BuildCronFileContent(schedules []model.Schedule) strin
 		cronCommand := c.GenerateCronCommand(&schedule)
 
 		lines = append(lines, fmt.Sprintf("# Schedule ID: %d", schedule.ID))
+		// CRON_TZ applies to the entries after it, so every zoned entry sets its own.
+		// cronie honours it, Debian and Ubuntu's cron ignores it and runs the entry in
+		// the host's zone.
+		if schedule.Timezone != "" {
+			lines = append(lines, fmt.Sprintf("CRON_TZ=%s", schedule.Timezone))
+		}
 		lines = append(lines, fmt.Sprintf("%s root %s", cronExpression, cronCommand))
 		lines = append(lines, "")
 	}
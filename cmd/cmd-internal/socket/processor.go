@@ -65,6 +65,17 @@ func (p *CmdCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRe
 			schedule := p.mapToSchedule(scheduleMap)
 			schedules = append(schedules, schedule)
 		}
+		// A dry run answers with the cron file instead of writing it
+		if dryRun, _ := req.Args["dry_run"].(bool); dryRun {
+			return sharedSocket.CommandResponse{
+				Code:   200,
+				Status: sharedSocket.GetStatusText(200),
+				Data: map[string]interface{}{
+					"content":        p.adapter.RenderCronSchedules(schedules),
+					"schedule_count": len(schedules),
+				},
+			}
+		}
 		proc, procChan, err = p.adapter.UpdateCronSchedules(schedules)
 
 	case "delete_directory":
@@ -102,7 +113,7 @@ func (p *CmdCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRe
 			}
 		}
 
-		proc, procChan, err = p.adapter.CleanupBackups(backupIDs, folders)
+		proc, procChan, err = p.adapter.CleanupBackups(backupIDs, folders, sharedProcess.ScheduleIDArg(req.Args))
 
 	default:
 		return sharedSocket.CommandResponse{
@@ -150,11 +161,21 @@ func (p *CmdCommandProcessor) mapToSchedule(m map[string]interface{}) model.Sche
 		schedule.BackupType = bt
 	}
 
+	// Strategy
+	if st, ok := m["strategy"].(string); ok {
+		schedule.Strategy = st
+	}
+
 	// Frequency
 	if freq, ok := m["frequency"].(string); ok {
 		schedule.Frequency = freq
 	}
 
+	// Timezone
+	if tz, ok := m["timezone"].(string); ok {
+		schedule.Timezone = tz
+	}
+
 	// Hour
 	if hour, ok := m["hour"]; ok && hour != nil {
 		switch v := hour.(type) {
@@ -188,6 +209,18 @@ func (p *CmdCommandProcessor) mapToSchedule(m map[string]interface{}) model.Sche
 		}
 	}
 
+	// DaysOfWeek
+	if days, ok := m["days_of_week"].([]interface{}); ok {
+		for _, day := range days {
+			switch v := day.(type) {
+			case int:
+				schedule.DaysOfWeek = append(schedule.DaysOfWeek, v)
+			case float64:
+				schedule.DaysOfWeek = append(schedule.DaysOfWeek, int(v))
+			}
+		}
+	}
+
 	// DayOfMonth
 	if dom, ok := m["day_of_month"]; ok && dom != nil {
 		switch v := dom.(type) {
@@ -2,6 +2,7 @@ package validator
 
 import (
 	"fmt"
+	"time"
 )
 
 const (
@@ -28,6 +29,7 @@ type Validator struct {
 	commands         map[string]map[string]string
 	validFrequencies []string
 	validBackupTypes []string
+	validStrategies  []string
 }
 
 func NewValidator() *Validator {
@@ -46,6 +48,7 @@ func NewValidator() *Validator {
 		},
 		validFrequencies: []string{"daily", "weekly", "monthly", "hourly", "interval"},
 		validBackupTypes: []string{"full", "incremental"},
+		validStrategies:  []string{"physical", "logical"},
 	}
 }
 
@@ -88,6 +91,15 @@ func (v *Validator) Validate(cmd string, args map[string]interface{}) Validation
 			}
 		}
 
+		if dryRun, exists := args["dry_run"]; exists {
+			if _, ok := dryRun.(bool); !ok {
+				return ValidationResult{
+					Code:    StatusInvalid,
+					Message: "dry_run must be a boolean",
+				}
+			}
+		}
+
 		// Validate each schedule
 		for idx, scheduleRaw := range schedules {
 			schedule, ok := scheduleRaw.(map[string]interface{})
@@ -118,10 +130,12 @@ func (v *Validator) validateSchedule(schedule map[string]interface{}) Validation
 	validators := []func(map[string]interface{}) ValidationResult{
 		v.validateRequiredFields,
 		v.validateBackupType,
+		v.validateStrategy,
 		v.validateFrequency,
 		v.validateTimeFields,
 		v.validateDayFields,
 		v.validateIntervalFields,
+		v.validateTimezone,
 	}
 
 	for _, validator := range validators {
@@ -174,6 +188,33 @@ func (v *Validator) validateBackupType(schedule map[string]interface{}) Validati
 	return ValidationResult{Code: StatusOK, Message: ""}
 }
 
+func (v *Validator) validateStrategy(schedule map[string]interface{}) ValidationResult {
+	// Strategy is optional, schedules without one use physical backups
+	strategyRaw, exists := schedule["strategy"]
+	if !exists || strategyRaw == nil {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	strategy, ok := strategyRaw.(string)
+	if !ok {
+		return ValidationResult{
+			Code:    StatusInvalid,
+			Message: "strategy must be a string",
+		}
+	}
+
+	for _, validStrategy := range v.validStrategies {
+		if strategy == validStrategy {
+			return ValidationResult{Code: StatusOK, Message: ""}
+		}
+	}
+
+	return ValidationResult{
+		Code:    StatusInvalid,
+		Message: fmt.Sprintf("Invalid strategy: %s", strategy),
+	}
+}
+
 func (v *Validator) validateFrequency(schedule map[string]interface{}) ValidationResult {
 	frequency, ok := schedule["frequency"].(string)
 	if !ok {
@@ -280,6 +321,26 @@ func (v *Validator) validateDayFields(schedule map[string]interface{}) Validatio
 				}
 			}
 		}
+
+		if daysRaw, exists := schedule["days_of_week"]; exists && daysRaw != nil {
+			days, ok := daysRaw.([]interface{})
+			if !ok {
+				return ValidationResult{
+					Code:    StatusInvalid,
+					Message: fmt.Sprintf("Invalid days_of_week: %v", daysRaw),
+				}
+			}
+
+			for _, dayRaw := range days {
+				day, ok := v.toInt(dayRaw)
+				if !ok || day < 0 || day > MaxDayOfWeek {
+					return ValidationResult{
+						Code:    StatusInvalid,
+						Message: fmt.Sprintf("Invalid day in days_of_week: %v. Must be 0-%d", dayRaw, MaxDayOfWeek),
+					}
+				}
+			}
+		}
 	}
 
 	// Validate day_of_month for monthly schedules
@@ -376,3 +437,32 @@ func (v *Validator) toInt(val interface{}) (int, bool) {
 		return 0, false
 	}
 }
+
+func (v *Validator) validateTimezone(schedule map[string]interface{}) ValidationResult {
+	// Timezone is optional, schedules without one run in the host's zone
+	timezoneRaw, exists := schedule["timezone"]
+	if !exists || timezoneRaw == nil {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	timezone, ok := timezoneRaw.(string)
+	if !ok {
+		return ValidationResult{
+			Code:    StatusInvalid,
+			Message: "timezone must be a string",
+		}
+	}
+	if timezone == "" {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	// The zone is written to the cron file, only names known to the host are allowed
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		return ValidationResult{
+			Code:    StatusInvalid,
+			Message: fmt.Sprintf("Invalid timezone: %s", timezone),
+		}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
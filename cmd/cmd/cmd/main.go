@@ -41,6 +41,7 @@ func main() {
 
 	// Create process runner
 	runner := sharedProcess.NewRunner(writer)
+	runner.SetAllowedExecutables(adapter.AllowedExecutables)
 
 	// Create adapter
 	adptr := adapter.NewAdapter(cfg, runner)
@@ -7,11 +7,15 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/adapter"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/handler"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/logfile"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/serverinfo"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/socket"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/validator"
 	sharedProcess "github.com/martijn/dbcalm/shared/process"
@@ -35,15 +39,34 @@ func main() {
 	}
 
 	log.Printf("Loaded configuration: db_type=%s, backup_dir=%s", cfg.DbType, cfg.BackupDir)
+	logFile.SetLimits(megabytes(cfg.LogMaxSize), days(cfg.LogMaxAge), cfg.LogMaxBackups)
+
+	// Backups are refused while the backup directory can't be written to
+	if err := config.CheckBackupDir(cfg.BackupDir); err != nil {
+		log.Printf("Warning: %v, backups are refused until it is fixed", err)
+	}
 
 	// Create process writer
 	writer := sharedProcess.NewWriter(cfg.DatabasePath)
+	writer.SetCompressOutput(cfg.OutputCompressMinSize())
 
 	// Create process runner
 	runner := sharedProcess.NewRunner(writer)
+	runner.SetEnv(cfg.CommandEnv)
+	runner.SetAllowedExecutables(builder.AllowedExecutables(cfg))
+	runner.SetStatusRetry(cfg.StatusUpdateAttempts, cfg.StatusUpdateBackoff, cfg.StatusFallbackFile())
+	runner.SetSuccessExitCodes(cfg.SuccessExitCodes)
+	runner.SetTimeouts(cfg.CommandTimeouts)
+
+	// Statuses the catalog couldn't take last time go in before anything is reaped
+	if written, err := runner.ReconcileStatuses(); err != nil {
+		log.Printf("Warning: failed to write kept process statuses: %v", err)
+	} else if written > 0 {
+		log.Printf("Wrote %d kept process statuses to the catalog", written)
+	}
 
 	// Create adapter
-	adptr, err := adapter.NewAdapter(cfg, runner)
+	adptr, err := adapter.NewAdapter(cfg, runner, writer)
 	if err != nil {
 		log.Fatalf("Failed to create adapter: %v", err)
 	}
@@ -52,10 +75,30 @@ func main() {
 	valid := validator.NewValidator(cfg)
 
 	// Create queue handler
-	queueHandler := handler.NewQueueHandler(cfg)
+	queueHandler := handler.NewQueueHandler(cfg, adptr)
+
+	// Backups the catalog couldn't take last time are recorded before anything is reaped
+	if written, err := queueHandler.ReconcileBackups(); err != nil {
+		log.Printf("Warning: failed to record kept backups: %v", err)
+	} else if written > 0 {
+		log.Printf("Recorded %d kept backups in the catalog", written)
+	}
+
+	// Fail processes a previous run left behind, nothing is waiting on them anymore
+	if err := queueHandler.ReapInterrupted(); err != nil {
+		log.Printf("Warning: failed to reap interrupted processes: %v", err)
+	}
+
+	// Detect the server version and type up front, commands retry if this fails
+	detector := serverinfo.NewDetector(cfg)
+	if info, err := detector.Get(); err != nil {
+		log.Printf("Warning: could not detect server info, backups and restores are refused until it can be: %v", err)
+	} else {
+		log.Printf("Detected %s %d.%d.%d", info.DbType, info.Version.Major, info.Version.Minor, info.Version.Patch)
+	}
 
 	// Create processor and socket server
-	processor := socket.NewDbCommandProcessor(cfg, adptr, valid, queueHandler)
+	processor := socket.NewDbCommandProcessor(cfg, adptr, valid, queueHandler, detector)
 	server := sharedSocket.NewServer(constants.SocketPath, processor)
 
 	// Set up signal handling for graceful shutdown
@@ -80,17 +123,23 @@ func main() {
 }
 
 // setupLogging configures logging to write to both file and stderr during startup
-// Returns the log file handle so main() can switch to file-only after successful startup
-func setupLogging() (*os.File, error) {
+// Returns the log file handle so main() can switch to file-only after successful startup.
+// The log file rotates with the default limits until the configuration is loaded.
+func setupLogging() (*logfile.RotatingFile, error) {
 	// Create log directory if it doesn't exist
 	if err := os.MkdirAll(constants.LogDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory %s: %w", constants.LogDir, err)
 	}
 
 	// Open log file
-	logFile, err := os.OpenFile(constants.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	logFile, err := logfile.Open(
+		constants.LogFile,
+		megabytes(config.DefaultLogMaxSize),
+		days(config.DefaultLogMaxAge),
+		config.DefaultLogMaxBackups,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file %s: %w", constants.LogFile, err)
+		return nil, err
 	}
 
 	// Use MultiWriter to write to both file and stderr during startup
@@ -104,3 +153,11 @@ func setupLogging() (*os.File, error) {
 
 	return logFile, nil
 }
+
+func megabytes(n int) int64 {
+	return int64(n) * 1024 * 1024
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
@@ -1,11 +1,39 @@
 package adapter
 
 import (
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
 	sharedProcess "github.com/martijn/dbcalm/shared/process"
 )
 
 type Adapter interface {
-	FullBackup(id string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error)
-	IncrementalBackup(id, fromBackupID string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error)
-	RestoreBackup(idList []string, target string) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	FullBackup(id string, opts BackupOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	IncrementalBackup(id, fromBackupID string, opts BackupOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	RestoreBackup(idList []string, opts RestoreOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	VerifyBackup(idList []string) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+	ConsolidateBackup(id string, idList []string, scheduleID *int, retire bool) (*sharedProcess.Process, chan *sharedProcess.Process, error)
+}
+
+// BackupOptions are the settings a backup request may carry besides its ids
+type BackupOptions struct {
+	ScheduleID *int
+	// Strategy is physical or logical, incrementals are always physical
+	Strategy          string
+	ExcludeDatabases  []string
+	Hooks             builder.Hooks
+	Verify            bool
+	CredentialsSuffix string
+	Description       string
+}
+
+// RestoreOptions are the settings of a restore of a chain
+type RestoreOptions struct {
+	Target     string
+	TargetPath string
+	Mode       string
+	// Databases limits the restore to part of the backup, all of it when empty
+	Databases         []string
+	CredentialsSuffix string
+	// Record keeps a restore record of a folder restore once it completes
+	Record  bool
+	Archive bool
 }
@@ -0,0 +1,95 @@
+package adapter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// streamFilePattern matches the files backups are streamed to, see builder.StreamFile
+var streamFilePattern = regexp.MustCompile(`^backup-([A-Za-z0-9][A-Za-z0-9_.-]*)\.xbstream(\.gz|\.zst)?$`)
+
+// BackupFile is a backup found in backup_dir, whether the catalog knows it or not
+type BackupFile struct {
+	ID   string
+	Path string
+	// Kind is "folder" or "stream"
+	Kind string
+	// Type is "full" or "incremental", empty when it can't be told, as for streams
+	Type     string
+	Strategy string
+	// FromBackupID is the folder an incremental's LSN range starts at, empty when no
+	// folder in backup_dir ends there
+	FromBackupID string
+	ModifiedAt   time.Time
+}
+
+// ListBackupFiles lists the backups in backup_dir: folders holding a checkpoints file or
+// a dump, and stream files. Anything else, like restores and chains being consolidated,
+// is left out, so the list only holds what a backup would have left behind.
+func ListBackupFiles(cfg *config.Config) ([]BackupFile, error) {
+	entries, err := os.ReadDir(cfg.BackupDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var files []BackupFile
+	toLSNs := make(map[string]string)
+	fromLSNs := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(cfg.BackupDir, name)
+
+		if entry.IsDir() {
+			file := BackupFile{ID: name, Path: path, Kind: "folder", ModifiedAt: info.ModTime()}
+			if _, err := os.Stat(filepath.Join(path, builder.DumpFileName)); err == nil {
+				file.Type = "full"
+				file.Strategy = string(builder.BackupStrategyLogical)
+			} else if from, to, ok := builder.CheckpointLSNs(path); ok {
+				file.Type = "incremental"
+				if from == "0" {
+					file.Type = "full"
+				}
+				file.Strategy = string(builder.BackupStrategyPhysical)
+				toLSNs[to] = name
+				fromLSNs[name] = from
+			} else {
+				continue
+			}
+			files = append(files, file)
+			continue
+		}
+
+		if match := streamFilePattern.FindStringSubmatch(name); match != nil && info.Mode().IsRegular() {
+			files = append(files, BackupFile{
+				ID:         match[1],
+				Path:       path,
+				Kind:       "stream",
+				Strategy:   string(builder.BackupStrategyPhysical),
+				ModifiedAt: info.ModTime(),
+			})
+		}
+	}
+
+	for i := range files {
+		if files[i].Type == "incremental" {
+			files[i].FromBackupID = toLSNs[fromLSNs[files[i].ID]]
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModifiedAt.Before(files[j].ModifiedAt) })
+	return files, nil
+}
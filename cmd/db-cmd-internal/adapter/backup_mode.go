@@ -0,0 +1,57 @@
+package adapter
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// ApplyBackupMode sets the configured permissions and owner on a finished backup: every
+// directory and file of a backup folder, or the stream file. Forwarded streams aren't on
+// this host.
+func ApplyBackupMode(cfg *config.Config, id string) error {
+	uid, gid, err := cfg.BackupOwnerIDs()
+	if err != nil {
+		return err
+	}
+	setMode := cfg.BackupFileMode != 0 && cfg.BackupDirMode != 0
+	if !setMode && uid == -1 && gid == -1 {
+		return nil
+	}
+
+	apply := func(path string, mode os.FileMode) error {
+		if setMode {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		return os.Lchown(path, uid, gid)
+	}
+
+	backupPath := filepath.Join(cfg.BackupDir, id)
+	if info, err := os.Stat(backupPath); err == nil && info.IsDir() {
+		return filepath.WalkDir(backupPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return apply(path, cfg.BackupDirMode)
+			}
+			if entry.Type().IsRegular() {
+				return apply(path, cfg.BackupFileMode)
+			}
+			return nil
+		})
+	}
+
+	if cfg.Stream && !cfg.Forwarded() {
+		streamFile := builder.StreamFile(cfg, id)
+		if _, err := os.Stat(streamFile); err == nil {
+			return apply(streamFile, cfg.BackupFileMode)
+		}
+	}
+	return nil
+}
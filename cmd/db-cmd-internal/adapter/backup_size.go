@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// BackupSizes measures a finished backup. size is the space it takes in backup_dir and
+// uncompressedSize what it holds before compression, nil when the backup isn't compressed.
+// A streamed full backup's uncompressed size is estimated from the data dir, as the stream
+// is never unpacked. Forwarded streams and incremental streams have no measurable sizes.
+func BackupSizes(cfg *config.Config, id, strategy string, incremental bool, excludedDatabases []string) (size, uncompressedSize *int64) {
+	if strategy == string(builder.BackupStrategyLogical) {
+		dumpFile := filepath.Join(cfg.BackupDir, id, builder.DumpFileName)
+		size = fileSize(dumpFile)
+		if size != nil {
+			uncompressedSize = dumpedSize(filepath.Join(cfg.BackupDir, id, builder.DumpSizeFileName))
+		}
+		return size, uncompressedSize
+	}
+
+	if !cfg.Stream {
+		if info, err := os.Stat(filepath.Join(cfg.BackupDir, id)); err == nil && info.IsDir() {
+			total := dirSize(filepath.Join(cfg.BackupDir, id))
+			size = &total
+		}
+		return size, nil
+	}
+
+	if cfg.Forwarded() {
+		return nil, nil
+	}
+	size = fileSize(builder.StreamFile(cfg, id))
+	if size != nil && cfg.Compression != "" && !incremental {
+		estimate := dirSize(cfg.DataDir)
+		for _, name := range excludedDatabases {
+			estimate -= dirSize(filepath.Join(cfg.DataDir, name))
+		}
+		uncompressedSize = &estimate
+	}
+	return size, uncompressedSize
+}
+
+// fileSize returns the size of a regular file, nil when it can't be read
+func fileSize(path string) *int64 {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	size := info.Size()
+	return &size
+}
+
+// dumpedSize reads the byte count from the statistics dd wrote while counting a dump,
+// the line starting with it and " bytes". nil when they can't be read.
+func dumpedSize(path string) *int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		count, rest, found := strings.Cut(line, " ")
+		if !found || !strings.HasPrefix(rest, "bytes") {
+			continue
+		}
+		size, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &size
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package adapter
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// SyncBackup flushes a finished backup to disk: every file and directory of a backup
+// folder, or the stream file, and then backup_dir so the backup's own entry survives a
+// crash too. Forwarded streams aren't on this host.
+func SyncBackup(cfg *config.Config, id string) error {
+	backupPath := filepath.Join(cfg.BackupDir, id)
+	if info, err := os.Stat(backupPath); err == nil && info.IsDir() {
+		err := filepath.WalkDir(backupPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() || entry.Type().IsRegular() {
+				return syncPath(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return syncPath(cfg.BackupDir)
+	}
+
+	if cfg.Stream && !cfg.Forwarded() {
+		streamFile := builder.StreamFile(cfg, id)
+		if _, err := os.Stat(streamFile); err == nil {
+			if err := syncPath(streamFile); err != nil {
+				return err
+			}
+			return syncPath(cfg.BackupDir)
+		}
+	}
+	return nil
+}
+
+// syncPath fsyncs a file or directory
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
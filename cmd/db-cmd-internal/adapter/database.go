@@ -3,7 +3,9 @@ package adapter
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,30 +19,76 @@ import (
 // DatabaseAdapter handles database backup and restore operations
 // Works with both MariaDB (via mariabackup) and MySQL (via xtrabackup)
 type DatabaseAdapter struct {
-	config  *config.Config
-	builder builder.Builder
-	runner  *sharedProcess.Runner
+	config      *config.Config
+	builder     builder.Builder
+	dumpBuilder *builder.DumpBuilder
+	runner      *sharedProcess.Runner
+	writer      *sharedProcess.Writer
 }
 
 // NewDatabaseAdapter creates a new database adapter that works with both MariaDB and MySQL
-func NewDatabaseAdapter(cfg *config.Config, bldr builder.Builder, runner *sharedProcess.Runner) *DatabaseAdapter {
+func NewDatabaseAdapter(cfg *config.Config, bldr builder.Builder, runner *sharedProcess.Runner, writer *sharedProcess.Writer) *DatabaseAdapter {
 	return &DatabaseAdapter{
-		config:  cfg,
-		builder: bldr,
-		runner:  runner,
+		config:      cfg,
+		builder:     bldr,
+		dumpBuilder: builder.NewDumpBuilder(cfg),
+		runner:      runner,
+		writer:      writer,
 	}
 }
 
-func (a *DatabaseAdapter) FullBackup(id string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+func (a *DatabaseAdapter) FullBackup(id string, opts BackupOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+	exclude := a.excludedDatabases(opts.ExcludeDatabases)
+	hooks := a.backupHooks(opts.Hooks)
+	bldr, dumpBuilder := a.builders(opts.CredentialsSuffix)
+	strategy := opts.Strategy
+
 	// Build command
-	cmd := a.builder.BuildFullBackupCmd(id)
+	var cmd []string
+	var err error
+	if strategy == string(builder.BackupStrategyLogical) {
+		// Dumped by name, so the databases the dump holds are listed alongside it
+		all, listErr := listDatabases(dumpBuilder)
+		if listErr != nil {
+			return nil, nil, listErr
+		}
+		databases := builder.DatabasesToDump(all, exclude)
+		if len(databases) == 0 {
+			return nil, nil, fmt.Errorf("every database is excluded, nothing to back up")
+		}
+		cmd, err = dumpBuilder.BuildFullBackupCmd(id, databases)
+	} else {
+		strategy = string(builder.BackupStrategyPhysical)
+		cmd, err = bldr.BuildFullBackupCmd(id, exclude)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if cmd, err = a.withGrantsCapture(cmd, id, dumpBuilder); err != nil {
+		return nil, nil, err
+	}
+	if cmd, err = a.wrapBackupCmd(cmd, id, hooks); err != nil {
+		return nil, nil, err
+	}
 
 	// Prepare args
 	args := map[string]interface{}{
-		"id": id,
+		"id":                 id,
+		"strategy":           strategy,
+		"excluded_databases": exclude,
 	}
-	if scheduleID != nil {
-		args["schedule_id"] = *scheduleID
+	if opts.ScheduleID != nil {
+		args["schedule_id"] = *opts.ScheduleID
+	}
+	addHookArgs(args, hooks)
+	if opts.Verify {
+		args["verify"] = true
+	}
+	if opts.CredentialsSuffix != "" {
+		args["credentials_suffix"] = opts.CredentialsSuffix
+	}
+	if opts.Description != "" {
+		args["description"] = opts.Description
 	}
 
 	// Execute command
@@ -49,17 +97,41 @@ func (a *DatabaseAdapter) FullBackup(id string, scheduleID *int) (*sharedProcess
 	return proc, procChan, nil
 }
 
-func (a *DatabaseAdapter) IncrementalBackup(id, fromBackupID string, scheduleID *int) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+func (a *DatabaseAdapter) IncrementalBackup(id, fromBackupID string, opts BackupOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+	exclude := a.excludedDatabases(opts.ExcludeDatabases)
+	hooks := a.backupHooks(opts.Hooks)
+	bldr, dumpBuilder := a.builders(opts.CredentialsSuffix)
+
 	// Build command
-	cmd := a.builder.BuildIncrementalBackupCmd(id, fromBackupID)
+	cmd, err := bldr.BuildIncrementalBackupCmd(id, fromBackupID, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cmd, err = a.withGrantsCapture(cmd, id, dumpBuilder); err != nil {
+		return nil, nil, err
+	}
+	if cmd, err = a.wrapBackupCmd(cmd, id, hooks); err != nil {
+		return nil, nil, err
+	}
 
 	// Prepare args
 	args := map[string]interface{}{
-		"id":             id,
-		"from_backup_id": fromBackupID,
+		"id":                 id,
+		"from_backup_id":     fromBackupID,
+		"excluded_databases": exclude,
 	}
-	if scheduleID != nil {
-		args["schedule_id"] = *scheduleID
+	if opts.ScheduleID != nil {
+		args["schedule_id"] = *opts.ScheduleID
+	}
+	addHookArgs(args, hooks)
+	if opts.Verify {
+		args["verify"] = true
+	}
+	if opts.CredentialsSuffix != "" {
+		args["credentials_suffix"] = opts.CredentialsSuffix
+	}
+	if opts.Description != "" {
+		args["description"] = opts.Description
 	}
 
 	// Execute command
@@ -68,11 +140,115 @@ func (a *DatabaseAdapter) IncrementalBackup(id, fromBackupID string, scheduleID
 	return proc, procChan, nil
 }
 
-func (a *DatabaseAdapter) RestoreBackup(idList []string, target string) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+// wrapBackupCmd runs a backup command between its hooks, in the configured cgroup
+func (a *DatabaseAdapter) wrapBackupCmd(cmd []string, id string, hooks builder.Hooks) ([]string, error) {
+	cmd, err := builder.WrapWithHooks(a.config, cmd, id, hooks)
+	if err != nil {
+		return nil, err
+	}
+	return builder.WrapWithCgroup(a.config, cmd)
+}
+
+// builders returns the command builders for the requested credentials section,
+// the configured one when credentialsSuffix is empty
+func (a *DatabaseAdapter) builders(credentialsSuffix string) (builder.Builder, *builder.DumpBuilder) {
+	if credentialsSuffix == "" {
+		return a.builder, a.dumpBuilder
+	}
+	return a.builder.WithCredentialsSuffix(credentialsSuffix), a.dumpBuilder.WithCredentialsSuffix(credentialsSuffix)
+}
+
+// backupHooks fills in the globally configured hooks for any stage the request leaves empty
+func (a *DatabaseAdapter) backupHooks(requested builder.Hooks) builder.Hooks {
+	if requested.PreBackup == "" {
+		requested.PreBackup = a.config.PreBackupHook
+	}
+	if requested.PostBackup == "" {
+		requested.PostBackup = a.config.PostBackupHook
+	}
+	return requested
+}
+
+// addHookArgs records the hooks that ran around the backup on the process
+func addHookArgs(args map[string]interface{}, hooks builder.Hooks) {
+	if hooks.PreBackup != "" {
+		args["pre_backup_hook"] = hooks.PreBackup
+	}
+	if hooks.PostBackup != "" {
+		args["post_backup_hook"] = hooks.PostBackup
+	}
+}
+
+// excludedDatabases merges the globally configured exclusions with the requested ones
+func (a *DatabaseAdapter) excludedDatabases(requested []string) []string {
+	seen := map[string]bool{}
+	exclude := []string{}
+	for _, name := range append(append([]string{}, a.config.ExcludeDatabases...), requested...) {
+		if !seen[name] {
+			seen[name] = true
+			exclude = append(exclude, name)
+		}
+	}
+	return exclude
+}
+
+// listDatabases asks the running server for its databases, one per line since a
+// name can hold spaces
+func listDatabases(dumpBuilder *builder.DumpBuilder) ([]string, error) {
+	cmd := dumpBuilder.BuildListDatabasesCmd()
+	output, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	var databases []string
+	for _, name := range strings.Split(string(output), "\n") {
+		if name != "" {
+			databases = append(databases, name)
+		}
+	}
+	return databases, nil
+}
+
+// RestoreBackup restores the chain in idList. Folder restores go to opts.TargetPath when
+// set, or a timestamped folder under backup_dir/restores. Non-empty opts.Databases limit a
+// logical restore to their sections of the dump, and a folder restore to their directories.
+// A grants restore only applies the grants.sql captured with the backup.
+// A folder restore without opts.Record leaves no restore record once it completes, and an
+// archived one is packed into a tar.zst archive once prepared.
+func (a *DatabaseAdapter) RestoreBackup(idList []string, opts RestoreOptions) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+	bldr, dumpBuilder := a.builders(opts.CredentialsSuffix)
+
+	// Logical and grants restores replay SQL straight into the running server, no temp dir needed
+	if opts.Mode == string(builder.RestoreModeLogical) || opts.Mode == string(builder.RestoreModeGrants) {
+		cmd, err := dumpBuilder.BuildRestoreCmd(idList[0], opts.Databases)
+		if opts.Mode == string(builder.RestoreModeGrants) {
+			cmd, err = dumpBuilder.BuildApplyGrantsCmd(idList[0])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		args := map[string]interface{}{
+			"id_list":      idList,
+			"target":       opts.Target,
+			"tmp_dir":      "",
+			"restore_mode": opts.Mode,
+		}
+		if len(opts.Databases) > 0 {
+			args["databases"] = opts.Databases
+		}
+		if opts.CredentialsSuffix != "" {
+			args["credentials_suffix"] = opts.CredentialsSuffix
+		}
+		proc, procChan := a.runner.Execute(cmd, process.TypeRestore, nil, args)
+		return proc, procChan, nil
+	}
+
 	// Create temporary directory
 	var tmpDir string
-	if target == string(builder.RestoreTargetDatabase) {
+	if opts.Target == string(builder.RestoreTargetDatabase) {
 		tmpDir = fmt.Sprintf("%s%s", constants.TempRestorePrefix, uuid.New().String())
+	} else if opts.TargetPath != "" {
+		tmpDir = filepath.Clean(opts.TargetPath)
 	} else {
 		tmpDir = filepath.Join(a.config.BackupDir, "restores", time.Now().Format("2006-01-02-15-04-05"))
 	}
@@ -83,17 +259,117 @@ func (a *DatabaseAdapter) RestoreBackup(idList []string, target string) (*shared
 	}
 
 	// Build restore commands
-	commands := a.builder.BuildRestoreCmds(tmpDir, idList, target)
+	buildTarget := opts.Target
+	if opts.Archive {
+		buildTarget = string(builder.RestoreTargetArchive)
+	}
+	commands, err := bldr.BuildRestoreCmds(tmpDir, idList, buildTarget)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Prepare args
 	args := map[string]interface{}{
-		"id_list": idList,
-		"target":  target,
-		"tmp_dir": tmpDir,
+		"id_list":      idList,
+		"target":       opts.Target,
+		"tmp_dir":      tmpDir,
+		"restore_mode": string(builder.RestoreModePhysical),
+	}
+	if len(opts.Databases) > 0 {
+		args["databases"] = opts.Databases
+	}
+	if !opts.Record {
+		args["record"] = false
+	}
+	if opts.Archive {
+		args["archive"] = true
+	}
+
+	// The safety copy is taken right before copy-back, once the backup is known to prepare
+	if opts.Target == string(builder.RestoreTargetDatabase) && a.config.PreRestoreCopy {
+		if dir, ok := a.safetyCopyDir(); ok {
+			last := len(commands) - 1
+			if commands[last], err = builder.SafetyCopyCmd(a.config, a.config.DataDir, dir, commands[last]); err != nil {
+				return nil, nil, err
+			}
+			args["safety_copy_path"] = dir
+		}
 	}
 
 	// Execute consecutive commands
 	proc, procChan := a.runner.ExecuteConsecutive(commands, process.TypeRestore, args)
 
+	// Report progress while the restore runs
+	sourceDir := filepath.Join(a.config.BackupDir, idList[0])
+	copyDir := filepath.Join(tmpDir, idList[0])
+	finalPhase := ""
+	if opts.Target == string(builder.RestoreTargetDatabase) {
+		finalPhase = PhaseCopyingBack
+	} else if opts.Archive {
+		finalPhase = PhaseArchiving
+	}
+	go a.trackRestoreProgress(proc.CommandID, commands, sourceDir, copyDir, finalPhase)
+
+	return proc, procChan, nil
+}
+
+// VerifyBackup checks a backup can be restored without touching the server: physical
+// backups are prepared (with their chain) in a temporary directory, logical dumps are
+// checked for a complete gzip stream. idList runs from the full backup to the one verified.
+func (a *DatabaseAdapter) VerifyBackup(idList []string) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+	args := map[string]interface{}{
+		"id":      idList[len(idList)-1],
+		"id_list": idList,
+		"tmp_dir": "",
+	}
+
+	dumpFile := filepath.Join(a.config.BackupDir, idList[0], builder.DumpFileName)
+	if _, err := os.Stat(dumpFile); err == nil {
+		proc, procChan := a.runner.Execute([]string{"gzip", "-t", dumpFile}, process.TypeVerifyBackup, nil, args)
+		return proc, procChan, nil
+	}
+
+	tmpDir := fmt.Sprintf("%s%s", constants.TempVerifyPrefix, uuid.New().String())
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary verify directory: %w", err)
+	}
+	args["tmp_dir"] = tmpDir
+
+	commands, err := a.builder.BuildRestoreCmds(tmpDir, idList, string(builder.RestoreTargetFolder))
+	if err != nil {
+		return nil, nil, err
+	}
+	proc, procChan := a.runner.ExecuteConsecutive(commands, process.TypeVerifyBackup, args)
+
+	return proc, procChan, nil
+}
+
+// ConsolidateBackup prepares a chain (full backup first) into a new standalone full
+// backup id. The chain is prepared in a directory inside backup_dir that the queue
+// handler moves into place once every step succeeded, retiring the chain when asked to.
+func (a *DatabaseAdapter) ConsolidateBackup(id string, idList []string, scheduleID *int, retire bool) (*sharedProcess.Process, chan *sharedProcess.Process, error) {
+	tmpDir := builder.ConsolidateDir(a.config, id)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create consolidation directory: %w", err)
+	}
+
+	args := map[string]interface{}{
+		"id":      id,
+		"id_list": idList,
+		"tmp_dir": tmpDir,
+	}
+	if scheduleID != nil {
+		args["schedule_id"] = *scheduleID
+	}
+	if retire {
+		args["retire"] = true
+	}
+
+	commands, err := a.builder.BuildRestoreCmds(tmpDir, idList, string(builder.RestoreTargetFolder))
+	if err != nil {
+		return nil, nil, err
+	}
+	proc, procChan := a.runner.ExecuteConsecutive(commands, process.TypeConsolidate, args)
+
 	return proc, procChan, nil
 }
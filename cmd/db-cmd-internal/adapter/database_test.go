@@ -0,0 +1,92 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	sharedProcess "github.com/martijn/dbcalm/shared/process"
+)
+
+// restoreBuilder prepares with a no-op and stands in for copy-back with copyBack
+type restoreBuilder struct {
+	copyBack []string
+}
+
+func (b *restoreBuilder) BuildFullBackupCmd(id string, excludeDatabases []string) ([]string, error) {
+	return nil, nil
+}
+
+func (b *restoreBuilder) BuildIncrementalBackupCmd(id, fromBackupID string, excludeDatabases []string) ([]string, error) {
+	return nil, nil
+}
+
+func (b *restoreBuilder) BuildRestoreCmds(tmpDir string, idList []string, target string) ([][]string, error) {
+	return [][]string{{"true"}, b.copyBack}, nil
+}
+
+func (b *restoreBuilder) WithCredentialsSuffix(suffix string) builder.Builder {
+	return b
+}
+
+func TestRestoreBackupTakesSafetyCopyBeforeCopyBack(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "mysql")
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		t.Fatalf("failed to create data dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "ibdata1"), []byte("system tablespace"), 0600); err != nil {
+		t.Fatalf("failed to write ibdata1: %v", err)
+	}
+
+	cfg := &config.Config{
+		DbType:            "mariadb",
+		BackupDir:         filepath.Join(root, "backups"),
+		DataDir:           dataDir,
+		DataDirCheck:      config.DataDirCheckWarn,
+		PreRestoreCopy:    true,
+		PreRestoreCopyDir: filepath.Join(root, "pre-restore"),
+	}
+	writer := sharedProcess.NewWriter(filepath.Join(root, "db.sqlite3"))
+	runner := sharedProcess.NewRunner(writer)
+	runner.SetStatusRetry(1, 0, "")
+	bldr := &restoreBuilder{copyBack: []string{"/bin/sh", "-c", "echo restored > " + filepath.Join(dataDir, "ibdata1")}}
+	a := NewDatabaseAdapter(cfg, bldr, runner, writer)
+
+	proc, procChan, err := a.RestoreBackup([]string{"full-1"}, RestoreOptions{
+		Target: string(builder.RestoreTargetDatabase),
+		Mode:   string(builder.RestoreModePhysical),
+		Record: true,
+	})
+	if err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if tmpDir, ok := proc.Args["tmp_dir"].(string); ok && tmpDir != "" {
+		t.Cleanup(func() { os.RemoveAll(tmpDir) })
+	}
+
+	select {
+	case final := <-procChan:
+		if final.Status != sharedProcess.StatusSuccess {
+			t.Fatalf("expected the restore to succeed, got %s", final.Status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("restore did not finish")
+	}
+
+	copyDir, ok := proc.Args["safety_copy_path"].(string)
+	if !ok || copyDir == "" {
+		t.Fatalf("expected safety_copy_path on the restore, got %v", proc.Args)
+	}
+	copied, err := os.ReadFile(filepath.Join(copyDir, "ibdata1"))
+	if err != nil || string(copied) != "system tablespace" {
+		t.Errorf("expected ibdata1 copied as it was before copy-back, got %q (%v)", copied, err)
+	}
+	restored, _ := os.ReadFile(filepath.Join(dataDir, "ibdata1"))
+	if string(restored) != "restored\n" {
+		t.Errorf("expected copy-back to run after the copy, got ibdata1 %q", restored)
+	}
+}
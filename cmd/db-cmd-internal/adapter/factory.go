@@ -8,7 +8,7 @@ import (
 	sharedProcess "github.com/martijn/dbcalm/shared/process"
 )
 
-func NewAdapter(cfg *config.Config, runner *sharedProcess.Runner) (Adapter, error) {
+func NewAdapter(cfg *config.Config, runner *sharedProcess.Runner, writer *sharedProcess.Writer) (Adapter, error) {
 	// Create builder
 	bldr, err := builder.NewBuilder(cfg)
 	if err != nil {
@@ -17,5 +17,5 @@ func NewAdapter(cfg *config.Config, runner *sharedProcess.Runner) (Adapter, erro
 
 	// Both MariaDB and MySQL use the same adapter implementation
 	// The difference is in the builder (MariabackupBuilder vs XtrabackupBuilder)
-	return NewDatabaseAdapter(cfg, bldr, runner), nil
+	return NewDatabaseAdapter(cfg, bldr, runner, writer), nil
 }
@@ -0,0 +1,26 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// withGrantsCapture has a backup command write the server's users and grants to
+// grants.sql in the backup's folder once it succeeds, when capture_grants is on, so they
+// can be restored without the rest of the backup. Loading the config rejects it for
+// streamed backups, which have no folder to hold the file.
+func (a *DatabaseAdapter) withGrantsCapture(cmd []string, id string, dumpBuilder *builder.DumpBuilder) ([]string, error) {
+	if !a.config.CaptureGrants {
+		return cmd, nil
+	}
+	return dumpBuilder.WithGrantsCapture(cmd, id)
+}
+
+// HasGrants reports whether grants.sql was captured with a finished backup
+func HasGrants(cfg *config.Config, id string) bool {
+	_, err := os.Stat(filepath.Join(cfg.BackupDir, id, builder.GrantsFileName))
+	return err == nil
+}
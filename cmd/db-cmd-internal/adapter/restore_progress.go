@@ -0,0 +1,174 @@
+package adapter
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	sharedProcess "github.com/martijn/dbcalm/shared/process"
+)
+
+// Restore phases reported on the process record while a restore runs
+const (
+	PhaseCopying     = "copying"
+	PhasePreparing   = "preparing"
+	PhaseCopyingBack = "copying-back"
+	PhaseArchiving   = "archiving"
+	PhaseDone        = "done"
+	// PhaseApplyingIncrementals only shows in phase timings, progress counts it as preparing
+	PhaseApplyingIncrementals = "applying-incrementals"
+)
+
+const (
+	progressPollInterval = 2 * time.Second
+	// maxProgressLookupFailures stops tracking when the process record cannot be read
+	maxProgressLookupFailures = 30
+)
+
+// trackRestoreProgress polls a running restore and writes a coarse progress percentage
+// and phase to its process record until the last command finishes or one fails.
+// The current step is derived from the command line of the latest process row.
+// finalPhase is the phase of the last steps that follow the prepare steps, copying back
+// or archiving, empty when the restore ends with preparing.
+func (a *DatabaseAdapter) trackRestoreProgress(commandID string, commands [][]string, sourceDir, copyDir string, finalPhase string) {
+	totalBytes := dirSize(sourceDir)
+
+	lines := make([]string, len(commands))
+	for i, cmd := range commands {
+		lines[i] = strings.Join(cmd, " ")
+	}
+	finalSteps := 0
+	for i := len(lines) - 1; finalPhase != "" && i > 0 && restoreStepPhase(i, lines[i]) == finalPhase; i-- {
+		finalSteps++
+	}
+
+	failures := 0
+	for {
+		time.Sleep(progressPollInterval)
+
+		proc, err := a.writer.GetProcessByCommandID(commandID)
+		if err != nil || proc == nil {
+			failures++
+			if failures >= maxProgressLookupFailures {
+				log.Printf("Stopped tracking restore progress for %s: process record unavailable", commandID)
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		if proc.Status == sharedProcess.StatusFailed {
+			return
+		}
+
+		step := -1
+		for i, line := range lines {
+			if line == proc.Command {
+				step = i
+				break
+			}
+		}
+		if step < 0 {
+			continue
+		}
+
+		if proc.Status == sharedProcess.StatusSuccess && step == len(lines)-1 {
+			if err := a.writer.UpdateProgress(commandID, 100, PhaseDone); err != nil {
+				log.Printf("Failed to update restore progress: %v", err)
+			}
+			return
+		}
+
+		var copiedBytes int64
+		if step == 0 {
+			copiedBytes = dirSize(copyDir)
+		}
+
+		progress, phase := estimateRestoreProgress(step, len(lines), finalSteps, copiedBytes, totalBytes, finalPhase)
+		if err := a.writer.UpdateProgress(commandID, progress, phase); err != nil {
+			log.Printf("Failed to update restore progress: %v", err)
+		}
+	}
+}
+
+// estimateRestoreProgress maps the current restore step to a percentage and phase.
+// Copying the full backup covers 0-40% (by bytes copied), the prepare steps share the
+// next 50% (60% for plain folder restores) and the last finalSteps, copying back or
+// archiving, cover the remainder.
+func estimateRestoreProgress(step, totalSteps, finalSteps int, copiedBytes, totalBytes int64, finalPhase string) (int, string) {
+	const copySpan = 40
+
+	if step == 0 {
+		if totalBytes <= 0 {
+			return 0, PhaseCopying
+		}
+		progress := int(copiedBytes * copySpan / totalBytes)
+		if progress > copySpan {
+			progress = copySpan
+		}
+		return progress, PhaseCopying
+	}
+
+	prepareSteps := totalSteps - 1
+	prepareSpan := 60
+	if finalPhase != "" {
+		prepareSteps -= finalSteps
+		prepareSpan = 50
+		if step >= totalSteps-finalSteps {
+			return copySpan + prepareSpan, finalPhase
+		}
+	}
+	if prepareSteps <= 0 {
+		return copySpan, PhasePreparing
+	}
+
+	return copySpan + prepareSpan*(step-1)/prepareSteps, PhasePreparing
+}
+
+// RestorePhaseDurations sums the steps of a physical restore per phase, in seconds.
+// The phase of a step follows from its command line as BuildRestoreCmds writes it.
+func RestorePhaseDurations(steps []sharedProcess.Step) map[string]float64 {
+	durations := make(map[string]float64)
+	for i, step := range steps {
+		durations[restoreStepPhase(i, step.Command)] += step.Duration().Seconds()
+	}
+	return durations
+}
+
+// restoreStepPhase is the phase of step i of a physical restore, from its command line
+func restoreStepPhase(i int, command string) string {
+	switch {
+	case i == 0, strings.Contains(command, " -x -C "):
+		// Extracting a streamed backup takes the place of copying it
+		return PhaseCopying
+	case strings.Contains(command, "--copy-back"),
+		strings.HasPrefix(command, "rm -f ") && strings.HasSuffix(command, "/"+builder.GrantsFileName):
+		// Leaving the captured grants out of the prepared folder belongs to copying back
+		return PhaseCopyingBack
+	case strings.Contains(command, builder.ArchiveSuffix):
+		return PhaseArchiving
+	case strings.Contains(command, "--incremental-dir="):
+		return PhaseApplyingIncrementals
+	}
+	return PhasePreparing
+}
+
+// dirSize returns the total size in bytes of all regular files below path
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,113 @@
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	sharedProcess "github.com/martijn/dbcalm/shared/process"
+)
+
+func TestEstimateRestoreProgress(t *testing.T) {
+	tests := []struct {
+		name          string
+		step          int
+		totalSteps    int
+		finalSteps    int
+		copiedBytes   int64
+		totalBytes    int64
+		finalPhase    string
+		expected      int
+		expectedPhase string
+	}{
+		{name: "folder copying", step: 0, totalSteps: 3, copiedBytes: 50, totalBytes: 100, expected: 20, expectedPhase: PhaseCopying},
+		{name: "folder copying an empty backup", step: 0, totalSteps: 3, expected: 0, expectedPhase: PhaseCopying},
+		{name: "folder preparing", step: 1, totalSteps: 3, expected: 40, expectedPhase: PhasePreparing},
+		{name: "folder applying the incremental", step: 2, totalSteps: 3, expected: 70, expectedPhase: PhasePreparing},
+		{name: "archive preparing", step: 1, totalSteps: 3, finalSteps: 1, finalPhase: PhaseArchiving, expected: 40, expectedPhase: PhasePreparing},
+		{name: "archive packing", step: 2, totalSteps: 3, finalSteps: 1, finalPhase: PhaseArchiving, expected: 90, expectedPhase: PhaseArchiving},
+		{name: "database preparing", step: 1, totalSteps: 3, finalSteps: 1, finalPhase: PhaseCopyingBack, expected: 40, expectedPhase: PhasePreparing},
+		{name: "database copying back", step: 2, totalSteps: 3, finalSteps: 1, finalPhase: PhaseCopyingBack, expected: 90, expectedPhase: PhaseCopyingBack},
+		{name: "database removing grants", step: 2, totalSteps: 4, finalSteps: 2, finalPhase: PhaseCopyingBack, expected: 90, expectedPhase: PhaseCopyingBack},
+		{name: "database copying back after grants", step: 3, totalSteps: 4, finalSteps: 2, finalPhase: PhaseCopyingBack, expected: 90, expectedPhase: PhaseCopyingBack},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, phase := estimateRestoreProgress(tt.step, tt.totalSteps, tt.finalSteps, tt.copiedBytes, tt.totalBytes, tt.finalPhase)
+			if progress != tt.expected || phase != tt.expectedPhase {
+				t.Errorf("expected %d%% %s, got %d%% %s", tt.expected, tt.expectedPhase, progress, phase)
+			}
+		})
+	}
+}
+
+func TestRestorePhaseDurationsFollowRestoreCmds(t *testing.T) {
+	cfg := &config.Config{DbType: "mariadb", BackupDir: t.TempDir()}
+	for _, id := range []string{"full", "incr-1"} {
+		if err := os.Mkdir(filepath.Join(cfg.BackupDir, id), 0700); err != nil {
+			t.Fatalf("failed to create backup folder: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(cfg.BackupDir, "full", builder.GrantsFileName), []byte("GRANT USAGE ON *.* TO `app`@`%`;\n"), 0600); err != nil {
+		t.Fatalf("failed to write grants: %v", err)
+	}
+	bldr := builder.NewMariadbBuilder(cfg, builder.Version{Major: 10, Minor: 11})
+
+	tests := []struct {
+		target   string
+		expected []string
+	}{
+		{
+			target:   string(builder.RestoreTargetFolder),
+			expected: []string{PhaseCopying, PhasePreparing, PhaseApplyingIncrementals},
+		},
+		{
+			target:   string(builder.RestoreTargetArchive),
+			expected: []string{PhaseCopying, PhasePreparing, PhaseApplyingIncrementals, PhaseArchiving},
+		},
+		{
+			target:   string(builder.RestoreTargetDatabase),
+			expected: []string{PhaseCopying, PhasePreparing, PhaseApplyingIncrementals, PhaseCopyingBack, PhaseCopyingBack},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			commands, err := bldr.BuildRestoreCmds("/tmp/dbcalm-restore-x", []string{"full", "incr-1"}, tt.target)
+			if err != nil {
+				t.Fatalf("failed to build commands: %v", err)
+			}
+			if len(commands) != len(tt.expected) {
+				t.Fatalf("expected %d steps, got %d: %v", len(tt.expected), len(commands), commands)
+			}
+
+			// Each step takes a second more than the one before, so every phase sums differently
+			start := time.Date(2025, 11, 16, 10, 0, 0, 0, time.UTC)
+			steps := make([]sharedProcess.Step, len(commands))
+			want := make(map[string]float64)
+			for i, cmd := range commands {
+				steps[i] = sharedProcess.Step{
+					Command:   strings.Join(cmd, " "),
+					StartTime: start,
+					EndTime:   start.Add(time.Duration(i+1) * time.Second),
+				}
+				want[tt.expected[i]] += float64(i + 1)
+			}
+
+			durations := RestorePhaseDurations(steps)
+			if len(durations) != len(want) {
+				t.Errorf("expected phases %v, got %v", want, durations)
+			}
+			for phase, seconds := range want {
+				if durations[phase] != seconds {
+					t.Errorf("expected %s to take %.0fs, got %.0fs (%v)", phase, seconds, durations[phase], durations)
+				}
+			}
+		})
+	}
+}
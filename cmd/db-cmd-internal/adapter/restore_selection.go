@@ -0,0 +1,31 @@
+package adapter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KeepDatabases removes the directories of every database but the given ones from a
+// prepared folder restore in dir. The shared files (system tablespace, redo logs) stay,
+// as the kept tables need them to be opened or imported.
+func KeepDatabases(dir string, databases []string) error {
+	keep := make(map[string]bool, len(databases))
+	for _, name := range databases {
+		keep[name] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read restored folder: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || keep[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove database %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package adapter
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// safetyCopyDir returns the folder the data dir is copied to before a database restore.
+// It reports false, after logging why, when pre_restore_copy_dir can't be created or its
+// filesystem has less space available than the data dir takes.
+func (a *DatabaseAdapter) safetyCopyDir() (string, bool) {
+	if err := os.MkdirAll(a.config.PreRestoreCopyDir, 0700); err != nil {
+		log.Printf("Warning: skipping the pre-restore copy of %s: %v", a.config.DataDir, err)
+		return "", false
+	}
+
+	// Filesystems that can't be asked are left to the copy itself, which stops the restore
+	// before copy-back when it runs out of space
+	required := dirSize(a.config.DataDir)
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(a.config.PreRestoreCopyDir, &stat); err == nil {
+		if available := int64(stat.Bavail) * int64(stat.Bsize); available < required {
+			log.Printf("Warning: skipping the pre-restore copy of %s, it takes %d bytes and %s has %d available",
+				a.config.DataDir, required, a.config.PreRestoreCopyDir, available)
+			return "", false
+		}
+	}
+
+	return filepath.Join(a.config.PreRestoreCopyDir, time.Now().Format("2006-01-02-15-04-05")), true
+}
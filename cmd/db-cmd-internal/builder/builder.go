@@ -1,9 +1,23 @@
 package builder
 
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+)
+
 type Builder interface {
-	BuildFullBackupCmd(id string) []string
-	BuildIncrementalBackupCmd(id, fromBackupID string) []string
-	BuildRestoreCmds(tmpDir string, idList []string, target string) [][]string
+	BuildFullBackupCmd(id string, excludeDatabases []string) ([]string, error)
+	BuildIncrementalBackupCmd(id, fromBackupID string, excludeDatabases []string) ([]string, error)
+	BuildRestoreCmds(tmpDir string, idList []string, target string) ([][]string, error)
+	// WithCredentialsSuffix returns a builder using another section of the credentials file
+	WithCredentialsSuffix(suffix string) Builder
 }
 
 type RestoreTarget string
@@ -11,4 +25,191 @@ type RestoreTarget string
 const (
 	RestoreTargetDatabase RestoreTarget = "database"
 	RestoreTargetFolder   RestoreTarget = "folder"
+	// RestoreTargetArchive is a folder restore packed into an archive once prepared. It is
+	// only passed to BuildRestoreCmds, the restore itself still targets a folder.
+	RestoreTargetArchive RestoreTarget = "archive"
 )
+
+// ArchiveSuffix is appended to the prepared folder of an archived folder restore
+const ArchiveSuffix = ".tar.zst"
+
+type RestoreMode string
+
+const (
+	RestoreModePhysical RestoreMode = "physical"
+	RestoreModeLogical  RestoreMode = "logical"
+	// RestoreModeGrants applies only the users and grants captured with a backup
+	RestoreModeGrants RestoreMode = "grants"
+)
+
+type BackupStrategy string
+
+const (
+	BackupStrategyPhysical BackupStrategy = "physical"
+	BackupStrategyLogical  BackupStrategy = "logical"
+)
+
+// DumpFileName is the compressed SQL dump written by logical backups and replayed by logical restores
+const DumpFileName = "dump.sql.gz"
+
+// DumpSizeFileName records a logical backup's uncompressed size, the statistics dd
+// writes as it passes the dump on to gzip
+const DumpSizeFileName = "dump.size"
+
+// DumpDatabasesFileName lists the databases a logical backup dumped, one per line, written
+// as the dump starts so restores can check a selection without reading the dump
+const DumpDatabasesFileName = "dump.databases"
+
+// GrantsFileName holds the users and grants captured alongside a backup with capture_grants
+const GrantsFileName = "grants.sql"
+
+// ConsolidateDir is the directory a chain is prepared in before it replaces the new full
+// backup's directory. It lives in backup_dir so the prepared copy can be renamed into place.
+func ConsolidateDir(cfg *config.Config, id string) string {
+	return filepath.Join(cfg.BackupDir, ".consolidate-"+id)
+}
+
+// SafetyCopyCmd copies what is in dataDir to dir before running copyBack, so the files a
+// database restore copies back over can be put back. copyBack doesn't run when the copy fails.
+func SafetyCopyCmd(cfg *config.Config, dataDir, dir string, copyBack []string) ([]string, error) {
+	if err := checkStages(cfg, "cp", strings.Join(copyBack, " ")); err != nil {
+		return nil, err
+	}
+	quoted := make([]string, len(copyBack))
+	for i, arg := range copyBack {
+		quoted[i] = shellQuote(arg)
+	}
+	safetyCopy := fmt.Sprintf("mkdir -p %s && cp -a %s %s", shellQuote(dir), shellQuote(dataDir+"/."), shellQuote(dir))
+	return shellCmd(fmt.Sprintf("%s && exec %s", safetyCopy, strings.Join(quoted, " "))), nil
+}
+
+// StreamFile is the file a streamed backup is written to when it isn't forwarded
+func StreamFile(cfg *config.Config, id string) string {
+	outputFile := filepath.Join(cfg.BackupDir, fmt.Sprintf("backup-%s.xbstream", id))
+	if cfg.Compression == "gzip" {
+		outputFile += ".gz"
+	} else if cfg.Compression == "zstd" {
+		outputFile += ".zst"
+	}
+	return outputFile
+}
+
+// streamSuffixes are the names a stream file can have, by the compression it was written
+// with. Compression may have changed since, so a restore looks for each of them.
+var streamSuffixes = []string{".xbstream", ".xbstream.gz", ".xbstream.zst"}
+
+// FindStreamFile returns the file a backup was streamed to on this host, if any
+func FindStreamFile(cfg *config.Config, id string) (string, bool) {
+	for _, suffix := range streamSuffixes {
+		path := filepath.Join(cfg.BackupDir, "backup-"+id+suffix)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// CheckpointLSNs reads from_lsn and to_lsn from the checkpoints file of the backup folder
+// dir, which MariaDB 11 renamed from xtrabackup_checkpoints
+func CheckpointLSNs(dir string) (from, to string, ok bool) {
+	for _, name := range []string{"xtrabackup_checkpoints", "mariadb_backup_checkpoints"} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, found := strings.Cut(scanner.Text(), "=")
+			if !found {
+				continue
+			}
+			switch strings.TrimSpace(key) {
+			case "from_lsn":
+				from = strings.TrimSpace(value)
+			case "to_lsn":
+				to = strings.TrimSpace(value)
+			}
+		}
+		return from, to, from != "" && to != ""
+	}
+	return "", "", false
+}
+
+// BackupPaths are where a backup can be on this host: its folder and, when streams are
+// written to files here, its stream file
+func BackupPaths(cfg *config.Config, id string) []string {
+	paths := []string{filepath.Join(cfg.BackupDir, id)}
+	if cfg.Stream && !cfg.Forwarded() {
+		paths = append(paths, StreamFile(cfg, id))
+	}
+	return paths
+}
+
+// shellCmd runs script in the shell
+func shellCmd(script string) []string {
+	return []string{constants.ShellBin, "-c", script}
+}
+
+// stageExecutable is the executable a shell stage starts, its first word
+func stageExecutable(stage string) string {
+	fields := strings.Fields(stage)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.Trim(fields[0], "'")
+}
+
+// isShellScript reports whether cmd runs a script in the shell rather than one executable
+func isShellScript(cmd []string) bool {
+	return len(cmd) > 1 && cmd[0] == constants.ShellBin && cmd[1] == "-c"
+}
+
+// acceptExitCodes makes the success_exit_codes of processType count as success for the
+// one command in a shell script, so they don't apply to the other commands of a pipeline.
+// The runner leaves the exit code of a shell script as it is.
+func acceptExitCodes(cfg *config.Config, processType, command string) string {
+	codes := cfg.SuccessExitCodes[processType]
+	if len(codes) == 0 {
+		return command
+	}
+	patterns := make([]string, len(codes))
+	for i, code := range codes {
+		patterns[i] = strconv.Itoa(code)
+	}
+	return fmt.Sprintf("%s; rc=$?; case $rc in %s) rc=0;; esac; exit $rc", command, strings.Join(patterns, "|"))
+}
+
+// checkStages checks that every stage of a shell command starts an executable from
+// AllowedExecutables, before a script is built from them. The runner only sees the
+// shell, so this is where a stage is held to the allowlist.
+func checkStages(cfg *config.Config, stages ...string) error {
+	allowed := make(map[string]bool)
+	for _, executable := range AllowedExecutables(cfg) {
+		allowed[executable] = true
+	}
+	for _, stage := range stages {
+		if executable := stageExecutable(stage); !allowed[executable] {
+			return fmt.Errorf("executable not allowed: %q", executable)
+		}
+	}
+	return nil
+}
+
+// pipeline joins shell commands into a pipeline that exits with the code of the first
+// stage that failed, so a compressor or forward that exits cleanly can't hide a failed
+// backup tool. sh is often dash, which has no set -o pipefail, so every stage records
+// its own exit code in a temporary directory instead.
+func pipeline(stages ...string) string {
+	var script strings.Builder
+	script.WriteString(`st=$(mktemp -d) || exit 1; `)
+	for i, stage := range stages {
+		if i > 0 {
+			script.WriteString(" | ")
+		}
+		fmt.Fprintf(&script, `{ (%s); echo $? > "$st/%d"; }`, stage, i)
+	}
+	script.WriteString(`; rc=0; for f in "$st"/*; do [ "$rc" -eq 0 ] && rc=$(cat "$f"); done; rm -rf "$st"; exit $rc`)
+	return script.String()
+}
@@ -0,0 +1,791 @@
+package builder
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		DbType:                "mariadb",
+		BackupDir:             "/var/backups/dbcalm",
+		BackupCredentialsFile: "/etc/dbcalm/credentials.cnf",
+		Host:                  "localhost",
+	}
+}
+
+func TestDumpBackupCmdOmitsExcludedDatabases(t *testing.T) {
+	tests := []struct {
+		name     string
+		all      []string
+		exclude  []string
+		expected []string
+	}{
+		{
+			name:     "excluded databases are dropped",
+			all:      []string{"app", "analytics", "mysql", "scratch"},
+			exclude:  []string{"analytics", "scratch"},
+			expected: []string{"app", "mysql"},
+		},
+		{
+			name:     "virtual schemas are always dropped",
+			all:      []string{"app", "information_schema", "performance_schema"},
+			exclude:  []string{"nonexistent"},
+			expected: []string{"app"},
+		},
+		{
+			name:     "names with shell metacharacters stay one argument",
+			all:      []string{"app", "shop; touch $HOME/owned"},
+			expected: []string{"app", "shop; touch $HOME/owned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databases := DatabasesToDump(tt.all, tt.exclude)
+			if strings.Join(databases, ",") != strings.Join(tt.expected, ",") {
+				t.Fatalf("expected databases %v, got %v", tt.expected, databases)
+			}
+
+			cmd, err := NewDumpBuilder(testConfig()).BuildFullBackupCmd("20250101-000000", databases)
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			cmdStr := strings.Join(cmd, " ")
+
+			quoted := "'" + strings.Join(tt.expected, "' '") + "'"
+			if !strings.Contains(cmdStr, "--databases "+quoted+" ") {
+				t.Errorf("expected --databases %s in command, got: %s", quoted, cmdStr)
+			}
+			if strings.Contains(cmdStr, "--all-databases") {
+				t.Errorf("expected no --all-databases when excluding, got: %s", cmdStr)
+			}
+			list := "printf '%s\\n' " + quoted + " > /var/backups/dbcalm/20250101-000000/" + DumpDatabasesFileName
+			if !strings.Contains(cmdStr, list) {
+				t.Errorf("expected the dumped databases listed with %q, got: %s", list, cmdStr)
+			}
+			for _, name := range tt.exclude {
+				if strings.Contains(cmdStr, name) {
+					t.Errorf("excluded database %q appears in command: %s", name, cmdStr)
+				}
+			}
+		})
+	}
+}
+
+func TestDumpBackupCmdWithoutExclusionsDumpsAll(t *testing.T) {
+	cmd, err := NewDumpBuilder(testConfig()).BuildFullBackupCmd("20250101-000000", nil)
+	if err != nil {
+		t.Fatalf("failed to build command: %v", err)
+	}
+	cmdStr := strings.Join(cmd, " ")
+
+	if !strings.Contains(cmdStr, "--all-databases") {
+		t.Errorf("expected --all-databases, got: %s", cmdStr)
+	}
+}
+
+func TestDumpRestoreCmdReplaysSelectedDatabases(t *testing.T) {
+	cfg := testConfig()
+	cfg.BackupDir = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(cfg.BackupDir, "dump"), 0755); err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	dump := "SET NAMES utf8mb4;\n" +
+		"-- Current Database: `mysql`\nUSE `mysql`;\n" +
+		"-- Current Database: `shop`\nUSE `shop`;\n" +
+		"-- Current Database: `shop_archive`\nUSE `shop_archive`;\n"
+	gzipped := exec.Command("sh", "-c", "gzip > "+filepath.Join(cfg.BackupDir, "dump", DumpFileName))
+	gzipped.Stdin = strings.NewReader(dump)
+	if err := gzipped.Run(); err != nil {
+		t.Fatalf("failed to write dump: %v", err)
+	}
+
+	cmd, err := NewDumpBuilder(cfg).BuildRestoreCmd("dump", nil)
+	if err != nil {
+		t.Fatalf("failed to build command: %v", err)
+	}
+	if cmdStr := strings.Join(cmd, " "); strings.Contains(cmdStr, "awk") {
+		t.Errorf("expected the whole dump to be replayed without a selection, got: %s", cmdStr)
+	}
+
+	// Run the pipeline up to the client to see what it would replay
+	cmd, err = NewDumpBuilder(cfg).BuildRestoreCmd("dump", []string{"shop"})
+	if err != nil {
+		t.Fatalf("failed to build command: %v", err)
+	}
+	pipeline := cmd[2][:strings.LastIndex(cmd[2], " | ")]
+	output, err := exec.Command("sh", "-c", pipeline).Output()
+	if err != nil {
+		t.Fatalf("failed to run %s: %v", pipeline, err)
+	}
+	expected := "SET NAMES utf8mb4;\n-- Current Database: `shop`\nUSE `shop`;\n"
+	if string(output) != expected {
+		t.Errorf("expected only the header and shop to be replayed, got:\n%s", output)
+	}
+}
+
+func TestPhysicalBackupCmdExcludesDatabases(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   bool
+		exclude  []string
+		expected string
+	}{
+		{
+			name:     "target dir",
+			exclude:  []string{"analytics", "scratch"},
+			expected: "--databases-exclude=analytics scratch",
+		},
+		{
+			name:     "stream quotes the exclude list",
+			stream:   true,
+			exclude:  []string{"analytics", "scratch"},
+			expected: "'--databases-exclude=analytics scratch'",
+		},
+		{
+			name:     "stream keeps the shell from expanding a name",
+			stream:   true,
+			exclude:  []string{"analytics$1"},
+			expected: "'--databases-exclude=analytics$1'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Stream = tt.stream
+
+			cmd, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildFullBackupCmd("20250101-000000", tt.exclude)
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			cmdStr := strings.Join(cmd, " ")
+
+			if !strings.Contains(cmdStr, tt.expected) {
+				t.Errorf("expected %s in command, got: %s", tt.expected, cmdStr)
+			}
+			if strings.Count(cmdStr, "analytics") != 1 {
+				t.Errorf("expected excluded database only in --databases-exclude, got: %s", cmdStr)
+			}
+		})
+	}
+}
+
+func TestBuildersUseSelectedCredentialsSuffix(t *testing.T) {
+	tests := []struct {
+		name     string
+		suffix   string
+		expected string
+	}{
+		{
+			name:     "defaults to the dbcalm section",
+			expected: "--defaults-group-suffix=-dbcalm",
+		},
+		{
+			name:     "selected section",
+			suffix:   "-replica",
+			expected: "--defaults-group-suffix=-replica",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			commands := map[string]func() ([]string, error){
+				"mariabackup": func() ([]string, error) {
+					return NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).WithCredentialsSuffix(tt.suffix).BuildFullBackupCmd("20250101-000000", nil)
+				},
+				"xtrabackup": func() ([]string, error) {
+					return NewMysqlBuilder(cfg, Version{Major: 8}).WithCredentialsSuffix(tt.suffix).BuildIncrementalBackupCmd("20250102-000000", "20250101-000000", nil)
+				},
+				"dump": func() ([]string, error) {
+					return NewDumpBuilder(cfg).WithCredentialsSuffix(tt.suffix).BuildFullBackupCmd("20250101-000000", nil)
+				},
+				"dump restore": func() ([]string, error) {
+					return NewDumpBuilder(cfg).WithCredentialsSuffix(tt.suffix).BuildRestoreCmd("20250101-000000", nil)
+				},
+			}
+
+			for name, build := range commands {
+				cmd, err := build()
+				if err != nil {
+					t.Fatalf("%s: failed to build command: %v", name, err)
+				}
+				cmdStr := strings.Join(cmd, " ")
+				if !strings.Contains(cmdStr, tt.expected) || strings.Count(cmdStr, "--defaults-group-suffix") != 1 {
+					t.Errorf("%s: expected %s in command, got: %s", name, tt.expected, cmdStr)
+				}
+			}
+		})
+	}
+
+	// The configured builder is left untouched
+	cmdStr := strings.Join(NewDumpBuilder(testConfig()).BuildListDatabasesCmd(), " ")
+	if !strings.Contains(cmdStr, "--defaults-group-suffix=-dbcalm") {
+		t.Errorf("expected the default section, got: %s", cmdStr)
+	}
+}
+
+// writeHook writes an executable shell script that records its name in log before exiting with exitCode
+func writeHook(t *testing.T, dir, name, log string, exitCode int) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho " + name + " >> " + log + "\nexit " + strconv.Itoa(exitCode) + "\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write hook: %v", err)
+	}
+	return path
+}
+
+func TestWrapWithHooks(t *testing.T) {
+	tests := []struct {
+		name         string
+		preExit      int
+		backupExit   int
+		postExit     int
+		expectedExit int
+		expectedLog  []string
+	}{
+		{
+			name:         "failing pre-backup hook aborts the backup",
+			preExit:      1,
+			expectedExit: 1,
+			expectedLog:  []string{"pre"},
+		},
+		{
+			name:         "hooks run around a successful backup",
+			expectedExit: 0,
+			expectedLog:  []string{"pre", "backup", "post"},
+		},
+		{
+			name:         "post-backup hook runs after a failed backup",
+			backupExit:   2,
+			expectedExit: 2,
+			expectedLog:  []string{"pre", "backup", "post"},
+		},
+		{
+			name:         "failing post-backup hook keeps the backup result",
+			postExit:     1,
+			expectedExit: 0,
+			expectedLog:  []string{"pre", "backup", "post"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			log := filepath.Join(dir, "log")
+			cfg := testConfig()
+			cfg.HookDir = dir
+			hooks := Hooks{
+				PreBackup:  writeHook(t, dir, "pre", log, tt.preExit),
+				PostBackup: writeHook(t, dir, "post", log, tt.postExit),
+			}
+			backup := []string{"/bin/sh", "-c", "echo backup >> " + log + "; exit " + strconv.Itoa(tt.backupExit)}
+
+			cmd, err := WrapWithHooks(cfg, backup, "20250101-000000", hooks)
+			if err != nil {
+				t.Fatalf("failed to wrap command: %v", err)
+			}
+			err = exec.Command(cmd[0], cmd[1:]...).Run()
+
+			exitCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("failed to run wrapped command: %v", err)
+			}
+			if exitCode != tt.expectedExit {
+				t.Errorf("expected exit code %d, got %d", tt.expectedExit, exitCode)
+			}
+
+			data, _ := os.ReadFile(log)
+			if got := strings.Fields(string(data)); strings.Join(got, ",") != strings.Join(tt.expectedLog, ",") {
+				t.Errorf("expected run order %v, got %v", tt.expectedLog, got)
+			}
+		})
+	}
+}
+
+func TestWrapWithHooksWithoutHooksKeepsCommand(t *testing.T) {
+	cmd := []string{"mariabackup", "--backup"}
+	if got, err := WrapWithHooks(testConfig(), cmd, "20250101-000000", Hooks{}); err != nil || strings.Join(got, " ") != "mariabackup --backup" {
+		t.Errorf("expected command unchanged, got %v", got)
+	}
+}
+
+func TestPipelineExitsWithFirstFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		stages   []string
+		expected int
+	}{
+		{name: "all stages succeed", stages: []string{"echo data", "gzip", "cat > /dev/null"}, expected: 0},
+		{name: "backup fails, compressor succeeds", stages: []string{"echo partial; exit 2", "gzip", "cat > /dev/null"}, expected: 2},
+		{name: "compressor fails", stages: []string{"echo data", "cat > /dev/null; exit 3"}, expected: 3},
+		{name: "first failure wins", stages: []string{"exit 2", "cat > /dev/null; exit 3"}, expected: 2},
+		{name: "last stage fails", stages: []string{"echo data", "gzip", "cat > /dev/null; exit 4"}, expected: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cmd := exec.Command("sh", "-c", pipeline(tt.stages...))
+			cmd.Env = append(os.Environ(), "TMPDIR="+tmpDir)
+			err := cmd.Run()
+			if got := cmd.ProcessState.ExitCode(); got != tt.expected {
+				t.Errorf("expected exit code %d, got %d (%v)", tt.expected, got, err)
+			}
+			// The exit codes are recorded in a temporary directory, removed again
+			if entries, _ := os.ReadDir(tmpDir); len(entries) > 0 {
+				t.Errorf("expected the exit code directory to be removed, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestSuccessExitCodesApplyToTheToolStage(t *testing.T) {
+	cfg := testConfig()
+	cfg.SuccessExitCodes = map[string][]int{"backup": {1}}
+
+	tests := []struct {
+		name     string
+		stages   []string
+		expected int
+	}{
+		{name: "tool warning succeeds", stages: []string{acceptExitCodes(cfg, "backup", "(echo data; exit 1)"), "gzip", "cat > /dev/null"}, expected: 0},
+		{name: "other tool code fails", stages: []string{acceptExitCodes(cfg, "backup", "(echo data; exit 2)"), "gzip", "cat > /dev/null"}, expected: 2},
+		{name: "compressor's code fails", stages: []string{acceptExitCodes(cfg, "backup", "echo data"), "cat > /dev/null; exit 1"}, expected: 1},
+		{name: "another type's codes don't apply", stages: []string{acceptExitCodes(cfg, "restore", "(echo data; exit 1)"), "cat > /dev/null"}, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", pipeline(tt.stages...))
+			cmd.Env = append(os.Environ(), "TMPDIR="+t.TempDir())
+			err := cmd.Run()
+			if got := cmd.ProcessState.ExitCode(); got != tt.expected {
+				t.Errorf("expected exit code %d, got %d (%v)", tt.expected, got, err)
+			}
+		})
+	}
+
+	// A wrapped backup command maps the codes in its shell, the runner doesn't for scripts
+	cfg.HookDir = "/etc/dbcalm/hooks"
+	cmd, err := WrapWithHooks(cfg, []string{"/usr/bin/mariabackup", "--backup"}, "full-1", Hooks{PostBackup: "/etc/dbcalm/hooks/post.sh"})
+	if err != nil {
+		t.Fatalf("failed to wrap command: %v", err)
+	}
+	if !strings.Contains(cmd[2], "case $rc in 1) rc=0;; esac") {
+		t.Errorf("expected the hooks' shell to apply the success codes, got %s", cmd[2])
+	}
+}
+
+func TestStreamBackupCmdFailsWhenBackupToolFails(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		forward     string
+	}{
+		{name: "uncompressed file"},
+		{name: "gzip compressed file", compression: "gzip"},
+		{name: "forwarded", forward: "cat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A backup tool that streams part of a backup and then fails
+			backupBin := filepath.Join(t.TempDir(), "mariabackup")
+			if err := os.WriteFile(backupBin, []byte("#!/bin/sh\necho partial\nexit 1\n"), 0755); err != nil {
+				t.Fatalf("failed to write backup tool: %v", err)
+			}
+
+			cfg := testConfig()
+			cfg.BackupDir = t.TempDir()
+			cfg.BackupBin = backupBin
+			cfg.Stream = true
+			cfg.Compression = tt.compression
+			cfg.Forward = tt.forward
+
+			cmd, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildFullBackupCmd("20250101-000000", nil)
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			run := exec.Command(cmd[0], cmd[1:]...)
+			run.Env = append(os.Environ(), "TMPDIR="+t.TempDir())
+			output, err := run.Output()
+			if code := run.ProcessState.ExitCode(); code != 1 {
+				t.Fatalf("expected the backup tool's exit code 1, got %d (%v)", code, err)
+			}
+			if tt.forward != "" && !strings.Contains(string(output), "partial") {
+				t.Errorf("expected the stream to be forwarded, got %q", output)
+			}
+		})
+	}
+}
+
+func TestRestoreCmdsExtractStreamedBackups(t *testing.T) {
+	cfg := testConfig()
+	cfg.BackupDir = t.TempDir()
+	for _, name := range []string{"backup-full.xbstream.gz", "backup-incr-2.xbstream"} {
+		if err := os.WriteFile(filepath.Join(cfg.BackupDir, name), []byte("stream"), 0600); err != nil {
+			t.Fatalf("failed to write stream file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(cfg.BackupDir, "incr-1"), 0700); err != nil {
+		t.Fatalf("failed to create backup folder: %v", err)
+	}
+
+	tmpDir := "/tmp/dbcalm-restore-x"
+	commands, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildRestoreCmds(tmpDir, []string{"full", "incr-1", "incr-2"}, string(RestoreTargetDatabase))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+	lines := make([]string, len(commands))
+	for i, cmd := range commands {
+		lines[i] = strings.Join(cmd, " ")
+	}
+
+	expected := []string{
+		"gunzip -c " + filepath.Join(cfg.BackupDir, "backup-full.xbstream.gz"),
+		"/usr/bin/mbstream -x -C " + tmpDir + "/incr-2 < " + filepath.Join(cfg.BackupDir, "backup-incr-2.xbstream"),
+		"--prepare --target-dir=" + tmpDir + "/full",
+		"--incremental-dir=" + filepath.Join(cfg.BackupDir, "incr-1"),
+		"--incremental-dir=" + tmpDir + "/incr-2",
+		"--copy-back",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d commands, got %d: %q", len(expected), len(lines), lines)
+	}
+	for i, want := range expected {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("expected command %d to contain %q, got %q", i, want, lines[i])
+		}
+	}
+	if !strings.Contains(lines[0], "/usr/bin/mbstream -x -C "+tmpDir+"/full") {
+		t.Errorf("expected the full backup to be extracted into the restore dir, got %q", lines[0])
+	}
+
+	cfg.DbType = "mysql"
+	commands, err = NewMysqlBuilder(cfg, Version{Major: 8}).BuildRestoreCmds(tmpDir, []string{"full"}, string(RestoreTargetFolder))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+	if line := strings.Join(commands[0], " "); !strings.Contains(line, "/usr/bin/xbstream -x -C ") {
+		t.Errorf("expected MySQL streams to be extracted with xbstream, got %q", line)
+	}
+}
+
+func TestRestoreCmdsArchiveFolderRestore(t *testing.T) {
+	cfg := testConfig()
+	cfg.BackupDir = t.TempDir()
+	for _, id := range []string{"full", "incr-1"} {
+		if err := os.Mkdir(filepath.Join(cfg.BackupDir, id), 0700); err != nil {
+			t.Fatalf("failed to create backup folder: %v", err)
+		}
+	}
+
+	tmpDir := "/restores/2025-01-01"
+	folder, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildRestoreCmds(tmpDir, []string{"full", "incr-1"}, string(RestoreTargetFolder))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+	archived, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildRestoreCmds(tmpDir, []string{"full", "incr-1"}, string(RestoreTargetArchive))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+
+	if len(archived) != len(folder)+1 {
+		t.Fatalf("expected the folder restore's steps and an archive step, got %d and %d commands", len(folder), len(archived))
+	}
+	for i := range folder {
+		if strings.Join(folder[i], " ") != strings.Join(archived[i], " ") {
+			t.Errorf("expected step %d to be the same as for a folder restore, got %q", i, archived[i])
+		}
+	}
+
+	last := strings.Join(archived[len(archived)-1], " ")
+	for _, want := range []string{
+		"tar -C " + tmpDir + " -cf - full",
+		"zstd - -c -T0 > " + tmpDir + "/full.tar.zst",
+		"&& rm -rf " + tmpDir + "/full",
+	} {
+		if !strings.Contains(last, want) {
+			t.Errorf("expected the archive step to contain %q, got %q", want, last)
+		}
+	}
+}
+
+func TestRestoreCmdsKeepGrantsOutOfCopyBack(t *testing.T) {
+	cfg := testConfig()
+	cfg.BackupDir = t.TempDir()
+	for _, id := range []string{"full", "incr-1"} {
+		if err := os.Mkdir(filepath.Join(cfg.BackupDir, id), 0700); err != nil {
+			t.Fatalf("failed to create backup folder: %v", err)
+		}
+	}
+	bldr := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11})
+
+	without, err := bldr.BuildRestoreCmds("/tmp/dbcalm-restore-x", []string{"full", "incr-1"}, string(RestoreTargetDatabase))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+
+	// Grants captured with the incremental end up in the prepared folder too
+	if err := os.WriteFile(filepath.Join(cfg.BackupDir, "incr-1", GrantsFileName), []byte("GRANT USAGE ON *.* TO `app`@`%`;\n"), 0600); err != nil {
+		t.Fatalf("failed to write grants: %v", err)
+	}
+	with, err := bldr.BuildRestoreCmds("/tmp/dbcalm-restore-x", []string{"full", "incr-1"}, string(RestoreTargetDatabase))
+	if err != nil {
+		t.Fatalf("failed to build commands: %v", err)
+	}
+
+	if len(with) != len(without)+1 {
+		t.Fatalf("expected one step more with grants, got %d and %d commands", len(without), len(with))
+	}
+	remove := strings.Join(with[len(with)-2], " ")
+	if remove != "rm -f /tmp/dbcalm-restore-x/full/"+GrantsFileName {
+		t.Errorf("expected grants.sql removed from the prepared folder, got %q", remove)
+	}
+	if with[len(with)-1][1] != "--copy-back" {
+		t.Errorf("expected copy-back to stay the last step, got %q", with[len(with)-1])
+	}
+}
+
+func TestGrantsCapturedAfterTheBackup(t *testing.T) {
+	cfg := testConfig()
+	cfg.BackupDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(cfg.BackupDir, "full-1"), 0700); err != nil {
+		t.Fatalf("failed to create backup folder: %v", err)
+	}
+	grantsFile := filepath.Join(cfg.BackupDir, "full-1", GrantsFileName)
+
+	tests := []struct {
+		name     string
+		backup   []string
+		exitCode int
+	}{
+		{name: "failed backup", backup: []string{"/bin/sh", "-c", "exit 3"}, exitCode: 3},
+		// The client isn't there to list the grants, the backup is kept without them
+		{name: "failed capture", backup: []string{"/bin/sh", "-c", "exit 0"}, exitCode: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := NewDumpBuilder(cfg).WithGrantsCapture(tt.backup, "full-1")
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			if !strings.Contains(cmd[2], "> "+grantsFile) {
+				t.Fatalf("expected the grants written to %s, got %q", grantsFile, cmd[2])
+			}
+
+			err = exec.Command(cmd[0], cmd[1:]...).Run()
+			exitCode := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("failed to run command: %v", err)
+			}
+			if exitCode != tt.exitCode {
+				t.Errorf("expected the backup's exit code %d, got %d", tt.exitCode, exitCode)
+			}
+			if _, err := os.Stat(grantsFile); !os.IsNotExist(err) {
+				t.Errorf("expected no grants.sql, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGrantsQueryLeavesOutRoles(t *testing.T) {
+	tests := []struct {
+		dbType  string
+		notRole string
+		hexFlag bool
+	}{
+		{dbType: "mariadb", notRole: "WHERE u.is_role = 'N' AND"},
+		{dbType: "mysql", notRole: "WHERE NOT EXISTS (SELECT 1 FROM mysql.role_edges AS e WHERE e.from_user = u.user AND e.from_host = u.host) AND", hexFlag: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dbType, func(t *testing.T) {
+			query := grantsQuery(tt.dbType)
+			expected := "SELECT CONCAT('SHOW CREATE USER ', QUOTE(u.user), '@', QUOTE(u.host), '; SHOW GRANTS FOR ', QUOTE(u.user), '@', QUOTE(u.host), ';') " +
+				"FROM mysql.user AS u " + tt.notRole + " u.user NOT IN ('mariadb.sys', 'mysql.sys', 'mysql.session', 'mysql.infoschema')"
+			if query != expected {
+				t.Errorf("expected query:\n%s\ngot:\n%s", expected, query)
+			}
+
+			cfg := testConfig()
+			cfg.DbType = tt.dbType
+			cmd, err := NewDumpBuilder(cfg).WithGrantsCapture([]string{"/bin/sh", "-c", "exit 0"}, "full-1")
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			if !strings.Contains(cmd[2], query) {
+				t.Errorf("expected the query in the command, got %q", cmd[2])
+			}
+			hex := `--init-command="SET SESSION print_identified_with_as_hex = ON"`
+			if strings.Contains(cmd[2], hex) != tt.hexFlag {
+				t.Errorf("expected %s in the command only for MySQL, got %q", hex, cmd[2])
+			}
+		})
+	}
+}
+
+func TestSafetyCopyTakenBeforeCopyBack(t *testing.T) {
+	files := map[string]string{"ibdata1": "system tablespace", "undo/undo001": "undo log"}
+
+	tests := []struct {
+		name         string
+		copyDir      func(root, dataDir string) string
+		expectCopied bool
+	}{
+		{name: "copied before copy-back", copyDir: func(root, _ string) string { return filepath.Join(root, "pre-restore", "2025-01-01") }, expectCopied: true},
+		{name: "folder with spaces", copyDir: func(root, _ string) string { return filepath.Join(root, "pre restore", "2025-01-01 $(id)") }, expectCopied: true},
+		// A copy that can't be taken stops the restore before anything is overwritten
+		{name: "failed copy skips copy-back", copyDir: func(_, dataDir string) string { return filepath.Join(dataDir, "ibdata1", "copy") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dataDir := filepath.Join(root, "mysql")
+			if err := os.MkdirAll(filepath.Join(dataDir, "undo"), 0700); err != nil {
+				t.Fatalf("failed to create data dir: %v", err)
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0600); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+			copyDir := tt.copyDir(root, dataDir)
+
+			// Stands in for copy-back, overwriting what the data dir holds
+			copyBack := []string{"/bin/sh", "-c", "echo restored > " + filepath.Join(dataDir, "ibdata1")}
+			cmd, err := SafetyCopyCmd(testConfig(), dataDir, copyDir, copyBack)
+			if err != nil {
+				t.Fatalf("failed to build command: %v", err)
+			}
+			output, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
+			if (err == nil) != tt.expectCopied {
+				t.Fatalf("expected success %v, got %v (%s)", tt.expectCopied, err, output)
+			}
+
+			restored, _ := os.ReadFile(filepath.Join(dataDir, "ibdata1"))
+			if !tt.expectCopied {
+				if string(restored) != "system tablespace" {
+					t.Errorf("expected the data dir untouched, got ibdata1 %q", restored)
+				}
+				return
+			}
+			if string(restored) != "restored\n" {
+				t.Errorf("expected copy-back to run, got ibdata1 %q", restored)
+			}
+			for name, content := range files {
+				copied, err := os.ReadFile(filepath.Join(copyDir, name))
+				if err != nil || string(copied) != content {
+					t.Errorf("expected %s as it was before copy-back, got %q (%v)", name, copied, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapWithCgroup(t *testing.T) {
+	cmd := []string{"/usr/bin/mariabackup", "--backup", "--target-dir=/var/backups/dbcalm/full-1"}
+
+	cfg := testConfig()
+	if wrapped, err := WrapWithCgroup(cfg, cmd); err != nil || strings.Join(wrapped, " ") != strings.Join(cmd, " ") {
+		t.Errorf("expected the command unchanged without limits, got %q (%v)", wrapped, err)
+	}
+
+	cfg.BackupCgroup = config.BackupCgroup{MemoryMax: "4G", CPUQuota: "50%", IOWeight: 20, Slice: "dbcalm.slice"}
+	wrapped, err := WrapWithCgroup(cfg, cmd)
+	if err != nil {
+		t.Fatalf("failed to wrap command: %v", err)
+	}
+	if len(wrapped) != 3 || wrapped[0] != "/bin/sh" || wrapped[1] != "-c" {
+		t.Fatalf("expected a shell running systemd-run, got %q", wrapped)
+	}
+	expected := "'/usr/bin/systemd-run' '--scope' '--quiet' '--collect' '--slice=dbcalm.slice' " +
+		"'-p' 'MemoryMax=4G' '-p' 'CPUQuota=50%' '-p' 'IOWeight=20' " +
+		"'--' '/usr/bin/mariabackup' '--backup' '--target-dir=/var/backups/dbcalm/full-1'"
+	if wrapped[2] != expected {
+		t.Errorf("expected %s, got %s", expected, wrapped[2])
+	}
+
+	// Limits left out are not passed
+	cfg.BackupCgroup = config.BackupCgroup{CPUQuota: "200%"}
+	if wrapped, err = WrapWithCgroup(cfg, cmd); err != nil {
+		t.Fatalf("failed to wrap command: %v", err)
+	}
+	if strings.Contains(wrapped[2], "MemoryMax") || strings.Contains(wrapped[2], "IOWeight") || strings.Contains(wrapped[2], "--slice") {
+		t.Errorf("expected only the CPU quota, got %s", wrapped[2])
+	}
+}
+
+func TestShellCommandsOnlyRunAllowedExecutables(t *testing.T) {
+	cfg := testConfig()
+	cfg.HookDir = "/etc/dbcalm/hooks"
+	cfg.BackupCgroup = config.BackupCgroup{MemoryMax: "4G"}
+
+	for _, executable := range AllowedExecutables(cfg) {
+		if executable == "sh" {
+			t.Error("expected the shell to be allowed only by its path")
+		}
+	}
+
+	if _, err := WrapWithCgroup(cfg, []string{"/tmp/payload", "--backup"}); err == nil {
+		t.Error("expected an unknown executable to be refused in the cgroup scope")
+	}
+	if _, err := WrapWithHooks(cfg, []string{"/usr/bin/mariabackup"}, "full-1", Hooks{PreBackup: "/tmp/hook.sh"}); err == nil {
+		t.Error("expected a hook outside the hook directory to be refused")
+	}
+	if _, err := SafetyCopyCmd(cfg, "/var/lib/mysql", "/var/backups/pre-restore", []string{"rm", "-rf", "/var/lib/mysql"}); err == nil {
+		t.Error("expected an unknown copy-back executable to be refused")
+	}
+
+	// The operator's forward pipeline runs what it was configured with
+	cfg.Stream = true
+	cfg.Forward = "/usr/local/bin/upload --bucket backups"
+	cmd, err := NewMariadbBuilder(cfg, Version{Major: 10, Minor: 11}).BuildFullBackupCmd("full-1", nil)
+	if err != nil {
+		t.Fatalf("expected the configured forward to be allowed: %v", err)
+	}
+	if cmd[0] != "/bin/sh" || !strings.Contains(cmd[2], "/usr/local/bin/upload --bucket backups") {
+		t.Errorf("expected the stream to be forwarded, got %q", cmd)
+	}
+}
+
+func TestVersionDetectionUsesConfiguredAdminBin(t *testing.T) {
+	// A stand-in admin tool echoing the arguments it was started with
+	admin := filepath.Join(t.TempDir(), "mariadb-admin")
+	script := "#!/bin/sh\necho \"mariadb-admin  Ver 10.11.6-MariaDB $*\"\n"
+	if err := os.WriteFile(admin, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write admin tool: %v", err)
+	}
+	cfg := testConfig()
+	cfg.AdminBin = admin
+	cfg = cfg.WithCredentialsSuffix("-replica")
+
+	version, err := DetectMariaDBVersion(cfg)
+	if err != nil {
+		t.Fatalf("expected the configured admin tool to be run: %v", err)
+	}
+	if version != (Version{Major: 10, Minor: 11, Patch: 6}) {
+		t.Errorf("expected version 10.11.6, got %+v", version)
+	}
+
+	allowed := strings.Join(AllowedExecutables(cfg), " ")
+	if !strings.Contains(allowed, admin) || strings.Contains(allowed, "/usr/bin/mariadb-admin") {
+		t.Errorf("expected only the configured admin tool to be allowed, got %s", allowed)
+	}
+}
@@ -0,0 +1,49 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
+)
+
+// WrapWithCgroup runs cmd in a transient systemd scope limited to the configured memory,
+// CPU and IO weight, and returns cmd unchanged without limits. systemd-run is started from
+// a shell rather than directly: it execs cmd once the scope exists, and the shell keeps the
+// executable of the tracked process the one the command line starts with. The shell
+// applies the backup's success_exit_codes to cmd, as the runner doesn't for shell scripts.
+func WrapWithCgroup(cfg *config.Config, cmd []string) ([]string, error) {
+	cgroup := cfg.BackupCgroup
+	if !cgroup.Enabled() {
+		return cmd, nil
+	}
+	if err := checkStages(cfg, constants.SystemdRunBin, cmd[0]); err != nil {
+		return nil, err
+	}
+
+	args := []string{constants.SystemdRunBin, "--scope", "--quiet", "--collect"}
+	if cgroup.Slice != "" {
+		args = append(args, "--slice="+cgroup.Slice)
+	}
+	if cgroup.MemoryMax != "" {
+		args = append(args, "-p", "MemoryMax="+cgroup.MemoryMax)
+	}
+	if cgroup.CPUQuota != "" {
+		args = append(args, "-p", "CPUQuota="+cgroup.CPUQuota)
+	}
+	if cgroup.IOWeight != 0 {
+		args = append(args, "-p", fmt.Sprintf("IOWeight=%d", cgroup.IOWeight))
+	}
+	args = append(append(args, "--"), cmd...)
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	if isShellScript(cmd) {
+		return shellCmd(strings.Join(quoted, " ")), nil
+	}
+	return shellCmd(acceptExitCodes(cfg, process.TypeBackup, strings.Join(quoted, " "))), nil
+}
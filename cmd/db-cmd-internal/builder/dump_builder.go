@@ -0,0 +1,196 @@
+package builder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
+)
+
+// DumpBuilder builds the commands for the logical backup strategy: a compressed
+// SQL dump taken with mariadb-dump/mysqldump and replayed with the matching client
+type DumpBuilder struct {
+	config *config.Config
+}
+
+func NewDumpBuilder(cfg *config.Config) *DumpBuilder {
+	return &DumpBuilder{config: cfg}
+}
+
+// WithCredentialsSuffix returns a dump builder using another section of the credentials file
+func (b *DumpBuilder) WithCredentialsSuffix(suffix string) *DumpBuilder {
+	return NewDumpBuilder(b.config.WithCredentialsSuffix(suffix))
+}
+
+func (b *DumpBuilder) DumpExecutable() string {
+	if b.config.DbType == "mysql" {
+		return constants.MySQLDumpBin
+	}
+	return constants.MariaDBDumpBin
+}
+
+func (b *DumpBuilder) ClientExecutable() string {
+	if b.config.DbType == "mysql" {
+		return constants.MySQLClientBin
+	}
+	return constants.MariaDBClientBin
+}
+
+// BuildFullBackupCmd dumps databases into <backup_dir>/<id>/dump.sql.gz, listing them in
+// dump.databases. An empty databases list dumps all databases, which leaves no list.
+// dd counts the bytes dumped on their way to gzip into dump.size, so the uncompressed
+// size is known without reading it back.
+func (b *DumpBuilder) BuildFullBackupCmd(id string, databases []string) ([]string, error) {
+	targetDir := filepath.Join(b.config.BackupDir, id)
+	dumpFile := filepath.Join(targetDir, DumpFileName)
+
+	selection := "--all-databases"
+	list := ""
+	if len(databases) > 0 {
+		quoted := make([]string, len(databases))
+		for i, name := range databases {
+			quoted[i] = shellQuote(name)
+		}
+		selection = "--databases " + strings.Join(quoted, " ")
+		list = fmt.Sprintf("printf '%%s\\n' %s > %s || exit $?; ", strings.Join(quoted, " "), filepath.Join(targetDir, DumpDatabasesFileName))
+	}
+
+	dump := fmt.Sprintf("%s --defaults-file=%s --defaults-group-suffix=%s --host=%s "+
+		"%s --single-transaction --routines --events --triggers",
+		b.DumpExecutable(), b.config.BackupCredentialsFile, b.config.DefaultsGroupSuffix(), b.config.Host, selection)
+	count := "dd bs=1M 2> " + filepath.Join(targetDir, DumpSizeFileName)
+	compress := "gzip > " + dumpFile
+	if err := checkStages(b.config, dump, count, compress); err != nil {
+		return nil, err
+	}
+	dump = acceptExitCodes(b.config, process.TypeBackup, dump)
+	cmdStr := fmt.Sprintf("mkdir -p %s || exit $?; %s%s", targetDir, list, pipeline(dump, count, compress))
+
+	return shellCmd(cmdStr), nil
+}
+
+// BuildListDatabasesCmd lists the server's databases, one per line
+func (b *DumpBuilder) BuildListDatabasesCmd() []string {
+	return []string{
+		b.ClientExecutable(),
+		fmt.Sprintf("--defaults-file=%s", b.config.BackupCredentialsFile),
+		fmt.Sprintf("--defaults-group-suffix=%s", b.config.DefaultsGroupSuffix()),
+		fmt.Sprintf("--host=%s", b.config.Host),
+		"--batch",
+		"--skip-column-names",
+		"--execute=SHOW DATABASES",
+	}
+}
+
+// DatabasesToDump removes the excluded databases and the virtual schemas
+// --all-databases would skip from the server's database list
+func DatabasesToDump(all, exclude []string) []string {
+	skip := map[string]bool{
+		"information_schema": true,
+		"performance_schema": true,
+	}
+	for _, name := range exclude {
+		skip[name] = true
+	}
+
+	var databases []string
+	for _, name := range all {
+		if !skip[name] {
+			databases = append(databases, name)
+		}
+	}
+	return databases
+}
+
+// dumpDatabaseMarker starts every database's section in dumps taken with
+// --all-databases or --databases, followed by the name and a closing backtick
+const dumpDatabaseMarker = "-- Current Database: `"
+
+// dumpSectionFilter is an awk program passing the dump's header and the sections of the
+// databases in keep, taking the name after dumpDatabaseMarker
+const dumpSectionFilter = `index($0, "` + dumpDatabaseMarker + `") == 1 {
+	name = substr($0, 23); sub(/` + "`" + `$/, "", name)
+	on = index(keep, " " name " ") > 0; started = 1
+}
+!started || on`
+
+// BuildRestoreCmd replays a backup's SQL dump into the running server. With databases
+// given only their sections of the dump are replayed. The names are validated database
+// identifiers, safe inside single quotes.
+func (b *DumpBuilder) BuildRestoreCmd(id string, databases []string) ([]string, error) {
+	dumpFile := filepath.Join(b.config.BackupDir, id, DumpFileName)
+	stages := []string{"gunzip -c " + dumpFile}
+	if len(databases) > 0 {
+		stages = append(stages, fmt.Sprintf("awk -v keep=' %s ' '%s'", strings.Join(databases, " "), dumpSectionFilter))
+	}
+	stages = append(stages, fmt.Sprintf("%s --defaults-file=%s --defaults-group-suffix=%s --host=%s",
+		b.ClientExecutable(), b.config.BackupCredentialsFile, b.config.DefaultsGroupSuffix(), b.config.Host))
+	if err := checkStages(b.config, stages...); err != nil {
+		return nil, err
+	}
+	stages[len(stages)-1] = acceptExitCodes(b.config, process.TypeRestore, stages[len(stages)-1])
+	return shellCmd(pipeline(stages...)), nil
+}
+
+// grantsQuery lists a SHOW CREATE USER and a SHOW GRANTS statement for every account of
+// a dbType server, leaving out roles and the accounts the server creates for itself.
+// MariaDB marks its roles in mysql.user. MySQL keeps a role as a locked account there,
+// one granted to an account is told apart by mysql.role_edges.
+func grantsQuery(dbType string) string {
+	notRole := "u.is_role = 'N'"
+	if dbType == "mysql" {
+		notRole = "NOT EXISTS (SELECT 1 FROM mysql.role_edges AS e WHERE e.from_user = u.user AND e.from_host = u.host)"
+	}
+	return "SELECT CONCAT('SHOW CREATE USER ', QUOTE(u.user), '@', QUOTE(u.host), '; SHOW GRANTS FOR ', QUOTE(u.user), '@', QUOTE(u.host), ';') " +
+		"FROM mysql.user AS u WHERE " + notRole + " AND u.user NOT IN ('mariadb.sys', 'mysql.sys', 'mysql.session', 'mysql.infoschema')"
+}
+
+// WithGrantsCapture follows the backup command cmd with writing the server's users and
+// grants to <backup_dir>/<id>/grants.sql, in the same process so the backup's timeout
+// covers both. The statements listed by grantsQuery are run by a second client, whose
+// output rows are the CREATE USER and GRANT statements, made safe to apply to a server
+// that has the user. The grants are only captured once the backup succeeded, and a
+// failed capture leaves the backup without grants.sql and its exit code as it was.
+func (b *DumpBuilder) WithGrantsCapture(cmd []string, id string) ([]string, error) {
+	grantsFile := filepath.Join(b.config.BackupDir, id, GrantsFileName)
+	client := fmt.Sprintf("%s --defaults-file=%s --defaults-group-suffix=%s --host=%s --batch --raw --skip-column-names",
+		b.ClientExecutable(), b.config.BackupCredentialsFile, b.config.DefaultsGroupSuffix(), b.config.Host)
+	// MySQL prints caching_sha2_password hashes as binary, which sed could mangle
+	show := client
+	if b.config.DbType == "mysql" {
+		show += ` --init-command="SET SESSION print_identified_with_as_hex = ON"`
+	}
+	stages := []string{
+		fmt.Sprintf("%s --execute=\"%s\"", client, grantsQuery(b.config.DbType)),
+		show,
+		`sed -e 's/^CREATE USER /CREATE USER IF NOT EXISTS /' -e 's/$/;/' > ` + grantsFile,
+	}
+	if err := checkStages(b.config, append(stages, cmd[0])...); err != nil {
+		return nil, err
+	}
+
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		quoted[i] = shellQuote(arg)
+	}
+	run := strings.Join(quoted, " ")
+	if !isShellScript(cmd) {
+		run = "(" + acceptExitCodes(b.config, process.TypeBackup, run) + ")"
+	}
+	return shellCmd(fmt.Sprintf("%s; rc=$?; [ $rc -eq 0 ] || exit $rc; (%s) || { rm -f %s; echo %s >&2; }; exit $rc",
+		run, pipeline(stages...), grantsFile, shellQuote("capturing grants failed, the backup is kept without them"))), nil
+}
+
+// BuildApplyGrantsCmd replays a backup's grants.sql into the running server
+func (b *DumpBuilder) BuildApplyGrantsCmd(id string) ([]string, error) {
+	grantsFile := filepath.Join(b.config.BackupDir, id, GrantsFileName)
+	apply := fmt.Sprintf("%s --defaults-file=%s --defaults-group-suffix=%s --host=%s < %s",
+		b.ClientExecutable(), b.config.BackupCredentialsFile, b.config.DefaultsGroupSuffix(), b.config.Host, grantsFile)
+	if err := checkStages(b.config, apply); err != nil {
+		return nil, err
+	}
+	return shellCmd(apply), nil
+}
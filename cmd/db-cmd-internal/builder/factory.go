@@ -4,19 +4,52 @@ import (
 	"fmt"
 
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
 )
 
+// AllowedExecutables lists every executable the builders and adapter start commands
+// with, for the process runner's allowlist. Shell commands run through constants.ShellBin,
+// the builders check every stage of them against the same list first.
+func AllowedExecutables(cfg *config.Config) []string {
+	dumpBuilder := NewDumpBuilder(cfg)
+	executables := []string{
+		constants.ShellBin,
+		"cp",
+		"gzip",
+		"gunzip",
+		"zstd",
+		"tar",
+		"awk",
+		"sed",
+		"dd",
+		NewMariadbBuilder(cfg, Version{}).executable(),
+		NewMysqlBuilder(cfg, Version{}).executable(),
+		dumpBuilder.DumpExecutable(),
+		dumpBuilder.ClientExecutable(),
+		cfg.AdminExecutable(),
+		constants.MbstreamBin,
+		constants.XbstreamBin,
+		constants.SystemdRunBin,
+		constants.SSHBin,
+	}
+	// The operator's forward pipeline runs what it was configured with
+	for _, stage := range cfg.ForwardStages("") {
+		executables = append(executables, stageExecutable(stage))
+	}
+	return executables
+}
+
 func NewBuilder(cfg *config.Config) (Builder, error) {
 	switch cfg.DbType {
 	case "mariadb":
-		version, err := DetectMariaDBVersion(cfg.BackupCredentialsFile)
+		version, err := DetectMariaDBVersion(cfg)
 		if err != nil {
 			// Default to version that doesn't use --apply-log-only
 			version = Version{Major: 10, Minor: 5, Patch: 0}
 		}
 		return NewMariadbBuilder(cfg, version), nil
 	case "mysql":
-		version, err := DetectMySQLVersion(cfg.BackupCredentialsFile)
+		version, err := DetectMySQLVersion(cfg)
 		if err != nil {
 			// Default version
 			version = Version{Major: 8, Minor: 0, Patch: 0}
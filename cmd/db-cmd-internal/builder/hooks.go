@@ -0,0 +1,72 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
+)
+
+// Hooks are the operator scripts run around a backup. Empty paths are skipped.
+type Hooks struct {
+	PreBackup  string
+	PostBackup string
+}
+
+func (h Hooks) Empty() bool {
+	return h.PreBackup == "" && h.PostBackup == ""
+}
+
+// WrapWithHooks runs the backup command between the hooks in a single shell, so the
+// hook output ends up in the same process record as the backup. A failing pre-backup
+// hook aborts before the backup starts. The post-backup hook runs whether the backup
+// succeeded or not and sees its exit code in DBCALM_BACKUP_EXIT_CODE; the backup's
+// exit code is kept either way, with the backup's success_exit_codes counting as 0. The hooks have to be inside cfg's hook directory.
+func WrapWithHooks(cfg *config.Config, cmd []string, id string, hooks Hooks) ([]string, error) {
+	if hooks.Empty() {
+		return cmd, nil
+	}
+	for _, hook := range []string{hooks.PreBackup, hooks.PostBackup} {
+		if hook == "" {
+			continue
+		}
+		if err := cfg.ValidateHookPath(hook); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkStages(cfg, cmd[0]); err != nil {
+		return nil, err
+	}
+
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		quoted[i] = shellQuote(arg)
+	}
+
+	var script strings.Builder
+	fmt.Fprintf(&script, "export DBCALM_BACKUP_ID=%s; ", shellQuote(id))
+	if hooks.PreBackup != "" {
+		fmt.Fprintf(&script, "echo %s; %s || { rc=$?; echo %s >&2; exit $rc; }; ",
+			shellQuote("pre-backup hook: "+hooks.PreBackup), shellQuote(hooks.PreBackup),
+			shellQuote("pre-backup hook failed, backup aborted"))
+	}
+	run := strings.Join(quoted, " ")
+	if !isShellScript(cmd) {
+		run = "(" + acceptExitCodes(cfg, process.TypeBackup, run) + ")"
+	}
+	fmt.Fprintf(&script, "%s; rc=$?; ", run)
+	if hooks.PostBackup != "" {
+		fmt.Fprintf(&script, "echo %s; DBCALM_BACKUP_EXIT_CODE=$rc %s || echo %s >&2; ",
+			shellQuote("post-backup hook: "+hooks.PostBackup), shellQuote(hooks.PostBackup),
+			shellQuote("post-backup hook failed"))
+	}
+	script.WriteString("exit $rc")
+
+	return shellCmd(script.String()), nil
+}
+
+// shellQuote single-quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
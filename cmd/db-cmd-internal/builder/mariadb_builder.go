@@ -2,6 +2,7 @@ package builder
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
 )
 
 type Version struct {
@@ -47,19 +49,23 @@ func (b *MariadbBuilder) executable() string {
 	return "/usr/bin/mariabackup"
 }
 
-func (b *MariadbBuilder) BuildFullBackupCmd(id string) []string {
-	return b.buildBackupCmd(id, "")
+func (b *MariadbBuilder) WithCredentialsSuffix(suffix string) Builder {
+	return NewMariadbBuilder(b.config.WithCredentialsSuffix(suffix), b.version)
 }
 
-func (b *MariadbBuilder) BuildIncrementalBackupCmd(id, fromBackupID string) []string {
-	return b.buildBackupCmd(id, fromBackupID)
+func (b *MariadbBuilder) BuildFullBackupCmd(id string, excludeDatabases []string) ([]string, error) {
+	return b.buildBackupCmd(id, "", excludeDatabases)
 }
 
-func (b *MariadbBuilder) buildBackupCmd(id, fromBackupID string) []string {
+func (b *MariadbBuilder) BuildIncrementalBackupCmd(id, fromBackupID string, excludeDatabases []string) ([]string, error) {
+	return b.buildBackupCmd(id, fromBackupID, excludeDatabases)
+}
+
+func (b *MariadbBuilder) buildBackupCmd(id, fromBackupID string, excludeDatabases []string) ([]string, error) {
 	cmd := []string{
 		b.executable(),
 		fmt.Sprintf("--defaults-file=%s", b.config.BackupCredentialsFile),
-		"--defaults-group-suffix=-dbcalm",
+		fmt.Sprintf("--defaults-group-suffix=%s", b.config.DefaultsGroupSuffix()),
 		"--backup",
 	}
 
@@ -79,48 +85,87 @@ func (b *MariadbBuilder) buildBackupCmd(id, fromBackupID string) []string {
 		cmd = append(cmd, fmt.Sprintf("--incremental-basedir=%s", basedir))
 	}
 
+	// Excluded databases are skipped entirely by mariabackup/xtrabackup
+	if len(excludeDatabases) > 0 {
+		cmd = append(cmd, fmt.Sprintf("--databases-exclude=%s", strings.Join(excludeDatabases, " ")))
+	}
+
 	// Handle stream output
 	if b.config.Stream {
-		outputFile := filepath.Join(b.config.BackupDir, fmt.Sprintf("backup-%s.xbstream", id))
-		
-		if b.config.Compression == "gzip" {
-			outputFile += ".gz"
-		} else if b.config.Compression == "zstd" {
-			outputFile += ".zst"
+		outputFile := StreamFile(b.config, id)
+
+		// Build shell command string for stream pipeline, every argument quoted
+		quoted := make([]string, len(cmd))
+		for i, arg := range cmd {
+			quoted[i] = shellQuote(arg)
 		}
+		stages := []string{strings.Join(quoted, " ")}
 
-		// Build shell command string for stream pipeline
-		cmdStr := strings.Join(cmd, " ")
-		
 		if b.config.Compression == "gzip" {
-			cmdStr += " | gzip"
+			stages = append(stages, "gzip")
 		} else if b.config.Compression == "zstd" {
-			cmdStr += " | zstd - -c -T0"
+			stages = append(stages, "zstd - -c -T0")
+		}
+
+		forward := b.config.ForwardStages(filepath.Base(outputFile))
+		if err := checkStages(b.config, append(stages, forward...)...); err != nil {
+			return nil, err
 		}
 
-		if b.config.Forward != "" {
-			cmdStr += " | " + b.config.Forward
+		var cmdStr string
+		if len(forward) > 0 {
+			stages[0] = acceptExitCodes(b.config, process.TypeBackup, stages[0])
+			cmdStr = pipeline(append(stages, forward...)...)
 		} else {
-			cmdStr += " > " + outputFile
+			stages[len(stages)-1] += " > " + outputFile
+			stages[0] = acceptExitCodes(b.config, process.TypeBackup, stages[0])
+			cmdStr = pipeline(stages...)
+			// The shell creates the stream file, keep it from being readable under a loose umask
+			if umask := b.config.StreamUmask(); umask != "" {
+				cmdStr = "umask " + umask + "; " + cmdStr
+			}
 		}
 
-		return []string{"sh", "-c", cmdStr}
+		return shellCmd(cmdStr), nil
 	}
 
-	return cmd
+	return cmd, nil
 }
 
-func (b *MariadbBuilder) BuildRestoreCmds(tmpDir string, idList []string, target string) [][]string {
+func (b *MariadbBuilder) BuildRestoreCmds(tmpDir string, idList []string, target string) ([][]string, error) {
 	var commands [][]string
 	
 	fullBackupID := idList[0]
 	fullBackupPath := filepath.Join(b.config.BackupDir, fullBackupID)
 	tmpFullBackupPath := filepath.Join(tmpDir, fullBackupID)
 
-	// Step 1: Copy full backup to tmp
-	commands = append(commands, []string{
-		"cp", "-r", fullBackupPath, tmpDir,
-	})
+	// Step 1: Copy full backup to tmp, streamed backups are extracted into it instead.
+	// Streamed incrementals are extracted next to it, the prepare steps need directories.
+	incrPaths := make(map[string]string, len(idList)-1)
+	for i, id := range idList {
+		streamFile, streamed := b.streamFile(id)
+		switch {
+		case i == 0 && streamed:
+			extract, err := b.extractStreamCmd(streamFile, tmpFullBackupPath)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, extract)
+		case i == 0:
+			commands = append(commands, []string{
+				"cp", "-r", fullBackupPath, tmpDir,
+			})
+		case streamed:
+			incrPaths[id] = filepath.Join(tmpDir, id)
+			extract, err := b.extractStreamCmd(streamFile, incrPaths[id])
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, extract)
+		default:
+			incrPaths[id] = filepath.Join(b.config.BackupDir, id)
+		}
+	}
 
 	// Step 2: Prepare full backup
 	prepareCmd := []string{
@@ -138,8 +183,7 @@ func (b *MariadbBuilder) BuildRestoreCmds(tmpDir string, idList []string, target
 
 	// Step 3: Apply incremental backups
 	for i := 1; i < len(idList); i++ {
-		incrID := idList[i]
-		incrPath := filepath.Join(b.config.BackupDir, incrID)
+		incrPath := incrPaths[idList[i]]
 		
 		applyCmd := []string{
 			b.executable(),
@@ -156,17 +200,81 @@ func (b *MariadbBuilder) BuildRestoreCmds(tmpDir string, idList []string, target
 		commands = append(commands, applyCmd)
 	}
 
-	// Step 4: Copy back to database (only for database target)
-	if target == string(RestoreTargetDatabase) {
+	// Step 4: Copy back to database, or pack the prepared folder into an archive
+	switch target {
+	case string(RestoreTargetDatabase):
+		// The captured grants are no part of the data dir, copy-back would copy them in too
+		if b.hasGrants(idList) {
+			commands = append(commands, []string{"rm", "-f", filepath.Join(tmpFullBackupPath, GrantsFileName)})
+		}
 		copyBackCmd := []string{
 			b.executable(),
 			"--copy-back",
 			fmt.Sprintf("--target-dir=%s", tmpFullBackupPath),
 		}
 		commands = append(commands, copyBackCmd)
+	case string(RestoreTargetArchive):
+		archive, err := b.archiveCmd(tmpFullBackupPath)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, archive)
 	}
 
-	return commands
+	return commands, nil
+}
+
+// archiveCmd packs the prepared folder dir into dir.tar.zst next to it, and removes the
+// folder once the archive is complete
+func (b *MariadbBuilder) archiveCmd(dir string) ([]string, error) {
+	tar := fmt.Sprintf("tar -C %s -cf - %s", filepath.Dir(dir), filepath.Base(dir))
+	compress := fmt.Sprintf("zstd - -c -T0 > %s%s", dir, ArchiveSuffix)
+	if err := checkStages(b.config, tar, compress); err != nil {
+		return nil, err
+	}
+	return shellCmd(fmt.Sprintf("(%s) && rm -rf %s", pipeline(tar, compress), dir)), nil
+}
+
+// hasGrants reports whether a backup of the chain has captured grants, which the copy
+// and the incremental prepare steps bring along into the prepared folder
+func (b *MariadbBuilder) hasGrants(idList []string) bool {
+	for _, id := range idList {
+		if _, err := os.Stat(filepath.Join(b.config.BackupDir, id, GrantsFileName)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// streamFile returns the stream file of a backup that has no backup folder
+func (b *MariadbBuilder) streamFile(id string) (string, bool) {
+	if _, err := os.Stat(filepath.Join(b.config.BackupDir, id)); err == nil {
+		return "", false
+	}
+	return FindStreamFile(b.config, id)
+}
+
+// extractStreamCmd unpacks a stream file into dir, decompressing it by its extension
+func (b *MariadbBuilder) extractStreamCmd(streamFile, dir string) ([]string, error) {
+	extractor := constants.MbstreamBin
+	if b.config.DbType == "mysql" {
+		extractor = constants.XbstreamBin
+	}
+	extract := fmt.Sprintf("%s -x -C %s", extractor, dir)
+
+	var stages []string
+	switch {
+	case strings.HasSuffix(streamFile, ".gz"):
+		stages = []string{"gunzip -c " + streamFile, extract}
+	case strings.HasSuffix(streamFile, ".zst"):
+		stages = []string{"zstd -d -c " + streamFile, extract}
+	default:
+		stages = []string{extract + " < " + streamFile}
+	}
+	if err := checkStages(b.config, stages...); err != nil {
+		return nil, err
+	}
+	return shellCmd(fmt.Sprintf("mkdir -p %s || exit $?; %s", dir, pipeline(stages...))), nil
 }
 
 func (b *MariadbBuilder) shouldUseApplyLogOnly() bool {
@@ -174,10 +282,11 @@ func (b *MariadbBuilder) shouldUseApplyLogOnly() bool {
 	return b.version.LessThan(Version{Major: 10, Minor: 2, Patch: 0})
 }
 
-func DetectMariaDBVersion(credentialsFile string) (Version, error) {
-	cmd := exec.Command(constants.MariaDBAdminBin,
-		fmt.Sprintf("--defaults-file=%s", credentialsFile),
-		"--defaults-group-suffix=-dbcalm",
+// DetectMariaDBVersion reads the version of the configured admin tool, admin_bin when set
+func DetectMariaDBVersion(cfg *config.Config) (Version, error) {
+	cmd := exec.Command(cfg.AdminExecutable(),
+		fmt.Sprintf("--defaults-file=%s", cfg.BackupCredentialsFile),
+		fmt.Sprintf("--defaults-group-suffix=%s", cfg.DefaultsGroupSuffix()),
 		"--version")
 
 	output, err := cmd.CombinedOutput()
@@ -185,10 +294,11 @@ func DetectMariaDBVersion(credentialsFile string) (Version, error) {
 		return Version{}, fmt.Errorf("failed to detect MariaDB version: %w", err)
 	}
 
-	return parseVersion(string(output))
+	return ParseVersion(string(output))
 }
 
-func parseVersion(versionStr string) (Version, error) {
+// ParseVersion reads the first major.minor.patch version from a tool's output
+func ParseVersion(versionStr string) (Version, error) {
 	// Example: "mariadb-admin  Ver 10.5.23-MariaDB for Linux on x86_64"
 	re := regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
 	matches := re.FindStringSubmatch(versionStr)
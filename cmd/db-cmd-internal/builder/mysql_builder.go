@@ -5,7 +5,6 @@ import (
 	"os/exec"
 
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
-	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
 )
 
 type MysqlBuilder struct {
@@ -25,26 +24,39 @@ func (b *MysqlBuilder) executable() string {
 	return "/usr/bin/xtrabackup"
 }
 
-func (b *MysqlBuilder) BuildFullBackupCmd(id string) []string {
+func (b *MysqlBuilder) WithCredentialsSuffix(suffix string) Builder {
+	return NewMysqlBuilder(b.config.WithCredentialsSuffix(suffix), b.version)
+}
+
+func (b *MysqlBuilder) BuildFullBackupCmd(id string, excludeDatabases []string) ([]string, error) {
 	// Use parent implementation but with xtrabackup executable
-	cmd := b.MariadbBuilder.buildBackupCmd(id, "")
+	cmd, err := b.MariadbBuilder.buildBackupCmd(id, "", excludeDatabases)
+	if err != nil {
+		return nil, err
+	}
 	// Replace mariabackup with xtrabackup
 	if len(cmd) > 0 && cmd[0] != b.executable() {
 		cmd[0] = b.executable()
 	}
-	return cmd
+	return cmd, nil
 }
 
-func (b *MysqlBuilder) BuildIncrementalBackupCmd(id, fromBackupID string) []string {
-	cmd := b.MariadbBuilder.buildBackupCmd(id, fromBackupID)
+func (b *MysqlBuilder) BuildIncrementalBackupCmd(id, fromBackupID string, excludeDatabases []string) ([]string, error) {
+	cmd, err := b.MariadbBuilder.buildBackupCmd(id, fromBackupID, excludeDatabases)
+	if err != nil {
+		return nil, err
+	}
 	if len(cmd) > 0 && cmd[0] != b.executable() {
 		cmd[0] = b.executable()
 	}
-	return cmd
+	return cmd, nil
 }
 
-func (b *MysqlBuilder) BuildRestoreCmds(tmpDir string, idList []string, target string) [][]string {
-	commands := b.MariadbBuilder.BuildRestoreCmds(tmpDir, idList, target)
+func (b *MysqlBuilder) BuildRestoreCmds(tmpDir string, idList []string, target string) ([][]string, error) {
+	commands, err := b.MariadbBuilder.BuildRestoreCmds(tmpDir, idList, target)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Replace mariabackup with xtrabackup in all commands
 	for i, cmd := range commands {
@@ -63,13 +75,14 @@ func (b *MysqlBuilder) BuildRestoreCmds(tmpDir string, idList []string, target s
 		}
 	}
 
-	return commands
+	return commands, nil
 }
 
-func DetectMySQLVersion(credentialsFile string) (Version, error) {
-	cmd := exec.Command(constants.MySQLAdminBin,
-		fmt.Sprintf("--defaults-file=%s", credentialsFile),
-		"--defaults-group-suffix=-dbcalm",
+// DetectMySQLVersion reads the version of the configured admin tool, admin_bin when set
+func DetectMySQLVersion(cfg *config.Config) (Version, error) {
+	cmd := exec.Command(cfg.AdminExecutable(),
+		fmt.Sprintf("--defaults-file=%s", cfg.BackupCredentialsFile),
+		fmt.Sprintf("--defaults-group-suffix=%s", cfg.DefaultsGroupSuffix()),
 		"--version")
 
 	output, err := cmd.CombinedOutput()
@@ -77,5 +90,5 @@ func DetectMySQLVersion(credentialsFile string) (Version, error) {
 		return Version{}, fmt.Errorf("failed to detect MySQL version: %w", err)
 	}
 
-	return parseVersion(string(output))
+	return ParseVersion(string(output))
 }
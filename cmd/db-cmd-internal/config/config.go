@@ -2,8 +2,17 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
 	"github.com/spf13/viper"
 )
 
@@ -13,11 +22,665 @@ type Config struct {
 	BackupCredentialsFile string `mapstructure:"backup_credentials_file"`
 	BackupBin             string `mapstructure:"backup_bin"`
 	DataDir               string `mapstructure:"data_dir"`
+	// DataDirAllowlist holds filepath.Match patterns of files a database restore accepts in
+	// DataDir on top of the built-in ones, e.g. undo_* for separate undo tablespaces
+	DataDirAllowlist []string `mapstructure:"data_dir_allowlist"`
+	// DataDirCheck is what a database restore does when DataDir holds other files:
+	// DataDirCheckRefuse or DataDirCheckWarn
+	DataDirCheck string `mapstructure:"data_dir_check"`
 	Stream                bool   `mapstructure:"stream"`
 	Compression           string `mapstructure:"compression"`
 	Forward               string `mapstructure:"forward"`
+	// SSHForward streams each backup to its own file on another host, instead of a
+	// hand-written Forward pipeline
+	SSHForward SSHForward `mapstructure:"ssh_forward"`
+	// BackupCgroup runs backups in a transient systemd scope with these resource limits,
+	// unset runs them like any other command
+	BackupCgroup BackupCgroup `mapstructure:"backup_cgroup"`
 	Host                  string `mapstructure:"host"`
 	DatabasePath          string `mapstructure:"database_path"`
+	// ExcludeDatabases are left out of every backup, on top of any per-schedule exclusions
+	ExcludeDatabases []string `mapstructure:"exclude_databases"`
+	// HookDir is the only directory pre/post backup hooks may be run from
+	HookDir        string `mapstructure:"hook_dir"`
+	PreBackupHook  string `mapstructure:"pre_backup_hook"`
+	PostBackupHook string `mapstructure:"post_backup_hook"`
+	// CredentialsSuffix selects the [client<suffix>] section of the credentials file
+	// used when a request doesn't name one
+	CredentialsSuffix string `mapstructure:"credentials_suffix"`
+	// CredentialsPermissions is what backups and restores do when the credentials file
+	// is readable by others or writable by its group: CredentialsPermissionsWarn,
+	// CredentialsPermissionsRefuse or CredentialsPermissionsIgnore
+	CredentialsPermissions string `mapstructure:"credentials_permissions"`
+	// CommandEnv holds extra KEY=VALUE entries for the environment the backup tools run
+	// with, such as a locale or LD_LIBRARY_PATH on a non-Debian library layout
+	CommandEnv []string `mapstructure:"command_env"`
+	// CreateBackupDir creates a missing backup_dir at startup, owned by BackupDirOwner
+	// ("user" or "user:group") when set
+	CreateBackupDir bool   `mapstructure:"create_backup_dir"`
+	BackupDirOwner  string `mapstructure:"backup_dir_owner"`
+	// LogMaxSize (MB) is the size the server log is rotated at, LogMaxAge (days) and
+	// LogMaxBackups limit the rotated files kept, zero keeps them all
+	LogMaxSize    int `mapstructure:"log_max_size"`
+	LogMaxAge     int `mapstructure:"log_max_age"`
+	LogMaxBackups int `mapstructure:"log_max_backups"`
+	// MinFreeInodes is the number of free inodes backups and restores need on the filesystem
+	// they write to, zero disables the check
+	MinFreeInodes uint64 `mapstructure:"min_free_inodes"`
+	// BackupFileMode and BackupDirMode are set on the files and directories of every
+	// backup, so database contents don't follow whatever umask db-cmd runs with
+	BackupFileMode os.FileMode `mapstructure:"backup_file_mode"`
+	BackupDirMode  os.FileMode `mapstructure:"backup_dir_mode"`
+	// BackupOwner ("user" or "user:group") is given every finished backup, folder or
+	// stream file, so the restore path can read what db-cmd wrote. Empty keeps db-cmd's.
+	BackupOwner string `mapstructure:"backup_owner"`
+	// SyncBackups fsyncs every finished backup before it is recorded in the catalog, so
+	// a crash right after can't lose a backup the catalog lists. Turning it off trades
+	// that guarantee for faster completion of large backups.
+	SyncBackups bool `mapstructure:"sync_backups"`
+	// CaptureGrants writes the server's users and grants to grants.sql in every finished
+	// backup folder, so they can be restored on their own with restore_mode grants.
+	// Streamed backups have no folder, so it can't be combined with Stream.
+	CaptureGrants bool `mapstructure:"capture_grants"`
+	// Source is the role of the server this instance backs up, SourcePrimary or
+	// SourceReplica, recorded on every backup. Empty leaves backups without a source.
+	Source string `mapstructure:"source"`
+	// CompressOutput gzips the output and errors stored for a process when they are at
+	// least CompressOutputMinSize bytes, keeping the process table small
+	CompressOutput        bool `mapstructure:"compress_output"`
+	CompressOutputMinSize int  `mapstructure:"compress_output_min_size"`
+	// PreRestoreCopy copies what is in DataDir to a timestamped folder under PreRestoreCopyDir
+	// before a physical database restore copies back over it, skipped when that filesystem
+	// lacks the space. PreRestoreCopyDir defaults to backup_dir/pre-restore. It needs
+	// DataDirCheckWarn, with DataDirCheckRefuse there is nothing in DataDir to copy.
+	PreRestoreCopy    bool   `mapstructure:"pre_restore_copy"`
+	PreRestoreCopyDir string `mapstructure:"pre_restore_copy_dir"`
+	// ServerStartCommand starts the database server after a physical database restore,
+	// e.g. [/usr/bin/systemctl, start, mariadb]. Empty leaves starting it to the operator.
+	ServerStartCommand []string `mapstructure:"server_start_command"`
+	// RestoreFailureServer is what happens to the server after a failed physical database
+	// restore, RestoreFailureKeepStopped or RestoreFailureStart
+	RestoreFailureServer string `mapstructure:"restore_failure_server"`
+	// AdminBin is the admin tool the server is pinged with, mariadb-admin or mysqladmin
+	// by db_type when empty
+	AdminBin string `mapstructure:"admin_bin"`
+	// PingFallbackAddress is connected to instead when the admin tool is missing: host:port
+	// or the absolute path of the server's socket. Empty disables the fallback.
+	PingFallbackAddress string `mapstructure:"ping_fallback_address"`
+	// StatusUpdateAttempts is how often the final status of a process is written to the
+	// catalog before it is kept in StatusFallbackFile, waiting StatusUpdateBackoff (doubling)
+	// between attempts
+	StatusUpdateAttempts int           `mapstructure:"status_update_attempts"`
+	StatusUpdateBackoff  time.Duration `mapstructure:"status_update_backoff"`
+	// SuccessExitCodes holds the exit codes, per process type, that count as success
+	// besides 0, e.g. {backup: [1]} for a backup tool that exits 1 on warnings
+	SuccessExitCodes map[string][]int `mapstructure:"success_exit_codes"`
+	// CommandTimeouts holds how long a command of a process type may run before it is
+	// killed, e.g. {backup: 6h, cleanup_backups: 5m}. Types left out have no timeout.
+	CommandTimeouts map[string]time.Duration `mapstructure:"command_timeouts"`
+}
+
+// StatusFallbackFile holds the final process statuses the catalog couldn't take, next to
+// the catalog. db-cmd writes them on its next start.
+func (c *Config) StatusFallbackFile() string {
+	return filepath.Join(filepath.Dir(c.DatabasePath), "pending-status.jsonl")
+}
+
+// BackupFallbackFile holds the backups the catalog couldn't take once they finished, next
+// to the catalog. db-cmd records them on its next start.
+func (c *Config) BackupFallbackFile() string {
+	return filepath.Join(filepath.Dir(c.DatabasePath), "pending-backups.jsonl")
+}
+
+// AdminExecutable is the admin tool the server is pinged with
+func (c *Config) AdminExecutable() string {
+	if c.AdminBin != "" {
+		return c.AdminBin
+	}
+	if c.DbType == "mysql" {
+		return constants.MySQLAdminBin
+	}
+	return constants.MariaDBAdminBin
+}
+
+// ValidateAdminBin checks a configured admin tool is an executable file
+func ValidateAdminBin(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("admin_bin must be an absolute path, got: %q", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("admin_bin %s is not accessible: %w", path, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("admin_bin %s is not an executable file", path)
+	}
+	return nil
+}
+
+// ValidatePingFallbackAddress checks the fallback is host:port or an absolute socket path
+func ValidatePingFallbackAddress(address string) error {
+	if address == "" || filepath.IsAbs(address) {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return fmt.Errorf("invalid ping_fallback_address %q: must be host:port or a socket path", address)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid ping_fallback_address %q: invalid port", address)
+	}
+	return nil
+}
+
+// Restore failure policies. Starting the server on a half-restored data dir can damage
+// it further, so by default it is left stopped for the operator to inspect.
+const (
+	RestoreFailureKeepStopped = "keep_stopped"
+	RestoreFailureStart       = "start"
+)
+
+// ValidateServerStart checks the server start command and the restore failure policy
+func ValidateServerStart(command []string, restoreFailure string) error {
+	if restoreFailure != RestoreFailureKeepStopped && restoreFailure != RestoreFailureStart {
+		return fmt.Errorf("restore_failure_server must be '%s' or '%s', got: %s", RestoreFailureKeepStopped, RestoreFailureStart, restoreFailure)
+	}
+	if len(command) == 0 {
+		if restoreFailure == RestoreFailureStart {
+			return fmt.Errorf("restore_failure_server: %s requires server_start_command", RestoreFailureStart)
+		}
+		return nil
+	}
+	if !filepath.IsAbs(command[0]) {
+		return fmt.Errorf("server_start_command must start with an absolute path, got: %q", command[0])
+	}
+	return nil
+}
+
+// Credentials file permission policies. The file holds database passwords, the installer
+// leaves it 0640 so only its owner and group can read it.
+const (
+	CredentialsPermissionsWarn   = "warn"
+	CredentialsPermissionsRefuse = "refuse"
+	CredentialsPermissionsIgnore = "ignore"
+)
+
+// ValidateCredentialsPermissions checks the credentials file permission policy
+func ValidateCredentialsPermissions(policy string) error {
+	switch policy {
+	case CredentialsPermissionsWarn, CredentialsPermissionsRefuse, CredentialsPermissionsIgnore:
+		return nil
+	}
+	return fmt.Errorf("credentials_permissions must be '%s', '%s' or '%s', got: %s",
+		CredentialsPermissionsWarn, CredentialsPermissionsRefuse, CredentialsPermissionsIgnore, policy)
+}
+
+// Data directory policies for database restores. Either way the files that are in the way
+// are logged, warn leaves it to the backup tool's copy-back to take them or fail.
+const (
+	DataDirCheckRefuse = "refuse"
+	DataDirCheckWarn   = "warn"
+)
+
+// ValidateDataDirCheck checks the data directory policy
+func ValidateDataDirCheck(policy string) error {
+	switch policy {
+	case DataDirCheckRefuse, DataDirCheckWarn:
+		return nil
+	}
+	return fmt.Errorf("data_dir_check must be '%s' or '%s', got: %s", DataDirCheckRefuse, DataDirCheckWarn, policy)
+}
+
+// ValidateDataDirAllowlist checks every entry is a valid pattern for a single file name
+func ValidateDataDirAllowlist(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || strings.Contains(pattern, "/") {
+			return fmt.Errorf("%q must be a file name pattern without a directory", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Server roles a backup can be taken from
+const (
+	SourcePrimary = "primary"
+	SourceReplica = "replica"
+)
+
+// ValidateSource checks the role of the server backups are taken from
+func ValidateSource(source string) error {
+	switch source {
+	case "", SourcePrimary, SourceReplica:
+		return nil
+	}
+	return fmt.Errorf("source must be '%s' or '%s', got: %s", SourcePrimary, SourceReplica, source)
+}
+
+// Backup permission defaults, only the owner can read database contents
+const (
+	DefaultBackupFileMode os.FileMode = 0600
+	DefaultBackupDirMode  os.FileMode = 0700
+)
+
+// ValidateBackupModes checks the backup permissions are plain permission bits that
+// leave the owner able to read the backups back
+func ValidateBackupModes(fileMode, dirMode os.FileMode) error {
+	if fileMode&^os.ModePerm != 0 || fileMode&0600 != 0600 {
+		return fmt.Errorf("invalid backup_file_mode %04o: must be permission bits including owner read/write", fileMode)
+	}
+	if dirMode&^os.ModePerm != 0 || dirMode&0700 != 0700 {
+		return fmt.Errorf("invalid backup_dir_mode %04o: must be permission bits including owner read/write/execute", dirMode)
+	}
+	return nil
+}
+
+// StreamUmask is the umask a stream file is created with, so it never has more
+// permissions than BackupFileMode. Empty when no file mode is configured.
+func (c *Config) StreamUmask() string {
+	if c.BackupFileMode == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04o", ^c.BackupFileMode&os.ModePerm)
+}
+
+// DefaultCompressOutputMinSize leaves short output as text, it would barely shrink
+const DefaultCompressOutputMinSize = 4096
+
+// OutputCompressMinSize is the size stored process output is compressed from, zero when
+// compression is off
+func (c *Config) OutputCompressMinSize() int {
+	if !c.CompressOutput {
+		return 0
+	}
+	return c.CompressOutputMinSize
+}
+
+// DefaultMinFreeInodes leaves room for the files of a database with many small tables
+const DefaultMinFreeInodes = 10000
+
+// Log rotation defaults
+const (
+	DefaultLogMaxSize    = 100
+	DefaultLogMaxAge     = 30
+	DefaultLogMaxBackups = 5
+)
+
+// DefaultCredentialsSuffix selects the [client-dbcalm] section of the credentials file
+const DefaultCredentialsSuffix = "-dbcalm"
+
+// credentialsSuffixPattern keeps the option group suffix safe to pass on the command line
+var credentialsSuffixPattern = regexp.MustCompile(`^-[A-Za-z0-9_]{1,32}$`)
+
+// ValidateCredentialsSuffix checks a --defaults-group-suffix value such as "-replica"
+func ValidateCredentialsSuffix(suffix string) error {
+	if !credentialsSuffixPattern.MatchString(suffix) {
+		return fmt.Errorf("invalid credentials suffix: %q", suffix)
+	}
+	return nil
+}
+
+// DefaultsGroupSuffix is the --defaults-group-suffix passed to the database tools
+func (c *Config) DefaultsGroupSuffix() string {
+	if c.CredentialsSuffix == "" {
+		return DefaultCredentialsSuffix
+	}
+	return c.CredentialsSuffix
+}
+
+// WithCredentialsSuffix returns the config with another credentials section selected.
+// An empty suffix keeps the configured one.
+func (c *Config) WithCredentialsSuffix(suffix string) *Config {
+	if suffix == "" || suffix == c.DefaultsGroupSuffix() {
+		return c
+	}
+	selected := *c
+	selected.CredentialsSuffix = suffix
+	return &selected
+}
+
+// envKeyPattern matches the environment variable names command_env may set
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateCommandEnv checks that every entry has the KEY=VALUE form
+func ValidateCommandEnv(env []string) error {
+	for _, entry := range env {
+		key, _, found := strings.Cut(entry, "=")
+		if !found || !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid environment entry: %q", entry)
+		}
+	}
+	return nil
+}
+
+// knownProcessType reports whether db-cmd runs processes of the type
+func knownProcessType(processType string) bool {
+	switch processType {
+	case process.TypeBackup, process.TypeRestore, process.TypeCleanupBackups, process.TypeVerifyBackup, process.TypeConsolidate:
+		return true
+	}
+	return false
+}
+
+// ValidateSuccessExitCodes checks that the success exit codes are set for known process
+// types and are exit codes a command can return
+func ValidateSuccessExitCodes(codes map[string][]int) error {
+	for processType, typeCodes := range codes {
+		if !knownProcessType(processType) {
+			return fmt.Errorf("success_exit_codes: unknown process type: %s", processType)
+		}
+		for _, code := range typeCodes {
+			if code < 0 || code > 255 {
+				return fmt.Errorf("success_exit_codes: %s: exit code must be between 0 and 255, got: %d", processType, code)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateCommandTimeouts checks that the timeouts are set for known process types and
+// are positive
+func ValidateCommandTimeouts(timeouts map[string]time.Duration) error {
+	for processType, timeout := range timeouts {
+		if !knownProcessType(processType) {
+			return fmt.Errorf("command_timeouts: unknown process type: %s", processType)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("command_timeouts: %s: timeout must be positive, got: %s", processType, timeout)
+		}
+	}
+	return nil
+}
+
+// forwardMetacharacters may not appear outside single quotes in the forward pipeline,
+// so it can't chain, substitute or redirect commands in the root shell running it
+const forwardMetacharacters = ";&`$()<>\"\\\n\r"
+
+// ValidateForward checks the pipeline streamed backups are piped into. It may only
+// pipe between plain commands, shell syntax is allowed inside single quotes (e.g. the
+// remote command of ssh).
+func ValidateForward(forward string) error {
+	if forward == "" {
+		return nil
+	}
+	_, err := forwardStages(forward)
+	return err
+}
+
+// forwardStages splits the forward pipeline into its stages
+func forwardStages(forward string) ([]string, error) {
+	var stages []string
+	quoted := false
+	stage := ""
+	for _, r := range forward {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '|':
+			if strings.TrimSpace(stage) == "" {
+				return nil, fmt.Errorf("invalid forward %q: empty pipeline stage", forward)
+			}
+			stages = append(stages, strings.TrimSpace(stage))
+			stage = ""
+			continue
+		case strings.ContainsRune(forwardMetacharacters, r):
+			return nil, fmt.Errorf("invalid forward %q: %q is only allowed inside single quotes", forward, r)
+		}
+		stage += string(r)
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("invalid forward %q: unterminated quote", forward)
+	}
+	if strings.TrimSpace(stage) == "" {
+		return nil, fmt.Errorf("invalid forward %q: empty pipeline stage", forward)
+	}
+	return append(stages, strings.TrimSpace(stage)), nil
+}
+
+// ForwardStages are the stages of the pipeline a streamed backup saved as fileName is
+// piped into, none when streams are written locally
+func (c *Config) ForwardStages(fileName string) []string {
+	if c.Forward == "" {
+		if c.SSHForward.Enabled() {
+			return []string{c.ForwardPipeline(fileName)}
+		}
+		return nil
+	}
+	// The forward was validated when the config was loaded
+	stages, _ := forwardStages(c.Forward)
+	return stages
+}
+
+// BackupCgroup holds the resource limits of the systemd scope backups run in. Empty fields
+// set no limit.
+type BackupCgroup struct {
+	MemoryMax string `mapstructure:"memory_max"` // Bytes with an optional K, M, G or T suffix
+	CPUQuota  string `mapstructure:"cpu_quota"`  // Percentage of one CPU, 200% is two
+	IOWeight  int    `mapstructure:"io_weight"`  // 1-10000, others get 100 by default
+	Slice     string `mapstructure:"slice"`      // Slice the scope is placed in, e.g. dbcalm.slice
+}
+
+var (
+	cgroupMemoryPattern = regexp.MustCompile(`^[1-9][0-9]*[KMGT]?$`)
+	cgroupCPUPattern    = regexp.MustCompile(`^[1-9][0-9]*%$`)
+	cgroupSlicePattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:-]*\.slice$`)
+)
+
+// Enabled reports whether backups run in a systemd scope
+func (c BackupCgroup) Enabled() bool {
+	return c.MemoryMax != "" || c.CPUQuota != "" || c.IOWeight != 0 || c.Slice != ""
+}
+
+// ValidateBackupCgroup checks the limits are values systemd takes, so a typo fails at
+// startup instead of every backup
+func ValidateBackupCgroup(c BackupCgroup) error {
+	if c.MemoryMax != "" && !cgroupMemoryPattern.MatchString(c.MemoryMax) {
+		return fmt.Errorf("invalid backup_cgroup memory_max: %q (expected bytes with an optional K, M, G or T suffix)", c.MemoryMax)
+	}
+	if c.CPUQuota != "" && !cgroupCPUPattern.MatchString(c.CPUQuota) {
+		return fmt.Errorf("invalid backup_cgroup cpu_quota: %q (expected a percentage, e.g. 50%%)", c.CPUQuota)
+	}
+	if c.IOWeight < 0 || c.IOWeight > 10000 {
+		return fmt.Errorf("invalid backup_cgroup io_weight: %d (expected 1-10000)", c.IOWeight)
+	}
+	if c.Slice != "" && !cgroupSlicePattern.MatchString(c.Slice) {
+		return fmt.Errorf("invalid backup_cgroup slice: %q (expected a name ending in .slice)", c.Slice)
+	}
+	return nil
+}
+
+// SSHForward is the host streamed backups are written to over ssh
+type SSHForward struct {
+	Host         string `mapstructure:"host"`
+	User         string `mapstructure:"user"`
+	Port         int    `mapstructure:"port"`
+	RemoteDir    string `mapstructure:"remote_dir"`
+	IdentityFile string `mapstructure:"identity_file"`
+}
+
+// sshConnectTimeout keeps an unreachable host from hanging a backup or its preflight
+const sshConnectTimeout = 10
+
+var (
+	// sshHostPattern can't start with "-", so the host is never taken for an ssh option
+	sshHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	sshUserPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,31}$`)
+	// sshPathPattern keeps paths free of characters either shell would interpret
+	sshPathPattern = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+	// SSHFileNamePattern limits the remote file names, which are built from backup IDs
+	SSHFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+)
+
+// Enabled reports whether streamed backups are forwarded over ssh
+func (f SSHForward) Enabled() bool {
+	return f.Host != ""
+}
+
+// ValidateSSHForward checks every part of the ssh target is safe to put on the command line
+func ValidateSSHForward(f SSHForward) error {
+	if !sshHostPattern.MatchString(f.Host) {
+		return fmt.Errorf("invalid ssh_forward host: %q", f.Host)
+	}
+	if !sshUserPattern.MatchString(f.User) {
+		return fmt.Errorf("invalid ssh_forward user: %q", f.User)
+	}
+	if f.Port < 0 || f.Port > 65535 {
+		return fmt.Errorf("invalid ssh_forward port: %d", f.Port)
+	}
+	if !sshPathPattern.MatchString(f.RemoteDir) || filepath.Clean(f.RemoteDir) != f.RemoteDir {
+		return fmt.Errorf("invalid ssh_forward remote_dir: %q", f.RemoteDir)
+	}
+	if f.IdentityFile != "" && (!sshPathPattern.MatchString(f.IdentityFile) || filepath.Clean(f.IdentityFile) != f.IdentityFile) {
+		return fmt.Errorf("invalid ssh_forward identity_file: %q", f.IdentityFile)
+	}
+	return nil
+}
+
+// Command is the ssh invocation up to the remote command. BatchMode makes a missing key
+// or unknown host key fail instead of prompting.
+func (f SSHForward) Command() []string {
+	cmd := []string{constants.SSHBin, "-o", "BatchMode=yes", "-o", fmt.Sprintf("ConnectTimeout=%d", sshConnectTimeout)}
+	if f.Port != 0 {
+		cmd = append(cmd, "-p", fmt.Sprintf("%d", f.Port))
+	}
+	if f.IdentityFile != "" {
+		cmd = append(cmd, "-i", f.IdentityFile)
+	}
+	return append(cmd, f.User+"@"+f.Host)
+}
+
+// ForwardPipeline is the pipeline a streamed backup saved as fileName is piped into,
+// empty when streams are written locally. With ssh_forward the file is written to
+// remote_dir, fileName has to match SSHFileNamePattern.
+func (c *Config) ForwardPipeline(fileName string) string {
+	if c.Forward != "" || !c.SSHForward.Enabled() {
+		return c.Forward
+	}
+	remoteFile := c.SSHForward.RemoteDir + "/" + fileName
+	return strings.Join(c.SSHForward.Command(), " ") + " 'cat > " + remoteFile + "'"
+}
+
+// Forwarded reports whether streamed backups leave this host
+func (c *Config) Forwarded() bool {
+	return c.Forward != "" || c.SSHForward.Enabled()
+}
+
+// databaseNamePattern limits excluded database names to plain identifiers so they
+// can be passed to mariabackup and the dump pipeline without quoting surprises
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_$-]{1,64}$`)
+
+// ValidateDatabaseNames checks that every name is a plain database identifier
+func ValidateDatabaseNames(names []string) error {
+	for _, name := range names {
+		if !databaseNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid database name: %q", name)
+		}
+	}
+	return nil
+}
+
+// hookPathPattern keeps hook paths free of characters the shell would interpret
+var hookPathPattern = regexp.MustCompile(`^/[A-Za-z0-9_./-]+$`)
+
+// ValidateHookPath checks that a hook is an absolute path inside the hook directory
+func (c *Config) ValidateHookPath(path string) error {
+	if !hookPathPattern.MatchString(path) || filepath.Clean(path) != path {
+		return fmt.Errorf("invalid hook path: %q", path)
+	}
+
+	hookDir := filepath.Clean(c.HookDir)
+	if c.HookDir == "" || !strings.HasPrefix(path, hookDir+string(filepath.Separator)) {
+		return fmt.Errorf("hook %s is not inside the hook directory %s", path, c.HookDir)
+	}
+
+	return nil
+}
+
+// CheckBackupDir checks that dir exists, is a directory and can be written to by
+// creating and removing a probe file in it
+func CheckBackupDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("backup directory %s does not exist", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("backup directory %s is not accessible: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("backup directory %s is not a directory", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".dbcalm-write-check-")
+	if err != nil {
+		return fmt.Errorf("backup directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	return nil
+}
+
+// createBackupDir creates the backup directory and hands it to the configured owner
+func (c *Config) createBackupDir() error {
+	if err := os.MkdirAll(c.BackupDir, 0750); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", c.BackupDir, err)
+	}
+	if c.BackupDirOwner == "" {
+		return nil
+	}
+
+	uid, gid, err := lookupOwner(c.BackupDirOwner)
+	if err != nil {
+		return fmt.Errorf("backup_dir_owner: %w", err)
+	}
+	if err := os.Chown(c.BackupDir, uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of backup directory %s: %w", c.BackupDir, err)
+	}
+	return nil
+}
+
+// BackupOwnerIDs resolves BackupOwner, -1 for both ids when it isn't set so os.Chown
+// leaves the owner alone
+func (c *Config) BackupOwnerIDs() (int, int, error) {
+	if c.BackupOwner == "" {
+		return -1, -1, nil
+	}
+	uid, gid, err := lookupOwner(c.BackupOwner)
+	if err != nil {
+		return -1, -1, fmt.Errorf("backup_owner: %w", err)
+	}
+	return uid, gid, nil
+}
+
+// lookupOwner resolves "user" or "user:group" to ids, a lone user keeps its primary group
+func lookupOwner(owner string) (int, int, error) {
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unknown user %q", userName)
+	}
+	gidStr := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown group %q", groupName)
+		}
+		gidStr = g.Gid
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid for user %q", userName)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid for owner %q", owner)
+	}
+	return uid, gid, nil
 }
 
 func Load(configPath string) (*Config, error) {
@@ -28,11 +691,30 @@ func Load(configPath string) (*Config, error) {
 	// Set defaults
 	v.SetDefault("backup_credentials_file", "/etc/dbcalm/credentials.cnf")
 	v.SetDefault("data_dir", "/var/lib/mysql")
+	v.SetDefault("data_dir_check", DataDirCheckRefuse)
 	v.SetDefault("stream", false)
 	v.SetDefault("compression", "")
 	v.SetDefault("forward", "")
 	v.SetDefault("host", "localhost")
 	v.SetDefault("database_path", "/var/lib/dbcalm/db.sqlite3")
+	v.SetDefault("hook_dir", "/etc/dbcalm/hooks")
+	v.SetDefault("credentials_suffix", DefaultCredentialsSuffix)
+	v.SetDefault("credentials_permissions", CredentialsPermissionsWarn)
+	v.SetDefault("create_backup_dir", false)
+	v.SetDefault("log_max_size", DefaultLogMaxSize)
+	v.SetDefault("log_max_age", DefaultLogMaxAge)
+	v.SetDefault("log_max_backups", DefaultLogMaxBackups)
+	v.SetDefault("min_free_inodes", DefaultMinFreeInodes)
+	v.SetDefault("backup_file_mode", uint32(DefaultBackupFileMode))
+	v.SetDefault("backup_dir_mode", uint32(DefaultBackupDirMode))
+	v.SetDefault("sync_backups", true)
+	v.SetDefault("capture_grants", false)
+	v.SetDefault("compress_output", false)
+	v.SetDefault("compress_output_min_size", DefaultCompressOutputMinSize)
+	v.SetDefault("restore_failure_server", RestoreFailureKeepStopped)
+	v.SetDefault("pre_restore_copy", false)
+	v.SetDefault("status_update_attempts", 5)
+	v.SetDefault("status_update_backoff", "200ms")
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -54,9 +736,123 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("backup_dir is required in config")
 	}
 
-	// Validate backup directory exists
+	if err := ValidateDatabaseNames(cfg.ExcludeDatabases); err != nil {
+		return nil, fmt.Errorf("exclude_databases: %w", err)
+	}
+
+	if err := ValidateCredentialsSuffix(cfg.CredentialsSuffix); err != nil {
+		return nil, err
+	}
+	if err := ValidateCredentialsPermissions(cfg.CredentialsPermissions); err != nil {
+		return nil, err
+	}
+	if err := ValidateSource(cfg.Source); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateDataDirAllowlist(cfg.DataDirAllowlist); err != nil {
+		return nil, fmt.Errorf("data_dir_allowlist: %w", err)
+	}
+	if err := ValidateDataDirCheck(cfg.DataDirCheck); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateForward(cfg.Forward); err != nil {
+		return nil, err
+	}
+
+	if cfg.SSHForward.Enabled() {
+		if err := ValidateSSHForward(cfg.SSHForward); err != nil {
+			return nil, err
+		}
+		if cfg.Forward != "" {
+			return nil, fmt.Errorf("forward and ssh_forward can't both be set")
+		}
+		if !cfg.Stream {
+			return nil, fmt.Errorf("ssh_forward requires stream: true")
+		}
+	}
+
+	if err := ValidateBackupCgroup(cfg.BackupCgroup); err != nil {
+		return nil, err
+	}
+
+	if cfg.LogMaxSize <= 0 {
+		return nil, fmt.Errorf("log_max_size must be positive, got: %d", cfg.LogMaxSize)
+	}
+	if cfg.LogMaxAge < 0 || cfg.LogMaxBackups < 0 {
+		return nil, fmt.Errorf("log_max_age and log_max_backups can't be negative")
+	}
+
+	if err := ValidateCommandEnv(cfg.CommandEnv); err != nil {
+		return nil, fmt.Errorf("command_env: %w", err)
+	}
+
+	if err := ValidateBackupModes(cfg.BackupFileMode, cfg.BackupDirMode); err != nil {
+		return nil, err
+	}
+	if _, _, err := cfg.BackupOwnerIDs(); err != nil {
+		return nil, err
+	}
+
+	if cfg.CompressOutput && cfg.CompressOutputMinSize < 1 {
+		return nil, fmt.Errorf("compress_output_min_size must be at least 1, got: %d", cfg.CompressOutputMinSize)
+	}
+
+	if cfg.StatusUpdateAttempts < 1 || cfg.StatusUpdateBackoff < 0 {
+		return nil, fmt.Errorf("status_update_attempts must be at least 1 and status_update_backoff can't be negative")
+	}
+
+	if err := ValidateSuccessExitCodes(cfg.SuccessExitCodes); err != nil {
+		return nil, err
+	}
+	if err := ValidateCommandTimeouts(cfg.CommandTimeouts); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateServerStart(cfg.ServerStartCommand, cfg.RestoreFailureServer); err != nil {
+		return nil, err
+	}
+
+	if cfg.CaptureGrants && cfg.Stream {
+		return nil, fmt.Errorf("capture_grants can't be combined with stream: true, streamed backups have no folder for grants.sql")
+	}
+
+	if cfg.PreRestoreCopy && cfg.DataDirCheck != DataDirCheckWarn {
+		return nil, fmt.Errorf("pre_restore_copy needs data_dir_check: %s, with %s a restore only starts on an empty data_dir", DataDirCheckWarn, cfg.DataDirCheck)
+	}
+	if cfg.PreRestoreCopyDir == "" {
+		cfg.PreRestoreCopyDir = filepath.Join(cfg.BackupDir, "pre-restore")
+	} else if !filepath.IsAbs(cfg.PreRestoreCopyDir) {
+		return nil, fmt.Errorf("pre_restore_copy_dir must be an absolute path, got: %s", cfg.PreRestoreCopyDir)
+	}
+
+	if cfg.AdminBin != "" {
+		if err := ValidateAdminBin(cfg.AdminBin); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidatePingFallbackAddress(cfg.PingFallbackAddress); err != nil {
+		return nil, err
+	}
+
+	for _, hook := range []string{cfg.PreBackupHook, cfg.PostBackupHook} {
+		if hook == "" {
+			continue
+		}
+		if err := cfg.ValidateHookPath(hook); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate backup directory exists, creating it when configured to
 	if _, err := os.Stat(cfg.BackupDir); os.IsNotExist(err) {
-		return nil, fmt.Errorf("backup directory does not exist: %s", cfg.BackupDir)
+		if !cfg.CreateBackupDir {
+			return nil, fmt.Errorf("backup directory does not exist: %s", cfg.BackupDir)
+		}
+		if err := cfg.createBackupDir(); err != nil {
+			return nil, err
+		}
 	}
 
 	return &cfg, nil
@@ -72,6 +868,8 @@ func (c *Config) Value(key string) string {
 		return c.BackupCredentialsFile
 	case "backup_bin":
 		return c.BackupBin
+	case "admin_bin":
+		return c.AdminBin
 	case "data_dir":
 		return c.DataDir
 	case "compression":
@@ -82,6 +880,12 @@ func (c *Config) Value(key string) string {
 		return c.Host
 	case "database_path":
 		return c.DatabasePath
+	case "hook_dir":
+		return c.HookDir
+	case "pre_backup_hook":
+		return c.PreBackupHook
+	case "post_backup_hook":
+		return c.PostBackupHook
 	default:
 		return ""
 	}
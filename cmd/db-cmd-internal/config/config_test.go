@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateForward(t *testing.T) {
+	tests := []struct {
+		forward string
+		valid   bool
+	}{
+		{forward: "", valid: true},
+		{forward: "ssh backup@vault 'cat > /backups/db.xbstream'", valid: true},
+		{forward: "pv -q | ssh backup@vault 'cat > /backups/db.xbstream'", valid: true},
+		{forward: "ssh backup@vault cat > /tmp/db.xbstream", valid: false},
+		{forward: "ssh backup@vault 'cat'; rm -rf /", valid: false},
+		{forward: "ssh backup@vault $(cat /etc/shadow)", valid: false},
+		{forward: "ssh backup@vault `id`", valid: false},
+		{forward: "ssh backup@vault 'cat' && reboot", valid: false},
+		{forward: "ssh backup@vault \"cat > $HOME/db\"", valid: false},
+		{forward: "ssh backup@vault 'cat", valid: false},
+		{forward: "ssh backup@vault || reboot", valid: false},
+		{forward: "ssh backup@vault |", valid: false},
+		{forward: "ssh backup@vault\nreboot", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateForward(tt.forward)
+		if tt.valid && err != nil {
+			t.Errorf("expected %q to be valid, got %v", tt.forward, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("expected %q to be rejected", tt.forward)
+		}
+	}
+}
+
+func TestSSHForwardPipeline(t *testing.T) {
+	cfg := &Config{
+		Stream: true,
+		SSHForward: SSHForward{
+			Host:         "vault.example.com",
+			User:         "backup",
+			Port:         2222,
+			RemoteDir:    "/srv/backups",
+			IdentityFile: "/etc/dbcalm/id_ed25519",
+		},
+	}
+	if err := ValidateSSHForward(cfg.SSHForward); err != nil {
+		t.Fatalf("expected a valid ssh_forward, got %v", err)
+	}
+
+	forward := cfg.ForwardPipeline("backup-20250101-000000.xbstream.gz")
+	expected := "/usr/bin/ssh -o BatchMode=yes -o ConnectTimeout=10 -p 2222 -i /etc/dbcalm/id_ed25519 backup@vault.example.com 'cat > /srv/backups/backup-20250101-000000.xbstream.gz'"
+	if forward != expected {
+		t.Errorf("expected %q, got %q", expected, forward)
+	}
+	// The constructed pipeline has to hold up to the checks on a hand-written one
+	if err := ValidateForward(forward); err != nil {
+		t.Errorf("expected the pipeline to pass ValidateForward, got %v", err)
+	}
+
+	invalid := []SSHForward{
+		{Host: "-oProxyCommand=id", User: "backup", RemoteDir: "/srv/backups"},
+		{Host: "vault", User: "backup;id", RemoteDir: "/srv/backups"},
+		{Host: "vault", User: "backup", RemoteDir: "/srv/backups'; rm -rf /'"},
+		{Host: "vault", User: "backup", RemoteDir: "relative/dir"},
+		{Host: "vault", User: "backup", RemoteDir: "/srv/../etc"},
+		{Host: "vault", User: "backup", RemoteDir: "/srv/backups", IdentityFile: "/etc/$(id)"},
+		{Host: "vault", User: "backup", RemoteDir: "/srv/backups", Port: 70000},
+	}
+	for _, f := range invalid {
+		if err := ValidateSSHForward(f); err == nil {
+			t.Errorf("expected %+v to be rejected", f)
+		}
+	}
+}
+
+func TestValidatePingFallbackAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{address: "", valid: true},
+		{address: "127.0.0.1:3306", valid: true},
+		{address: "db.internal:6033", valid: true},
+		{address: "[::1]:3306", valid: true},
+		{address: "/run/mysqld/mysqld.sock", valid: true},
+		{address: "127.0.0.1", valid: false},
+		{address: ":3306", valid: false},
+		{address: "127.0.0.1:70000", valid: false},
+		{address: "run/mysqld/mysqld.sock", valid: false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePingFallbackAddress(tt.address)
+		if tt.valid && err != nil {
+			t.Errorf("expected %q to be valid, got %v", tt.address, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("expected %q to be rejected", tt.address)
+		}
+	}
+}
+
+func TestValidateBackupCgroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup BackupCgroup
+		valid  bool
+	}{
+		{name: "unset", valid: true},
+		{name: "all limits", cgroup: BackupCgroup{MemoryMax: "4G", CPUQuota: "150%", IOWeight: 50, Slice: "dbcalm-backup.slice"}, valid: true},
+		{name: "memory in bytes", cgroup: BackupCgroup{MemoryMax: "1073741824"}, valid: true},
+		{name: "memory unit", cgroup: BackupCgroup{MemoryMax: "4GB"}},
+		{name: "memory zero", cgroup: BackupCgroup{MemoryMax: "0"}},
+		{name: "cpu without percent", cgroup: BackupCgroup{CPUQuota: "50"}},
+		{name: "io weight too high", cgroup: BackupCgroup{IOWeight: 10001}},
+		{name: "io weight negative", cgroup: BackupCgroup{IOWeight: -1}},
+		{name: "slice without suffix", cgroup: BackupCgroup{Slice: "dbcalm"}},
+		{name: "slice taken for an option", cgroup: BackupCgroup{Slice: "-p.slice"}},
+		{name: "slice with a space", cgroup: BackupCgroup{Slice: "db calm.slice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBackupCgroup(tt.cgroup)
+			if tt.valid && err != nil {
+				t.Errorf("expected %+v to be valid, got %v", tt.cgroup, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected %+v to be rejected", tt.cgroup)
+			}
+		})
+	}
+}
+
+func TestLoadCommandTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts string
+		expected map[string]time.Duration
+		valid    bool
+	}{
+		{
+			name:     "per process type",
+			timeouts: "command_timeouts:\n  backup: 6h\n  cleanup_backups: 5m\n  restore: 90m\n",
+			expected: map[string]time.Duration{"backup": 6 * time.Hour, "cleanup_backups": 5 * time.Minute, "restore": 90 * time.Minute},
+			valid:    true,
+		},
+		{name: "none configured", valid: true},
+		{name: "unknown process type", timeouts: "command_timeouts:\n  update_cron_schedules: 10s\n"},
+		{name: "not positive", timeouts: "command_timeouts:\n  backup: 0s\n"},
+		{name: "not a duration", timeouts: "command_timeouts:\n  backup: soon\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.yml")
+			content := "db_type: mariadb\nbackup_dir: " + dir + "\n" + tt.timeouts
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			cfg, err := Load(path)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("expected the timeouts to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if len(cfg.CommandTimeouts) != len(tt.expected) {
+				t.Fatalf("expected %d timeouts, got %v", len(tt.expected), cfg.CommandTimeouts)
+			}
+			for processType, timeout := range tt.expected {
+				if cfg.CommandTimeouts[processType] != timeout {
+					t.Errorf("expected %s to time out after %s, got %s", processType, timeout, cfg.CommandTimeouts[processType])
+				}
+			}
+		})
+	}
+}
@@ -20,6 +20,9 @@ const (
 	// TempRestorePrefix is the prefix for temporary restore directories
 	// The full path will be TempRestorePrefix + UUID
 	TempRestorePrefix = "/tmp/dbcalm-restore-"
+
+	// TempVerifyPrefix is the prefix for the directories backups are prepared in to verify them
+	TempVerifyPrefix = "/tmp/dbcalm-verify-"
 )
 
 // Database admin tool paths
@@ -31,6 +34,42 @@ const (
 	MySQLAdminBin = "/usr/bin/mysqladmin"
 )
 
+// Database client paths (used to replay logical dumps)
+const (
+	// MariaDBClientBin is the path to the mariadb client binary
+	MariaDBClientBin = "/usr/bin/mariadb"
+
+	// MySQLClientBin is the path to the mysql client binary
+	MySQLClientBin = "/usr/bin/mysql"
+)
+
+// Database dump tool paths (used by the logical backup strategy)
+const (
+	// MariaDBDumpBin is the path to the mariadb-dump binary
+	MariaDBDumpBin = "/usr/bin/mariadb-dump"
+
+	// MySQLDumpBin is the path to the mysqldump binary
+	MySQLDumpBin = "/usr/bin/mysqldump"
+)
+
+// Stream extraction tool paths (used to unpack streamed backups before a restore)
+const (
+	// MbstreamBin is the path to MariaDB's mbstream binary
+	MbstreamBin = "/usr/bin/mbstream"
+
+	// XbstreamBin is the path to Percona's xbstream binary
+	XbstreamBin = "/usr/bin/xbstream"
+)
+
+// SystemdRunBin is the path to systemd-run, which starts backups in a scope with resource limits
+const SystemdRunBin = "/usr/bin/systemd-run"
+
+// ShellBin is the shell pipelines, hooks and wrapped commands run in
+const ShellBin = "/bin/sh"
+
+// SSHBin is the path to ssh, which ssh_forward writes streamed backups to another host with
+const SSHBin = "/usr/bin/ssh"
+
 // Log paths
 const (
 	// LogDir is the directory for log files
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/repository"
+)
+
+// recordBackup adds a finished backup to the catalog, retrying while the catalog is busy
+// as process statuses are. Once every attempt failed the backup goes to the fallback file,
+// so its files aren't left in backup_dir without anything keeping track of them. It
+// reports whether the catalog has the backup.
+func (h *QueueHandler) recordBackup(backup *repository.Backup) bool {
+	attempts := h.config.StatusUpdateAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := h.config.StatusUpdateBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = h.createBackup(backup)
+		if err == nil {
+			return true
+		}
+		if attempt >= attempts {
+			break
+		}
+		log.Printf("Failed to create backup record for %s (attempt %d of %d), retrying: %v", backup.ID, attempt, attempts, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	log.Printf("Failed to create backup record for %s: %v", backup.ID, err)
+	path := h.config.BackupFallbackFile()
+	if err := appendPendingBackup(path, backup); err != nil {
+		log.Printf("Failed to keep backup %s for later, it is only in backup_dir now: %v", backup.ID, err)
+		return false
+	}
+	log.Printf("Kept backup %s in %s for later", backup.ID, path)
+	return false
+}
+
+func appendPendingBackup(path string, backup *repository.Backup) error {
+	line, err := json.Marshal(backup)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReconcileBackups adds the backups kept in the fallback file to the catalog and returns
+// how many were added. Backups the catalog got in the meantime are dropped, those that
+// still fail stay in the file.
+func (h *QueueHandler) ReconcileBackups() (int, error) {
+	path := h.config.BackupFallbackFile()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	var remaining []*repository.Backup
+	written := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var backup repository.Backup
+		if err := json.Unmarshal(scanner.Bytes(), &backup); err != nil {
+			log.Printf("Skipping unreadable entry in %s: %v", path, err)
+			continue
+		}
+		if existing, err := h.backupRepo.Get(backup.ID); err == nil && existing != nil {
+			log.Printf("Backup %s kept for later is already in the catalog", backup.ID)
+			continue
+		}
+		if err := h.createBackup(&backup); err != nil {
+			log.Printf("Failed to create kept backup record for %s: %v", backup.ID, err)
+			remaining = append(remaining, &backup)
+			continue
+		}
+		written++
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return written, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return written, fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	for _, backup := range remaining {
+		if err := appendPendingBackup(path, backup); err != nil {
+			return written, fmt.Errorf("failed to keep backup %s: %w", backup.ID, err)
+		}
+	}
+	return written, nil
+}
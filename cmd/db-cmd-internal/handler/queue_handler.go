@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/adapter"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
 	sharedProcess "github.com/martijn/dbcalm/shared/process"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
@@ -16,14 +22,26 @@ type QueueHandler struct {
 	config    *config.Config
 	backupRepo *repository.BackupRepository
 	restoreRepo *repository.RestoreRepository
+	// adapter runs the verification chained after backups that ask for it
+	adapter adapter.Adapter
+	processWriter *sharedProcess.Writer
+	// syncBackup flushes a finished backup to disk before it is recorded
+	syncBackup func(cfg *config.Config, id string) error
+	// createBackup adds a finished backup to the catalog
+	createBackup func(backup *repository.Backup) error
 }
 
-func NewQueueHandler(cfg *config.Config) *QueueHandler {
-	return &QueueHandler{
+func NewQueueHandler(cfg *config.Config, adptr adapter.Adapter) *QueueHandler {
+	h := &QueueHandler{
 		config:      cfg,
 		backupRepo:  repository.NewBackupRepository(cfg.DatabasePath),
 		restoreRepo: repository.NewRestoreRepository(cfg.DatabasePath),
+		adapter:     adptr,
+		processWriter: sharedProcess.NewWriter(cfg.DatabasePath),
+		syncBackup:    adapter.SyncBackup,
 	}
+	h.createBackup = h.backupRepo.Create
+	return h
 }
 
 func (h *QueueHandler) Handle(processChan <-chan *sharedProcess.Process) {
@@ -39,10 +57,23 @@ func (h *QueueHandler) handleProcess(proc *sharedProcess.Process) {
 		return
 	}
 
+	// A failed verification is an outcome to record, not a failed process to clean up
+	if proc.Type == process.TypeVerifyBackup {
+		h.handleVerify(proc)
+		return
+	}
+
+	if proc.Type == process.TypeRestore {
+		h.recordPhaseDurations(proc)
+	}
+
 	// Check if process failed
-	if proc.ReturnCode != nil && *proc.ReturnCode != 0 {
+	if proc.Failed() {
 		log.Printf("Process failed with return code %d: %s", *proc.ReturnCode, proc.Command)
 		h.cleanupFailedProcess(proc)
+		if proc.Type == process.TypeRestore {
+			h.handleServerAfterRestore(proc, true)
+		}
 		return
 	}
 
@@ -54,6 +85,8 @@ func (h *QueueHandler) handleProcess(proc *sharedProcess.Process) {
 		h.handleRestore(proc)
 	case process.TypeCleanupBackups:
 		h.handleCleanupBackups(proc)
+	case process.TypeConsolidate:
+		h.handleConsolidate(proc)
 	default:
 		log.Printf("Unknown process type: %s", proc.Type)
 	}
@@ -63,26 +96,116 @@ func (h *QueueHandler) handleBackup(proc *sharedProcess.Process) {
 	// Transform process to backup
 	backup := &repository.Backup{
 		ID:        proc.Args["id"].(string),
+		Strategy:  string(builder.BackupStrategyPhysical),
 		StartTime: proc.StartTime,
 		EndTime:   proc.EndTime,
 		ProcessID: *proc.ID,
+		Source:    h.config.Source,
 	}
 
+	backup.Type = repository.TypeFull
 	if fromBackupID, ok := proc.Args["from_backup_id"].(string); ok && fromBackupID != "" {
 		backup.FromBackupID = &fromBackupID
+		backup.Type = repository.TypeIncremental
+	}
+
+	backup.ScheduleID = sharedProcess.ScheduleIDArg(proc.Args)
+
+	if strategy, ok := proc.Args["strategy"].(string); ok && strategy != "" {
+		backup.Strategy = strategy
+	}
+	if description, ok := proc.Args["description"].(string); ok && description != "" {
+		backup.Description = &description
+	}
+
+	switch excluded := proc.Args["excluded_databases"].(type) {
+	case []string:
+		backup.ExcludedDatabases = excluded
+	case []interface{}:
+		for _, item := range excluded {
+			if name, ok := item.(string); ok {
+				backup.ExcludedDatabases = append(backup.ExcludedDatabases, name)
+			}
+		}
+	}
+
+	// The backup command captured the grants after the backup, when they could be
+	backup.GrantsCaptured = adapter.HasGrants(h.config, backup.ID)
+
+	if err := adapter.ApplyBackupMode(h.config, backup.ID); err != nil {
+		log.Printf("Warning: failed to set permissions of backup %s: %v", backup.ID, err)
 	}
 
-	if scheduleID, ok := proc.Args["schedule_id"].(float64); ok && scheduleID > 0 {
-		sid := int(scheduleID)
-		backup.ScheduleID = &sid
+	// A backup that may not be on disk is failed rather than recorded
+	if h.config.SyncBackups {
+		if err := h.syncBackup(h.config, backup.ID); err != nil {
+			log.Printf("Failed to sync backup %s to disk: %v", backup.ID, err)
+			h.failProcess(proc, fmt.Sprintf("failed to sync backup to disk: %v", err))
+			h.cleanupFailedProcess(proc)
+			return
+		}
 	}
 
+	backup.Size, backup.UncompressedSize = adapter.BackupSizes(h.config, backup.ID, backup.Strategy,
+		backup.Type == repository.TypeIncremental, backup.ExcludedDatabases)
+
 	// Save to database
-	err := h.backupRepo.Create(backup)
-	if err != nil {
-		log.Printf("Failed to create backup record: %v", err)
+	if !h.recordBackup(backup) {
+		return
+	}
+	log.Printf("Backup created successfully: %s", backup.ID)
+
+	if verify, _ := proc.Args["verify"].(bool); verify {
+		h.verifyBackup(backup.ID)
+	}
+}
+
+// failProcess marks a process that exited successfully as failed, when what it wrote
+// can't be kept
+func (h *QueueHandler) failProcess(proc *sharedProcess.Process, errorMsg string) {
+	proc.Status = sharedProcess.StatusFailed
+	proc.Error = &errorMsg
+	if err := h.processWriter.UpdateProcessStatus(*proc.ID, proc.Status, proc.Output, proc.Error, proc.ReturnCode, proc.EndTime); err != nil {
+		log.Printf("Failed to mark process %d failed: %v", *proc.ID, err)
+	}
+}
+
+// verifyBackup chains a verification of the backup (and the chain it depends on)
+func (h *QueueHandler) verifyBackup(id string) {
+	idList, err := h.backupRepo.RequiredBackups(id)
+	if err == nil {
+		var procChan chan *sharedProcess.Process
+		_, procChan, err = h.adapter.VerifyBackup(idList)
+		if err == nil {
+			log.Printf("Verifying backup: %s", id)
+			h.Handle(procChan)
+			return
+		}
+	}
+
+	log.Printf("Failed to start verification of backup %s: %v", id, err)
+	if err := h.backupRepo.UpdateVerification(id, repository.VerificationFailed, time.Now()); err != nil {
+		log.Printf("Failed to record backup verification: %v", err)
+	}
+}
+
+func (h *QueueHandler) handleVerify(proc *sharedProcess.Process) {
+	id, _ := proc.Args["id"].(string)
+
+	status := repository.VerificationPassed
+	if proc.ReturnCode == nil || proc.Failed() {
+		status = repository.VerificationFailed
+		log.Printf("Verification of backup %s failed: %s", id, proc.Command)
 	} else {
-		log.Printf("Backup created successfully: %s", backup.ID)
+		log.Printf("Backup verified: %s", id)
+	}
+
+	if err := h.backupRepo.UpdateVerification(id, status, time.Now()); err != nil {
+		log.Printf("Failed to record backup verification: %v", err)
+	}
+
+	if tmpDir, ok := proc.Args["tmp_dir"].(string); ok && strings.HasPrefix(tmpDir, constants.TempVerifyPrefix) {
+		go h.removeTmpRestoreFolder(tmpDir)
 	}
 }
 
@@ -129,26 +252,224 @@ func (h *QueueHandler) handleRestore(proc *sharedProcess.Process) {
 		EndTime:    proc.EndTime,
 		Target:     proc.Args["target"].(string),
 		TargetPath: proc.Args["tmp_dir"].(string),
+		Mode:       string(builder.RestoreModePhysical),
 		BackupID:   backupID,
 		ProcessID:  *proc.ID,
 	}
 
+	if mode, ok := proc.Args["restore_mode"].(string); ok && mode != "" {
+		restore.Mode = mode
+	}
+	if safetyCopyPath, ok := proc.Args["safety_copy_path"].(string); ok {
+		restore.SafetyCopyPath = safetyCopyPath
+	}
+
+	switch databases := proc.Args["databases"].(type) {
+	case []string:
+		restore.Databases = databases
+	case []interface{}:
+		for _, item := range databases {
+			if name, ok := item.(string); ok {
+				restore.Databases = append(restore.Databases, name)
+			}
+		}
+	}
+
+	// A folder restore limited to databases drops the others once prepared
+	if restore.Target == string(builder.RestoreTargetFolder) && len(restore.Databases) > 0 {
+		if err := adapter.KeepDatabases(filepath.Join(restore.TargetPath, backupID), restore.Databases); err != nil {
+			log.Printf("Warning: failed to limit restore of %s to %v: %v", backupID, restore.Databases, err)
+		}
+	}
+
+	// An archived folder restore leaves only the archive of the prepared folder
+	if archive, _ := proc.Args["archive"].(bool); archive {
+		restore.Archive = true
+		restore.TargetPath = filepath.Join(restore.TargetPath, backupID+builder.ArchiveSuffix)
+	}
+
+	// The data is restored as of the latest backup's completion
 	if latestBackup != nil {
-		restore.BackupTimestamp = &latestBackup.StartTime
+		restore.BackupTimestamp = latestBackup.EndTime
+		if restore.BackupTimestamp == nil {
+			restore.BackupTimestamp = &latestBackup.StartTime
+		}
 	}
 
-	// Save to database
-	err = h.restoreRepo.Create(restore)
-	if err != nil {
+	// Save to database, unless the folder restore was a throwaway one
+	if record, ok := proc.Args["record"].(bool); ok && !record && restore.Target == string(builder.RestoreTargetFolder) {
+		log.Printf("Restore of backup %s to %s completed without a record", backupID, restore.TargetPath)
+	} else if err := h.restoreRepo.Create(restore); err != nil {
 		log.Printf("Failed to create restore record: %v", err)
 	} else {
 		log.Printf("Restore created successfully for backup: %s", backupID)
 	}
 
 	// Cleanup tmp folder for database restores
-	if restore.Target == string(builder.RestoreTargetDatabase) {
+	if restore.Target == string(builder.RestoreTargetDatabase) && restore.TargetPath != "" {
 		go h.removeTmpRestoreFolder(restore.TargetPath)
 	}
+
+	h.handleServerAfterRestore(proc, false)
+}
+
+// recordPhaseDurations adds the time a physical restore spent per phase to its process
+// args as phase_durations, including the phases of a restore that failed
+func (h *QueueHandler) recordPhaseDurations(proc *sharedProcess.Process) {
+	if len(proc.Steps) == 0 || proc.ID == nil {
+		return
+	}
+	proc.Args["phase_durations"] = adapter.RestorePhaseDurations(proc.Steps)
+	if err := h.processWriter.RecordOutcome(*proc.ID, proc.Args, nil); err != nil {
+		log.Printf("Failed to record restore phase durations: %v", err)
+	}
+}
+
+// Server actions recorded as server_action in a physical database restore's process args
+const (
+	serverActionStarted     = "started"
+	serverActionStartFailed = "start_failed"
+	serverActionKeptStopped = "kept_stopped"
+)
+
+// handleServerAfterRestore starts the database server after a physical database restore,
+// unless the restore failed and the policy keeps it stopped. A server kept stopped is
+// flagged in the process error, as it needs the operator to start it.
+func (h *QueueHandler) handleServerAfterRestore(proc *sharedProcess.Process, failed bool) {
+	target, _ := proc.Args["target"].(string)
+	mode, _ := proc.Args["restore_mode"].(string)
+	if proc.ID == nil || target != string(builder.RestoreTargetDatabase) || mode == string(builder.RestoreModeLogical) ||
+		mode == string(builder.RestoreModeGrants) {
+		return
+	}
+
+	var errorMsg *string
+	switch {
+	case failed && h.config.RestoreFailureServer != config.RestoreFailureStart:
+		proc.Args["server_action"] = serverActionKeptStopped
+		msg := "database server left stopped after the failed restore, check the data directory before starting it"
+		if safetyCopyPath, ok := proc.Args["safety_copy_path"].(string); ok {
+			msg += fmt.Sprintf(", its contents from before the restore are in %s", safetyCopyPath)
+		}
+		if proc.Error != nil && *proc.Error != "" {
+			msg = *proc.Error + "\n" + msg
+		}
+		errorMsg = &msg
+		log.Printf("Restore failed, leaving the database server stopped")
+	case len(h.config.ServerStartCommand) == 0:
+		return
+	default:
+		proc.Args["server_action"] = h.startServer()
+	}
+
+	if err := h.processWriter.RecordOutcome(*proc.ID, proc.Args, errorMsg); err != nil {
+		log.Printf("Failed to record server action for process %d: %v", *proc.ID, err)
+	}
+}
+
+// startServer runs the configured server start command, returning the server action
+func (h *QueueHandler) startServer() string {
+	command := h.config.ServerStartCommand
+	log.Printf("Starting the database server: %s", strings.Join(command, " "))
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		log.Printf("Failed to start the database server: %v: %s", err, strings.TrimSpace(string(output)))
+		return serverActionStartFailed
+	}
+	return serverActionStarted
+}
+
+// handleConsolidate moves the prepared chain into place as a new full backup. It takes
+// the times of the chain's latest backup, as that is the point in time it holds.
+func (h *QueueHandler) handleConsolidate(proc *sharedProcess.Process) {
+	id, _ := proc.Args["id"].(string)
+	tmpDir, _ := proc.Args["tmp_dir"].(string)
+	idList := idListArg(proc.Args)
+	if id == "" || tmpDir == "" || len(idList) == 0 {
+		log.Printf("Missing arguments in consolidate process args")
+		return
+	}
+	defer h.removeTmpRestoreFolder(tmpDir)
+
+	backupPath := filepath.Join(h.config.BackupDir, id)
+	if err := os.Rename(filepath.Join(tmpDir, idList[0]), backupPath); err != nil {
+		log.Printf("Failed to move consolidated backup %s into place: %v", id, err)
+		return
+	}
+
+	backup := &repository.Backup{
+		ID:         id,
+		Type:       repository.TypeFull,
+		Strategy:   string(builder.BackupStrategyPhysical),
+		ScheduleID: sharedProcess.ScheduleIDArg(proc.Args),
+		StartTime:  proc.StartTime,
+		EndTime:    proc.EndTime,
+		ProcessID:  *proc.ID,
+		Source:     h.config.Source,
+	}
+	if latest, err := h.backupRepo.Get(idList[len(idList)-1]); err == nil && latest != nil {
+		backup.StartTime = latest.StartTime
+		backup.EndTime = latest.EndTime
+	}
+	if err := adapter.ApplyBackupMode(h.config, id); err != nil {
+		log.Printf("Warning: failed to set permissions of backup %s: %v", id, err)
+	}
+	// The chain is only retired once the consolidated backup is safely on disk
+	if h.config.SyncBackups {
+		if err := h.syncBackup(h.config, id); err != nil {
+			log.Printf("Failed to sync consolidated backup %s to disk: %v", id, err)
+			h.failProcess(proc, fmt.Sprintf("failed to sync consolidated backup to disk: %v", err))
+			if err := os.RemoveAll(backupPath); err != nil {
+				log.Printf("Failed to remove consolidated backup: %v", err)
+			}
+			return
+		}
+	}
+	backup.Size, _ = adapter.BackupSizes(h.config, id, backup.Strategy, false, nil)
+
+	// The chain stays until the catalog has the backup replacing it
+	if !h.recordBackup(backup) {
+		return
+	}
+	log.Printf("Consolidated %d backups into full backup: %s", len(idList), id)
+
+	if retire, _ := proc.Args["retire"].(bool); retire {
+		h.retireChain(idList)
+	}
+}
+
+// retireChain removes a consolidated chain, newest first so an interruption never
+// leaves an incremental without its base
+func (h *QueueHandler) retireChain(idList []string) {
+	for i := len(idList) - 1; i >= 0; i-- {
+		for _, backupPath := range builder.BackupPaths(h.config, idList[i]) {
+			if err := os.RemoveAll(backupPath); err != nil {
+				log.Printf("Failed to remove retired backup %s: %v", backupPath, err)
+				return
+			}
+		}
+		if err := h.backupRepo.Delete(idList[i]); err != nil {
+			log.Printf("Failed to delete retired backup record %s: %v", idList[i], err)
+			return
+		}
+		log.Printf("Retired consolidated backup: %s", idList[i])
+	}
+}
+
+// idListArg reads the id_list process argument
+func idListArg(args map[string]interface{}) []string {
+	var idList []string
+	switch v := args["id_list"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				idList = append(idList, str)
+			}
+		}
+	case []string:
+		idList = v
+	}
+	return idList
 }
 
 func (h *QueueHandler) handleCleanupBackups(proc *sharedProcess.Process) {
@@ -157,14 +478,22 @@ func (h *QueueHandler) handleCleanupBackups(proc *sharedProcess.Process) {
 }
 
 func (h *QueueHandler) cleanupFailedProcess(proc *sharedProcess.Process) {
-	// For failed backups, cleanup the backup folder if it exists
+	// A failed consolidation leaves a partially prepared copy of the chain behind
+	if proc.Type == process.TypeConsolidate {
+		if id, ok := proc.Args["id"].(string); ok && id != "" {
+			h.removeTmpRestoreFolder(builder.ConsolidateDir(h.config, id))
+		}
+	}
+
+	// For failed backups, cleanup the backup folder or the truncated stream file
 	if proc.Type == process.TypeBackup {
 		if id, ok := proc.Args["id"].(string); ok {
-			backupPath := filepath.Join(h.config.BackupDir, id)
-			if _, err := os.Stat(backupPath); err == nil {
-				log.Printf("Removing failed backup folder: %s", backupPath)
-				if err := os.RemoveAll(backupPath); err != nil {
-					log.Printf("Failed to remove backup folder: %v", err)
+			for _, backupPath := range builder.BackupPaths(h.config, id) {
+				if _, err := os.Stat(backupPath); err == nil {
+					log.Printf("Removing failed backup: %s", backupPath)
+					if err := os.RemoveAll(backupPath); err != nil {
+						log.Printf("Failed to remove backup: %v", err)
+					}
 				}
 			}
 		}
@@ -177,3 +506,68 @@ func (h *QueueHandler) removeTmpRestoreFolder(tmpPath string) {
 		log.Printf("Failed to remove temporary restore folder: %v", err)
 	}
 }
+
+// ReapInterrupted fails the processes left running by a previous db-cmd (after a crash
+// or host reboot), since nothing is waiting on them anymore. Interrupted restores get
+// their partially prepared temp dir removed and are flagged resumable, so the operator
+// can re-trigger them from the same backups.
+func (h *QueueHandler) ReapInterrupted() error {
+	processes, err := h.processWriter.ListRunning(process.Types...)
+	if err != nil {
+		return err
+	}
+
+	for _, proc := range processes {
+		if proc.ID == nil {
+			continue
+		}
+		if sharedProcess.Alive(proc.PID, proc.Command) {
+			log.Printf("Process %d (%s) survived the restart, leaving it running", *proc.ID, proc.Type)
+			continue
+		}
+
+		if proc.Args == nil {
+			proc.Args = make(map[string]interface{})
+		}
+		proc.Args["interrupted"] = true
+		errorMsg := fmt.Sprintf("interrupted: db-cmd stopped before the %s process finished", proc.Type)
+
+		switch proc.Type {
+		case process.TypeRestore:
+			h.removeInterruptedTmpDir(proc)
+			proc.Args["resumable"] = true
+			errorMsg += ", re-trigger the restore to resume it"
+		case process.TypeVerifyBackup:
+			h.removeInterruptedTmpDir(proc)
+		case process.TypeBackup, process.TypeConsolidate:
+			h.cleanupFailedProcess(proc)
+		}
+
+		if err := h.processWriter.MarkInterrupted(*proc.ID, errorMsg, proc.Args, time.Now()); err != nil {
+			log.Printf("Failed to mark process %d interrupted: %v", *proc.ID, err)
+			continue
+		}
+		log.Printf("Marked interrupted %s process %d as failed", proc.Type, *proc.ID)
+	}
+
+	return nil
+}
+
+// removeInterruptedTmpDir removes the temp dir of an interrupted restore or verification,
+// but only when it is one of the directories db-cmd creates for them
+func (h *QueueHandler) removeInterruptedTmpDir(proc *sharedProcess.Process) {
+	tmpDir, _ := proc.Args["tmp_dir"].(string)
+	if tmpDir == "" {
+		return
+	}
+
+	restoresDir := filepath.Join(h.config.BackupDir, "restores") + string(filepath.Separator)
+	if !strings.HasPrefix(tmpDir, constants.TempRestorePrefix) &&
+		!strings.HasPrefix(tmpDir, constants.TempVerifyPrefix) &&
+		!strings.HasPrefix(filepath.Clean(tmpDir), restoresDir) {
+		log.Printf("Not removing unexpected temporary directory of interrupted process: %s", tmpDir)
+		return
+	}
+
+	h.removeTmpRestoreFolder(tmpDir)
+}
@@ -0,0 +1,949 @@
+package handler
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/adapter"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/process"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/repository"
+	"github.com/martijn/dbcalm/shared/database"
+	sharedProcess "github.com/martijn/dbcalm/shared/process"
+)
+
+// catalogSchema is the app's schema of the catalog tables db-cmd writes to, so the tests
+// hit the same NOT NULL columns and defaults as a real catalog
+const catalogSchema = `
+CREATE TABLE process (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	command_id TEXT NOT NULL,
+	command TEXT NOT NULL,
+	pid INTEGER,
+	status TEXT NOT NULL,
+	output TEXT,
+	error TEXT,
+	return_code INTEGER,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME,
+	type TEXT NOT NULL,
+	args TEXT NOT NULL,
+	progress INTEGER,
+	phase TEXT,
+	schedule_id INTEGER,
+	retry_of TEXT
+);
+
+CREATE TABLE backup (
+	id TEXT PRIMARY KEY,
+	type TEXT,
+	from_backup_id TEXT,
+	schedule_id INTEGER,
+	strategy TEXT NOT NULL DEFAULT 'physical',
+	excluded_databases TEXT,
+	verification_status TEXT,
+	last_verified_at DATETIME,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME,
+	process_id INTEGER NOT NULL,
+	size INTEGER,
+	uncompressed_size INTEGER,
+	description TEXT,
+	source TEXT,
+	expires_at DATETIME,
+	grants_captured INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (from_backup_id) REFERENCES backup(id) ON DELETE CASCADE,
+	FOREIGN KEY (process_id) REFERENCES process(id) ON DELETE CASCADE
+);
+
+CREATE TABLE restore (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	backup_id TEXT NOT NULL,
+	backup_timestamp DATETIME NOT NULL,
+	target TEXT NOT NULL,
+	target_path TEXT NOT NULL,
+	archive INTEGER NOT NULL DEFAULT 0,
+	mode TEXT NOT NULL DEFAULT 'physical',
+	databases TEXT,
+	safety_copy_path TEXT,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME,
+	process_id INTEGER NOT NULL,
+	FOREIGN KEY (backup_id) REFERENCES backup(id) ON DELETE CASCADE,
+	FOREIGN KEY (process_id) REFERENCES process(id) ON DELETE CASCADE
+);
+`
+
+// newCatalog creates a catalog with the app's schema in dir, returning its path and
+// a connection that is closed with the test
+func newCatalog(t *testing.T, dir string) (string, *sql.DB) {
+	t.Helper()
+	dbPath := filepath.Join(dir, "db.sqlite3")
+	db, err := database.OpenDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(catalogSchema); err != nil {
+		t.Fatalf("failed to create catalog: %v", err)
+	}
+	return dbPath, db
+}
+
+func TestVerifyFailureFlagsBackup(t *testing.T) {
+	tests := []struct {
+		name       string
+		returnCode int
+		expected   string
+	}{
+		{name: "failed verification", returnCode: 1, expected: "failed"},
+		{name: "passed verification", returnCode: 0, expected: "passed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath, db := newCatalog(t, t.TempDir())
+
+			if _, err := db.Exec(`INSERT INTO backup (id, start_time, process_id) VALUES ('20250101-000000', CURRENT_TIMESTAMP, 1)`); err != nil {
+				t.Fatalf("failed to seed catalog: %v", err)
+			}
+
+			h := NewQueueHandler(&config.Config{DatabasePath: dbPath}, nil)
+			h.handleProcess(&sharedProcess.Process{
+				Type:       process.TypeVerifyBackup,
+				ReturnCode: &tt.returnCode,
+				Args:       map[string]interface{}{"id": "20250101-000000", "tmp_dir": ""},
+			})
+
+			var status string
+			var verifiedAt time.Time
+			if err := db.QueryRow(`SELECT verification_status, last_verified_at FROM backup WHERE id = '20250101-000000'`).Scan(&status, &verifiedAt); err != nil {
+				t.Fatalf("failed to read backup: %v", err)
+			}
+			if status != tt.expected {
+				t.Errorf("expected verification_status %s, got %s", tt.expected, status)
+			}
+			if verifiedAt.IsZero() {
+				t.Errorf("expected last_verified_at to be set")
+			}
+		})
+	}
+}
+
+func TestReapInterruptedRestore(t *testing.T) {
+	backupDir := t.TempDir()
+	dbPath, db := newCatalog(t, t.TempDir())
+
+	// A restore interrupted halfway through preparing its chain
+	tmpDir := filepath.Join(backupDir, "restores", "2025-01-01-00-00-00")
+	if err := os.MkdirAll(filepath.Join(tmpDir, "20250101-000000"), 0755); err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	args, _ := json.Marshal(map[string]interface{}{"id_list": []string{"20250101-000000"}, "target": "folder", "tmp_dir": tmpDir})
+	insert := `INSERT INTO process (command, command_id, pid, status, start_time, type, args) VALUES (?, ?, ?, 'running', ?, ?, ?)`
+	if _, err := db.Exec(insert, "mariabackup --prepare", "restore-1", 999999999, time.Now(), process.TypeRestore, string(args)); err != nil {
+		t.Fatalf("failed to seed restore: %v", err)
+	}
+	// A process that is still alive is left alone
+	if _, err := db.Exec(insert, os.Args[0]+" -test.run", "alive-1", os.Getpid(), time.Now(), process.TypeBackup, "{}"); err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+	// cmd's processes are left to cmd
+	if _, err := db.Exec(insert, "rm -rf /var/backups/old", "cleanup-1", 999999999, time.Now(), process.TypeCleanupBackups, "{}"); err != nil {
+		t.Fatalf("failed to seed cleanup: %v", err)
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath, BackupDir: backupDir}, nil)
+	if err := h.ReapInterrupted(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(tmpDir); !os.IsNotExist(err) {
+		t.Errorf("expected the temp dir to be removed, got %v", err)
+	}
+
+	restore, err := sharedProcess.NewWriter(dbPath).GetProcessByCommandID("restore-1")
+	if err != nil {
+		t.Fatalf("failed to read restore: %v", err)
+	}
+	if restore.Status != sharedProcess.StatusFailed {
+		t.Errorf("expected status failed, got %s", restore.Status)
+	}
+	if restore.Error == nil || !strings.Contains(*restore.Error, "interrupted") {
+		t.Errorf("expected an interrupted error, got %v", restore.Error)
+	}
+	if resumable, _ := restore.Args["resumable"].(bool); !resumable {
+		t.Errorf("expected the restore to be flagged resumable, got args %v", restore.Args)
+	}
+
+	alive, err := sharedProcess.NewWriter(dbPath).GetProcessByCommandID("alive-1")
+	if err != nil {
+		t.Fatalf("failed to read process: %v", err)
+	}
+	if alive.Status != sharedProcess.StatusRunning {
+		t.Errorf("expected the live process to stay running, got %s", alive.Status)
+	}
+	cleanup, err := sharedProcess.NewWriter(dbPath).GetProcessByCommandID("cleanup-1")
+	if err != nil {
+		t.Fatalf("failed to read process: %v", err)
+	}
+	if cleanup.Status != sharedProcess.StatusRunning {
+		t.Errorf("expected cmd's process to stay running, got %s", cleanup.Status)
+	}
+
+	// A process that finished meanwhile keeps its outcome
+	if err := sharedProcess.NewWriter(dbPath).MarkInterrupted(*restore.ID, "interrupted", nil, time.Now()); err == nil {
+		t.Error("expected marking a finished process interrupted to fail")
+	}
+}
+
+func TestRestoreRecordsChainCompletionAsBackupTimestamp(t *testing.T) {
+	dbPath, db := newCatalog(t, t.TempDir())
+
+	fullStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	incrStart := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	incrEnd := incrStart.Add(25 * time.Minute)
+	insert := `INSERT INTO backup (id, from_backup_id, start_time, end_time, process_id) VALUES (?, ?, ?, ?, 1)`
+	if _, err := db.Exec(insert, "full", nil, fullStart, fullStart.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+	if _, err := db.Exec(insert, "incr", "full", incrStart, incrEnd); err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath}, nil)
+	processID := 7
+	returnCode := 0
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeRestore,
+		ReturnCode: &returnCode,
+		StartTime:  time.Now(),
+		Args:       map[string]interface{}{"id_list": []string{"full", "incr"}, "target": "folder", "tmp_dir": "/var/backups/restores/x"},
+	})
+
+	var backupTimestamp time.Time
+	if err := db.QueryRow(`SELECT backup_timestamp FROM restore WHERE process_id = 7`).Scan(&backupTimestamp); err != nil {
+		t.Fatalf("failed to read restore: %v", err)
+	}
+	if !backupTimestamp.Equal(incrEnd) {
+		t.Errorf("expected backup_timestamp %v (the latest backup's end), got %v", incrEnd, backupTimestamp)
+	}
+}
+
+func TestFolderRestoreWithoutRecord(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	if _, err := db.Exec(`INSERT INTO backup (id, start_time, end_time, process_id) VALUES ('full', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1)`); err != nil {
+		t.Fatalf("failed to seed catalog: %v", err)
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath}, nil)
+	returnCode := 0
+	restore := func(processID int, args map[string]interface{}) {
+		args["id_list"] = []string{"full"}
+		args["tmp_dir"] = filepath.Join(dir, "restores", "x")
+		h.handleProcess(&sharedProcess.Process{
+			ID:         &processID,
+			Type:       process.TypeRestore,
+			ReturnCode: &returnCode,
+			StartTime:  time.Now(),
+			Args:       args,
+		})
+	}
+	recorded := func(processID int) bool {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM restore WHERE process_id = ?`, processID).Scan(&count); err != nil {
+			t.Fatalf("failed to count restores: %v", err)
+		}
+		return count > 0
+	}
+
+	restore(1, map[string]interface{}{"target": "folder", "record": false})
+	if recorded(1) {
+		t.Error("expected no restore record for a folder restore with record=false")
+	}
+	restore(2, map[string]interface{}{"target": "folder"})
+	if !recorded(2) {
+		t.Error("expected folder restores to be recorded by default")
+	}
+	// Database restores are always recorded
+	restore(3, map[string]interface{}{"target": "database", "record": false})
+	if !recorded(3) {
+		t.Error("expected a database restore to be recorded regardless of record")
+	}
+}
+
+func TestBackupRecordsCompressedAndUncompressedSize(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	// A logical backup's dump, compressible content so the sizes differ
+	backupDir := filepath.Join(dir, "backups")
+	if err := os.MkdirAll(filepath.Join(backupDir, "dump-1"), 0755); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+	dump, err := os.Create(filepath.Join(backupDir, "dump-1", builder.DumpFileName))
+	if err != nil {
+		t.Fatalf("failed to create dump: %v", err)
+	}
+	content := strings.Repeat("INSERT INTO t VALUES (1);\n", 1000)
+	zw := gzip.NewWriter(dump)
+	zw.Write([]byte(content))
+	zw.Close()
+	dump.Close()
+
+	// The dump's size is counted by dd as it is taken
+	count := exec.Command("sh", "-c", "dd bs=1M 2> "+filepath.Join(backupDir, "dump-1", builder.DumpSizeFileName)+" > /dev/null")
+	count.Stdin = strings.NewReader(content)
+	if err := count.Run(); err != nil {
+		t.Fatalf("failed to count dump: %v", err)
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath, BackupDir: backupDir}, nil)
+	processID := 3
+	returnCode := 0
+	endTime := time.Now()
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeBackup,
+		ReturnCode: &returnCode,
+		StartTime:  endTime.Add(-time.Minute),
+		EndTime:    &endTime,
+		Args:       map[string]interface{}{"id": "dump-1", "strategy": "logical"},
+	})
+
+	var size, uncompressed int64
+	if err := db.QueryRow(`SELECT size, uncompressed_size FROM backup WHERE id = 'dump-1'`).Scan(&size, &uncompressed); err != nil {
+		t.Fatalf("failed to read backup: %v", err)
+	}
+	info, _ := os.Stat(filepath.Join(backupDir, "dump-1", builder.DumpFileName))
+	if size != info.Size() {
+		t.Errorf("expected size %d, got %d", info.Size(), size)
+	}
+	if uncompressed != int64(len(content)) {
+		t.Errorf("expected uncompressed size %d, got %d", len(content), uncompressed)
+	}
+}
+
+func TestBackupAppliesConfiguredMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+	}{
+		{name: "backup folder"},
+		{name: "stream file", stream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath, _ := newCatalog(t, dir)
+
+			backupDir := filepath.Join(dir, "backups")
+			cfg := &config.Config{
+				DatabasePath:   dbPath,
+				BackupDir:      backupDir,
+				Stream:         tt.stream,
+				BackupFileMode: 0640,
+				BackupDirMode:  0750,
+			}
+
+			// Created the way a permissive umask would leave them
+			var files, dirs []string
+			if tt.stream {
+				if err := os.MkdirAll(backupDir, 0755); err != nil {
+					t.Fatalf("failed to create backup dir: %v", err)
+				}
+				files = append(files, builder.StreamFile(cfg, "full-1"))
+			} else {
+				dirs = append(dirs, filepath.Join(backupDir, "full-1"), filepath.Join(backupDir, "full-1", "mysql"))
+				files = append(files, filepath.Join(backupDir, "full-1", "ibdata1"), filepath.Join(backupDir, "full-1", "mysql", "user.frm"))
+				if err := os.MkdirAll(dirs[1], 0777); err != nil {
+					t.Fatalf("failed to create backup dir: %v", err)
+				}
+			}
+			for _, file := range files {
+				if err := os.WriteFile(file, []byte("data"), 0666); err != nil {
+					t.Fatalf("failed to create backup file: %v", err)
+				}
+				os.Chmod(file, 0666)
+			}
+			for _, d := range dirs {
+				os.Chmod(d, 0777)
+			}
+
+			h := NewQueueHandler(cfg, nil)
+			processID := 4
+			returnCode := 0
+			endTime := time.Now()
+			h.handleProcess(&sharedProcess.Process{
+				ID:         &processID,
+				Type:       process.TypeBackup,
+				ReturnCode: &returnCode,
+				StartTime:  endTime.Add(-time.Minute),
+				EndTime:    &endTime,
+				Args:       map[string]interface{}{"id": "full-1"},
+			})
+
+			for _, file := range files {
+				info, err := os.Stat(file)
+				if err != nil {
+					t.Fatalf("failed to stat %s: %v", file, err)
+				}
+				if info.Mode().Perm() != 0640 {
+					t.Errorf("expected %s to have mode 0640, got %04o", file, info.Mode().Perm())
+				}
+			}
+			for _, d := range dirs {
+				info, err := os.Stat(d)
+				if err != nil {
+					t.Fatalf("failed to stat %s: %v", d, err)
+				}
+				if info.Mode().Perm() != 0750 {
+					t.Errorf("expected %s to have mode 0750, got %04o", d, info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestBackupSyncedBeforeRecording(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	backupDir := filepath.Join(dir, "backups")
+	for _, id := range []string{"full-1", "full-2", "full-3"} {
+		if err := os.MkdirAll(filepath.Join(backupDir, id, "mysql"), 0755); err != nil {
+			t.Fatalf("failed to create backup dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(backupDir, id, "mysql", "user.frm"), []byte("data"), 0644); err != nil {
+			t.Fatalf("failed to create backup file: %v", err)
+		}
+	}
+
+	cfg := &config.Config{DatabasePath: dbPath, BackupDir: backupDir, SyncBackups: true}
+	h := NewQueueHandler(cfg, nil)
+	var synced []string
+	var syncErr error
+	h.syncBackup = func(cfg *config.Config, id string) error {
+		// Recorded backups must not be in the catalog yet when they are synced
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM backup WHERE id = ?`, id).Scan(&count)
+		if count != 0 {
+			t.Errorf("expected %s to be synced before it is recorded", id)
+		}
+		synced = append(synced, id)
+		if syncErr != nil {
+			return syncErr
+		}
+		return adapter.SyncBackup(cfg, id)
+	}
+
+	run := func(id string) int {
+		result, err := db.Exec(`INSERT INTO process (command, command_id, pid, status, start_time, type, args) VALUES ('mariabackup --backup', ?, 0, 'success', ?, 'backup', '{}')`, id, time.Now())
+		if err != nil {
+			t.Fatalf("failed to seed process: %v", err)
+		}
+		processID64, _ := result.LastInsertId()
+		processID := int(processID64)
+		returnCode := 0
+		endTime := time.Now()
+		h.handleProcess(&sharedProcess.Process{
+			ID:         &processID,
+			Type:       process.TypeBackup,
+			Status:     sharedProcess.StatusSuccess,
+			ReturnCode: &returnCode,
+			StartTime:  endTime.Add(-time.Minute),
+			EndTime:    &endTime,
+			Args:       map[string]interface{}{"id": id},
+		})
+		return processID
+	}
+	recorded := func(id string) bool {
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM backup WHERE id = ?`, id).Scan(&count)
+		return count == 1
+	}
+
+	run("full-1")
+	if len(synced) != 1 || synced[0] != "full-1" || !recorded("full-1") {
+		t.Fatalf("expected full-1 to be synced and recorded, synced %v", synced)
+	}
+
+	// A backup that can't be synced is failed and removed instead of recorded
+	syncErr = syscall.EIO
+	processID := run("full-2")
+	if recorded("full-2") {
+		t.Error("expected full-2 not to be recorded")
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "full-2")); !os.IsNotExist(err) {
+		t.Errorf("expected full-2 to be removed, got %v", err)
+	}
+	var status, errorMsg string
+	if err := db.QueryRow(`SELECT status, error FROM process WHERE id = ?`, processID).Scan(&status, &errorMsg); err != nil {
+		t.Fatalf("failed to read process: %v", err)
+	}
+	if status != sharedProcess.StatusFailed || !strings.Contains(errorMsg, "sync") {
+		t.Errorf("expected the process to fail with a sync error, got %s: %s", status, errorMsg)
+	}
+
+	// With sync_backups off backups are recorded without syncing
+	cfg.SyncBackups = false
+	syncErr = nil
+	run("full-3")
+	if len(synced) != 2 || !recorded("full-3") {
+		t.Errorf("expected full-3 to be recorded without a sync, synced %v", synced)
+	}
+}
+
+func TestBackupRecordsCapturedGrants(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	// The backup command captured the grants of full-1, full-2's capture failed
+	backupDir := filepath.Join(dir, "backups")
+	for _, id := range []string{"full-1", "full-2"} {
+		if err := os.MkdirAll(filepath.Join(backupDir, id, "mysql"), 0755); err != nil {
+			t.Fatalf("failed to create backup dir: %v", err)
+		}
+	}
+	grants := "CREATE USER IF NOT EXISTS `app`@`%`;\nGRANT SELECT ON `shop`.* TO `app`@`%`;\n"
+	if err := os.WriteFile(filepath.Join(backupDir, "full-1", builder.GrantsFileName), []byte(grants), 0600); err != nil {
+		t.Fatalf("failed to write grants: %v", err)
+	}
+
+	cfg := &config.Config{DatabasePath: dbPath, BackupDir: backupDir, CaptureGrants: true}
+	h := NewQueueHandler(cfg, nil)
+	for _, id := range []string{"full-1", "full-2"} {
+		processID := 1
+		returnCode := 0
+		endTime := time.Now()
+		h.handleProcess(&sharedProcess.Process{
+			ID:         &processID,
+			Type:       process.TypeBackup,
+			Status:     sharedProcess.StatusSuccess,
+			ReturnCode: &returnCode,
+			StartTime:  endTime.Add(-time.Minute),
+			EndTime:    &endTime,
+			Args:       map[string]interface{}{"id": id},
+		})
+	}
+
+	for id, expected := range map[string]bool{"full-1": true, "full-2": false} {
+		var captured bool
+		if err := db.QueryRow(`SELECT grants_captured FROM backup WHERE id = ?`, id).Scan(&captured); err != nil {
+			t.Fatalf("expected %s to be recorded: %v", id, err)
+		}
+		if captured != expected {
+			t.Errorf("expected %s recorded with grants_captured %v, got %v", id, expected, captured)
+		}
+	}
+}
+
+func TestBackupKeptWhenCatalogWriteFails(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	backupDir := filepath.Join(dir, "backups")
+	if err := os.MkdirAll(filepath.Join(backupDir, "full-1"), 0755); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+
+	cfg := &config.Config{DatabasePath: dbPath, BackupDir: backupDir, StatusUpdateAttempts: 3, StatusUpdateBackoff: time.Millisecond}
+	h := NewQueueHandler(cfg, nil)
+	attempts := 0
+	h.createBackup = func(backup *repository.Backup) error {
+		attempts++
+		return errors.New("database is locked")
+	}
+
+	processID := 7
+	returnCode := 0
+	endTime := time.Now()
+	description := "before the migration"
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeBackup,
+		Status:     sharedProcess.StatusSuccess,
+		ReturnCode: &returnCode,
+		StartTime:  endTime.Add(-time.Minute),
+		EndTime:    &endTime,
+		Args:       map[string]interface{}{"id": "full-1", "description": description},
+	})
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts to record the backup, got %d", attempts)
+	}
+	kept, err := os.ReadFile(cfg.BackupFallbackFile())
+	if err != nil {
+		t.Fatalf("expected the backup to be kept for later: %v", err)
+	}
+	if !strings.Contains(string(kept), `"ID":"full-1"`) {
+		t.Errorf("expected full-1 in the fallback file, got %s", kept)
+	}
+
+	// The next start records it once the catalog takes writes again
+	h = NewQueueHandler(cfg, nil)
+	written, err := h.ReconcileBackups()
+	if err != nil || written != 1 {
+		t.Fatalf("expected 1 kept backup recorded, got %d (%v)", written, err)
+	}
+	var recordedProcess int
+	var recordedDescription string
+	if err := db.QueryRow(`SELECT process_id, description FROM backup WHERE id = 'full-1'`).Scan(&recordedProcess, &recordedDescription); err != nil {
+		t.Fatalf("expected full-1 in the catalog: %v", err)
+	}
+	if recordedProcess != processID || recordedDescription != description {
+		t.Errorf("expected full-1 recorded as taken, got process %d and description %q", recordedProcess, recordedDescription)
+	}
+	if _, err := os.Stat(cfg.BackupFallbackFile()); !os.IsNotExist(err) {
+		t.Errorf("expected the fallback file to be removed, got %v", err)
+	}
+}
+
+func TestStreamedBackupOwnerAndCleanup(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("no current user: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		returnCode int
+	}{
+		{name: "successful backup is registered with mode and owner"},
+		{name: "failed backup leaves no stream file", returnCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath, db := newCatalog(t, dir)
+
+			backupDir := filepath.Join(dir, "backups")
+			if err := os.MkdirAll(backupDir, 0755); err != nil {
+				t.Fatalf("failed to create backup dir: %v", err)
+			}
+			cfg := &config.Config{
+				DatabasePath:   dbPath,
+				BackupDir:      backupDir,
+				Stream:         true,
+				Compression:    "zstd",
+				BackupFileMode: 0640,
+				BackupDirMode:  0750,
+				BackupOwner:    current.Username,
+			}
+			streamFile := builder.StreamFile(cfg, "full-1")
+			if err := os.WriteFile(streamFile, []byte("stream"), 0666); err != nil {
+				t.Fatalf("failed to create stream file: %v", err)
+			}
+			os.Chmod(streamFile, 0666)
+
+			h := NewQueueHandler(cfg, nil)
+			processID := 5
+			returnCode := tt.returnCode
+			endTime := time.Now()
+			h.handleProcess(&sharedProcess.Process{
+				ID:         &processID,
+				Type:       process.TypeBackup,
+				ReturnCode: &returnCode,
+				StartTime:  endTime.Add(-time.Minute),
+				EndTime:    &endTime,
+				Args:       map[string]interface{}{"id": "full-1"},
+			})
+
+			var size int64
+			err = db.QueryRow(`SELECT size FROM backup WHERE id = 'full-1'`).Scan(&size)
+			info, statErr := os.Stat(streamFile)
+
+			if tt.returnCode != 0 {
+				if err == nil {
+					t.Errorf("expected no backup record for a failed backup")
+				}
+				if !os.IsNotExist(statErr) {
+					t.Errorf("expected the truncated stream file to be removed, got %v", statErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected the streamed backup to be registered: %v", err)
+			}
+			if statErr != nil {
+				t.Fatalf("failed to stat stream file: %v", statErr)
+			}
+			if size != info.Size() {
+				t.Errorf("expected size %d, got %d", info.Size(), size)
+			}
+			if info.Mode().Perm() != 0640 {
+				t.Errorf("expected mode 0640, got %04o", info.Mode().Perm())
+			}
+			stat := info.Sys().(*syscall.Stat_t)
+			if strconv.FormatUint(uint64(stat.Uid), 10) != current.Uid || strconv.FormatUint(uint64(stat.Gid), 10) != current.Gid {
+				t.Errorf("expected owner %s:%s, got %d:%d", current.Uid, current.Gid, stat.Uid, stat.Gid)
+			}
+		})
+	}
+}
+
+func TestConsolidateReplacesRetiredChain(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	incrStart := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	insert := `INSERT INTO backup (id, type, from_backup_id, start_time, end_time, process_id) VALUES (?, ?, ?, ?, ?, 1)`
+	if _, err := db.Exec(insert, "full", "full", nil, incrStart.Add(-24*time.Hour), incrStart.Add(-23*time.Hour)); err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+	if _, err := db.Exec(insert, "incr", "incremental", "full", incrStart, incrStart.Add(time.Minute)); err != nil {
+		t.Fatalf("failed to seed backup: %v", err)
+	}
+
+	backupDir := filepath.Join(dir, "backups")
+	cfg := &config.Config{DatabasePath: dbPath, BackupDir: backupDir}
+	for _, id := range []string{"full", "incr"} {
+		if err := os.MkdirAll(filepath.Join(backupDir, id), 0755); err != nil {
+			t.Fatalf("failed to create backup dir: %v", err)
+		}
+	}
+	// The chain as the consolidate commands leave it, prepared in the full backup's copy
+	tmpDir := builder.ConsolidateDir(cfg, "consolidated")
+	if err := os.MkdirAll(filepath.Join(tmpDir, "full"), 0755); err != nil {
+		t.Fatalf("failed to create consolidation dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "full", "ibdata1"), []byte("prepared"), 0644); err != nil {
+		t.Fatalf("failed to write prepared data: %v", err)
+	}
+
+	h := NewQueueHandler(cfg, nil)
+	processID := 9
+	returnCode := 0
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeConsolidate,
+		ReturnCode: &returnCode,
+		StartTime:  time.Now(),
+		Args: map[string]interface{}{
+			"id": "consolidated", "id_list": []interface{}{"full", "incr"}, "tmp_dir": tmpDir, "retire": true,
+		},
+	})
+
+	if content, err := os.ReadFile(filepath.Join(backupDir, "consolidated", "ibdata1")); err != nil || string(content) != "prepared" {
+		t.Fatalf("expected the prepared chain in the new backup's directory, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(tmpDir); !os.IsNotExist(err) {
+		t.Errorf("expected the consolidation dir to be removed, got %v", err)
+	}
+
+	var backupType string
+	var startTime time.Time
+	if err := db.QueryRow(`SELECT type, start_time FROM backup WHERE id = 'consolidated'`).Scan(&backupType, &startTime); err != nil {
+		t.Fatalf("failed to read consolidated backup: %v", err)
+	}
+	if backupType != "full" || !startTime.Equal(incrStart) {
+		t.Errorf("expected a full backup taking the incremental's start %v, got %s at %v", incrStart, backupType, startTime)
+	}
+
+	for _, id := range []string{"full", "incr"} {
+		if _, err := os.Stat(filepath.Join(backupDir, id)); !os.IsNotExist(err) {
+			t.Errorf("expected retired backup %s to be removed, got %v", id, err)
+		}
+		var count int
+		db.QueryRow(`SELECT COUNT(*) FROM backup WHERE id = ?`, id).Scan(&count)
+		if count != 0 {
+			t.Errorf("expected retired backup record %s to be deleted", id)
+		}
+	}
+}
+
+func TestFailedRestoreLeavesServerStopped(t *testing.T) {
+	tests := []struct {
+		name           string
+		restoreFailure string
+		returnCode     int
+		expectStarted  bool
+		expectAction   string
+	}{
+		{name: "failed restore keeps server stopped", restoreFailure: config.RestoreFailureKeepStopped, returnCode: 1, expectAction: "kept_stopped"},
+		{name: "failed restore starts server when configured", restoreFailure: config.RestoreFailureStart, returnCode: 1, expectStarted: true, expectAction: "started"},
+		{name: "successful restore starts server", restoreFailure: config.RestoreFailureKeepStopped, returnCode: 0, expectStarted: true, expectAction: "started"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath, db := newCatalog(t, dir)
+
+			if _, err := db.Exec(`
+				INSERT INTO process (id, command, command_id, pid, status, error, start_time, type, args)
+				VALUES (1, 'mariabackup --copy-back', 'restore-1', 0, 'failed', 'copy-back failed', CURRENT_TIMESTAMP, 'restore', '{}');
+				INSERT INTO backup (id, start_time, end_time, process_id) VALUES ('full', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1);
+			`); err != nil {
+				t.Fatalf("failed to seed catalog: %v", err)
+			}
+
+			// The start command leaves a marker instead of starting a server
+			marker := filepath.Join(dir, "started")
+			h := NewQueueHandler(&config.Config{
+				DatabasePath:         dbPath,
+				ServerStartCommand:   []string{"touch", marker},
+				RestoreFailureServer: tt.restoreFailure,
+			}, nil)
+			processID := 1
+			errorMsg := "copy-back failed"
+			h.handleProcess(&sharedProcess.Process{
+				ID:         &processID,
+				Type:       process.TypeRestore,
+				ReturnCode: &tt.returnCode,
+				Error:      &errorMsg,
+				StartTime:  time.Now(),
+				Args: map[string]interface{}{
+					"id_list": []string{"full"}, "target": "database", "tmp_dir": "", "restore_mode": "physical",
+				},
+			})
+
+			if _, err := os.Stat(marker); (err == nil) != tt.expectStarted {
+				t.Errorf("expected server started %v, got stat error %v", tt.expectStarted, err)
+			}
+
+			restore, err := sharedProcess.NewWriter(dbPath).GetProcessByCommandID("restore-1")
+			if err != nil {
+				t.Fatalf("failed to read restore: %v", err)
+			}
+			if restore.Args["server_action"] != tt.expectAction {
+				t.Errorf("expected server_action %s, got %v", tt.expectAction, restore.Args["server_action"])
+			}
+			flagged := restore.Error != nil && strings.Contains(*restore.Error, "left stopped")
+			if flagged != (tt.expectAction == "kept_stopped") {
+				t.Errorf("expected the error to flag the stopped server only when kept stopped, got %v", restore.Error)
+			}
+		})
+	}
+}
+
+func TestRestoreRecordsPhaseDurations(t *testing.T) {
+	dbPath, db := newCatalog(t, t.TempDir())
+
+	if _, err := db.Exec(`
+		INSERT INTO process (id, command, command_id, pid, status, start_time, type, args)
+		VALUES (1, 'mariabackup --prepare', 'restore-1', 0, 'success', CURRENT_TIMESTAMP, 'restore', '{}');
+		INSERT INTO backup (id, from_backup_id, start_time, end_time, process_id) VALUES
+			('full', NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1),
+			('incr-1', 'full', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1),
+			('incr-2', 'incr-1', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1);
+	`); err != nil {
+		t.Fatalf("failed to seed catalog: %v", err)
+	}
+
+	// A folder restore of a full backup and two incrementals, as BuildRestoreCmds writes it
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := func(command string, offset, seconds int) sharedProcess.Step {
+		begin := start.Add(time.Duration(offset) * time.Second)
+		return sharedProcess.Step{Command: command, StartTime: begin, EndTime: begin.Add(time.Duration(seconds) * time.Second)}
+	}
+	steps := []sharedProcess.Step{
+		step("cp -r /backups/full /restores", 0, 30),
+		step("mariabackup --prepare --target-dir=/restores/full --apply-log-only", 30, 20),
+		step("mariabackup --prepare --target-dir=/restores/full --incremental-dir=/backups/incr-1 --apply-log-only", 50, 5),
+		step("mariabackup --prepare --target-dir=/restores/full --incremental-dir=/backups/incr-2", 55, 7),
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath}, nil)
+	processID := 1
+	returnCode := 0
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeRestore,
+		ReturnCode: &returnCode,
+		StartTime:  start,
+		Steps:      steps,
+		Args: map[string]interface{}{
+			"id_list": []string{"full", "incr-1", "incr-2"}, "target": "folder", "tmp_dir": "/restores", "restore_mode": "physical",
+		},
+	})
+
+	restore, err := sharedProcess.NewWriter(dbPath).GetProcessByCommandID("restore-1")
+	if err != nil {
+		t.Fatalf("failed to read restore: %v", err)
+	}
+	durations, _ := restore.Args["phase_durations"].(map[string]interface{})
+	expected := map[string]float64{"copying": 30, "preparing": 20, "applying-incrementals": 12}
+	if len(durations) != len(expected) {
+		t.Fatalf("expected phase_durations %v, got %v", expected, restore.Args["phase_durations"])
+	}
+	for phase, seconds := range expected {
+		if durations[phase] != seconds {
+			t.Errorf("expected %s to take %vs, got %v", phase, seconds, durations[phase])
+		}
+	}
+}
+
+func TestFolderRestoreKeepsSelectedDatabases(t *testing.T) {
+	dir := t.TempDir()
+	dbPath, db := newCatalog(t, dir)
+
+	if _, err := db.Exec(`INSERT INTO backup (id, start_time, end_time, process_id) VALUES ('full', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 1)`); err != nil {
+		t.Fatalf("failed to seed catalog: %v", err)
+	}
+
+	// The prepared copy of the full backup
+	tmpDir := filepath.Join(dir, "restores")
+	prepared := filepath.Join(tmpDir, "full")
+	for _, name := range []string{"shop", "crm", "mysql"} {
+		if err := os.MkdirAll(filepath.Join(prepared, name), 0755); err != nil {
+			t.Fatalf("failed to create database dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(prepared, "ibdata1"), []byte("tablespace"), 0644); err != nil {
+		t.Fatalf("failed to write ibdata1: %v", err)
+	}
+
+	h := NewQueueHandler(&config.Config{DatabasePath: dbPath}, nil)
+	processID := 1
+	returnCode := 0
+	h.handleProcess(&sharedProcess.Process{
+		ID:         &processID,
+		Type:       process.TypeRestore,
+		ReturnCode: &returnCode,
+		StartTime:  time.Now(),
+		Args: map[string]interface{}{
+			"id_list": []string{"full"}, "target": "folder", "tmp_dir": tmpDir, "restore_mode": "physical",
+			"databases": []interface{}{"shop"},
+		},
+	})
+
+	entries, err := os.ReadDir(prepared)
+	if err != nil {
+		t.Fatalf("failed to read restored folder: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "ibdata1,shop" {
+		t.Errorf("expected only ibdata1 and shop to be kept, got %v", names)
+	}
+
+	var databases string
+	if err := db.QueryRow(`SELECT databases FROM restore`).Scan(&databases); err != nil {
+		t.Fatalf("failed to read restore: %v", err)
+	}
+	if databases != `["shop"]` {
+		t.Errorf("expected the selection to be recorded, got %s", databases)
+	}
+}
@@ -0,0 +1,161 @@
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is appended to the log file name on rotation, it sorts chronologically
+const rotatedTimeFormat = "20060102-150405.000"
+
+// RotatingFile is an append-only log file that is moved aside once it would grow past
+// maxSize. Rotated files beyond maxBackups or older than maxAge are removed, zero keeps
+// them all.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	now        func() time.Time
+}
+
+// Open opens (or creates) the log file at path for appending
+func Open(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetLimits changes the rotation limits, used once the configuration is loaded
+func (r *RotatingFile) SetLimits(maxSize int64, maxAge time.Duration, maxBackups int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxSize = maxSize
+	r.maxAge = maxAge
+	r.maxBackups = maxBackups
+}
+
+// Write appends p, rotating first when it would take the file past maxSize
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A file lost to a failed rotation is opened again
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	// A failed rotation is retried on the next write, p still goes to the reopened file
+	var rotateErr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if rotateErr = r.rotate(); r.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Close closes the current log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", r.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", r.path, err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file aside, starts a new one and removes expired rotations.
+// When the file can't be moved aside it is reopened, so logging carries on in it.
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return r.reopen(fmt.Errorf("failed to close log file %s: %w", r.path, err))
+	}
+
+	rotated := r.path + "." + r.now().Format(rotatedTimeFormat)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return r.reopen(fmt.Errorf("failed to rotate log file %s: %w", r.path, err))
+	}
+
+	if err := r.open(); err != nil {
+		r.file = nil
+		return err
+	}
+
+	r.prune()
+	return nil
+}
+
+// reopen opens the log file again after a failed rotation, returning the rotation's error
+func (r *RotatingFile) reopen(cause error) error {
+	if err := r.open(); err != nil {
+		r.file = nil
+		return errors.Join(cause, err)
+	}
+	return cause
+}
+
+// prune removes rotated files past maxBackups or maxAge, failures are left for the next rotation
+func (r *RotatingFile) prune() {
+	rotated, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+
+	// Newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	cutoff := r.now().Add(-r.maxAge)
+	for i, name := range rotated {
+		stamp, err := time.ParseInLocation(rotatedTimeFormat, strings.TrimPrefix(name, r.path+"."), time.Local)
+		if err != nil {
+			continue
+		}
+		if (r.maxBackups > 0 && i >= r.maxBackups) || (r.maxAge > 0 && stamp.Before(cutoff)) {
+			os.Remove(name)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatesAtSizeThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbcalm.log")
+	logFile, err := Open(path, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer logFile.Close()
+
+	clock := time.Date(2026, time.March, 10, 2, 0, 0, 0, time.Local)
+	logFile.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	write := func(line string) {
+		t.Helper()
+		if _, err := logFile.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	// Exactly at the threshold stays in the current file
+	write("12345")
+	write("67890")
+	if rotated, _ := filepath.Glob(path + ".*"); len(rotated) != 0 {
+		t.Fatalf("expected no rotation at the threshold, got %v", rotated)
+	}
+
+	// One byte past it rotates before writing
+	write("a")
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 rotated file, got %v", rotated)
+	}
+	if content, _ := os.ReadFile(rotated[0]); string(content) != "1234567890" {
+		t.Errorf("expected rotated file to hold the old content, got %q", content)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "a" {
+		t.Errorf("expected current file to hold the new write, got %q", content)
+	}
+
+	// Only maxBackups rotated files are kept, the oldest go first
+	for _, line := range []string{"bbbbbbbbbb", "cccccccccc", "dddddddddd"} {
+		write(line)
+	}
+	rotated, _ = filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", rotated)
+	}
+	for _, name := range rotated {
+		if content, _ := os.ReadFile(name); strings.HasPrefix(string(content), "1") || string(content) == "a" {
+			t.Errorf("expected the oldest rotations to be removed, %s still holds %q", name, content)
+		}
+	}
+}
+
+func TestFailedRotationKeepsLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbcalm.log")
+	logFile, err := Open(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer logFile.Close()
+
+	clock := time.Date(2026, time.March, 10, 2, 0, 0, 0, time.Local)
+	logFile.now = func() time.Time { return clock }
+
+	// A non-empty directory where the rotated file would go makes the rename fail
+	blocked := path + "." + clock.Format(rotatedTimeFormat)
+	if err := os.MkdirAll(filepath.Join(blocked, "keep"), 0755); err != nil {
+		t.Fatalf("failed to block rotation: %v", err)
+	}
+
+	if _, err := logFile.Write([]byte("1234567890")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := logFile.Write([]byte("a")); err == nil {
+		t.Error("expected the failed rotation to be reported")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "1234567890a" {
+		t.Errorf("expected writes to carry on in the original file, got %q", content)
+	}
+
+	// The next write rotates once the way is clear
+	os.RemoveAll(blocked)
+	if _, err := logFile.Write([]byte("b")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "b" {
+		t.Errorf("expected the retried rotation to start a new file, got %q", content)
+	}
+}
@@ -5,4 +5,10 @@ const (
 	TypeBackup         = "backup"
 	TypeRestore        = "restore"
 	TypeCleanupBackups = "cleanup_backups"
+	TypeVerifyBackup   = "verify_backup"
+	TypeConsolidate    = "consolidate_backup"
 )
+
+// Types are the process types db-cmd runs itself, the other types in the process
+// table belong to cmd
+var Types = []string{TypeBackup, TypeRestore, TypeVerifyBackup, TypeConsolidate}
@@ -2,19 +2,52 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/martijn/dbcalm/shared/database"
 )
 
+// Backup types stored on the backup record
+const (
+	TypeFull        = "full"
+	TypeIncremental = "incremental"
+)
+
+// Verification outcomes stored on the backup record
+const (
+	VerificationPassed = "passed"
+	VerificationFailed = "failed"
+)
+
 type Backup struct {
 	ID           string
+	Type         string
 	FromBackupID *string
 	ScheduleID   *int
+	Strategy     string
 	StartTime    time.Time
 	EndTime      *time.Time
 	ProcessID    int
+
+	// Description is the operator's note on why the backup was taken, nil without one
+	Description *string
+
+	// Source is the role of the server the backup was taken from, empty when not configured
+	Source string
+
+	// ExcludedDatabases records which databases the backup deliberately left out
+	ExcludedDatabases []string
+
+	// GrantsCaptured is set when grants.sql was captured with the backup, so restore_mode
+	// grants can apply it
+	GrantsCaptured bool
+
+	// Size is the space the backup takes in backup_dir, UncompressedSize what it holds
+	// before compression. Both are nil when they couldn't be measured.
+	Size             *int64
+	UncompressedSize *int64
 }
 
 type BackupRepository struct {
@@ -36,10 +69,24 @@ func (r *BackupRepository) Create(backup *Backup) error {
 	}
 	defer db.Close()
 
+	var excludedDatabases interface{}
+	if len(backup.ExcludedDatabases) > 0 {
+		data, err := json.Marshal(backup.ExcludedDatabases)
+		if err != nil {
+			return fmt.Errorf("failed to marshal excluded databases: %w", err)
+		}
+		excludedDatabases = string(data)
+	}
+
+	var source interface{}
+	if backup.Source != "" {
+		source = backup.Source
+	}
+
 	_, err = db.Exec(`
-		INSERT INTO backup (id, from_backup_id, schedule_id, start_time, end_time, process_id)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, backup.ID, backup.FromBackupID, backup.ScheduleID, backup.StartTime, backup.EndTime, backup.ProcessID)
+		INSERT INTO backup (id, type, from_backup_id, schedule_id, strategy, excluded_databases, start_time, end_time, process_id, size, uncompressed_size, description, source, grants_captured)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, backup.ID, backup.Type, backup.FromBackupID, backup.ScheduleID, backup.Strategy, excludedDatabases, backup.StartTime, backup.EndTime, backup.ProcessID, backup.Size, backup.UncompressedSize, backup.Description, source, backup.GrantsCaptured)
 
 	if err != nil {
 		return fmt.Errorf("failed to create backup: %w", err)
@@ -48,6 +95,39 @@ func (r *BackupRepository) Create(backup *Backup) error {
 	return nil
 }
 
+// Delete removes the backup record
+func (r *BackupRepository) Delete(id string) error {
+	db, err := r.getDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM backup WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateVerification records the outcome of verifying a backup
+func (r *BackupRepository) UpdateVerification(id, status string, verifiedAt time.Time) error {
+	db, err := r.getDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		UPDATE backup SET verification_status = ?, last_verified_at = ? WHERE id = ?
+	`, status, verifiedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update backup verification: %w", err)
+	}
+
+	return nil
+}
+
 func (r *BackupRepository) Get(id string) (*Backup, error) {
 	db, err := r.getDB()
 	if err != nil {
@@ -89,9 +169,15 @@ func (r *BackupRepository) Get(id string) (*Backup, error) {
 
 func (r *BackupRepository) RequiredBackups(backupID string) ([]string, error) {
 	var required []string
+	visited := make(map[string]bool)
 	current := backupID
 
 	for current != "" {
+		if visited[current] {
+			return nil, fmt.Errorf("circular backup chain: %s leads back to %s", backupID, current)
+		}
+		visited[current] = true
+
 		backup, err := r.Get(current)
 		if err != nil {
 			return nil, err
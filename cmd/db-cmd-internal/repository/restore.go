@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -14,6 +15,10 @@ type Restore struct {
 	EndTime         *time.Time
 	Target          string
 	TargetPath      string
+	Archive         bool // TargetPath is a tar.zst archive of the prepared folder
+	Mode            string
+	Databases       []string // The databases the restore was limited to, nil for all
+	SafetyCopyPath  string   // Copy of the data dir taken before a database restore, empty when none was
 	BackupID        string
 	BackupTimestamp *time.Time
 	ProcessID       int
@@ -38,10 +43,24 @@ func (r *RestoreRepository) Create(restore *Restore) error {
 	}
 	defer db.Close()
 
+	var databases interface{}
+	if len(restore.Databases) > 0 {
+		data, err := json.Marshal(restore.Databases)
+		if err != nil {
+			return fmt.Errorf("failed to marshal databases: %w", err)
+		}
+		databases = string(data)
+	}
+
+	var safetyCopyPath interface{}
+	if restore.SafetyCopyPath != "" {
+		safetyCopyPath = restore.SafetyCopyPath
+	}
+
 	_, err = db.Exec(`
-		INSERT INTO restore (start_time, end_time, target, target_path, backup_id, backup_timestamp, process_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, restore.StartTime, restore.EndTime, restore.Target, restore.TargetPath, restore.BackupID, restore.BackupTimestamp, restore.ProcessID)
+		INSERT INTO restore (start_time, end_time, target, target_path, archive, mode, databases, safety_copy_path, backup_id, backup_timestamp, process_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, restore.StartTime, restore.EndTime, restore.Target, restore.TargetPath, restore.Archive, restore.Mode, databases, safetyCopyPath, restore.BackupID, restore.BackupTimestamp, restore.ProcessID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create restore: %w", err)
@@ -0,0 +1,177 @@
+package serverinfo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+// Info describes the database server db-cmd operates on
+type Info struct {
+	DbType          string
+	Version         builder.Version
+	DumpAvailable   bool
+	ClientAvailable bool
+	DetectedAt      time.Time
+}
+
+// Data returns the info in the shape sent back over the socket
+func (i *Info) Data() map[string]interface{} {
+	return map[string]interface{}{
+		"db_type":          i.DbType,
+		"version":          fmt.Sprintf("%d.%d.%d", i.Version.Major, i.Version.Minor, i.Version.Patch),
+		"dump_available":   i.DumpAvailable,
+		"client_available": i.ClientAvailable,
+		"detected_at":      i.DetectedAt.Format(time.RFC3339),
+	}
+}
+
+const (
+	// infoTTL is how long a detected server info is trusted, so an upgraded server is
+	// picked up without restarting db-cmd
+	infoTTL = 5 * time.Minute
+	// failureTTL is how long a failed detection is reported before trying again
+	failureTTL = 10 * time.Second
+)
+
+// Detector detects the server info and caches the result, a failure for a shorter time
+// than a success, so commands don't each ask the server
+type Detector struct {
+	config    *config.Config
+	mu        sync.Mutex
+	info      *Info
+	err       error
+	checkedAt time.Time
+	now       func() time.Time
+	version   func(cfg *config.Config) (builder.Version, error)
+}
+
+func NewDetector(cfg *config.Config) *Detector {
+	return &Detector{config: cfg, now: time.Now, version: ServerVersion}
+}
+
+// Get returns the cached server info, detecting it again once the cache expired
+func (d *Detector) Get() (*Info, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ttl := infoTTL
+	if d.err != nil {
+		ttl = failureTTL
+	}
+	if !d.checkedAt.IsZero() && d.now().Sub(d.checkedAt) < ttl {
+		return d.info, d.err
+	}
+
+	d.info, d.err = d.detect()
+	d.checkedAt = d.now()
+	return d.info, d.err
+}
+
+func (d *Detector) detect() (*Info, error) {
+	if d.config.DbType != "mariadb" && d.config.DbType != "mysql" {
+		return nil, fmt.Errorf("unsupported db_type: %s", d.config.DbType)
+	}
+	version, err := d.version(d.config)
+	if err != nil {
+		return nil, err
+	}
+
+	dumpBuilder := builder.NewDumpBuilder(d.config)
+
+	return &Info{
+		DbType:          d.config.DbType,
+		Version:         version,
+		DumpAvailable:   fileExists(dumpBuilder.DumpExecutable()),
+		ClientAvailable: fileExists(dumpBuilder.ClientExecutable()),
+		DetectedAt:      d.now(),
+	}, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// pingDialTimeout keeps an unreachable fallback address from hanging the check
+const pingDialTimeout = 5 * time.Second
+
+// Ping checks that the server accepts a connection with the config's credentials section.
+// The error carries the admin tool's output, e.g. an access denied message. Without the
+// admin tool the server is only connected to at ping_fallback_address when configured,
+// which doesn't check the credentials.
+func Ping(cfg *config.Config) error {
+	admin := cfg.AdminExecutable()
+	if _, err := os.Stat(admin); os.IsNotExist(err) && cfg.PingFallbackAddress != "" {
+		return dialServer(cfg.PingFallbackAddress)
+	}
+
+	output, err := exec.Command(admin,
+		fmt.Sprintf("--defaults-file=%s", cfg.BackupCredentialsFile),
+		fmt.Sprintf("--defaults-group-suffix=%s", cfg.DefaultsGroupSuffix()),
+		"ping").CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s", message)
+		}
+		return err
+	}
+	return nil
+}
+
+// dialServer connects to the server's socket path or host:port
+func dialServer(address string) error {
+	network := "tcp"
+	if filepath.IsAbs(address) {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, address, pingDialTimeout)
+	if err != nil {
+		return fmt.Errorf("server not reachable at %s: %w", address, err)
+	}
+	return conn.Close()
+}
+
+// TestConnection pings the server with the config's credentials section and returns
+// the detected version, so credentials can be checked before a backup needs them
+func TestConnection(cfg *config.Config) (builder.Version, error) {
+	if err := Ping(cfg); err != nil {
+		return builder.Version{}, fmt.Errorf("connection with credentials [client%s] failed: %w", cfg.DefaultsGroupSuffix(), err)
+	}
+
+	return ServerVersion(cfg)
+}
+
+// ServerVersion asks the running server for its version with the admin tool. The
+// tools' own --version is the client's, which can differ from the server's.
+func ServerVersion(cfg *config.Config) (builder.Version, error) {
+	output, err := exec.Command(cfg.AdminExecutable(),
+		fmt.Sprintf("--defaults-file=%s", cfg.BackupCredentialsFile),
+		fmt.Sprintf("--defaults-group-suffix=%s", cfg.DefaultsGroupSuffix()),
+		"version").CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return builder.Version{}, fmt.Errorf("failed to detect server version: %s", message)
+		}
+		return builder.Version{}, fmt.Errorf("failed to detect server version: %w", err)
+	}
+	return parseServerVersion(string(output))
+}
+
+// parseServerVersion reads the "Server version" line of the admin tool's version output
+func parseServerVersion(output string) (builder.Version, error) {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Server version") {
+			return builder.ParseVersion(line)
+		}
+	}
+	return builder.Version{}, fmt.Errorf("no server version in: %s", strings.TrimSpace(output))
+}
@@ -0,0 +1,103 @@
+package serverinfo
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+func TestPingFallsBackToConnectCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+
+	missingAdmin := filepath.Join(t.TempDir(), "mariadb-admin")
+	cfg := &config.Config{DbType: "mariadb", AdminBin: missingAdmin, PingFallbackAddress: address}
+	if err := Ping(cfg); err != nil {
+		t.Errorf("expected the fallback to reach the server, got %v", err)
+	}
+
+	listener.Close()
+	if err := Ping(cfg); err == nil {
+		t.Error("expected an error once the server is gone")
+	}
+
+	// Without a fallback the missing admin tool is an error
+	if err := Ping(&config.Config{DbType: "mariadb", AdminBin: missingAdmin}); err == nil {
+		t.Error("expected an error without the admin tool or a fallback")
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	// The client tool is older than the server, only the server's version counts
+	output := `mariadb-admin  Ver 9.1 Distrib 10.6.18-MariaDB, for debian-linux-gnu on x86_64
+Copyright (c) 2000, 2018, Oracle, MariaDB Corporation Ab and others.
+
+Server version		10.11.6-MariaDB-0+deb12u1
+Protocol version	10
+Connection		Localhost via UNIX socket
+Uptime:			3 days 2 hours 1 min 5 sec
+`
+	version, err := parseServerVersion(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != (builder.Version{Major: 10, Minor: 11, Patch: 6}) {
+		t.Errorf("expected the server's 10.11.6, got %+v", version)
+	}
+
+	if _, err := parseServerVersion("mysqladmin  Ver 8.0.35 for Linux on x86_64"); err == nil {
+		t.Error("expected an error without a server version line")
+	}
+}
+
+func TestDetectorCachesServerInfo(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	var detectErr error
+	detector := NewDetector(&config.Config{DbType: "mariadb"})
+	detector.now = func() time.Time { return now }
+	detector.version = func(cfg *config.Config) (builder.Version, error) {
+		calls++
+		return builder.Version{Major: 10, Minor: 11, Patch: 6}, detectErr
+	}
+
+	get := func() error {
+		_, err := detector.Get()
+		return err
+	}
+
+	// A detected version is reused until it expires
+	if err := get(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now = now.Add(infoTTL - time.Second)
+	get()
+	if calls != 1 {
+		t.Errorf("expected one detection within the ttl, got %d", calls)
+	}
+
+	// An expired one is detected again, and a failure is cached for a shorter time
+	detectErr = errors.New("server down")
+	now = now.Add(time.Second)
+	if err := get(); err == nil {
+		t.Error("expected the failed detection to be reported")
+	}
+	get()
+	if calls != 2 {
+		t.Errorf("expected the failure to be cached, got %d detections", calls)
+	}
+
+	detectErr = nil
+	now = now.Add(failureTTL)
+	if err := get(); err != nil || calls != 3 {
+		t.Errorf("expected a new detection after the failure expired, got %v after %d detections", err, calls)
+	}
+}
@@ -2,11 +2,15 @@ package socket
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/adapter"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/handler"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/serverinfo"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/validator"
 	sharedProcess "github.com/martijn/dbcalm/shared/process"
 	sharedSocket "github.com/martijn/dbcalm/shared/socket"
@@ -17,14 +21,16 @@ type DbCommandProcessor struct {
 	adapter      adapter.Adapter
 	validator    *validator.Validator
 	queueHandler *handler.QueueHandler
+	serverInfo   *serverinfo.Detector
 }
 
-func NewDbCommandProcessor(cfg *config.Config, adptr adapter.Adapter, valid *validator.Validator, qHandler *handler.QueueHandler) *DbCommandProcessor {
+func NewDbCommandProcessor(cfg *config.Config, adptr adapter.Adapter, valid *validator.Validator, qHandler *handler.QueueHandler, detector *serverinfo.Detector) *DbCommandProcessor {
 	return &DbCommandProcessor{
 		config:       cfg,
 		adapter:      adptr,
 		validator:    valid,
 		queueHandler: qHandler,
+		serverInfo:   detector,
 	}
 }
 
@@ -39,6 +45,35 @@ func (p *DbCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRes
 		}
 	}
 
+	// server_info is answered synchronously and also tells callers whether db-cmd is ready
+	if req.Cmd == "server_info" {
+		return p.processServerInfo()
+	}
+
+	// test_connection checks credentials, so it must work before the server info is known
+	if req.Cmd == "test_connection" {
+		return p.processTestConnection(req.Args)
+	}
+
+	// process_usage reads /proc, which only db-cmd can for the processes it started
+	if req.Cmd == "process_usage" {
+		return p.processProcessUsage(req.Args)
+	}
+
+	// list_backup_files only reads backup_dir, which db-cmd owns
+	if req.Cmd == "list_backup_files" {
+		return p.processListBackupFiles()
+	}
+
+	// Refuse backups and restores until the server version and type are known
+	if _, err := p.serverInfo.Get(); err != nil {
+		return sharedSocket.CommandResponse{
+			Code:    503,
+			Status:  sharedSocket.GetStatusText(503),
+			Message: fmt.Sprintf("cannot determine MySQL/MariaDB server version: %v", err),
+		}
+	}
+
 	// Validate request
 	validationResult := p.validator.Validate(req.Cmd, req.Args)
 	if validationResult.Code != validator.StatusOK {
@@ -62,17 +97,38 @@ func (p *DbCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRes
 			sidInt := int(sid)
 			scheduleID = &sidInt
 		}
-		proc, procChan, err = p.adapter.FullBackup(id, scheduleID)
+		verify, _ := req.Args["verify"].(bool)
+		strategy, _ := req.Args["strategy"].(string)
+		if strategy == "" {
+			strategy = string(builder.BackupStrategyPhysical)
+		}
+		proc, procChan, err = p.adapter.FullBackup(id, adapter.BackupOptions{
+			ScheduleID:        scheduleID,
+			Strategy:          strategy,
+			ExcludeDatabases:  stringList(req.Args["exclude_databases"]),
+			Hooks:             backupHooks(req.Args),
+			Verify:            verify,
+			CredentialsSuffix: credentialsSuffix(req.Args),
+			Description:       description(req.Args),
+		})
 
 	case "incremental_backup":
 		id := req.Args["id"].(string)
 		fromBackupID := req.Args["from_backup_id"].(string)
+		verify, _ := req.Args["verify"].(bool)
 		var scheduleID *int
 		if sid, ok := req.Args["schedule_id"].(float64); ok {
 			sidInt := int(sid)
 			scheduleID = &sidInt
 		}
-		proc, procChan, err = p.adapter.IncrementalBackup(id, fromBackupID, scheduleID)
+		proc, procChan, err = p.adapter.IncrementalBackup(id, fromBackupID, adapter.BackupOptions{
+			ScheduleID:        scheduleID,
+			ExcludeDatabases:  stringList(req.Args["exclude_databases"]),
+			Hooks:             backupHooks(req.Args),
+			Verify:            verify,
+			CredentialsSuffix: credentialsSuffix(req.Args),
+			Description:       description(req.Args),
+		})
 
 	case "restore_backup":
 		// Convert id_list to []string
@@ -90,7 +146,35 @@ func (p *DbCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRes
 			}
 		}
 		target := req.Args["target"].(string)
-		proc, procChan, err = p.adapter.RestoreBackup(idList, target)
+		mode, _ := req.Args["restore_mode"].(string)
+		if mode == "" {
+			mode = string(builder.RestoreModePhysical)
+		}
+		targetPath, _ := req.Args["target_path"].(string)
+		record, ok := req.Args["record"].(bool)
+		if !ok {
+			record = true
+		}
+		archive, _ := req.Args["archive"].(bool)
+		proc, procChan, err = p.adapter.RestoreBackup(idList, adapter.RestoreOptions{
+			Target:            target,
+			TargetPath:        targetPath,
+			Mode:              mode,
+			Databases:         stringList(req.Args["databases"]),
+			CredentialsSuffix: credentialsSuffix(req.Args),
+			Record:            record,
+			Archive:           archive,
+		})
+
+	case "consolidate_backup":
+		id := req.Args["id"].(string)
+		var scheduleID *int
+		if sid, ok := req.Args["schedule_id"].(float64); ok {
+			sidInt := int(sid)
+			scheduleID = &sidInt
+		}
+		retire, _ := req.Args["retire"].(bool)
+		proc, procChan, err = p.adapter.ConsolidateBackup(id, stringList(req.Args["id_list"]), scheduleID, retire)
 
 	default:
 		return sharedSocket.CommandResponse{
@@ -117,3 +201,176 @@ func (p *DbCommandProcessor) ProcessRequest(data []byte) sharedSocket.CommandRes
 		ID:     proc.CommandID,
 	}
 }
+
+func (p *DbCommandProcessor) processServerInfo() sharedSocket.CommandResponse {
+	info, err := p.serverInfo.Get()
+	if err != nil {
+		return sharedSocket.CommandResponse{
+			Code:    503,
+			Status:  sharedSocket.GetStatusText(503),
+			Message: fmt.Sprintf("cannot determine MySQL/MariaDB server version: %v", err),
+		}
+	}
+
+	data := info.Data()
+	if p.config.Source != "" {
+		data["source"] = p.config.Source
+	}
+
+	return sharedSocket.CommandResponse{
+		Code:   200,
+		Status: sharedSocket.GetStatusText(200),
+		Data:   data,
+	}
+}
+
+func (p *DbCommandProcessor) processTestConnection(args map[string]interface{}) sharedSocket.CommandResponse {
+	if result := p.validator.Validate("test_connection", args); result.Code != validator.StatusOK {
+		return sharedSocket.CommandResponse{
+			Code:    result.Code,
+			Status:  sharedSocket.GetStatusText(result.Code),
+			Message: result.Message,
+		}
+	}
+
+	cfg := p.config.WithCredentialsSuffix(credentialsSuffix(args))
+	data := map[string]interface{}{
+		"credentials_suffix": cfg.DefaultsGroupSuffix(),
+		"db_type":            cfg.DbType,
+	}
+
+	// A failed connection is the answer to the test, not a failed request
+	version, err := serverinfo.TestConnection(cfg)
+	if err != nil {
+		data["connected"] = false
+		data["error"] = err.Error()
+	} else {
+		data["connected"] = true
+		data["version"] = fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+	}
+
+	return sharedSocket.CommandResponse{
+		Code:   200,
+		Status: sharedSocket.GetStatusText(200),
+		Data:   data,
+	}
+}
+
+func (p *DbCommandProcessor) processProcessUsage(args map[string]interface{}) sharedSocket.CommandResponse {
+	if result := p.validator.Validate("process_usage", args); result.Code != validator.StatusOK {
+		return sharedSocket.CommandResponse{
+			Code:    result.Code,
+			Status:  sharedSocket.GetStatusText(result.Code),
+			Message: result.Message,
+		}
+	}
+
+	pid := int(args["pid"].(float64))
+	command := args["command"].(string)
+	var usage *sharedProcess.Usage
+	err := sharedProcess.ErrNotRunning
+	if sharedProcess.Alive(pid, command) {
+		usage, err = sharedProcess.ReadUsage(pid)
+	}
+	if errors.Is(err, sharedProcess.ErrNotRunning) {
+		return sharedSocket.CommandResponse{
+			Code:    404,
+			Status:  sharedSocket.GetStatusText(404),
+			Message: fmt.Sprintf("process %d is not running", pid),
+		}
+	}
+	if err != nil {
+		return sharedSocket.CommandResponse{
+			Code:    500,
+			Status:  sharedSocket.GetStatusText(500),
+			Message: fmt.Sprintf("failed to read usage of process %d: %v", pid, err),
+		}
+	}
+
+	return sharedSocket.CommandResponse{
+		Code:   200,
+		Status: sharedSocket.GetStatusText(200),
+		Data: map[string]interface{}{
+			"pid":                   usage.PID,
+			"state":                 usage.State,
+			"threads":               usage.Threads,
+			"elapsed_seconds":       usage.ElapsedSeconds,
+			"cpu_user_seconds":      usage.CPUUserSeconds,
+			"cpu_system_seconds":    usage.CPUSystemSeconds,
+			"block_io_wait_seconds": usage.BlockIOWaitSeconds,
+			"rss_bytes":             usage.RSSBytes,
+			"read_bytes":            usage.ReadBytes,
+			"write_bytes":           usage.WriteBytes,
+		},
+	}
+}
+
+func (p *DbCommandProcessor) processListBackupFiles() sharedSocket.CommandResponse {
+	files, err := adapter.ListBackupFiles(p.config)
+	if err != nil {
+		return sharedSocket.CommandResponse{
+			Code:    500,
+			Status:  sharedSocket.GetStatusText(500),
+			Message: err.Error(),
+		}
+	}
+
+	backups := make([]map[string]interface{}, 0, len(files))
+	for _, file := range files {
+		backups = append(backups, map[string]interface{}{
+			"id":             file.ID,
+			"path":           file.Path,
+			"kind":           file.Kind,
+			"type":           file.Type,
+			"strategy":       file.Strategy,
+			"from_backup_id": file.FromBackupID,
+			"modified_at":    file.ModifiedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return sharedSocket.CommandResponse{
+		Code:   200,
+		Status: sharedSocket.GetStatusText(200),
+		Data: map[string]interface{}{
+			"backups": backups,
+			// Forwarded streams never land in backup_dir, so their catalog rows have no files here
+			"forwarded": p.config.Forwarded(),
+		},
+	}
+}
+
+// stringList converts a JSON array argument to []string, ignoring non-string items
+func stringList(raw interface{}) []string {
+	var list []string
+	switch v := raw.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+	case []string:
+		list = v
+	}
+	return list
+}
+
+// credentialsSuffix reads the per-request credentials section, empty for the configured one
+func credentialsSuffix(args map[string]interface{}) string {
+	suffix, _ := args["credentials_suffix"].(string)
+	return suffix
+}
+
+// description reads the operator's note on a backup, empty when there is none
+func description(args map[string]interface{}) string {
+	note, _ := args["description"].(string)
+	return note
+}
+
+// backupHooks reads the per-request pre/post backup hooks
+func backupHooks(args map[string]interface{}) builder.Hooks {
+	var hooks builder.Hooks
+	hooks.PreBackup, _ = args["pre_backup_hook"].(string)
+	hooks.PostBackup, _ = args["post_backup_hook"].(string)
+	return hooks
+}
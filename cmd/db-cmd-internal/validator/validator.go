@@ -3,13 +3,18 @@ package validator
 import (
 	"bufio"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
+	"unicode/utf8"
 
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/builder"
 	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
-	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/constants"
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/serverinfo"
 )
 
 const (
@@ -20,6 +25,13 @@ const (
 	StatusServiceUnavailable = 503
 )
 
+// credentialsModeTooOpen are the permission bits a credentials file shouldn't have: any
+// access for others, or write access for its group
+const credentialsModeTooOpen os.FileMode = 0027
+
+// maxDescriptionLength is the longest note a backup can carry, the API allows the same
+const maxDescriptionLength = 500
+
 type ValidationResult struct {
 	Code    int
 	Message string
@@ -27,10 +39,12 @@ type ValidationResult struct {
 
 type Validator struct {
 	config *config.Config
+	// statfs reads filesystem stats for the free inodes check
+	statfs func(path string, buf *syscall.Statfs_t) error
 }
 
 func NewValidator(cfg *config.Config) *Validator {
-	return &Validator{config: cfg}
+	return &Validator{config: cfg, statfs: syscall.Statfs}
 }
 
 func (v *Validator) Validate(cmd string, args map[string]interface{}) ValidationResult {
@@ -42,6 +56,13 @@ func (v *Validator) Validate(cmd string, args map[string]interface{}) Validation
 		return v.validateIncrementalBackup(args)
 	case "restore_backup":
 		return v.validateRestoreBackup(args)
+	case "consolidate_backup":
+		return v.validateConsolidateBackup(args)
+	case "test_connection":
+		_, result := v.requestedCredentialsSuffix(args)
+		return result
+	case "process_usage":
+		return validateProcessUsage(args)
 	default:
 		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("Unknown command: %s", cmd)}
 	}
@@ -53,19 +74,64 @@ func (v *Validator) validateFullBackup(args map[string]interface{}) ValidationRe
 	if !ok || id == "" {
 		return ValidationResult{Code: StatusBadRequest, Message: "Missing required argument: id"}
 	}
+	if result := validateBackupIDs(id); result.Code != StatusOK {
+		return result
+	}
 
 	// Check backup ID is unique
 	if v.backupExists(id) {
 		return ValidationResult{Code: StatusConflict, Message: fmt.Sprintf("Backup with id '%s' already exists", id)}
 	}
 
+	strategy := string(builder.BackupStrategyPhysical)
+	if strategyRaw, exists := args["strategy"]; exists {
+		s, ok := strategyRaw.(string)
+		if !ok || (s != string(builder.BackupStrategyPhysical) && s != string(builder.BackupStrategyLogical)) {
+			return ValidationResult{Code: StatusBadRequest, Message: "strategy must be 'physical' or 'logical'"}
+		}
+		strategy = s
+	}
+
+	if result := v.validateExcludeDatabases(args); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateHooks(args); result.Code != StatusOK {
+		return result
+	}
+
+	if result := validateDescription(args); result.Code != StatusOK {
+		return result
+	}
+
 	// Check credentials file is valid
-	if !v.credentialsFileValid() {
-		return ValidationResult{Code: StatusServiceUnavailable, Message: "credentials file not found or missing [client-dbcalm] section"}
+	suffix, result := v.credentialsSuffix(args)
+	if result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateBackupDir(); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateFreeInodes(v.config.BackupDir, "cannot create backup"); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateSSHForward(id); result.Code != StatusOK {
+		return result
+	}
+
+	// Logical backups need the dump tool installed alongside the server
+	if strategy == string(builder.BackupStrategyLogical) {
+		dumpBin := builder.NewDumpBuilder(v.config).DumpExecutable()
+		if _, err := os.Stat(dumpBin); err != nil {
+			return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("cannot create logical backup, %s not found", dumpBin)}
+		}
 	}
 
 	// Check server is alive
-	if !v.serverAlive() {
+	if !v.serverAlive(suffix) {
 		return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot create backup, MySQL/MariaDB server is not running"}
 	}
 
@@ -83,6 +149,9 @@ func (v *Validator) validateIncrementalBackup(args map[string]interface{}) Valid
 	if !ok || fromBackupID == "" {
 		return ValidationResult{Code: StatusBadRequest, Message: "Missing required argument: from_backup_id"}
 	}
+	if result := validateBackupIDs(id, fromBackupID); result.Code != StatusOK {
+		return result
+	}
 
 	// Check backup ID is unique
 	if v.backupExists(id) {
@@ -94,13 +163,43 @@ func (v *Validator) validateIncrementalBackup(args map[string]interface{}) Valid
 		return ValidationResult{Code: StatusNotFound, Message: fmt.Sprintf("Base backup with id '%s' not found", fromBackupID)}
 	}
 
+	if result := v.validateExcludeDatabases(args); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateHooks(args); result.Code != StatusOK {
+		return result
+	}
+
+	if result := validateDescription(args); result.Code != StatusOK {
+		return result
+	}
+
+	// Logical dumps carry no LSN, so they cannot serve as an incremental base
+	if v.isLogicalBackup(fromBackupID) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("Base backup with id '%s' is a logical dump and cannot be used for incremental backups", fromBackupID)}
+	}
+
 	// Check credentials file is valid
-	if !v.credentialsFileValid() {
-		return ValidationResult{Code: StatusServiceUnavailable, Message: "credentials file not found or missing [client-dbcalm] section"}
+	suffix, result := v.credentialsSuffix(args)
+	if result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateBackupDir(); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateFreeInodes(v.config.BackupDir, "cannot create backup"); result.Code != StatusOK {
+		return result
+	}
+
+	if result := v.validateSSHForward(id); result.Code != StatusOK {
+		return result
 	}
 
 	// Check server is alive
-	if !v.serverAlive() {
+	if !v.serverAlive(suffix) {
 		return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot create backup, MySQL/MariaDB server is not running"}
 	}
 
@@ -132,6 +231,9 @@ func (v *Validator) validateRestoreBackup(args map[string]interface{}) Validatio
 	if len(idList) == 0 {
 		return ValidationResult{Code: StatusBadRequest, Message: "id_list cannot be empty"}
 	}
+	if result := validateBackupIDs(idList...); result.Code != StatusOK {
+		return result
+	}
 
 	target, ok := args["target"].(string)
 	if !ok || target == "" {
@@ -142,6 +244,46 @@ func (v *Validator) validateRestoreBackup(args map[string]interface{}) Validatio
 		return ValidationResult{Code: StatusBadRequest, Message: "target must be 'database' or 'folder'"}
 	}
 
+	if targetPath, exists := args["target_path"]; exists {
+		if target != "folder" {
+			return ValidationResult{Code: StatusBadRequest, Message: "target_path is only supported for folder restores"}
+		}
+		path, ok := targetPath.(string)
+		if !ok {
+			return ValidationResult{Code: StatusBadRequest, Message: "target_path must be a string"}
+		}
+		if result := v.validateTargetPath(path); result.Code != StatusOK {
+			return result
+		}
+	}
+
+	// Only throwaway folder restores may skip the restore record, the history of
+	// database restores is kept complete
+	if recordRaw, exists := args["record"]; exists {
+		record, ok := recordRaw.(bool)
+		if !ok {
+			return ValidationResult{Code: StatusBadRequest, Message: "record must be a boolean"}
+		}
+		if !record && target != "folder" {
+			return ValidationResult{Code: StatusBadRequest, Message: "record=false is only supported for folder restores"}
+		}
+	}
+
+	// The archive is packed right after preparing, before a databases selection prunes it
+	archive := false
+	if archiveRaw, exists := args["archive"]; exists {
+		var ok bool
+		if archive, ok = archiveRaw.(bool); !ok {
+			return ValidationResult{Code: StatusBadRequest, Message: "archive must be a boolean"}
+		}
+		if archive && target != "folder" {
+			return ValidationResult{Code: StatusBadRequest, Message: "archive is only supported for folder restores"}
+		}
+		if databases, _ := args["databases"].([]interface{}); archive && len(databases) > 0 {
+			return ValidationResult{Code: StatusBadRequest, Message: "archive can't be combined with databases"}
+		}
+	}
+
 	// Check all backups exist
 	for _, id := range idList {
 		if !v.backupExists(id) {
@@ -149,31 +291,506 @@ func (v *Validator) validateRestoreBackup(args map[string]interface{}) Validatio
 		}
 	}
 
+	mode := string(builder.RestoreModePhysical)
+	if modeRaw, exists := args["restore_mode"]; exists {
+		m, ok := modeRaw.(string)
+		if !ok || (m != string(builder.RestoreModePhysical) && m != string(builder.RestoreModeLogical) && m != string(builder.RestoreModeGrants)) {
+			return ValidationResult{Code: StatusBadRequest, Message: "restore_mode must be 'physical', 'logical' or 'grants'"}
+		}
+		mode = m
+	}
+
+	// Grants restores apply the users and grants captured with a backup, nothing else
+	if mode == string(builder.RestoreModeGrants) {
+		return v.validateGrantsRestore(idList, target, args)
+	}
+
+	if result := v.validateRestoreDatabases(idList[0], target, mode, args); result.Code != StatusOK {
+		return result
+	}
+
+	// Logical restores replay a dump into the running server instead of replacing the data dir
+	if mode == string(builder.RestoreModeLogical) {
+		return v.validateLogicalRestore(idList, target, args)
+	}
+
+	// Logical dumps can't be prepared or copied back by mariabackup/xtrabackup
+	if v.isLogicalBackup(idList[0]) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("Backup with id '%s' is a logical dump, use restore_mode 'logical'", idList[0])}
+	}
+
+	// The incrementals are applied in id_list order, each has to start where the one before ended
+	if result := v.validateChainOrder(idList); result.Code != StatusOK {
+		return result
+	}
+
 	// For database restore, check server is stopped and data dir is empty
 	if target == "database" {
-		if v.serverAlive() {
+		suffix, result := v.requestedCredentialsSuffix(args)
+		if result.Code != StatusOK {
+			return result
+		}
+		if v.serverAlive(suffix) {
 			return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot restore to database, MySQL/MariaDb server is not stopped"}
 		}
 
-		if !v.dataDirEmpty() {
-			return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot restore to database, mysql/mariadb data directory is not empty (usually /var/lib/mysql)"}
+		if result := v.validateDataDir(); result.Code != StatusOK {
+			return result
+		}
+
+		return v.validateFreeInodes(v.config.DataDir, "cannot restore to database")
+	}
+
+	// Folder restores are prepared inside the backup directory
+	if result := v.validateFreeInodes(v.config.BackupDir, "cannot restore to folder"); result.Code != StatusOK {
+		return result
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+func (v *Validator) validateConsolidateBackup(args map[string]interface{}) ValidationResult {
+	id, ok := args["id"].(string)
+	if !ok || id == "" {
+		return ValidationResult{Code: StatusBadRequest, Message: "Missing required argument: id"}
+	}
+	if result := validateBackupIDs(id); result.Code != StatusOK {
+		return result
+	}
+
+	if v.backupExists(id) {
+		return ValidationResult{Code: StatusConflict, Message: fmt.Sprintf("Backup with id '%s' already exists", id)}
+	}
+	if _, err := os.Stat(builder.ConsolidateDir(v.config, id)); err == nil {
+		return ValidationResult{Code: StatusConflict, Message: fmt.Sprintf("Backup with id '%s' is already being consolidated", id)}
+	}
+
+	idListRaw, ok := args["id_list"].([]interface{})
+	if !ok {
+		return ValidationResult{Code: StatusBadRequest, Message: "id_list must be an array of strings"}
+	}
+	var idList []string
+	for _, item := range idListRaw {
+		str, ok := item.(string)
+		if !ok || str == "" {
+			return ValidationResult{Code: StatusBadRequest, Message: "id_list must be an array of strings"}
+		}
+		idList = append(idList, str)
+	}
+	if result := validateBackupIDs(idList...); result.Code != StatusOK {
+		return result
+	}
+
+	// A full backup on its own is already standalone
+	if len(idList) < 2 {
+		return ValidationResult{Code: StatusBadRequest, Message: "id_list must hold a full backup and at least one incremental"}
+	}
+
+	// Streamed backups are single files, there is no directory to prepare
+	if v.config.Stream {
+		return ValidationResult{Code: StatusBadRequest, Message: "streamed backups cannot be consolidated"}
+	}
+
+	// Every link of the chain has to be on disk, or the prepare stops halfway
+	for _, chainID := range idList {
+		if !v.backupExists(chainID) {
+			return ValidationResult{Code: StatusNotFound, Message: fmt.Sprintf("Backup with id '%s' not found", chainID)}
+		}
+	}
+
+	if v.isLogicalBackup(idList[0]) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("Backup with id '%s' is a logical dump and cannot be consolidated", idList[0])}
+	}
+
+	if result := v.validateBackupDir(); result.Code != StatusOK {
+		return result
+	}
+
+	return v.validateFreeInodes(v.config.BackupDir, "cannot consolidate backup")
+}
+
+func (v *Validator) validateLogicalRestore(idList []string, target string, args map[string]interface{}) ValidationResult {
+	if target != string(builder.RestoreTargetDatabase) {
+		return ValidationResult{Code: StatusBadRequest, Message: "logical restore is only supported for the database target"}
+	}
+
+	if len(idList) != 1 {
+		return ValidationResult{Code: StatusBadRequest, Message: "logical restore requires a single full backup"}
+	}
+
+	if !v.isLogicalBackup(idList[0]) {
+		return ValidationResult{Code: StatusNotFound, Message: fmt.Sprintf("Backup with id '%s' has no logical dump (%s)", idList[0], builder.DumpFileName)}
+	}
+
+	suffix, result := v.credentialsSuffix(args)
+	if result.Code != StatusOK {
+		return result
+	}
+
+	if !v.serverAlive(suffix) {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot run logical restore, MySQL/MariaDB server is not running"}
+	}
+
+	if result := v.validateFreeInodes(v.config.DataDir, "cannot run logical restore"); result.Code != StatusOK {
+		return result
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+func (v *Validator) validateGrantsRestore(idList []string, target string, args map[string]interface{}) ValidationResult {
+	if target != string(builder.RestoreTargetDatabase) {
+		return ValidationResult{Code: StatusBadRequest, Message: "grants restore is only supported for the database target"}
+	}
+
+	if len(idList) != 1 {
+		return ValidationResult{Code: StatusBadRequest, Message: "grants restore requires a single backup"}
+	}
+
+	if _, exists := args["databases"]; exists {
+		return ValidationResult{Code: StatusBadRequest, Message: "databases can't be selected for grants restores"}
+	}
+
+	if _, err := os.Stat(filepath.Join(v.config.BackupDir, idList[0], builder.GrantsFileName)); err != nil {
+		return ValidationResult{Code: StatusNotFound, Message: fmt.Sprintf("Backup with id '%s' has no captured grants (%s)", idList[0], builder.GrantsFileName)}
+	}
+
+	suffix, result := v.credentialsSuffix(args)
+	if result.Code != StatusOK {
+		return result
+	}
+
+	if !v.serverAlive(suffix) {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: "cannot run grants restore, MySQL/MariaDB server is not running"}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// validateRestoreDatabases checks the databases a restore is limited to: valid names, a
+// restore that can bring back part of a backup, and every database present in the backup
+func (v *Validator) validateRestoreDatabases(id, target, mode string, args map[string]interface{}) ValidationResult {
+	raw, exists := args["databases"]
+	if !exists || raw == nil {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	items, ok := raw.([]interface{})
+	if !ok {
+		return ValidationResult{Code: StatusBadRequest, Message: "databases must be an array of strings"}
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		name, ok := item.(string)
+		if !ok {
+			return ValidationResult{Code: StatusBadRequest, Message: "databases must be an array of strings"}
+		}
+		names = append(names, name)
+	}
+	if err := config.ValidateDatabaseNames(names); err != nil {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("databases: %v", err)}
+	}
+
+	// Copy-back replaces the whole data dir
+	if target == string(builder.RestoreTargetDatabase) && mode != string(builder.RestoreModeLogical) {
+		return ValidationResult{Code: StatusBadRequest, Message: "databases can only be selected for logical restores to the database and for folder restores"}
+	}
+
+	available, ok := v.backupDatabases(id)
+	if !ok {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("the databases in backup '%s' can't be listed, restore it without selecting databases", id)}
+	}
+	for _, name := range names {
+		if !available[name] {
+			return ValidationResult{Code: StatusNotFound, Message: fmt.Sprintf("Database '%s' not found in backup '%s'", name, id)}
+		}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// backupDatabases lists the databases a full backup holds: those listed in a logical
+// backup's dump.databases, or the directories of a physical backup. Streamed backups and
+// dumps taken without a list can't be listed.
+func (v *Validator) backupDatabases(id string) (map[string]bool, bool) {
+	databases := map[string]bool{}
+	backupPath := filepath.Join(v.config.BackupDir, id)
+
+	if v.isLogicalBackup(id) {
+		data, err := os.ReadFile(filepath.Join(backupPath, builder.DumpDatabasesFileName))
+		if err != nil {
+			return nil, false
+		}
+		for _, name := range strings.Fields(string(data)) {
+			databases[name] = true
+		}
+		return databases, true
+	}
+
+	entries, err := os.ReadDir(backupPath)
+	if err != nil {
+		return nil, false
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			databases[entry.Name()] = true
+		}
+	}
+	return databases, true
+}
+
+func (v *Validator) validateExcludeDatabases(args map[string]interface{}) ValidationResult {
+	raw, exists := args["exclude_databases"]
+	if !exists || raw == nil {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	items, ok := raw.([]interface{})
+	if !ok {
+		return ValidationResult{Code: StatusBadRequest, Message: "exclude_databases must be an array of strings"}
+	}
+
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		name, ok := item.(string)
+		if !ok {
+			return ValidationResult{Code: StatusBadRequest, Message: "exclude_databases must be an array of strings"}
+		}
+		names = append(names, name)
+	}
+
+	if err := config.ValidateDatabaseNames(names); err != nil {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("exclude_databases: %v", err)}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// validateDescription checks the optional note on a backup is a string of at most
+// maxDescriptionLength characters
+func validateDescription(args map[string]interface{}) ValidationResult {
+	raw, exists := args["description"]
+	if !exists || raw == nil {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+	description, ok := raw.(string)
+	if !ok {
+		return ValidationResult{Code: StatusBadRequest, Message: "description must be a string"}
+	}
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("description must be at most %d characters", maxDescriptionLength)}
+	}
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// validateHooks checks the requested hooks, and the global ones they fall back to,
+// are executables inside the hook directory that only their owner can modify
+func (v *Validator) validateHooks(args map[string]interface{}) ValidationResult {
+	for _, stage := range []struct {
+		key      string
+		fallback string
+	}{
+		{"pre_backup_hook", v.config.PreBackupHook},
+		{"post_backup_hook", v.config.PostBackupHook},
+	} {
+		hook := stage.fallback
+		if raw, exists := args[stage.key]; exists && raw != nil {
+			requested, ok := raw.(string)
+			if !ok {
+				return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("%s must be a string", stage.key)}
+			}
+			if requested != "" {
+				if err := v.config.ValidateHookPath(requested); err != nil {
+					return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("%s: %v", stage.key, err)}
+				}
+				hook = requested
+			}
+		}
+		if hook == "" {
+			continue
+		}
+
+		info, err := os.Lstat(hook)
+		if err != nil {
+			return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("%s %s not found", stage.key, hook)}
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("%s %s is not an executable file", stage.key, hook)}
 		}
+		if info.Mode().Perm()&0022 != 0 {
+			return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("%s %s is writable by group or others", stage.key, hook)}
+		}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// requestedCredentialsSuffix returns the credentials section the request selects, the
+// configured one when it names none
+func (v *Validator) requestedCredentialsSuffix(args map[string]interface{}) (string, ValidationResult) {
+	suffix := v.config.DefaultsGroupSuffix()
+	if raw, exists := args["credentials_suffix"]; exists && raw != nil {
+		requested, ok := raw.(string)
+		if !ok {
+			return "", ValidationResult{Code: StatusBadRequest, Message: "credentials_suffix must be a string"}
+		}
+		if requested != "" {
+			if err := config.ValidateCredentialsSuffix(requested); err != nil {
+				return "", ValidationResult{Code: StatusBadRequest, Message: err.Error()}
+			}
+			suffix = requested
+		}
+	}
+	return suffix, ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// credentialsSuffix returns the requested credentials section and checks the
+// credentials file has it
+func (v *Validator) credentialsSuffix(args map[string]interface{}) (string, ValidationResult) {
+	suffix, result := v.requestedCredentialsSuffix(args)
+	if result.Code != StatusOK {
+		return "", result
+	}
+
+	if !v.credentialsFileValid(suffix) {
+		return "", ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("credentials file not found or missing [client%s] section", suffix)}
 	}
+	if result := v.validateCredentialsPermissions(); result.Code != StatusOK {
+		return "", result
+	}
+
+	return suffix, ValidationResult{Code: StatusOK, Message: ""}
+}
 
+// validateBackupDir checks backups can be written to the backup directory, so a missing
+// or read-only directory is reported before the backup tool fails on it
+func (v *Validator) validateBackupDir() ValidationResult {
+	if err := config.CheckBackupDir(v.config.BackupDir); err != nil {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("cannot create backup, %v", err)}
+	}
 	return ValidationResult{Code: StatusOK, Message: ""}
 }
 
-func (v *Validator) credentialsFileValid() bool {
+// validateTargetPath checks the folder a restore is written to. It has to be an absolute
+// path outside backup_dir, so the restore can't overwrite the backups it is made from, and
+// either an empty directory or one that can be created in an existing parent.
+func (v *Validator) validateTargetPath(path string) ValidationResult {
+	if !filepath.IsAbs(path) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s must be an absolute path", path)}
+	}
+	path = filepath.Clean(path)
+
+	if isWithin(resolvePath(path), resolvePath(v.config.BackupDir)) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s is inside the backup directory %s", path, v.config.BackupDir)}
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if parent, err := os.Stat(filepath.Dir(path)); err != nil || !parent.IsDir() {
+			return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s does not exist and its parent directory is missing", path)}
+		}
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+	if err != nil {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s can't be read: %v", path, err)}
+	}
+	if !info.IsDir() {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s is not a directory", path)}
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("target_path %s can't be read: %v", path, err)}
+	}
+	if len(entries) > 0 {
+		return ValidationResult{Code: StatusConflict, Message: fmt.Sprintf("target_path %s is not empty", path)}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// resolvePath follows symlinks in the part of path that exists, so a link can't hide
+// that a path is inside another
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolvePath(parent), filepath.Base(path))
+}
+
+// isWithin reports whether path is dir or below it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateFreeInodes checks the filesystem holding path has min_free_inodes left, a
+// database with many small files can run out of inodes long before it runs out of space
+func (v *Validator) validateFreeInodes(path, action string) ValidationResult {
+	if v.config.MinFreeInodes == 0 {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	var stat syscall.Statfs_t
+	if err := v.statfs(path, &stat); err != nil {
+		// A missing directory is reported by the checks that need it
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	// Filesystems that allocate inodes dynamically (btrfs) report no inode counts
+	if stat.Files == 0 {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	if stat.Ffree < v.config.MinFreeInodes {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf(
+			"%s, only %d free inodes left on the filesystem of %s (min_free_inodes is %d)",
+			action, stat.Ffree, path, v.config.MinFreeInodes)}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// validateSSHForward checks the backup can be streamed to the ssh_forward host: its ID
+// has to be safe as a remote file name and the host has to accept the connection
+func (v *Validator) validateSSHForward(id string) ValidationResult {
+	if v.config.Forward != "" || !v.config.SSHForward.Enabled() {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	if !config.SSHFileNamePattern.MatchString(id) {
+		return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("backup id '%s' can't be used as a file name on the ssh_forward host", id)}
+	}
+
+	// The remote dir is checked along the way, the stream would be lost without it
+	cmd := append(v.config.SSHForward.Command(), "test", "-d", v.config.SSHForward.RemoteDir)
+	if output, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf(
+			"cannot create backup, ssh_forward target %s@%s:%s is not reachable: %s",
+			v.config.SSHForward.User, v.config.SSHForward.Host, v.config.SSHForward.RemoteDir,
+			strings.TrimSpace(string(output)+" "+err.Error()))}
+	}
+
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+func (v *Validator) credentialsFileValid(suffix string) bool {
 	file, err := os.Open(v.config.BackupCredentialsFile)
 	if err != nil {
 		return false
 	}
 	defer file.Close()
 
+	section := "[client" + suffix + "]"
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		if line == "[client-dbcalm]" {
+		if line == section {
 			return true
 		}
 	}
@@ -181,61 +798,145 @@ func (v *Validator) credentialsFileValid() bool {
 	return false
 }
 
-func (v *Validator) serverAlive() bool {
-	var cmd *exec.Cmd
+// validateCredentialsPermissions applies credentials_permissions to a credentials file
+// others can read or its group can change. Unset, the policy is to warn.
+func (v *Validator) validateCredentialsPermissions() ValidationResult {
+	if v.config.CredentialsPermissions == config.CredentialsPermissionsIgnore {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+	info, err := os.Stat(v.config.BackupCredentialsFile)
+	if err != nil || info.Mode().Perm()&credentialsModeTooOpen == 0 {
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
 
-	if v.config.DbType == "mariadb" {
-		cmd = exec.Command(constants.MariaDBAdminBin,
-			fmt.Sprintf("--defaults-file=%s", v.config.BackupCredentialsFile),
-			"--defaults-group-suffix=-dbcalm",
-			"ping")
-	} else {
-		cmd = exec.Command(constants.MySQLAdminBin,
-			fmt.Sprintf("--defaults-file=%s", v.config.BackupCredentialsFile),
-			"--defaults-group-suffix=-dbcalm",
-			"ping")
+	message := fmt.Sprintf("credentials file %s has mode %04o, the database passwords in it must not be readable by others or writable by its group (chmod 640)",
+		v.config.BackupCredentialsFile, info.Mode().Perm())
+	if v.config.CredentialsPermissions == config.CredentialsPermissionsRefuse {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: message}
 	}
+	log.Printf("Warning: %s", message)
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
 
-	err := cmd.Run()
-	return err == nil
+func (v *Validator) serverAlive(suffix string) bool {
+	return serverinfo.Ping(v.config.WithCredentialsSuffix(suffix)) == nil
 }
 
-func (v *Validator) dataDirEmpty() bool {
+// dataDirAllowlist is what a stopped server leaves in its data directory that a restore can
+// replace: the system tablespace, buffer pool dump and redo logs, sockets, pids and error logs
+var dataDirAllowlist = []string{"ib_buffer_pool", "ibdata1", "ib_logfile*", "*.sock", "*.pid", "*.err"}
+
+// dataDirBlockers lists the entries of the data directory that match neither the built-in
+// allowlist nor data_dir_allowlist
+func (v *Validator) dataDirBlockers() ([]string, error) {
 	entries, err := os.ReadDir(v.config.DataDir)
 	if err != nil {
-		return false
-	}
-
-	allowedFiles := map[string]bool{
-		"ib_buffer_pool": true,
-		"ibdata1":        true,
+		return nil, err
 	}
 
+	patterns := append(append([]string{}, dataDirAllowlist...), v.config.DataDirAllowlist...)
+	var blockers []string
 	for _, entry := range entries {
 		name := entry.Name()
-		
-		// Ignore allowed files
-		if allowedFiles[name] {
-			continue
+		allowed := false
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				allowed = true
+				break
+			}
 		}
-		
-		// Ignore log files, sockets, pid files, error files
-		if strings.HasPrefix(name, "ib_logfile") ||
-			strings.HasSuffix(name, ".sock") ||
-			strings.HasSuffix(name, ".pid") ||
-			strings.HasSuffix(name, ".err") {
-			continue
+		if !allowed {
+			blockers = append(blockers, name)
 		}
+	}
+	return blockers, nil
+}
 
-		// Found a non-allowed file
-		return false
+// validateDataDir checks the data directory a database restore copies back into holds
+// nothing the restore would clash with. The files in the way are logged, and with
+// data_dir_check warn the restore goes ahead regardless.
+func (v *Validator) validateDataDir() ValidationResult {
+	blockers, err := v.dataDirBlockers()
+	if err != nil {
+		return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("cannot restore to database, failed to read data directory %s: %v", v.config.DataDir, err)}
+	}
+	if len(blockers) == 0 {
+		return ValidationResult{Code: StatusOK, Message: ""}
 	}
 
-	return true
+	log.Printf("Data directory %s is not empty, files outside the allowlist: %s", v.config.DataDir, strings.Join(blockers, ", "))
+	if v.config.DataDirCheck == config.DataDirCheckWarn {
+		log.Printf("Warning: restoring into a data directory that is not empty, data_dir_check is %s", config.DataDirCheckWarn)
+		return ValidationResult{Code: StatusOK, Message: ""}
+	}
+
+	// The log has the full list, the response names enough to go on
+	const shown = 5
+	names := strings.Join(blockers, ", ")
+	if len(blockers) > shown {
+		names = fmt.Sprintf("%s and %d more", strings.Join(blockers[:shown], ", "), len(blockers)-shown)
+	}
+	return ValidationResult{Code: StatusServiceUnavailable, Message: fmt.Sprintf("cannot restore to database, mysql/mariadb data directory %s is not empty: %s", v.config.DataDir, names)}
 }
 
-func (v *Validator) backupExists(id string) bool {
-	backupPath := filepath.Join(v.config.BackupDir, id)
-	_, err := os.Stat(backupPath)
+// backupIDPattern keeps a backup ID a single path element under backup_dir: no separators,
+// no leading dot, at most 128 characters. The app checks the same before dispatching.
+var backupIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// validateBackupIDs refuses backup IDs that could point outside backup_dir
+func validateBackupIDs(ids ...string) ValidationResult {
+	for _, id := range ids {
+		if !backupIDPattern.MatchString(id) {
+			return ValidationResult{Code: StatusBadRequest, Message: fmt.Sprintf("invalid backup id '%s'", id)}
+		}
+	}
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// validateChainOrder checks the LSN ranges in the backups' checkpoints files line up.
+// Streamed backups have no readable checkpoints file and are left to the prepare step.
+func (v *Validator) validateChainOrder(idList []string) ValidationResult {
+	var previousTo string
+	for i, id := range idList {
+		from, to, ok := v.checkpointLSNs(id)
+		if !ok {
+			return ValidationResult{Code: StatusOK, Message: ""}
+		}
+		if i > 0 && from != previousTo {
+			return ValidationResult{Code: StatusConflict, Message: fmt.Sprintf("Backup with id '%s' starts at LSN %s, not at LSN %s where '%s' ends", id, from, previousTo, idList[i-1])}
+		}
+		previousTo = to
+	}
+	return ValidationResult{Code: StatusOK, Message: ""}
+}
+
+// checkpointLSNs reads from_lsn and to_lsn from a backup's checkpoints file
+func (v *Validator) checkpointLSNs(id string) (from, to string, ok bool) {
+	return builder.CheckpointLSNs(filepath.Join(v.config.BackupDir, id))
+}
+
+func (v *Validator) isLogicalBackup(id string) bool {
+	_, err := os.Stat(filepath.Join(v.config.BackupDir, id, builder.DumpFileName))
 	return err == nil
 }
+
+func (v *Validator) backupExists(id string) bool {
+	for _, backupPath := range builder.BackupPaths(v.config, id) {
+		if _, err := os.Stat(backupPath); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateProcessUsage checks the pid and command of the process to read the usage of
+func validateProcessUsage(args map[string]interface{}) ValidationResult {
+	pid, ok := args["pid"].(float64)
+	if !ok || pid < 1 || pid != float64(int(pid)) {
+		return ValidationResult{Code: StatusBadRequest, Message: "pid must be a positive integer"}
+	}
+	if command, ok := args["command"].(string); !ok || command == "" {
+		return ValidationResult{Code: StatusBadRequest, Message: "Missing required argument: command"}
+	}
+	return ValidationResult{Code: StatusOK}
+}
@@ -0,0 +1,386 @@
+package validator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/martijn/dbcalm-db-cmd/db-cmd-internal/config"
+)
+
+func TestValidateBackupDir(t *testing.T) {
+	root := t.TempDir()
+	credentialsFile := filepath.Join(root, "credentials.cnf")
+	if err := os.WriteFile(credentialsFile, []byte("[client-dbcalm]\nuser=backup\n"), 0600); err != nil {
+		t.Fatalf("failed to write credentials file: %v", err)
+	}
+
+	notADir := filepath.Join(root, "not-a-dir")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	readOnly := filepath.Join(root, "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		backupDir string
+		message   string
+		skip      bool
+	}{
+		{name: "missing", backupDir: filepath.Join(root, "missing"), message: "does not exist"},
+		{name: "not a directory", backupDir: notADir, message: "is not a directory"},
+		// root writes through directory permissions
+		{name: "read-only", backupDir: readOnly, message: "is not writable", skip: os.Geteuid() == 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.skip {
+				t.Skip("directory permissions don't apply to root")
+			}
+			v := NewValidator(&config.Config{
+				DbType:                "mariadb",
+				BackupDir:             tt.backupDir,
+				BackupCredentialsFile: credentialsFile,
+				CredentialsSuffix:     config.DefaultCredentialsSuffix,
+			})
+
+			result := v.Validate("full_backup", map[string]interface{}{"id": "backup-1"})
+			if result.Code != StatusServiceUnavailable {
+				t.Fatalf("expected status %d, got %d (%s)", StatusServiceUnavailable, result.Code, result.Message)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("expected message to contain %q, got %q", tt.message, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateFreeInodes(t *testing.T) {
+	root := t.TempDir()
+	credentialsFile := filepath.Join(root, "credentials.cnf")
+	if err := os.WriteFile(credentialsFile, []byte("[client-dbcalm]\nuser=backup\n"), 0600); err != nil {
+		t.Fatalf("failed to write credentials file: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		minFreeInodes uint64
+		files         uint64
+		ffree         uint64
+		expectRefused bool
+	}{
+		{name: "enough free inodes", minFreeInodes: 1000, files: 100000, ffree: 1000},
+		{name: "too few free inodes", minFreeInodes: 1000, files: 100000, ffree: 999, expectRefused: true},
+		{name: "no inode counts reported", minFreeInodes: 1000, files: 0, ffree: 0},
+		{name: "check disabled", minFreeInodes: 0, files: 100000, ffree: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewValidator(&config.Config{
+				DbType:                "mariadb",
+				BackupDir:             root,
+				BackupCredentialsFile: credentialsFile,
+				CredentialsSuffix:     config.DefaultCredentialsSuffix,
+				MinFreeInodes:         tt.minFreeInodes,
+			})
+			v.statfs = func(path string, buf *syscall.Statfs_t) error {
+				if path != root {
+					t.Errorf("expected the backup directory to be checked, got %s", path)
+				}
+				buf.Files = tt.files
+				buf.Ffree = tt.ffree
+				return nil
+			}
+
+			// Past the inode check the backup is refused for the server not running in the test
+			result := v.Validate("full_backup", map[string]interface{}{"id": "backup-1"})
+			refused := strings.Contains(result.Message, "free inodes")
+			if refused != tt.expectRefused {
+				t.Fatalf("expected refused %v, got %d (%s)", tt.expectRefused, result.Code, result.Message)
+			}
+			if refused && result.Code != StatusServiceUnavailable {
+				t.Errorf("expected status %d, got %d", StatusServiceUnavailable, result.Code)
+			}
+		})
+	}
+}
+
+func TestValidateCredentialsPermissions(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          os.FileMode
+		policy        string
+		expectRefused bool
+	}{
+		{name: "owner only", mode: 0600, policy: config.CredentialsPermissionsRefuse},
+		{name: "group readable", mode: 0640, policy: config.CredentialsPermissionsRefuse},
+		{name: "world readable refused", mode: 0644, policy: config.CredentialsPermissionsRefuse, expectRefused: true},
+		{name: "group writable refused", mode: 0660, policy: config.CredentialsPermissionsRefuse, expectRefused: true},
+		{name: "world readable warned", mode: 0644, policy: config.CredentialsPermissionsWarn},
+		{name: "world readable ignored", mode: 0644, policy: config.CredentialsPermissionsIgnore},
+		{name: "unset policy warns", mode: 0644},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			credentialsFile := filepath.Join(root, "credentials.cnf")
+			if err := os.WriteFile(credentialsFile, []byte("[client-dbcalm]\nuser=backup\npassword=secret\n"), 0600); err != nil {
+				t.Fatalf("failed to write credentials file: %v", err)
+			}
+			if err := os.Chmod(credentialsFile, tt.mode); err != nil {
+				t.Fatalf("failed to chmod credentials file: %v", err)
+			}
+
+			v := NewValidator(&config.Config{
+				DbType:                 "mariadb",
+				BackupDir:              root,
+				BackupCredentialsFile:  credentialsFile,
+				CredentialsSuffix:      config.DefaultCredentialsSuffix,
+				CredentialsPermissions: tt.policy,
+			})
+
+			// Past the permission check the backup is refused for the server not running in the test
+			result := v.Validate("full_backup", map[string]interface{}{"id": "backup-1"})
+			refused := strings.Contains(result.Message, "credentials file")
+			if refused != tt.expectRefused {
+				t.Fatalf("expected refused %v, got %d (%s)", tt.expectRefused, result.Code, result.Message)
+			}
+			if refused && (result.Code != StatusServiceUnavailable || !strings.Contains(result.Message, fmt.Sprintf("%04o", tt.mode))) {
+				t.Errorf("expected a 503 naming mode %04o, got %d (%s)", tt.mode, result.Code, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateTargetPath(t *testing.T) {
+	root := t.TempDir()
+	backupDir := filepath.Join(root, "backups")
+	if err := os.MkdirAll(filepath.Join(backupDir, "restores"), 0755); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+
+	nonEmpty := filepath.Join(root, "non-empty")
+	if err := os.MkdirAll(nonEmpty, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(nonEmpty, "ibdata1"), nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	// A link pointing into the backup directory is as nested as the directory itself
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(filepath.Join(backupDir, "restores"), link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		code    int
+		message string
+	}{
+		{name: "backup directory itself", path: backupDir, code: StatusBadRequest, message: "inside the backup directory"},
+		{name: "nested in backup directory", path: filepath.Join(backupDir, "restores", "new"), code: StatusBadRequest, message: "inside the backup directory"},
+		{name: "dot segments into backup directory", path: filepath.Join(root, "empty", "..", "backups", "x"), code: StatusBadRequest, message: "inside the backup directory"},
+		{name: "symlink into backup directory", path: filepath.Join(link, "new"), code: StatusBadRequest, message: "inside the backup directory"},
+		{name: "relative", path: "restores/new", code: StatusBadRequest, message: "absolute path"},
+		{name: "non-empty", path: nonEmpty, code: StatusConflict, message: "is not empty"},
+		{name: "missing parent", path: filepath.Join(root, "missing", "new"), code: StatusBadRequest, message: "parent directory is missing"},
+		{name: "empty directory", path: empty, code: StatusOK},
+		{name: "creatable", path: filepath.Join(root, "new"), code: StatusOK},
+		{name: "sibling with backup directory prefix", path: backupDir + "-restore", code: StatusOK},
+	}
+
+	v := NewValidator(&config.Config{DbType: "mariadb", BackupDir: backupDir})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.validateTargetPath(tt.path)
+			if result.Code != tt.code {
+				t.Fatalf("expected status %d, got %d (%s)", tt.code, result.Code, result.Message)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("expected message to contain %q, got %q", tt.message, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsTraversalBackupIDs(t *testing.T) {
+	root := t.TempDir()
+	backupDir := filepath.Join(root, "backups")
+	// Targets a traversal could otherwise find and report as existing backups
+	for _, dir := range []string{filepath.Join(backupDir, "full"), filepath.Join(root, "etc")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+	}
+	v := NewValidator(&config.Config{DbType: "mariadb", BackupDir: backupDir})
+
+	for _, id := range []string{"../etc", "..", ".", "full/../../etc", "/etc", "full\x00", ".hidden", strings.Repeat("a", 129)} {
+		requests := map[string]map[string]interface{}{
+			"full_backup":        {"id": id},
+			"incremental_backup": {"id": "incr", "from_backup_id": id},
+			"restore_backup":     {"id_list": []interface{}{"full", id}, "target": "folder"},
+			"consolidate_backup": {"id": "consolidated", "id_list": []interface{}{"full", id}},
+		}
+		for cmd, args := range requests {
+			result := v.Validate(cmd, args)
+			if result.Code != StatusBadRequest || !strings.Contains(result.Message, "invalid backup id") {
+				t.Errorf("%s with id %q: expected an invalid backup id 400, got %d (%s)", cmd, id, result.Code, result.Message)
+			}
+		}
+	}
+}
+
+func TestValidateRestoreChainOrder(t *testing.T) {
+	backupDir := t.TempDir()
+	checkpoints := map[string]string{
+		"full":   "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 100\n",
+		"incr-a": "backup_type = incremental\nfrom_lsn = 100\nto_lsn = 200\n",
+		"incr-b": "backup_type = incremental\nfrom_lsn = 200\nto_lsn = 300\n",
+	}
+	for id, content := range checkpoints {
+		if err := os.MkdirAll(filepath.Join(backupDir, id), 0755); err != nil {
+			t.Fatalf("failed to create backup: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(backupDir, id, "xtrabackup_checkpoints"), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write checkpoints: %v", err)
+		}
+	}
+	v := NewValidator(&config.Config{DbType: "mariadb", BackupDir: backupDir})
+
+	tests := []struct {
+		name     string
+		idList   []interface{}
+		expected int
+	}{
+		{name: "chain in order", idList: []interface{}{"full", "incr-a", "incr-b"}, expected: StatusOK},
+		{name: "incrementals swapped", idList: []interface{}{"full", "incr-b", "incr-a"}, expected: StatusConflict},
+		{name: "incremental skipped", idList: []interface{}{"full", "incr-b"}, expected: StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.Validate("restore_backup", map[string]interface{}{"id_list": tt.idList, "target": "folder"})
+			if result.Code != tt.expected {
+				t.Errorf("expected %d, got %d (%s)", tt.expected, result.Code, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateRestoreDatabases(t *testing.T) {
+	backupDir := t.TempDir()
+	for _, dir := range []string{"full/shop", "full/mysql", "dump", "unlisted"} {
+		if err := os.MkdirAll(filepath.Join(backupDir, dir), 0755); err != nil {
+			t.Fatalf("failed to create backup: %v", err)
+		}
+	}
+	for _, file := range []string{"dump/dump.sql.gz", "unlisted/dump.sql.gz"} {
+		if err := os.WriteFile(filepath.Join(backupDir, file), nil, 0644); err != nil {
+			t.Fatalf("failed to create dump: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(backupDir, "dump", "dump.databases"), []byte("mysql\nshop\n"), 0644); err != nil {
+		t.Fatalf("failed to write database list: %v", err)
+	}
+
+	v := NewValidator(&config.Config{DbType: "mariadb", BackupDir: backupDir})
+
+	tests := []struct {
+		name      string
+		id        string
+		target    string
+		mode      string
+		databases []interface{}
+		expected  int
+	}{
+		{name: "database in physical backup", id: "full", target: "folder", mode: "physical", databases: []interface{}{"shop"}, expected: StatusOK},
+		{name: "database missing from physical backup", id: "full", target: "folder", mode: "physical", databases: []interface{}{"crm"}, expected: StatusNotFound},
+		{name: "physical restore to the database", id: "full", target: "database", mode: "physical", databases: []interface{}{"shop"}, expected: StatusBadRequest},
+		{name: "invalid name", id: "full", target: "folder", mode: "physical", databases: []interface{}{"shop; rm -rf /"}, expected: StatusBadRequest},
+		{name: "dump without a list", id: "unlisted", target: "database", mode: "logical", databases: []interface{}{"shop"}, expected: StatusBadRequest},
+		{name: "database missing from dump", id: "dump", target: "database", mode: "logical", databases: []interface{}{"crm"}, expected: StatusNotFound},
+		// Gets past the selection to the check for a running server
+		{name: "database in dump", id: "dump", target: "database", mode: "logical", databases: []interface{}{"shop"}, expected: StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := v.Validate("restore_backup", map[string]interface{}{
+				"id_list": []interface{}{tt.id}, "target": tt.target, "restore_mode": tt.mode, "databases": tt.databases,
+			})
+			if result.Code != tt.expected {
+				t.Errorf("expected %d, got %d (%s)", tt.expected, result.Code, result.Message)
+			}
+		})
+	}
+}
+
+func TestValidateDataDirAllowlist(t *testing.T) {
+	backupDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(backupDir, "full"), 0755); err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	checkpoints := "backup_type = full-backuped\nfrom_lsn = 0\nto_lsn = 100\n"
+	if err := os.WriteFile(filepath.Join(backupDir, "full", "xtrabackup_checkpoints"), []byte(checkpoints), 0644); err != nil {
+		t.Fatalf("failed to write checkpoints: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		files         []string
+		allowlist     []string
+		check         string
+		expectRefused bool
+	}{
+		{name: "built-in leftovers", files: []string{"ibdata1", "ib_logfile0", "mysqld.pid", "host.err"}},
+		{name: "undo tablespaces refused", files: []string{"ibdata1", "undo001", "undo002"}, expectRefused: true},
+		{name: "undo tablespaces allowed", files: []string{"ibdata1", "undo001", "undo002"}, allowlist: []string{"undo*"}},
+		{name: "allowlist only covers its pattern", files: []string{"undo001", "shop"}, allowlist: []string{"undo*"}, expectRefused: true},
+		{name: "warned", files: []string{"undo001"}, check: config.DataDirCheckWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dataDir, name), nil, 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+			v := NewValidator(&config.Config{
+				DbType:           "mariadb",
+				BackupDir:        backupDir,
+				DataDir:          dataDir,
+				DataDirAllowlist: tt.allowlist,
+				DataDirCheck:     tt.check,
+			})
+
+			// The server isn't running in the test, so the restore gets to the data directory check
+			result := v.Validate("restore_backup", map[string]interface{}{"id_list": []interface{}{"full"}, "target": "database"})
+			refused := strings.Contains(result.Message, "not empty")
+			if refused != tt.expectRefused {
+				t.Fatalf("expected refused %v, got %d (%s)", tt.expectRefused, result.Code, result.Message)
+			}
+			if !refused && result.Code != StatusOK {
+				t.Errorf("expected %d, got %d (%s)", StatusOK, result.Code, result.Message)
+			}
+			if refused && (result.Code != StatusServiceUnavailable || !strings.Contains(result.Message, tt.files[len(tt.files)-1])) {
+				t.Errorf("expected a 503 naming %s, got %d (%s)", tt.files[len(tt.files)-1], result.Code, result.Message)
+			}
+		})
+	}
+}
@@ -10,7 +10,9 @@ import (
 // OpenDB opens a SQLite connection with proper concurrency settings.
 // All cmd services should use this instead of sql.Open directly.
 func OpenDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// The app's catalog triggers bring every timestamp into one format, they need times
+	// written in a format SQLite parses rather than the driver's default time.Time.String()
+	db, err := sql.Open("sqlite", dbPath+"?_time_format=sqlite")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
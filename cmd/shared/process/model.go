@@ -24,4 +24,31 @@ type Process struct {
 	Type       string                 `db:"type" json:"type"`
 	Args       map[string]interface{} `json:"args"`
 	ArgsJSON   string                 `db:"args"` // For database storage
+	// Steps holds the commands a consecutive run got through, set on its final process
+	Steps []Step `json:"-"`
+}
+
+// Step is the timing of one command of a consecutive run
+type Step struct {
+	Command   string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// Duration is how long the step's command ran
+func (s Step) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// Failed reports whether the process ended unsuccessfully. The runner decides that from
+// the success exit codes of the command type; a process without a final status falls
+// back to a non-zero return code.
+func (p *Process) Failed() bool {
+	switch p.Status {
+	case StatusFailed:
+		return true
+	case StatusSuccess:
+		return false
+	}
+	return p.ReturnCode != nil && *p.ReturnCode != 0
 }
@@ -0,0 +1,53 @@
+package process
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream. Captured output is text, so a stored value starting
+// with it is compressed.
+const gzipMagic = "\x1f\x8b"
+
+// encodeOutput returns the value to store for captured output: gzipped bytes when
+// compression is enabled and the output is at least minSize bytes, the plain text otherwise
+func encodeOutput(output *string, minSize int) (interface{}, error) {
+	if output == nil {
+		return nil, nil
+	}
+	if minSize <= 0 || len(*output) < minSize {
+		return *output, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(*output)); err != nil {
+		return nil, fmt.Errorf("failed to compress output: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress output: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeOutput returns the text of stored output, decompressing it when it was gzipped
+func decodeOutput(stored string) (string, error) {
+	if !strings.HasPrefix(stored, gzipMagic) {
+		return stored, nil
+	}
+
+	zr, err := gzip.NewReader(strings.NewReader(stored))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress output: %w", err)
+	}
+	defer zr.Close()
+
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress output: %w", err)
+	}
+	return string(text), nil
+}
@@ -0,0 +1,62 @@
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputRoundTrip(t *testing.T) {
+	long := strings.Repeat("[00] Copying ./ibdata1 to /backups/ibdata1\n", 200)
+	short := "completed OK!"
+
+	tests := []struct {
+		name           string
+		output         string
+		minSize        int
+		expectCompress bool
+	}{
+		{name: "long output is compressed", output: long, minSize: 4096, expectCompress: true},
+		{name: "output below the threshold stays text", output: short, minSize: 4096},
+		{name: "compression disabled", output: long},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := encodeOutput(&tt.output, tt.minSize)
+			if err != nil {
+				t.Fatalf("encodeOutput failed: %v", err)
+			}
+
+			var storedText string
+			switch v := stored.(type) {
+			case []byte:
+				if !tt.expectCompress {
+					t.Fatal("expected output to be stored as text")
+				}
+				if len(v) >= len(tt.output) {
+					t.Errorf("expected compressed output to be smaller, got %d bytes for %d", len(v), len(tt.output))
+				}
+				storedText = string(v)
+			case string:
+				if tt.expectCompress {
+					t.Fatal("expected output to be compressed")
+				}
+				storedText = v
+			default:
+				t.Fatalf("unexpected stored type %T", stored)
+			}
+
+			decoded, err := decodeOutput(storedText)
+			if err != nil {
+				t.Fatalf("decodeOutput failed: %v", err)
+			}
+			if decoded != tt.output {
+				t.Errorf("round trip changed the output")
+			}
+		})
+	}
+
+	if stored, err := encodeOutput(nil, 1); err != nil || stored != nil {
+		t.Errorf("expected nil output to stay NULL, got %v, %v", stored, err)
+	}
+}
@@ -3,22 +3,151 @@ package process
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	DefaultStatusRetryAttempts = 5
+	DefaultStatusRetryBackoff  = 200 * time.Millisecond
+)
+
 type Runner struct {
 	writer *Writer
+	// env holds extra KEY=VALUE entries for the commands, overriding the cleaned environment
+	env []string
+	// allowed holds the executables commands may start with, nil allows any
+	allowed map[string]bool
+	// statusAttempts and statusBackoff retry the final status update of a process,
+	// which a momentary lock on the catalog can fail
+	statusAttempts int
+	statusBackoff  time.Duration
+	// statusFallback is the file a final status goes to once every attempt failed
+	statusFallback string
+	// updateStatus writes a final status, the writer's UpdateProcessStatus
+	updateStatus func(processID int, status string, output, errorMsg *string, returnCode *int, endTime *time.Time) error
+	// successCodes holds the exit codes besides 0 a command type succeeds with
+	successCodes map[string]map[int]bool
+	// timeouts holds how long a command of a type may run before it is killed
+	timeouts map[string]time.Duration
 }
 
 func NewRunner(writer *Writer) *Runner {
-	return &Runner{writer: writer}
+	return &Runner{
+		writer:         writer,
+		statusAttempts: DefaultStatusRetryAttempts,
+		statusBackoff:  DefaultStatusRetryBackoff,
+		updateStatus:   writer.UpdateProcessStatus,
+	}
+}
+
+// SetStatusRetry sets how often the final status of a process is written before giving
+// up, the backoff doubling after every attempt. A status that still can't be written is
+// appended to fallbackPath for ReconcileStatuses, empty only logs it.
+func (r *Runner) SetStatusRetry(attempts int, backoff time.Duration, fallbackPath string) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	r.statusAttempts = attempts
+	r.statusBackoff = backoff
+	r.statusFallback = fallbackPath
+}
+
+// SetSuccessExitCodes sets the exit codes, per command type, that count as success
+// besides 0, for tools that exit non-zero after finishing with warnings. Any other
+// exit code, or being killed by a signal, fails the process. They don't apply to shell
+// scripts (sh -c), whose exit code can be that of any command in them, such a script
+// applies them to the tool it runs itself.
+func (r *Runner) SetSuccessExitCodes(codes map[string][]int) {
+	r.successCodes = make(map[string]map[int]bool, len(codes))
+	for commandType, typeCodes := range codes {
+		r.successCodes[commandType] = make(map[int]bool, len(typeCodes))
+		for _, code := range typeCodes {
+			r.successCodes[commandType][code] = true
+		}
+	}
+}
+
+// SetTimeouts sets how long a command may run, per command type, before it is killed
+// and fails. Every command of a consecutive run gets the full timeout. Types without
+// a timeout run as long as they take.
+func (r *Runner) SetTimeouts(timeouts map[string]time.Duration) {
+	r.timeouts = timeouts
+}
+
+// succeeded reports whether command, which exited with returnCode and Wait returning
+// err, succeeded for its command type
+func (r *Runner) succeeded(command []string, commandType string, returnCode int, err error) bool {
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return false
+	}
+	if returnCode == 0 {
+		return true
+	}
+	return !isShellScript(command) && r.successCodes[commandType][returnCode]
+}
+
+// isShellScript reports whether command runs a script in the shell
+func isShellScript(command []string) bool {
+	return len(command) > 1 && filepath.Base(command[0]) == "sh" && command[1] == "-c"
+}
+
+// SetEnv adds KEY=VALUE entries to the environment of every command, for example a locale
+// or plugin directory the backup tools need. An entry overrides the same key in the cleaned
+// environment, including LD_LIBRARY_PATH.
+func (r *Runner) SetEnv(env []string) {
+	r.env = env
+}
+
+// SetAllowedExecutables restricts the runner to commands whose executable (argv[0]) is
+// one of the given paths, exactly as the builders produce them. Anything else fails
+// before it is started.
+func (r *Runner) SetAllowedExecutables(executables []string) {
+	r.allowed = make(map[string]bool, len(executables))
+	for _, executable := range executables {
+		r.allowed[executable] = true
+	}
+}
+
+func (r *Runner) checkAllowed(command []string) error {
+	if len(command) == 0 || command[0] == "" {
+		return fmt.Errorf("empty command")
+	}
+	if r.allowed != nil && !r.allowed[command[0]] {
+		return fmt.Errorf("executable not allowed: %s", command[0])
+	}
+	return nil
+}
+
+// failedToStart is the failed process reported for a command that never ran
+func failedToStart(command []string, commandID, commandType string, args map[string]interface{}, err error) *Process {
+	now := time.Now()
+	errMsg := err.Error()
+	returnCode := -1
+
+	return &Process{
+		Command:    strings.Join(command, " "),
+		CommandID:  commandID,
+		PID:        0,
+		Status:     StatusFailed,
+		Error:      &errMsg,
+		ReturnCode: &returnCode,
+		StartTime:  now,
+		EndTime:    &now,
+		Type:       commandType,
+		Args:       args,
+	}
 }
 
 func (r *Runner) Execute(command []string, commandType string, commandID *string, args map[string]interface{}) (*Process, chan *Process) {
@@ -30,38 +159,30 @@ func (r *Runner) Execute(command []string, commandType string, commandID *string
 
 	processChan := make(chan *Process, 1)
 
+	if err := r.checkAllowed(command); err != nil {
+		log.Printf("Refusing to run command: %v", err)
+		process := failedToStart(command, *commandID, commandType, args, err)
+		processChan <- process
+		return process, processChan
+	}
+
 	// Start command
 	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Env = getCleanEnvForSystemBinaries()
+	cmd.Env = cleanEnvForSystemBinaries(os.Environ(), runtime.GOARCH, r.env)
 
 	// Capture output
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	deadline := r.newDeadline(cmd, commandType)
 
 	err := cmd.Start()
 	if err != nil {
-		// Create failed process
-		now := time.Now()
-		errMsg := err.Error()
-		returnCode := -1
-		
-		process := &Process{
-			Command:    strings.Join(command, " "),
-			CommandID:  *commandID,
-			PID:        0,
-			Status:     StatusFailed,
-			Error:      &errMsg,
-			ReturnCode: &returnCode,
-			StartTime:  now,
-			EndTime:    &now,
-			Type:       commandType,
-			Args:       args,
-		}
-
+		process := failedToStart(command, *commandID, commandType, args, err)
 		processChan <- process
 		return process, processChan
 	}
+	deadline.start(cmd)
 
 	pid := cmd.Process.Pid
 	startTime := time.Now()
@@ -96,29 +217,38 @@ func (r *Runner) Execute(command []string, commandType string, commandID *string
 	}
 
 	// Start goroutine to wait for completion
-	go r.waitForCompletion(cmd, process, &stdout, &stderr, processChan)
+	go r.waitForCompletion(cmd, process, &stdout, &stderr, deadline, processChan)
 
 	return process, processChan
 }
 
-func (r *Runner) waitForCompletion(cmd *exec.Cmd, process *Process, stdout, stderr *bytes.Buffer, processChan chan *Process) {
+func (r *Runner) waitForCompletion(cmd *exec.Cmd, process *Process, stdout, stderr *bytes.Buffer, deadline *deadline, processChan chan *Process) {
 	defer close(processChan)
 
 	// Wait for command to complete
 	err := cmd.Wait()
+	timedOut, timeoutMsg := deadline.stop()
 	endTime := time.Now()
 	process.EndTime = &endTime
 
 	// Get output
 	outputStr := stdout.String()
 	errorStr := stderr.String()
+	if timedOut {
+		if errorStr != "" {
+			errorStr += "\n"
+		}
+		errorStr += timeoutMsg
+	}
 
 	// Get return code
 	returnCode := cmd.ProcessState.ExitCode()
 	process.ReturnCode = &returnCode
 
+	success := !timedOut && r.succeeded(cmd.Args, process.Type, returnCode, err)
+
 	// Match Python's behavior: combine on success, separate on failure
-	if returnCode == 0 {
+	if success {
 		// Success: combine stdout and stderr into output field
 		var combinedOutput string
 		if outputStr != "" {
@@ -145,25 +275,15 @@ func (r *Runner) waitForCompletion(cmd *exec.Cmd, process *Process, stdout, stde
 	}
 
 	// Update status
-	if err != nil || returnCode != 0 {
-		process.Status = StatusFailed
-	} else {
+	if success {
 		process.Status = StatusSuccess
+	} else {
+		process.Status = StatusFailed
 	}
 
 	// Update database
 	if process.ID != nil {
-		err := r.writer.UpdateProcessStatus(
-			*process.ID,
-			process.Status,
-			process.Output,
-			process.Error,
-			process.ReturnCode,
-			process.EndTime,
-		)
-		if err != nil {
-			log.Printf("Failed to update process status: %v", err)
-		}
+		r.recordStatus(process, process.Output, process.Error)
 	}
 
 	// Send completed process to channel
@@ -189,6 +309,7 @@ func (r *Runner) runCommandsSequentially(commands [][]string, commandType string
 	defer close(hasOneChan)
 
 	var lastProcess *Process
+	var steps []Step
 
 	for i, command := range commands {
 		// Execute command
@@ -203,8 +324,14 @@ func (r *Runner) runCommandsSequentially(commands [][]string, commandType string
 		completedProcess := <-processChan
 		lastProcess = completedProcess
 
+		step := Step{Command: completedProcess.Command, StartTime: completedProcess.StartTime, EndTime: completedProcess.StartTime}
+		if completedProcess.EndTime != nil {
+			step.EndTime = *completedProcess.EndTime
+		}
+		steps = append(steps, step)
+
 		// Stop on first failure
-		if completedProcess.ReturnCode != nil && *completedProcess.ReturnCode != 0 {
+		if completedProcess.Failed() {
 			log.Printf("Command failed with return code %d, stopping execution", *completedProcess.ReturnCode)
 			break
 		}
@@ -212,24 +339,54 @@ func (r *Runner) runCommandsSequentially(commands [][]string, commandType string
 
 	// Send final process to master channel
 	if lastProcess != nil {
+		lastProcess.Steps = steps
 		masterChan <- lastProcess
 	}
 }
 
-func getCleanEnvForSystemBinaries() []string {
-	env := os.Environ()
+// multiarchTriplets maps GOARCH to the Debian multiarch library directory name
+var multiarchTriplets = map[string]string{
+	"amd64":   "x86_64-linux-gnu",
+	"arm64":   "aarch64-linux-gnu",
+	"arm":     "arm-linux-gnueabihf",
+	"386":     "i386-linux-gnu",
+	"ppc64le": "powerpc64le-linux-gnu",
+	"s390x":   "s390x-linux-gnu",
+	"riscv64": "riscv64-linux-gnu",
+}
+
+// systemLibraryPath is the LD_LIBRARY_PATH system binaries are run with on goarch
+func systemLibraryPath(goarch string) string {
+	if triplet, ok := multiarchTriplets[goarch]; ok {
+		return "/usr/lib/" + triplet + ":/usr/lib:/lib"
+	}
+	return "/usr/lib:/lib"
+}
 
+func cleanEnvForSystemBinaries(environ []string, goarch string, extra []string) []string {
 	// Check if we're running from a compiled binary (equivalent to PyInstaller frozen check)
 	// In Go, we can check if LD_LIBRARY_PATH is set and reset it
 	var cleanEnv []string
-	for _, e := range env {
+	for _, e := range environ {
 		if !strings.HasPrefix(e, "LD_LIBRARY_PATH=") {
 			cleanEnv = append(cleanEnv, e)
 		}
 	}
 
 	// Set clean LD_LIBRARY_PATH for system binaries
-	cleanEnv = append(cleanEnv, "LD_LIBRARY_PATH=/usr/lib/x86_64-linux-gnu:/usr/lib:/lib")
+	cleanEnv = append(cleanEnv, "LD_LIBRARY_PATH="+systemLibraryPath(goarch))
+
+	// Configured entries replace any inherited value of the same key
+	for _, entry := range extra {
+		key := strings.SplitN(entry, "=", 2)[0] + "="
+		kept := cleanEnv[:0]
+		for _, e := range cleanEnv {
+			if !strings.HasPrefix(e, key) {
+				kept = append(kept, e)
+			}
+		}
+		cleanEnv = append(kept, entry)
+	}
 
 	return cleanEnv
 }
@@ -243,38 +400,31 @@ func (r *Runner) ExecuteWithStreaming(command []string, commandType string, comm
 
 	processChan := make(chan *Process, 1)
 
+	if err := r.checkAllowed(command); err != nil {
+		log.Printf("Refusing to run command: %v", err)
+		process := failedToStart(command, *commandID, commandType, args, err)
+		processChan <- process
+		return process, processChan
+	}
+
 	// Start command
 	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Env = getCleanEnvForSystemBinaries()
+	cmd.Env = cleanEnvForSystemBinaries(os.Environ(), runtime.GOARCH, r.env)
 
 	// Set output to writer if provided
 	if outputWriter != nil {
 		cmd.Stdout = outputWriter
 		cmd.Stderr = outputWriter
 	}
+	deadline := r.newDeadline(cmd, commandType)
 
 	err := cmd.Start()
 	if err != nil {
-		now := time.Now()
-		errMsg := err.Error()
-		returnCode := -1
-
-		process := &Process{
-			Command:    strings.Join(command, " "),
-			CommandID:  *commandID,
-			PID:        0,
-			Status:     StatusFailed,
-			Error:      &errMsg,
-			ReturnCode: &returnCode,
-			StartTime:  now,
-			EndTime:    &now,
-			Type:       commandType,
-			Args:       args,
-		}
-
+		process := failedToStart(command, *commandID, commandType, args, err)
 		processChan <- process
 		return process, processChan
 	}
+	deadline.start(cmd)
 
 	pid := cmd.Process.Pid
 	startTime := time.Now()
@@ -309,16 +459,17 @@ func (r *Runner) ExecuteWithStreaming(command []string, commandType string, comm
 	}
 
 	// Start goroutine to wait for completion (without capturing output)
-	go r.waitForCompletionNoCapture(cmd, process, processChan)
+	go r.waitForCompletionNoCapture(cmd, process, deadline, processChan)
 
 	return process, processChan
 }
 
-func (r *Runner) waitForCompletionNoCapture(cmd *exec.Cmd, process *Process, processChan chan *Process) {
+func (r *Runner) waitForCompletionNoCapture(cmd *exec.Cmd, process *Process, deadline *deadline, processChan chan *Process) {
 	defer close(processChan)
 
 	// Wait for command to complete
 	err := cmd.Wait()
+	timedOut, timeoutMsg := deadline.stop()
 	endTime := time.Now()
 	process.EndTime = &endTime
 
@@ -327,25 +478,18 @@ func (r *Runner) waitForCompletionNoCapture(cmd *exec.Cmd, process *Process, pro
 	process.ReturnCode = &returnCode
 
 	// Update status
-	if err != nil || returnCode != 0 {
-		process.Status = StatusFailed
-	} else {
+	if !timedOut && r.succeeded(cmd.Args, process.Type, returnCode, err) {
 		process.Status = StatusSuccess
+	} else {
+		process.Status = StatusFailed
+	}
+	if timedOut {
+		process.Error = &timeoutMsg
 	}
 
-	// Update database
+	// Update database, no output is captured when streaming
 	if process.ID != nil {
-		err := r.writer.UpdateProcessStatus(
-			*process.ID,
-			process.Status,
-			nil, // No output captured when streaming
-			nil,
-			process.ReturnCode,
-			process.EndTime,
-		)
-		if err != nil {
-			log.Printf("Failed to update process status: %v", err)
-		}
+		r.recordStatus(process, nil, process.Error)
 	}
 
 	// Send completed process to channel
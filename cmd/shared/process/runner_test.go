@@ -0,0 +1,197 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanEnvForSystemBinaries(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "LD_LIBRARY_PATH=/opt/dbcalm/lib", "LANG=C"}
+
+	tests := []struct {
+		name     string
+		goarch   string
+		extra    []string
+		expected []string
+	}{
+		{
+			name:     "x86_64 keeps the original library path",
+			goarch:   "amd64",
+			expected: []string{"PATH=/usr/bin", "LANG=C", "LD_LIBRARY_PATH=/usr/lib/x86_64-linux-gnu:/usr/lib:/lib"},
+		},
+		{
+			name:     "arm64 uses the aarch64 library path",
+			goarch:   "arm64",
+			expected: []string{"PATH=/usr/bin", "LANG=C", "LD_LIBRARY_PATH=/usr/lib/aarch64-linux-gnu:/usr/lib:/lib"},
+		},
+		{
+			name:     "unknown architectures fall back to the generic directories",
+			goarch:   "mips",
+			expected: []string{"PATH=/usr/bin", "LANG=C", "LD_LIBRARY_PATH=/usr/lib:/lib"},
+		},
+		{
+			name:     "configured entries are added and override inherited ones",
+			goarch:   "amd64",
+			extra:    []string{"LANG=C.UTF-8", "LD_LIBRARY_PATH=/opt/mariadb/lib", "PLUGIN_DIR=/opt/plugins"},
+			expected: []string{"PATH=/usr/bin", "LANG=C.UTF-8", "LD_LIBRARY_PATH=/opt/mariadb/lib", "PLUGIN_DIR=/opt/plugins"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cleanEnvForSystemBinaries(environ, tt.goarch, tt.extra)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteRejectsDisallowedExecutable(t *testing.T) {
+	runner := NewRunner(nil)
+	runner.SetAllowedExecutables([]string{"/usr/bin/mariabackup", "sh"})
+
+	tests := []struct {
+		name    string
+		command []string
+	}{
+		{name: "unlisted binary", command: []string{"/bin/rm", "-rf", "/var/lib/mysql"}},
+		{name: "same binary by another path", command: []string{"mariabackup", "--backup"}},
+		{name: "empty command", command: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, execute := range []func() (*Process, chan *Process){
+				func() (*Process, chan *Process) { return runner.Execute(tt.command, "backup", nil, nil) },
+				func() (*Process, chan *Process) {
+					return runner.ExecuteWithStreaming(tt.command, "backup", nil, nil, nil)
+				},
+			} {
+				proc, procChan := execute()
+				if proc.Status != StatusFailed || proc.PID != 0 {
+					t.Errorf("expected the command to fail without starting, got status %s pid %d", proc.Status, proc.PID)
+				}
+				if proc.Error == nil || *proc.Error == "" {
+					t.Errorf("expected an error explaining the rejection")
+				}
+				if completed := <-procChan; completed != proc {
+					t.Errorf("expected the rejected process on the channel")
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteConsecutiveRecordsStepTimings(t *testing.T) {
+	// The process table is missing, the runner logs that and runs the commands anyway
+	runner := NewRunner(NewWriter(filepath.Join(t.TempDir(), "db.sqlite3")))
+
+	_, procChan := runner.ExecuteConsecutive([][]string{{"sleep", "0.1"}, {"true"}}, "restore", map[string]interface{}{})
+	proc := <-procChan
+
+	if len(proc.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(proc.Steps))
+	}
+	if proc.Steps[0].Command != "sleep 0.1" || proc.Steps[1].Command != "true" {
+		t.Errorf("expected the steps in command order, got %q and %q", proc.Steps[0].Command, proc.Steps[1].Command)
+	}
+	if got := proc.Steps[0].Duration(); got < 100*time.Millisecond {
+		t.Errorf("expected the first step to take at least 100ms, got %s", got)
+	}
+	if proc.Steps[1].StartTime.Before(proc.Steps[0].EndTime) {
+		t.Errorf("expected the second step to start after the first ended")
+	}
+}
+
+func TestExecuteSuccessExitCodes(t *testing.T) {
+	runner := NewRunner(NewWriter(filepath.Join(t.TempDir(), "db.sqlite3")))
+	runner.SetStatusRetry(1, 0, "")
+	runner.SetSuccessExitCodes(map[string][]int{"backup": {1}})
+
+	// A tool exiting with the code it is given, the codes don't apply to shell scripts
+	tool := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho warning >&2\nexit $1\n"), 0755); err != nil {
+		t.Fatalf("failed to write tool: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		command     []string
+		commandType string
+		expected    string
+	}{
+		{name: "zero always succeeds", command: []string{"sh", "-c", "exit 0"}, commandType: "restore", expected: StatusSuccess},
+		{name: "configured code succeeds", command: []string{tool, "1"}, commandType: "backup", expected: StatusSuccess},
+		{name: "code configured for another type fails", command: []string{tool, "1"}, commandType: "restore", expected: StatusFailed},
+		{name: "unconfigured code fails", command: []string{tool, "2"}, commandType: "backup", expected: StatusFailed},
+		{name: "shell script keeps its exit code", command: []string{"sh", "-c", "echo data | (exit 1)"}, commandType: "backup", expected: StatusFailed},
+		{name: "killed by a signal fails", command: []string{"sh", "-c", "kill -9 $$"}, commandType: "backup", expected: StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, procChan := runner.Execute(tt.command, tt.commandType, nil, map[string]interface{}{})
+			proc := <-procChan
+			if proc.Status != tt.expected {
+				t.Errorf("expected status %s, got %s (return code %d)", tt.expected, proc.Status, *proc.ReturnCode)
+			}
+			if proc.Failed() != (tt.expected == StatusFailed) {
+				t.Errorf("expected Failed() to match status %s", proc.Status)
+			}
+			if tt.expected == StatusSuccess && proc.Error != nil {
+				t.Errorf("expected a successful process to have no error, got %q", *proc.Error)
+			}
+		})
+	}
+}
+
+func TestExecuteTimeoutsPerType(t *testing.T) {
+	runner := NewRunner(NewWriter(filepath.Join(t.TempDir(), "db.sqlite3")))
+	runner.SetStatusRetry(1, 0, "")
+	runner.SetTimeouts(map[string]time.Duration{"cleanup_backups": 200 * time.Millisecond, "backup": time.Hour})
+
+	tests := []struct {
+		name        string
+		commandType string
+		command     []string
+		expected    string
+	}{
+		{name: "past its deadline", commandType: "cleanup_backups", command: []string{"sh", "-c", "sleep 5 | cat"}, expected: StatusFailed},
+		{name: "within its deadline", commandType: "cleanup_backups", command: []string{"sh", "-c", "exit 0"}, expected: StatusSuccess},
+		{name: "longer deadline of another type", commandType: "backup", command: []string{"sleep", "0.4"}, expected: StatusSuccess},
+		{name: "type without a deadline", commandType: "restore", command: []string{"sleep", "0.4"}, expected: StatusSuccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, execute := range []func() (*Process, chan *Process){
+				func() (*Process, chan *Process) { return runner.Execute(tt.command, tt.commandType, nil, nil) },
+				func() (*Process, chan *Process) {
+					return runner.ExecuteWithStreaming(tt.command, tt.commandType, nil, nil, nil)
+				},
+			} {
+				start := time.Now()
+				_, procChan := execute()
+				proc := <-procChan
+				if proc.Status != tt.expected {
+					t.Errorf("expected status %s, got %s", tt.expected, proc.Status)
+				}
+				if tt.expected == StatusSuccess {
+					continue
+				}
+				// The whole pipeline is killed, not only the shell running it
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("expected the command to be killed at its deadline, ran %s", elapsed)
+				}
+				if proc.Error == nil || !strings.Contains(*proc.Error, "timed out after 200ms") {
+					t.Errorf("expected a timeout error, got %v", proc.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// pendingStatus is a final process status that couldn't be written to the catalog,
+// kept in the fallback file until ReconcileStatuses writes it
+type pendingStatus struct {
+	ProcessID  int        `json:"process_id"`
+	Status     string     `json:"status"`
+	Output     *string    `json:"output,omitempty"`
+	Error      *string    `json:"error,omitempty"`
+	ReturnCode *int       `json:"return_code,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+}
+
+// recordStatus writes a finished process's status, retrying while the catalog is busy
+// so the process isn't left running in it. Once every attempt failed the status goes
+// to the fallback file.
+func (r *Runner) recordStatus(process *Process, output, errorMsg *string) {
+	backoff := r.statusBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.updateStatus(*process.ID, process.Status, output, errorMsg, process.ReturnCode, process.EndTime)
+		if err == nil {
+			return
+		}
+		if attempt >= r.statusAttempts {
+			break
+		}
+		log.Printf("Failed to update process status (attempt %d of %d), retrying: %v", attempt, r.statusAttempts, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	log.Printf("Failed to update process status: %v", err)
+	if r.statusFallback == "" {
+		return
+	}
+	pending := pendingStatus{
+		ProcessID:  *process.ID,
+		Status:     process.Status,
+		Output:     output,
+		Error:      errorMsg,
+		ReturnCode: process.ReturnCode,
+		EndTime:    process.EndTime,
+	}
+	if err := appendPendingStatus(r.statusFallback, pending); err != nil {
+		log.Printf("Failed to keep status of process %d for later: %v", *process.ID, err)
+		return
+	}
+	log.Printf("Kept status %s of process %d in %s for later", process.Status, *process.ID, r.statusFallback)
+}
+
+func appendPendingStatus(path string, pending pendingStatus) error {
+	line, err := json.Marshal(pending)
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReconcileStatuses writes the statuses kept in the fallback file to the catalog and
+// returns how many were written. Those that still fail stay in the file.
+func (r *Runner) ReconcileStatuses() (int, error) {
+	if r.statusFallback == "" {
+		return 0, nil
+	}
+	file, err := os.Open(r.statusFallback)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", r.statusFallback, err)
+	}
+
+	var remaining []pendingStatus
+	written := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var pending pendingStatus
+		if err := json.Unmarshal(scanner.Bytes(), &pending); err != nil {
+			log.Printf("Skipping unreadable entry in %s: %v", r.statusFallback, err)
+			continue
+		}
+		if err := r.updateStatus(pending.ProcessID, pending.Status, pending.Output, pending.Error, pending.ReturnCode, pending.EndTime); err != nil {
+			log.Printf("Failed to write kept status of process %d: %v", pending.ProcessID, err)
+			remaining = append(remaining, pending)
+			continue
+		}
+		written++
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return written, fmt.Errorf("failed to read %s: %w", r.statusFallback, err)
+	}
+
+	if err := os.Remove(r.statusFallback); err != nil {
+		return written, fmt.Errorf("failed to remove %s: %w", r.statusFallback, err)
+	}
+	for _, pending := range remaining {
+		if err := appendPendingStatus(r.statusFallback, pending); err != nil {
+			return written, fmt.Errorf("failed to keep status of process %d: %w", pending.ProcessID, err)
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingUpdates fails the first n status updates like a locked catalog, then records them
+type failingUpdates struct {
+	failures int
+	calls    int
+	written  map[int]string
+}
+
+func (f *failingUpdates) update(processID int, status string, output, errorMsg *string, returnCode *int, endTime *time.Time) error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("database is locked")
+	}
+	f.written[processID] = status
+	return nil
+}
+
+// newStatusRunner runs commands against a catalog without a process table, so every
+// process gets ID 0 and only the injected status updates are looked at
+func newStatusRunner(t *testing.T, updates *failingUpdates, attempts int, fallback string) *Runner {
+	runner := NewRunner(NewWriter(filepath.Join(t.TempDir(), "db.sqlite3")))
+	runner.SetStatusRetry(attempts, time.Millisecond, fallback)
+	runner.updateStatus = updates.update
+	return runner
+}
+
+func TestFinalStatusRetriedOnTransientError(t *testing.T) {
+	updates := &failingUpdates{failures: 2, written: map[int]string{}}
+	fallback := filepath.Join(t.TempDir(), "pending-status.jsonl")
+	runner := newStatusRunner(t, updates, 3, fallback)
+
+	_, procChan := runner.Execute([]string{"true"}, "backup", nil, nil)
+	<-procChan
+
+	if updates.calls != 3 || updates.written[0] != StatusSuccess {
+		t.Errorf("expected the status to be written on the third attempt, got %d calls and %v", updates.calls, updates.written)
+	}
+	if _, err := os.Stat(fallback); !os.IsNotExist(err) {
+		t.Errorf("expected no fallback file once the retry succeeded, got %v", err)
+	}
+}
+
+func TestFinalStatusKeptAndReconciled(t *testing.T) {
+	updates := &failingUpdates{failures: 2, written: map[int]string{}}
+	fallback := filepath.Join(t.TempDir(), "pending-status.jsonl")
+	runner := newStatusRunner(t, updates, 2, fallback)
+
+	_, procChan := runner.Execute([]string{"false"}, "backup", nil, nil)
+	<-procChan
+
+	if len(updates.written) != 0 {
+		t.Fatalf("expected every attempt to fail, got %v", updates.written)
+	}
+	if _, err := os.Stat(fallback); err != nil {
+		t.Fatalf("expected the status in the fallback file, got %v", err)
+	}
+
+	// The next start writes it once the catalog takes writes again
+	written, err := runner.ReconcileStatuses()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 1 || updates.written[0] != StatusFailed {
+		t.Errorf("expected the failed status to be written, got %d written and %v", written, updates.written)
+	}
+	if _, err := os.Stat(fallback); !os.IsNotExist(err) {
+		t.Errorf("expected the fallback file to be removed, got %v", err)
+	}
+}
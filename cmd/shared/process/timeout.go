@@ -0,0 +1,54 @@
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// deadline kills a command, and everything it started, once it runs past the timeout of
+// its command type
+type deadline struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// newDeadline returns the deadline for a command of commandType, nil when the type has
+// no timeout. The command runs in its own process group so a shell pipeline is killed
+// as a whole, which has to be set before it starts.
+func (r *Runner) newDeadline(cmd *exec.Cmd, commandType string) *deadline {
+	timeout := r.timeouts[commandType]
+	if timeout <= 0 {
+		return nil
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return &deadline{timeout: timeout}
+}
+
+// start arms the deadline for the started command
+func (d *deadline) start(cmd *exec.Cmd) {
+	if d == nil {
+		return
+	}
+	pgid := cmd.Process.Pid
+	d.timer = time.AfterFunc(d.timeout, func() {
+		d.expired.Store(true)
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+}
+
+// stop disarms the deadline once the command finished and reports whether it expired,
+// with the error to record for it
+func (d *deadline) stop() (bool, string) {
+	if d == nil || d.timer == nil {
+		return false, ""
+	}
+	d.timer.Stop()
+	if !d.expired.Load() {
+		return false, ""
+	}
+	return true, fmt.Sprintf("command timed out after %s", d.timeout)
+}
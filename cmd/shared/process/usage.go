@@ -0,0 +1,151 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of the times in /proc/<pid>/stat. Linux fixes it at
+// 100 for userspace regardless of the kernel's tick rate.
+const clockTicks = 100
+
+// ErrNotRunning is returned for a pid that has exited, or was never started
+var ErrNotRunning = errors.New("process is not running")
+
+// Usage is a running process's resource usage as read from /proc. CPU time and IO are
+// totals since the process started; comparing them to the elapsed time tells a backup
+// that is waiting on disk from one that is busy compressing.
+type Usage struct {
+	PID              int
+	State            string // R running, S sleeping, D waiting on disk IO, see proc(5)
+	Threads          int
+	ElapsedSeconds   float64
+	CPUUserSeconds   float64
+	CPUSystemSeconds float64
+	// BlockIOWaitSeconds is the time spent waiting for block IO, zero when the
+	// kernel's delay accounting is off
+	BlockIOWaitSeconds float64
+	RSSBytes           uint64
+	ReadBytes          uint64 // Bytes the process caused to be read from storage
+	WriteBytes         uint64 // Bytes the process caused to be written to storage
+}
+
+// Alive reports whether pid is still running the given command. Comparing the
+// executable guards against the pid being reused after a reboot.
+func Alive(pid int, command string) bool {
+	fields := strings.Fields(command)
+	if pid <= 0 || len(fields) == 0 {
+		return false
+	}
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	executable := string(bytes.SplitN(cmdline, []byte{0}, 2)[0])
+	return executable == fields[0]
+}
+
+// ReadUsage reads the resource usage of pid from /proc/<pid>/stat and /proc/<pid>/io.
+// The io file is only readable for processes of the same user.
+func ReadUsage(pid int) (*Usage, error) {
+	if pid <= 0 {
+		return nil, ErrNotRunning
+	}
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process stat: %w", err)
+	}
+	usage, startedAt, err := parseStat(pid, string(stat))
+	if err != nil {
+		return nil, err
+	}
+	// An exited process waiting to be reaped has no usage left to report
+	if usage.State == "Z" || usage.State == "X" {
+		return nil, ErrNotRunning
+	}
+
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uptime: %w", err)
+	}
+	if fields := strings.Fields(string(uptime)); len(fields) > 0 {
+		if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil && seconds > startedAt {
+			usage.ElapsedSeconds = seconds - startedAt
+		}
+	}
+
+	ioFile, err := os.Open(filepath.Join(dir, "io"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process io: %w", err)
+	}
+	defer ioFile.Close()
+	scanner := bufio.NewScanner(ioFile)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "read_bytes":
+			usage.ReadBytes = n
+		case "write_bytes":
+			usage.WriteBytes = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read process io: %w", err)
+	}
+
+	return usage, nil
+}
+
+// parseStat reads the fields of a /proc/<pid>/stat line. It also returns when the process
+// started, in seconds since boot.
+func parseStat(pid int, stat string) (*Usage, float64, error) {
+	// The command name is in parentheses and can itself contain spaces and parentheses
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return nil, 0, fmt.Errorf("unexpected process stat format")
+	}
+	// fields[0] is the state, field 3 in proc(5)
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return nil, 0, fmt.Errorf("unexpected process stat format: %d fields", len(fields))
+	}
+	field := func(n int) uint64 {
+		if n-3 >= len(fields) {
+			return 0
+		}
+		value, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return value
+	}
+
+	return &Usage{
+		PID:                pid,
+		State:              fields[0],
+		Threads:            int(field(20)),
+		CPUUserSeconds:     float64(field(14)) / clockTicks,
+		CPUSystemSeconds:   float64(field(15)) / clockTicks,
+		BlockIOWaitSeconds: float64(field(42)) / clockTicks,
+		RSSBytes:           field(24) * uint64(os.Getpagesize()),
+	}, float64(field(22)) / clockTicks, nil
+}
@@ -0,0 +1,85 @@
+package process
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestReadUsage(t *testing.T) {
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer child.Process.Kill()
+	pid := child.Process.Pid
+
+	// Give the child a moment to exec sleep and map its memory
+	deadline := time.Now().Add(2 * time.Second)
+	var usage *Usage
+	for {
+		if Alive(pid, "sleep 30") {
+			var err error
+			if usage, err = ReadUsage(pid); err != nil {
+				t.Fatalf("ReadUsage failed: %v", err)
+			}
+			if usage.RSSBytes > 0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected pid %d to be running sleep", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if usage.PID != pid || usage.State == "" || usage.Threads < 1 {
+		t.Errorf("expected the pid, a state and a thread, got %+v", usage)
+	}
+	if usage.RSSBytes == 0 {
+		t.Errorf("expected resident memory, got %+v", usage)
+	}
+	if usage.ElapsedSeconds < 0 || usage.ElapsedSeconds > 60 {
+		t.Errorf("expected the child to have just started, got %.2fs", usage.ElapsedSeconds)
+	}
+	if Alive(pid, "mariabackup --backup") {
+		t.Error("expected a different executable not to match")
+	}
+
+	if err := child.Process.Kill(); err != nil {
+		t.Fatalf("failed to kill child: %v", err)
+	}
+	child.Wait()
+
+	if _, err := ReadUsage(pid); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning once the child exited, got %v", err)
+	}
+	if Alive(pid, "sleep 30") {
+		t.Error("expected the exited child not to be alive")
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	// A command name with spaces and parentheses, fields up to delayacct_blkio_ticks
+	stat := "4242 (my (odd) cmd) D 1 4242 4242 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 3 0 1000 " +
+		"12345678 512 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 2 0 0 300 0 0"
+
+	usage, startedAt, err := parseStat(4242, stat)
+	if err != nil {
+		t.Fatalf("parseStat failed: %v", err)
+	}
+	if usage.State != "D" || usage.Threads != 3 {
+		t.Errorf("expected state D with 3 threads, got %+v", usage)
+	}
+	if usage.CPUUserSeconds != 2.5 || usage.CPUSystemSeconds != 0.5 || usage.BlockIOWaitSeconds != 3 {
+		t.Errorf("expected 2.5s user, 0.5s system and 3s IO wait, got %+v", usage)
+	}
+	if startedAt != 10 {
+		t.Errorf("expected a start 10s after boot, got %.2f", startedAt)
+	}
+
+	if _, _, err := parseStat(1, "garbage"); err == nil {
+		t.Error("expected an error for a malformed stat line")
+	}
+}
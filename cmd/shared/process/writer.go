@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/martijn/dbcalm/shared/database"
@@ -11,12 +12,20 @@ import (
 
 type Writer struct {
 	dbPath string
+	// compressMinSize gzips stored output and errors of at least this many bytes, zero stores them as text
+	compressMinSize int
 }
 
 func NewWriter(dbPath string) *Writer {
 	return &Writer{dbPath: dbPath}
 }
 
+// SetCompressOutput has process output and errors of at least minSize bytes stored gzipped.
+// Readers decompress them transparently. Zero stores all output as text.
+func (w *Writer) SetCompressOutput(minSize int) {
+	w.compressMinSize = minSize
+}
+
 func (w *Writer) getDB() (*sql.DB, error) {
 	return database.OpenDB(w.dbPath)
 }
@@ -33,10 +42,11 @@ func (w *Writer) CreateProcess(command, commandID string, pid int, status, proce
 		return 0, fmt.Errorf("failed to marshal args: %w", err)
 	}
 
+	// The schedule is copied onto the row so processes can be filtered by it
 	result, err := db.Exec(`
-		INSERT INTO process (command, command_id, pid, status, output, error, return_code, start_time, end_time, type, args)
-		VALUES (?, ?, ?, ?, NULL, NULL, NULL, ?, NULL, ?, ?)
-	`, command, commandID, pid, status, startTime, processType, string(argsJSON))
+		INSERT INTO process (command, command_id, pid, status, output, error, return_code, start_time, end_time, type, args, schedule_id)
+		VALUES (?, ?, ?, ?, NULL, NULL, NULL, ?, NULL, ?, ?, ?)
+	`, command, commandID, pid, status, startTime, processType, string(argsJSON), ScheduleIDArg(args))
 
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert process: %w", err)
@@ -50,7 +60,34 @@ func (w *Writer) CreateProcess(command, commandID string, pid int, status, proce
 	return int(id), nil
 }
 
+// ScheduleIDArg reads the schedule_id arg, which is an int in memory and a float64 once
+// it has been through JSON. It returns nil for processes without a schedule.
+func ScheduleIDArg(args map[string]interface{}) *int {
+	var id int
+	switch v := args["schedule_id"].(type) {
+	case int:
+		id = v
+	case int64:
+		id = int(v)
+	case float64:
+		id = int(v)
+	}
+	if id <= 0 {
+		return nil
+	}
+	return &id
+}
+
 func (w *Writer) UpdateProcessStatus(processID int, status string, output, errorMsg *string, returnCode *int, endTime *time.Time) error {
+	storedOutput, err := encodeOutput(output, w.compressMinSize)
+	if err != nil {
+		return err
+	}
+	storedError, err := encodeOutput(errorMsg, w.compressMinSize)
+	if err != nil {
+		return err
+	}
+
 	db, err := w.getDB()
 	if err != nil {
 		return err
@@ -61,7 +98,7 @@ func (w *Writer) UpdateProcessStatus(processID int, status string, output, error
 		UPDATE process 
 		SET status = ?, output = ?, error = ?, return_code = ?, end_time = ?
 		WHERE id = ?
-	`, status, output, errorMsg, returnCode, endTime, processID)
+	`, status, storedOutput, storedError, returnCode, endTime, processID)
 
 	if err != nil {
 		return fmt.Errorf("failed to update process: %w", err)
@@ -70,6 +107,28 @@ func (w *Writer) UpdateProcessStatus(processID int, status string, output, error
 	return nil
 }
 
+// UpdateProgress records the progress percentage and phase for every process row of a command.
+// Consecutive commands share a command ID, so the latest row always carries the current progress.
+func (w *Writer) UpdateProgress(commandID string, progress int, phase string) error {
+	db, err := w.getDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		UPDATE process
+		SET progress = ?, phase = ?
+		WHERE command_id = ?
+	`, progress, phase, commandID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update process progress: %w", err)
+	}
+
+	return nil
+}
+
 func (w *Writer) GetProcessByCommandID(commandID string) (*Process, error) {
 	db, err := w.getDB()
 	if err != nil {
@@ -77,23 +136,140 @@ func (w *Writer) GetProcessByCommandID(commandID string) (*Process, error) {
 	}
 	defer db.Close()
 
-	var p Process
-	var output, errorMsg sql.NullString
-	var returnCode sql.NullInt64
-	var endTime sql.NullTime
-	var id sql.NullInt64
-
-	err = db.QueryRow(`
+	process, err := scanProcess(db.QueryRow(`
 		SELECT id, command, command_id, pid, status, output, error, return_code, start_time, end_time, type, args
 		FROM process
 		WHERE command_id = ?
 		ORDER BY id DESC
 		LIMIT 1
-	`, commandID).Scan(&id, &p.Command, &p.CommandID, &p.PID, &p.Status, &output, &errorMsg, &returnCode, &p.StartTime, &endTime, &p.Type, &p.ArgsJSON)
+	`, commandID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return process, err
+}
+
+// ListRunning returns the processes of the given types still recorded as running
+func (w *Writer) ListRunning(types ...string) ([]*Process, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	db, err := w.getDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	args := []interface{}{StatusRunning}
+	for _, processType := range types {
+		args = append(args, processType)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(types)), ", ")
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, command, command_id, pid, status, output, error, return_code, start_time, end_time, type, args
+		FROM process
+		WHERE status = ? AND type IN (%s)
+		ORDER BY id
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query running processes: %w", err)
+	}
+	defer rows.Close()
+
+	var processes []*Process
+	for rows.Next() {
+		process, err := scanProcess(rows)
+		if err != nil {
+			return nil, err
+		}
+		processes = append(processes, process)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate running processes: %w", err)
+	}
+
+	return processes, nil
+}
+
+// MarkInterrupted fails a process that was still running when db-cmd stopped,
+// replacing its args so flags such as "resumable" reach the API
+func (w *Writer) MarkInterrupted(processID int, errorMsg string, args map[string]interface{}, endTime time.Time) error {
+	db, err := w.getDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal args: %w", err)
+	}
+
+	// A process that finished in the meantime keeps its own outcome
+	result, err := db.Exec(`
+		UPDATE process
+		SET status = ?, error = ?, return_code = ?, end_time = ?, args = ?
+		WHERE id = ? AND status = ?
+	`, StatusFailed, errorMsg, -1, endTime, string(argsJSON), processID, StatusRunning)
+
+	if err != nil {
+		return fmt.Errorf("failed to mark process interrupted: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("process %d is no longer running", processID)
+	}
+
+	return nil
+}
+
+// RecordOutcome replaces the args of a finished process and, when errorMsg is set, its
+// error, to record what db-cmd did once the process ended
+func (w *Writer) RecordOutcome(processID int, args map[string]interface{}, errorMsg *string) error {
+	storedError, err := encodeOutput(errorMsg, w.compressMinSize)
+	if err != nil {
+		return err
+	}
+
+	db, err := w.getDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to marshal args: %w", err)
+	}
+
+	_, err = db.Exec(`
+		UPDATE process
+		SET args = ?, error = COALESCE(?, error)
+		WHERE id = ?
+	`, string(argsJSON), storedError, processID)
 
+	if err != nil {
+		return fmt.Errorf("failed to record process outcome: %w", err)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProcess(row rowScanner) (*Process, error) {
+	var p Process
+	var output, errorMsg sql.NullString
+	var returnCode sql.NullInt64
+	var endTime sql.NullTime
+	var id sql.NullInt64
+
+	err := row.Scan(&id, &p.Command, &p.CommandID, &p.PID, &p.Status, &output, &errorMsg, &returnCode, &p.StartTime, &endTime, &p.Type, &p.ArgsJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil
+			return nil, err
 		}
 		return nil, fmt.Errorf("failed to query process: %w", err)
 	}
@@ -103,10 +279,18 @@ func (w *Writer) GetProcessByCommandID(commandID string) (*Process, error) {
 		p.ID = &idInt
 	}
 	if output.Valid {
-		p.Output = &output.String
+		text, err := decodeOutput(output.String)
+		if err != nil {
+			return nil, err
+		}
+		p.Output = &text
 	}
 	if errorMsg.Valid {
-		p.Error = &errorMsg.String
+		text, err := decodeOutput(errorMsg.String)
+		if err != nil {
+			return nil, err
+		}
+		p.Error = &text
 	}
 	if returnCode.Valid {
 		rc := int(returnCode.Int64)
@@ -6,8 +6,9 @@ type CommandRequest struct {
 }
 
 type CommandResponse struct {
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
-	ID      string `json:"id,omitempty"`
-	Message string `json:"message,omitempty"`
+	Code    int                    `json:"code"`
+	Status  string                 `json:"status"`
+	ID      string                 `json:"id,omitempty"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
 }
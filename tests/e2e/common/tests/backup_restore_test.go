@@ -525,7 +525,9 @@ func TestBackupRequiresCredentialsFile(t *testing.T) {
 
 	defer func() {
 		// Restore credentials file - ensure this runs before test returns
-		// Use mode 0644 so mysql user can read it (dbcalm-db-cmd runs as mysql)
+		// Use mode 0644 so mysql user can read it (dbcalm-db-cmd runs as mysql). Recreated
+		// by root the file loses the installer's mysql:dbcalm 0640, db-cmd logs a warning
+		// for the world-readable passwords under the default credentials_permissions: warn.
 		if originalContent != nil {
 			if err := os.WriteFile(credentialsFile, originalContent, 0644); err != nil {
 				t.Errorf("Failed to restore credentials file: %v", err)